@@ -0,0 +1,156 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CommandIssuerProfileSpec holds enrollment settings shared by the Issuers and ClusterIssuers that
+// reference the profile. Fields set on an issuer take precedence over the profile.
+type CommandIssuerProfileSpec struct {
+	// CertificateTemplate is the name of the certificate template to use
+	// +optional
+	CertificateTemplate string `json:"certificateTemplate,omitempty"`
+
+	// CertificateAuthorityLogicalName is the logical name of the certificate authority to use
+	// +optional
+	CertificateAuthorityLogicalName string `json:"certificateAuthorityLogicalName,omitempty"`
+
+	// CertificateAuthorityHostname is the hostname associated with the certificate authority
+	// specified by CertificateAuthorityLogicalName
+	// +optional
+	CertificateAuthorityHostname string `json:"certificateAuthorityHostname,omitempty"`
+
+	// AllowedCertificateAuthorities lists the certificate authorities that CertificateRequests
+	// may select with the command-issuer.keyfactor.com/certificate-authority annotation. An
+	// issuer that lists its own certificate authorities replaces the list of the profile.
+	// +optional
+	AllowedCertificateAuthorities []string `json:"allowedCertificateAuthorities,omitempty"`
+
+	// AllowedSANTypes lists the SAN types that CSRs may contain. An issuer that lists its own
+	// SAN types replaces the list of the profile.
+	// +optional
+	AllowedSANTypes []SANType `json:"allowedSanTypes,omitempty"`
+
+	// EnrollmentParameters are additional properties that are added verbatim to the body of
+	// every enrollment request. They are merged with the enrollment parameters of an issuer,
+	// whose values take precedence.
+	// +optional
+	EnrollmentParameters map[string]string `json:"enrollmentParameters,omitempty"`
+
+	// MetadataFromLabels maps keys of the labels of the issuer to the names of Command
+	// metadata fields. It is merged with the mapping of an issuer, whose entries take
+	// precedence.
+	// +optional
+	MetadataFromLabels map[string]string `json:"metadataFromLabels,omitempty"`
+
+	// MetadataFromAnnotations maps keys of the annotations of the issuer to the names of
+	// Command metadata fields. It is merged with the mapping of an issuer, whose entries
+	// take precedence.
+	// +optional
+	MetadataFromAnnotations map[string]string `json:"metadataFromAnnotations,omitempty"`
+
+	// CertificateCollection is the name of a Command certificate collection that groups the
+	// certificates enrolled by the issuers of the profile
+	// +optional
+	CertificateCollection string `json:"certificateCollection,omitempty"`
+
+	// DefaultDuration is the lifetime requested from Command for certificates whose
+	// CertificateRequest doesn't set a duration
+	// +optional
+	DefaultDuration *metav1.Duration `json:"defaultDuration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CommandIssuerProfile is the Schema for the commandissuerprofiles API
+type CommandIssuerProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CommandIssuerProfileSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CommandIssuerProfileList contains a list of CommandIssuerProfile
+type CommandIssuerProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CommandIssuerProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CommandIssuerProfile{}, &CommandIssuerProfileList{})
+}
+
+// MergeProfile returns a copy of the issuer spec with the settings of the profile that the issuer
+// doesn't set. Lists set on the issuer replace those of the profile, while maps are merged with the
+// entries of the issuer taking precedence. The certificate authority hostname of the profile is only
+// used together with its logical name.
+func MergeProfile(spec *IssuerSpec, profile *CommandIssuerProfileSpec) *IssuerSpec {
+	merged := spec.DeepCopy()
+
+	if merged.CertificateTemplate == "" {
+		merged.CertificateTemplate = profile.CertificateTemplate
+	}
+	if merged.CertificateAuthorityLogicalName == "" {
+		merged.CertificateAuthorityLogicalName = profile.CertificateAuthorityLogicalName
+		if merged.CertificateAuthorityHostname == "" {
+			merged.CertificateAuthorityHostname = profile.CertificateAuthorityHostname
+		}
+	}
+	if len(merged.AllowedCertificateAuthorities) == 0 {
+		merged.AllowedCertificateAuthorities = slices.Clone(profile.AllowedCertificateAuthorities)
+	}
+	if len(merged.AllowedSANTypes) == 0 {
+		merged.AllowedSANTypes = slices.Clone(profile.AllowedSANTypes)
+	}
+	if merged.CertificateCollection == "" {
+		merged.CertificateCollection = profile.CertificateCollection
+	}
+	if merged.DefaultDuration == nil && profile.DefaultDuration != nil {
+		duration := *profile.DefaultDuration
+		merged.DefaultDuration = &duration
+	}
+
+	merged.EnrollmentParameters = mergeStringMaps(profile.EnrollmentParameters, merged.EnrollmentParameters)
+	merged.MetadataFromLabels = mergeStringMaps(profile.MetadataFromLabels, merged.MetadataFromLabels)
+	merged.MetadataFromAnnotations = mergeStringMaps(profile.MetadataFromAnnotations, merged.MetadataFromAnnotations)
+
+	return merged
+}
+
+// mergeStringMaps returns a map with the entries of both maps, with the entries of overrides taking
+// precedence. It returns nil if both maps are empty.
+func mergeStringMaps(defaults, overrides map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return overrides
+	}
+
+	merged := make(map[string]string, len(defaults)+len(overrides))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
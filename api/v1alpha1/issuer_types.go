@@ -24,6 +24,12 @@ import (
 type IssuerSpec struct {
 	// Hostname is the hostname of a Keyfactor Command instance.
 	Hostname string `json:"hostname,omitempty"`
+	// FallbackHostnames are the hostnames of further instances of the same Keyfactor Command
+	// deployment, e.g. in another region. Requests that can't be served by Hostname are
+	// sent to the fallback hostnames in order. They must accept the same credentials and
+	// be trusted by the same CA bundle as Hostname.
+	// +optional
+	FallbackHostnames []string `json:"fallbackHostnames,omitempty"`
 	// CertificateTemplate is the name of the certificate template to use.
 	// Refer to the Keyfactor Command documentation for more information.
 	CertificateTemplate string `json:"certificateTemplate,omitempty"`
@@ -34,6 +40,15 @@ type IssuerSpec struct {
 	// CertificateAuthorityLogicalName E.g. "ca.example.com"
 	CertificateAuthorityHostname string `json:"certificateAuthorityHostname,omitempty"`
 
+	// AllowedCertificateAuthorities lists the certificate authorities that CertificateRequests
+	// may select with the command-issuer.keyfactor.com/certificate-authority annotation, each
+	// in the format "<logical name>" or "<hostname>\<logical name>". If empty, the annotation
+	// is rejected. If set, the certificate authorities selected by the
+	// command-issuer.keyfactor.com/certificateAuthorityLogicalName and
+	// command-issuer.keyfactor.com/certificateAuthorityHostname annotations must be listed too.
+	// +optional
+	AllowedCertificateAuthorities []string `json:"allowedCertificateAuthorities,omitempty"`
+
 	// A reference to a K8s kubernetes.io/basic-auth Secret containing basic auth
 	// credentials for the Command instance configured in Hostname. The secret must
 	// be in the same namespace as the referent. If the
@@ -43,11 +58,464 @@ type IssuerSpec struct {
 	// namespace that the controller runs in).
 	SecretName string `json:"commandSecretName,omitempty"`
 
+	// ReadSecretName optionally references a kubernetes.io/basic-auth Secret containing
+	// separate credentials for the read-only Command operations, i.e. health checks and
+	// polling enrollments that are pending approval. The Secret is read from the same
+	// namespace as SecretName. If unset, the credentials in SecretName are used for all
+	// operations.
+	// +optional
+	ReadSecretName string `json:"commandReadSecretName,omitempty"`
+
+	// UsernameKey is the key of the Secrets referenced by SecretName and ReadSecretName
+	// that holds the Command username. Defaults to "username".
+	// +optional
+	UsernameKey string `json:"usernameKey,omitempty"`
+
+	// PasswordKey is the key of the Secrets referenced by SecretName and ReadSecretName
+	// that holds the Command password. Defaults to "password".
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+
+	// HostnameKey optionally names a key of the Secrets referenced by SecretName and
+	// ReadSecretName that holds the hostname of the Command instance. If set, the
+	// hostname is read from the Secret instead of Hostname, which is used as a fallback
+	// if the Secret has no such key. If HostnameConfigMapName is set, HostnameKey names
+	// the key of the ConfigMap instead.
+	// +optional
+	HostnameKey string `json:"hostnameKey,omitempty"`
+
+	// HostnameConfigMapName optionally names a ConfigMap in the namespace of the Secrets
+	// that holds the hostname of the Command instance in the key named by HostnameKey,
+	// or "hostname" by default. If the ConfigMap has no such key, Hostname is used.
+	// +optional
+	HostnameConfigMapName string `json:"hostnameConfigMapName,omitempty"`
+
+	// SecretNamespace optionally overrides the namespace that a ClusterIssuer reads
+	// the Secrets referenced by SecretName, ReadSecretName and CaSecretName from. If unset, the
+	// 'cluster issuer secret namespace' is used, which defaults to the 'cluster resource
+	// namespace'. The controller must be granted access to Secrets in this namespace. Only
+	// valid for ClusterIssuers.
+	// +optional
+	SecretNamespace string `json:"commandSecretNamespace,omitempty"`
+
 	// The name of the secret containing the CA bundle to use when verifying
 	// Command's server certificate. If specified, the CA bundle will be added to
 	// the client trust roots for the Command issuer.
 	// +optional
 	CaSecretName string `json:"caSecretName"`
+
+	// InsecureSkipVerify disables verification of Command's server certificate. This is
+	// unsafe and must only be used in test or development environments where no CA bundle
+	// is available for Command. Use CaSecretName instead whenever possible.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// RequestHeaders are static HTTP headers sent with every request to Command, e.g. the
+	// API key of an API gateway in front of Command. Headers managed by the issuer, such as
+	// Authorization and Content-Type, can't be set.
+	// +optional
+	RequestHeaders []RequestHeader `json:"requestHeaders,omitempty"`
+
+	// SubjectPattern is an optional regular expression that the Common Name of every
+	// CSR signed by this issuer must match. CertificateRequests that don't match are
+	// rejected before they are enrolled with Command. The pattern is not anchored, so
+	// use ^ and $ to require a full match.
+	// +optional
+	SubjectPattern string `json:"subjectPattern,omitempty"`
+
+	// ApplySubjectPatternToSANs additionally requires every SAN of the CSR (DNS names,
+	// IP addresses, URIs and email addresses) to match SubjectPattern.
+	// +optional
+	ApplySubjectPatternToSANs bool `json:"applySubjectPatternToSANs,omitempty"`
+
+	// RequireCommonName rejects CSRs without a Common Name before they are enrolled
+	// with Command, e.g. if the certificate template requires one. The Common Name
+	// can't be derived from the SANs since the CSR is signed by the requester.
+	// +optional
+	RequireCommonName bool `json:"requireCommonName,omitempty"`
+
+	// IncludeCommonNameInSANs adds the Common Name of CSRs to the SANs enrolled with
+	// Command unless the CSR already contains it, since clients verify the SANs rather
+	// than the Common Name (RFC 6125). A Common Name that is a DNS name is added as a DNS
+	// SAN and an IP address as an IP SAN. Other Common Names, such as "My Service", aren't
+	// added.
+	// +optional
+	IncludeCommonNameInSANs bool `json:"includeCommonNameInSANs,omitempty"`
+
+	// AllowedSANTypes optionally restricts the types of subject alternative names that
+	// CSRs signed by this issuer may contain, e.g. to the SAN types allowed by the
+	// certificate template. CertificateRequests with other SAN types are rejected before
+	// they are enrolled with Command. If empty, all SAN types are allowed.
+	// +optional
+	AllowedSANTypes []SANType `json:"allowedSanTypes,omitempty"`
+
+	// PermittedDNSDomains optionally restricts the DNS names that CSRs signed by this
+	// issuer may request, e.g. to the domains owned by the team using the issuer. An entry
+	// such as example.com permits exactly that name, and an entry such as *.example.com
+	// permits every name below example.com. The DNS SANs of the CSR, and its Common Name if
+	// it is a DNS name, must each be permitted by an entry. CertificateRequests with other
+	// names are rejected before they are enrolled with Command. If empty, all DNS names
+	// are permitted.
+	// +optional
+	PermittedDNSDomains []string `json:"permittedDNSDomains,omitempty"`
+
+	// AdditionalSANs are subject alternative names that are added to every certificate
+	// enrolled by this issuer, e.g. an organizational URI required by policy. Their types
+	// must be allowed by allowedSanTypes. They aren't matched against the subject pattern.
+	// +optional
+	AdditionalSANs *AdditionalSANs `json:"additionalSans,omitempty"`
+
+	// KeyPolicy optionally restricts the public keys and signature algorithms of CSRs
+	// signed by this issuer, e.g. to forbid RSA-1024 keys and SHA-1 signatures that the
+	// certificate template accepts. CertificateRequests that don't conform are rejected
+	// before they are enrolled with Command.
+	// +optional
+	KeyPolicy *KeyPolicy `json:"keyPolicy,omitempty"`
+
+	// SANMismatchPolicy determines what happens when the certificate issued by Command
+	// doesn't contain the Common Name and SANs requested by the CSR, e.g. because the
+	// certificate template removed or rewrote them. Warn records the differences in an
+	// Event and a condition of the request, Fail marks the request as failed, and Ignore
+	// doesn't compare them. Defaults to Warn.
+	// +optional
+	SANMismatchPolicy SANMismatchPolicy `json:"sanMismatchPolicy,omitempty"`
+
+	// EnableRenewal renews certificates that were previously enrolled by this issuer
+	// instead of enrolling a new certificate in Command, preserving the certificate
+	// lineage and metadata in Command. The certificate template must support renewal.
+	// If no previously enrolled certificate is known, a new certificate is enrolled.
+	// +optional
+	EnableRenewal bool `json:"enableRenewal,omitempty"`
+
+	// RenewalMode determines how certificates are renewed in Command if EnableRenewal is
+	// true. ReKey enrolls the CSR of the renewal as a renewal of the previous certificate,
+	// so the renewed certificate has the key of the CSR. SameKey uses the renewal flow
+	// of Command, which reissues the previous certificate with its key, and requires the
+	// CSR to reuse the key of the previous certificate. If the key changed, the CSR is
+	// enrolled as with ReKey. Defaults to ReKey.
+	// +optional
+	RenewalMode RenewalMode `json:"renewalMode,omitempty"`
+
+	// EnrollmentParameters are additional properties that are added verbatim to the
+	// body of every enrollment request sent to Command, e.g. template-specific enrollment
+	// parameters. Properties that are managed by the issuer, like CSR, Template or
+	// Metadata, can't be set.
+	// +optional
+	EnrollmentParameters map[string]string `json:"enrollmentParameters,omitempty"`
+
+	// ExtendedKeyUsageParameter optionally sets an enrollment parameter from the extended
+	// key usages of the CSR, e.g. to select the server or client authentication behavior
+	// of a certificate template. CSRs whose extended key usages map to different values
+	// are rejected before they are enrolled with Command.
+	// +optional
+	ExtendedKeyUsageParameter *ExtendedKeyUsageParameter `json:"extendedKeyUsageParameter,omitempty"`
+
+	// RequiredCertificatePolicy optionally requires every certificate issued by Command to
+	// assert a certificate policy OID, e.g. as mandated in regulated environments. Requests
+	// whose issued certificate doesn't contain the policy are marked as failed.
+	// +optional
+	RequiredCertificatePolicy *RequiredCertificatePolicy `json:"requiredCertificatePolicy,omitempty"`
+
+	// EnrollmentFormat determines how the CSR is encoded in enrollment requests to Command,
+	// e.g. if a certificate template doesn't accept the default format. PEM sends the PEM
+	// encoded CSR including its header and footer, and PKCS10 sends the base64 encoded DER
+	// PKCS#10 request without them. Defaults to PEM.
+	// +optional
+	EnrollmentFormat EnrollmentFormat `json:"enrollmentFormat,omitempty"`
+
+	// EnrollmentRequestTemplate is an optional Go template that renders the JSON body of
+	// the enrollment requests sent to Command instead of the built-in body, e.g. for
+	// Command configurations that expect a different shape. It is rendered with the CSR,
+	// its names, and the properties and metadata of the built-in request. The rendered
+	// body must be a JSON object containing the CSR.
+	// +optional
+	EnrollmentRequestTemplate string `json:"enrollmentRequestTemplate,omitempty"`
+
+	// MetadataFromLabels maps keys of the labels of the Issuer to the names of Command
+	// metadata fields. The values of the labels are recorded in these metadata fields on
+	// every certificate enrolled by the issuer. Labels that aren't set are skipped.
+	// +optional
+	MetadataFromLabels map[string]string `json:"metadataFromLabels,omitempty"`
+
+	// MetadataFromAnnotations maps keys of the annotations of the Issuer to the names of
+	// Command metadata fields. The values of the annotations are recorded in these metadata
+	// fields on every certificate enrolled by the issuer. Annotations that aren't set are
+	// skipped.
+	// +optional
+	MetadataFromAnnotations map[string]string `json:"metadataFromAnnotations,omitempty"`
+
+	// ChangeReference optionally records a change management reference, e.g. an ITSM ticket
+	// number, in a Command metadata field of every certificate enrolled by the issuer, and
+	// in the comment of certificates revoked by the issuer. Requests set the reference with
+	// the command-issuer.keyfactor.com/change-reference annotation.
+	// +optional
+	ChangeReference *ChangeReference `json:"changeReference,omitempty"`
+
+	// CertificateCollection is the name of a Command certificate collection that groups
+	// the certificates enrolled by this issuer, e.g. for expiry reporting. Command can't
+	// add certificates to a collection on enrollment, so the name is recorded in the
+	// Certificate-Collection metadata field, which the query of the collection should
+	// select. The health check verifies that the collection exists.
+	// +optional
+	CertificateCollection string `json:"certificateCollection,omitempty"`
+
+	// DefaultDuration is the lifetime requested from Command for certificates whose
+	// CertificateRequest doesn't set a duration. A duration set on the request takes
+	// precedence. If empty, the lifetime is determined by the certificate template.
+	// +optional
+	DefaultDuration *metav1.Duration `json:"defaultDuration,omitempty"`
+
+	// AllowCA allows requests with isCA set to enroll CA certificates, e.g. for subordinate CAs
+	// of downstream issuers. If false, these requests are rejected before they are enrolled with
+	// Command.
+	// +optional
+	AllowCA bool `json:"allowCA,omitempty"`
+
+	// CACertificateTemplate is the name of the certificate template that CA certificates are
+	// enrolled with. If empty, CertificateTemplate is used, which must then issue CA certificates.
+	// Requires AllowCA.
+	// +optional
+	CACertificateTemplate string `json:"caCertificateTemplate,omitempty"`
+
+	// EnrollmentLimits optionally limits the rate and concurrency of the calls to Command
+	// made by this issuer to enroll certificates, so that a burst of requests of one tenant
+	// can't starve the enrollments of the other issuers. The limits are enforced by each
+	// replica of the controller.
+	// +optional
+	EnrollmentLimits *EnrollmentLimits `json:"enrollmentLimits,omitempty"`
+
+	// ProfileName is the name of a CommandIssuerProfile holding enrollment settings shared
+	// with other issuers. Settings that aren't set on the issuer are read from the profile.
+	// Issuers reference a profile in their own namespace, and ClusterIssuers a profile in
+	// the cluster resource namespace.
+	// +optional
+	ProfileName string `json:"profileName,omitempty"`
+}
+
+// SANType is a type of subject alternative name. OtherName SANs are limited to
+// user principal names.
+// +kubebuilder:validation:Enum=DNS;IP;URI;Email;OtherName
+type SANType string
+
+const (
+	SANTypeDNS       SANType = "DNS"
+	SANTypeIP        SANType = "IP"
+	SANTypeURI       SANType = "URI"
+	SANTypeEmail     SANType = "Email"
+	SANTypeOtherName SANType = "OtherName"
+)
+
+// AdditionalSANs are subject alternative names added to every enrollment of an issuer
+type AdditionalSANs struct {
+	// DNSNames are DNS names to add to every certificate
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// IPAddresses are IP addresses to add to every certificate
+	// +optional
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+
+	// URIs are URIs to add to every certificate
+	// +optional
+	URIs []string `json:"uris,omitempty"`
+
+	// EmailAddresses are email addresses to add to every certificate
+	// +optional
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+}
+
+// KeyPolicy restricts the public keys and signature algorithms of the CSRs signed by an issuer
+type KeyPolicy struct {
+	// AllowedKeyAlgorithms are the public key algorithms that CSRs may use. If empty,
+	// all key algorithms are allowed.
+	// +optional
+	AllowedKeyAlgorithms []KeyAlgorithm `json:"allowedKeyAlgorithms,omitempty"`
+
+	// MinRSAKeySize is the minimum size of RSA keys in bits, e.g. 2048
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinRSAKeySize int `json:"minRsaKeySize,omitempty"`
+
+	// MinECDSAKeySize is the minimum size of the curve of ECDSA keys in bits, e.g. 384
+	// to forbid P-256 keys
+	// +kubebuilder:validation:Enum=224;256;384;521
+	// +optional
+	MinECDSAKeySize int `json:"minEcdsaKeySize,omitempty"`
+
+	// AllowedSignatureAlgorithms are the algorithms that CSRs may be signed with. If
+	// empty, all signature algorithms are allowed.
+	// +optional
+	AllowedSignatureAlgorithms []SignatureAlgorithm `json:"allowedSignatureAlgorithms,omitempty"`
+}
+
+// KeyAlgorithm is a public key algorithm
+// +kubebuilder:validation:Enum=RSA;ECDSA;Ed25519
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA     KeyAlgorithm = "RSA"
+	KeyAlgorithmECDSA   KeyAlgorithm = "ECDSA"
+	KeyAlgorithmEd25519 KeyAlgorithm = "Ed25519"
+)
+
+// SignatureAlgorithm is the algorithm that a CSR is signed with, named like
+// x509.SignatureAlgorithm
+// +kubebuilder:validation:Enum=SHA1-RSA;SHA256-RSA;SHA384-RSA;SHA512-RSA;SHA256-RSAPSS;SHA384-RSAPSS;SHA512-RSAPSS;ECDSA-SHA1;ECDSA-SHA256;ECDSA-SHA384;ECDSA-SHA512;Ed25519
+type SignatureAlgorithm string
+
+const (
+	SignatureAlgorithmSHA1WithRSA      SignatureAlgorithm = "SHA1-RSA"
+	SignatureAlgorithmSHA256WithRSA    SignatureAlgorithm = "SHA256-RSA"
+	SignatureAlgorithmSHA384WithRSA    SignatureAlgorithm = "SHA384-RSA"
+	SignatureAlgorithmSHA512WithRSA    SignatureAlgorithm = "SHA512-RSA"
+	SignatureAlgorithmSHA256WithRSAPSS SignatureAlgorithm = "SHA256-RSAPSS"
+	SignatureAlgorithmSHA384WithRSAPSS SignatureAlgorithm = "SHA384-RSAPSS"
+	SignatureAlgorithmSHA512WithRSAPSS SignatureAlgorithm = "SHA512-RSAPSS"
+	SignatureAlgorithmECDSAWithSHA1    SignatureAlgorithm = "ECDSA-SHA1"
+	SignatureAlgorithmECDSAWithSHA256  SignatureAlgorithm = "ECDSA-SHA256"
+	SignatureAlgorithmECDSAWithSHA384  SignatureAlgorithm = "ECDSA-SHA384"
+	SignatureAlgorithmECDSAWithSHA512  SignatureAlgorithm = "ECDSA-SHA512"
+	SignatureAlgorithmPureEd25519      SignatureAlgorithm = "Ed25519"
+)
+
+// EnrollmentLimits limits the calls to Command made by an issuer to enroll certificates and
+// poll pending enrollments
+type EnrollmentLimits struct {
+	// RequestsPerMinute is the sustained rate at which the issuer may call Command. If zero,
+	// the rate isn't limited.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RequestsPerMinute int32 `json:"requestsPerMinute,omitempty"`
+
+	// Burst is how many calls may be made at once before RequestsPerMinute applies.
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+
+	// MaxConcurrentEnrollments is how many calls of the issuer may be in flight at once. If
+	// zero, the concurrency isn't limited.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConcurrentEnrollments int32 `json:"maxConcurrentEnrollments,omitempty"`
+
+	// WhenExceeded determines what happens to requests that exceed the limits. Queue retries
+	// them once the issuer has capacity again, without occupying a worker in the meantime,
+	// and FailFast marks them as failed. Defaults to Queue.
+	// +optional
+	WhenExceeded EnrollmentLimitPolicy `json:"whenExceeded,omitempty"`
+}
+
+// EnrollmentLimitPolicy determines what happens to requests that exceed the enrollment limits of
+// an issuer
+// +kubebuilder:validation:Enum=Queue;FailFast
+type EnrollmentLimitPolicy string
+
+const (
+	EnrollmentLimitPolicyQueue    EnrollmentLimitPolicy = "Queue"
+	EnrollmentLimitPolicyFailFast EnrollmentLimitPolicy = "FailFast"
+)
+
+// SANMismatchPolicy determines what happens when the names of an issued certificate
+// don't match the names requested by the CSR
+// +kubebuilder:validation:Enum=Warn;Fail;Ignore
+type SANMismatchPolicy string
+
+const (
+	SANMismatchPolicyWarn   SANMismatchPolicy = "Warn"
+	SANMismatchPolicyFail   SANMismatchPolicy = "Fail"
+	SANMismatchPolicyIgnore SANMismatchPolicy = "Ignore"
+)
+
+// RenewalMode determines how a certificate previously enrolled by an issuer is renewed
+// +kubebuilder:validation:Enum=ReKey;SameKey
+type RenewalMode string
+
+const (
+	RenewalModeReKey   RenewalMode = "ReKey"
+	RenewalModeSameKey RenewalMode = "SameKey"
+)
+
+// ExtendedKeyUsageParameter derives the value of an enrollment parameter from the extended key
+// usages of a CSR
+type ExtendedKeyUsageParameter struct {
+	// Name is the name of the enrollment parameter, e.g. "SubTemplate". It can't be a
+	// property managed by the issuer or a key of EnrollmentParameters.
+	Name string `json:"name"`
+
+	// Values maps extended key usages to the value of the parameter. Keys are the names of
+	// extended key usages used by cert-manager, e.g. "server auth" or "client auth", or
+	// OIDs in dotted notation. Extended key usages of the CSR that aren't mapped are
+	// ignored.
+	Values map[string]string `json:"values"`
+
+	// Default is the value of the parameter for CSRs without a mapped extended key usage.
+	// If empty, these CSRs are enrolled without the parameter.
+	// +optional
+	Default string `json:"default,omitempty"`
+}
+
+// RequiredCertificatePolicy is a certificate policy that issued certificates must assert
+type RequiredCertificatePolicy struct {
+	// OID is the certificate policy OID in dotted notation, e.g. "2.23.140.1.2.2"
+	OID string `json:"oid"`
+
+	// EnrollmentParameter is the name of an optional enrollment parameter that is set to
+	// the OID, for certificate templates that select the certificate policy by an
+	// enrollment parameter. It can't be a property managed by the issuer or a key of
+	// EnrollmentParameters.
+	// +optional
+	EnrollmentParameter string `json:"enrollmentParameter,omitempty"`
+}
+
+// ChangeReference configures the change management reference attached to the certificate
+// operations of an issuer in Command
+type ChangeReference struct {
+	// MetadataField is the name of the Command metadata field that the change reference is
+	// recorded in, e.g. "ChangeTicket". It takes precedence over a metadata annotation of
+	// the request for the same field.
+	MetadataField string `json:"metadataField"`
+
+	// Required rejects requests without a change reference before they are enrolled with
+	// Command
+	// +optional
+	Required bool `json:"required,omitempty"`
+
+	// Pattern is an optional regular expression that change references must match, e.g.
+	// "^CHG[0-9]{7}$". Requests with a change reference that doesn't match are rejected
+	// before they are enrolled with Command. The pattern is not anchored.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+
+	// Default is the change reference of requests without the change-reference annotation,
+	// e.g. a standing change that covers routine renewals. It must match Pattern.
+	// +optional
+	Default string `json:"default,omitempty"`
+}
+
+// EnrollmentFormat determines how a CSR is encoded in an enrollment request to Command
+// +kubebuilder:validation:Enum=PEM;PKCS10
+type EnrollmentFormat string
+
+const (
+	EnrollmentFormatPEM    EnrollmentFormat = "PEM"
+	EnrollmentFormatPKCS10 EnrollmentFormat = "PKCS10"
+)
+
+// RequestHeader is a static HTTP header sent with every request to Command. Exactly one of
+// Value and SecretKey must be set.
+type RequestHeader struct {
+	// Name is the name of the HTTP header, e.g. "X-Api-Key"
+	Name string `json:"name"`
+
+	// Value is the value of the header
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// SecretKey is the key of the Secrets referenced by SecretName and ReadSecretName that
+	// holds the value of the header, e.g. to keep an API key out of the issuer.
+	// +optional
+	SecretKey string `json:"secretKey,omitempty"`
 }
 
 // IssuerStatus defines the observed state of Issuer
@@ -56,6 +524,11 @@ type IssuerStatus struct {
 	// Known condition types are `Ready`.
 	// +optional
 	Conditions []IssuerCondition `json:"conditions,omitempty"`
+
+	// CommandVersion is the version of the Keyfactor Command instance that the
+	// issuer is connected to, if it could be determined.
+	// +optional
+	CommandVersion string `json:"commandVersion,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -101,6 +574,12 @@ type IssuerCondition struct {
 	// transition, complementing reason.
 	// +optional
 	Message string `json:"message,omitempty"`
+
+	// ObservedGeneration is the .metadata.generation of the issuer that the
+	// condition was set for. A condition with an older generation doesn't
+	// reflect the current spec.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 // IssuerConditionType represents an Issuer condition value.
@@ -0,0 +1,639 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/validate-command-issuer-keyfactor-com-v1alpha1-issuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=command-issuer.keyfactor.com,resources=issuers,verbs=create;update,versions=v1alpha1,name=vissuer.command-issuer.keyfactor.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-command-issuer-keyfactor-com-v1alpha1-clusterissuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=command-issuer.keyfactor.com,resources=clusterissuers,verbs=create;update,versions=v1alpha1,name=vclusterissuer.command-issuer.keyfactor.com,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the validating webhook for Issuers with the manager.
+func (r *Issuer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&issuerValidator{}).
+		Complete()
+}
+
+// SetupWebhookWithManager registers the validating webhook for ClusterIssuers with the manager.
+func (r *ClusterIssuer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&issuerValidator{}).
+		Complete()
+}
+
+// reservedEnrollmentParameters are the properties of a Command enrollment request that are
+// managed by the issuer and can't be set in EnrollmentParameters
+var reservedEnrollmentParameters = []string{
+	"CSR",
+	"CertificateAuthority",
+	"IncludeChain",
+	"Metadata",
+	"AdditionalEnrollmentFields",
+	"Timestamp",
+	"Template",
+	"SANs",
+	"RenewalCertificateId",
+	"ValidityPeriod",
+	"ValidityPeriodUnits",
+}
+
+// enrollmentRequestTemplateFuncs are the functions available to enrollment request templates in
+// addition to the built-in functions of text/template
+var enrollmentRequestTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote and escape a string
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// ParseEnrollmentRequestTemplate parses the EnrollmentRequestTemplate of an issuer. Referencing a
+// value that the template isn't rendered with is an error when the template is rendered.
+func ParseEnrollmentRequestTemplate(text string) (*template.Template, error) {
+	return template.New("enrollmentRequestTemplate").Option("missingkey=error").Funcs(enrollmentRequestTemplateFuncs).Parse(text)
+}
+
+// IsReservedEnrollmentParameter returns true if the enrollment request property is managed by
+// the issuer. Command matches property names case-insensitively, so the comparison is too.
+func IsReservedEnrollmentParameter(name string) bool {
+	for _, reserved := range reservedEnrollmentParameters {
+		if strings.EqualFold(name, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedRequestHeaders are the HTTP headers of requests to Command that are managed by the
+// issuer or the HTTP client and can't be set in RequestHeaders
+var reservedRequestHeaders = []string{
+	"Authorization",
+	"Content-Type",
+	"Content-Length",
+	"Accept",
+	"Host",
+	"User-Agent",
+	"x-keyfactor-api-version",
+	"x-keyfactor-requested-with",
+}
+
+// IsReservedRequestHeader returns true if the HTTP header is managed by the issuer. Header names
+// are case-insensitive, so the comparison is too.
+func IsReservedRequestHeader(name string) bool {
+	for _, reserved := range reservedRequestHeaders {
+		if strings.EqualFold(name, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerNamePattern matches a valid HTTP header name
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// KeyAlgorithm returns the public key algorithm of keys that sign with the signature algorithm
+func (a SignatureAlgorithm) KeyAlgorithm() KeyAlgorithm {
+	switch {
+	case a == SignatureAlgorithmPureEd25519:
+		return KeyAlgorithmEd25519
+	case strings.HasPrefix(string(a), "ECDSA-"):
+		return KeyAlgorithmECDSA
+	default:
+		return KeyAlgorithmRSA
+	}
+}
+
+// extendedKeyUsageOIDs maps the names that cert-manager uses for extended key usages to their OIDs
+var extendedKeyUsageOIDs = map[string]string{
+	"any":              "2.5.29.37.0",
+	"server auth":      "1.3.6.1.5.5.7.3.1",
+	"client auth":      "1.3.6.1.5.5.7.3.2",
+	"code signing":     "1.3.6.1.5.5.7.3.3",
+	"email protection": "1.3.6.1.5.5.7.3.4",
+	"ipsec end system": "1.3.6.1.5.5.7.3.5",
+	"ipsec tunnel":     "1.3.6.1.5.5.7.3.6",
+	"ipsec user":       "1.3.6.1.5.5.7.3.7",
+	"timestamping":     "1.3.6.1.5.5.7.3.8",
+	"ocsp signing":     "1.3.6.1.5.5.7.3.9",
+	"microsoft sgc":    "1.3.6.1.4.1.311.10.3.3",
+	"netscape sgc":     "2.16.840.1.113730.4.1",
+}
+
+// oidPattern matches an OID in dotted notation
+var oidPattern = regexp.MustCompile(`^[0-2](\.(0|[1-9][0-9]*))+$`)
+
+// ExtendedKeyUsageOID returns the OID in dotted notation of an extended key usage, which is either
+// named like in cert-manager, e.g. "server auth", or given as an OID in dotted notation. It returns
+// false if the extended key usage is unknown or malformed.
+func ExtendedKeyUsageOID(usage string) (string, bool) {
+	if oid, ok := extendedKeyUsageOIDs[strings.ToLower(usage)]; ok {
+		return oid, true
+	}
+	if IsObjectIdentifier(usage) {
+		return usage, true
+	}
+	return "", false
+}
+
+// IsObjectIdentifier returns whether oid is an OID in dotted notation, e.g. "2.23.140.1.2.2"
+func IsObjectIdentifier(oid string) bool {
+	return oidPattern.MatchString(oid)
+}
+
+// SplitCertificateAuthority splits a certificate authority in the format "<logical name>" or
+// "<hostname>\<logical name>" into its hostname and logical name
+func SplitCertificateAuthority(certificateAuthority string) (string, string) {
+	if hostname, logicalName, found := strings.Cut(certificateAuthority, `\`); found {
+		return hostname, logicalName
+	}
+	return "", certificateAuthority
+}
+
+// DNSDomainPermits returns whether an entry of permittedDNSDomains permits a DNS name. An entry
+// such as "example.com" only permits the name itself, and a wildcard entry such as "*.example.com"
+// permits every name below the domain, including wildcard names. Names are compared case-insensitively
+// and without a trailing dot.
+func DNSDomainPermits(domain, name string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if suffix, found := strings.CutPrefix(domain, "*"); found {
+		return len(name) > len(suffix) && strings.HasSuffix(name, suffix)
+	}
+	return name == domain
+}
+
+// ValidateIssuerSpec validates the fields of an IssuerSpec that can't be expressed as
+// OpenAPI validation rules on the CRD.
+func ValidateIssuerSpec(spec *IssuerSpec) error {
+	return validateIssuerSpec(spec, field.NewPath("spec")).ToAggregate()
+}
+
+func validateIssuerSpec(spec *IssuerSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.SubjectPattern != "" {
+		if _, err := regexp.Compile(spec.SubjectPattern); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("subjectPattern"), spec.SubjectPattern, err.Error()))
+		}
+	} else if spec.ApplySubjectPatternToSANs {
+		allErrs = append(allErrs, field.Required(fldPath.Child("subjectPattern"), "required when applySubjectPatternToSANs is true"))
+	}
+
+	secretKeys := []struct{ name, key string }{
+		{"usernameKey", spec.UsernameKey},
+		{"passwordKey", spec.PasswordKey},
+		{"hostnameKey", spec.HostnameKey},
+	}
+	for _, secretKey := range secretKeys {
+		if secretKey.key == "" {
+			continue
+		}
+		for _, msg := range validation.IsConfigMapKey(secretKey.key) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(secretKey.name), secretKey.key, msg))
+		}
+	}
+
+	for i, hostname := range spec.FallbackHostnames {
+		switch {
+		case strings.TrimSpace(hostname) == "":
+			allErrs = append(allErrs, field.Required(fldPath.Child("fallbackHostnames").Index(i), "the hostname of a Command instance is required"))
+		case hostname == spec.Hostname:
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("fallbackHostnames").Index(i), hostname))
+		}
+	}
+
+	if spec.ProfileName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.ProfileName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("profileName"), spec.ProfileName, msg))
+		}
+	}
+
+	for i, certificateAuthority := range spec.AllowedCertificateAuthorities {
+		if _, logicalName := SplitCertificateAuthority(certificateAuthority); strings.TrimSpace(logicalName) == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("allowedCertificateAuthorities").Index(i), certificateAuthority, `must be the logical name of a certificate authority, optionally prefixed by its hostname and a backslash, e.g. "ca.example.com\InternalIssuingCA1"`))
+		}
+	}
+
+	allErrs = append(allErrs, validateRequestHeaders(spec.RequestHeaders, fldPath.Child("requestHeaders"))...)
+	allErrs = append(allErrs, validatePermittedDNSDomains(spec.PermittedDNSDomains, fldPath.Child("permittedDNSDomains"))...)
+	allErrs = append(allErrs, validateAdditionalSANs(spec.AdditionalSANs, spec.AllowedSANTypes, spec.PermittedDNSDomains, fldPath.Child("additionalSans"))...)
+	allErrs = append(allErrs, validateKeyPolicy(spec.KeyPolicy, fldPath.Child("keyPolicy"))...)
+
+	if spec.RenewalMode != "" && !spec.EnableRenewal {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("renewalMode"), spec.RenewalMode, "requires enableRenewal to be true"))
+	}
+
+	if spec.CACertificateTemplate != "" && !spec.AllowCA {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("caCertificateTemplate"), spec.CACertificateTemplate, "requires allowCA to be true"))
+	}
+
+	if spec.DefaultDuration != nil && spec.DefaultDuration.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("defaultDuration"), spec.DefaultDuration.Duration.String(), "must be greater than zero"))
+	}
+
+	names := make([]string, 0, len(spec.EnrollmentParameters))
+	for name := range spec.EnrollmentParameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if IsReservedEnrollmentParameter(name) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("enrollmentParameters").Key(name), "managed by the issuer"))
+		}
+	}
+
+	allErrs = append(allErrs, validateExtendedKeyUsageParameter(spec.ExtendedKeyUsageParameter, spec.EnrollmentParameters, fldPath.Child("extendedKeyUsageParameter"))...)
+	allErrs = append(allErrs, validateRequiredCertificatePolicy(spec.RequiredCertificatePolicy, spec, fldPath.Child("requiredCertificatePolicy"))...)
+
+	if spec.EnrollmentRequestTemplate != "" {
+		if _, err := ParseEnrollmentRequestTemplate(spec.EnrollmentRequestTemplate); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("enrollmentRequestTemplate"), spec.EnrollmentRequestTemplate, err.Error()))
+		}
+	}
+
+	allErrs = append(allErrs, validateMetadataMapping(spec.MetadataFromLabels, fldPath.Child("metadataFromLabels"))...)
+	allErrs = append(allErrs, validateMetadataMapping(spec.MetadataFromAnnotations, fldPath.Child("metadataFromAnnotations"))...)
+	allErrs = append(allErrs, validateChangeReference(spec.ChangeReference, fldPath.Child("changeReference"))...)
+
+	if limits := spec.EnrollmentLimits; limits != nil && limits.Burst > 0 && limits.RequestsPerMinute == 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("enrollmentLimits", "burst"), limits.Burst, "requires requestsPerMinute to be set"))
+	}
+
+	return allErrs
+}
+
+// validateChangeReference verifies that a change reference names a metadata field, that its pattern
+// is a valid regular expression, and that its default matches the pattern
+func validateChangeReference(reference *ChangeReference, fldPath *field.Path) field.ErrorList {
+	if reference == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	if reference.MetadataField == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("metadataField"), "the name of a Command metadata field is required"))
+	}
+
+	if reference.Pattern == "" {
+		return allErrs
+	}
+	pattern, err := regexp.Compile(reference.Pattern)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath.Child("pattern"), reference.Pattern, err.Error()))
+	}
+	if reference.Default != "" && !pattern.MatchString(reference.Default) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("default"), reference.Default, fmt.Sprintf("must match pattern %q", reference.Pattern)))
+	}
+
+	return allErrs
+}
+
+// validateMetadataMapping verifies that the keys of a mapping of labels or annotations to Command
+// metadata fields are valid label and annotation keys, and that every key maps to a metadata field
+func validateMetadataMapping(mapping map[string]string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+		}
+		if strings.TrimSpace(mapping[key]) == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Key(key), "the name of a Command metadata field is required"))
+		}
+	}
+
+	return allErrs
+}
+
+// validatePermittedDNSDomains verifies that every permitted DNS domain is a DNS name, optionally
+// prefixed by a wildcard label, and that no domain is listed twice
+func validatePermittedDNSDomains(domains []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]bool)
+	for i, domain := range domains {
+		if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(domain, "*.")); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), domain, `must be a DNS name, e.g. "example.com", or a DNS name prefixed by a wildcard label, e.g. "*.example.com": `+strings.Join(errs, ", ")))
+			continue
+		}
+		if seen[domain] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), domain))
+		}
+		seen[domain] = true
+	}
+
+	return allErrs
+}
+
+// validateAdditionalSANs verifies that the additional SANs of an issuer are well-formed, that
+// their types are allowed by allowedSANTypes, if the issuer restricts the SAN types, and that
+// their DNS names are permitted by permittedDNSDomains, if the issuer restricts the DNS names
+func validateAdditionalSANs(sans *AdditionalSANs, allowedSANTypes []SANType, permittedDNSDomains []string, fldPath *field.Path) field.ErrorList {
+	if sans == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	allowed := func(sanType SANType) bool {
+		if len(allowedSANTypes) == 0 {
+			return true
+		}
+		for _, allowedType := range allowedSANTypes {
+			if allowedType == sanType {
+				return true
+			}
+		}
+		return false
+	}
+
+	fields := []struct {
+		name     string
+		sanType  SANType
+		values   []string
+		validate func(string) string
+	}{
+		{"dnsNames", SANTypeDNS, sans.DNSNames, func(value string) string {
+			if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(value, "*.")); len(errs) > 0 {
+				return strings.Join(errs, ", ")
+			}
+			if len(permittedDNSDomains) == 0 {
+				return ""
+			}
+			for _, domain := range permittedDNSDomains {
+				if DNSDomainPermits(domain, value) {
+					return ""
+				}
+			}
+			return "must be permitted by permittedDNSDomains"
+		}},
+		{"ipAddresses", SANTypeIP, sans.IPAddresses, func(value string) string {
+			if net.ParseIP(value) == nil {
+				return "must be a valid IP address"
+			}
+			return ""
+		}},
+		{"uris", SANTypeURI, sans.URIs, func(value string) string {
+			if uri, err := url.Parse(value); err != nil || uri.Scheme == "" {
+				return "must be an absolute URI"
+			}
+			return ""
+		}},
+		{"emailAddresses", SANTypeEmail, sans.EmailAddresses, func(value string) string {
+			if _, err := mail.ParseAddress(value); err != nil || strings.ContainsAny(value, "<> ") {
+				return "must be a valid email address"
+			}
+			return ""
+		}},
+	}
+	for _, f := range fields {
+		if len(f.values) > 0 && !allowed(f.sanType) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child(f.name), fmt.Sprintf("%s SANs are not allowed by allowedSanTypes", f.sanType)))
+		}
+		for i, value := range f.values {
+			if msg := f.validate(value); msg != "" {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child(f.name).Index(i), value, msg))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateKeyPolicy verifies that every allowed signature algorithm of a key policy signs with an
+// allowed key algorithm, since CSRs signed with it would always be rejected otherwise
+func validateKeyPolicy(policy *KeyPolicy, fldPath *field.Path) field.ErrorList {
+	if policy == nil || len(policy.AllowedKeyAlgorithms) == 0 {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	for i, signatureAlgorithm := range policy.AllowedSignatureAlgorithms {
+		keyAlgorithm := signatureAlgorithm.KeyAlgorithm()
+		allowed := false
+		for _, allowedAlgorithm := range policy.AllowedKeyAlgorithms {
+			if allowedAlgorithm == keyAlgorithm {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("allowedSignatureAlgorithms").Index(i), signatureAlgorithm, fmt.Sprintf("requires %s keys, which are not allowed by allowedKeyAlgorithms", keyAlgorithm)))
+		}
+	}
+
+	return allErrs
+}
+
+// validateExtendedKeyUsageParameter verifies that the enrollment parameter derived from the extended
+// key usages of CSRs isn't managed by the issuer or set by enrollmentParameters, and that its values
+// are keyed by known extended key usages
+func validateExtendedKeyUsageParameter(parameter *ExtendedKeyUsageParameter, enrollmentParameters map[string]string, fldPath *field.Path) field.ErrorList {
+	if parameter == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	switch {
+	case strings.TrimSpace(parameter.Name) == "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), "the name of an enrollment parameter is required"))
+	case IsReservedEnrollmentParameter(parameter.Name):
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("name"), "managed by the issuer"))
+	default:
+		for name := range enrollmentParameters {
+			if strings.EqualFold(name, parameter.Name) {
+				allErrs = append(allErrs, field.Forbidden(fldPath.Child("name"), fmt.Sprintf("conflicts with enrollmentParameters key %q", name)))
+			}
+		}
+	}
+
+	if len(parameter.Values) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("values"), "at least one extended key usage must be mapped"))
+	}
+	usages := make([]string, 0, len(parameter.Values))
+	for usage := range parameter.Values {
+		usages = append(usages, usage)
+	}
+	sort.Strings(usages)
+	for _, usage := range usages {
+		if _, ok := ExtendedKeyUsageOID(usage); !ok {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("values"), usage, `must be the name of an extended key usage, e.g. "server auth", or an OID in dotted notation`))
+		}
+	}
+
+	return allErrs
+}
+
+// validateRequiredCertificatePolicy verifies that the required certificate policy is an OID, and that
+// its enrollment parameter isn't managed by the issuer or set by enrollmentParameters or
+// extendedKeyUsageParameter
+func validateRequiredCertificatePolicy(policy *RequiredCertificatePolicy, spec *IssuerSpec, fldPath *field.Path) field.ErrorList {
+	if policy == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	switch {
+	case policy.OID == "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("oid"), "the OID of a certificate policy is required"))
+	case !IsObjectIdentifier(policy.OID):
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("oid"), policy.OID, `must be an OID in dotted notation, e.g. "2.23.140.1.2.2"`))
+	}
+
+	if policy.EnrollmentParameter == "" {
+		return allErrs
+	}
+	if IsReservedEnrollmentParameter(policy.EnrollmentParameter) {
+		return append(allErrs, field.Forbidden(fldPath.Child("enrollmentParameter"), "managed by the issuer"))
+	}
+	for name := range spec.EnrollmentParameters {
+		if strings.EqualFold(name, policy.EnrollmentParameter) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("enrollmentParameter"), fmt.Sprintf("conflicts with enrollmentParameters key %q", name)))
+		}
+	}
+	if spec.ExtendedKeyUsageParameter != nil && strings.EqualFold(spec.ExtendedKeyUsageParameter.Name, policy.EnrollmentParameter) {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("enrollmentParameter"), "conflicts with extendedKeyUsageParameter"))
+	}
+
+	return allErrs
+}
+
+// validateRequestHeaders verifies that the static request headers have valid and unique names
+// that aren't managed by the issuer, and that each has either a value or a Secret key
+func validateRequestHeaders(headers []RequestHeader, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]bool, len(headers))
+	for i, header := range headers {
+		idxPath := fldPath.Index(i)
+
+		switch {
+		case header.Name == "":
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "the name of an HTTP header is required"))
+		case !headerNamePattern.MatchString(header.Name):
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), header.Name, "must be a valid HTTP header name"))
+		case IsReservedRequestHeader(header.Name):
+			allErrs = append(allErrs, field.Forbidden(idxPath.Child("name"), "managed by the issuer"))
+		case seen[strings.ToLower(header.Name)]:
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), header.Name))
+		}
+		seen[strings.ToLower(header.Name)] = true
+
+		switch {
+		case header.Value != "" && header.SecretKey != "":
+			allErrs = append(allErrs, field.Invalid(idxPath, header.Name, "value and secretKey are mutually exclusive"))
+		case header.Value == "" && header.SecretKey == "":
+			allErrs = append(allErrs, field.Required(idxPath.Child("value"), "either value or secretKey is required"))
+		case strings.ContainsAny(header.Value, "\r\n\x00"):
+			// The value isn't included in the error since it may be a credential
+			allErrs = append(allErrs, field.Forbidden(idxPath.Child("value"), "must not contain line breaks or NUL characters"))
+		case header.SecretKey != "":
+			for _, msg := range validation.IsConfigMapKey(header.SecretKey) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("secretKey"), header.SecretKey, msg))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// issuerValidator validates Issuers and ClusterIssuers on create and update
+// +kubebuilder:object:generate=false
+type issuerValidator struct{}
+
+var _ webhook.CustomValidator = &issuerValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *issuerValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(obj)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *issuerValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(newObj)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *issuerValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *issuerValidator) validate(obj runtime.Object) error {
+	allErrs, err := ValidateIssuer(obj)
+	if err != nil {
+		return err
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	var kind, name string
+	switch t := obj.(type) {
+	case *Issuer:
+		kind, name = "Issuer", t.Name
+	case *ClusterIssuer:
+		kind, name = "ClusterIssuer", t.Name
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind(kind).GroupKind(), name, allErrs)
+}
+
+// ValidateIssuer validates an Issuer or ClusterIssuer like the validating admission webhook does,
+// and returns the errors of its fields.
+func ValidateIssuer(obj runtime.Object) (field.ErrorList, error) {
+	switch t := obj.(type) {
+	case *Issuer:
+		allErrs := validateIssuerSpec(&t.Spec, field.NewPath("spec"))
+		if t.Spec.SecretNamespace != "" {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "commandSecretNamespace"), "only supported on ClusterIssuers"))
+		}
+		return allErrs, nil
+	case *ClusterIssuer:
+		return validateIssuerSpec(&t.Spec, field.NewPath("spec")), nil
+	default:
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+}
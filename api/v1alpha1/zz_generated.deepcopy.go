@@ -22,15 +22,66 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalSANs) DeepCopyInto(out *AdditionalSANs) {
+	*out = *in
+	if in.DNSNames != nil {
+		in, out := &in.DNSNames, &out.DNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPAddresses != nil {
+		in, out := &in.IPAddresses, &out.IPAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.URIs != nil {
+		in, out := &in.URIs, &out.URIs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EmailAddresses != nil {
+		in, out := &in.EmailAddresses, &out.EmailAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalSANs.
+func (in *AdditionalSANs) DeepCopy() *AdditionalSANs {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalSANs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeReference) DeepCopyInto(out *ChangeReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeReference.
+func (in *ChangeReference) DeepCopy() *ChangeReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterIssuer) DeepCopyInto(out *ClusterIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -84,12 +135,158 @@ func (in *ClusterIssuerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommandIssuerProfile) DeepCopyInto(out *CommandIssuerProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommandIssuerProfile.
+func (in *CommandIssuerProfile) DeepCopy() *CommandIssuerProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(CommandIssuerProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CommandIssuerProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommandIssuerProfileList) DeepCopyInto(out *CommandIssuerProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CommandIssuerProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommandIssuerProfileList.
+func (in *CommandIssuerProfileList) DeepCopy() *CommandIssuerProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(CommandIssuerProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CommandIssuerProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommandIssuerProfileSpec) DeepCopyInto(out *CommandIssuerProfileSpec) {
+	*out = *in
+	if in.AllowedCertificateAuthorities != nil {
+		in, out := &in.AllowedCertificateAuthorities, &out.AllowedCertificateAuthorities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedSANTypes != nil {
+		in, out := &in.AllowedSANTypes, &out.AllowedSANTypes
+		*out = make([]SANType, len(*in))
+		copy(*out, *in)
+	}
+	if in.EnrollmentParameters != nil {
+		in, out := &in.EnrollmentParameters, &out.EnrollmentParameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.MetadataFromLabels != nil {
+		in, out := &in.MetadataFromLabels, &out.MetadataFromLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.MetadataFromAnnotations != nil {
+		in, out := &in.MetadataFromAnnotations, &out.MetadataFromAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.DefaultDuration != nil {
+		in, out := &in.DefaultDuration, &out.DefaultDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommandIssuerProfileSpec.
+func (in *CommandIssuerProfileSpec) DeepCopy() *CommandIssuerProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CommandIssuerProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnrollmentLimits) DeepCopyInto(out *EnrollmentLimits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnrollmentLimits.
+func (in *EnrollmentLimits) DeepCopy() *EnrollmentLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(EnrollmentLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtendedKeyUsageParameter) DeepCopyInto(out *ExtendedKeyUsageParameter) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtendedKeyUsageParameter.
+func (in *ExtendedKeyUsageParameter) DeepCopy() *ExtendedKeyUsageParameter {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtendedKeyUsageParameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Issuer) DeepCopyInto(out *Issuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -165,6 +362,87 @@ func (in *IssuerList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IssuerSpec) DeepCopyInto(out *IssuerSpec) {
 	*out = *in
+	if in.FallbackHostnames != nil {
+		in, out := &in.FallbackHostnames, &out.FallbackHostnames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedCertificateAuthorities != nil {
+		in, out := &in.AllowedCertificateAuthorities, &out.AllowedCertificateAuthorities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestHeaders != nil {
+		in, out := &in.RequestHeaders, &out.RequestHeaders
+		*out = make([]RequestHeader, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedSANTypes != nil {
+		in, out := &in.AllowedSANTypes, &out.AllowedSANTypes
+		*out = make([]SANType, len(*in))
+		copy(*out, *in)
+	}
+	if in.PermittedDNSDomains != nil {
+		in, out := &in.PermittedDNSDomains, &out.PermittedDNSDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalSANs != nil {
+		in, out := &in.AdditionalSANs, &out.AdditionalSANs
+		*out = new(AdditionalSANs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KeyPolicy != nil {
+		in, out := &in.KeyPolicy, &out.KeyPolicy
+		*out = new(KeyPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EnrollmentParameters != nil {
+		in, out := &in.EnrollmentParameters, &out.EnrollmentParameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExtendedKeyUsageParameter != nil {
+		in, out := &in.ExtendedKeyUsageParameter, &out.ExtendedKeyUsageParameter
+		*out = new(ExtendedKeyUsageParameter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequiredCertificatePolicy != nil {
+		in, out := &in.RequiredCertificatePolicy, &out.RequiredCertificatePolicy
+		*out = new(RequiredCertificatePolicy)
+		**out = **in
+	}
+	if in.MetadataFromLabels != nil {
+		in, out := &in.MetadataFromLabels, &out.MetadataFromLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.MetadataFromAnnotations != nil {
+		in, out := &in.MetadataFromAnnotations, &out.MetadataFromAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ChangeReference != nil {
+		in, out := &in.ChangeReference, &out.ChangeReference
+		*out = new(ChangeReference)
+		**out = **in
+	}
+	if in.DefaultDuration != nil {
+		in, out := &in.DefaultDuration, &out.DefaultDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.EnrollmentLimits != nil {
+		in, out := &in.EnrollmentLimits, &out.EnrollmentLimits
+		*out = new(EnrollmentLimits)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerSpec.
@@ -198,3 +476,58 @@ func (in *IssuerStatus) DeepCopy() *IssuerStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeyPolicy) DeepCopyInto(out *KeyPolicy) {
+	*out = *in
+	if in.AllowedKeyAlgorithms != nil {
+		in, out := &in.AllowedKeyAlgorithms, &out.AllowedKeyAlgorithms
+		*out = make([]KeyAlgorithm, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedSignatureAlgorithms != nil {
+		in, out := &in.AllowedSignatureAlgorithms, &out.AllowedSignatureAlgorithms
+		*out = make([]SignatureAlgorithm, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeyPolicy.
+func (in *KeyPolicy) DeepCopy() *KeyPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(KeyPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestHeader) DeepCopyInto(out *RequestHeader) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestHeader.
+func (in *RequestHeader) DeepCopy() *RequestHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequiredCertificatePolicy) DeepCopyInto(out *RequiredCertificatePolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequiredCertificatePolicy.
+func (in *RequiredCertificatePolicy) DeepCopy() *RequiredCertificatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RequiredCertificatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// AuditOutcome is the outcome of an enrollment recorded in the audit log
+type AuditOutcome string
+
+const (
+	// AuditOutcomeIssued is recorded when Command issued a certificate
+	AuditOutcomeIssued AuditOutcome = "Issued"
+	// AuditOutcomePending is recorded when the enrollment awaits approval in Command
+	AuditOutcomePending AuditOutcome = "Pending"
+	// AuditOutcomeReused is recorded when the certificate of a coalesced enrollment of the same CSR
+	// was reused without enrolling again
+	AuditOutcomeReused AuditOutcome = "Reused"
+	// AuditOutcomeFailed is recorded when the enrollment failed or was rejected
+	AuditOutcomeFailed AuditOutcome = "Failed"
+)
+
+// AuditRecord is the record of a single enrollment written to the audit log
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Kind is the kind of the request, i.e. CertificateRequest or CertificateSigningRequest
+	Kind                 string       `json:"kind"`
+	Namespace            string       `json:"namespace,omitempty"`
+	Name                 string       `json:"name"`
+	IssuerKind           string       `json:"issuerKind"`
+	IssuerNamespace      string       `json:"issuerNamespace,omitempty"`
+	IssuerName           string       `json:"issuerName"`
+	CertificateTemplate  string       `json:"certificateTemplate,omitempty"`
+	CertificateAuthority string       `json:"certificateAuthority,omitempty"`
+	ChangeReference      string       `json:"changeReference,omitempty"`
+	CertificateID        int32        `json:"certificateID,omitempty"`
+	Outcome              AuditOutcome `json:"outcome"`
+	Error                string       `json:"error,omitempty"`
+}
+
+// AuditLogger writes a JSON record of every enrollment to Writer, one per line, separately from the
+// operational logs. Records are written whatever the outcome of the enrollment.
+type AuditLogger struct {
+	Writer io.Writer
+	Clock  clock.PassiveClock
+
+	mu sync.Mutex
+}
+
+// syncer is implemented by writers that can flush written data to stable storage, e.g. *os.File
+type syncer interface {
+	Sync() error
+}
+
+// Record writes the record to the audit log. Failures to write it are logged, since they must not
+// fail the enrollment that was already performed.
+func (a *AuditLogger) Record(ctx context.Context, record AuditRecord) {
+	if a == nil || a.Writer == nil {
+		return
+	}
+
+	if record.Time.IsZero() {
+		record.Time = a.clock().Now()
+	}
+	record.Time = record.Time.UTC()
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to encode the audit record of the enrollment")
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.Writer.Write(line); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to write the audit record of the enrollment", "record", string(line))
+		return
+	}
+	if s, ok := a.Writer.(syncer); ok {
+		// Sync fails with EINVAL on pipes and terminals, e.g. if the audit log is written to stdout
+		if err := s.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+			log.FromContext(ctx).Error(err, "Failed to sync the audit log")
+		}
+	}
+}
+
+func (a *AuditLogger) clock() clock.PassiveClock {
+	if a.Clock == nil {
+		return clock.RealClock{}
+	}
+	return a.Clock
+}
+
+// auditEnrollment returns the audit record of an enrollment of request with the signer of the issuer,
+// given the Command ID of the issued certificate, if any, and the error of the enrollment
+func auditEnrollment(kind string, request, issuer client.Object, issuerSpec *commandissuer.IssuerSpec, commandSigner signer.Signer, certificateID int32, err error) AuditRecord {
+	record := AuditRecord{
+		Kind:                 kind,
+		Namespace:            request.GetNamespace(),
+		Name:                 request.GetName(),
+		IssuerKind:           issuerKind(issuer),
+		IssuerNamespace:      issuer.GetNamespace(),
+		IssuerName:           issuer.GetName(),
+		CertificateTemplate:  issuerSpec.CertificateTemplate,
+		CertificateAuthority: issuerSpec.CertificateAuthorityLogicalName,
+		ChangeReference:      signer.ChangeReferenceOf(request.GetAnnotations(), issuerSpec.ChangeReference),
+		CertificateID:        certificateID,
+		Outcome:              AuditOutcomeIssued,
+	}
+	// The annotations of the request may override the template and certificate authority of the issuer
+	if reporter, ok := commandSigner.(signer.EnrollmentTargetReporter); ok {
+		record.CertificateTemplate, record.CertificateAuthority = reporter.EnrollmentTarget()
+	}
+
+	var pendingErr *signer.EnrollmentPendingError
+	switch {
+	case errors.As(err, &pendingErr):
+		record.Outcome = AuditOutcomePending
+	case err != nil:
+		record.Outcome = AuditOutcomeFailed
+		record.Error = err.Error()
+	}
+	return record
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// fakeTargetSigner is a Signer that reports the template and certificate authority it enrolls with
+type fakeTargetSigner struct {
+	signer.Signer
+}
+
+func (fakeTargetSigner) EnrollmentTarget() (string, string) {
+	return "Overridden", "ca.example.com\\Other"
+}
+
+func TestAuditEnrollment(t *testing.T) {
+	certificateRequest := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "cr1"}}
+	issuer := &commandissuer.ClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer1"}}
+	issuerSpec := &commandissuer.IssuerSpec{CertificateTemplate: "WebServer", CertificateAuthorityLogicalName: "CA1"}
+
+	tests := []struct {
+		name             string
+		signer           signer.Signer
+		certificateID    int32
+		err              error
+		expectedTemplate string
+		expectedCA       string
+		expectedOutcome  AuditOutcome
+		expectedError    string
+	}{
+		{
+			name:             "Issued",
+			certificateID:    42,
+			expectedTemplate: "WebServer",
+			expectedCA:       "CA1",
+			expectedOutcome:  AuditOutcomeIssued,
+		},
+		{
+			name:             "Pending",
+			err:              fmt.Errorf("wrapped: %w", &signer.EnrollmentPendingError{RequestID: 7}),
+			expectedTemplate: "WebServer",
+			expectedCA:       "CA1",
+			expectedOutcome:  AuditOutcomePending,
+		},
+		{
+			name:             "Failed",
+			err:              errors.New("template not found"),
+			expectedTemplate: "WebServer",
+			expectedCA:       "CA1",
+			expectedOutcome:  AuditOutcomeFailed,
+			expectedError:    "template not found",
+		},
+		{
+			name:             "OverriddenTarget",
+			signer:           fakeTargetSigner{},
+			certificateID:    42,
+			expectedTemplate: "Overridden",
+			expectedCA:       "ca.example.com\\Other",
+			expectedOutcome:  AuditOutcomeIssued,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := auditEnrollment("CertificateRequest", certificateRequest, issuer, issuerSpec, tt.signer, tt.certificateID, tt.err)
+			assert.Equal(t, "ns1", record.Namespace)
+			assert.Equal(t, "cr1", record.Name)
+			assert.Equal(t, "ClusterIssuer", record.IssuerKind)
+			assert.Equal(t, "issuer1", record.IssuerName)
+			assert.Equal(t, tt.certificateID, record.CertificateID)
+			assert.Equal(t, tt.expectedTemplate, record.CertificateTemplate)
+			assert.Equal(t, tt.expectedCA, record.CertificateAuthority)
+			assert.Equal(t, tt.expectedOutcome, record.Outcome)
+			assert.Equal(t, tt.expectedError, record.Error)
+		})
+	}
+}
+
+func TestAuditLoggerRecord(t *testing.T) {
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	var buf bytes.Buffer
+	logger := &AuditLogger{Writer: &buf, Clock: clocktesting.NewFakePassiveClock(now)}
+	logger.Record(ctx, AuditRecord{Kind: "CertificateRequest", Name: "cr1", Outcome: AuditOutcomeIssued, CertificateID: 42})
+	logger.Record(ctx, AuditRecord{Kind: "CertificateSigningRequest", Name: "csr1", Outcome: AuditOutcomeFailed, Error: "denied"})
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &record))
+	assert.Equal(t, "2024-05-01T10:00:00Z", record["time"])
+	assert.Equal(t, "cr1", record["name"])
+	assert.Equal(t, float64(42), record["certificateID"])
+	assert.NotContains(t, record, "error")
+
+	require.NoError(t, json.Unmarshal(lines[1], &record))
+	assert.Equal(t, "Failed", record["outcome"])
+	assert.Equal(t, "denied", record["error"])
+
+	// A nil logger doesn't audit enrollments
+	var nilLogger *AuditLogger
+	nilLogger.Record(ctx, AuditRecord{Name: "cr1"})
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+const (
+	// recentLatencyWindow is the time constant of the average of the recent latency of Command
+	recentLatencyWindow = time.Minute
+	// baselineLatencyWindow is the time constant of the average latency of Command that the recent
+	// latency is compared to. It is long enough that the baseline lags behind a degradation.
+	baselineLatencyWindow = 15 * time.Minute
+)
+
+// Backpressure lengthens the intervals that requests are requeued after while the latency of Command
+// trends upward, so that a slow but healthy Command isn't loaded further by polls and health checks,
+// and shortens them again as the latency recovers. It observes the latency of every request to Command
+// in the command_request_duration_seconds histogram, and keeps an exponentially weighted average of the
+// recent latency and of a slower baseline. A Backpressure is shared by all reconcilers.
+type Backpressure struct {
+	sensitivity float64
+	maxInterval time.Duration
+	clock       clock.PassiveClock
+
+	mu       sync.Mutex
+	recent   float64
+	baseline float64
+	last     time.Time
+}
+
+// NewBackpressure returns a Backpressure that multiplies requeue intervals by 1 + sensitivity × the
+// relative increase of the recent latency of Command over its baseline, but never beyond maxInterval.
+// If sensitivity is zero, the latency is observed but requeue intervals are unchanged.
+func NewBackpressure(sensitivity float64, maxInterval time.Duration, clock clock.PassiveClock) *Backpressure {
+	return &Backpressure{
+		sensitivity: sensitivity,
+		maxInterval: maxInterval,
+		clock:       clock,
+	}
+}
+
+// ObserveCommandLatency implements signer.LatencyObserver
+func (b *Backpressure) ObserveCommandLatency(latency time.Duration) {
+	if b == nil {
+		return
+	}
+	commandRequestDuration.Observe(latency.Seconds())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	seconds := latency.Seconds()
+	if b.last.IsZero() {
+		b.recent, b.baseline, b.last = seconds, seconds, now
+		return
+	}
+
+	// The weight of a sample depends on the time since the previous one, so that the averages
+	// decay at the same rate however many requests are sent
+	elapsed := now.Sub(b.last)
+	b.recent += (1 - math.Exp(-float64(elapsed)/float64(recentLatencyWindow))) * (seconds - b.recent)
+	b.baseline += (1 - math.Exp(-float64(elapsed)/float64(baselineLatencyWindow))) * (seconds - b.baseline)
+	b.last = now
+}
+
+// factor returns how much requeue intervals are lengthened, which is at least 1
+func (b *Backpressure) factor() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.baseline <= 0 || b.recent <= b.baseline {
+		return 1
+	}
+	return 1 + b.sensitivity*(b.recent/b.baseline-1)
+}
+
+// Requeue returns interval lengthened according to the recent latency of Command. The interval is
+// never lengthened beyond the maximum interval, and intervals that already exceed it are returned
+// unchanged. If b is nil, interval is returned.
+func (b *Backpressure) Requeue(interval time.Duration) time.Duration {
+	if b == nil || b.sensitivity <= 0 || interval >= b.maxInterval {
+		return interval
+	}
+
+	factor := b.factor()
+	if factor <= 1 {
+		return interval
+	}
+	if float64(interval)*factor >= float64(b.maxInterval) {
+		return b.maxInterval
+	}
+	return time.Duration(float64(interval) * factor)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestBackpressure(t *testing.T) {
+	// observe records a request with the given latency every 10 seconds for the given duration
+	observe := func(clock *clocktesting.FakeClock, b *Backpressure, latency, duration time.Duration) {
+		for elapsed := time.Duration(0); elapsed < duration; elapsed += 10 * time.Second {
+			clock.Step(10 * time.Second)
+			b.ObserveCommandLatency(latency)
+		}
+	}
+
+	t.Run("Nil", func(t *testing.T) {
+		var b *Backpressure
+		b.ObserveCommandLatency(time.Second)
+		assert.Equal(t, time.Minute, b.Requeue(time.Minute))
+	})
+
+	t.Run("NoObservations", func(t *testing.T) {
+		b := NewBackpressure(1, 10*time.Minute, clocktesting.NewFakeClock(fixedClockStart))
+		assert.Equal(t, time.Minute, b.Requeue(time.Minute))
+	})
+
+	t.Run("SteadyLatency", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		b := NewBackpressure(1, 10*time.Minute, clock)
+		observe(clock, b, 2*time.Second, 30*time.Minute)
+		assert.Equal(t, time.Minute, b.Requeue(time.Minute), "a slow but steady latency is the baseline")
+	})
+
+	t.Run("RisingLatency", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		b := NewBackpressure(1, 10*time.Minute, clock)
+		observe(clock, b, 100*time.Millisecond, 30*time.Minute)
+		observe(clock, b, 300*time.Millisecond, 3*time.Minute)
+
+		interval := b.Requeue(time.Minute)
+		assert.Greater(t, interval, 2*time.Minute, "the recent latency is about three times the baseline")
+		assert.Less(t, interval, 3*time.Minute)
+
+		// Recovery shortens the interval again
+		observe(clock, b, 100*time.Millisecond, 5*time.Minute)
+		assert.Equal(t, time.Minute, b.Requeue(time.Minute))
+	})
+
+	t.Run("Sensitivity", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		low := NewBackpressure(0.5, 10*time.Minute, clock)
+		high := NewBackpressure(2, 10*time.Minute, clock)
+		for _, b := range []*Backpressure{low, high} {
+			b.ObserveCommandLatency(100 * time.Millisecond)
+		}
+		for elapsed := time.Duration(0); elapsed < 3*time.Minute; elapsed += 10 * time.Second {
+			clock.Step(10 * time.Second)
+			low.ObserveCommandLatency(200 * time.Millisecond)
+			high.ObserveCommandLatency(200 * time.Millisecond)
+		}
+		assert.Less(t, low.Requeue(time.Minute), high.Requeue(time.Minute))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		b := NewBackpressure(0, 10*time.Minute, clock)
+		observe(clock, b, 100*time.Millisecond, 30*time.Minute)
+		observe(clock, b, 5*time.Second, 3*time.Minute)
+		assert.Equal(t, time.Minute, b.Requeue(time.Minute))
+	})
+
+	t.Run("MaxInterval", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		b := NewBackpressure(10, 5*time.Minute, clock)
+		observe(clock, b, 100*time.Millisecond, 30*time.Minute)
+		observe(clock, b, 5*time.Second, 3*time.Minute)
+		assert.Equal(t, 5*time.Minute, b.Requeue(time.Minute))
+		assert.Equal(t, 10*time.Minute, b.Requeue(10*time.Minute), "intervals above the maximum aren't changed")
+	})
+}
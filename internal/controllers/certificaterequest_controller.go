@@ -26,15 +26,25 @@ import (
 	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strconv"
+	"time"
 )
 
 var (
@@ -43,6 +53,85 @@ var (
 	errIssuerNotReady = errors.New("issuer is not ready")
 	errSignerBuilder  = errors.New("failed to build the signer")
 	errSignerSign     = errors.New("failed to sign")
+	errRecordEnrolled = errors.New("failed to record the enrolled certificate")
+	errRecordPending  = errors.New("failed to record the pending enrollment")
+	errRecordAttempt  = errors.New("failed to record the failed enrollment attempt")
+	errGetNamespace   = errors.New("failed to get the namespace")
+)
+
+const (
+	// certificateRequestReasonAuthenticationFailed is the Ready condition reason set when Command
+	// rejects the issuer credentials. The request is retried since the credentials may be rotated.
+	certificateRequestReasonAuthenticationFailed = "AuthenticationFailed"
+	// certificateRequestReasonTimeout is the Ready condition reason set when a reconcile exceeds the
+	// configured timeout. The request is retried.
+	certificateRequestReasonTimeout = "Timeout"
+	// certificateRequestReasonCommandUnavailable is the Ready condition reason set when calls to
+	// Command are short-circuited after repeated failures. The request is retried after the cooldown.
+	certificateRequestReasonCommandUnavailable = "CommandUnavailable"
+	// certificateRequestReasonInvalidIssuer is the Ready condition reason set when the issuer spec or
+	// its Secrets are invalid. The request is retried since the issuer may be fixed.
+	certificateRequestReasonInvalidIssuer = "InvalidIssuer"
+	// certificateRequestReasonEnrollmentLimited is the Ready condition reason set when the issuer
+	// exhausted its enrollment limits. The request is retried once the issuer has capacity again.
+	certificateRequestReasonEnrollmentLimited = "EnrollmentLimited"
+
+	// certificateRequestConditionSANMismatch is the condition set on a CertificateRequest whose issued
+	// certificate doesn't contain the names requested by the CSR
+	certificateRequestConditionSANMismatch cmapi.CertificateRequestConditionType = "SANMismatch"
+	// reasonSANMismatch is the reason of the SANMismatch condition and of the Event recorded for it
+	reasonSANMismatch = "SANMismatch"
+	// reasonClockSkew is the reason of the Event recorded when the issued certificate isn't valid at
+	// the local time
+	reasonClockSkew = "ClockSkew"
+	// reasonCommandFailover is the reason of the Event recorded when a request is served by a fallback
+	// hostname of the issuer because the preferred Command instances failed
+	reasonCommandFailover = "CommandFailover"
+	// reasonCertificatePolicyMissing is the reason of the Event recorded when the issued certificate
+	// doesn't contain the certificate policy required by the issuer
+	reasonCertificatePolicyMissing = "CertificatePolicyMissing"
+	// reasonEnrollmentSkipped is the reason of the Event recorded when a request is annotated to be
+	// handled manually
+	reasonEnrollmentSkipped = "EnrollmentSkipped"
+
+	// enrollmentKeyAnnotation identifies the CertificateRequest UID and generation that the
+	// certificate in enrolledCertificateAnnotation and enrolledCertificateCAAnnotation was enrolled for.
+	enrollmentKeyAnnotation         = "command-issuer.keyfactor.com/enrollment-key"
+	enrolledCertificateAnnotation   = "command-issuer.keyfactor.com/enrolled-certificate"
+	enrolledCertificateCAAnnotation = "command-issuer.keyfactor.com/enrolled-ca"
+	enrolledCertificateIDAnnotation = "command-issuer.keyfactor.com/enrolled-certificate-id"
+
+	// enrolledCertificateSerialAnnotation and enrolledCertificateFingerprintAnnotation record the
+	// serial number and SHA-256 fingerprint of the enrolled certificate if RecordCertificateFingerprints
+	// is enabled, e.g. for correlation with external audit systems.
+	enrolledCertificateSerialAnnotation      = "command-issuer.keyfactor.com/enrolled-certificate-serial"
+	enrolledCertificateFingerprintAnnotation = "command-issuer.keyfactor.com/enrolled-certificate-fingerprint"
+
+	// commandEndpointAnnotation records the host of the Command instance that enrolled the certificate
+	// if the issuer has fallback hostnames
+	commandEndpointAnnotation = "command-issuer.keyfactor.com/command-endpoint"
+
+	// pendingRequestIDAnnotation and pendingSinceAnnotation record an enrollment that is awaiting
+	// approval in Command for the UID and generation in enrollmentKeyAnnotation, so that following
+	// reconciles poll the enrollment instead of enrolling the CSR again.
+	pendingRequestIDAnnotation = "command-issuer.keyfactor.com/pending-request-id"
+	pendingSinceAnnotation     = "command-issuer.keyfactor.com/pending-since"
+
+	// failedAttemptsAnnotation counts the enrollments of the UID and generation in enrollmentKeyAnnotation
+	// that failed for reasons other than the unavailability of Command, e.g. a CSR that the certificate
+	// template rejects with a server error
+	failedAttemptsAnnotation = "command-issuer.keyfactor.com/failed-enrollment-attempts"
+
+	// defaultEnrollmentPollInterval is used if no enrollment poll interval is configured
+	defaultEnrollmentPollInterval = time.Minute
+
+	// DefaultSkipEnrollmentAnnotation is the default annotation that marks a CertificateRequest as
+	// handled manually, so that the controller leaves it alone
+	DefaultSkipEnrollmentAnnotation = "command-issuer.keyfactor.com/skip-enrollment"
+
+	// certificateIDAnnotation records the Command ID of the most recently enrolled certificate on the
+	// cert-manager Certificate so that renewals of the Certificate can renew it in Command.
+	certificateIDAnnotation = "command-issuer.keyfactor.com/certificate-id"
 )
 
 type CertificateRequestReconciler struct {
@@ -51,19 +140,125 @@ type CertificateRequestReconciler struct {
 	Scheme                            *runtime.Scheme
 	SignerBuilder                     signer.CommandSignerBuilder
 	ClusterResourceNamespace          string
+	ClusterIssuerSecretNamespace      string
 	SecretAccessGrantedAtClusterLevel bool
 	Clock                             clock.Clock
-	CheckApprovedCondition            bool
+	LogSampler                        *EnrollmentLogSampler
+	RequestIDHeader                   string
+	// CheckApprovedCondition waits for CertificateRequests that reference an Issuer to be approved
+	// before signing them
+	CheckApprovedCondition bool
+	// CheckClusterIssuerApprovedCondition waits for CertificateRequests that reference a ClusterIssuer
+	// to be approved before signing them
+	CheckClusterIssuerApprovedCondition bool
+	// ApprovedCheckExemptNamespaces selects the namespaces whose CertificateRequests are signed without
+	// waiting to be approved, e.g. trusted namespaces that auto-signing is allowed in. If nil, the
+	// approved condition is checked in every namespace as configured by CheckApprovedCondition and
+	// CheckClusterIssuerApprovedCondition.
+	ApprovedCheckExemptNamespaces labels.Selector
+	// DisableClusterIssuers ignores CertificateRequests that reference a ClusterIssuer, e.g. if they
+	// are handled by another instance of the controller
+	DisableClusterIssuers bool
+	// CommandInsecureSkipVerify disables verification of Command's server certificate for every issuer
+	CommandInsecureSkipVerify bool
+	// UserAgentSuffix is appended to the User-Agent sent to Command, e.g. to identify the cluster
+	UserAgentSuffix string
+	// TransportOptions tunes the connection pool of the HTTP transports used to connect to Command
+	TransportOptions signer.TransportOptions
+	// CSRLimits limits the CSRs that are sent to Command. Zero values disable the limits.
+	CSRLimits signer.CSRLimits
+	// SchemaCache caches the certificate templates and metadata fields of Command to validate requests
+	// before they are enrolled. If nil, requests aren't validated against them.
+	SchemaCache *signer.SchemaCache
+	// CAChainCache caches the CA chains returned by Command, so that enrollments with the same CA and
+	// certificate template don't fetch the chain again. If nil, the chain is fetched with every enrollment.
+	CAChainCache *signer.CAChainCache
+	// CircuitBreaker short-circuits calls to a Command host that is persistently down. If nil, calls
+	// to Command are never short-circuited.
+	CircuitBreaker *signer.CircuitBreaker
+	// RateLimiter limits the rate of requests to Command, e.g. to a share of a budget shared by the
+	// replicas of the controller. If nil, requests aren't rate limited.
+	RateLimiter *rate.Limiter
+	// IssuerStatusHandler records successful enrollments for the issuer status endpoint. If nil, they
+	// aren't recorded.
+	IssuerStatusHandler *IssuerStatusHandler
+	// EnrollmentPollInterval is how often an enrollment that is awaiting approval in Command is polled
+	EnrollmentPollInterval time.Duration
+	// EnrollmentMaxPendingDuration is how long an enrollment may await approval in Command before the
+	// CertificateRequest is marked as Failed. If zero, the enrollment is polled until it is approved or denied.
+	EnrollmentMaxPendingDuration time.Duration
+	// Recorder records Events on CertificateRequests, e.g. when the issued certificate doesn't
+	// match the CSR. If nil, no Events are recorded.
+	Recorder record.EventRecorder
+	// ClusterName identifies the cluster in the metadata of the certificates enrolled in Command. If
+	// empty, it isn't recorded.
+	ClusterName string
+	// Timeout bounds the calls to Command of a single reconcile, which may make several requests. If
+	// zero, reconciles aren't bounded.
+	Timeout time.Duration
+	// ClockSkewTolerance is how far the validity window of an issued certificate may be from the local
+	// time before a warning is recorded
+	ClockSkewTolerance time.Duration
+	// ShutdownGracePeriod is how long an in-flight reconcile may continue after the controller begins
+	// to shut down, so that an enrollment isn't abandoned before it is recorded. If zero, in-flight
+	// reconciles are cancelled immediately.
+	ShutdownGracePeriod time.Duration
+	// RecordCertificateFingerprints records the serial number and SHA-256 fingerprint of each enrolled
+	// certificate as annotations of the CertificateRequest
+	RecordCertificateFingerprints bool
+	// MaxEnrollmentAttempts is how many enrollments of a CertificateRequest may fail before it is
+	// marked as Failed. Failures caused by the unavailability of Command, timeouts, and authentication
+	// failures aren't counted. If zero, failed enrollments are retried indefinitely.
+	MaxEnrollmentAttempts int
+	// EnrollmentCoalescer reuses an enrollment of the same CSR for the same Certificate that is in flight
+	// or completed recently, instead of enrolling it again. If nil, every CertificateRequest is enrolled.
+	EnrollmentCoalescer *EnrollmentCoalescer
+	// AuditLogger writes a structured record of every enrollment, whatever its outcome. If nil,
+	// enrollments aren't audited.
+	AuditLogger *AuditLogger
+	// EnrollmentNotifier notifies a webhook of every completed enrollment. If nil, no notifications
+	// are sent.
+	EnrollmentNotifier *EnrollmentNotifier
+	// IssuerLimiter enforces the enrollment limits of the issuers. If nil, the enrollment limits of
+	// issuers aren't enforced.
+	IssuerLimiter *IssuerLimiter
+	// MaxConditionMessageLength is the maximum length in bytes of condition messages. Longer messages
+	// are truncated, and the full message is recorded as an Event. If zero, messages aren't truncated.
+	MaxConditionMessageLength int
+	// IssuerRefDiagnostics records an Event explaining why the issuer referenced by a CertificateRequest
+	// of this group can't be used, e.g. because issuerRef has a misspelled name or the wrong kind, or
+	// the issuer isn't ready
+	IssuerRefDiagnostics bool
+	// PriorityReconciles is how many CertificateRequests annotated with the high priority are
+	// reconciled at once by a controller with a work queue of its own, so that they are processed
+	// ahead of the queue of normal requests, e.g. during a mass rotation. If zero, the annotation is
+	// ignored and all requests share one queue.
+	PriorityReconciles int
+	// Backpressure observes the latency of Command and lengthens the interval that enrollments awaiting
+	// approval are polled at while it trends upward. If nil, the latency isn't observed and the interval
+	// is unchanged.
+	Backpressure *Backpressure
+	// SkipEnrollmentAnnotation is the annotation that marks a CertificateRequest as handled manually,
+	// e.g. while it is provisioned out-of-band during an incident. CertificateRequests whose annotation
+	// is "true" are left untouched until it is removed. If empty, no CertificateRequests are skipped.
+	SkipEnrollmentAnnotation string
 }
 
-// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;patch;watch
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile attempts to sign a CertificateRequest given the configuration provided and a configured
 // Command signer instance.
 func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
-	log := ctrl.LoggerFrom(ctx)
+	ctx, cancel := withShutdownGracePeriod(ctx, r.ShutdownGracePeriod)
+	defer cancel()
+
+	log := ctrl.LoggerFrom(ctx).WithName(ReconcilerLoggerName)
+	ctx = ctrl.LoggerInto(ctx, log)
 
 	meta := signer.K8sMetadata{}
 
@@ -83,6 +278,11 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	if r.DisableClusterIssuers && certificateRequest.Spec.IssuerRef.Kind == "ClusterIssuer" {
+		log.Info("ClusterIssuers are disabled. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+
 	// Ignore CertificateRequest if it is already Ready
 	if cmutil.CertificateRequestHasCondition(&certificateRequest, cmapi.CertificateRequestCondition{
 		Type:   cmapi.CertificateRequestConditionReady,
@@ -111,6 +311,16 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	// Leave the CertificateRequest and its conditions untouched while it is handled manually. It isn't
+	// requeued, so it doesn't hold a worker, and it is reconciled again when the annotation is removed.
+	if r.skipEnrollment(ctx, &certificateRequest) {
+		log.Info("CertificateRequest is annotated to be handled manually. Ignoring.", "annotation", r.SkipEnrollmentAnnotation)
+		if r.Recorder != nil {
+			r.Recorder.Event(&certificateRequest, corev1.EventTypeNormal, reasonEnrollmentSkipped, fmt.Sprintf("Not enrolling the CertificateRequest because it is annotated with %s. Remove the annotation to enroll it.", r.SkipEnrollmentAnnotation))
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// We now have a CertificateRequest that belongs to us so we are responsible
 	// for updating its Ready condition.
 	setReadyCondition := func(status cmmeta.ConditionStatus, reason, message string) {
@@ -119,10 +329,20 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 			cmapi.CertificateRequestConditionReady,
 			status,
 			reason,
-			message,
+			conditionMessage(r.Recorder, &certificateRequest, message, r.MaxConditionMessageLength),
 		)
 	}
 
+	// setFailed marks the CertificateRequest as permanently failed so that cert-manager backs off
+	// before creating a new CertificateRequest, instead of the request being retried
+	setFailed := func(reason, message string) {
+		if certificateRequest.Status.FailureTime == nil {
+			nowTime := metav1.NewTime(r.Clock.Now())
+			certificateRequest.Status.FailureTime = &nowTime
+		}
+		setReadyCondition(cmmeta.ConditionFalse, reason, message)
+	}
+
 	// Always attempt to update the Ready condition
 	defer func() {
 		if err != nil {
@@ -139,17 +359,16 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	if cmutil.CertificateRequestIsDenied(&certificateRequest) {
 		log.Info("CertificateRequest has been denied yet. Marking as failed.")
 
-		if certificateRequest.Status.FailureTime == nil {
-			nowTime := metav1.NewTime(r.Clock.Now())
-			certificateRequest.Status.FailureTime = &nowTime
-		}
-
 		message := "The CertificateRequest was denied by an approval controller"
-		setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonDenied, message)
+		setFailed(cmapi.CertificateRequestReasonDenied, message)
 		return ctrl.Result{}, nil
 	}
 
-	if r.CheckApprovedCondition {
+	checkApproved, err := r.checkApprovedCondition(ctx, &certificateRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if checkApproved {
 		// If CertificateRequest has not been approved, exit early.
 		if !cmutil.CertificateRequestIsApproved(&certificateRequest) {
 			log.Info("CertificateRequest has not been approved yet. Ignoring.")
@@ -170,7 +389,8 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	if err != nil {
 		err = fmt.Errorf("%w: %v", errIssuerRef, err)
 		log.Error(err, "Unrecognized kind. Ignoring.")
-		setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, err.Error())
+		setFailed(cmapi.CertificateRequestReasonFailed, err.Error())
+		r.recordIssuerRefEvent(&certificateRequest, reasonInvalidIssuerRef, issuerKindDiagnosis(certificateRequest.Spec.IssuerRef.Kind))
 		return ctrl.Result{}, nil
 	}
 	issuer := issuerRO.(client.Object)
@@ -178,76 +398,125 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	issuerName := types.NamespacedName{
 		Name: certificateRequest.Spec.IssuerRef.Name,
 	}
-	var secretNamespace string
 	switch t := issuer.(type) {
 	case *commandissuer.Issuer:
 		issuerName.Namespace = certificateRequest.Namespace
-		secretNamespace = certificateRequest.Namespace
 		log = log.WithValues("issuer", issuerName)
 		meta.ControllerKind = "issuer"
 	case *commandissuer.ClusterIssuer:
-		secretNamespace = r.ClusterResourceNamespace
 		log = log.WithValues("clusterissuer", issuerName)
 		meta.ControllerKind = "clusterissuer"
 	default:
 		err := fmt.Errorf("unexpected issuer type: %v", t)
 		log.Error(err, "The issuerRef referred to a registered Kind which is not yet handled. Ignoring.")
-		setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, err.Error())
+		setFailed(cmapi.CertificateRequestReasonFailed, err.Error())
 		return ctrl.Result{}, nil
 	}
 
-	// If SecretAccessGrantedAtClusterLevel is false, we always look for the Secret in the same namespace as the Issuer
-	if !r.SecretAccessGrantedAtClusterLevel {
-		secretNamespace = r.ClusterResourceNamespace
-	}
-
 	// Get the Issuer or ClusterIssuer
 	if err := r.Get(ctx, issuerName, issuer); err != nil {
+		if apierrors.IsNotFound(err) && r.IssuerRefDiagnostics {
+			if diagnosis := r.issuerNotFoundDiagnosis(ctx, &certificateRequest); diagnosis != "" {
+				r.recordIssuerRefEvent(&certificateRequest, reasonIssuerNotFound, diagnosis)
+				return ctrl.Result{}, fmt.Errorf("%w: %v. %s", errGetIssuer, err, diagnosis)
+			}
+		}
 		return ctrl.Result{}, fmt.Errorf("%w: %v", errGetIssuer, err)
 	}
 
+	secretNamespace, err := issuerutil.GetSecretNamespace(issuer, r.ClusterResourceNamespace, r.ClusterIssuerSecretNamespace, r.SecretAccessGrantedAtClusterLevel)
+	if err != nil {
+		log.Error(err, "Unable to determine the Secret namespace. Ignoring.")
+		setFailed(cmapi.CertificateRequestReasonFailed, err.Error())
+		return ctrl.Result{}, nil
+	}
+
 	issuerSpec, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
 	if err != nil {
 		log.Error(err, "Unable to get the IssuerStatus. Ignoring.")
-		setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, err.Error())
+		setFailed(cmapi.CertificateRequestReasonFailed, err.Error())
 		return ctrl.Result{}, nil
 	}
 
-	if !issuerutil.IsReady(issuerStatus) {
+	if !issuerutil.IsReady(issuerStatus, issuer.GetGeneration()) {
+		if r.IssuerRefDiagnostics {
+			diagnosis := issuerNotReadyDiagnosis(issuer, issuerStatus)
+			r.recordIssuerRefEvent(&certificateRequest, reasonIssuerNotReady, diagnosis)
+			return ctrl.Result{}, fmt.Errorf("%w: %s", errIssuerNotReady, diagnosis)
+		}
 		return ctrl.Result{}, errIssuerNotReady
 	}
 
-	// Set the context on the config client
-	r.ConfigClient.SetContext(ctx)
+	issuerSpec, err = specWithProfile(ctx, r.Client, issuerSpec, profileNamespace(issuer, r.ClusterResourceNamespace))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-	authSecretName := types.NamespacedName{
-		Name:      issuerSpec.SecretName,
-		Namespace: secretNamespace,
+	// Send a request ID to Command on every call so that its logs can be correlated with ours
+	if r.RequestIDHeader != "" {
+		var requestID string
+		ctx, requestID = signer.ContextWithRequestID(ctx, r.RequestIDHeader)
+		log = log.WithValues("requestID", requestID)
 	}
+	ctx = signer.ContextWithUserAgentSuffix(ctx, r.UserAgentSuffix)
+	ctx = signer.ContextWithTransportOptions(ctx, r.TransportOptions)
+	ctx = signer.ContextWithCSRLimits(ctx, r.CSRLimits)
+	ctx = signer.ContextWithSchemaCache(ctx, r.SchemaCache)
+	ctx = signer.ContextWithCAChainCache(ctx, r.CAChainCache)
+	ctx = signer.ContextWithCircuitBreaker(ctx, r.CircuitBreaker)
+	ctx = signer.ContextWithRateLimiter(ctx, r.RateLimiter)
+	if r.Backpressure != nil {
+		ctx = signer.ContextWithLatencyObserver(ctx, r.Backpressure)
+	}
+	ctx, endpoints := signer.ContextWithEndpointRecorder(ctx)
 
-	var authSecret corev1.Secret
-	if err = r.ConfigClient.GetSecret(authSecretName, &authSecret); err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, authSecretName, err)
+	// Only a sample of enrollments emit informational logs, errors are always logged
+	sampleKey := meta.ControllerKind + "/" + issuerName.Name
+	if issuerName.Namespace != "" {
+		sampleKey = meta.ControllerKind + "/" + issuerName.Namespace + "/" + issuerName.Name
 	}
+	sampled := r.LogSampler.Sample(sampleKey)
+	ctx = ctrl.LoggerInto(ctx, r.LogSampler.Logger(log, sampled))
 
-	// Retrieve the CA certificate secret
-	caSecretName := types.NamespacedName{
-		Name:      issuerSpec.CaSecretName,
-		Namespace: authSecretName.Namespace,
+	// Bound the calls to Command so that a slow Command instance doesn't occupy a worker indefinitely.
+	// Kubernetes is still updated with ctx, so that a certificate issued just before the timeout is
+	// recorded rather than enrolled again.
+	commandCtx := ctx
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		commandCtx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
 	}
+	// The signer logs under its own name, so that its verbosity can be configured separately
+	commandCtx = ctrl.LoggerInto(commandCtx, ctrl.LoggerFrom(commandCtx).WithName(SignerLoggerName))
 
-	var caSecret corev1.Secret
-	if issuerSpec.CaSecretName != "" {
-		// If the CA secret name is not specified, we will not attempt to retrieve it
-		err = r.ConfigClient.GetSecret(caSecretName, &caSecret)
-		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetCaSecret, caSecretName, err)
+	// If a previous reconcile already enrolled a certificate for this request but failed to update
+	// the status, use the recorded certificate instead of enrolling a duplicate in Command
+	if leaf, chain, ok := enrolledCertificate(&certificateRequest); ok {
+		log.Info("Found certificate enrolled by a previous reconcile. Not enrolling again.")
+		if err := r.checkIssuedNames(ctx, &certificateRequest, issuerSpec, leaf); err != nil {
+			setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{}, nil
 		}
+		if err := r.checkCertificatePolicy(ctx, &certificateRequest, issuerSpec, leaf); err != nil {
+			setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{}, nil
+		}
+		certificateRequest.Status.Certificate = leaf
+		certificateRequest.Status.CA = chain
+
+		setReadyCondition(cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, "Signed")
+		return ctrl.Result{}, nil
 	}
 
-	commandSigner, err := r.SignerBuilder(ctx, issuerSpec, certificateRequest.GetAnnotations(), authSecret.Data, caSecret.Data)
+	commandSigner, err := newIssuerSigner(commandCtx, r.ConfigClient, r.SignerBuilder, issuerSpec, secretNamespace, r.CommandInsecureSkipVerify, certificateRequest.GetAnnotations())
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w: %v", errSignerBuilder, err)
+		if errors.Is(err, signer.ErrInvalidConfig) {
+			log.Error(err, "Issuer configuration is invalid. Retrying.")
+			setReadyCondition(cmmeta.ConditionFalse, certificateRequestReasonInvalidIssuer, err.Error())
+			return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+		}
+		return ctrl.Result{}, err
 	}
 
 	// Assign metadata
@@ -258,11 +527,173 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	meta.IssuerNamespace = certificateRequest.Namespace
 	meta.ControllerReconcileId = string(controller.ReconcileIDFromContext(ctx))
 	meta.CertificateSigningRequestNamespace = certificateRequest.Namespace
+	meta.ClusterName = r.ClusterName
+	meta.IssuerMetadata = issuerMetadata(issuer, issuerSpec)
+	if certificateRequest.Spec.Duration != nil {
+		meta.Duration = certificateRequest.Spec.Duration.Duration
+	}
+	meta.IsCA = certificateRequest.Spec.IsCA
 
-	leaf, chain, err := commandSigner.Sign(ctx, certificateRequest.Spec.Request, meta)
+	var leaf, chain []byte
+	var certificateID int32
+	var coalescedFrom string
+	limitedSigner := r.IssuerLimiter.Signer(commandSigner, issuer, issuerSpec.EnrollmentLimits)
+	pendingRequestID, polling := pendingEnrollment(&certificateRequest)
+	if polling {
+		// The CSR was already enrolled by a previous reconcile and is awaiting approval in Command
+		log.Info(fmt.Sprintf("Polling enrollment request %d awaiting approval in Command", pendingRequestID))
+		leaf, chain, certificateID, err = limitedSigner.PollEnrollment(commandCtx, certificateRequest.Spec.Request, pendingRequestID, meta)
+	} else {
+		if issuerSpec.EnableRenewal {
+			meta.RenewalCertificateID = r.renewalCertificateID(ctx, &certificateRequest)
+		}
+
+		leaf, chain, certificateID, coalescedFrom, err = r.EnrollmentCoalescer.Enroll(commandCtx, coalescingKey(&certificateRequest), certificateRequest.Name, func() ([]byte, []byte, int32, error) {
+			return limitedSigner.Sign(commandCtx, certificateRequest.Spec.Request, meta)
+		})
+	}
+
+	// An enrollment awaiting approval is audited when it is first enrolled and when it completes, not
+	// on every poll. Requests queued by the enrollment limits of the issuer weren't enrolled.
+	var pendingErr *signer.EnrollmentPendingError
+	var limitErr *enrollmentLimitError
+	if (!polling || !errors.As(err, &pendingErr)) && (!errors.As(err, &limitErr) || limitErr.failFast) {
+		record := auditEnrollment("CertificateRequest", &certificateRequest, issuer, issuerSpec, commandSigner, certificateID, err)
+		if err == nil && coalescedFrom != "" {
+			record.Outcome = AuditOutcomeReused
+		}
+		r.AuditLogger.Record(ctx, record)
+		r.EnrollmentNotifier.Notify(ctx, record)
+	}
+	if err != nil && errors.Is(commandCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("reconcile did not complete within %s: %w", r.Timeout, err)
+		log.Error(err, "Timed out waiting for Command. Retrying.")
+		setReadyCondition(cmmeta.ConditionFalse, certificateRequestReasonTimeout, fmt.Sprintf("%v: %v", errSignerSign, err))
+		return ctrl.Result{Requeue: true}, nil
+	}
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w: %v", errSignerSign, err)
+		if errors.As(err, &pendingErr) {
+			pendingSince, err := r.recordPendingEnrollment(ctx, &certificateRequest, pendingErr.RequestID)
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordPending, err)
+			}
+
+			if r.EnrollmentMaxPendingDuration > 0 && r.Clock.Since(pendingSince) >= r.EnrollmentMaxPendingDuration {
+				err = fmt.Errorf("enrollment request %d was not approved in Command within %s", pendingErr.RequestID, r.EnrollmentMaxPendingDuration)
+				log.Error(err, "Enrollment is still pending. Not retrying.")
+				setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+				return ctrl.Result{}, nil
+			}
+
+			pollInterval := r.EnrollmentPollInterval
+			if pollInterval <= 0 {
+				pollInterval = defaultEnrollmentPollInterval
+			}
+			pollInterval = r.Backpressure.Requeue(pollInterval)
+			log.Info(fmt.Sprintf("Enrollment is awaiting approval in Command. Polling again in %s.", pollInterval))
+			setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, pendingErr.Error())
+			return ctrl.Result{RequeueAfter: pollInterval}, nil
+		}
+		if errors.Is(err, signer.ErrSubjectPatternMismatch) || errors.Is(err, signer.ErrSANTypeNotAllowed) || errors.Is(err, signer.ErrDNSDomainNotPermitted) || errors.Is(err, signer.ErrChangeReferenceInvalid) || errors.Is(err, signer.ErrCommonNameRequired) || errors.Is(err, signer.ErrCSRTooLarge) || errors.Is(err, signer.ErrCertificateAuthorityNotAllowed) || errors.Is(err, signer.ErrKeyPolicyViolation) || errors.Is(err, signer.ErrExtendedKeyUsageAmbiguous) || errors.Is(err, signer.ErrCANotAllowed) || errors.Is(err, signer.ErrCSRMalformed) {
+			log.Error(err, "CertificateRequest does not conform to the issuer policy. Not retrying.")
+			setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, signer.ErrEnrollmentDenied) {
+			log.Error(err, "Command denied the enrollment. Not retrying.")
+			setFailed(cmapi.CertificateRequestReasonDenied, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, signer.ErrSchemaMismatch) {
+			log.Error(err, "CertificateRequest references a certificate template or metadata field that doesn't exist in Command, or has a key type the template doesn't support. Not retrying.")
+			setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, signer.ErrEnrollmentRejected) {
+			log.Error(err, "Command rejected the enrollment. Not retrying.")
+			setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, signer.ErrInvalidConfig) {
+			// e.g. the enrollment request template of the issuer rendered an invalid request
+			log.Error(err, "Issuer configuration is invalid. Retrying.")
+			setReadyCondition(cmmeta.ConditionFalse, certificateRequestReasonInvalidIssuer, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+		}
+		if errors.Is(err, signer.ErrAuthenticationFailed) {
+			log.Error(err, "Command rejected the issuer credentials. Retrying.")
+			setReadyCondition(cmmeta.ConditionFalse, certificateRequestReasonAuthenticationFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+		}
+		var circuitErr *signer.CircuitOpenError
+		if errors.As(err, &circuitErr) {
+			log.Info(circuitErr.Error())
+			setReadyCondition(cmmeta.ConditionFalse, certificateRequestReasonCommandUnavailable, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{RequeueAfter: circuitErr.RetryAfter}, nil
+		}
+		if errors.As(err, &limitErr) {
+			if limitErr.failFast {
+				log.Error(err, "Issuer exceeded its enrollment limits. Not retrying.")
+				setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+				return ctrl.Result{}, nil
+			}
+			log.Info(limitErr.Error())
+			setReadyCondition(cmmeta.ConditionFalse, certificateRequestReasonEnrollmentLimited, fmt.Sprintf("%v: %v", errSignerSign, err))
+			return ctrl.Result{RequeueAfter: limitErr.retryAfter}, nil
+		}
+		if polling || errors.Is(err, signer.ErrTransient) || r.MaxEnrollmentAttempts <= 0 {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errSignerSign, err)
+		}
+
+		attempts, recordErr := r.recordFailedAttempt(ctx, &certificateRequest)
+		if recordErr != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordAttempt, recordErr)
+		}
+		if attempts >= r.MaxEnrollmentAttempts {
+			log.Error(err, fmt.Sprintf("Enrollment failed %d times. Not retrying.", attempts))
+			setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: enrollment failed %d times: %v", errSignerSign, attempts, err))
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("%w (attempt %d of %d): %v", errSignerSign, attempts, r.MaxEnrollmentAttempts, err)
+	}
+	if coalescedFrom != "" {
+		log.Info(fmt.Sprintf("Reusing the certificate enrolled for CertificateRequest %s with the same CSR. Not enrolling again.", coalescedFrom))
+	} else {
+		r.IssuerStatusHandler.RecordEnrollment(issuer)
+	}
+
+	endpoint, failedOver := endpoints.Endpoint()
+	if failedOver {
+		log.Info(fmt.Sprintf("WARNING: The certificate was enrolled with the fallback Command endpoint %s", endpoint))
+		if r.Recorder != nil {
+			r.Recorder.Event(&certificateRequest, corev1.EventTypeWarning, reasonCommandFailover, fmt.Sprintf("Enrolled with the fallback Command endpoint %s because the preferred endpoints failed", endpoint))
+		}
+	}
+
+	// Record the certificate before updating the status so that a retry doesn't enroll it again
+	if err = r.recordEnrolledCertificate(ctx, &certificateRequest, leaf, chain, certificateID, endpoint); err != nil {
+		return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordEnrolled, err)
+	}
+
+	if issuerSpec.EnableRenewal {
+		if err := r.recordCertificateID(ctx, &certificateRequest, certificateID); err != nil {
+			// The certificate was issued, so only the next renewal is affected
+			log.Error(err, "Failed to record the Command certificate ID on the Certificate. The next renewal will enroll a new certificate.")
+		}
+	}
+
+	// The names are compared after the patches above, which replace the status of certificateRequest
+	if err := r.checkIssuedNames(ctx, &certificateRequest, issuerSpec, leaf); err != nil {
+		setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+		return ctrl.Result{}, nil
 	}
+	if err := r.checkCertificatePolicy(ctx, &certificateRequest, issuerSpec, leaf); err != nil {
+		setFailed(cmapi.CertificateRequestReasonFailed, fmt.Sprintf("%v: %v", errSignerSign, err))
+		return ctrl.Result{}, nil
+	}
+
+	r.checkValidityWindow(ctx, &certificateRequest, leaf)
+
 	certificateRequest.Status.Certificate = leaf
 	certificateRequest.Status.CA = chain
 
@@ -270,10 +701,346 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	return ctrl.Result{}, nil
 }
 
+// checkValidityWindow records a warning Event if the issued certificate isn't valid at the local time
+// beyond the clock skew tolerance. The certificate is still issued, since it is valid at the time of the CA.
+func (r *CertificateRequestReconciler) checkValidityWindow(ctx context.Context, certificateRequest *cmapi.CertificateRequest, leaf []byte) {
+	log := ctrl.LoggerFrom(ctx)
+
+	err := signer.CheckValidityWindow(leaf, r.Clock.Now(), r.ClockSkewTolerance)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, signer.ErrValidityWindow) {
+		log.Error(err, "Failed to check the validity of the issued certificate")
+		return
+	}
+
+	log.Info(fmt.Sprintf("WARNING: %v", err))
+	if r.Recorder != nil {
+		r.Recorder.Event(certificateRequest, corev1.EventTypeWarning, reasonClockSkew, err.Error())
+	}
+}
+
+// checkApprovedCondition returns whether the CertificateRequest must be approved before it is signed,
+// depending on the kind of issuer it references and the labels of its namespace
+func (r *CertificateRequestReconciler) checkApprovedCondition(ctx context.Context, certificateRequest *cmapi.CertificateRequest) (bool, error) {
+	check := r.CheckApprovedCondition
+	if certificateRequest.Spec.IssuerRef.Kind == "ClusterIssuer" {
+		check = r.CheckClusterIssuerApprovedCondition
+	}
+	if !check || r.ApprovedCheckExemptNamespaces == nil {
+		return check, nil
+	}
+
+	var namespace corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: certificateRequest.Namespace}, &namespace); err != nil {
+		return false, fmt.Errorf("%w: %v", errGetNamespace, err)
+	}
+	if r.ApprovedCheckExemptNamespaces.Matches(labels.Set(namespace.Labels)) {
+		ctrl.LoggerFrom(ctx).V(1).Info("Namespace is exempt from the approved check", "namespace", namespace.Name)
+		return false, nil
+	}
+	return true, nil
+}
+
+// certificateRequestsForNamespace returns a reconcile request for every CertificateRequest in the
+// namespace, so that requests awaiting approval are signed once their namespace becomes exempt from
+// the approved check
+func (r *CertificateRequestReconciler) certificateRequestsForNamespace(ctx context.Context, namespace client.Object) []reconcile.Request {
+	if !r.ApprovedCheckExemptNamespaces.Matches(labels.Set(namespace.GetLabels())) {
+		return nil
+	}
+
+	var list cmapi.CertificateRequestList
+	if err := r.List(ctx, &list, client.InNamespace(namespace.GetName())); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to list the CertificateRequests of the namespace", "namespace", namespace.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
+
+// checkIssuedNames compares the names of the issued certificate with the names requested by the CSR of
+// the CertificateRequest and the additional SANs of the issuer, since the certificate template may have
+// removed or rewritten them. A mismatch is recorded in an Event and the SANMismatch condition, or
+// returned if the SANMismatchPolicy of the issuer is Fail.
+func (r *CertificateRequestReconciler) checkIssuedNames(ctx context.Context, certificateRequest *cmapi.CertificateRequest, issuerSpec *commandissuer.IssuerSpec, leaf []byte) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	policy := issuerSpec.SANMismatchPolicy
+	if policy == commandissuer.SANMismatchPolicyIgnore {
+		return nil
+	}
+
+	err := signer.CompareIssuedNames(certificateRequest.Spec.Request, leaf, issuerSpec)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, signer.ErrIssuedSANMismatch) {
+		// The certificate was issued, so a comparison failure doesn't fail the request
+		log.Error(err, "Failed to compare the issued certificate with the CSR")
+		return nil
+	}
+
+	if policy == commandissuer.SANMismatchPolicyFail {
+		log.Error(err, "Command issued a certificate that doesn't match the CSR. Not retrying.")
+		return err
+	}
+
+	log.Info(fmt.Sprintf("WARNING: %v", err))
+	if r.Recorder != nil {
+		r.Recorder.Event(certificateRequest, corev1.EventTypeWarning, reasonSANMismatch, err.Error())
+	}
+	cmutil.SetCertificateRequestCondition(certificateRequest, certificateRequestConditionSANMismatch, cmmeta.ConditionTrue, reasonSANMismatch, err.Error())
+	return nil
+}
+
+// checkCertificatePolicy verifies that the issued certificate asserts the certificate policy required by
+// the issuer, if any. A certificate without the policy is recorded in an Event and returned as an error,
+// since the certificate template or certificate authority won't issue it on retries either.
+func (r *CertificateRequestReconciler) checkCertificatePolicy(ctx context.Context, certificateRequest *cmapi.CertificateRequest, issuerSpec *commandissuer.IssuerSpec, leaf []byte) error {
+	if issuerSpec.RequiredCertificatePolicy == nil {
+		return nil
+	}
+
+	err := signer.CheckCertificatePolicy(leaf, issuerSpec.RequiredCertificatePolicy.OID)
+	if err == nil {
+		return nil
+	}
+
+	ctrl.LoggerFrom(ctx).Error(err, "Command issued a certificate without the required certificate policy. Not retrying.")
+	if r.Recorder != nil && errors.Is(err, signer.ErrCertificatePolicyMissing) {
+		r.Recorder.Event(certificateRequest, corev1.EventTypeWarning, reasonCertificatePolicyMissing, err.Error())
+	}
+	return err
+}
+
+// enrollmentKey returns a key that identifies a single enrollment of the CertificateRequest
+func enrollmentKey(certificateRequest *cmapi.CertificateRequest) string {
+	return fmt.Sprintf("%s/%d", certificateRequest.UID, certificateRequest.Generation)
+}
+
+// enrolledCertificate returns the certificate and chain recorded on the CertificateRequest by
+// recordEnrolledCertificate, if they were enrolled for the current UID and generation.
+func enrolledCertificate(certificateRequest *cmapi.CertificateRequest) ([]byte, []byte, bool) {
+	annotations := certificateRequest.GetAnnotations()
+	if annotations[enrollmentKeyAnnotation] != enrollmentKey(certificateRequest) {
+		return nil, nil, false
+	}
+
+	leaf, ok := annotations[enrolledCertificateAnnotation]
+	if !ok || leaf == "" {
+		return nil, nil, false
+	}
+
+	return []byte(leaf), []byte(annotations[enrolledCertificateCAAnnotation]), true
+}
+
+// pendingEnrollment returns the Command request ID of the enrollment recorded on the CertificateRequest
+// by recordPendingEnrollment, if it was enrolled for the current UID and generation.
+func pendingEnrollment(certificateRequest *cmapi.CertificateRequest) (int32, bool) {
+	annotations := certificateRequest.GetAnnotations()
+	if annotations[enrollmentKeyAnnotation] != enrollmentKey(certificateRequest) {
+		return 0, false
+	}
+
+	requestID, err := strconv.ParseInt(annotations[pendingRequestIDAnnotation], 10, 32)
+	if err != nil || requestID <= 0 {
+		return 0, false
+	}
+
+	return int32(requestID), true
+}
+
+// recordPendingEnrollment patches the Command request ID of an enrollment awaiting approval onto the
+// CertificateRequest annotations and returns the time at which the enrollment was first found pending.
+func (r *CertificateRequestReconciler) recordPendingEnrollment(ctx context.Context, certificateRequest *cmapi.CertificateRequest, requestID int32) (time.Time, error) {
+	annotations := certificateRequest.GetAnnotations()
+	if id, ok := pendingEnrollment(certificateRequest); ok && id == requestID {
+		if pendingSince, err := time.Parse(time.RFC3339, annotations[pendingSinceAnnotation]); err == nil {
+			return pendingSince, nil
+		}
+	}
+
+	patch := client.MergeFrom(certificateRequest.DeepCopy())
+
+	pendingSince := r.Clock.Now().UTC().Truncate(time.Second)
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[enrollmentKeyAnnotation] = enrollmentKey(certificateRequest)
+	annotations[pendingRequestIDAnnotation] = strconv.FormatInt(int64(requestID), 10)
+	annotations[pendingSinceAnnotation] = pendingSince.Format(time.RFC3339)
+	certificateRequest.SetAnnotations(annotations)
+
+	return pendingSince, r.Patch(ctx, certificateRequest, patch)
+}
+
+// recordFailedAttempt increments the number of failed enrollments recorded on the CertificateRequest
+// annotations for the current UID and generation, and returns the new number of failed enrollments.
+func (r *CertificateRequestReconciler) recordFailedAttempt(ctx context.Context, certificateRequest *cmapi.CertificateRequest) (int, error) {
+	patch := client.MergeFrom(certificateRequest.DeepCopy())
+
+	annotations := certificateRequest.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	attempts := 0
+	if annotations[enrollmentKeyAnnotation] == enrollmentKey(certificateRequest) {
+		// An unparsable count is reset rather than failing the request
+		attempts, _ = strconv.Atoi(annotations[failedAttemptsAnnotation])
+	}
+	attempts++
+	annotations[enrollmentKeyAnnotation] = enrollmentKey(certificateRequest)
+	annotations[failedAttemptsAnnotation] = strconv.Itoa(attempts)
+	certificateRequest.SetAnnotations(annotations)
+
+	return attempts, r.Patch(ctx, certificateRequest, patch)
+}
+
+// recordEnrolledCertificate patches the certificate and chain enrolled with Command onto the
+// CertificateRequest annotations, along with the host of the Command instance that enrolled it, if
+// known. Unlike the status update, the merge patch doesn't conflict with concurrent updates, so the
+// certificate is retained if the status update fails.
+func (r *CertificateRequestReconciler) recordEnrolledCertificate(ctx context.Context, certificateRequest *cmapi.CertificateRequest, leaf, chain []byte, certificateID int32, endpoint string) error {
+	patch := client.MergeFrom(certificateRequest.DeepCopy())
+
+	annotations := certificateRequest.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[enrollmentKeyAnnotation] = enrollmentKey(certificateRequest)
+	annotations[enrolledCertificateAnnotation] = string(leaf)
+	annotations[enrolledCertificateCAAnnotation] = string(chain)
+	if certificateID != 0 {
+		annotations[enrolledCertificateIDAnnotation] = strconv.FormatInt(int64(certificateID), 10)
+	}
+	if endpoint != "" {
+		annotations[commandEndpointAnnotation] = endpoint
+	}
+	if r.RecordCertificateFingerprints {
+		serial, fingerprint, err := signer.CertificateFingerprint(leaf)
+		if err != nil {
+			// The certificate is recorded regardless, since it was already issued by Command
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to compute the fingerprint of the enrolled certificate")
+		} else {
+			annotations[enrolledCertificateSerialAnnotation] = serial
+			annotations[enrolledCertificateFingerprintAnnotation] = fingerprint
+		}
+	}
+	delete(annotations, pendingRequestIDAnnotation)
+	delete(annotations, pendingSinceAnnotation)
+	certificateRequest.SetAnnotations(annotations)
+
+	return r.Patch(ctx, certificateRequest, patch)
+}
+
+// renewalCertificateID returns the Command ID of the certificate previously enrolled for the
+// Certificate that owns the CertificateRequest, or zero if a new certificate should be enrolled.
+func (r *CertificateRequestReconciler) renewalCertificateID(ctx context.Context, certificateRequest *cmapi.CertificateRequest) int32 {
+	log := ctrl.LoggerFrom(ctx)
+
+	certificateName, ok := certificateRequest.GetAnnotations()[cmapi.CertificateNameKey]
+	if !ok || certificateName == "" {
+		log.Info("CertificateRequest is not owned by a Certificate. Enrolling a new certificate.")
+		return 0
+	}
+
+	var certificate cmapi.Certificate
+	if err := r.Get(ctx, types.NamespacedName{Namespace: certificateRequest.Namespace, Name: certificateName}, &certificate); err != nil {
+		log.Error(err, "Failed to get the Certificate. Enrolling a new certificate.", "certificate", certificateName)
+		return 0
+	}
+
+	value, ok := certificate.GetAnnotations()[certificateIDAnnotation]
+	if !ok {
+		log.Info("No previously enrolled certificate found. Enrolling a new certificate.", "certificate", certificateName)
+		return 0
+	}
+
+	certificateID, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || certificateID <= 0 {
+		log.Error(err, "Invalid Command certificate ID on the Certificate. Enrolling a new certificate.", "certificate", certificateName, "certificateID", value)
+		return 0
+	}
+
+	return int32(certificateID)
+}
+
+// recordCertificateID patches the Command ID of the enrolled certificate onto the Certificate that
+// owns the CertificateRequest so that the next renewal of the Certificate renews it in Command.
+func (r *CertificateRequestReconciler) recordCertificateID(ctx context.Context, certificateRequest *cmapi.CertificateRequest, certificateID int32) error {
+	certificateName, ok := certificateRequest.GetAnnotations()[cmapi.CertificateNameKey]
+	if !ok || certificateName == "" || certificateID == 0 {
+		return nil
+	}
+
+	var certificate cmapi.Certificate
+	if err := r.Get(ctx, types.NamespacedName{Namespace: certificateRequest.Namespace, Name: certificateName}, &certificate); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(certificate.DeepCopy())
+
+	annotations := certificate.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[certificateIDAnnotation] = strconv.FormatInt(int64(certificateID), 10)
+	certificate.SetAnnotations(annotations)
+
+	return r.Patch(ctx, &certificate, patch)
+}
+
 // SetupWithManager registers the CertificateRequestReconciler with the controller manager.
 // It configures controller-runtime to reconcile cert-manager CertificateRequests in the cluster.
 func (r *CertificateRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cmapi.CertificateRequest{}).
-		Complete(r)
+	if r.PriorityReconciles <= 0 {
+		return r.newControllerManagedBy(mgr).
+			For(&cmapi.CertificateRequest{}).
+			Complete(r)
+	}
+
+	// Requests of each priority are reconciled by a controller of their own
+	if err := r.newControllerManagedBy(mgr).
+		For(&cmapi.CertificateRequest{}, builder.WithPredicates(priorityPredicate(false))).
+		Complete(&priorityLaneReconciler{CertificateRequestReconciler: r}); err != nil {
+		return err
+	}
+	return r.newControllerManagedBy(mgr).
+		Named(priorityControllerName).
+		For(&cmapi.CertificateRequest{}, builder.WithPredicates(priorityPredicate(true))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.PriorityReconciles}).
+		Complete(&priorityLaneReconciler{CertificateRequestReconciler: r, highPriority: true})
+}
+
+// skipEnrollment returns true if the CertificateRequest is annotated to be handled manually. Values
+// other than booleans are ignored, so that a typo doesn't leave a request unprocessed silently.
+func (r *CertificateRequestReconciler) skipEnrollment(ctx context.Context, certificateRequest *cmapi.CertificateRequest) bool {
+	if r.SkipEnrollmentAnnotation == "" {
+		return false
+	}
+	value, ok := certificateRequest.GetAnnotations()[r.SkipEnrollmentAnnotation]
+	if !ok {
+		return false
+	}
+	skip, err := strconv.ParseBool(value)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("Ignoring the invalid value %q of annotation %s, which must be true or false", value, r.SkipEnrollmentAnnotation))
+		return false
+	}
+	return skip
+}
+
+// newControllerManagedBy returns a builder of a controller of CertificateRequests with the watches
+// shared by the controllers of every priority
+func (r *CertificateRequestReconciler) newControllerManagedBy(mgr ctrl.Manager) *builder.Builder {
+	b := ctrl.NewControllerManagedBy(mgr)
+	if r.ApprovedCheckExemptNamespaces != nil {
+		b = b.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.certificateRequestsForNamespace), builder.WithPredicates(predicate.LabelChangedPredicate{}))
+	}
+	return b
 }
@@ -17,8 +17,20 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
@@ -29,46 +41,82 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/utils/clock"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"math/big"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strings"
 	"testing"
+	"time"
 
 	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
 	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	signerfake "github.com/Keyfactor/command-issuer/internal/issuer/signer/fake"
 )
 
 var (
-	fixedClock = clock.RealClock{}
+	fixedClockStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fixedClock      = clocktesting.NewFakeClock(fixedClockStart)
 )
 
+// fakeCommandCertificateID is the Command ID of the certificate returned by fakeSigner
+const fakeCommandCertificateID = 1234
+
 type fakeSigner struct {
-	errSign error
+	errSign                      error
+	expectedRenewalCertificateID int32
+	errPoll                      error
+	expectedPollRequestID        int32
+	expectedIsCA                 bool
+	// blockSign makes Sign wait until its context is done
+	blockSign bool
+}
+
+func (o *fakeSigner) Sign(ctx context.Context, _ []byte, meta signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	if o.blockSign {
+		<-ctx.Done()
+		return nil, nil, 0, ctx.Err()
+	}
+	if meta.RenewalCertificateID != o.expectedRenewalCertificateID {
+		return nil, nil, 0, fmt.Errorf("unexpected renewal certificate ID %d", meta.RenewalCertificateID)
+	}
+	if meta.IsCA != o.expectedIsCA {
+		return nil, nil, 0, fmt.Errorf("unexpected isCA %t", meta.IsCA)
+	}
+	return []byte("fake signed certificate"), []byte("fake ca chain"), fakeCommandCertificateID, o.errSign
 }
 
-func (o *fakeSigner) Sign(context.Context, []byte, signer.K8sMetadata) ([]byte, []byte, error) {
-	return []byte("fake signed certificate"), []byte("fake ca chain"), o.errSign
+func (o *fakeSigner) PollEnrollment(_ context.Context, _ []byte, requestID int32, _ signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	if o.expectedPollRequestID == 0 || requestID != o.expectedPollRequestID {
+		return nil, nil, 0, fmt.Errorf("unexpected poll of enrollment request %d", requestID)
+	}
+	return []byte("fake signed certificate"), []byte("fake ca chain"), fakeCommandCertificateID, o.errPoll
 }
 
 func TestCertificateRequestReconcile(t *testing.T) {
-	//nowMetaTime := metav1.NewTime(fixedClockStart)
+	nowMetaTime := metav1.NewTime(fixedClockStart)
 
 	type testCase struct {
 		name                         types.NamespacedName
 		objects                      []client.Object
 		Builder                      signer.CommandSignerBuilder
 		clusterResourceNamespace     string
+		timeout                      time.Duration
 		expectedResult               ctrl.Result
 		expectedError                error
 		expectedReadyConditionStatus cmmeta.ConditionStatus
 		expectedReadyConditionReason string
 		expectedFailureTime          *metav1.Time
 		expectedCertificate          []byte
+		// expectedCertificateID is the Command certificate ID expected on the ns1/certificate1 Certificate
+		expectedCertificateID string
 	}
 	tests := map[string]testCase{
 		"success-issuer": {
@@ -115,7 +163,71 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 				},
 			},
-			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake signed certificate"),
+		},
+		"success-read-credentials": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:     "issuer1-credentials",
+						ReadSecretName: "issuer1-read-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{"username": []byte("enroller")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-read-credentials",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{"username": []byte("reader")},
+				},
+			},
+			Builder: func(_ context.Context, _ *commandissuer.IssuerSpec, _ map[string]string, authSecretData map[string][]byte, readSecretData map[string][]byte, _ map[string][]byte) (signer.Signer, error) {
+				if string(authSecretData["username"]) != "enroller" || string(readSecretData["username"]) != "reader" {
+					return nil, errors.New("expected the enrollment and read credentials to be passed to the signer")
+				}
 				return &fakeSigner{}, nil
 			},
 			expectedReadyConditionStatus: cmmeta.ConditionTrue,
@@ -123,6 +235,126 @@ func TestCertificateRequestReconcile(t *testing.T) {
 			expectedFailureTime:          nil,
 			expectedCertificate:          []byte("fake signed certificate"),
 		},
+		"success-previously-enrolled": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+					func(cr *cmapi.CertificateRequest) {
+						cr.UID = "cr1-uid"
+						cr.Annotations = map[string]string{
+							enrollmentKeyAnnotation:         enrollmentKey(cr),
+							enrolledCertificateAnnotation:   "previously enrolled certificate",
+							enrolledCertificateCAAnnotation: "previously enrolled ca chain",
+						}
+					},
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return nil, errors.New("the certificate must not be enrolled again")
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("previously enrolled certificate"),
+		},
+		"success-renewal": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+					cmgen.AddCertificateRequestAnnotations(map[string]string{
+						cmapi.CertificateNameKey: "certificate1",
+					}),
+				),
+				&cmapi.Certificate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "certificate1",
+						Namespace: "ns1",
+						Annotations: map[string]string{
+							certificateIDAnnotation: "42",
+						},
+					},
+				},
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:    "issuer1-credentials",
+						EnableRenewal: true,
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{expectedRenewalCertificateID: 42}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake signed certificate"),
+			expectedCertificateID:        "1234",
+		},
 		"success-cluster-issuer": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
@@ -166,7 +398,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 				},
 			},
-			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
 				return &fakeSigner{}, nil
 			},
 			clusterResourceNamespace:     "kube-system",
@@ -256,6 +488,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 			},
 			expectedReadyConditionStatus: cmmeta.ConditionFalse,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
 		},
 		"issuer-not-found": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
@@ -346,6 +579,47 @@ func TestCertificateRequestReconcile(t *testing.T) {
 			expectedReadyConditionStatus: cmmeta.ConditionFalse,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
 		},
+		"issuer-ready-condition-stale": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "issuer1",
+						Namespace:  "ns1",
+						Generation: 2,
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:               commandissuer.IssuerConditionReady,
+								Status:             commandissuer.ConditionTrue,
+								ObservedGeneration: 1,
+							},
+						},
+					},
+				},
+			},
+			expectedError:                errIssuerNotReady,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
 		"issuer-secret-not-found": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
@@ -432,13 +706,64 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 				},
 			},
-			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
 				return nil, errors.New("simulated signer builder error")
 			},
 			expectedError:                errSignerBuilder,
 			expectedReadyConditionStatus: cmmeta.ConditionFalse,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
 		},
+		"signer-builder-invalid-config": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return nil, fmt.Errorf("%w: simulated missing certificate template", signer.ErrInvalidConfig)
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: certificateRequestReasonInvalidIssuer,
+		},
 		"signer-error": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
@@ -483,14 +808,14 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 				},
 			},
-			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
 				return &fakeSigner{errSign: errors.New("simulated sign error")}, nil
 			},
 			expectedError:                errSignerSign,
 			expectedReadyConditionStatus: cmmeta.ConditionFalse,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
 		},
-		"request-not-approved": {
+		"signer-subject-pattern-mismatch": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
@@ -501,6 +826,10 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Group: commandissuer.GroupVersion.Group,
 						Kind:  "Issuer",
 					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionReady,
 						Status: cmmeta.ConditionUnknown,
@@ -530,19 +859,578 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 				},
 			},
-			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) (signer.Signer, error) {
-				return &fakeSigner{}, nil
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated mismatch", signer.ErrSubjectPatternMismatch)}, nil
 			},
-			expectedFailureTime: nil,
-			expectedCertificate: nil,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
 		},
-		//"request-denied": {
-		//    name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-		//    objects: []client.Object{
-		//        cmgen.CertificateRequest(
-		//            "cr1",
-		//            cmgen.SetCertificateRequestNamespace("ns1"),
-		//            cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+		"signer-csr-too-large": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated oversized CSR", signer.ErrCSRTooLarge)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-csr-malformed": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated undecodable CSR", signer.ErrCSRMalformed)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-schema-mismatch": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated missing certificate template", signer.ErrSchemaMismatch)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-certificate-authority-not-allowed": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated certificate authority override", signer.ErrCertificateAuthorityNotAllowed)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-ca-not-allowed": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIsCA(true),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{expectedIsCA: true, errSign: fmt.Errorf("%w: simulated CA request", signer.ErrCANotAllowed)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-enrollment-denied": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated denial", signer.ErrEnrollmentDenied)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonDenied,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-enrollment-rejected": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated rejection", signer.ErrEnrollmentRejected)}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+		},
+		"signer-authentication-failed": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: fmt.Errorf("%w: simulated 401", signer.ErrAuthenticationFailed)}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: certificateRequestReasonAuthenticationFailed,
+		},
+		"signer-timeout": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{blockSign: true}, nil
+			},
+			timeout:                      10 * time.Millisecond,
+			expectedResult:               ctrl.Result{Requeue: true},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: certificateRequestReasonTimeout,
+		},
+		"signer-circuit-open": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: &signer.CircuitOpenError{Host: "command.example.com", RetryAfter: time.Minute}}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: time.Minute},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: certificateRequestReasonCommandUnavailable,
+		},
+		"request-not-approved": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: commandissuer.GroupVersion.Group,
+						Kind:  "Issuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			Builder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedFailureTime: nil,
+			expectedCertificate: nil,
+		},
+		//"request-denied": {
+		//    name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+		//    objects: []client.Object{
+		//        cmgen.CertificateRequest(
+		//            "cr1",
+		//            cmgen.SetCertificateRequestNamespace("ns1"),
+		//            cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 		//                Name:  "issuer1",
 		//                Group: commandissuer.GroupVersion.Group,
 		//                Kind:  "Issuer",
@@ -595,70 +1483,1467 @@ func TestCertificateRequestReconcile(t *testing.T) {
 	require.NoError(t, cmapi.AddToScheme(scheme))
 	require.NoError(t, corev1.AddToScheme(scheme))
 
-	for name, tc := range tests {
-		t.Run(name, func(t *testing.T) {
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tc.objects...).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+			controller := CertificateRequestReconciler{
+				Client:                              fakeClient,
+				ConfigClient:                        NewFakeConfigClient(fakeClient),
+				Scheme:                              scheme,
+				ClusterResourceNamespace:            tc.clusterResourceNamespace,
+				SignerBuilder:                       tc.Builder,
+				CheckApprovedCondition:              true,
+				CheckClusterIssuerApprovedCondition: true,
+				Clock:                               fixedClock,
+				SecretAccessGrantedAtClusterLevel:   true,
+				Timeout:                             tc.timeout,
+			}
+			result, err := controller.Reconcile(
+				ctrl.LoggerInto(context.TODO(), logrtesting.New(t)),
+				reconcile.Request{NamespacedName: tc.name},
+			)
+			if tc.expectedError != nil {
+				assertErrorIs(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedResult, result, "Unexpected result")
+
+			var cr cmapi.CertificateRequest
+			err = fakeClient.Get(context.TODO(), tc.name, &cr)
+			require.NoError(t, client.IgnoreNotFound(err), "unexpected error from fake client")
+			if err == nil {
+				if tc.expectedReadyConditionStatus != "" {
+					assertCertificateRequestHasReadyCondition(t, tc.expectedReadyConditionStatus, tc.expectedReadyConditionReason, &cr)
+				}
+				assert.Equal(t, tc.expectedCertificate, cr.Status.Certificate)
+
+				if !apiequality.Semantic.DeepEqual(tc.expectedFailureTime, cr.Status.FailureTime) {
+					assert.Equal(t, tc.expectedFailureTime, cr.Status.FailureTime)
+				}
+			}
+
+			if tc.expectedCertificateID != "" {
+				var certificate cmapi.Certificate
+				require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: "ns1", Name: "certificate1"}, &certificate))
+				assert.Equal(t, tc.expectedCertificateID, certificate.Annotations[certificateIDAnnotation])
+			}
+		})
+	}
+}
+
+func TestCertificateRequestReconcileCredentialRotation(t *testing.T) {
+	certificateRequest := func(name string) *cmapi.CertificateRequest {
+		return cmgen.CertificateRequest(
+			name,
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "issuer1",
+				Group: commandissuer.GroupVersion.Group,
+				Kind:  "Issuer",
+			}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionApproved,
+				Status: cmmeta.ConditionTrue,
+			}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionUnknown,
+			}),
+		)
+	}
+	authSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "issuer1-credentials",
+			Namespace: "ns1",
+		},
+		Data: map[string][]byte{
+			"username": []byte("username"),
+			"password": []byte("original-password"),
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			certificateRequest("cr1"),
+			certificateRequest("cr2"),
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "issuer1",
+					Namespace: "ns1",
+				},
+				Spec: commandissuer.IssuerSpec{
+					SecretName: "issuer1-credentials",
+				},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{
+						{
+							Type:   commandissuer.IssuerConditionReady,
+							Status: commandissuer.ConditionTrue,
+						},
+					},
+				},
+			},
+			authSecret,
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	var passwords []string
+	controller := CertificateRequestReconciler{
+		Client:       fakeClient,
+		ConfigClient: NewFakeConfigClient(fakeClient),
+		Scheme:       scheme,
+		SignerBuilder: func(_ context.Context, _ *commandissuer.IssuerSpec, _ map[string]string, authSecretData map[string][]byte, _ map[string][]byte, _ map[string][]byte) (signer.Signer, error) {
+			passwords = append(passwords, string(authSecretData["password"]))
+			return &fakeSigner{}, nil
+		},
+		CheckApprovedCondition:              true,
+		CheckClusterIssuerApprovedCondition: true,
+		Clock:                               fixedClock,
+		SecretAccessGrantedAtClusterLevel:   true,
+	}
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+
+	_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "cr1"}})
+	require.NoError(t, err)
+
+	// Rotate the credentials without restarting the controller
+	authSecret.Data["password"] = []byte("rotated-password")
+	require.NoError(t, fakeClient.Update(context.TODO(), authSecret))
+
+	_, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "cr2"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"original-password", "rotated-password"}, passwords)
+}
+
+func TestCertificateRequestReconcileMaxEnrollmentAttempts(t *testing.T) {
+	errTemplate := errors.New("error enrolling certificate with Command")
+
+	tests := []struct {
+		name                  string
+		maxEnrollmentAttempts int
+		failedAttempts        string
+		errSign               error
+		expectedError         bool
+		expectedAttempts      string
+		expectedFailed        bool
+	}{
+		{
+			name:                  "FirstAttempt",
+			maxEnrollmentAttempts: 3,
+			errSign:               errTemplate,
+			expectedError:         true,
+			expectedAttempts:      "1",
+		},
+		{
+			name:                  "LastAttempt",
+			maxEnrollmentAttempts: 3,
+			failedAttempts:        "2",
+			errSign:               errTemplate,
+			expectedAttempts:      "3",
+			expectedFailed:        true,
+		},
+		{
+			name:                  "TransientFailureNotCounted",
+			maxEnrollmentAttempts: 3,
+			failedAttempts:        "2",
+			errSign:               fmt.Errorf("%w: connection refused", signer.ErrTransient),
+			expectedError:         true,
+			expectedAttempts:      "2",
+		},
+		{
+			name:           "Unlimited",
+			failedAttempts: "2",
+			errSign:        errTemplate,
+			expectedError:  true,
+			// The annotation isn't updated if the number of attempts isn't limited
+			expectedAttempts: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+							Type:   cmapi.CertificateRequestConditionReady,
+							Status: cmmeta.ConditionUnknown,
+						}),
+						func(cr *cmapi.CertificateRequest) {
+							cr.UID = "cr1-uid"
+							if tt.failedAttempts != "" {
+								cr.Annotations = map[string]string{
+									enrollmentKeyAnnotation:  enrollmentKey(cr),
+									failedAttemptsAnnotation: tt.failedAttempts,
+								}
+							}
+						},
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+			controller := CertificateRequestReconciler{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				Scheme:       scheme,
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &fakeSigner{errSign: tt.errSign}, nil
+				},
+				Clock:                             clocktesting.NewFakeClock(fixedClockStart),
+				SecretAccessGrantedAtClusterLevel: true,
+				MaxEnrollmentAttempts:             tt.maxEnrollmentAttempts,
+			}
+
+			name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err := controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+			if tt.expectedError {
+				assert.ErrorIs(t, err, errSignerSign)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+			assert.Equal(t, tt.expectedAttempts, cr.GetAnnotations()[failedAttemptsAnnotation])
+
+			ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+			require.NotNil(t, ready)
+			if tt.expectedFailed {
+				assert.Equal(t, cmapi.CertificateRequestReasonFailed, ready.Reason)
+				assert.NotNil(t, cr.Status.FailureTime)
+			} else {
+				assert.Equal(t, cmapi.CertificateRequestReasonPending, ready.Reason)
+				assert.Nil(t, cr.Status.FailureTime)
+			}
+		})
+	}
+}
+
+func TestCertificateRequestReconcilePendingEnrollment(t *testing.T) {
+	const requestID = 42
+
+	pendingSince := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	certificateRequest := func(name string, annotations map[string]string) *cmapi.CertificateRequest {
+		return cmgen.CertificateRequest(
+			name,
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "issuer1",
+				Group: commandissuer.GroupVersion.Group,
+				Kind:  "Issuer",
+			}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionApproved,
+				Status: cmmeta.ConditionTrue,
+			}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionUnknown,
+			}),
+			func(cr *cmapi.CertificateRequest) {
+				cr.UID = types.UID(name + "-uid")
+				if annotations != nil {
+					annotations[enrollmentKeyAnnotation] = enrollmentKey(cr)
+					cr.Annotations = annotations
+				}
+			},
+		)
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			certificateRequest("cr1", nil),
+			// cr2 has been awaiting approval for longer than the maximum pending duration
+			certificateRequest("cr2", map[string]string{
+				pendingRequestIDAnnotation: "43",
+				pendingSinceAnnotation:     pendingSince.Add(-25 * time.Hour).Format(time.RFC3339),
+			}),
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "issuer1",
+					Namespace: "ns1",
+				},
+				Spec: commandissuer.IssuerSpec{
+					SecretName: "issuer1-credentials",
+				},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{
+						{
+							Type:   commandissuer.IssuerConditionReady,
+							Status: commandissuer.ConditionTrue,
+						},
+					},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "issuer1-credentials",
+					Namespace: "ns1",
+				},
+			},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	fakeClock := clocktesting.NewFakeClock(pendingSince)
+	var commandSigner *fakeSigner
+	controller := CertificateRequestReconciler{
+		Client:       fakeClient,
+		ConfigClient: NewFakeConfigClient(fakeClient),
+		Scheme:       scheme,
+		SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			return commandSigner, nil
+		},
+		CheckApprovedCondition:              true,
+		CheckClusterIssuerApprovedCondition: true,
+		Clock:                               fakeClock,
+		SecretAccessGrantedAtClusterLevel:   true,
+		EnrollmentPollInterval:              30 * time.Second,
+		EnrollmentMaxPendingDuration:        24 * time.Hour,
+	}
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+	cr1 := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+
+	// The enrollment is awaiting approval in Command
+	commandSigner = &fakeSigner{errSign: &signer.EnrollmentPendingError{RequestID: requestID}}
+	result, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: cr1})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Second}, result)
+
+	var cr cmapi.CertificateRequest
+	require.NoError(t, fakeClient.Get(context.TODO(), cr1, &cr))
+	assertCertificateRequestHasReadyCondition(t, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, &cr)
+	assert.Nil(t, cr.Status.FailureTime)
+	assert.Equal(t, "42", cr.Annotations[pendingRequestIDAnnotation])
+	assert.Equal(t, "2024-01-01T00:00:00Z", cr.Annotations[pendingSinceAnnotation])
+
+	// The enrollment is polled instead of enrolling the CSR again, and is still pending
+	fakeClock.Step(time.Hour)
+	commandSigner = &fakeSigner{errSign: errors.New("the CSR must not be enrolled again"), expectedPollRequestID: requestID, errPoll: &signer.EnrollmentPendingError{RequestID: requestID}}
+	result, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: cr1})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Second}, result)
+
+	require.NoError(t, fakeClient.Get(context.TODO(), cr1, &cr))
+	assertCertificateRequestHasReadyCondition(t, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, &cr)
+	assert.Equal(t, "2024-01-01T00:00:00Z", cr.Annotations[pendingSinceAnnotation])
+
+	// The enrollment was approved in Command
+	commandSigner = &fakeSigner{errSign: errors.New("the CSR must not be enrolled again"), expectedPollRequestID: requestID}
+	result, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: cr1})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	require.NoError(t, fakeClient.Get(context.TODO(), cr1, &cr))
+	assertCertificateRequestHasReadyCondition(t, cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, &cr)
+	assert.Equal(t, []byte("fake signed certificate"), cr.Status.Certificate)
+	assert.NotContains(t, cr.Annotations, pendingRequestIDAnnotation)
+	assert.NotContains(t, cr.Annotations, pendingSinceAnnotation)
+
+	// The enrollment of cr2 wasn't approved within the maximum pending duration
+	cr2 := types.NamespacedName{Namespace: "ns1", Name: "cr2"}
+	commandSigner = &fakeSigner{expectedPollRequestID: 43, errPoll: &signer.EnrollmentPendingError{RequestID: 43}}
+	result, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: cr2})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	require.NoError(t, fakeClient.Get(context.TODO(), cr2, &cr))
+	assertCertificateRequestHasReadyCondition(t, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, &cr)
+	assert.NotNil(t, cr.Status.FailureTime)
+}
+
+func assertErrorIs(t *testing.T, expectedError, actualError error) {
+	if !assert.Error(t, actualError) {
+		return
+	}
+	assert.Truef(t, errors.Is(actualError, expectedError), "unexpected error type. expected: %v, got: %v", expectedError, actualError)
+}
+
+func assertCertificateRequestHasReadyCondition(t *testing.T, status cmmeta.ConditionStatus, reason string, cr *cmapi.CertificateRequest) {
+	condition := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+	if !assert.NotNil(t, condition, "Ready condition not found") {
+		return
+	}
+	assert.Equal(t, status, condition.Status, "unexpected condition status")
+	validReasons := sets.NewString(
+		cmapi.CertificateRequestReasonPending,
+		cmapi.CertificateRequestReasonFailed,
+		cmapi.CertificateRequestReasonIssued,
+		cmapi.CertificateRequestReasonDenied,
+		certificateRequestReasonAuthenticationFailed,
+		certificateRequestReasonTimeout,
+		certificateRequestReasonCommandUnavailable,
+		certificateRequestReasonInvalidIssuer,
+	)
+	assert.Contains(t, validReasons, reason, "unexpected condition reason")
+	assert.Equal(t, reason, condition.Reason, "unexpected condition reason")
+}
+
+// issuedSigner is a signer that issues a certificate with the given DNS names, regardless of the CSR
+type issuedSigner struct {
+	leaf []byte
+}
+
+func (o *issuedSigner) Sign(context.Context, []byte, signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	return o.leaf, nil, fakeCommandCertificateID, nil
+}
+
+func (o *issuedSigner) PollEnrollment(_ context.Context, _ []byte, requestID int32, _ signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	return nil, nil, 0, fmt.Errorf("unexpected poll of enrollment request %d", requestID)
+}
+
+func TestCertificateRequestReconcileSANMismatch(t *testing.T) {
+	tests := []struct {
+		name                         string
+		policy                       commandissuer.SANMismatchPolicy
+		issuedDNSNames               []string
+		expectedReadyConditionReason string
+		expectedMismatchCondition    bool
+		expectedEvent                bool
+	}{
+		{
+			name:                         "Match",
+			issuedDNSNames:               []string{"app.example.com", "www.example.com"},
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name:                         "Warn",
+			issuedDNSNames:               []string{"app.example.com"},
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedMismatchCondition:    true,
+			expectedEvent:                true,
+		},
+		{
+			name:                         "Fail",
+			policy:                       commandissuer.SANMismatchPolicyFail,
+			issuedDNSNames:               []string{"app.example.com"},
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+		},
+		{
+			name:                         "Ignore",
+			policy:                       commandissuer.SANMismatchPolicyIgnore,
+			issuedDNSNames:               []string{"app.example.com"},
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr, leaf := generateCSRAndCertificate(t, []string{"app.example.com", "www.example.com"}, tt.issuedDNSNames)
+
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestCSR(csr),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+							Type:   cmapi.CertificateRequestConditionReady,
+							Status: cmmeta.ConditionUnknown,
+						}),
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec: commandissuer.IssuerSpec{
+							SecretName:        "issuer1-credentials",
+							SANMismatchPolicy: tt.policy,
+						},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controller := CertificateRequestReconciler{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				Scheme:       scheme,
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &issuedSigner{leaf: leaf}, nil
+				},
+				Clock:                             fixedClock,
+				SecretAccessGrantedAtClusterLevel: true,
+				Recorder:                          recorder,
+			}
+
+			name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err := controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+			require.NoError(t, err)
+
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+			ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+			require.NotNil(t, ready)
+			assert.Equal(t, tt.expectedReadyConditionReason, ready.Reason)
+
+			mismatch := cmutil.GetCertificateRequestCondition(&cr, certificateRequestConditionSANMismatch)
+			if tt.expectedMismatchCondition {
+				if assert.NotNil(t, mismatch) {
+					assert.Contains(t, mismatch.Message, `DNS SANs ["www.example.com"] are missing`)
+				}
+			} else {
+				assert.Nil(t, mismatch)
+			}
+
+			if tt.expectedEvent {
+				assert.Len(t, recorder.Events, 1)
+			} else {
+				assert.Empty(t, recorder.Events)
+			}
+		})
+	}
+}
+
+func TestCertificateRequestReconcileClockSkew(t *testing.T) {
+	tests := []struct {
+		name          string
+		now           time.Time
+		tolerance     time.Duration
+		expectedEvent bool
+	}{
+		{
+			name: "Valid",
+			now:  fixedClockStart,
+		},
+		{
+			name:          "NotYetValid",
+			now:           fixedClockStart.Add(-time.Minute),
+			expectedEvent: true,
+		},
+		{
+			name:      "NotYetValidWithinTolerance",
+			now:       fixedClockStart.Add(-time.Minute),
+			tolerance: 2 * time.Minute,
+		},
+		{
+			name:          "Expired",
+			now:           fixedClockStart.Add(2 * time.Hour),
+			tolerance:     time.Minute,
+			expectedEvent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr, leaf := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestCSR(csr),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+							Type:   cmapi.CertificateRequestConditionReady,
+							Status: cmmeta.ConditionUnknown,
+						}),
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controller := CertificateRequestReconciler{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				Scheme:       scheme,
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &issuedSigner{leaf: leaf}, nil
+				},
+				Clock:                             clocktesting.NewFakeClock(tt.now),
+				SecretAccessGrantedAtClusterLevel: true,
+				Recorder:                          recorder,
+				ClockSkewTolerance:                tt.tolerance,
+			}
+
+			name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err := controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+			require.NoError(t, err)
+
+			// The certificate is issued regardless of the clock skew
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+			ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+			require.NotNil(t, ready)
+			assert.Equal(t, cmapi.CertificateRequestReasonIssued, ready.Reason)
+
+			if tt.expectedEvent {
+				if assert.Len(t, recorder.Events, 1) {
+					assert.Contains(t, <-recorder.Events, reasonClockSkew)
+				}
+			} else {
+				assert.Empty(t, recorder.Events)
+			}
+		})
+	}
+}
+
+func TestCertificateRequestReconcileRequiredCertificatePolicy(t *testing.T) {
+	tests := []struct {
+		name                         string
+		policy                       *commandissuer.RequiredCertificatePolicy
+		issuedPolicies               []asn1.ObjectIdentifier
+		expectedReadyConditionReason string
+		expectedEvent                bool
+	}{
+		{
+			name:                         "NoPolicy",
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name:                         "Asserted",
+			policy:                       &commandissuer.RequiredCertificatePolicy{OID: "2.23.140.1.2.2"},
+			issuedPolicies:               []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}, {2, 23, 140, 1, 2, 2}},
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name:                         "Missing",
+			policy:                       &commandissuer.RequiredCertificatePolicy{OID: "2.23.140.1.2.2"},
+			issuedPolicies:               []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}},
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedEvent:                true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: "app.example.com"},
+				DNSNames: []string{"app.example.com"},
+			}, key)
+			require.NoError(t, err)
+			certificateDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber:      big.NewInt(1),
+				Subject:           pkix.Name{CommonName: "app.example.com"},
+				DNSNames:          []string{"app.example.com"},
+				NotBefore:         fixedClockStart,
+				NotAfter:          fixedClockStart.Add(time.Hour),
+				PolicyIdentifiers: tt.issuedPolicies,
+			}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"}}, &key.PublicKey, key)
+			require.NoError(t, err)
+			leaf := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER})
+
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+							Type:   cmapi.CertificateRequestConditionReady,
+							Status: cmmeta.ConditionUnknown,
+						}),
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec: commandissuer.IssuerSpec{
+							SecretName:                "issuer1-credentials",
+							RequiredCertificatePolicy: tt.policy,
+						},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controller := CertificateRequestReconciler{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				Scheme:       scheme,
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &issuedSigner{leaf: leaf}, nil
+				},
+				Clock:                             fixedClock,
+				SecretAccessGrantedAtClusterLevel: true,
+				Recorder:                          recorder,
+			}
+
+			name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err = controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+			require.NoError(t, err)
+
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+			ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+			require.NotNil(t, ready)
+			assert.Equal(t, tt.expectedReadyConditionReason, ready.Reason)
+
+			if tt.expectedEvent {
+				assert.Contains(t, ready.Message, "does not contain the required certificate policy 2.23.140.1.2.2")
+				assert.Empty(t, cr.Status.Certificate)
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, reasonCertificatePolicyMissing)
+			} else {
+				assert.Equal(t, leaf, cr.Status.Certificate)
+				assert.Empty(t, recorder.Events)
+			}
+		})
+	}
+}
+
+func TestCertificateRequestReconcileRecordCertificateFingerprints(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{
+			name:    "Enabled",
+			enabled: true,
+		},
+		{
+			name: "Disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr, leaf := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestCSR(csr),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+							Type:   cmapi.CertificateRequestConditionReady,
+							Status: cmmeta.ConditionUnknown,
+						}),
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+			controller := CertificateRequestReconciler{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				Scheme:       scheme,
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &issuedSigner{leaf: leaf}, nil
+				},
+				Clock:                             clocktesting.NewFakeClock(fixedClockStart),
+				SecretAccessGrantedAtClusterLevel: true,
+				RecordCertificateFingerprints:     tt.enabled,
+			}
+
+			name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err := controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+			require.NoError(t, err)
+
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+			serial, serialOK := cr.GetAnnotations()[enrolledCertificateSerialAnnotation]
+			fingerprint, fingerprintOK := cr.GetAnnotations()[enrolledCertificateFingerprintAnnotation]
+			if !tt.enabled {
+				assert.False(t, serialOK)
+				assert.False(t, fingerprintOK)
+				return
+			}
+
+			block, _ := pem.Decode(leaf)
+			require.NotNil(t, block)
+			sum := sha256.Sum256(block.Bytes)
+			assert.Equal(t, "1", serial)
+			assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), fingerprint)
+		})
+	}
+}
+
+func TestCertificateRequestReconcileFakeSigner(t *testing.T) {
+	csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			cmgen.CertificateRequest(
+				"cr1",
+				cmgen.SetCertificateRequestNamespace("ns1"),
+				cmgen.SetCertificateRequestCSR(csr),
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+					Name:  "issuer1",
+					Group: commandissuer.GroupVersion.Group,
+					Kind:  "Issuer",
+				}),
+				cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+					Type:   cmapi.CertificateRequestConditionReady,
+					Status: cmmeta.ConditionUnknown,
+				}),
+			),
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+				Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{
+						{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+					},
+				},
+			},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	fakeSigner, err := signerfake.NewSigner()
+	require.NoError(t, err)
+	controller := CertificateRequestReconciler{
+		Client:                            fakeClient,
+		ConfigClient:                      NewFakeConfigClient(fakeClient),
+		Scheme:                            scheme,
+		SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
+		Clock:                             clocktesting.NewFakeClock(time.Now()),
+		SecretAccessGrantedAtClusterLevel: true,
+	}
+
+	name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+	_, err = controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+	require.NoError(t, err)
+
+	var cr cmapi.CertificateRequest
+	require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+	ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+	require.NotNil(t, ready)
+	assert.Equal(t, cmapi.CertificateRequestReasonIssued, ready.Reason)
+	assert.Equal(t, fakeSigner.CA(), cr.Status.CA)
+
+	if assert.Len(t, fakeSigner.Requests(), 1) {
+		assert.Equal(t, "issuer1", fakeSigner.Requests()[0].IssuerName)
+	}
+}
+
+func TestCertificateRequestReconcileSkipEnrollment(t *testing.T) {
+	tests := []struct {
+		name                     string
+		skipEnrollmentAnnotation string
+		annotations              map[string]string
+		expectedSkip             bool
+	}{
+		{
+			name:                     "Annotated",
+			skipEnrollmentAnnotation: DefaultSkipEnrollmentAnnotation,
+			annotations:              map[string]string{DefaultSkipEnrollmentAnnotation: "true"},
+			expectedSkip:             true,
+		},
+		{
+			name:                     "AnnotatedFalse",
+			skipEnrollmentAnnotation: DefaultSkipEnrollmentAnnotation,
+			annotations:              map[string]string{DefaultSkipEnrollmentAnnotation: "false"},
+		},
+		{
+			name:                     "AnnotatedInvalid",
+			skipEnrollmentAnnotation: DefaultSkipEnrollmentAnnotation,
+			annotations:              map[string]string{DefaultSkipEnrollmentAnnotation: "yes please"},
+		},
+		{
+			name:                     "NotAnnotated",
+			skipEnrollmentAnnotation: DefaultSkipEnrollmentAnnotation,
+		},
+		{
+			name:                     "CustomAnnotation",
+			skipEnrollmentAnnotation: "example.com/manual",
+			annotations:              map[string]string{"example.com/manual": "true"},
+			expectedSkip:             true,
+		},
+		{
+			name:        "Disabled",
+			annotations: map[string]string{DefaultSkipEnrollmentAnnotation: "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			initialCondition := cmapi.CertificateRequestCondition{
+				Type:    cmapi.CertificateRequestConditionReady,
+				Status:  cmmeta.ConditionFalse,
+				Reason:  cmapi.CertificateRequestReasonPending,
+				Message: "Provisioned manually",
+			}
 			fakeClient := fake.NewClientBuilder().
 				WithScheme(scheme).
-				WithObjects(tc.objects...).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestCSR(csr),
+						cmgen.SetCertificateRequestAnnotations(tt.annotations),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(initialCondition),
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
 				Build()
+
+			fakeSigner, err := signerfake.NewSigner()
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(10)
 			controller := CertificateRequestReconciler{
 				Client:                            fakeClient,
 				ConfigClient:                      NewFakeConfigClient(fakeClient),
 				Scheme:                            scheme,
-				ClusterResourceNamespace:          tc.clusterResourceNamespace,
-				SignerBuilder:                     tc.Builder,
-				CheckApprovedCondition:            true,
+				SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
 				Clock:                             fixedClock,
 				SecretAccessGrantedAtClusterLevel: true,
-			}
-			result, err := controller.Reconcile(
-				ctrl.LoggerInto(context.TODO(), logrtesting.New(t)),
-				reconcile.Request{NamespacedName: tc.name},
-			)
-			if tc.expectedError != nil {
-				assertErrorIs(t, tc.expectedError, err)
-			} else {
-				assert.NoError(t, err)
+				Recorder:                          recorder,
+				SkipEnrollmentAnnotation:          tt.skipEnrollmentAnnotation,
 			}
 
-			assert.Equal(t, tc.expectedResult, result, "Unexpected result")
+			name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			result, err := controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: name})
+			require.NoError(t, err)
 
 			var cr cmapi.CertificateRequest
-			err = fakeClient.Get(context.TODO(), tc.name, &cr)
-			require.NoError(t, client.IgnoreNotFound(err), "unexpected error from fake client")
-			if err == nil {
-				if tc.expectedReadyConditionStatus != "" {
-					assertCertificateRequestHasReadyCondition(t, tc.expectedReadyConditionStatus, tc.expectedReadyConditionReason, &cr)
-				}
-				assert.Equal(t, tc.expectedCertificate, cr.Status.Certificate)
+			require.NoError(t, fakeClient.Get(context.TODO(), name, &cr))
+			ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+			require.NotNil(t, ready)
 
-				if !apiequality.Semantic.DeepEqual(tc.expectedFailureTime, cr.Status.FailureTime) {
-					assert.Equal(t, tc.expectedFailureTime, cr.Status.FailureTime)
+			if tt.expectedSkip {
+				assert.Equal(t, ctrl.Result{}, result)
+				assert.Equal(t, initialCondition, *ready)
+				assert.Empty(t, cr.Status.Certificate)
+				assert.Empty(t, fakeSigner.Requests())
+				if assert.Len(t, recorder.Events, 1) {
+					event := <-recorder.Events
+					assert.Contains(t, event, "Normal "+reasonEnrollmentSkipped)
+					assert.Contains(t, event, tt.skipEnrollmentAnnotation)
 				}
+			} else {
+				assert.Equal(t, cmapi.CertificateRequestReasonIssued, ready.Reason)
+				assert.Len(t, fakeSigner.Requests(), 1)
 			}
 		})
 	}
 }
 
-func assertErrorIs(t *testing.T, expectedError, actualError error) {
-	if !assert.Error(t, actualError) {
-		return
+func TestCertificateRequestReconcileEnrollmentCoalescing(t *testing.T) {
+	csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+	otherCSR, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	certificateRequest := func(name string, csr []byte) *cmapi.CertificateRequest {
+		return cmgen.CertificateRequest(
+			name,
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.SetCertificateRequestCSR(csr),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "issuer1",
+				Group: commandissuer.GroupVersion.Group,
+				Kind:  "Issuer",
+			}),
+			cmgen.AddCertificateRequestAnnotations(map[string]string{cmapi.CertificateNameKey: "cert1"}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionUnknown,
+			}),
+		)
 	}
-	assert.Truef(t, errors.Is(actualError, expectedError), "unexpected error type. expected: %v, got: %v", expectedError, actualError)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			certificateRequest("cr1", csr),
+			certificateRequest("cr2", csr),
+			certificateRequest("cr3", otherCSR),
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+				Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{
+						{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+					},
+				},
+			},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	fakeSigner, err := signerfake.NewSigner()
+	require.NoError(t, err)
+	clock := clocktesting.NewFakeClock(time.Now())
+	var auditLog bytes.Buffer
+	controller := CertificateRequestReconciler{
+		Client:                            fakeClient,
+		ConfigClient:                      NewFakeConfigClient(fakeClient),
+		Scheme:                            scheme,
+		SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
+		Clock:                             clock,
+		SecretAccessGrantedAtClusterLevel: true,
+		EnrollmentCoalescer:               NewEnrollmentCoalescer(5*time.Second, clock),
+		AuditLogger:                       &AuditLogger{Writer: &auditLog, Clock: clock},
+	}
+
+	certificates := make(map[string][]byte)
+	for _, name := range []string{"cr1", "cr2", "cr3"} {
+		namespacedName := types.NamespacedName{Namespace: "ns1", Name: name}
+		_, err = controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+
+		var cr cmapi.CertificateRequest
+		require.NoError(t, fakeClient.Get(context.TODO(), namespacedName, &cr))
+		ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+		require.NotNil(t, ready)
+		assert.Equal(t, cmapi.CertificateRequestReasonIssued, ready.Reason)
+		certificates[name] = cr.Status.Certificate
+	}
+
+	// cr2 has the same CSR as cr1 and reuses its certificate, cr3 has another key and is enrolled
+	assert.Len(t, fakeSigner.Requests(), 2)
+	assert.Equal(t, certificates["cr1"], certificates["cr2"])
+	assert.NotEqual(t, certificates["cr1"], certificates["cr3"])
+
+	// Every CertificateRequest is audited, including the one that reused a certificate
+	var outcomes []AuditOutcome
+	decoder := json.NewDecoder(&auditLog)
+	for decoder.More() {
+		var record AuditRecord
+		require.NoError(t, decoder.Decode(&record))
+		assert.Equal(t, "CertificateRequest", record.Kind)
+		assert.Equal(t, "issuer1", record.IssuerName)
+		outcomes = append(outcomes, record.Outcome)
+	}
+	assert.Equal(t, []AuditOutcome{AuditOutcomeIssued, AuditOutcomeReused, AuditOutcomeIssued}, outcomes)
 }
 
-func assertCertificateRequestHasReadyCondition(t *testing.T, status cmmeta.ConditionStatus, reason string, cr *cmapi.CertificateRequest) {
-	condition := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
-	if !assert.NotNil(t, condition, "Ready condition not found") {
-		return
+func TestCertificateRequestReconcileEnrollmentLimits(t *testing.T) {
+	csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	certificateRequest := func(name string) *cmapi.CertificateRequest {
+		return cmgen.CertificateRequest(
+			name,
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.SetCertificateRequestCSR(csr),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "issuer1",
+				Group: commandissuer.GroupVersion.Group,
+				Kind:  "Issuer",
+			}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionUnknown,
+			}),
+		)
 	}
-	assert.Equal(t, status, condition.Status, "unexpected condition status")
-	validReasons := sets.NewString(
-		cmapi.CertificateRequestReasonPending,
-		cmapi.CertificateRequestReasonFailed,
-		cmapi.CertificateRequestReasonIssued,
-		cmapi.CertificateRequestReasonDenied,
-	)
-	assert.Contains(t, validReasons, reason, "unexpected condition reason")
-	assert.Equal(t, reason, condition.Reason, "unexpected condition reason")
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			certificateRequest("cr1"),
+			certificateRequest("cr2"),
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+				Spec: commandissuer.IssuerSpec{
+					SecretName:       "issuer1-credentials",
+					EnrollmentLimits: &commandissuer.EnrollmentLimits{RequestsPerMinute: 1},
+				},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{
+						{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+					},
+				},
+			},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	fakeSigner, err := signerfake.NewSigner()
+	require.NoError(t, err)
+	clock := clocktesting.NewFakeClock(time.Now())
+	controller := CertificateRequestReconciler{
+		Client:                            fakeClient,
+		ConfigClient:                      NewFakeConfigClient(fakeClient),
+		Scheme:                            scheme,
+		SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
+		Clock:                             clock,
+		SecretAccessGrantedAtClusterLevel: true,
+		IssuerLimiter:                     NewIssuerLimiter(clock),
+	}
+
+	reconcileRequest := func(name string) (ctrl.Result, *cmapi.CertificateRequestCondition) {
+		namespacedName := types.NamespacedName{Namespace: "ns1", Name: name}
+		result, err := controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+
+		var cr cmapi.CertificateRequest
+		require.NoError(t, fakeClient.Get(context.TODO(), namespacedName, &cr))
+		ready := cmutil.GetCertificateRequestCondition(&cr, cmapi.CertificateRequestConditionReady)
+		require.NotNil(t, ready)
+		return result, ready
+	}
+
+	_, ready := reconcileRequest("cr1")
+	assert.Equal(t, cmapi.CertificateRequestReasonIssued, ready.Reason)
+
+	// The issuer may enroll once per minute, so cr2 is queued without calling Command
+	result, ready := reconcileRequest("cr2")
+	assert.Equal(t, certificateRequestReasonEnrollmentLimited, ready.Reason)
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+	assert.Len(t, fakeSigner.Requests(), 1)
+
+	clock.Step(time.Minute)
+	_, ready = reconcileRequest("cr2")
+	assert.Equal(t, cmapi.CertificateRequestReasonIssued, ready.Reason)
+	assert.Len(t, fakeSigner.Requests(), 2)
+}
+
+// generateCSRAndCertificate returns a PEM encoded CSR requesting csrDNSNames and a PEM encoded
+// self-signed certificate issued for certificateDNSNames
+func generateCSRAndCertificate(t *testing.T, csrDNSNames, certificateDNSNames []string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: csrDNSNames[0]},
+		DNSNames: csrDNSNames,
+	}, key)
+	require.NoError(t, err)
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: csrDNSNames[0]},
+		DNSNames:     certificateDNSNames,
+		NotBefore:    fixedClockStart,
+		NotAfter:     fixedClockStart.Add(time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"}}, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER})
+}
+
+func TestCertificateRequestReconcileApprovedCheckPerIssuerKind(t *testing.T) {
+	tests := []struct {
+		name                     string
+		kind                     string
+		checkIssuer              bool
+		checkClusterIssuer       bool
+		exemptNamespaces         string
+		namespaceLabels          map[string]string
+		expectedSignedUnapproved bool
+	}{
+		{
+			name:               "IssuerRequiresApproval",
+			kind:               "Issuer",
+			checkIssuer:        true,
+			checkClusterIssuer: false,
+		},
+		{
+			name:                     "ClusterIssuerTrusted",
+			kind:                     "ClusterIssuer",
+			checkIssuer:              true,
+			checkClusterIssuer:       false,
+			expectedSignedUnapproved: true,
+		},
+		{
+			name:                     "IssuerTrusted",
+			kind:                     "Issuer",
+			checkIssuer:              false,
+			checkClusterIssuer:       true,
+			expectedSignedUnapproved: true,
+		},
+		{
+			name:               "ClusterIssuerRequiresApproval",
+			kind:               "ClusterIssuer",
+			checkIssuer:        false,
+			checkClusterIssuer: true,
+		},
+		{
+			name:                     "IssuerInExemptNamespace",
+			kind:                     "Issuer",
+			checkIssuer:              true,
+			checkClusterIssuer:       true,
+			exemptNamespaces:         "command-issuer.keyfactor.com/auto-approve=true",
+			namespaceLabels:          map[string]string{"command-issuer.keyfactor.com/auto-approve": "true"},
+			expectedSignedUnapproved: true,
+		},
+		{
+			name:                     "ClusterIssuerInExemptNamespace",
+			kind:                     "ClusterIssuer",
+			checkIssuer:              true,
+			checkClusterIssuer:       true,
+			exemptNamespaces:         "command-issuer.keyfactor.com/auto-approve=true",
+			namespaceLabels:          map[string]string{"command-issuer.keyfactor.com/auto-approve": "true"},
+			expectedSignedUnapproved: true,
+		},
+		{
+			name:               "IssuerInNamespaceNotExempt",
+			kind:               "Issuer",
+			checkIssuer:        true,
+			checkClusterIssuer: true,
+			exemptNamespaces:   "command-issuer.keyfactor.com/auto-approve=true",
+			namespaceLabels:    map[string]string{"command-issuer.keyfactor.com/auto-approve": "false"},
+		},
+	}
+
+	readyStatus := commandissuer.IssuerStatus{
+		Conditions: []commandissuer.IssuerCondition{
+			{
+				Type:   commandissuer.IssuerConditionReady,
+				Status: commandissuer.ConditionTrue,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			// The request isn't approved yet, but already has a Ready condition
+			certificateRequest := cmgen.CertificateRequest(
+				"cr1",
+				cmgen.SetCertificateRequestNamespace("ns1"),
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+					Name:  "issuer1",
+					Group: commandissuer.GroupVersion.Group,
+					Kind:  tt.kind,
+				}),
+				cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+					Type:   cmapi.CertificateRequestConditionReady,
+					Status: cmmeta.ConditionUnknown,
+				}),
+			)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					certificateRequest,
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status:     readyStatus,
+					},
+					&commandissuer.ClusterIssuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status:     readyStatus,
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"},
+					},
+					&corev1.Namespace{
+						ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: tt.namespaceLabels},
+					},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			var exemptNamespaces labels.Selector
+			if tt.exemptNamespaces != "" {
+				var err error
+				exemptNamespaces, err = labels.Parse(tt.exemptNamespaces)
+				require.NoError(t, err)
+			}
+
+			controller := CertificateRequestReconciler{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				Scheme:       scheme,
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &fakeSigner{}, nil
+				},
+				ClusterResourceNamespace:            "ns1",
+				CheckApprovedCondition:              tt.checkIssuer,
+				CheckClusterIssuerApprovedCondition: tt.checkClusterIssuer,
+				ApprovedCheckExemptNamespaces:       exemptNamespaces,
+				Clock:                               fixedClock,
+				SecretAccessGrantedAtClusterLevel:   true,
+			}
+
+			_, err := controller.Reconcile(
+				ctrl.LoggerInto(context.TODO(), logrtesting.New(t)),
+				reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "cr1"}},
+			)
+			require.NoError(t, err)
+
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: "ns1", Name: "cr1"}, &cr))
+			signed := cmutil.CertificateRequestHasCondition(&cr, cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionTrue,
+			})
+			assert.Equal(t, tt.expectedSignedUnapproved, signed)
+		})
+	}
+}
+
+func TestCertificateRequestsForNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			cmgen.CertificateRequest("cr1", cmgen.SetCertificateRequestNamespace("ns1")),
+			cmgen.CertificateRequest("cr2", cmgen.SetCertificateRequestNamespace("ns1")),
+			cmgen.CertificateRequest("cr3", cmgen.SetCertificateRequestNamespace("ns2")),
+		).
+		Build()
+
+	exemptNamespaces, err := labels.Parse("command-issuer.keyfactor.com/auto-approve=true")
+	require.NoError(t, err)
+	controller := CertificateRequestReconciler{Client: fakeClient, ApprovedCheckExemptNamespaces: exemptNamespaces}
+
+	// The requests of a namespace that became exempt are reconciled
+	exempt := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: map[string]string{"command-issuer.keyfactor.com/auto-approve": "true"}}}
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "cr1"}},
+		{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "cr2"}},
+	}, controller.certificateRequestsForNamespace(context.TODO(), exempt))
+
+	// Requests of other namespaces still wait to be approved
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns2"}}
+	assert.Empty(t, controller.certificateRequestsForNamespace(context.TODO(), other))
 }
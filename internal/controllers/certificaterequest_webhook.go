@@ -0,0 +1,138 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// defaultAnnotationsKey is the key of the ConfigMap of defaults that holds a YAML map of the
+	// annotations added to CertificateRequests
+	defaultAnnotationsKey = "annotations"
+	// defaultLabelsKey is the key of the ConfigMap of defaults that holds a YAML map of the labels
+	// added to CertificateRequests
+	defaultLabelsKey = "labels"
+)
+
+//+kubebuilder:webhook:path=/mutate-cert-manager-io-v1-certificaterequest,mutating=true,failurePolicy=ignore,sideEffects=None,groups=cert-manager.io,resources=certificaterequests,verbs=create,versions=v1,name=mcertificaterequest.command-issuer.keyfactor.com,admissionReviewVersions=v1
+
+// CertificateRequestDefaulter adds default annotations and labels to new CertificateRequests that
+// reference an Issuer or ClusterIssuer of this group, e.g. to record the same Command metadata for
+// every certificate without editing each Certificate. Annotations and labels that the
+// CertificateRequest already sets are kept.
+type CertificateRequestDefaulter struct {
+	// Reader reads the ConfigMap of defaults. The API reader of the manager avoids caching every
+	// ConfigMap of the cluster.
+	Reader client.Reader
+	// ConfigMap is the name of the ConfigMap of defaults. Its annotations and labels keys hold YAML
+	// maps of the default annotations and labels, since ConfigMap keys can't contain slashes.
+	ConfigMap types.NamespacedName
+}
+
+var _ webhook.CustomDefaulter = &CertificateRequestDefaulter{}
+
+// SetupWebhookWithManager registers the mutating webhook for CertificateRequests with the manager.
+func (d *CertificateRequestDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&cmapi.CertificateRequest{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+// Default implements webhook.CustomDefaulter. The CertificateRequest is admitted unchanged if the
+// defaults can't be read, so that an invalid ConfigMap doesn't prevent certificates from being issued.
+func (d *CertificateRequestDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	certificateRequest, ok := obj.(*cmapi.CertificateRequest)
+	if !ok {
+		return fmt.Errorf("expected a CertificateRequest, got %T", obj)
+	}
+	if certificateRequest.Spec.IssuerRef.Group != commandissuer.GroupVersion.Group {
+		return nil
+	}
+
+	annotations, labels, err := d.defaults(ctx)
+	if err != nil {
+		log.Error(err, "Failed to read the default annotations and labels of CertificateRequests. Not adding defaults.", "configMap", d.ConfigMap)
+		return nil
+	}
+
+	certificateRequest.SetAnnotations(withDefaults(certificateRequest.GetAnnotations(), annotations))
+	certificateRequest.SetLabels(withDefaults(certificateRequest.GetLabels(), labels))
+	return nil
+}
+
+// defaults reads the default annotations and labels from the ConfigMap. A missing ConfigMap has no
+// defaults.
+func (d *CertificateRequestDefaulter) defaults(ctx context.Context) (map[string]string, map[string]string, error) {
+	var configMap corev1.ConfigMap
+	if err := d.Reader.Get(ctx, d.ConfigMap, &configMap); err != nil {
+		return nil, nil, client.IgnoreNotFound(err)
+	}
+
+	var annotations, labels map[string]string
+	if err := yaml.Unmarshal([]byte(configMap.Data[defaultAnnotationsKey]), &annotations); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", defaultAnnotationsKey, err)
+	}
+	for key := range annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("invalid %s: %q is not a valid annotation key: %v", defaultAnnotationsKey, key, errs)
+		}
+	}
+
+	if err := yaml.Unmarshal([]byte(configMap.Data[defaultLabelsKey]), &labels); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", defaultLabelsKey, err)
+	}
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("invalid %s: %q is not a valid label key: %v", defaultLabelsKey, key, errs)
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("invalid %s: %q is not a valid value of label %q: %v", defaultLabelsKey, value, key, errs)
+		}
+	}
+
+	return annotations, labels, nil
+}
+
+// withDefaults returns values with the entries of defaults whose keys it doesn't contain
+func withDefaults(values, defaults map[string]string) map[string]string {
+	for key, value := range defaults {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]string)
+		}
+		values[key] = value
+	}
+	return values
+}
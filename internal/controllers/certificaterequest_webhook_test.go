@@ -0,0 +1,134 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCertificateRequestDefaulter(t *testing.T) {
+	configMapName := types.NamespacedName{Namespace: "command-issuer-system", Name: "certificate-request-defaults"}
+	defaults := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configMapName.Name, Namespace: configMapName.Namespace},
+		Data: map[string]string{
+			"annotations": "metadata.command-issuer.keyfactor.com/ResponsibleTeam: pki@example.com\ncommand-issuer.keyfactor.com/certificateTemplate: WebServer\n",
+			"labels":      "example.com/managed-by: command-issuer\n",
+		},
+	}
+
+	tests := []struct {
+		name                string
+		objects             []client.Object
+		issuerGroup         string
+		annotations         map[string]string
+		expectedAnnotations map[string]string
+		expectedLabels      map[string]string
+	}{
+		{
+			name:        "AddsDefaults",
+			objects:     []client.Object{defaults},
+			issuerGroup: commandissuer.GroupVersion.Group,
+			expectedAnnotations: map[string]string{
+				"metadata.command-issuer.keyfactor.com/ResponsibleTeam": "pki@example.com",
+				"command-issuer.keyfactor.com/certificateTemplate":      "WebServer",
+			},
+			expectedLabels: map[string]string{"example.com/managed-by": "command-issuer"},
+		},
+		{
+			name:        "KeepsExistingAnnotations",
+			objects:     []client.Object{defaults},
+			issuerGroup: commandissuer.GroupVersion.Group,
+			annotations: map[string]string{"command-issuer.keyfactor.com/certificateTemplate": "Ephemeral2day"},
+			expectedAnnotations: map[string]string{
+				"metadata.command-issuer.keyfactor.com/ResponsibleTeam": "pki@example.com",
+				"command-issuer.keyfactor.com/certificateTemplate":      "Ephemeral2day",
+			},
+			expectedLabels: map[string]string{"example.com/managed-by": "command-issuer"},
+		},
+		{
+			name:        "OtherIssuerGroup",
+			objects:     []client.Object{defaults},
+			issuerGroup: "cert-manager.io",
+		},
+		{
+			name:        "NoConfigMap",
+			issuerGroup: commandissuer.GroupVersion.Group,
+		},
+		{
+			name: "InvalidConfigMap",
+			objects: []client.Object{&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: configMapName.Name, Namespace: configMapName.Namespace},
+				Data: map[string]string{
+					"annotations": "metadata.command-issuer.keyfactor.com/ResponsibleTeam: pki@example.com\n",
+					"labels":      "example.com/managed-by: not a valid label value\n",
+				},
+			}},
+			issuerGroup: commandissuer.GroupVersion.Group,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			defaulter := &CertificateRequestDefaulter{
+				Reader:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build(),
+				ConfigMap: configMapName,
+			}
+
+			certificateRequest := cmgen.CertificateRequest(
+				"cr1",
+				cmgen.SetCertificateRequestNamespace("ns1"),
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{Name: "issuer1", Group: tt.issuerGroup, Kind: "Issuer"}),
+				cmgen.SetCertificateRequestAnnotations(tt.annotations),
+			)
+			require.NoError(t, defaulter.Default(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), certificateRequest))
+
+			// Compare the lengths too, since the CertificateRequest may have empty rather than nil maps
+			assert.Len(t, certificateRequest.GetAnnotations(), len(tt.expectedAnnotations))
+			assert.Len(t, certificateRequest.GetLabels(), len(tt.expectedLabels))
+			for key, value := range tt.expectedAnnotations {
+				assert.Equal(t, value, certificateRequest.GetAnnotations()[key], "annotation %s", key)
+			}
+			for key, value := range tt.expectedLabels {
+				assert.Equal(t, value, certificateRequest.GetLabels()[key], "label %s", key)
+			}
+		})
+	}
+
+	t.Run("NotACertificateRequest", func(t *testing.T) {
+		defaulter := &CertificateRequestDefaulter{ConfigMap: configMapName}
+		assert.Error(t, defaulter.Default(context.TODO(), &cmapi.Certificate{}))
+	})
+}
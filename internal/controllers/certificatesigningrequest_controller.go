@@ -0,0 +1,658 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	experimentalapi "github.com/cert-manager/cert-manager/pkg/apis/experimental/v1alpha1"
+	"golang.org/x/time/rate"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+// DefaultSignerDomain is the domain of the signer names of Kubernetes CertificateSigningRequests
+// that are enrolled with an Issuer or ClusterIssuer
+const DefaultSignerDomain = "command-issuer.keyfactor.com"
+
+// errSubjectAccessReview is returned when the requester of a CertificateSigningRequest can't be
+// authorized to use its Issuer
+var errSubjectAccessReview = errors.New("failed to authorize the requester of the CertificateSigningRequest")
+
+// certificateSigningRequestReasonFailed is the reason of the Failed condition set on a
+// CertificateSigningRequest that can't be enrolled with Command
+const certificateSigningRequestReasonFailed = "CommandIssuerFailed"
+
+// CertificateSigningRequestReconciler enrolls Kubernetes CertificateSigningRequests with the Command
+// signer of an Issuer or ClusterIssuer. The issuer is selected by the signer name of the request,
+// which is issuers.<SignerDomain>/<namespace>.<name> for an Issuer and
+// clusterissuers.<SignerDomain>/<name> for a ClusterIssuer.
+type CertificateSigningRequestReconciler struct {
+	client.Client
+	ConfigClient                      issuerutil.ConfigClient
+	Scheme                            *runtime.Scheme
+	SignerBuilder                     signer.CommandSignerBuilder
+	ClusterResourceNamespace          string
+	ClusterIssuerSecretNamespace      string
+	SecretAccessGrantedAtClusterLevel bool
+	Clock                             clock.Clock
+	// SignerDomain is the domain of the signer names handled by the reconciler. Defaults to DefaultSignerDomain.
+	SignerDomain    string
+	RequestIDHeader string
+	// CommandInsecureSkipVerify disables verification of Command's server certificate for every issuer
+	CommandInsecureSkipVerify bool
+	// UserAgentSuffix is appended to the User-Agent sent to Command, e.g. to identify the cluster
+	UserAgentSuffix string
+	// TransportOptions tunes the connection pool of the HTTP transports used to connect to Command
+	TransportOptions signer.TransportOptions
+	// CSRLimits limits the CSRs that are sent to Command. Zero values disable the limits.
+	CSRLimits signer.CSRLimits
+	// SchemaCache caches the certificate templates and metadata fields of Command to validate requests
+	// before they are enrolled. If nil, requests aren't validated against them.
+	SchemaCache *signer.SchemaCache
+	// CAChainCache caches the CA chains returned by Command, so that enrollments with the same CA and
+	// certificate template don't fetch the chain again. If nil, the chain is fetched with every enrollment.
+	CAChainCache *signer.CAChainCache
+	// CircuitBreaker short-circuits calls to a Command host that is persistently down. If nil, calls
+	// to Command are never short-circuited.
+	CircuitBreaker *signer.CircuitBreaker
+	// RateLimiter limits the rate of requests to Command, e.g. to a share of a budget shared by the
+	// replicas of the controller. If nil, requests aren't rate limited.
+	RateLimiter *rate.Limiter
+	// IssuerStatusHandler records successful enrollments for the issuer status endpoint. If nil, they
+	// aren't recorded.
+	IssuerStatusHandler *IssuerStatusHandler
+	// EnrollmentPollInterval is how often an enrollment that is awaiting approval in Command is polled
+	EnrollmentPollInterval time.Duration
+	// ClusterName identifies the cluster in the metadata of the certificates enrolled in Command. If
+	// empty, it isn't recorded.
+	ClusterName string
+	// Recorder records Events on CertificateSigningRequests, e.g. when the issued certificate doesn't
+	// match the CSR. If nil, no Events are recorded.
+	Recorder record.EventRecorder
+	// ClockSkewTolerance is how far the validity window of an issued certificate may be from the local
+	// time before a warning is recorded
+	ClockSkewTolerance time.Duration
+	// WatchNamespaces limits the Issuers whose signer names are handled to these namespaces. If empty,
+	// Issuers in every namespace are handled.
+	WatchNamespaces []string
+	// DisableClusterIssuers ignores the signer names of ClusterIssuers, e.g. if they are handled by
+	// another instance of the controller
+	DisableClusterIssuers bool
+	// ShutdownGracePeriod is how long an in-flight reconcile may continue after the controller begins
+	// to shut down. If zero, in-flight reconciles are cancelled immediately.
+	ShutdownGracePeriod time.Duration
+	// AuditLogger writes a structured record of every enrollment, whatever its outcome. If nil,
+	// enrollments aren't audited.
+	AuditLogger *AuditLogger
+	// EnrollmentNotifier notifies a webhook of every completed enrollment. If nil, no notifications
+	// are sent.
+	EnrollmentNotifier *EnrollmentNotifier
+	// IssuerLimiter enforces the enrollment limits of the issuers. If nil, the enrollment limits of
+	// issuers aren't enforced.
+	IssuerLimiter *IssuerLimiter
+	// SubjectAccessReviews verifies that the requester of a CertificateSigningRequest may reference the
+	// Issuer of its signer name. If nil, CertificateSigningRequests for Issuers aren't signed.
+	SubjectAccessReviews authorizationv1client.SubjectAccessReviewInterface
+	// Timeout bounds the calls to Command of a single reconcile. If zero, only the timeouts of the
+	// individual HTTP requests apply.
+	Timeout time.Duration
+	// MaxEnrollmentAttempts is how many enrollments of a CertificateSigningRequest may fail before it is
+	// marked as Failed. If zero, failed enrollments are retried indefinitely.
+	MaxEnrollmentAttempts int
+	// MaxConditionMessageLength is the maximum length in bytes of condition messages. Longer messages
+	// are truncated, and the full message is recorded as an Event. If zero, messages aren't truncated.
+	MaxConditionMessageLength int
+	// Backpressure observes the latency of Command and lengthens the interval that enrollments awaiting
+	// approval are polled at while it trends upward. If nil, the latency isn't observed and the interval
+	// is unchanged.
+	Backpressure *Backpressure
+}
+
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;patch;watch
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/status,verbs=patch;update
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,verbs=sign,resourceNames=issuers.command-issuer.keyfactor.com/*;clusterissuers.command-issuer.keyfactor.com/*
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Reconcile enrolls an approved CertificateSigningRequest with the Command signer of the Issuer or
+// ClusterIssuer referred to by its signer name.
+func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := withShutdownGracePeriod(ctx, r.ShutdownGracePeriod)
+	defer cancel()
+
+	log := ctrl.LoggerFrom(ctx).WithName(ReconcilerLoggerName)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	var csr certificatesv1.CertificateSigningRequest
+	if err := r.Get(ctx, req.NamespacedName, &csr); err != nil {
+		if err := client.IgnoreNotFound(err); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unexpected get error: %v", err)
+		}
+		log.Info("Not found. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+
+	issuer, issuerName, ok := r.issuerForSignerName(csr.Spec.SignerName)
+	if !ok {
+		log.Info("Foreign signer name. Ignoring.", "signerName", csr.Spec.SignerName)
+		return ctrl.Result{}, nil
+	}
+
+	if len(csr.Status.Certificate) > 0 {
+		log.Info("CertificateSigningRequest is already signed. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+	if certificateSigningRequestHasCondition(&csr, certificatesv1.CertificateFailed) {
+		log.Info("CertificateSigningRequest is Failed. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+	if certificateSigningRequestHasCondition(&csr, certificatesv1.CertificateDenied) {
+		log.Info("CertificateSigningRequest has been denied. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+	if !certificateSigningRequestHasCondition(&csr, certificatesv1.CertificateApproved) {
+		log.Info("CertificateSigningRequest has not been approved yet. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+
+	meta := signer.K8sMetadata{}
+	switch issuer.(type) {
+	case *commandissuer.Issuer:
+		log = log.WithValues("issuer", issuerName)
+		meta.ControllerKind = "issuer"
+	case *commandissuer.ClusterIssuer:
+		log = log.WithValues("clusterissuer", issuerName)
+		meta.ControllerKind = "clusterissuer"
+	}
+
+	// Anyone may create a CertificateSigningRequest with any signer name, so the requester must be
+	// allowed to use an Issuer in its namespace, like with the namespaced signers of cert-manager
+	if _, ok := issuer.(*commandissuer.Issuer); ok {
+		allowed, err := r.userCanReferenceSigner(ctx, &csr, issuerName)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errSubjectAccessReview, err)
+		}
+		if !allowed {
+			err := fmt.Errorf("requester %q is not permitted to reference the Issuer %s: the \"reference\" verb on the \"signers\" resource of the %s API group is required in namespace %s", csr.Spec.Username, issuerName, commandissuer.GroupVersion.Group, issuerName.Namespace)
+			log.Error(err, "Not retrying.")
+			return ctrl.Result{}, r.setFailed(ctx, &csr, err.Error())
+		}
+	}
+
+	// Get the Issuer or ClusterIssuer
+	if err := r.Get(ctx, issuerName, issuer); err != nil {
+		return ctrl.Result{}, fmt.Errorf("%w: %v", errGetIssuer, err)
+	}
+
+	secretNamespace, err := issuerutil.GetSecretNamespace(issuer, r.ClusterResourceNamespace, r.ClusterIssuerSecretNamespace, r.SecretAccessGrantedAtClusterLevel)
+	if err != nil {
+		log.Error(err, "Unable to determine the Secret namespace. Not retrying.")
+		return ctrl.Result{}, r.setFailed(ctx, &csr, err.Error())
+	}
+
+	issuerSpec, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
+	if err != nil {
+		log.Error(err, "Unable to get the IssuerStatus. Not retrying.")
+		return ctrl.Result{}, r.setFailed(ctx, &csr, err.Error())
+	}
+
+	if !issuerutil.IsReady(issuerStatus, issuer.GetGeneration()) {
+		return ctrl.Result{}, errIssuerNotReady
+	}
+
+	issuerSpec, err = specWithProfile(ctx, r.Client, issuerSpec, profileNamespace(issuer, r.ClusterResourceNamespace))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Send a request ID to Command on every call so that its logs can be correlated with ours
+	if r.RequestIDHeader != "" {
+		var requestID string
+		ctx, requestID = signer.ContextWithRequestID(ctx, r.RequestIDHeader)
+		log = log.WithValues("requestID", requestID)
+	}
+	ctx = signer.ContextWithUserAgentSuffix(ctx, r.UserAgentSuffix)
+	ctx = signer.ContextWithTransportOptions(ctx, r.TransportOptions)
+	ctx = signer.ContextWithCSRLimits(ctx, r.CSRLimits)
+	ctx = signer.ContextWithSchemaCache(ctx, r.SchemaCache)
+	ctx = signer.ContextWithCAChainCache(ctx, r.CAChainCache)
+	ctx = signer.ContextWithCircuitBreaker(ctx, r.CircuitBreaker)
+	ctx = signer.ContextWithRateLimiter(ctx, r.RateLimiter)
+	if r.Backpressure != nil {
+		ctx = signer.ContextWithLatencyObserver(ctx, r.Backpressure)
+	}
+	ctx, endpoints := signer.ContextWithEndpointRecorder(ctx)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	// If a previous reconcile already enrolled a certificate for this request but failed to update
+	// the status, use the recorded certificate instead of enrolling a duplicate in Command
+	if leaf, chain, ok := enrolledCertificateSigningRequestCertificate(&csr); ok {
+		log.Info("Found certificate enrolled by a previous reconcile. Not enrolling again.")
+		return r.completeEnrollment(ctx, &csr, issuerSpec, leaf, chain)
+	}
+
+	// Bound the calls to Command so that a slow Command instance doesn't occupy a worker indefinitely.
+	// Kubernetes is still updated with ctx, so that a certificate issued just before the timeout is
+	// recorded rather than enrolled again.
+	commandCtx := ctx
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		commandCtx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	// The signer logs under its own name, so that its verbosity can be configured separately
+	commandCtx = ctrl.LoggerInto(commandCtx, ctrl.LoggerFrom(commandCtx).WithName(SignerLoggerName))
+
+	commandSigner, err := newIssuerSigner(commandCtx, r.ConfigClient, r.SignerBuilder, issuerSpec, secretNamespace, r.CommandInsecureSkipVerify, csr.GetAnnotations())
+	if err != nil {
+		if errors.Is(err, signer.ErrInvalidConfig) {
+			log.Error(err, "Issuer configuration is invalid. Retrying.", "retryAfter", defaultHealthCheckInterval)
+			return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	meta.ControllerNamespace = r.ClusterResourceNamespace
+	meta.ControllerResourceGroupName = commandissuer.GroupVersion.Group
+	meta.IssuerName = issuerName.Name
+	meta.IssuerNamespace = issuerName.Namespace
+	meta.ControllerReconcileId = string(controller.ReconcileIDFromContext(ctx))
+	meta.ClusterName = r.ClusterName
+	meta.IssuerMetadata = issuerMetadata(issuer, issuerSpec)
+	if csr.Spec.ExpirationSeconds != nil {
+		meta.Duration = time.Duration(*csr.Spec.ExpirationSeconds) * time.Second
+	}
+	// cert-manager requests CA certificates from CertificateSigningRequest signers with an annotation
+	meta.IsCA = csr.GetAnnotations()[experimentalapi.CertificateSigningRequestIsCAAnnotationKey] == "true"
+
+	var leaf, chain []byte
+	var certificateID int32
+	limitedSigner := r.IssuerLimiter.Signer(commandSigner, issuer, issuerSpec.EnrollmentLimits)
+	requestID, polling := pendingCertificateSigningRequestEnrollment(&csr)
+	if polling {
+		// The CSR was already enrolled by a previous reconcile and is awaiting approval in Command
+		log.Info(fmt.Sprintf("Polling enrollment request %d awaiting approval in Command", requestID))
+		leaf, chain, certificateID, err = limitedSigner.PollEnrollment(commandCtx, csr.Spec.Request, requestID, meta)
+	} else {
+		leaf, chain, certificateID, err = limitedSigner.Sign(commandCtx, csr.Spec.Request, meta)
+	}
+
+	// An enrollment awaiting approval is audited when it is first enrolled and when it completes, not
+	// on every poll. Requests queued by the enrollment limits of the issuer weren't enrolled.
+	var pendingErr *signer.EnrollmentPendingError
+	var limitErr *enrollmentLimitError
+	if (!polling || !errors.As(err, &pendingErr)) && (!errors.As(err, &limitErr) || limitErr.failFast) {
+		record := auditEnrollment("CertificateSigningRequest", &csr, issuer, issuerSpec, commandSigner, certificateID, err)
+		r.AuditLogger.Record(ctx, record)
+		r.EnrollmentNotifier.Notify(ctx, record)
+	}
+	if err != nil && errors.Is(commandCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("reconcile did not complete within %s: %w", r.Timeout, err)
+		log.Error(err, "Timed out waiting for Command. Retrying.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	if err != nil {
+		if errors.As(err, &pendingErr) {
+			if err := r.recordPendingEnrollment(ctx, &csr, pendingErr.RequestID); err != nil {
+				return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordPending, err)
+			}
+
+			pollInterval := r.EnrollmentPollInterval
+			if pollInterval <= 0 {
+				pollInterval = defaultEnrollmentPollInterval
+			}
+			pollInterval = r.Backpressure.Requeue(pollInterval)
+			log.Info(fmt.Sprintf("Enrollment is awaiting approval in Command. Polling again in %s.", pollInterval))
+			return ctrl.Result{RequeueAfter: pollInterval}, nil
+		}
+		if errors.Is(err, signer.ErrSubjectPatternMismatch) || errors.Is(err, signer.ErrSANTypeNotAllowed) || errors.Is(err, signer.ErrDNSDomainNotPermitted) || errors.Is(err, signer.ErrChangeReferenceInvalid) || errors.Is(err, signer.ErrCommonNameRequired) || errors.Is(err, signer.ErrCSRTooLarge) || errors.Is(err, signer.ErrCertificateAuthorityNotAllowed) || errors.Is(err, signer.ErrKeyPolicyViolation) || errors.Is(err, signer.ErrExtendedKeyUsageAmbiguous) || errors.Is(err, signer.ErrCANotAllowed) || errors.Is(err, signer.ErrCSRMalformed) ||
+			errors.Is(err, signer.ErrEnrollmentDenied) || errors.Is(err, signer.ErrEnrollmentRejected) || errors.Is(err, signer.ErrSchemaMismatch) {
+			log.Error(err, "Command did not issue a certificate. Not retrying.")
+			return ctrl.Result{}, r.setFailed(ctx, &csr, fmt.Sprintf("%v: %v", errSignerSign, err))
+		}
+		if errors.Is(err, signer.ErrInvalidConfig) {
+			log.Error(err, "Issuer configuration is invalid. Retrying.", "retryAfter", defaultHealthCheckInterval)
+			return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+		}
+		var circuitErr *signer.CircuitOpenError
+		if errors.As(err, &circuitErr) {
+			log.Info(circuitErr.Error())
+			return ctrl.Result{RequeueAfter: circuitErr.RetryAfter}, nil
+		}
+		if errors.As(err, &limitErr) {
+			if limitErr.failFast {
+				log.Error(err, "Issuer exceeded its enrollment limits. Not retrying.")
+				return ctrl.Result{}, r.setFailed(ctx, &csr, fmt.Sprintf("%v: %v", errSignerSign, err))
+			}
+			log.Info(limitErr.Error())
+			return ctrl.Result{RequeueAfter: limitErr.retryAfter}, nil
+		}
+		if polling || errors.Is(err, signer.ErrTransient) || r.MaxEnrollmentAttempts <= 0 {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errSignerSign, err)
+		}
+
+		attempts, recordErr := r.recordFailedAttempt(ctx, &csr)
+		if recordErr != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordAttempt, recordErr)
+		}
+		if attempts >= r.MaxEnrollmentAttempts {
+			log.Error(err, fmt.Sprintf("Enrollment failed %d times. Not retrying.", attempts))
+			return ctrl.Result{}, r.setFailed(ctx, &csr, fmt.Sprintf("%v: enrollment failed %d times: %v", errSignerSign, attempts, err))
+		}
+		return ctrl.Result{}, fmt.Errorf("%w (attempt %d of %d): %v", errSignerSign, attempts, r.MaxEnrollmentAttempts, err)
+	}
+	r.IssuerStatusHandler.RecordEnrollment(issuer)
+
+	endpoint, failedOver := endpoints.Endpoint()
+	if failedOver {
+		log.Info(fmt.Sprintf("WARNING: The certificate was enrolled with the fallback Command endpoint %s", endpoint))
+		if r.Recorder != nil {
+			r.Recorder.Event(&csr, corev1.EventTypeWarning, reasonCommandFailover, fmt.Sprintf("Enrolled with the fallback Command endpoint %s because the preferred endpoints failed", endpoint))
+		}
+	}
+
+	// Record the certificate before updating the status so that a retry doesn't enroll it again
+	if err := r.recordEnrolledCertificate(ctx, &csr, leaf, chain, certificateID, endpoint); err != nil {
+		return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordEnrolled, err)
+	}
+
+	return r.completeEnrollment(ctx, &csr, issuerSpec, leaf, chain)
+}
+
+// completeEnrollment verifies the certificate enrolled for the CertificateSigningRequest against the
+// issuer policy and records it in the status of the CertificateSigningRequest
+func (r *CertificateSigningRequestReconciler) completeEnrollment(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, issuerSpec *commandissuer.IssuerSpec, leaf, chain []byte) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// The certificate template may have removed or rewritten the requested names
+	if issuerSpec.SANMismatchPolicy != commandissuer.SANMismatchPolicyIgnore {
+		if err := signer.CompareIssuedNames(csr.Spec.Request, leaf, issuerSpec); errors.Is(err, signer.ErrIssuedSANMismatch) {
+			if issuerSpec.SANMismatchPolicy == commandissuer.SANMismatchPolicyFail {
+				log.Error(err, "Command issued a certificate that doesn't match the CSR. Not retrying.")
+				return ctrl.Result{}, r.setFailed(ctx, csr, fmt.Sprintf("%v: %v", errSignerSign, err))
+			}
+			log.Info(fmt.Sprintf("WARNING: %v", err))
+			if r.Recorder != nil {
+				r.Recorder.Event(csr, corev1.EventTypeWarning, reasonSANMismatch, err.Error())
+			}
+		} else if err != nil {
+			log.Error(err, "Failed to compare the issued certificate with the CSR")
+		}
+	}
+
+	// Regulated issuers only accept certificates that assert their certificate policy
+	if policy := issuerSpec.RequiredCertificatePolicy; policy != nil {
+		if err := signer.CheckCertificatePolicy(leaf, policy.OID); err != nil {
+			log.Error(err, "Command issued a certificate without the required certificate policy. Not retrying.")
+			if r.Recorder != nil && errors.Is(err, signer.ErrCertificatePolicyMissing) {
+				r.Recorder.Event(csr, corev1.EventTypeWarning, reasonCertificatePolicyMissing, err.Error())
+			}
+			return ctrl.Result{}, r.setFailed(ctx, csr, fmt.Sprintf("%v: %v", errSignerSign, err))
+		}
+	}
+
+	// The certificate is still issued if it isn't valid at the local time, since it is valid at the time of the CA
+	if err := signer.CheckValidityWindow(leaf, r.Clock.Now(), r.ClockSkewTolerance); errors.Is(err, signer.ErrValidityWindow) {
+		log.Info(fmt.Sprintf("WARNING: %v", err))
+		if r.Recorder != nil {
+			r.Recorder.Event(csr, corev1.EventTypeWarning, reasonClockSkew, err.Error())
+		}
+	} else if err != nil {
+		log.Error(err, "Failed to check the validity of the issued certificate")
+	}
+
+	// The certificate of a CertificateSigningRequest is followed by its chain
+	csr.Status.Certificate = append(leaf, chain...)
+	if err := r.Status().Update(ctx, csr); err != nil {
+		return ctrl.Result{}, fmt.Errorf("%w: %v", errRecordEnrolled, err)
+	}
+
+	log.Info("Signed the CertificateSigningRequest")
+	return ctrl.Result{}, nil
+}
+
+// issuerForSignerName returns an empty Issuer or ClusterIssuer and its name for a signer name handled
+// by the reconciler. ok is false if the signer name belongs to another signer.
+func (r *CertificateSigningRequestReconciler) issuerForSignerName(signerName string) (issuer client.Object, name types.NamespacedName, ok bool) {
+	domain := r.SignerDomain
+	if domain == "" {
+		domain = DefaultSignerDomain
+	}
+
+	prefix, issuerRef, found := strings.Cut(signerName, "/")
+	if !found || issuerRef == "" {
+		return nil, types.NamespacedName{}, false
+	}
+
+	switch prefix {
+	case "issuers." + domain:
+		// Namespaces can't contain dots, so the namespace ends at the first one
+		namespace, issuerName, found := strings.Cut(issuerRef, ".")
+		if !found || namespace == "" || issuerName == "" {
+			return nil, types.NamespacedName{}, false
+		}
+		if len(r.WatchNamespaces) > 0 && !slices.Contains(r.WatchNamespaces, namespace) {
+			return nil, types.NamespacedName{}, false
+		}
+		return &commandissuer.Issuer{}, types.NamespacedName{Namespace: namespace, Name: issuerName}, true
+	case "clusterissuers." + domain:
+		if r.DisableClusterIssuers {
+			return nil, types.NamespacedName{}, false
+		}
+		return &commandissuer.ClusterIssuer{}, types.NamespacedName{Name: issuerRef}, true
+	default:
+		return nil, types.NamespacedName{}, false
+	}
+}
+
+// setFailed marks the CertificateSigningRequest as permanently failed
+func (r *CertificateSigningRequestReconciler) setFailed(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, message string) error {
+	now := metav1.NewTime(r.Clock.Now())
+	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Type:               certificatesv1.CertificateFailed,
+		Status:             corev1.ConditionTrue,
+		Reason:             certificateSigningRequestReasonFailed,
+		Message:            conditionMessage(r.Recorder, csr, message, r.MaxConditionMessageLength),
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+	})
+	return r.Status().Update(ctx, csr)
+}
+
+// recordPendingEnrollment patches the Command request ID of an enrollment awaiting approval onto the
+// CertificateSigningRequest annotations, so that following reconciles poll the enrollment instead of
+// enrolling the CSR again. The request of a CertificateSigningRequest is immutable, so the request ID
+// only needs to be tied to its UID.
+func (r *CertificateSigningRequestReconciler) recordPendingEnrollment(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, requestID int32) error {
+	if id, ok := pendingCertificateSigningRequestEnrollment(csr); ok && id == requestID {
+		return nil
+	}
+
+	patch := client.MergeFrom(csr.DeepCopy())
+
+	annotations := csr.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[enrollmentKeyAnnotation] = string(csr.UID)
+	annotations[pendingRequestIDAnnotation] = strconv.FormatInt(int64(requestID), 10)
+	annotations[pendingSinceAnnotation] = r.Clock.Now().UTC().Truncate(time.Second).Format(time.RFC3339)
+	csr.SetAnnotations(annotations)
+
+	return r.Patch(ctx, csr, patch)
+}
+
+// pendingCertificateSigningRequestEnrollment returns the Command request ID of the enrollment
+// recorded on the CertificateSigningRequest by recordPendingEnrollment
+func pendingCertificateSigningRequestEnrollment(csr *certificatesv1.CertificateSigningRequest) (int32, bool) {
+	annotations := csr.GetAnnotations()
+	if annotations[enrollmentKeyAnnotation] != string(csr.UID) {
+		return 0, false
+	}
+
+	requestID, err := strconv.ParseInt(annotations[pendingRequestIDAnnotation], 10, 32)
+	if err != nil || requestID <= 0 {
+		return 0, false
+	}
+
+	return int32(requestID), true
+}
+
+// enrolledCertificateSigningRequestCertificate returns the certificate and chain recorded on the
+// CertificateSigningRequest by recordEnrolledCertificate
+func enrolledCertificateSigningRequestCertificate(csr *certificatesv1.CertificateSigningRequest) ([]byte, []byte, bool) {
+	annotations := csr.GetAnnotations()
+	if annotations[enrollmentKeyAnnotation] != string(csr.UID) {
+		return nil, nil, false
+	}
+
+	leaf, ok := annotations[enrolledCertificateAnnotation]
+	if !ok || leaf == "" {
+		return nil, nil, false
+	}
+
+	return []byte(leaf), []byte(annotations[enrolledCertificateCAAnnotation]), true
+}
+
+// recordEnrolledCertificate patches the certificate and chain enrolled with Command onto the
+// CertificateSigningRequest annotations, along with the Command ID of the certificate and the host of
+// the Command instance that enrolled it, if known. The merge patch doesn't conflict with concurrent
+// updates, so the certificate is retained if the status update fails.
+func (r *CertificateSigningRequestReconciler) recordEnrolledCertificate(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, leaf, chain []byte, certificateID int32, endpoint string) error {
+	patch := client.MergeFrom(csr.DeepCopy())
+
+	annotations := csr.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[enrollmentKeyAnnotation] = string(csr.UID)
+	annotations[enrolledCertificateAnnotation] = string(leaf)
+	annotations[enrolledCertificateCAAnnotation] = string(chain)
+	if certificateID != 0 {
+		annotations[enrolledCertificateIDAnnotation] = strconv.FormatInt(int64(certificateID), 10)
+	}
+	if endpoint != "" {
+		annotations[commandEndpointAnnotation] = endpoint
+	}
+	delete(annotations, pendingRequestIDAnnotation)
+	delete(annotations, pendingSinceAnnotation)
+	csr.SetAnnotations(annotations)
+
+	return r.Patch(ctx, csr, patch)
+}
+
+// recordFailedAttempt increments the number of failed enrollments recorded on the
+// CertificateSigningRequest annotations and returns the new number of failed enrollments
+func (r *CertificateSigningRequestReconciler) recordFailedAttempt(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (int, error) {
+	patch := client.MergeFrom(csr.DeepCopy())
+
+	annotations := csr.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	attempts := 0
+	if annotations[enrollmentKeyAnnotation] == string(csr.UID) {
+		// An unparsable count is reset rather than failing the request
+		attempts, _ = strconv.Atoi(annotations[failedAttemptsAnnotation])
+	}
+	attempts++
+	annotations[enrollmentKeyAnnotation] = string(csr.UID)
+	annotations[failedAttemptsAnnotation] = strconv.Itoa(attempts)
+	csr.SetAnnotations(annotations)
+
+	return attempts, r.Patch(ctx, csr, patch)
+}
+
+// userCanReferenceSigner returns whether the requester of the CertificateSigningRequest may use the
+// Issuer. Like cert-manager requires for its namespaced signers, the requester needs the "reference"
+// verb on the "signers" resource of the issuer API group in the namespace of the Issuer, either for
+// the name of the Issuer or for every name.
+func (r *CertificateSigningRequestReconciler) userCanReferenceSigner(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, issuerName types.NamespacedName) (bool, error) {
+	if r.SubjectAccessReviews == nil {
+		return false, errors.New("subject access reviews are not available")
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(csr.Spec.Extra))
+	for key, value := range csr.Spec.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	for _, name := range []string{issuerName.Name, "*"} {
+		review, err := r.SubjectAccessReviews.Create(ctx, &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   csr.Spec.Username,
+				Groups: csr.Spec.Groups,
+				Extra:  extra,
+				UID:    csr.Spec.UID,
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Group:     commandissuer.GroupVersion.Group,
+					Resource:  "signers",
+					Verb:      "reference",
+					Namespace: issuerName.Namespace,
+					Name:      name,
+					Version:   "*",
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return false, err
+		}
+		if review.Status.Allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// certificateSigningRequestHasCondition returns true if the CertificateSigningRequest has a condition
+// of the given type with status True
+func certificateSigningRequestHasCondition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager registers the CertificateSigningRequestReconciler with the controller manager.
+// It configures controller-runtime to reconcile Kubernetes CertificateSigningRequests in the cluster.
+func (r *CertificateSigningRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certificatesv1.CertificateSigningRequest{}).
+		Complete(r)
+}
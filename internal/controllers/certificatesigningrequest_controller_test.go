@@ -0,0 +1,328 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestCertificateSigningRequestReconcile(t *testing.T) {
+	certificateSigningRequest := func(signerName string, annotations map[string]string, conditions ...certificatesv1.RequestConditionType) *certificatesv1.CertificateSigningRequest {
+		csr := &certificatesv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "csr1",
+				UID:         "csr1-uid",
+				Annotations: annotations,
+			},
+			Spec: certificatesv1.CertificateSigningRequestSpec{
+				SignerName: signerName,
+				Request:    []byte("fake csr"),
+				Username:   "user1",
+			},
+		}
+		for _, condition := range conditions {
+			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+				Type:   condition,
+				Status: corev1.ConditionTrue,
+			})
+		}
+		return csr
+	}
+	readyStatus := commandissuer.IssuerStatus{
+		Conditions: []commandissuer.IssuerCondition{
+			{
+				Type:   commandissuer.IssuerConditionReady,
+				Status: commandissuer.ConditionTrue,
+			},
+		},
+	}
+	issuer := &commandissuer.Issuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "issuer1",
+			Namespace: "ns1",
+		},
+		Spec: commandissuer.IssuerSpec{
+			SecretName: "issuer1-credentials",
+		},
+		Status: readyStatus,
+	}
+	clusterIssuer := &commandissuer.ClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "clusterissuer1",
+		},
+		Spec: commandissuer.IssuerSpec{
+			SecretName: "clusterissuer1-credentials",
+		},
+		Status: readyStatus,
+	}
+	secrets := []client.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "issuer1-credentials",
+				Namespace: "ns1",
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "clusterissuer1-credentials",
+				Namespace: "kube-system",
+			},
+		},
+	}
+	fakeSignerBuilder := func(s *fakeSigner) signer.CommandSignerBuilder {
+		return func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			return s, nil
+		}
+	}
+
+	type testCase struct {
+		csr                 *certificatesv1.CertificateSigningRequest
+		objects             []client.Object
+		signer              *fakeSigner
+		expectedResult      ctrl.Result
+		expectedError       error
+		expectedCertificate []byte
+		expectedFailed      bool
+		expectedPendingID   string
+		// referenceDenied denies the requester the reference verb on the Issuer
+		referenceDenied       bool
+		maxEnrollmentAttempts int
+	}
+	tests := map[string]testCase{
+		"success-issuer": {
+			csr:                 certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects:             []client.Object{issuer},
+			signer:              &fakeSigner{},
+			expectedCertificate: []byte("fake signed certificatefake ca chain"),
+		},
+		"success-clusterissuer": {
+			csr:                 certificateSigningRequest("clusterissuers.command-issuer.keyfactor.com/clusterissuer1", nil, certificatesv1.CertificateApproved),
+			objects:             []client.Object{clusterIssuer},
+			signer:              &fakeSigner{},
+			expectedCertificate: []byte("fake signed certificatefake ca chain"),
+		},
+		"foreign-signer-name": {
+			csr:     certificateSigningRequest("kubernetes.io/kube-apiserver-client", nil, certificatesv1.CertificateApproved),
+			objects: []client.Object{issuer},
+			signer:  &fakeSigner{errSign: fmt.Errorf("unexpected enrollment")},
+		},
+		"invalid-issuer-signer-name": {
+			csr:     certificateSigningRequest("issuers.command-issuer.keyfactor.com/issuer1", nil, certificatesv1.CertificateApproved),
+			objects: []client.Object{issuer},
+			signer:  &fakeSigner{errSign: fmt.Errorf("unexpected enrollment")},
+		},
+		"not-approved": {
+			csr:     certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil),
+			objects: []client.Object{issuer},
+			signer:  &fakeSigner{errSign: fmt.Errorf("unexpected enrollment")},
+		},
+		"denied": {
+			csr:     certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateDenied),
+			objects: []client.Object{issuer},
+			signer:  &fakeSigner{errSign: fmt.Errorf("unexpected enrollment")},
+		},
+		"issuer-not-found": {
+			csr:           certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer2", nil, certificatesv1.CertificateApproved),
+			objects:       []client.Object{issuer},
+			signer:        &fakeSigner{},
+			expectedError: errGetIssuer,
+		},
+		"issuer-not-ready": {
+			csr: certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects: []client.Object{&commandissuer.Issuer{
+				ObjectMeta: issuer.ObjectMeta,
+				Spec:       issuer.Spec,
+			}},
+			signer:        &fakeSigner{},
+			expectedError: errIssuerNotReady,
+		},
+		"enrollment-rejected": {
+			csr:            certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects:        []client.Object{issuer},
+			signer:         &fakeSigner{errSign: fmt.Errorf("%w: simulated rejection", signer.ErrEnrollmentRejected)},
+			expectedFailed: true,
+		},
+		"enrollment-transient-error": {
+			csr:           certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects:       []client.Object{issuer},
+			signer:        &fakeSigner{errSign: fmt.Errorf("simulated timeout")},
+			expectedError: errSignerSign,
+		},
+		"enrollment-pending": {
+			csr:               certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects:           []client.Object{issuer},
+			signer:            &fakeSigner{errSign: &signer.EnrollmentPendingError{RequestID: 42}},
+			expectedResult:    ctrl.Result{RequeueAfter: defaultEnrollmentPollInterval},
+			expectedPendingID: "42",
+		},
+		"enrollment-pending-approved": {
+			csr: certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", map[string]string{
+				enrollmentKeyAnnotation:    "csr1-uid",
+				pendingRequestIDAnnotation: "42",
+			}, certificatesv1.CertificateApproved),
+			objects:             []client.Object{issuer},
+			signer:              &fakeSigner{errSign: fmt.Errorf("unexpected enrollment"), expectedPollRequestID: 42},
+			expectedCertificate: []byte("fake signed certificatefake ca chain"),
+		},
+		"issuer-reference-denied": {
+			csr:             certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects:         []client.Object{issuer},
+			signer:          &fakeSigner{errSign: fmt.Errorf("unexpected enrollment")},
+			referenceDenied: true,
+			expectedFailed:  true,
+		},
+		"clusterissuer-reference-not-required": {
+			csr:                 certificateSigningRequest("clusterissuers.command-issuer.keyfactor.com/clusterissuer1", nil, certificatesv1.CertificateApproved),
+			objects:             []client.Object{clusterIssuer},
+			signer:              &fakeSigner{},
+			referenceDenied:     true,
+			expectedCertificate: []byte("fake signed certificatefake ca chain"),
+		},
+		"enrolled-by-previous-reconcile": {
+			csr: certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", map[string]string{
+				enrollmentKeyAnnotation:         "csr1-uid",
+				enrolledCertificateAnnotation:   "recorded certificate",
+				enrolledCertificateCAAnnotation: "recorded ca chain",
+			}, certificatesv1.CertificateApproved),
+			objects:             []client.Object{issuer},
+			signer:              &fakeSigner{errSign: fmt.Errorf("unexpected enrollment")},
+			expectedCertificate: []byte("recorded certificaterecorded ca chain"),
+		},
+		"enrollment-max-attempts": {
+			csr: certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", map[string]string{
+				enrollmentKeyAnnotation:  "csr1-uid",
+				failedAttemptsAnnotation: "1",
+			}, certificatesv1.CertificateApproved),
+			objects:               []client.Object{issuer},
+			signer:                &fakeSigner{errSign: fmt.Errorf("simulated error")},
+			maxEnrollmentAttempts: 2,
+			expectedFailed:        true,
+		},
+		"enrollment-attempt-below-max": {
+			csr:                   certificateSigningRequest("issuers.command-issuer.keyfactor.com/ns1.issuer1", nil, certificatesv1.CertificateApproved),
+			objects:               []client.Object{issuer},
+			signer:                &fakeSigner{errSign: fmt.Errorf("simulated error")},
+			maxEnrollmentAttempts: 2,
+			expectedError:         errSignerSign,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, certificatesv1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(append(append([]client.Object{tc.csr}, tc.objects...), secrets...)...).
+				WithStatusSubresource(&certificatesv1.CertificateSigningRequest{}).
+				Build()
+			kubeClient := kubefake.NewSimpleClientset()
+			kubeClient.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+				attributes := review.Spec.ResourceAttributes
+				review.Status.Allowed = !tc.referenceDenied && review.Spec.User == "user1" &&
+					attributes.Group == commandissuer.GroupVersion.Group && attributes.Resource == "signers" &&
+					attributes.Verb == "reference" && attributes.Namespace == "ns1" && attributes.Name != "*"
+				return true, review, nil
+			})
+
+			controller := CertificateSigningRequestReconciler{
+				Client:                            fakeClient,
+				ConfigClient:                      NewFakeConfigClient(fakeClient),
+				Scheme:                            scheme,
+				ClusterResourceNamespace:          "kube-system",
+				SignerBuilder:                     fakeSignerBuilder(tc.signer),
+				Clock:                             fixedClock,
+				SecretAccessGrantedAtClusterLevel: true,
+				SubjectAccessReviews:              kubeClient.AuthorizationV1().SubjectAccessReviews(),
+				MaxEnrollmentAttempts:             tc.maxEnrollmentAttempts,
+			}
+			result, err := controller.Reconcile(
+				ctrl.LoggerInto(context.TODO(), logrtesting.New(t)),
+				reconcile.Request{NamespacedName: types.NamespacedName{Name: tc.csr.Name}},
+			)
+			if tc.expectedError != nil {
+				assertErrorIs(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedResult, result, "Unexpected result")
+
+			var csr certificatesv1.CertificateSigningRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Name: tc.csr.Name}, &csr))
+			assert.Equal(t, tc.expectedCertificate, csr.Status.Certificate)
+			assert.Equal(t, tc.expectedFailed, certificateSigningRequestHasCondition(&csr, certificatesv1.CertificateFailed))
+			assert.Equal(t, tc.expectedPendingID, csr.Annotations[pendingRequestIDAnnotation])
+			if tc.expectedCertificate != nil {
+				assert.NotEmpty(t, csr.Annotations[enrolledCertificateAnnotation], "the certificate must be recorded before the status is updated")
+			}
+		})
+	}
+}
+
+func TestCertificateSigningRequestSignerDomain(t *testing.T) {
+	r := CertificateSigningRequestReconciler{SignerDomain: "example.com"}
+
+	issuer, name, ok := r.issuerForSignerName("issuers.example.com/ns1.issuer.with.dots")
+	require.True(t, ok)
+	assert.IsType(t, &commandissuer.Issuer{}, issuer)
+	assert.Equal(t, types.NamespacedName{Namespace: "ns1", Name: "issuer.with.dots"}, name)
+
+	_, _, ok = r.issuerForSignerName("issuers.command-issuer.keyfactor.com/ns1.issuer1")
+	assert.False(t, ok)
+
+	_, _, ok = r.issuerForSignerName("clusterissuers.example.com/")
+	assert.False(t, ok)
+}
+
+func TestCertificateSigningRequestWatchScope(t *testing.T) {
+	r := CertificateSigningRequestReconciler{WatchNamespaces: []string{"tenant-a"}, DisableClusterIssuers: true}
+
+	_, name, ok := r.issuerForSignerName("issuers.command-issuer.keyfactor.com/tenant-a.issuer1")
+	require.True(t, ok)
+	assert.Equal(t, types.NamespacedName{Namespace: "tenant-a", Name: "issuer1"}, name)
+
+	_, _, ok = r.issuerForSignerName("issuers.command-issuer.keyfactor.com/tenant-b.issuer1")
+	assert.False(t, ok)
+
+	_, _, ok = r.issuerForSignerName("clusterissuers.command-issuer.keyfactor.com/issuer1")
+	assert.False(t, ok)
+}
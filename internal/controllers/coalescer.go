@@ -0,0 +1,162 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/utils/clock"
+)
+
+// EnrollmentCoalescer coalesces the enrollments of identical CSRs for the same cert-manager
+// Certificate. When a Certificate is edited several times in quick succession, cert-manager may
+// create CertificateRequests with the same CSR before the previous one is issued. Instead of
+// enrolling each of them in Command, an enrollment that is in flight or completed within the window
+// is reused. Only successful enrollments are reused.
+type EnrollmentCoalescer struct {
+	window time.Duration
+	clock  clock.PassiveClock
+
+	mu          sync.Mutex
+	enrollments map[string]*coalescedEnrollment
+}
+
+// coalescedEnrollment is the result of an enrollment. done is closed once the enrollment completes.
+type coalescedEnrollment struct {
+	done chan struct{}
+
+	// owner is the name of the CertificateRequest that enrolled the certificate
+	owner         string
+	leaf          []byte
+	chain         []byte
+	certificateID int32
+	err           error
+	completedAt   time.Time
+}
+
+// NewEnrollmentCoalescer creates a new EnrollmentCoalescer that reuses enrollments completed within
+// window. A window of 0 or less disables coalescing and returns nil.
+func NewEnrollmentCoalescer(window time.Duration, clock clock.PassiveClock) *EnrollmentCoalescer {
+	if window <= 0 {
+		return nil
+	}
+	return &EnrollmentCoalescer{
+		window:      window,
+		clock:       clock,
+		enrollments: make(map[string]*coalescedEnrollment),
+	}
+}
+
+// Enroll calls enroll, unless an enrollment with the same key is in flight or completed successfully
+// within the window, in which case its certificate, chain, and Command certificate ID are returned
+// along with the name of the CertificateRequest that enrolled them. coalescedFrom is empty if enroll
+// was called. If the in-flight enrollment fails, enroll is called. A nil coalescer always calls enroll.
+func (c *EnrollmentCoalescer) Enroll(ctx context.Context, key, owner string, enroll func() ([]byte, []byte, int32, error)) (leaf, chain []byte, certificateID int32, coalescedFrom string, err error) {
+	if c == nil || key == "" {
+		leaf, chain, certificateID, err = enroll()
+		return leaf, chain, certificateID, "", err
+	}
+
+	for {
+		c.mu.Lock()
+		now := c.clock.Now()
+		for k, e := range c.enrollments {
+			if !e.completedAt.IsZero() && now.Sub(e.completedAt) > c.window {
+				delete(c.enrollments, k)
+			}
+		}
+
+		existing, ok := c.enrollments[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-existing.done:
+		case <-ctx.Done():
+			return nil, nil, 0, "", ctx.Err()
+		}
+		if existing.err == nil {
+			enrollmentsCoalescedTotal.Inc()
+			return existing.leaf, existing.chain, existing.certificateID, existing.owner, nil
+		}
+		// The enrollment failed and was removed, so enroll again unless another request already is
+	}
+
+	enrollment := &coalescedEnrollment{
+		done:  make(chan struct{}),
+		owner: owner,
+	}
+	c.enrollments[key] = enrollment
+	c.mu.Unlock()
+
+	leaf, chain, certificateID, err = enroll()
+
+	c.mu.Lock()
+	enrollment.leaf, enrollment.chain, enrollment.certificateID, enrollment.err = leaf, chain, certificateID, err
+	enrollment.completedAt = c.clock.Now()
+	if err != nil {
+		delete(c.enrollments, key)
+	}
+	close(enrollment.done)
+	c.mu.Unlock()
+
+	return leaf, chain, certificateID, "", err
+}
+
+// coalescingKey returns the key under which the enrollment of a CertificateRequest is coalesced, or
+// an empty string if it isn't owned by a Certificate. The key identifies the Certificate, the issuer,
+// and everything about the request that changes the enrolled certificate: the CSR, the requested
+// duration, whether a CA certificate is requested, and the annotations that override the
+// enrollment, since a certificate can only be reused for the same request.
+func coalescingKey(certificateRequest *cmapi.CertificateRequest) string {
+	annotations := certificateRequest.GetAnnotations()
+	certificateName := annotations[cmapi.CertificateNameKey]
+	if certificateName == "" {
+		return ""
+	}
+
+	hash := sha256.New()
+	hash.Write(certificateRequest.Spec.Request)
+	if duration := certificateRequest.Spec.Duration; duration != nil {
+		fmt.Fprintf(hash, "\x00duration=%s", duration.Duration)
+	}
+	fmt.Fprintf(hash, "\x00isCA=%t", certificateRequest.Spec.IsCA)
+
+	var keys []string
+	for key := range annotations {
+		if signer.IsEnrollmentAnnotation(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "\x00%s=%s", key, annotations[key])
+	}
+
+	issuerRef := certificateRequest.Spec.IssuerRef
+	return certificateRequest.Namespace + "/" + certificateName + "/" + issuerRef.Kind + "/" + issuerRef.Name + "/" + hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,191 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestEnrollmentCoalescer(t *testing.T) {
+	enrollFunc := func(calls *int, leaf string, err error) func() ([]byte, []byte, int32, error) {
+		return func() ([]byte, []byte, int32, error) {
+			*calls++
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			return []byte(leaf), []byte("chain"), 42, nil
+		}
+	}
+
+	t.Run("ReusedWithinWindow", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		coalescer := NewEnrollmentCoalescer(5*time.Second, clock)
+		calls := 0
+
+		leaf, _, _, coalescedFrom, err := coalescer.Enroll(context.TODO(), "key", "cr1", enrollFunc(&calls, "leaf1", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "leaf1", string(leaf))
+		assert.Empty(t, coalescedFrom)
+
+		clock.Step(4 * time.Second)
+		leaf, chain, certificateID, coalescedFrom, err := coalescer.Enroll(context.TODO(), "key", "cr2", enrollFunc(&calls, "leaf2", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "leaf1", string(leaf))
+		assert.Equal(t, "chain", string(chain))
+		assert.Equal(t, int32(42), certificateID)
+		assert.Equal(t, "cr1", coalescedFrom)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("EnrolledAfterWindow", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(fixedClockStart)
+		coalescer := NewEnrollmentCoalescer(5*time.Second, clock)
+		calls := 0
+
+		_, _, _, _, err := coalescer.Enroll(context.TODO(), "key", "cr1", enrollFunc(&calls, "leaf1", nil))
+		require.NoError(t, err)
+
+		clock.Step(6 * time.Second)
+		leaf, _, _, coalescedFrom, err := coalescer.Enroll(context.TODO(), "key", "cr2", enrollFunc(&calls, "leaf2", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "leaf2", string(leaf))
+		assert.Empty(t, coalescedFrom)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("DifferentKeys", func(t *testing.T) {
+		coalescer := NewEnrollmentCoalescer(5*time.Second, clocktesting.NewFakeClock(fixedClockStart))
+		calls := 0
+
+		_, _, _, _, err := coalescer.Enroll(context.TODO(), "key1", "cr1", enrollFunc(&calls, "leaf1", nil))
+		require.NoError(t, err)
+		leaf, _, _, _, err := coalescer.Enroll(context.TODO(), "key2", "cr2", enrollFunc(&calls, "leaf2", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "leaf2", string(leaf))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("FailureNotReused", func(t *testing.T) {
+		coalescer := NewEnrollmentCoalescer(5*time.Second, clocktesting.NewFakeClock(fixedClockStart))
+		calls := 0
+
+		_, _, _, _, err := coalescer.Enroll(context.TODO(), "key", "cr1", enrollFunc(&calls, "", errors.New("enrollment failed")))
+		require.Error(t, err)
+		leaf, _, _, coalescedFrom, err := coalescer.Enroll(context.TODO(), "key", "cr2", enrollFunc(&calls, "leaf2", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "leaf2", string(leaf))
+		assert.Empty(t, coalescedFrom)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("InFlight", func(t *testing.T) {
+		coalescer := NewEnrollmentCoalescer(5*time.Second, clocktesting.NewFakeClock(fixedClockStart))
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, _, err := coalescer.Enroll(context.TODO(), "key", "cr1", func() ([]byte, []byte, int32, error) {
+				close(started)
+				<-release
+				return []byte("leaf1"), nil, 1, nil
+			})
+			assert.NoError(t, err)
+		}()
+		<-started
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+		}()
+		leaf, _, _, coalescedFrom, err := coalescer.Enroll(context.TODO(), "key", "cr2", func() ([]byte, []byte, int32, error) {
+			t.Error("the in-flight enrollment should be reused")
+			return nil, nil, 0, nil
+		})
+		wg.Wait()
+		require.NoError(t, err)
+		assert.Equal(t, "leaf1", string(leaf))
+		assert.Equal(t, "cr1", coalescedFrom)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		coalescer := NewEnrollmentCoalescer(0, clocktesting.NewFakeClock(fixedClockStart))
+		assert.Nil(t, coalescer)
+		calls := 0
+
+		for i := 0; i < 2; i++ {
+			_, _, _, coalescedFrom, err := coalescer.Enroll(context.TODO(), "key", "cr1", enrollFunc(&calls, "leaf", nil))
+			require.NoError(t, err)
+			assert.Empty(t, coalescedFrom)
+		}
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestCoalescingKey(t *testing.T) {
+	issuerRef := cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{Name: "issuer1", Kind: "Issuer"})
+	owned := func(name string, csr []byte) *cmapi.CertificateRequest {
+		return cmgen.CertificateRequest(name,
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.SetCertificateRequestCSR(csr),
+			issuerRef,
+			cmgen.AddCertificateRequestAnnotations(map[string]string{cmapi.CertificateNameKey: "cert1"}),
+		)
+	}
+
+	assert.Equal(t, coalescingKey(owned("cr1", []byte("csr1"))), coalescingKey(owned("cr2", []byte("csr1"))))
+	assert.NotEqual(t, coalescingKey(owned("cr1", []byte("csr1"))), coalescingKey(owned("cr2", []byte("csr2"))))
+	ca := owned("cr2", []byte("csr1"))
+	ca.Spec.IsCA = true
+	assert.NotEqual(t, coalescingKey(owned("cr1", []byte("csr1"))), coalescingKey(ca))
+
+	longer := owned("cr2", []byte("csr1"))
+	longer.Spec.Duration = &metav1.Duration{Duration: time.Hour}
+	assert.NotEqual(t, coalescingKey(owned("cr1", []byte("csr1"))), coalescingKey(longer))
+
+	for _, annotation := range []string{
+		"command-issuer.keyfactor.com/certificateTemplate",
+		"command-issuer.keyfactor.com/certificateAuthorityLogicalName",
+		"command-issuer.keyfactor.com/certificateAuthorityHostname",
+		"command-issuer.keyfactor.com/certificate-authority",
+		"metadata.command-issuer.keyfactor.com/Owner",
+	} {
+		overridden := owned("cr2", []byte("csr1"))
+		overridden.Annotations[annotation] = "value"
+		assert.NotEqual(t, coalescingKey(owned("cr1", []byte("csr1"))), coalescingKey(overridden), annotation)
+	}
+
+	// Other annotations don't change the enrolled certificate
+	unrelated := owned("cr2", []byte("csr1"))
+	unrelated.Annotations["example.com/unrelated"] = "value"
+	assert.Equal(t, coalescingKey(owned("cr1", []byte("csr1"))), coalescingKey(unrelated))
+	assert.Empty(t, coalescingKey(cmgen.CertificateRequest("cr1", cmgen.SetCertificateRequestNamespace("ns1"), issuerRef)))
+}
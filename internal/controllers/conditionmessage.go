@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// DefaultMaxConditionMessageLength is the default maximum length in bytes of the condition messages
+	// set by the controllers
+	DefaultMaxConditionMessageLength = 1024
+	// MinMaxConditionMessageLength is the smallest maximum length of condition messages that leaves
+	// room for a useful message
+	MinMaxConditionMessageLength = 64
+
+	// reasonConditionMessageTruncated is the reason of the Event recorded with the full message of a
+	// condition whose message was truncated
+	reasonConditionMessageTruncated = "ConditionMessageTruncated"
+
+	// conditionMessageEllipsis marks the end of a truncated condition message
+	conditionMessageEllipsis = "…"
+	// redacted replaces the sensitive values in condition messages
+	redacted = "[REDACTED]"
+)
+
+// sensitivePatterns match the values in error messages that must not be recorded in conditions or
+// Events, such as credentials echoed by a proxy or Command in an error response
+var sensitivePatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Private keys, e.g. in a misconfigured Secret that was echoed back
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), redacted},
+	// Credentials in URLs
+	{regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`), "${1}" + redacted + "@"},
+	// Authorization header values
+	{regexp.MustCompile(`(?i)(\bauthorization\s*[:=]\s*)(?:(?:basic|bearer)\s+)?[^\s,;]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{8,}`), "${1}" + redacted},
+	// Passwords, secrets and tokens in query strings, form values, and JSON
+	{regexp.MustCompile(`(?i)(\b(?:password|passwd|secret|client_secret|token|access_token|api_?key)=)[^\s&,;]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)("(?:password|passwd|secret|client_secret|token|access_token|api_?key)"\s*:\s*)"[^"]*"`), "${1}\"" + redacted + "\""},
+}
+
+// redactMessage replaces the sensitive values in message
+func redactMessage(message string) string {
+	for _, sensitive := range sensitivePatterns {
+		message = sensitive.pattern.ReplaceAllString(message, sensitive.replacement)
+	}
+	return message
+}
+
+// truncateMessage truncates message to at most maxLength bytes, ending it with an ellipsis. The
+// message is cut at a word boundary if one is close to the limit, so that it doesn't end mid-word.
+// If maxLength is zero, the message isn't truncated. It returns true if the message was truncated.
+func truncateMessage(message string, maxLength int) (string, bool) {
+	if maxLength <= 0 || len(message) <= maxLength {
+		return message, false
+	}
+
+	cut := max(maxLength-len(conditionMessageEllipsis), 0)
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	// Words longer than a quarter of the message, e.g. an encoded response body, are cut anyway
+	if i := strings.LastIndexAny(message[:cut+1], " \t\n"); i >= cut*3/4 {
+		cut = i
+	}
+	return strings.TrimRight(message[:cut], " \t\n.,:;-") + conditionMessageEllipsis, true
+}
+
+// conditionMessage returns the message of a condition of object with its sensitive values redacted,
+// truncated to maxLength bytes. If the message is truncated, the full message is recorded as an Event
+// of object, so that its detail is still available for debugging.
+func conditionMessage(recorder record.EventRecorder, object runtime.Object, message string, maxLength int) string {
+	message = redactMessage(message)
+	truncated, ok := truncateMessage(message, maxLength)
+	if ok && recorder != nil {
+		recorder.Event(object, corev1.EventTypeWarning, reasonConditionMessageTruncated, message)
+	}
+	return truncated
+}
@@ -0,0 +1,286 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultExpiryScanInterval  = time.Hour
+	defaultExpiryScanThreshold = 30 * 24 * time.Hour
+	defaultExpiryScanTimeout   = time.Minute
+
+	// reasonCertificatesExpiring is the reason of the Event recorded on an issuer when certificates it
+	// enrolled expire within the threshold of the expiry scan
+	reasonCertificatesExpiring = "CertificatesExpiring"
+	// expiringCertificatesInEvent is the maximum number of certificates listed in the message of a
+	// CertificatesExpiring Event
+	expiringCertificatesInEvent = 5
+)
+
+// ExpiringCertificateScanner periodically queries Command for the certificates enrolled through each
+// ready Issuer and ClusterIssuer that expire within Threshold, and reports their number per issuer in
+// the command_issuer_expiring_certificates gauge. The certificates are found by the metadata that the
+// controller records when it enrolls them, so certificates that are no longer requested by
+// cert-manager, e.g. because they are consumed outside of the cluster, are reported as well.
+type ExpiringCertificateScanner struct {
+	Client        client.Reader
+	ConfigClient  issuerutil.ConfigClient
+	SignerBuilder signer.CommandSignerBuilder
+	Clock         clock.Clock
+	// Interval is how often Command is queried. Defaults to an hour.
+	Interval time.Duration
+	// Threshold is how long before their expiry certificates are reported. Defaults to 30 days.
+	Threshold time.Duration
+	// Timeout bounds the queries of a single issuer. Defaults to a minute.
+	Timeout time.Duration
+
+	ClusterResourceNamespace          string
+	ClusterIssuerSecretNamespace      string
+	SecretAccessGrantedAtClusterLevel bool
+	// DisableClusterIssuers skips ClusterIssuers, e.g. if they are handled by another instance of the
+	// controller
+	DisableClusterIssuers bool
+	// ClusterName matches the Cluster-Name metadata field of the certificates. If empty, the
+	// certificates of every cluster that has an issuer with the same name are reported.
+	ClusterName string
+
+	// Recorder records a Warning Event on the issuers that have certificates expiring within the
+	// threshold. If nil, no Events are recorded.
+	Recorder record.EventRecorder
+
+	// CommandInsecureSkipVerify disables verification of Command's server certificate for every issuer
+	CommandInsecureSkipVerify bool
+	// UserAgentSuffix is appended to the User-Agent sent to Command, e.g. to identify the cluster
+	UserAgentSuffix string
+	// TransportOptions tunes the connection pool of the HTTP transports used to connect to Command
+	TransportOptions signer.TransportOptions
+	// CircuitBreaker short-circuits calls to a Command host that is persistently down. If nil, calls
+	// to Command are never short-circuited.
+	CircuitBreaker *signer.CircuitBreaker
+	// RateLimiter limits the rate of requests to Command. If nil, requests aren't rate limited.
+	RateLimiter *rate.Limiter
+}
+
+// Start implements manager.Runnable. It scans Command every Interval until ctx is done.
+func (s *ExpiringCertificateScanner) Start(ctx context.Context) error {
+	for {
+		s.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.clock().After(s.interval()):
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Only the leader queries Command, so
+// that the replicas of the controller don't multiply the load of the scan.
+func (s *ExpiringCertificateScanner) NeedLeaderElection() bool {
+	return true
+}
+
+// scan counts the expiring certificates of every ready issuer and replaces the series of the gauge.
+// Issuers whose certificates can't be listed have no series until the next successful scan, so that
+// a stale count isn't reported.
+func (s *ExpiringCertificateScanner) scan(ctx context.Context) {
+	k8sLog := log.FromContext(ctx)
+
+	issuers, err := s.issuers(ctx)
+	if err != nil {
+		k8sLog.Error(err, "Failed to list the issuers to scan for expiring certificates")
+		return
+	}
+
+	before := s.clock().Now().Add(s.threshold())
+	type issuerKey struct{ kind, namespace, name string }
+	counts := make(map[issuerKey]int, len(issuers))
+	for _, issuer := range issuers {
+		kind := issuer.GetObjectKind().GroupVersionKind().Kind
+		certificates, err := s.scanIssuer(ctx, issuer, before)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			k8sLog.Error(err, fmt.Sprintf("Failed to list the expiring certificates of %s %s", kind, client.ObjectKeyFromObject(issuer)))
+			continue
+		}
+		counts[issuerKey{kind, issuer.GetNamespace(), issuer.GetName()}] = len(certificates)
+
+		if len(certificates) > 0 {
+			k8sLog.V(1).Info(fmt.Sprintf("%s %s has %d certificates in Command that expire before %s", kind, client.ObjectKeyFromObject(issuer), len(certificates), before.UTC().Format(time.RFC3339)))
+			if s.Recorder != nil {
+				s.Recorder.Event(issuer, corev1.EventTypeWarning, reasonCertificatesExpiring, expiringCertificatesMessage(certificates, before))
+			}
+		}
+	}
+
+	expiringCertificates.Reset()
+	for key, count := range counts {
+		expiringCertificates.WithLabelValues(key.kind, key.namespace, key.name).Set(float64(count))
+	}
+}
+
+// issuers returns the ready Issuers and ClusterIssuers, with their kind set
+func (s *ExpiringCertificateScanner) issuers(ctx context.Context) ([]client.Object, error) {
+	var issuers commandissuer.IssuerList
+	if err := s.Client.List(ctx, &issuers); err != nil {
+		return nil, err
+	}
+	var objects []client.Object
+	for i := range issuers.Items {
+		issuers.Items[i].SetGroupVersionKind(commandissuer.GroupVersion.WithKind("Issuer"))
+		objects = append(objects, &issuers.Items[i])
+	}
+
+	if !s.DisableClusterIssuers {
+		var clusterIssuers commandissuer.ClusterIssuerList
+		if err := s.Client.List(ctx, &clusterIssuers); err != nil {
+			return nil, err
+		}
+		for i := range clusterIssuers.Items {
+			clusterIssuers.Items[i].SetGroupVersionKind(commandissuer.GroupVersion.WithKind("ClusterIssuer"))
+			objects = append(objects, &clusterIssuers.Items[i])
+		}
+	}
+
+	ready := objects[:0]
+	for _, issuer := range objects {
+		_, status, err := issuerutil.GetSpecAndStatus(issuer)
+		if err == nil && issuerutil.IsReady(status, issuer.GetGeneration()) {
+			ready = append(ready, issuer)
+		}
+	}
+	return ready, nil
+}
+
+// scanIssuer lists the certificates enrolled through the issuer that expire before the given time
+func (s *ExpiringCertificateScanner) scanIssuer(ctx context.Context, issuer client.Object, before time.Time) ([]signer.ExpiringCertificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+
+	spec, _, err := issuerutil.GetSpecAndStatus(issuer)
+	if err != nil {
+		return nil, err
+	}
+	spec, err = specWithProfile(ctx, s.Client, spec, profileNamespace(issuer, s.ClusterResourceNamespace))
+	if err != nil {
+		return nil, err
+	}
+	secretNamespace, err := issuerutil.GetSecretNamespace(issuer, s.ClusterResourceNamespace, s.ClusterIssuerSecretNamespace, s.SecretAccessGrantedAtClusterLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName(SignerLoggerName))
+	ctx = signer.ContextWithUserAgentSuffix(ctx, s.UserAgentSuffix)
+	ctx = signer.ContextWithTransportOptions(ctx, s.TransportOptions)
+	ctx = signer.ContextWithCircuitBreaker(ctx, s.CircuitBreaker)
+	ctx = signer.ContextWithRateLimiter(ctx, s.RateLimiter)
+
+	commandSigner, err := newIssuerSigner(ctx, s.ConfigClient, s.SignerBuilder, spec, secretNamespace, s.CommandInsecureSkipVerify, nil)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := commandSigner.(signer.ExpiringCertificateLister)
+	if !ok {
+		return nil, errors.New("the signer of the issuer can't list expiring certificates")
+	}
+
+	// The certificates are matched by the metadata recorded by the CertificateRequest and
+	// CertificateSigningRequest reconcilers. The Issuer-Namespace of the certificates of a
+	// ClusterIssuer is the namespace of their request, so it isn't matched for ClusterIssuers.
+	meta := signer.K8sMetadata{
+		ControllerKind: "issuer",
+		IssuerName:     issuer.GetName(),
+		ClusterName:    s.ClusterName,
+	}
+	if _, ok := issuer.(*commandissuer.ClusterIssuer); ok {
+		meta.ControllerKind = "clusterissuer"
+	} else {
+		meta.IssuerNamespace = issuer.GetNamespace()
+	}
+	return lister.ListExpiringCertificates(ctx, meta, before)
+}
+
+// expiringCertificatesMessage returns the message of the CertificatesExpiring Event, listing the
+// certificates that expire first
+func expiringCertificatesMessage(certificates []signer.ExpiringCertificate, before time.Time) string {
+	certificates = append([]signer.ExpiringCertificate(nil), certificates...)
+	sort.Slice(certificates, func(i, j int) bool {
+		return certificates[i].NotAfter.Before(certificates[j].NotAfter)
+	})
+
+	listed := make([]string, 0, expiringCertificatesInEvent)
+	for _, certificate := range certificates {
+		if len(listed) == expiringCertificatesInEvent {
+			break
+		}
+		listed = append(listed, fmt.Sprintf("%q (Command ID %d) expires at %s", certificate.CommonName, certificate.CertificateID, certificate.NotAfter.UTC().Format(time.RFC3339)))
+	}
+
+	message := fmt.Sprintf("%d certificates enrolled in Command expire before %s: %s", len(certificates), before.UTC().Format(time.RFC3339), strings.Join(listed, ", "))
+	if len(certificates) > len(listed) {
+		message += fmt.Sprintf(", and %d more", len(certificates)-len(listed))
+	}
+	return message
+}
+
+func (s *ExpiringCertificateScanner) clock() clock.Clock {
+	if s.Clock == nil {
+		return clock.RealClock{}
+	}
+	return s.Clock
+}
+
+func (s *ExpiringCertificateScanner) interval() time.Duration {
+	if s.Interval <= 0 {
+		return defaultExpiryScanInterval
+	}
+	return s.Interval
+}
+
+func (s *ExpiringCertificateScanner) threshold() time.Duration {
+	if s.Threshold <= 0 {
+		return defaultExpiryScanThreshold
+	}
+	return s.Threshold
+}
+
+func (s *ExpiringCertificateScanner) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return defaultExpiryScanTimeout
+	}
+	return s.Timeout
+}
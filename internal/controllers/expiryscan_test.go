@@ -0,0 +1,243 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeExpiringCertificateLister returns the certificates of each issuer name and records the
+// metadata and the time it was queried with
+type fakeExpiringCertificateLister struct {
+	fakeSigner
+	certificates map[string][]signer.ExpiringCertificate
+	err          error
+	queries      *[]signer.K8sMetadata
+	before       *time.Time
+}
+
+func (o *fakeExpiringCertificateLister) ListExpiringCertificates(_ context.Context, meta signer.K8sMetadata, before time.Time) ([]signer.ExpiringCertificate, error) {
+	*o.queries = append(*o.queries, meta)
+	*o.before = before
+	return o.certificates[meta.IssuerName], o.err
+}
+
+func TestExpiringCertificateScanner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	ready := commandissuer.IssuerStatus{
+		Conditions: []commandissuer.IssuerCondition{{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue}},
+	}
+	objects := []client.Object{
+		&commandissuer.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+			Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", SecretName: "auth"},
+			Status:     ready,
+		},
+		&commandissuer.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "not-ready", Namespace: "ns1"},
+			Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", SecretName: "auth"},
+		},
+		&commandissuer.ClusterIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterissuer1"},
+			Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", SecretName: "auth"},
+			Status:     ready,
+		},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "ns1"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "kube-system"}},
+	}
+
+	expiring := []signer.ExpiringCertificate{
+		{CertificateID: 1, CommonName: "later.example.com", NotAfter: fixedClockStart.Add(48 * time.Hour)},
+		{CertificateID: 2, CommonName: "sooner.example.com", NotAfter: fixedClockStart.Add(24 * time.Hour)},
+	}
+
+	tests := map[string]struct {
+		disableClusterIssuers bool
+		err                   error
+		expectedQueries       []signer.K8sMetadata
+		expectedGauge         map[[3]string]float64
+		expectedEvents        []string
+	}{
+		"issuers-and-clusterissuers": {
+			expectedQueries: []signer.K8sMetadata{
+				{ControllerKind: "issuer", IssuerName: "issuer1", IssuerNamespace: "ns1", ClusterName: "cluster-a"},
+				{ControllerKind: "clusterissuer", IssuerName: "clusterissuer1", ClusterName: "cluster-a"},
+			},
+			expectedGauge: map[[3]string]float64{
+				{"Issuer", "ns1", "issuer1"}:            2,
+				{"ClusterIssuer", "", "clusterissuer1"}: 0,
+			},
+			expectedEvents: []string{
+				`Warning CertificatesExpiring 2 certificates enrolled in Command expire before 2024-01-31T00:00:00Z: "sooner.example.com" (Command ID 2) expires at 2024-01-02T00:00:00Z, "later.example.com" (Command ID 1) expires at 2024-01-03T00:00:00Z`,
+			},
+		},
+		"disable-cluster-issuers": {
+			disableClusterIssuers: true,
+			expectedQueries: []signer.K8sMetadata{
+				{ControllerKind: "issuer", IssuerName: "issuer1", IssuerNamespace: "ns1", ClusterName: "cluster-a"},
+			},
+			expectedGauge: map[[3]string]float64{
+				{"Issuer", "ns1", "issuer1"}: 2,
+			},
+			expectedEvents: []string{"Warning CertificatesExpiring 2 certificates"},
+		},
+		"query-fails": {
+			err: errors.New("command unavailable"),
+			expectedQueries: []signer.K8sMetadata{
+				{ControllerKind: "issuer", IssuerName: "issuer1", IssuerNamespace: "ns1", ClusterName: "cluster-a"},
+				{ControllerKind: "clusterissuer", IssuerName: "clusterissuer1", ClusterName: "cluster-a"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+			var queries []signer.K8sMetadata
+			var before time.Time
+			recorder := record.NewFakeRecorder(10)
+			// A series of a deleted issuer is removed by the next scan
+			expiringCertificates.WithLabelValues("Issuer", "ns1", "deleted").Set(1)
+
+			scanner := &ExpiringCertificateScanner{
+				Client:       fakeClient,
+				ConfigClient: NewFakeConfigClient(fakeClient),
+				SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+					return &fakeExpiringCertificateLister{
+						certificates: map[string][]signer.ExpiringCertificate{"issuer1": expiring},
+						err:          tc.err,
+						queries:      &queries,
+						before:       &before,
+					}, nil
+				},
+				Clock:                    fixedClock,
+				Threshold:                30 * 24 * time.Hour,
+				ClusterResourceNamespace: "kube-system",
+				DisableClusterIssuers:    tc.disableClusterIssuers,
+				ClusterName:              "cluster-a",
+				Recorder:                 recorder,
+			}
+			scanner.scan(context.Background())
+
+			assert.Equal(t, tc.expectedQueries, queries)
+			assert.Equal(t, fixedClockStart.Add(30*24*time.Hour), before)
+
+			assert.Equal(t, len(tc.expectedGauge), testutil.CollectAndCount(expiringCertificates))
+			for labels, value := range tc.expectedGauge {
+				assert.Equal(t, value, testutil.ToFloat64(expiringCertificates.WithLabelValues(labels[0], labels[1], labels[2])), labels)
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			require.Len(t, events, len(tc.expectedEvents))
+			for i, expected := range tc.expectedEvents {
+				assert.True(t, strings.HasPrefix(events[i], expected), events[i])
+			}
+		})
+	}
+}
+
+func TestExpiringCertificateScannerSharedConfigClient(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	issuer := &commandissuer.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+		Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", SecretName: "auth"},
+		Status: commandissuer.IssuerStatus{
+			Conditions: []commandissuer.IssuerCondition{{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue}},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		issuer,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "ns1"}},
+	).Build()
+	configClient := NewFakeConfigClient(fakeClient)
+
+	var queries []signer.K8sMetadata
+	var before time.Time
+	scanner := &ExpiringCertificateScanner{
+		Client:       fakeClient,
+		ConfigClient: configClient,
+		SignerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+			return &fakeExpiringCertificateLister{queries: &queries, before: &before}, nil
+		},
+		Clock:                             fixedClock,
+		Threshold:                         30 * 24 * time.Hour,
+		SecretAccessGrantedAtClusterLevel: true,
+		Recorder:                          record.NewFakeRecorder(100),
+	}
+	signerBuilder := func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+		return &fakeSigner{}, nil
+	}
+
+	// Every scan of an issuer cancels its context when it returns, which must not affect the
+	// reconciles reading from the same config client
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			scanner.scan(context.Background())
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		_, err := newIssuerSigner(context.Background(), configClient, signerBuilder, &issuer.Spec, "ns1", false, nil)
+		assert.NoError(t, err)
+	}
+	<-done
+
+	assert.Len(t, queries, 50)
+}
+
+func TestExpiringCertificatesMessage(t *testing.T) {
+	var certificates []signer.ExpiringCertificate
+	for i := 0; i < 7; i++ {
+		certificates = append(certificates, signer.ExpiringCertificate{
+			CertificateID: int32(i),
+			CommonName:    "cert.example.com",
+			NotAfter:      fixedClockStart.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	message := expiringCertificatesMessage(certificates, fixedClockStart.Add(24*time.Hour))
+	assert.True(t, strings.HasPrefix(message, "7 certificates enrolled in Command expire before 2024-01-02T00:00:00Z: "), message)
+	assert.Equal(t, 5, strings.Count(message, "Command ID"))
+	assert.True(t, strings.HasSuffix(message, ", and 2 more"), message)
+}
@@ -34,7 +34,6 @@ var _ util.ConfigClient = &FakeConfigClient{}
 
 type FakeConfigClient struct {
 	client client.Client
-	ctx    context.Context
 }
 
 // NewFakeConfigClient uses the
@@ -44,14 +43,16 @@ func NewFakeConfigClient(fakeControllerRuntimeClient client.Client) util.ConfigC
 	}
 }
 
-func (f *FakeConfigClient) SetContext(ctx context.Context) {
-	f.ctx = ctx
-}
-
-func (f *FakeConfigClient) GetConfigMap(name types.NamespacedName, out *corev1.ConfigMap) error {
-	return f.client.Get(f.ctx, name, out)
+func (f *FakeConfigClient) GetConfigMap(ctx context.Context, name types.NamespacedName, out *corev1.ConfigMap) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.client.Get(ctx, name, out)
 }
 
-func (f *FakeConfigClient) GetSecret(name types.NamespacedName, out *corev1.Secret) error {
-	return f.client.Get(f.ctx, name, out)
+func (f *FakeConfigClient) GetSecret(ctx context.Context, name types.NamespacedName, out *corev1.Secret) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.client.Get(ctx, name, out)
 }
@@ -22,27 +22,47 @@ import (
 	"fmt"
 	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
 	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"math/rand"
+	"sync"
 	"time"
 
 	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
 	issuerReadyConditionReason = "command-issuer.IssuerController.Reconcile"
 	defaultHealthCheckInterval = time.Minute
+	// commandVersionCacheTTL is how long the version of a Command instance is cached before it is
+	// queried again
+	commandVersionCacheTTL = time.Hour
+
+	// forceRecheckAnnotation forces a health check of an issuer when its value changes, e.g. to a
+	// timestamp, and clears the state cached for its Command instance
+	forceRecheckAnnotation = "command-issuer.keyfactor.com/force-recheck"
+	// reasonForcedRecheck is the reason of the Event recorded when a health check is forced
+	reasonForcedRecheck = "ForcedRecheck"
 )
 
 var (
 	errGetAuthSecret        = errors.New("failed to get Secret containing Issuer credentials")
+	errGetReadSecret        = errors.New("commandReadSecretName specified a name, but failed to get Secret containing Issuer read credentials")
 	errGetCaSecret          = errors.New("caSecretName specified a name, but failed to get Secret containing CA certificate")
 	errHealthCheckerBuilder = errors.New("failed to build the healthchecker")
 	errHealthCheckerCheck   = errors.New("healthcheck failed")
+	errInvalidIssuerSpec    = errors.New("invalid issuer spec")
+	// errConfigClientUnavailable is returned if the controller was started without a config client
+	errConfigClientUnavailable = errors.New("the controller has no client to read the Secrets and ConfigMaps of issuers")
 )
 
 // IssuerReconciler reconciles a Issuer object
@@ -51,14 +71,106 @@ type IssuerReconciler struct {
 	ConfigClient                      issuerutil.ConfigClient
 	Kind                              string
 	ClusterResourceNamespace          string
+	ClusterIssuerSecretNamespace      string
 	SecretAccessGrantedAtClusterLevel bool
 	Scheme                            *runtime.Scheme
 	HealthCheckerBuilder              signer.HealthCheckerBuilder
+	RequestIDHeader                   string
+	// RetryInterval is how long to wait before checking the health of a not-ready issuer again.
+	// If zero, failed health checks are retried with the controller's exponential backoff.
+	RetryInterval time.Duration
+	Clock         clock.Clock
+	// CommandInsecureSkipVerify disables verification of Command's server certificate for every issuer
+	CommandInsecureSkipVerify bool
+	// UserAgentSuffix is appended to the User-Agent sent to Command, e.g. to identify the cluster
+	UserAgentSuffix string
+	// TransportOptions tunes the connection pool of the HTTP transports used to connect to Command
+	TransportOptions signer.TransportOptions
+	// CircuitBreaker short-circuits calls to a Command host that is persistently down. If nil, calls
+	// to Command are never short-circuited.
+	CircuitBreaker *signer.CircuitBreaker
+	// RateLimiter limits the rate of requests to Command, e.g. to a share of a budget shared by the
+	// replicas of the controller. If nil, requests aren't rate limited.
+	RateLimiter *rate.Limiter
+	// HealthCheckJitter randomizes the interval between health checks by up to this fraction in
+	// either direction, so that issuers created at the same time don't check Command at the same time
+	HealthCheckJitter float64
+	// IssuerStatusHandler records the health checks of the issuer for the issuer status endpoint. If
+	// nil, they aren't recorded.
+	IssuerStatusHandler *IssuerStatusHandler
+	// SchemaCache is the cache of Command schemas shared with the request reconcilers. The schemas
+	// of the Command instance of an issuer are cleared when a health check is forced.
+	SchemaCache *signer.SchemaCache
+	// CAChainCache is the cache of CA chains shared with the request reconcilers. The chains of the
+	// Command instance of an issuer are cleared when a health check is forced.
+	CAChainCache *signer.CAChainCache
+	// Recorder records Events on issuers, e.g. when a health check is forced
+	Recorder record.EventRecorder
+	// IssuerLimiter enforces the enrollment limits of the issuers. The state of the limits of an
+	// issuer is discarded when it is deleted.
+	IssuerLimiter *IssuerLimiter
+	// MaxConditionMessageLength is the maximum length in bytes of condition messages. Longer messages
+	// are truncated, and the full message is recorded as an Event. If zero, messages aren't truncated.
+	MaxConditionMessageLength int
+	// Backpressure observes the latency of Command and lengthens the interval between the health checks
+	// of ready issuers, and of issuers that failed a health check, while it trends upward. If nil, the
+	// latency isn't observed and the intervals are unchanged.
+	Backpressure *Backpressure
+
+	commandVersions commandVersionCache
+	// forceRecheckValues holds the last seen value of the force-recheck annotation of each issuer
+	forceRecheckValues forceRecheckValues
+	// random returns a number in [0.0, 1.0). Defaults to rand.Float64.
+	random func() float64
+}
+
+// commandVersionCache caches the versions of Command instances by hostname
+type commandVersionCache struct {
+	mu      sync.Mutex
+	entries map[string]commandVersionEntry
+}
+
+type commandVersionEntry struct {
+	version   string
+	checkedAt time.Time
+}
+
+// forceRecheckValues tracks the value of the force-recheck annotation of each issuer, so that a
+// change can be told apart from a reconcile of an issuer that was annotated in the past
+type forceRecheckValues struct {
+	mu     sync.Mutex
+	values map[types.NamespacedName]string
+}
+
+// observe records the value of the force-recheck annotation of the issuer and returns true if it
+// changed since the issuer was last observed. The first observation of an issuer, e.g. after the
+// controller restarted, isn't a change, since every issuer is checked on startup anyway.
+func (f *forceRecheckValues) observe(name types.NamespacedName, value string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.values == nil {
+		f.values = make(map[types.NamespacedName]string)
+	}
+	previous, seen := f.values[name]
+	f.values[name] = value
+	return seen && previous != value
+}
+
+// forget stops tracking a deleted issuer
+func (f *forceRecheckValues) forget(name types.NamespacedName) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.values, name)
 }
 
 //+kubebuilder:rbac:groups=command-issuer.keyfactor.com,resources=issuers;clusterissuers,verbs=get;list;watch
 //+kubebuilder:rbac:groups=command-issuer.keyfactor.com,resources=issuers/status;clusterissuers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=command-issuer.keyfactor.com,resources=issuers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=command-issuer.keyfactor.com,resources=commandissuerprofiles,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // newIssuer returns a new Issuer or ClusterIssuer object
 func (r *IssuerReconciler) newIssuer() (client.Object, error) {
@@ -72,7 +184,8 @@ func (r *IssuerReconciler) newIssuer() (client.Object, error) {
 
 // Reconcile reconciles and updates the status of an Issuer or ClusterIssuer object
 func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
-	log := ctrl.LoggerFrom(ctx)
+	log := ctrl.LoggerFrom(ctx).WithName(ReconcilerLoggerName)
+	ctx = ctrl.LoggerInto(ctx, log)
 
 	issuer, err := r.newIssuer()
 	if err != nil {
@@ -84,9 +197,21 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 			return ctrl.Result{}, fmt.Errorf("unexpected get error: %v", err)
 		}
 		log.Info("Not found. Ignoring.")
+		r.forceRecheckValues.forget(req.NamespacedName)
+		r.IssuerLimiter.Forget(r.Kind, req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
+	// Reconciles are triggered by every change to the issuer, so a changed annotation only needs to
+	// be noticed to clear the cached state before the health check
+	forceRecheck := r.forceRecheckValues.observe(req.NamespacedName, issuer.GetAnnotations()[forceRecheckAnnotation])
+	if forceRecheck {
+		log.Info("Health check forced by the force-recheck annotation")
+		if r.Recorder != nil {
+			r.Recorder.Event(issuer, corev1.EventTypeNormal, reasonForcedRecheck, fmt.Sprintf("Forced a health check, %s changed to %q", forceRecheckAnnotation, issuer.GetAnnotations()[forceRecheckAnnotation]))
+		}
+	}
+
 	issuerSpec, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
 	if err != nil {
 		log.Error(err, "Unexpected error while getting issuer spec and status. Not retrying.")
@@ -96,7 +221,7 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 	// Always attempt to update the Ready condition
 	defer func() {
 		if err != nil {
-			issuerutil.SetReadyCondition(issuerStatus, commandissuer.ConditionFalse, issuerReadyConditionReason, err.Error())
+			issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionFalse, issuerReadyConditionReason, conditionMessage(r.Recorder, issuer, err.Error(), r.MaxConditionMessageLength))
 		}
 		if updateErr := r.Status().Update(ctx, issuer); updateErr != nil {
 			err = utilerrors.NewAggregate([]error{err, updateErr})
@@ -105,36 +230,79 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 	}()
 
 	if ready := issuerutil.GetReadyCondition(issuerStatus); ready == nil {
-		issuerutil.SetReadyCondition(issuerStatus, commandissuer.ConditionUnknown, issuerReadyConditionReason, "First seen")
+		issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionUnknown, issuerReadyConditionReason, "First seen")
 		return ctrl.Result{}, nil
 	}
 
-	authSecretName := types.NamespacedName{
-		Name: issuerSpec.SecretName,
+	// The settings of the profile are validated together with those of the issuer
+	issuerSpec, err = specWithProfile(ctx, r.Client, issuerSpec, profileNamespace(issuer, r.ClusterResourceNamespace))
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
-	switch issuer.(type) {
-	case *commandissuer.Issuer:
-		authSecretName.Namespace = req.Namespace
-	case *commandissuer.ClusterIssuer:
-		authSecretName.Namespace = r.ClusterResourceNamespace
-	default:
-		log.Error(fmt.Errorf("unexpected issuer type: %t", issuer), "Not retrying.")
+	if err := commandissuer.ValidateIssuerSpec(issuerSpec); err != nil {
+		log.Error(err, "Invalid issuer spec. Not retrying.")
+		issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionFalse, issuerReadyConditionReason, fmt.Sprintf("%v: %v", errInvalidIssuerSpec, err))
 		return ctrl.Result{}, nil
 	}
 
-	// If SecretAccessGrantedAtClusterLevel is false, we always look for the Secret in the same namespace as the Issuer
-	if !r.SecretAccessGrantedAtClusterLevel {
-		authSecretName.Namespace = r.ClusterResourceNamespace
+	secretNamespace, err := issuerutil.GetSecretNamespace(issuer, r.ClusterResourceNamespace, r.ClusterIssuerSecretNamespace, r.SecretAccessGrantedAtClusterLevel)
+	if err != nil {
+		log.Error(err, "Not retrying.")
+		return ctrl.Result{}, nil
 	}
 
-	// Set the context on the config client
-	r.ConfigClient.SetContext(ctx)
+	authSecretName := types.NamespacedName{
+		Name:      issuerSpec.SecretName,
+		Namespace: secretNamespace,
+	}
+
+	// Send a request ID to Command on every call so that its logs can be correlated with ours
+	if r.RequestIDHeader != "" {
+		var requestID string
+		ctx, requestID = signer.ContextWithRequestID(ctx, r.RequestIDHeader)
+		ctx = ctrl.LoggerInto(ctx, log.WithValues("requestID", requestID))
+	}
+	ctx = signer.ContextWithUserAgentSuffix(ctx, r.UserAgentSuffix)
+	ctx = signer.ContextWithTransportOptions(ctx, r.TransportOptions)
+	ctx = signer.ContextWithCircuitBreaker(ctx, r.CircuitBreaker)
+	ctx = signer.ContextWithRateLimiter(ctx, r.RateLimiter)
+	if r.Backpressure != nil {
+		ctx = signer.ContextWithLatencyObserver(ctx, r.Backpressure)
+	}
+	ctx, endpoints := signer.ContextWithEndpointRecorder(ctx)
+
+	if r.ConfigClient == nil {
+		log.Error(errConfigClientUnavailable, "Not retrying.")
+		issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionFalse, issuerReadyConditionReason, errConfigClientUnavailable.Error())
+		return ctrl.Result{}, nil
+	}
 
 	var authSecret corev1.Secret
-	if err := r.ConfigClient.GetSecret(authSecretName, &authSecret); err != nil {
+	if err := r.ConfigClient.GetSecret(ctx, authSecretName, &authSecret); err != nil {
 		return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, authSecretName, err)
 	}
+	if err := validateCredentialsSecret(&authSecret, "commandSecretName", issuerSpec); err != nil {
+		return r.failPermanently(ctx, issuer, issuerStatus, err), nil
+	}
+
+	// Health checks only read from Command, so they use the read credentials if the issuer has any
+	checkerSecretData := authSecret.Data
+	if issuerSpec.ReadSecretName != "" {
+		readSecretName := types.NamespacedName{
+			Name:      issuerSpec.ReadSecretName,
+			Namespace: authSecretName.Namespace,
+		}
+
+		var readSecret corev1.Secret
+		if err := r.ConfigClient.GetSecret(ctx, readSecretName, &readSecret); err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetReadSecret, readSecretName, err)
+		}
+		if err := validateCredentialsSecret(&readSecret, "commandReadSecretName", issuerSpec); err != nil {
+			return r.failPermanently(ctx, issuer, issuerStatus, err), nil
+		}
+		checkerSecretData = readSecret.Data
+	}
 
 	// Retrieve the CA certificate secret
 	caSecretName := types.NamespacedName{
@@ -145,23 +313,157 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 	var caSecret corev1.Secret
 	if issuerSpec.CaSecretName != "" {
 		// If the CA secret name is not specified, we will not attempt to retrieve it
-		err = r.ConfigClient.GetSecret(caSecretName, &caSecret)
+		err = r.ConfigClient.GetSecret(ctx, caSecretName, &caSecret)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetCaSecret, caSecretName, err)
 		}
+		if err := validateCASecret(&caSecret); err != nil {
+			return r.failPermanently(ctx, issuer, issuerStatus, err), nil
+		}
 	}
 
-	checker, err := r.HealthCheckerBuilder(ctx, issuerSpec, authSecret.Data, caSecret.Data)
+	issuerSpec, err = specWithConfigMapHostname(ctx, r.ConfigClient, issuerSpec, secretNamespace)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w: %v", errHealthCheckerBuilder, err)
+		return ctrl.Result{}, err
+	}
+
+	if forceRecheck {
+		// An invalid hostname is reported by the health checker builder
+		if hostname, err := signer.CommandHostname(issuerSpec, checkerSecretData); err == nil {
+			r.clearCachedState(hostname)
+		}
+		for _, hostname := range issuerSpec.FallbackHostnames {
+			r.clearCachedState(hostname)
+		}
 	}
 
-	if err := checker.Check(); err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w: %v", errHealthCheckerCheck, err)
+	// The health checker logs under its own name, so that its verbosity can be configured separately
+	checkCtx := ctrl.LoggerInto(ctx, log.WithName(HealthCheckLoggerName))
+	checker, err := r.HealthCheckerBuilder(checkCtx, specWithInsecureSkipVerify(issuerSpec, r.CommandInsecureSkipVerify), checkerSecretData, caSecret.Data)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errHealthCheckerBuilder, err)
+		if errors.Is(err, signer.ErrInvalidConfig) {
+			return r.failPermanently(ctx, issuer, issuerStatus, err), nil
+		}
+		return ctrl.Result{}, err
 	}
 
-	issuerutil.SetReadyCondition(issuerStatus, commandissuer.ConditionTrue, issuerReadyConditionReason, "Success")
-	return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+	err = checker.Check(checkCtx)
+	r.IssuerStatusHandler.RecordHealthCheck(issuer, err)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errHealthCheckerCheck, err)
+		if errors.Is(err, signer.ErrAuthenticationFailed) || errors.Is(err, signer.ErrInvalidConfig) {
+			return r.failPermanently(ctx, issuer, issuerStatus, err), nil
+		}
+		if r.RetryInterval <= 0 {
+			return ctrl.Result{}, err
+		}
+
+		// Requeue after the configured interval rather than backing off so that a temporarily
+		// unavailable Command instance isn't checked too often, and the recovery time is predictable
+		retryInterval := r.Backpressure.Requeue(r.jitter(r.RetryInterval))
+		nextRetry := r.Clock.Now().Add(retryInterval)
+		log.Error(err, "Health check failed", "nextRetry", nextRetry)
+		issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionFalse, issuerReadyConditionReason, fmt.Sprintf("%s. Retrying at %s", conditionMessage(r.Recorder, issuer, err.Error(), r.MaxConditionMessageLength), nextRetry.UTC().Format(time.RFC3339)))
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
+	}
+
+	// The hostname was validated when the health checker was built
+	hostname, _ := signer.CommandHostname(issuerSpec, checkerSecretData)
+
+	// The last known version is kept if the version can't be determined
+	if version := r.commandVersion(checkCtx, hostname, checker); version != "" {
+		issuerStatus.CommandVersion = version
+	}
+
+	if endpoint, failedOver := endpoints.Endpoint(); failedOver {
+		message := fmt.Sprintf("Health check was served by the fallback Command endpoint %s because the preferred endpoints failed", endpoint)
+		log.Info(fmt.Sprintf("WARNING: %s", message))
+		if r.Recorder != nil {
+			r.Recorder.Event(issuer, corev1.EventTypeWarning, reasonCommandFailover, message)
+		}
+		issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionTrue, issuerReadyConditionReason, fmt.Sprintf("Success, using the fallback Command endpoint %s", endpoint))
+		return ctrl.Result{RequeueAfter: r.Backpressure.Requeue(r.jitter(defaultHealthCheckInterval))}, nil
+	}
+
+	issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionTrue, issuerReadyConditionReason, "Success")
+	return ctrl.Result{RequeueAfter: r.Backpressure.Requeue(r.jitter(defaultHealthCheckInterval))}, nil
+}
+
+// failPermanently marks the issuer not ready because of an error that retrying won't resolve, such as
+// rejected credentials. The issuer is still checked again after the regular health check interval
+// rather than backing off, because changes to its Secrets don't trigger a reconcile.
+func (r *IssuerReconciler) failPermanently(ctx context.Context, issuer client.Object, issuerStatus *commandissuer.IssuerStatus, err error) ctrl.Result {
+	retryInterval := r.jitter(defaultHealthCheckInterval)
+	ctrl.LoggerFrom(ctx).Error(err, "Issuer configuration or credentials are invalid", "nextCheck", r.Clock.Now().Add(retryInterval))
+	issuerutil.SetReadyCondition(issuerStatus, issuer.GetGeneration(), commandissuer.ConditionFalse, issuerReadyConditionReason, conditionMessage(r.Recorder, issuer, err.Error(), r.MaxConditionMessageLength))
+	return ctrl.Result{RequeueAfter: retryInterval}
+}
+
+// jitter returns interval randomized by up to HealthCheckJitter in either direction. The average
+// interval is unchanged, so the overall frequency of health checks stays the same.
+func (r *IssuerReconciler) jitter(interval time.Duration) time.Duration {
+	if r.HealthCheckJitter <= 0 {
+		return interval
+	}
+
+	random := r.random
+	if random == nil {
+		random = rand.Float64
+	}
+
+	return interval + time.Duration((2*random()-1)*r.HealthCheckJitter*float64(interval))
+}
+
+// commandVersion returns the version of the Command instance at hostname. The version is cached
+// for commandVersionCacheTTL, including failures, so that Command isn't queried on every reconcile.
+// If the version can't be determined, an empty string is returned and the issuer remains ready.
+func (r *IssuerReconciler) commandVersion(ctx context.Context, hostname string, checker signer.HealthChecker) string {
+	log := ctrl.LoggerFrom(ctx)
+
+	r.commandVersions.mu.Lock()
+	defer r.commandVersions.mu.Unlock()
+
+	now := r.Clock.Now()
+	if entry, ok := r.commandVersions.entries[hostname]; ok && now.Sub(entry.checkedAt) < commandVersionCacheTTL {
+		return entry.version
+	}
+
+	version, err := checker.CommandVersion(ctx)
+	if err != nil {
+		log.Info(fmt.Sprintf("Unable to determine the Command version, not retrying for %s: %v", commandVersionCacheTTL, err))
+	}
+
+	if r.commandVersions.entries == nil {
+		r.commandVersions.entries = make(map[string]commandVersionEntry)
+	}
+	r.commandVersions.entries[hostname] = commandVersionEntry{version: version, checkedAt: now}
+
+	return version
+}
+
+// clearCachedState clears the state cached for the Command instance at hostname, so that a forced
+// health check and the following requests don't rely on state from before e.g. an outage was fixed
+func (r *IssuerReconciler) clearCachedState(hostname string) {
+	r.commandVersions.mu.Lock()
+	delete(r.commandVersions.entries, hostname)
+	r.commandVersions.mu.Unlock()
+
+	r.CircuitBreaker.Reset(hostname)
+	r.SchemaCache.Forget(hostname)
+	r.CAChainCache.Forget(hostname)
+}
+
+// specWithInsecureSkipVerify returns the issuer spec, or a copy of it that disables verification of
+// Command's server certificate if the controller was started with --command-insecure-skip-verify
+func specWithInsecureSkipVerify(spec *commandissuer.IssuerSpec, insecureSkipVerify bool) *commandissuer.IssuerSpec {
+	if !insecureSkipVerify || spec.InsecureSkipVerify {
+		return spec
+	}
+
+	spec = spec.DeepCopy()
+	spec.InsecureSkipVerify = true
+	return spec
 }
 
 // SetupWithManager registers the IssuerReconciler with the controller manager.
@@ -173,5 +475,45 @@ func (r *IssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(issuerType).
+		Watches(&commandissuer.CommandIssuerProfile{}, handler.EnqueueRequestsFromMapFunc(r.issuersForProfile)).
 		Complete(r)
 }
+
+// issuersForProfile returns a reconcile request for every issuer of the kind of the reconciler that
+// references the CommandIssuerProfile, so that a changed profile is validated and health checked
+func (r *IssuerReconciler) issuersForProfile(ctx context.Context, profile client.Object) []reconcile.Request {
+	log := ctrl.LoggerFrom(ctx)
+
+	var issuers []client.Object
+	switch r.Kind {
+	case "Issuer":
+		var list commandissuer.IssuerList
+		if err := r.List(ctx, &list, client.InNamespace(profile.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list the Issuers referencing the CommandIssuerProfile", "profile", client.ObjectKeyFromObject(profile))
+			return nil
+		}
+		for i := range list.Items {
+			issuers = append(issuers, &list.Items[i])
+		}
+	case "ClusterIssuer":
+		if profile.GetNamespace() != r.ClusterResourceNamespace {
+			return nil
+		}
+		var list commandissuer.ClusterIssuerList
+		if err := r.List(ctx, &list); err != nil {
+			log.Error(err, "Failed to list the ClusterIssuers referencing the CommandIssuerProfile", "profile", client.ObjectKeyFromObject(profile))
+			return nil
+		}
+		for i := range list.Items {
+			issuers = append(issuers, &list.Items[i])
+		}
+	}
+
+	var requests []reconcile.Request
+	for _, issuer := range issuers {
+		if spec, _, err := issuerutil.GetSpecAndStatus(issuer); err == nil && spec.ProfileName == profile.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(issuer)})
+		}
+	}
+	return requests
+}
@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
 	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
 	logrtesting "github.com/go-logr/logr/testr"
@@ -28,23 +29,35 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"testing"
+	"time"
 
 	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
 )
 
+// fakeCredentials are the data of a valid Secret with Command credentials
+var fakeCredentials = map[string][]byte{"username": []byte("username"), "password": []byte("password")}
+
 type fakeHealthChecker struct {
-	errCheck error
+	errCheck          error
+	commandVersion    string
+	errCommandVersion error
 }
 
-func (o *fakeHealthChecker) Check() error {
+func (o *fakeHealthChecker) Check(context.Context) error {
 	return o.errCheck
 }
 
+func (o *fakeHealthChecker) CommandVersion(context.Context) (string, error) {
+	return o.commandVersion, o.errCommandVersion
+}
+
 func TestIssuerReconcile(t *testing.T) {
 	type testCase struct {
 		kind                         string
@@ -52,9 +65,14 @@ func TestIssuerReconcile(t *testing.T) {
 		objects                      []client.Object
 		healthCheckerBuilder         signer.HealthCheckerBuilder
 		clusterResourceNamespace     string
+		clusterIssuerSecretNamespace string
+		retryInterval                time.Duration
 		expectedResult               ctrl.Result
 		expectedError                error
 		expectedReadyConditionStatus commandissuer.ConditionStatus
+		expectedReadyConditionMsg    string
+		expectedCommandVersion       string
+		noConfigClient               bool
 	}
 
 	tests := map[string]testCase{
@@ -64,11 +82,439 @@ func TestIssuerReconcile(t *testing.T) {
 			objects: []client.Object{
 				&commandissuer.Issuer{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "issuer1",
-						Namespace: "ns1",
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return &fakeHealthChecker{commandVersion: "11.0.0"}, nil
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedCommandVersion:       "11.0.0",
+		},
+		"success-issuer-read-credentials": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:     "issuer1-credentials",
+						ReadSecretName: "issuer1-read-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{"username": []byte("enroller"), "password": []byte("password")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-read-credentials",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{"username": []byte("reader"), "password": []byte("password")},
+				},
+			},
+			healthCheckerBuilder: func(_ context.Context, _ *commandissuer.IssuerSpec, authSecretData map[string][]byte, _ map[string][]byte) (signer.HealthChecker, error) {
+				if username := string(authSecretData["username"]); username != "reader" {
+					return nil, fmt.Errorf("expected the read credentials, got %q", username)
+				}
+				return &fakeHealthChecker{commandVersion: "11.0.0"}, nil
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedCommandVersion:       "11.0.0",
+		},
+		"success-issuer-profile": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:  "issuer1-credentials",
+						ProfileName: "profile1",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&commandissuer.CommandIssuerProfile{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "profile1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.CommandIssuerProfileSpec{
+						CertificateCollection: "Kubernetes Certificates",
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(_ context.Context, spec *commandissuer.IssuerSpec, _ map[string][]byte, _ map[string][]byte) (signer.HealthChecker, error) {
+				if spec.CertificateCollection != "Kubernetes Certificates" {
+					return nil, fmt.Errorf("expected the certificate collection of the profile, got %q", spec.CertificateCollection)
+				}
+				return &fakeHealthChecker{commandVersion: "11.0.0"}, nil
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedCommandVersion:       "11.0.0",
+		},
+		"issuer-profile-not-found": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:  "issuer1-credentials",
+						ProfileName: "profile1",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+			},
+			expectedError:                errGetProfile,
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+		},
+		"issuer-read-secret-not-found": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:     "issuer1-credentials",
+						ReadSecretName: "issuer1-read-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			expectedError:                errGetReadSecret,
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+		},
+		"success-issuer-hostname-configmap": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:            "issuer1-credentials",
+						Hostname:              "fallback.example.com",
+						HostnameConfigMapName: "command-hostname",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "command-hostname",
+						Namespace: "ns1",
+					},
+					Data: map[string]string{"hostname": "command.example.com"},
+				},
+			},
+			healthCheckerBuilder: func(_ context.Context, spec *commandissuer.IssuerSpec, _ map[string][]byte, _ map[string][]byte) (signer.HealthChecker, error) {
+				if spec.Hostname != "command.example.com" {
+					return nil, fmt.Errorf("expected the hostname command.example.com, got %q", spec.Hostname)
+				}
+				return &fakeHealthChecker{commandVersion: "11.0.0"}, nil
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedCommandVersion:       "11.0.0",
+		},
+		"success-issuer-hostname-configmap-fallback": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:            "issuer1-credentials",
+						Hostname:              "fallback.example.com",
+						HostnameKey:           "host",
+						HostnameConfigMapName: "command-hostname",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "command-hostname",
+						Namespace: "ns1",
+					},
+					Data: map[string]string{"hostname": "command.example.com"},
+				},
+			},
+			healthCheckerBuilder: func(_ context.Context, spec *commandissuer.IssuerSpec, _ map[string][]byte, _ map[string][]byte) (signer.HealthChecker, error) {
+				if spec.Hostname != "fallback.example.com" {
+					return nil, fmt.Errorf("expected the hostname fallback.example.com, got %q", spec.Hostname)
+				}
+				return &fakeHealthChecker{commandVersion: "11.0.0"}, nil
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedCommandVersion:       "11.0.0",
+		},
+		"issuer-hostname-configmap-not-found": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:            "issuer1-credentials",
+						HostnameConfigMapName: "command-hostname",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			expectedError:                errGetHostnameConfigMap,
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+		},
+		"success-issuer-unknown-command-version": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						CommandVersion: "10.4.0",
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return &fakeHealthChecker{errCommandVersion: errors.New("simulated license error")}, nil
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedCommandVersion:       "10.4.0",
+		},
+		"success-clusterissuer": {
+			kind: "ClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&commandissuer.ClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "clusterissuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return &fakeHealthChecker{}, nil
+			},
+			clusterResourceNamespace:     "kube-system",
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+		},
+		"success-clusterissuer-secret-namespace": {
+			kind: "ClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&commandissuer.ClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:      "clusterissuer1-credentials",
+						SecretNamespace: "ns2",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "ns2",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return &fakeHealthChecker{}, nil
+			},
+			clusterResourceNamespace:     "kube-system",
+			expectedReadyConditionStatus: commandissuer.ConditionTrue,
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+		},
+		"success-clusterissuer-flag-secret-namespace": {
+			kind: "ClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&commandissuer.ClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
 					},
 					Spec: commandissuer.IssuerSpec{
-						SecretName: "issuer1-credentials",
+						SecretName: "clusterissuer1-credentials",
 					},
 					Status: commandissuer.IssuerStatus{
 						Conditions: []commandissuer.IssuerCondition{
@@ -81,18 +527,21 @@ func TestIssuerReconcile(t *testing.T) {
 				},
 				&corev1.Secret{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "issuer1-credentials",
-						Namespace: "ns1",
+						Name:      "clusterissuer1-credentials",
+						Namespace: "issuer-secrets",
 					},
+					Data: fakeCredentials,
 				},
 			},
 			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
 				return &fakeHealthChecker{}, nil
 			},
+			clusterResourceNamespace:     "kube-system",
+			clusterIssuerSecretNamespace: "issuer-secrets",
 			expectedReadyConditionStatus: commandissuer.ConditionTrue,
 			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
 		},
-		"success-clusterissuer": {
+		"success-clusterissuer-secret-namespace-overrides-flag": {
 			kind: "ClusterIssuer",
 			name: types.NamespacedName{Name: "clusterissuer1"},
 			objects: []client.Object{
@@ -101,7 +550,8 @@ func TestIssuerReconcile(t *testing.T) {
 						Name: "clusterissuer1",
 					},
 					Spec: commandissuer.IssuerSpec{
-						SecretName: "clusterissuer1-credentials",
+						SecretName:      "clusterissuer1-credentials",
+						SecretNamespace: "ns2",
 					},
 					Status: commandissuer.IssuerStatus{
 						Conditions: []commandissuer.IssuerCondition{
@@ -115,14 +565,16 @@ func TestIssuerReconcile(t *testing.T) {
 				&corev1.Secret{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "clusterissuer1-credentials",
-						Namespace: "kube-system",
+						Namespace: "ns2",
 					},
+					Data: fakeCredentials,
 				},
 			},
 			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
 				return &fakeHealthChecker{}, nil
 			},
 			clusterResourceNamespace:     "kube-system",
+			clusterIssuerSecretNamespace: "issuer-secrets",
 			expectedReadyConditionStatus: commandissuer.ConditionTrue,
 			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
 		},
@@ -169,6 +621,55 @@ func TestIssuerReconcile(t *testing.T) {
 			expectedError:                errGetAuthSecret,
 			expectedReadyConditionStatus: commandissuer.ConditionFalse,
 		},
+		"issuer-invalid-subject-pattern": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:     "issuer1-credentials",
+						SubjectPattern: "^(unterminated",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+		},
+		"issuer-reserved-enrollment-parameter": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName:           "issuer1-credentials",
+						EnrollmentParameters: map[string]string{"Template": "other-template"},
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+			},
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+			expectedReadyConditionMsg:    "spec.enrollmentParameters[Template]",
+		},
 		"issuer-failing-healthchecker-builder": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
 			objects: []client.Object{
@@ -194,6 +695,7 @@ func TestIssuerReconcile(t *testing.T) {
 						Name:      "issuer1-credentials",
 						Namespace: "ns1",
 					},
+					Data: fakeCredentials,
 				},
 			},
 			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
@@ -202,6 +704,69 @@ func TestIssuerReconcile(t *testing.T) {
 			expectedError:                errHealthCheckerBuilder,
 			expectedReadyConditionStatus: commandissuer.ConditionFalse,
 		},
+		"issuer-tls-secret": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Type: corev1.SecretTypeTLS,
+					Data: map[string][]byte{"tls.crt": []byte("certificate"), "tls.key": []byte("key")},
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return nil, errors.New("the health checker must not be built with an invalid Secret")
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+			expectedReadyConditionMsg:    `invalid Secret: commandSecretName references Secret ns1/issuer1-credentials of type "kubernetes.io/tls", which can't hold Command credentials. Reference a Secret of type "kubernetes.io/basic-auth" or "Opaque" with the Command username and password instead`,
+		},
+		"issuer-no-config-client": {
+			kind: "Issuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+			},
+			noConfigClient:               true,
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+			expectedReadyConditionMsg:    errConfigClientUnavailable.Error(),
+		},
 		"issuer-failing-healthchecker-check": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
 			objects: []client.Object{
@@ -227,6 +792,7 @@ func TestIssuerReconcile(t *testing.T) {
 						Name:      "issuer1-credentials",
 						Namespace: "ns1",
 					},
+					Data: fakeCredentials,
 				},
 			},
 			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
@@ -235,29 +801,143 @@ func TestIssuerReconcile(t *testing.T) {
 			expectedError:                errHealthCheckerCheck,
 			expectedReadyConditionStatus: commandissuer.ConditionFalse,
 		},
+		"issuer-healthchecker-builder-invalid-config": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return nil, fmt.Errorf("%w: simulated missing credentials", signer.ErrInvalidConfig)
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+		},
+		"issuer-healthchecker-check-authentication-failed": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return &fakeHealthChecker{errCheck: fmt.Errorf("%w: simulated unauthorized response", signer.ErrAuthenticationFailed)}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+		},
+		"issuer-failing-healthchecker-check-retry-interval": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: commandissuer.IssuerSpec{
+						SecretName: "issuer1-credentials",
+					},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{
+								Type:   commandissuer.IssuerConditionReady,
+								Status: commandissuer.ConditionUnknown,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: fakeCredentials,
+				},
+			},
+			healthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+				return &fakeHealthChecker{errCheck: errors.New("simulated health check error")}, nil
+			},
+			retryInterval:                30 * time.Second,
+			expectedResult:               ctrl.Result{RequeueAfter: 30 * time.Second},
+			expectedReadyConditionStatus: commandissuer.ConditionFalse,
+			expectedReadyConditionMsg:    "Retrying at 2024-01-01T00:00:30Z",
+		},
 	}
 
 	scheme := runtime.NewScheme()
 	require.NoError(t, commandissuer.AddToScheme(scheme))
 	require.NoError(t, corev1.AddToScheme(scheme))
 
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			fakeClient := fake.NewClientBuilder().
 				WithScheme(scheme).
 				WithObjects(tc.objects...).
+				WithStatusSubresource(&commandissuer.Issuer{}, &commandissuer.ClusterIssuer{}).
 				Build()
 			if tc.kind == "" {
 				tc.kind = "Issuer"
 			}
+			var configClient issuerutil.ConfigClient = NewFakeConfigClient(fakeClient)
+			if tc.noConfigClient {
+				configClient = nil
+			}
 			controller := IssuerReconciler{
 				Kind:                              tc.kind,
 				Client:                            fakeClient,
-				ConfigClient:                      NewFakeConfigClient(fakeClient),
+				ConfigClient:                      configClient,
 				Scheme:                            scheme,
 				HealthCheckerBuilder:              tc.healthCheckerBuilder,
 				ClusterResourceNamespace:          tc.clusterResourceNamespace,
+				ClusterIssuerSecretNamespace:      tc.clusterIssuerSecretNamespace,
 				SecretAccessGrantedAtClusterLevel: true,
+				RetryInterval:                     tc.retryInterval,
+				Clock:                             fakeClock,
 			}
 			result, err := controller.Reconcile(
 				ctrl.LoggerInto(context.TODO(), logrtesting.New(t)),
@@ -278,11 +958,202 @@ func TestIssuerReconcile(t *testing.T) {
 				_, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
 				require.NoError(t, err)
 				assertIssuerHasReadyCondition(t, tc.expectedReadyConditionStatus, issuerStatus)
+				if tc.expectedReadyConditionMsg != "" {
+					assert.Contains(t, issuerutil.GetReadyCondition(issuerStatus).Message, tc.expectedReadyConditionMsg)
+				}
+				assert.Equal(t, tc.expectedCommandVersion, issuerStatus.CommandVersion, "unexpected Command version")
+			}
+		})
+	}
+}
+
+func TestIssuerCommandVersionCache(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	controller := IssuerReconciler{Clock: fakeClock}
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+
+	checker := &countingHealthChecker{fakeHealthChecker: fakeHealthChecker{errCommandVersion: errors.New("simulated license error")}}
+	assert.Equal(t, "", controller.commandVersion(ctx, "command.example.com", checker))
+	assert.Equal(t, 1, checker.calls)
+
+	// Failures are cached too, so Command isn't queried on every reconcile
+	checker.errCommandVersion = nil
+	checker.commandVersion = "11.0.0"
+	assert.Equal(t, "", controller.commandVersion(ctx, "command.example.com", checker))
+	assert.Equal(t, 1, checker.calls)
+
+	// Versions are cached per Command instance
+	assert.Equal(t, "11.0.0", controller.commandVersion(ctx, "other.example.com", checker))
+	assert.Equal(t, 2, checker.calls)
+
+	fakeClock.Step(commandVersionCacheTTL)
+	assert.Equal(t, "11.0.0", controller.commandVersion(ctx, "command.example.com", checker))
+	assert.Equal(t, 3, checker.calls)
+}
+
+func TestIssuerForceRecheck(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	name := types.NamespacedName{Namespace: "ns1", Name: "issuer1"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+				Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", SecretName: "issuer1-credentials"},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionUnknown}},
+				},
+			},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: name.Namespace}, Data: fakeCredentials},
+		).
+		WithStatusSubresource(&commandissuer.Issuer{}).
+		Build()
+
+	checker := &countingHealthChecker{fakeHealthChecker: fakeHealthChecker{commandVersion: "11.0.0"}}
+	recorder := record.NewFakeRecorder(10)
+	controller := IssuerReconciler{
+		Kind:         "Issuer",
+		Client:       fakeClient,
+		ConfigClient: NewFakeConfigClient(fakeClient),
+		Scheme:       scheme,
+		HealthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+			return checker, nil
+		},
+		SecretAccessGrantedAtClusterLevel: true,
+		Clock:                             clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Recorder:                          recorder,
+	}
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+	reconcileIssuer := func() {
+		_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+		require.NoError(t, err)
+	}
+	setAnnotation := func(value string) {
+		var issuer commandissuer.Issuer
+		require.NoError(t, fakeClient.Get(ctx, name, &issuer))
+		issuer.SetAnnotations(map[string]string{forceRecheckAnnotation: value})
+		require.NoError(t, fakeClient.Update(ctx, &issuer))
+	}
+
+	// An issuer that is already annotated when it is first seen isn't rechecked
+	setAnnotation("2024-01-01T00:00:00Z")
+	reconcileIssuer()
+	reconcileIssuer()
+	assert.Equal(t, 1, checker.calls)
+	assert.Empty(t, recorder.Events)
+
+	// Changing the annotation clears the cached Command version and records an Event
+	setAnnotation("2024-01-01T01:00:00Z")
+	reconcileIssuer()
+	assert.Equal(t, 2, checker.calls)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, reasonForcedRecheck)
+
+	reconcileIssuer()
+	assert.Equal(t, 2, checker.calls)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestIssuerObservedGeneration(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	name := types.NamespacedName{Namespace: "ns1", Name: "issuer1"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&commandissuer.Issuer{
+				ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace, Generation: 1},
+				Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", SecretName: "issuer1-credentials"},
+				Status: commandissuer.IssuerStatus{
+					Conditions: []commandissuer.IssuerCondition{{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionUnknown}},
+				},
+			},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: name.Namespace}, Data: fakeCredentials},
+		).
+		WithStatusSubresource(&commandissuer.Issuer{}).
+		Build()
+
+	controller := IssuerReconciler{
+		Kind:         "Issuer",
+		Client:       fakeClient,
+		ConfigClient: NewFakeConfigClient(fakeClient),
+		Scheme:       scheme,
+		HealthCheckerBuilder: func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+			return &fakeHealthChecker{}, nil
+		},
+		SecretAccessGrantedAtClusterLevel: true,
+		Clock:                             clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+	getIssuer := func() *commandissuer.Issuer {
+		var issuer commandissuer.Issuer
+		require.NoError(t, fakeClient.Get(ctx, name, &issuer))
+		return &issuer
+	}
+
+	_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+	require.NoError(t, err)
+	issuer := getIssuer()
+	assert.Equal(t, int64(1), issuerutil.GetReadyCondition(&issuer.Status).ObservedGeneration)
+	assert.True(t, issuerutil.IsReady(&issuer.Status, issuer.Generation))
+
+	// The API server increments the generation when the spec changes, which the fake client doesn't
+	issuer.Spec.Hostname = "command2.example.com"
+	issuer.Generation = 2
+	require.NoError(t, fakeClient.Update(ctx, issuer))
+
+	// The Ready condition of the previous spec is kept until the issuer is checked again
+	issuer = getIssuer()
+	assert.Equal(t, commandissuer.ConditionTrue, issuerutil.GetReadyCondition(&issuer.Status).Status)
+	assert.False(t, issuerutil.IsReady(&issuer.Status, issuer.Generation))
+
+	_, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+	require.NoError(t, err)
+	issuer = getIssuer()
+	assert.Equal(t, int64(2), issuerutil.GetReadyCondition(&issuer.Status).ObservedGeneration)
+	assert.True(t, issuerutil.IsReady(&issuer.Status, issuer.Generation))
+}
+
+func TestIssuerHealthCheckJitter(t *testing.T) {
+	tests := map[string]struct {
+		jitter   float64
+		random   float64
+		expected time.Duration
+	}{
+		"disabled":       {jitter: 0, random: 0, expected: time.Minute},
+		"shortest":       {jitter: 0.1, random: 0, expected: 54 * time.Second},
+		"average":        {jitter: 0.1, random: 0.5, expected: time.Minute},
+		"longest":        {jitter: 0.1, random: 0.99, expected: 65*time.Second + 880*time.Millisecond},
+		"large-fraction": {jitter: 0.5, random: 0.25, expected: 45 * time.Second},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			controller := IssuerReconciler{
+				HealthCheckJitter: tc.jitter,
+				random:            func() float64 { return tc.random },
 			}
+			assert.Equal(t, tc.expected, controller.jitter(time.Minute))
 		})
 	}
 }
 
+// countingHealthChecker counts the calls to CommandVersion
+type countingHealthChecker struct {
+	fakeHealthChecker
+	calls int
+}
+
+func (o *countingHealthChecker) CommandVersion(ctx context.Context) (string, error) {
+	o.calls++
+	return o.fakeHealthChecker.CommandVersion(ctx)
+}
+
 func assertIssuerHasReadyCondition(t *testing.T, status commandissuer.ConditionStatus, issuerStatus *commandissuer.IssuerStatus) {
 	condition := issuerutil.GetReadyCondition(issuerStatus)
 	if !assert.NotNil(t, condition, "Ready condition not found") {
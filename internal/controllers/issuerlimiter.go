@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultIssuerConcurrencyRetryInterval is how long a request that exceeds the concurrency limit of
+// its issuer waits before it is retried
+const defaultIssuerConcurrencyRetryInterval = 5 * time.Second
+
+// enrollmentLimitError is returned by the signers of an IssuerLimiter when the issuer exhausted its
+// enrollment limits, so Command wasn't called
+type enrollmentLimitError struct {
+	issuer string
+	// limit describes the exhausted limit
+	limit      string
+	retryAfter time.Duration
+	failFast   bool
+}
+
+func (e *enrollmentLimitError) Error() string {
+	if e.failFast {
+		return fmt.Sprintf("%s exceeded its %s", e.issuer, e.limit)
+	}
+	return fmt.Sprintf("%s exceeded its %s, retrying in %s", e.issuer, e.limit, e.retryAfter.Round(time.Second))
+}
+
+// IssuerLimiter enforces the enrollment limits of each issuer, so that a burst of requests of one
+// issuer can't monopolize the capacity of Command. An IssuerLimiter is shared by all reconcilers,
+// so that the limits apply to CertificateRequests and CertificateSigningRequests alike.
+type IssuerLimiter struct {
+	clock clock.PassiveClock
+
+	mu      sync.Mutex
+	issuers map[issuerKey]*issuerLimit
+}
+
+// issuerLimit is the state of the enrollment limits of a single issuer
+type issuerLimit struct {
+	// limiter is nil if the rate of the issuer isn't limited
+	limiter  *rate.Limiter
+	inFlight int
+}
+
+// NewIssuerLimiter returns an IssuerLimiter that measures rates with clock
+func NewIssuerLimiter(clock clock.PassiveClock) *IssuerLimiter {
+	return &IssuerLimiter{
+		clock:   clock,
+		issuers: make(map[issuerKey]*issuerLimit),
+	}
+}
+
+// Signer returns a Signer that calls s within the enrollment limits of the issuer. If the limiter
+// is nil or the issuer has no limits, s is returned.
+func (l *IssuerLimiter) Signer(s signer.Signer, issuer client.Object, limits *commandissuer.EnrollmentLimits) signer.Signer {
+	if l == nil || limits == nil || (limits.RequestsPerMinute <= 0 && limits.MaxConcurrentEnrollments <= 0) {
+		return s
+	}
+	return &limitedSigner{Signer: s, limiter: l, issuer: issuer, limits: *limits}
+}
+
+// acquire reserves a call to Command by the issuer. It returns a function that releases the call
+// once it completes, or an *enrollmentLimitError if the issuer exhausted its limits.
+func (l *IssuerLimiter) acquire(issuer client.Object, limits commandissuer.EnrollmentLimits) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := issuerKey{kind: issuerKind(issuer), namespace: issuer.GetNamespace(), name: issuer.GetName()}
+	state, ok := l.issuers[key]
+	if !ok {
+		state = &issuerLimit{}
+		l.issuers[key] = state
+	}
+
+	failFast := limits.WhenExceeded == commandissuer.EnrollmentLimitPolicyFailFast
+	name := key.kind + " " + key.name
+	if key.namespace != "" {
+		name = key.kind + " " + key.namespace + "/" + key.name
+	}
+
+	if limits.MaxConcurrentEnrollments > 0 && state.inFlight >= int(limits.MaxConcurrentEnrollments) {
+		return nil, &enrollmentLimitError{
+			issuer:     name,
+			limit:      fmt.Sprintf("limit of %d concurrent enrollments", limits.MaxConcurrentEnrollments),
+			retryAfter: defaultIssuerConcurrencyRetryInterval,
+			failFast:   failFast,
+		}
+	}
+
+	if limits.RequestsPerMinute > 0 {
+		now := l.clock.Now()
+		limit := rate.Limit(float64(limits.RequestsPerMinute) / 60)
+		burst := max(int(limits.Burst), 1)
+		// The limits of the issuer may have been edited since the limiter was created
+		if state.limiter == nil {
+			state.limiter = rate.NewLimiter(limit, burst)
+		} else {
+			state.limiter.SetLimitAt(now, limit)
+			state.limiter.SetBurstAt(now, burst)
+		}
+
+		reservation := state.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			return nil, &enrollmentLimitError{
+				issuer:     name,
+				limit:      fmt.Sprintf("limit of %d enrollments per minute", limits.RequestsPerMinute),
+				retryAfter: delay,
+				failFast:   failFast,
+			}
+		}
+	} else {
+		state.limiter = nil
+	}
+
+	state.inFlight++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		state.inFlight--
+	}, nil
+}
+
+// Forget discards the state of the enrollment limits of an issuer, e.g. because it was deleted. If the
+// issuer is recreated, its limits start over.
+func (l *IssuerLimiter) Forget(kind string, issuer types.NamespacedName) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.issuers, issuerKey{kind: kind, namespace: issuer.Namespace, name: issuer.Name})
+}
+
+// limitedSigner is a Signer whose calls to Command are limited by the enrollment limits of its issuer.
+// The limits are enforced by the enrollment gate of the signer, so requests it rejects by policy
+// don't count against them.
+type limitedSigner struct {
+	signer.Signer
+	limiter *IssuerLimiter
+	issuer  client.Object
+	limits  commandissuer.EnrollmentLimits
+}
+
+func (s *limitedSigner) Sign(ctx context.Context, csr []byte, meta signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	return s.Signer.Sign(signer.ContextWithEnrollmentGate(ctx, s.acquire), csr, meta)
+}
+
+func (s *limitedSigner) PollEnrollment(ctx context.Context, csr []byte, requestID int32, meta signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	return s.Signer.PollEnrollment(signer.ContextWithEnrollmentGate(ctx, s.acquire), csr, requestID, meta)
+}
+
+// acquire is the enrollment gate of the signer
+func (s *limitedSigner) acquire() (func(), error) {
+	return s.limiter.acquire(s.issuer, s.limits)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// blockingSigner is a Signer whose calls to Command block until release is closed. Its calls with a
+// nil CSR are rejected before calling Command.
+type blockingSigner struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSigner) Sign(ctx context.Context, csr []byte, _ signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	if csr == nil {
+		return nil, nil, 0, errors.New("CSR rejected")
+	}
+	release, err := signer.EnterEnrollmentGate(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	s.started <- struct{}{}
+	<-s.release
+	return nil, nil, 1, nil
+}
+
+func (s *blockingSigner) PollEnrollment(ctx context.Context, _ []byte, _ int32, _ signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	return s.Sign(ctx, []byte("csr"), signer.K8sMetadata{})
+}
+
+func TestIssuerLimiterConcurrency(t *testing.T) {
+	limiter := NewIssuerLimiter(clocktesting.NewFakePassiveClock(time.Now()))
+	issuer := &commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "issuer1"}}
+	otherIssuer := &commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "issuer1"}}
+	limits := &commandissuer.EnrollmentLimits{MaxConcurrentEnrollments: 1}
+
+	s := &blockingSigner{started: make(chan struct{}, 2), release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		_, _, _, err := limiter.Signer(s, issuer, limits).Sign(context.TODO(), []byte("csr"), signer.K8sMetadata{})
+		done <- err
+	}()
+	<-s.started
+
+	// A second call of the issuer exceeds its concurrency limit and is queued
+	_, _, _, err := limiter.Signer(s, issuer, limits).PollEnrollment(context.TODO(), []byte("csr"), 1, signer.K8sMetadata{})
+	var limitErr *enrollmentLimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.False(t, limitErr.failFast)
+	assert.Equal(t, defaultIssuerConcurrencyRetryInterval, limitErr.retryAfter)
+	assert.ErrorContains(t, err, "Issuer ns1/issuer1 exceeded its limit of 1 concurrent enrollments")
+
+	// Another issuer has its own limit
+	go func() {
+		_, _, _, err := limiter.Signer(s, otherIssuer, limits).Sign(context.TODO(), []byte("csr"), signer.K8sMetadata{})
+		done <- err
+	}()
+	<-s.started
+
+	close(s.release)
+	require.NoError(t, <-done)
+	require.NoError(t, <-done)
+
+	// Once the call completes, the issuer can call Command again
+	_, _, _, err = limiter.Signer(s, issuer, limits).Sign(context.TODO(), []byte("csr"), signer.K8sMetadata{})
+	assert.NoError(t, err)
+}
+
+func TestIssuerLimiterRate(t *testing.T) {
+	clock := clocktesting.NewFakePassiveClock(time.Now())
+	limiter := NewIssuerLimiter(clock)
+	issuer := &commandissuer.ClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer1"}}
+	limits := &commandissuer.EnrollmentLimits{RequestsPerMinute: 6, Burst: 2, WhenExceeded: commandissuer.EnrollmentLimitPolicyFailFast}
+
+	s := &blockingSigner{started: make(chan struct{}, 10), release: make(chan struct{})}
+	close(s.release)
+	sign := func() error {
+		_, _, _, err := limiter.Signer(s, issuer, limits).Sign(context.TODO(), []byte("csr"), signer.K8sMetadata{})
+		return err
+	}
+
+	// The burst is allowed at once
+	require.NoError(t, sign())
+	require.NoError(t, sign())
+
+	err := sign()
+	var limitErr *enrollmentLimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.True(t, limitErr.failFast)
+	assert.Equal(t, 10*time.Second, limitErr.retryAfter)
+	assert.EqualError(t, err, "ClusterIssuer issuer1 exceeded its limit of 6 enrollments per minute")
+
+	// A rejected call doesn't consume the budget
+	clock.SetTime(clock.Now().Add(10 * time.Second))
+	require.NoError(t, sign())
+	assert.Error(t, sign())
+
+	// Requests rejected by the signer before calling Command don't consume the budget either
+	clock.SetTime(clock.Now().Add(10 * time.Second))
+	_, _, _, err = limiter.Signer(s, issuer, limits).Sign(context.TODO(), nil, signer.K8sMetadata{})
+	assert.EqualError(t, err, "CSR rejected")
+	require.NoError(t, sign())
+
+	// Raising the limit of the issuer shortens the wait for the next call
+	limits.RequestsPerMinute = 600
+	err = sign()
+	require.True(t, errors.As(err, &limitErr))
+	assert.LessOrEqual(t, limitErr.retryAfter, 100*time.Millisecond)
+	clock.SetTime(clock.Now().Add(limitErr.retryAfter))
+	assert.NoError(t, sign())
+}
+
+func TestIssuerLimiterWithoutLimits(t *testing.T) {
+	issuer := &commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "issuer1"}}
+	s := &blockingSigner{}
+
+	limiter := NewIssuerLimiter(clocktesting.NewFakePassiveClock(time.Now()))
+	assert.Same(t, s, limiter.Signer(s, issuer, nil))
+	assert.Same(t, s, limiter.Signer(s, issuer, &commandissuer.EnrollmentLimits{WhenExceeded: commandissuer.EnrollmentLimitPolicyFailFast}))
+
+	var nilLimiter *IssuerLimiter
+	assert.Same(t, s, nilLimiter.Signer(s, issuer, &commandissuer.EnrollmentLimits{MaxConcurrentEnrollments: 1}))
+}
+
+func TestIssuerLimiterForget(t *testing.T) {
+	clock := clocktesting.NewFakePassiveClock(time.Now())
+	limiter := NewIssuerLimiter(clock)
+	issuer := &commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "issuer1"}}
+	limits := &commandissuer.EnrollmentLimits{RequestsPerMinute: 1, WhenExceeded: commandissuer.EnrollmentLimitPolicyFailFast}
+
+	s := &blockingSigner{started: make(chan struct{}, 10), release: make(chan struct{})}
+	close(s.release)
+	sign := func() error {
+		_, _, _, err := limiter.Signer(s, issuer, limits).Sign(context.TODO(), []byte("csr"), signer.K8sMetadata{})
+		return err
+	}
+
+	require.NoError(t, sign())
+	require.Error(t, sign())
+
+	// Forgetting another kind of issuer with the same name doesn't affect the issuer
+	limiter.Forget("ClusterIssuer", types.NamespacedName{Name: "issuer1"})
+	require.Error(t, sign())
+
+	// The state of a deleted issuer is discarded, so a recreated issuer starts over
+	limiter.Forget("Issuer", types.NamespacedName{Namespace: "ns1", Name: "issuer1"})
+	assert.Empty(t, limiter.issuers)
+	assert.NoError(t, sign())
+
+	var nilLimiter *IssuerLimiter
+	nilLimiter.Forget("Issuer", types.NamespacedName{Namespace: "ns1", Name: "issuer1"})
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// reasonInvalidIssuerRef is the reason of the Event recorded when the issuerRef of a request
+	// references a kind of this group that doesn't exist
+	reasonInvalidIssuerRef = "InvalidIssuerRef"
+	// reasonIssuerNotFound is the reason of the Event recorded when the issuer referenced by a request
+	// doesn't exist
+	reasonIssuerNotFound = "IssuerNotFound"
+	// reasonIssuerNotReady is the reason of the Event recorded when the issuer referenced by a request
+	// isn't ready
+	reasonIssuerNotReady = "IssuerNotReady"
+
+	// maxListedIssuers is how many issuer names are listed in the diagnosis of a missing issuer
+	maxListedIssuers = 10
+)
+
+// issuerKindDiagnosis explains an issuerRef kind that isn't a kind of this group, e.g. because it is
+// misspelled or has the wrong case
+func issuerKindDiagnosis(kind string) string {
+	for _, known := range []string{"Issuer", "ClusterIssuer"} {
+		if strings.EqualFold(kind, known) || editDistance(strings.ToLower(kind), strings.ToLower(known)) <= 2 {
+			return fmt.Sprintf("issuerRef.kind %q is not a kind of %s. Did you mean %q?", kind, commandissuer.GroupVersion.Group, known)
+		}
+	}
+	return fmt.Sprintf("issuerRef.kind %q is not a kind of %s. The kind must be Issuer or ClusterIssuer.", kind, commandissuer.GroupVersion.Group)
+}
+
+// issuerNotFoundDiagnosis explains why the issuer referenced by the CertificateRequest doesn't exist,
+// e.g. because issuerRef has the wrong kind or a misspelled name. The issuers are read from the cache
+// of the manager, so diagnosing a request is cheap.
+func (r *CertificateRequestReconciler) issuerNotFoundDiagnosis(ctx context.Context, certificateRequest *cmapi.CertificateRequest) string {
+	ref := certificateRequest.Spec.IssuerRef
+
+	var names []string
+	var scope, otherKind string
+	var other client.Object
+	switch ref.Kind {
+	case "Issuer":
+		var list commandissuer.IssuerList
+		if err := r.List(ctx, &list, client.InNamespace(certificateRequest.Namespace)); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to list the Issuers to diagnose the issuerRef")
+			return ""
+		}
+		for _, issuer := range list.Items {
+			names = append(names, issuer.Name)
+		}
+		scope = fmt.Sprintf("in namespace %s", certificateRequest.Namespace)
+		if !r.DisableClusterIssuers {
+			otherKind, other = "ClusterIssuer", &commandissuer.ClusterIssuer{}
+		}
+	case "ClusterIssuer":
+		var list commandissuer.ClusterIssuerList
+		if err := r.List(ctx, &list); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to list the ClusterIssuers to diagnose the issuerRef")
+			return ""
+		}
+		for _, issuer := range list.Items {
+			names = append(names, issuer.Name)
+		}
+		scope = "in the cluster"
+		otherKind, other = "Issuer", &commandissuer.Issuer{}
+	default:
+		return ""
+	}
+
+	// The name may exist with the other kind, e.g. if issuerRef.kind was omitted for a ClusterIssuer
+	if other != nil {
+		key := client.ObjectKey{Name: ref.Name}
+		if otherKind == "Issuer" {
+			key.Namespace = certificateRequest.Namespace
+		}
+		err := r.Get(ctx, key, other)
+		if err == nil {
+			return fmt.Sprintf("No %s named %q exists %s, but a %s does. Did you mean issuerRef.kind %q?", ref.Kind, ref.Name, scope, otherKind, otherKind)
+		}
+		if !apierrors.IsNotFound(err) {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to get the issuer of the other kind to diagnose the issuerRef")
+		}
+	}
+
+	if len(names) == 0 {
+		return fmt.Sprintf("No %s exists %s.", ref.Kind, scope)
+	}
+
+	// Suggest the closest name if the name looks misspelled
+	closest, distance := "", 0
+	for _, name := range names {
+		if d := editDistance(ref.Name, name); closest == "" || d < distance {
+			closest, distance = name, d
+		}
+	}
+	if distance <= max(2, len(ref.Name)/4) {
+		return fmt.Sprintf("No %s named %q exists %s. Did you mean %q?", ref.Kind, ref.Name, scope, closest)
+	}
+
+	sort.Strings(names)
+	listed := strings.Join(names[:min(len(names), maxListedIssuers)], ", ")
+	if len(names) > maxListedIssuers {
+		listed += fmt.Sprintf(" and %d more", len(names)-maxListedIssuers)
+	}
+	return fmt.Sprintf("No %s named %q exists %s. The %ss %s are: %s.", ref.Kind, ref.Name, scope, ref.Kind, scope, listed)
+}
+
+// issuerNotReadyDiagnosis explains why the issuer referenced by a request isn't ready
+func issuerNotReadyDiagnosis(issuer client.Object, issuerStatus *commandissuer.IssuerStatus) string {
+	name := issuerKind(issuer) + " " + issuer.GetName()
+	if issuer.GetNamespace() != "" {
+		name = issuerKind(issuer) + " " + issuer.GetNamespace() + "/" + issuer.GetName()
+	}
+
+	ready := issuerutil.GetReadyCondition(issuerStatus)
+	switch {
+	case ready == nil:
+		return fmt.Sprintf("%s has not been health checked yet", name)
+	case ready.Status == commandissuer.ConditionTrue:
+		return fmt.Sprintf("%s changed and has not been health checked again yet", name)
+	default:
+		return fmt.Sprintf("%s failed its health check: %s", name, ready.Message)
+	}
+}
+
+// recordIssuerRefEvent records an Event explaining why the issuer of the request can't be used, if
+// the diagnostics are enabled
+func (r *CertificateRequestReconciler) recordIssuerRefEvent(certificateRequest *cmapi.CertificateRequest, reason, message string) {
+	if r.Recorder == nil || !r.IssuerRefDiagnostics || message == "" {
+		return
+	}
+	r.Recorder.Event(certificateRequest, corev1.EventTypeWarning, reason, redactMessage(message))
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
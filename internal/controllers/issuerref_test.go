@@ -0,0 +1,209 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	signerfake "github.com/Keyfactor/command-issuer/internal/issuer/signer/fake"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("issuer", "issuer"))
+	assert.Equal(t, 1, editDistance("issuer", "isuer"))
+	assert.Equal(t, 2, editDistance("issuer", "issure"))
+	assert.Equal(t, 6, editDistance("", "issuer"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+}
+
+func TestIssuerKindDiagnosis(t *testing.T) {
+	assert.Equal(t, `issuerRef.kind "issuer" is not a kind of command-issuer.keyfactor.com. Did you mean "Issuer"?`, issuerKindDiagnosis("issuer"))
+	assert.Equal(t, `issuerRef.kind "ClusterIsuer" is not a kind of command-issuer.keyfactor.com. Did you mean "ClusterIssuer"?`, issuerKindDiagnosis("ClusterIsuer"))
+	assert.Equal(t, `issuerRef.kind "Certificate" is not a kind of command-issuer.keyfactor.com. The kind must be Issuer or ClusterIssuer.`, issuerKindDiagnosis("Certificate"))
+}
+
+func TestCertificateRequestReconcileIssuerRefDiagnostics(t *testing.T) {
+	csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+	readyIssuer := func(name string) *commandissuer.Issuer {
+		return &commandissuer.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns1"},
+			Status: commandissuer.IssuerStatus{
+				Conditions: []commandissuer.IssuerCondition{
+					{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+				},
+			},
+		}
+	}
+	var manyIssuers []client.Object
+	for i := 0; i < 12; i++ {
+		manyIssuers = append(manyIssuers, readyIssuer(fmt.Sprintf("team-%02d", i)))
+	}
+
+	tests := []struct {
+		name                 string
+		issuerRef            cmmeta.ObjectReference
+		objects              []client.Object
+		disableDiagnostics   bool
+		expectedError        error
+		expectedEvent        string
+		expectedErrorMessage string
+	}{
+		{
+			name:          "misspelled-kind",
+			issuerRef:     cmmeta.ObjectReference{Name: "issuer1", Group: commandissuer.GroupVersion.Group, Kind: "Isuer"},
+			objects:       []client.Object{readyIssuer("issuer1")},
+			expectedEvent: `Warning InvalidIssuerRef issuerRef.kind "Isuer" is not a kind of command-issuer.keyfactor.com. Did you mean "Issuer"?`,
+		},
+		{
+			name:                 "misspelled-name",
+			issuerRef:            cmmeta.ObjectReference{Name: "isuer1", Group: commandissuer.GroupVersion.Group, Kind: "Issuer"},
+			objects:              []client.Object{readyIssuer("issuer1"), readyIssuer("other")},
+			expectedError:        errGetIssuer,
+			expectedEvent:        `Warning IssuerNotFound No Issuer named "isuer1" exists in namespace ns1. Did you mean "issuer1"?`,
+			expectedErrorMessage: `Did you mean "issuer1"?`,
+		},
+		{
+			name:      "wrong-kind",
+			issuerRef: cmmeta.ObjectReference{Name: "issuer1", Group: commandissuer.GroupVersion.Group, Kind: "Issuer"},
+			objects: []client.Object{
+				&commandissuer.ClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer1"}},
+			},
+			expectedError: errGetIssuer,
+			expectedEvent: `Warning IssuerNotFound No Issuer named "issuer1" exists in namespace ns1, but a ClusterIssuer does. Did you mean issuerRef.kind "ClusterIssuer"?`,
+		},
+		{
+			name:          "no-issuers",
+			issuerRef:     cmmeta.ObjectReference{Name: "issuer1", Group: commandissuer.GroupVersion.Group, Kind: "ClusterIssuer"},
+			expectedError: errGetIssuer,
+			expectedEvent: `Warning IssuerNotFound No ClusterIssuer exists in the cluster.`,
+		},
+		{
+			name:          "lists-existing-issuers",
+			issuerRef:     cmmeta.ObjectReference{Name: "payments", Group: commandissuer.GroupVersion.Group, Kind: "Issuer"},
+			objects:       manyIssuers,
+			expectedError: errGetIssuer,
+			expectedEvent: `Warning IssuerNotFound No Issuer named "payments" exists in namespace ns1. The Issuers in namespace ns1 are: team-00, team-01, team-02, team-03, team-04, team-05, team-06, team-07, team-08, team-09 and 2 more.`,
+		},
+		{
+			name:      "issuer-not-ready",
+			issuerRef: cmmeta.ObjectReference{Name: "issuer1", Group: commandissuer.GroupVersion.Group, Kind: "Issuer"},
+			objects: []client.Object{
+				&commandissuer.Issuer{
+					ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+					Status: commandissuer.IssuerStatus{
+						Conditions: []commandissuer.IssuerCondition{
+							{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionFalse, Message: "failed to authenticate to Command"},
+						},
+					},
+				},
+			},
+			expectedError:        errIssuerNotReady,
+			expectedEvent:        `Warning IssuerNotReady Issuer ns1/issuer1 failed its health check: failed to authenticate to Command`,
+			expectedErrorMessage: "failed to authenticate to Command",
+		},
+		{
+			name:               "disabled",
+			issuerRef:          cmmeta.ObjectReference{Name: "isuer1", Group: commandissuer.GroupVersion.Group, Kind: "Issuer"},
+			objects:            []client.Object{readyIssuer("issuer1")},
+			disableDiagnostics: true,
+			expectedError:      errGetIssuer,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			objects := append([]client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestCSR(csr),
+					cmgen.SetCertificateRequestIssuer(tc.issuerRef),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+			}, tc.objects...)
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(objects...).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			fakeSigner, err := signerfake.NewSigner()
+			require.NoError(t, err)
+
+			recorder := record.NewFakeRecorder(10)
+			controller := CertificateRequestReconciler{
+				Client:                            fakeClient,
+				ConfigClient:                      NewFakeConfigClient(fakeClient),
+				Scheme:                            scheme,
+				SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
+				Clock:                             fixedClock,
+				SecretAccessGrantedAtClusterLevel: true,
+				Recorder:                          recorder,
+				IssuerRefDiagnostics:              !tc.disableDiagnostics,
+			}
+
+			namespacedName := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err = controller.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: namespacedName})
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.expectedErrorMessage != "" {
+				assert.Contains(t, err.Error(), tc.expectedErrorMessage)
+			}
+
+			if tc.expectedEvent == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Equal(t, tc.expectedEvent, <-recorder.Events)
+		})
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IssuerStatusEndpoint is the path of the metrics server that serves the IssuerStatusHandler
+const IssuerStatusEndpoint = "/issuers"
+
+// IssuerStatusHandler serves the readiness of every Issuer and ClusterIssuer as JSON, along with
+// the time of its last health check and last successful enrollment by this controller. Issuers are
+// listed from the cache of the manager and the times are kept in memory, so serving the endpoint
+// doesn't call the API server or Command.
+type IssuerStatusHandler struct {
+	Client client.Reader
+	Clock  clock.Clock
+	// DisableClusterIssuers omits ClusterIssuers, so that they aren't listed if the controller isn't
+	// allowed to read them
+	DisableClusterIssuers bool
+
+	mu       sync.Mutex
+	activity map[issuerKey]*issuerActivity
+}
+
+type issuerKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// issuerActivity holds what this controller observed of an issuer since it started
+type issuerActivity struct {
+	lastHealthCheck time.Time
+	lastEnrollment  time.Time
+	lastError       string
+	lastErrorTime   time.Time
+}
+
+// issuerStatusEntry is the status of an Issuer or ClusterIssuer served by the IssuerStatusHandler
+type issuerStatusEntry struct {
+	Kind           string `json:"kind"`
+	Namespace      string `json:"namespace,omitempty"`
+	Name           string `json:"name"`
+	Ready          string `json:"ready"`
+	Message        string `json:"message,omitempty"`
+	CommandVersion string `json:"commandVersion,omitempty"`
+	// The times are omitted if this controller hasn't checked the issuer or enrolled with it since it started
+	LastHealthCheckTime *time.Time `json:"lastHealthCheckTime,omitempty"`
+	LastEnrollmentTime  *time.Time `json:"lastEnrollmentTime,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorTime       *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// issuerStatusList is the response of the IssuerStatusHandler
+type issuerStatusList struct {
+	Issuers []issuerStatusEntry `json:"issuers"`
+}
+
+// RecordHealthCheck records a health check of the issuer and its error, if any. The last error is
+// kept after the issuer recovers, so that it can be inspected with its time.
+func (h *IssuerStatusHandler) RecordHealthCheck(issuer client.Object, err error) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	activity := h.activityFor(issuer)
+	activity.lastHealthCheck = h.clock().Now()
+	if err != nil {
+		activity.lastError = err.Error()
+		activity.lastErrorTime = activity.lastHealthCheck
+	}
+}
+
+// RecordEnrollment records a successful enrollment with the issuer
+func (h *IssuerStatusHandler) RecordEnrollment(issuer client.Object) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.activityFor(issuer).lastEnrollment = h.clock().Now()
+}
+
+// activityFor returns the activity of the issuer, creating it if needed. h.mu must be held.
+func (h *IssuerStatusHandler) activityFor(issuer client.Object) *issuerActivity {
+	key := issuerKey{kind: issuerKind(issuer), namespace: issuer.GetNamespace(), name: issuer.GetName()}
+	if h.activity == nil {
+		h.activity = make(map[issuerKey]*issuerActivity)
+	}
+	activity, ok := h.activity[key]
+	if !ok {
+		activity = &issuerActivity{}
+		h.activity[key] = activity
+	}
+	return activity
+}
+
+// ServeHTTP implements http.Handler
+func (h *IssuerStatusHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses, err := h.statuses(req)
+	if err != nil {
+		http.Error(w, "failed to list issuers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(issuerStatusList{Issuers: statuses})
+}
+
+// statuses returns the status of every Issuer and ClusterIssuer, sorted by kind, namespace and name
+func (h *IssuerStatusHandler) statuses(req *http.Request) ([]issuerStatusEntry, error) {
+	var issuers commandissuer.IssuerList
+	if err := h.Client.List(req.Context(), &issuers); err != nil {
+		return nil, err
+	}
+	var clusterIssuers commandissuer.ClusterIssuerList
+	if !h.DisableClusterIssuers {
+		if err := h.Client.List(req.Context(), &clusterIssuers); err != nil {
+			return nil, err
+		}
+	}
+
+	objects := make([]client.Object, 0, len(issuers.Items)+len(clusterIssuers.Items))
+	for i := range issuers.Items {
+		objects = append(objects, &issuers.Items[i])
+	}
+	for i := range clusterIssuers.Items {
+		objects = append(objects, &clusterIssuers.Items[i])
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	statuses := make([]issuerStatusEntry, 0, len(objects))
+	for _, issuer := range objects {
+		_, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
+		if err != nil {
+			continue
+		}
+
+		status := issuerStatusEntry{
+			Kind:           issuerKind(issuer),
+			Namespace:      issuer.GetNamespace(),
+			Name:           issuer.GetName(),
+			Ready:          string(commandissuer.ConditionUnknown),
+			CommandVersion: issuerStatus.CommandVersion,
+		}
+		if ready := issuerutil.GetReadyCondition(issuerStatus); ready != nil {
+			status.Ready = string(ready.Status)
+			status.Message = ready.Message
+		}
+		if activity, ok := h.activity[issuerKey{kind: status.Kind, namespace: status.Namespace, name: status.Name}]; ok {
+			status.LastHealthCheckTime = timeOrNil(activity.lastHealthCheck)
+			status.LastEnrollmentTime = timeOrNil(activity.lastEnrollment)
+			status.LastError = activity.lastError
+			status.LastErrorTime = timeOrNil(activity.lastErrorTime)
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kind != statuses[j].Kind {
+			return statuses[i].Kind < statuses[j].Kind
+		}
+		if statuses[i].Namespace != statuses[j].Namespace {
+			return statuses[i].Namespace < statuses[j].Namespace
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+func (h *IssuerStatusHandler) clock() clock.Clock {
+	if h.Clock == nil {
+		return clock.RealClock{}
+	}
+	return h.Clock
+}
+
+// issuerKind returns the kind of an Issuer or ClusterIssuer
+func issuerKind(issuer client.Object) string {
+	if _, ok := issuer.(*commandissuer.ClusterIssuer); ok {
+		return "ClusterIssuer"
+	}
+	return "Issuer"
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestIssuerStatusHandler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+
+	issuer := &commandissuer.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+		Status: commandissuer.IssuerStatus{
+			Conditions: []commandissuer.IssuerCondition{
+				{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue, Message: "Success"},
+			},
+			CommandVersion: "11.0",
+		},
+	}
+	clusterIssuer := &commandissuer.ClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "clusterissuer1"},
+		Status: commandissuer.IssuerStatus{
+			Conditions: []commandissuer.IssuerCondition{
+				{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionFalse, Message: "healthcheck failed"},
+			},
+		},
+	}
+	newIssuer := &commandissuer.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "issuer0", Namespace: "ns1"},
+	}
+
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	handler := &IssuerStatusHandler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(issuer, clusterIssuer, newIssuer).Build(),
+		Clock:  fakeClock,
+	}
+
+	handler.RecordHealthCheck(clusterIssuer, errors.New("simulated health check error"))
+	handler.RecordHealthCheck(issuer, errors.New("simulated transient error"))
+	fakeClock.Step(time.Minute)
+	handler.RecordHealthCheck(issuer, nil)
+	handler.RecordEnrollment(issuer)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, IssuerStatusEndpoint, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var response issuerStatusList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+
+	firstCheck := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	secondCheck := firstCheck.Add(time.Minute)
+	expected := []issuerStatusEntry{
+		{
+			Kind:                "ClusterIssuer",
+			Name:                "clusterissuer1",
+			Ready:               "False",
+			Message:             "healthcheck failed",
+			LastHealthCheckTime: &firstCheck,
+			LastError:           "simulated health check error",
+			LastErrorTime:       &firstCheck,
+		},
+		{
+			Kind:      "Issuer",
+			Namespace: "ns1",
+			Name:      "issuer0",
+			Ready:     "Unknown",
+		},
+		{
+			Kind:                "Issuer",
+			Namespace:           "ns1",
+			Name:                "issuer1",
+			Ready:               "True",
+			Message:             "Success",
+			CommandVersion:      "11.0",
+			LastHealthCheckTime: &secondCheck,
+			LastEnrollmentTime:  &secondCheck,
+			LastError:           "simulated transient error",
+			LastErrorTime:       &firstCheck,
+		},
+	}
+	assert.Equal(t, expected, response.Issuers)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, IssuerStatusEndpoint, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestIssuerStatusHandlerWithoutClusterIssuers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+
+	// The controller isn't allowed to read ClusterIssuers when they are disabled
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"}}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if _, ok := list.(*commandissuer.ClusterIssuerList); ok {
+					return apierrors.NewForbidden(commandissuer.GroupVersion.WithResource("clusterissuers").GroupResource(), "", errors.New("simulated RBAC denial"))
+				}
+				return c.List(ctx, list, opts...)
+			},
+		}).
+		Build()
+	handler := &IssuerStatusHandler{
+		Client:                fakeClient,
+		Clock:                 clocktesting.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		DisableClusterIssuers: true,
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, IssuerStatusEndpoint, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response issuerStatusList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, []issuerStatusEntry{{Kind: "Issuer", Namespace: "ns1", Name: "issuer1", Ready: "Unknown"}}, response.Issuers)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// Names of the loggers of the components whose verbosity can be configured with ComponentLogLevels,
+// in addition to the loggers of controller-runtime, e.g. controller-runtime.cache
+const (
+	// ReconcilerLoggerName names the loggers of the Issuer, ClusterIssuer, CertificateRequest and
+	// CertificateSigningRequest reconcilers
+	ReconcilerLoggerName = "reconciler"
+	// SignerLoggerName names the loggers of the enrollments in Command
+	SignerLoggerName = "signer"
+	// HealthCheckLoggerName names the loggers of the health checks of issuers
+	HealthCheckLoggerName = "healthcheck"
+)
+
+// ComponentLogLevels maps logger names to the verbosity of their Info logs, like the V levels of
+// logr. The level of a logger is the level of the innermost of its dot-separated names that has a
+// level, so signer=2 applies to reconciler.signer, and controller-runtime=0 to
+// controller-runtime.cache. Errors are always logged.
+type ComponentLogLevels map[string]int
+
+// ParseComponentLogLevels parses a comma-separated list of name=level pairs, e.g. the value of a
+// flag. Levels must not be negative.
+func ParseComponentLogLevels(value string) (ComponentLogLevels, error) {
+	levels := make(ComponentLogLevels)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not a name=level pair", pair)
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(level))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("the level of %q must be a non-negative integer, got %q", name, level)
+		}
+		levels[name] = v
+	}
+	return levels, nil
+}
+
+// MaxLevel returns the highest level of the components, or -1 if there are none
+func (l ComponentLogLevels) MaxLevel() int {
+	max := -1
+	for _, level := range l {
+		if level > max {
+			max = level
+		}
+	}
+	return max
+}
+
+// Logger returns a logger that emits the Info logs of each named logger up to the level of its
+// component, and of the other loggers up to defaultLevel. The sink of logger must be enabled up to
+// the highest of these levels. If there are no components, logger is returned unchanged.
+func (l ComponentLogLevels) Logger(logger logr.Logger, defaultLevel int) logr.Logger {
+	if len(l) == 0 || logger.GetSink() == nil {
+		return logger
+	}
+	return logr.New(componentLevelLogSink{LogSink: logger.GetSink(), levels: l, level: defaultLevel})
+}
+
+// componentLevelLogSink is a logr.LogSink that filters the Info logs of the wrapped sink by the
+// level of the innermost named component of the logger
+type componentLevelLogSink struct {
+	logr.LogSink
+	levels ComponentLogLevels
+	// level is the verbosity of the logger, from its innermost named component or the default
+	level int
+}
+
+// Init is a no-op; the wrapped sink was already initialized by its own logger.
+func (s componentLevelLogSink) Init(logr.RuntimeInfo) {}
+
+func (s componentLevelLogSink) Enabled(level int) bool {
+	return level <= s.level && s.LogSink.Enabled(level)
+}
+
+func (s componentLevelLogSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	s.LogSink = s.LogSink.WithValues(keysAndValues...)
+	return s
+}
+
+func (s componentLevelLogSink) WithName(name string) logr.LogSink {
+	s.LogSink = s.LogSink.WithName(name)
+	// Names may be dotted themselves, so each of their parts is matched
+	for _, part := range strings.Split(name, ".") {
+		if level, ok := s.levels[part]; ok {
+			s.level = level
+		}
+	}
+	return s
+}
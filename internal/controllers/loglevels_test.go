@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseComponentLogLevels(t *testing.T) {
+	levels, err := ParseComponentLogLevels(" signer=2, controller-runtime=0,,healthcheck = 1")
+	require.NoError(t, err)
+	assert.Equal(t, ComponentLogLevels{"signer": 2, "controller-runtime": 0, "healthcheck": 1}, levels)
+	assert.Equal(t, 2, levels.MaxLevel())
+
+	levels, err = ParseComponentLogLevels("")
+	require.NoError(t, err)
+	assert.Empty(t, levels)
+	assert.Equal(t, -1, levels.MaxLevel())
+
+	for _, value := range []string{"signer", "=1", "signer=-1", "signer=debug"} {
+		_, err := ParseComponentLogLevels(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestComponentLogLevelsLogger(t *testing.T) {
+	var logged []string
+	base := funcr.New(func(prefix, args string) {
+		logged = append(logged, prefix)
+	}, funcr.Options{Verbosity: 3})
+
+	levels := ComponentLogLevels{SignerLoggerName: 2, "controller-runtime": 0}
+	logger := levels.Logger(base, 1)
+
+	logger.V(1).Info("default")
+	logger.V(2).Info("default too verbose")
+	logger.WithName("controller-runtime").WithName("cache").V(1).Info("cache too verbose")
+	logger.WithName("controller-runtime.cache").V(1).Info("dotted cache too verbose")
+	logger.WithName(ReconcilerLoggerName).WithValues("key", "value").WithName(SignerLoggerName).V(2).Info("signer")
+	logger.WithName(ReconcilerLoggerName).WithName(SignerLoggerName).V(3).Info("signer too verbose")
+	logger.WithName(ReconcilerLoggerName).V(1).Info("reconciler")
+	logger.WithName("controller-runtime").V(5).Error(errors.New("failed"), "errors are always logged")
+
+	assert.Equal(t, []string{"", "reconciler/signer", "reconciler", "controller-runtime"}, logged)
+
+	assert.Equal(t, base, ComponentLogLevels{}.Logger(base, 1), "a logger without components is returned unchanged")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// EnrollmentLogSampler decides which enrollments emit informational request logs.
+// One in every Rate enrollments is logged for each Issuer/ClusterIssuer, so that a
+// single busy issuer can't starve the logs of the others. Errors are always logged.
+type EnrollmentLogSampler struct {
+	rate uint64
+
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// NewEnrollmentLogSampler creates a new EnrollmentLogSampler that logs 1 in rate enrollments
+// per issuer. A rate of 0 or 1 logs every enrollment.
+func NewEnrollmentLogSampler(rate int) *EnrollmentLogSampler {
+	if rate < 1 {
+		rate = 1
+	}
+	return &EnrollmentLogSampler{
+		rate:   uint64(rate),
+		counts: make(map[string]uint64),
+	}
+}
+
+// Sample records an enrollment for the issuer identified by key and returns true if
+// its informational logs should be emitted. A nil sampler samples every enrollment.
+func (s *EnrollmentLogSampler) Sample(key string) bool {
+	sampled := true
+	if s != nil {
+		s.mu.Lock()
+		sampled = s.counts[key]%s.rate == 0
+		s.counts[key]++
+		s.mu.Unlock()
+	}
+
+	enrollmentLogsTotal.WithLabelValues(key).Inc()
+	if sampled {
+		enrollmentLogsSampledTotal.WithLabelValues(key).Inc()
+	}
+
+	return sampled
+}
+
+// Logger returns logger unchanged if sampled is true. Otherwise, it returns a logger
+// that drops Info messages but still emits errors.
+func (s *EnrollmentLogSampler) Logger(logger logr.Logger, sampled bool) logr.Logger {
+	if sampled || logger.GetSink() == nil {
+		return logger
+	}
+	return logr.New(errorOnlyLogSink{logger.GetSink()})
+}
+
+// errorOnlyLogSink is a logr.LogSink that discards Info messages and forwards errors
+// to the wrapped sink.
+type errorOnlyLogSink struct {
+	logr.LogSink
+}
+
+// Init is a no-op; the wrapped sink was already initialized by its own logger.
+func (s errorOnlyLogSink) Init(logr.RuntimeInfo) {}
+
+func (s errorOnlyLogSink) Enabled(int) bool {
+	return false
+}
+
+func (s errorOnlyLogSink) Info(int, string, ...interface{}) {}
+
+func (s errorOnlyLogSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return errorOnlyLogSink{s.LogSink.WithValues(keysAndValues...)}
+}
+
+func (s errorOnlyLogSink) WithName(name string) logr.LogSink {
+	return errorOnlyLogSink{s.LogSink.WithName(name)}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrollmentLogSampler(t *testing.T) {
+	t.Run("SampleRate", func(t *testing.T) {
+		sampler := NewEnrollmentLogSampler(3)
+
+		var results []bool
+		for i := 0; i < 7; i++ {
+			results = append(results, sampler.Sample("issuer/ns1/sample-rate"))
+		}
+
+		assert.Equal(t, []bool{true, false, false, true, false, false, true}, results)
+		assert.Equal(t, float64(7), testutil.ToFloat64(enrollmentLogsTotal.WithLabelValues("issuer/ns1/sample-rate")))
+		assert.Equal(t, float64(3), testutil.ToFloat64(enrollmentLogsSampledTotal.WithLabelValues("issuer/ns1/sample-rate")))
+	})
+
+	t.Run("PerIssuer", func(t *testing.T) {
+		sampler := NewEnrollmentLogSampler(2)
+
+		assert.True(t, sampler.Sample("issuer/ns1/per-issuer-a"))
+		assert.True(t, sampler.Sample("issuer/ns1/per-issuer-b"))
+		assert.False(t, sampler.Sample("issuer/ns1/per-issuer-a"))
+		assert.False(t, sampler.Sample("issuer/ns1/per-issuer-b"))
+		assert.True(t, sampler.Sample("issuer/ns1/per-issuer-a"))
+	})
+
+	t.Run("DisabledSampling", func(t *testing.T) {
+		var nilSampler *EnrollmentLogSampler
+		zeroSampler := NewEnrollmentLogSampler(0)
+
+		for i := 0; i < 3; i++ {
+			assert.True(t, nilSampler.Sample("clusterissuer/disabled"))
+			assert.True(t, zeroSampler.Sample("clusterissuer/disabled"))
+		}
+	})
+
+	t.Run("UnsampledLoggerKeepsErrors", func(t *testing.T) {
+		var lines []string
+		logger := funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+		}, funcr.Options{})
+
+		sampler := NewEnrollmentLogSampler(2)
+
+		sampler.Logger(logger, true).Info("sampled info")
+		sampler.Logger(logger, false).Info("unsampled info")
+		sampler.Logger(logger, false).WithValues("key", "value").Info("unsampled info with values")
+		sampler.Logger(logger, false).Error(errors.New("failure"), "unsampled error")
+
+		if assert.Len(t, lines, 2) {
+			assert.Contains(t, lines[0], "sampled info")
+			assert.Contains(t, lines[1], "unsampled error")
+		}
+	})
+}
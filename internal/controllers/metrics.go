@@ -0,0 +1,100 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "command_issuer"
+
+var (
+	// enrollmentLogsTotal counts every enrollment seen by the log sampler, per issuer
+	enrollmentLogsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "enrollment_logs_total",
+			Help:      "Total number of enrollments considered for request logging.",
+		},
+		[]string{"issuer"},
+	)
+
+	// enrollmentLogsSampledTotal counts the enrollments whose info logs were emitted, per issuer
+	enrollmentLogsSampledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "enrollment_logs_sampled_total",
+			Help:      "Number of enrollments whose informational request logs were emitted.",
+		},
+		[]string{"issuer"},
+	)
+
+	// enrollmentsCoalescedTotal counts the CertificateRequests that reused the enrollment of an
+	// identical CSR instead of enrolling it in Command
+	enrollmentsCoalescedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "enrollments_coalesced_total",
+			Help:      "Number of CertificateRequests that reused a recent enrollment of the same CSR instead of enrolling it again.",
+		},
+	)
+
+	// commandRequestDuration observes the latency of the requests to Command, per host attempted
+	commandRequestDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "command_request_duration_seconds",
+			Help:      "Latency of the requests to Command until the response headers are received.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		},
+	)
+
+	// expiringCertificates is the number of certificates in Command that expire within the threshold
+	// of the expiry scan, per issuer
+	expiringCertificates = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "expiring_certificates",
+			Help:      "Number of certificates enrolled through the issuer that expire within the threshold of the expiry scan, according to the inventory of Command.",
+		},
+		[]string{"issuer_kind", "namespace", "name"},
+	)
+
+	// enrollmentNotificationsTotal counts the notifications of enrollments to the webhook, per result:
+	// sent, failed after the retries, or dropped because too many were waiting to be sent
+	enrollmentNotificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "enrollment_notifications_total",
+			Help:      "Number of enrollment notifications to the webhook, by result.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	// Register custom metrics with the global controller-runtime registry
+	metrics.Registry.MustRegister(
+		enrollmentLogsTotal,
+		enrollmentLogsSampledTotal,
+		enrollmentsCoalescedTotal,
+		commandRequestDuration,
+		expiringCertificates,
+		enrollmentNotificationsTotal,
+	)
+}
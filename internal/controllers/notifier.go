@@ -0,0 +1,233 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	defaultEnrollmentNotifierTimeout     = 10 * time.Second
+	defaultEnrollmentNotifierConcurrency = 4
+	// defaultEnrollmentNotifierRetryDelay is the delay before the first retry of a notification,
+	// doubled for every following retry
+	defaultEnrollmentNotifierRetryDelay = time.Second
+	// enrollmentNotifierQueueSize bounds the notifications waiting to be sent. Notifications are
+	// dropped while the queue is full, so that a slow webhook doesn't hold memory or reconciles.
+	enrollmentNotifierQueueSize = 1000
+)
+
+// Results of enrollment notifications, recorded by the enrollment_notifications_total metric
+const (
+	notificationResultSent    = "sent"
+	notificationResultFailed  = "failed"
+	notificationResultDropped = "dropped"
+)
+
+// EnrollmentNotifier POSTs the audit record of every completed enrollment as JSON to a webhook, e.g.
+// to notify dashboards or chatops of issued certificates and failed enrollments. Enrollments awaiting
+// approval in Command are notified once they complete. Notifications are queued and sent in the
+// background by a bounded number of workers, so a slow or unavailable webhook never blocks
+// reconciliation. Notifications that can't be queued, or aren't accepted after the retries, are
+// dropped and logged.
+type EnrollmentNotifier struct {
+	// URL is the webhook that notifications are POSTed to
+	URL string
+	// TokenFile is the path of a file with a bearer token sent in the Authorization header, e.g. from
+	// a mounted Secret. It is read for every notification, so the token can be rotated. If empty, no
+	// Authorization header is sent.
+	TokenFile string
+	// HTTPClient sends the notifications. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	Clock      clock.Clock
+	// Timeout bounds each attempt to send a notification. Defaults to 10 seconds.
+	Timeout time.Duration
+	// Retries is the number of times a notification is sent again after a network error or an HTTP
+	// 408, 429 or 5xx response
+	Retries int
+	// Concurrency is the number of notifications sent at the same time. Defaults to 4.
+	Concurrency int
+
+	// retryDelay is the delay before the first retry. Defaults to defaultEnrollmentNotifierRetryDelay.
+	retryDelay time.Duration
+
+	queueOnce sync.Once
+	queue     chan AuditRecord
+}
+
+// Notify queues the notification of an enrollment. It never blocks, and is a no-op on a nil
+// EnrollmentNotifier and for enrollments awaiting approval.
+func (n *EnrollmentNotifier) Notify(ctx context.Context, record AuditRecord) {
+	if n == nil || n.URL == "" || record.Outcome == AuditOutcomePending {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = n.clock().Now()
+	}
+	record.Time = record.Time.UTC()
+
+	select {
+	case n.records() <- record:
+	default:
+		enrollmentNotificationsTotal.WithLabelValues(notificationResultDropped).Inc()
+		ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("Dropping the notification of the enrollment because %d notifications are waiting to be sent", enrollmentNotifierQueueSize), "outcome", record.Outcome)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Notifications are only queued by
+// the reconcilers of the leader, so the notifier doesn't need to wait for leadership to send them.
+func (n *EnrollmentNotifier) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable. It sends the queued notifications until ctx is done.
+// Notifications still queued when ctx is done are dropped.
+func (n *EnrollmentNotifier) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("enrollment-notifier")
+
+	concurrency := n.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultEnrollmentNotifierConcurrency
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case record := <-n.records():
+					recordLog := log.WithValues("kind", record.Kind, "namespace", record.Namespace, "name", record.Name, "outcome", record.Outcome)
+					if err := n.send(ctx, record); err != nil {
+						enrollmentNotificationsTotal.WithLabelValues(notificationResultFailed).Inc()
+						recordLog.Error(err, "Failed to notify the webhook of the enrollment")
+						continue
+					}
+					enrollmentNotificationsTotal.WithLabelValues(notificationResultSent).Inc()
+					recordLog.V(1).Info("Notified the webhook of the enrollment")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// send POSTs the notification, retrying with an exponential backoff after errors that may be
+// transient
+func (n *EnrollmentNotifier) send(ctx context.Context, record AuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode the notification: %w", err)
+	}
+
+	delay := n.retryDelay
+	if delay <= 0 {
+		delay = defaultEnrollmentNotifierRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= n.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (not retried: %v)", err, ctx.Err())
+		case <-n.clock().After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends the notification once. It returns whether a failure may succeed when retried.
+func (n *EnrollmentNotifier) post(ctx context.Context, body []byte) (bool, error) {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = defaultEnrollmentNotifierTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create the request to %s: %w", n.URL, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if n.TokenFile != "" {
+		token, err := os.ReadFile(n.TokenFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read the webhook token: %w", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	httpClient := n.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return true, fmt.Errorf("failed to POST to %s: %w", n.URL, err)
+	}
+	defer response.Body.Close()
+	// The response is drained so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s responded with HTTP %d", n.URL, response.StatusCode)
+	switch {
+	case response.StatusCode == http.StatusRequestTimeout, response.StatusCode == http.StatusTooManyRequests, response.StatusCode >= 500:
+		return true, err
+	default:
+		return false, err
+	}
+}
+
+// records returns the queue of notifications waiting to be sent
+func (n *EnrollmentNotifier) records() chan AuditRecord {
+	n.queueOnce.Do(func() {
+		n.queue = make(chan AuditRecord, enrollmentNotifierQueueSize)
+	})
+	return n.queue
+}
+
+func (n *EnrollmentNotifier) clock() clock.Clock {
+	if n.Clock == nil {
+		return clock.RealClock{}
+	}
+	return n.Clock
+}
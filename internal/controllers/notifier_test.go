@@ -0,0 +1,191 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestEnrollmentNotifier(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600))
+
+	var mu sync.Mutex
+	var notifications []AuditRecord
+	received := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer s3cr3t", r.Header.Get("Authorization"))
+
+		var record AuditRecord
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+		mu.Lock()
+		notifications = append(notifications, record)
+		mu.Unlock()
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	notifier := &EnrollmentNotifier{
+		URL:         server.URL,
+		TokenFile:   tokenFile,
+		Clock:       clocktesting.NewFakeClock(now),
+		Concurrency: 1,
+	}
+
+	issued := AuditRecord{Kind: "CertificateRequest", Namespace: "ns1", Name: "cr1", IssuerKind: "Issuer", IssuerNamespace: "ns1", IssuerName: "issuer1", CertificateID: 42, Outcome: AuditOutcomeIssued}
+	failed := AuditRecord{Kind: "CertificateRequest", Namespace: "ns1", Name: "cr2", IssuerKind: "Issuer", IssuerNamespace: "ns1", IssuerName: "issuer1", Outcome: AuditOutcomeFailed, Error: "simulated enrollment error"}
+
+	// Notifications are queued before the notifier is started, and enrollments awaiting approval
+	// aren't notified
+	notifier.Notify(context.TODO(), issued)
+	notifier.Notify(context.TODO(), AuditRecord{Kind: "CertificateRequest", Namespace: "ns1", Name: "cr3", Outcome: AuditOutcomePending})
+	notifier.Notify(context.TODO(), failed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- notifier.Start(ctx) }()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for the notifications")
+		}
+	}
+	cancel()
+	require.NoError(t, <-done)
+
+	issued.Time = now
+	failed.Time = now
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []AuditRecord{issued, failed}, notifications)
+
+	var nilNotifier *EnrollmentNotifier
+	nilNotifier.Notify(context.TODO(), issued)
+}
+
+func TestEnrollmentNotifierSend(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		retries          int
+		expectedAttempts int
+		expectedError    bool
+	}{
+		{
+			name:             "Accepted",
+			statuses:         []int{http.StatusNoContent},
+			retries:          3,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "RetriedUntilAccepted",
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			retries:          3,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "RetriesExhausted",
+			statuses:         []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			retries:          2,
+			expectedAttempts: 3,
+			expectedError:    true,
+		},
+		{
+			name:             "NotRetriedAfterClientError",
+			statuses:         []int{http.StatusUnauthorized, http.StatusOK},
+			retries:          3,
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Empty(t, r.Header.Get("Authorization"))
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			notifier := &EnrollmentNotifier{URL: server.URL, Retries: tt.retries, retryDelay: time.Millisecond}
+			err := notifier.send(context.Background(), AuditRecord{Kind: "CertificateRequest", Name: "cr1", Outcome: AuditOutcomeIssued})
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.expectedAttempts, attempts)
+		})
+	}
+}
+
+func TestEnrollmentNotifierTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	notifier := &EnrollmentNotifier{URL: server.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	err := notifier.send(context.Background(), AuditRecord{Kind: "CertificateRequest", Name: "cr1", Outcome: AuditOutcomeIssued})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestEnrollmentNotifierDropsWhenQueueFull(t *testing.T) {
+	notifier := &EnrollmentNotifier{URL: "http://notifier.example.com"}
+	dropped := testutil.ToFloat64(enrollmentNotificationsTotal.WithLabelValues(notificationResultDropped))
+
+	// The notifier isn't started, so the queue fills up without blocking the caller
+	for i := 0; i < enrollmentNotifierQueueSize+2; i++ {
+		notifier.Notify(context.TODO(), AuditRecord{Kind: "CertificateRequest", Name: "cr1", Outcome: AuditOutcomeIssued})
+	}
+
+	assert.Len(t, notifier.records(), enrollmentNotifierQueueSize)
+	assert.Equal(t, dropped+2, testutil.ToFloat64(enrollmentNotificationsTotal.WithLabelValues(notificationResultDropped)))
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// priorityAnnotation raises the priority of a CertificateRequest, e.g. to reissue a certificate
+	// during an incident while a mass rotation is queued. The only priority is "high"; requests
+	// without the annotation or with another value have the normal priority.
+	priorityAnnotation = "command-issuer.keyfactor.com/priority"
+	priorityHigh       = "high"
+
+	// priorityControllerName is the name of the controller that reconciles high priority
+	// CertificateRequests
+	priorityControllerName = "certificaterequest-priority"
+)
+
+// isHighPriority returns true if the CertificateRequest is annotated with the high priority
+func isHighPriority(obj client.Object) bool {
+	return strings.EqualFold(strings.TrimSpace(obj.GetAnnotations()[priorityAnnotation]), priorityHigh)
+}
+
+// priorityPredicate selects the CertificateRequests of the high or the normal priority
+func priorityPredicate(highPriority bool) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return isHighPriority(obj) == highPriority
+	})
+}
+
+// priorityLaneReconciler reconciles the CertificateRequests of one priority with a work queue and
+// workers of its own, so that high priority requests don't wait behind the queue of normal requests.
+// A request whose priority changed while it was queued is skipped, since the queue of its new
+// priority reconciles it.
+type priorityLaneReconciler struct {
+	*CertificateRequestReconciler
+	highPriority bool
+}
+
+func (r *priorityLaneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var certificateRequest cmapi.CertificateRequest
+	if err := r.Get(ctx, req.NamespacedName, &certificateRequest); err != nil {
+		if err := client.IgnoreNotFound(err); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unexpected get error: %v", err)
+		}
+		ctrl.LoggerFrom(ctx).Info("Not found. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+	if isHighPriority(&certificateRequest) != r.highPriority {
+		ctrl.LoggerFrom(ctx).Info("Priority of the CertificateRequest changed. Ignoring.")
+		return ctrl.Result{}, nil
+	}
+	return r.CertificateRequestReconciler.Reconcile(ctx, req)
+}
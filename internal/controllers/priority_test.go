@@ -0,0 +1,250 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	signerfake "github.com/Keyfactor/command-issuer/internal/issuer/signer/fake"
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestIsHighPriority(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "Unset"},
+		{name: "High", annotations: map[string]string{priorityAnnotation: "high"}, expected: true},
+		{name: "CaseInsensitive", annotations: map[string]string{priorityAnnotation: " High "}, expected: true},
+		{name: "Other", annotations: map[string]string{priorityAnnotation: "urgent"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := cmgen.CertificateRequest("cr1", cmgen.SetCertificateRequestAnnotations(tc.annotations))
+			assert.Equal(t, tc.expected, isHighPriority(cr))
+			assert.Equal(t, tc.expected, priorityPredicate(true).Create(event.CreateEvent{Object: cr}))
+			assert.Equal(t, !tc.expected, priorityPredicate(false).Create(event.CreateEvent{Object: cr}))
+		})
+	}
+}
+
+func TestPriorityLaneReconcile(t *testing.T) {
+	csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		highPriority   bool
+		expectedSigned bool
+	}{
+		{name: "NormalLaneNormalRequest", expectedSigned: true},
+		{name: "HighLaneHighRequest", annotations: map[string]string{priorityAnnotation: "high"}, highPriority: true, expectedSigned: true},
+		{name: "NormalLaneSkipsHighRequest", annotations: map[string]string{priorityAnnotation: "high"}},
+		{name: "HighLaneSkipsNormalRequest", highPriority: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, commandissuer.AddToScheme(scheme))
+			require.NoError(t, cmapi.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					cmgen.CertificateRequest(
+						"cr1",
+						cmgen.SetCertificateRequestNamespace("ns1"),
+						cmgen.SetCertificateRequestAnnotations(tc.annotations),
+						cmgen.SetCertificateRequestCSR(csr),
+						cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+							Name:  "issuer1",
+							Group: commandissuer.GroupVersion.Group,
+							Kind:  "Issuer",
+						}),
+						cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+							Type:   cmapi.CertificateRequestConditionReady,
+							Status: cmmeta.ConditionUnknown,
+						}),
+					),
+					&commandissuer.Issuer{
+						ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+						Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials"},
+						Status: commandissuer.IssuerStatus{
+							Conditions: []commandissuer.IssuerCondition{
+								{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+							},
+						},
+					},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			fakeSigner, err := signerfake.NewSigner()
+			require.NoError(t, err)
+
+			lane := &priorityLaneReconciler{
+				CertificateRequestReconciler: &CertificateRequestReconciler{
+					Client:                            fakeClient,
+					ConfigClient:                      NewFakeConfigClient(fakeClient),
+					Scheme:                            scheme,
+					SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
+					Clock:                             fixedClock,
+					SecretAccessGrantedAtClusterLevel: true,
+					PriorityReconciles:                1,
+				},
+				highPriority: tc.highPriority,
+			}
+
+			namespacedName := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+			_, err = lane.Reconcile(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)), reconcile.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+
+			var cr cmapi.CertificateRequest
+			require.NoError(t, fakeClient.Get(context.TODO(), namespacedName, &cr))
+			signed := cmutil.CertificateRequestHasCondition(&cr, cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionTrue,
+			})
+			assert.Equal(t, tc.expectedSigned, signed)
+			if !tc.expectedSigned {
+				assert.Empty(t, cr.Status.Certificate)
+			}
+		})
+	}
+}
+
+func TestPriorityLanesReconcileConcurrently(t *testing.T) {
+	const requestsPerLane = 10
+	csr, _ := generateCSRAndCertificate(t, []string{"app.example.com"}, []string{"app.example.com"})
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	objects := []client.Object{
+		&commandissuer.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+			Spec:       commandissuer.IssuerSpec{SecretName: "issuer1-credentials", HostnameConfigMapName: "issuer1-hostname"},
+			Status: commandissuer.IssuerStatus{
+				Conditions: []commandissuer.IssuerCondition{
+					{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+				},
+			},
+		},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-credentials", Namespace: "ns1"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "issuer1-hostname", Namespace: "ns1"}, Data: map[string]string{"hostname": "command.example.com"}},
+	}
+	var requests []reconcile.Request
+	for i := 0; i < 2*requestsPerLane; i++ {
+		var annotations map[string]string
+		if i%2 == 1 {
+			annotations = map[string]string{priorityAnnotation: "high"}
+		}
+		name := fmt.Sprintf("cr%d", i)
+		objects = append(objects, cmgen.CertificateRequest(
+			name,
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.SetCertificateRequestAnnotations(annotations),
+			cmgen.SetCertificateRequestCSR(csr),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "issuer1",
+				Group: commandissuer.GroupVersion.Group,
+				Kind:  "Issuer",
+			}),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionUnknown,
+			}),
+		))
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: name}})
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	fakeSigner, err := signerfake.NewSigner()
+	require.NoError(t, err)
+
+	// Both lanes share the reconciler and its config client, like the controllers set up by SetupWithManager
+	reconciler := &CertificateRequestReconciler{
+		Client:                            fakeClient,
+		ConfigClient:                      NewFakeConfigClient(fakeClient),
+		Scheme:                            scheme,
+		SignerBuilder:                     signerfake.SignerBuilder(fakeSigner),
+		Clock:                             fixedClock,
+		SecretAccessGrantedAtClusterLevel: true,
+		PriorityReconciles:                2,
+	}
+	lanes := []*priorityLaneReconciler{
+		{CertificateRequestReconciler: reconciler},
+		{CertificateRequestReconciler: reconciler, highPriority: true},
+	}
+
+	// Every reconcile cancels its context when it returns, which must not affect the reconciles still
+	// running in either lane
+	var wg sync.WaitGroup
+	for _, lane := range lanes {
+		for _, request := range requests {
+			wg.Add(1)
+			go func(lane *priorityLaneReconciler, request reconcile.Request) {
+				defer wg.Done()
+				ctx, cancel := context.WithCancel(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)))
+				defer cancel()
+				_, err := lane.Reconcile(ctx, request)
+				assert.NoError(t, err)
+			}(lane, request)
+		}
+	}
+	wg.Wait()
+
+	for _, request := range requests {
+		var cr cmapi.CertificateRequest
+		require.NoError(t, fakeClient.Get(context.TODO(), request.NamespacedName, &cr))
+		assert.True(t, cmutil.CertificateRequestHasCondition(&cr, cmapi.CertificateRequestCondition{
+			Type:   cmapi.CertificateRequestConditionReady,
+			Status: cmmeta.ConditionTrue,
+		}), "CertificateRequest %s wasn't signed", request.Name)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var errGetProfile = errors.New("profileName specified a name, but failed to get the CommandIssuerProfile")
+
+// profileNamespace returns the namespace of the CommandIssuerProfile referenced by an issuer. Issuers
+// reference profiles in their own namespace, and ClusterIssuers in the cluster resource namespace.
+func profileNamespace(issuer client.Object, clusterResourceNamespace string) string {
+	if _, ok := issuer.(*commandissuer.ClusterIssuer); ok {
+		return clusterResourceNamespace
+	}
+	return issuer.GetNamespace()
+}
+
+// specWithProfile returns the issuer spec, or a copy of it merged with the CommandIssuerProfile
+// referenced by profileName in namespace. The profile is read on every call, so a changed profile is
+// used by the next enrollment.
+func specWithProfile(ctx context.Context, reader client.Reader, spec *commandissuer.IssuerSpec, namespace string) (*commandissuer.IssuerSpec, error) {
+	if spec.ProfileName == "" {
+		return spec, nil
+	}
+
+	profileName := types.NamespacedName{
+		Name:      spec.ProfileName,
+		Namespace: namespace,
+	}
+
+	var profile commandissuer.CommandIssuerProfile
+	if err := reader.Get(ctx, profileName, &profile); err != nil {
+		return nil, fmt.Errorf("%w, profile name: %s, reason: %v", errGetProfile, profileName, err)
+	}
+	return commandissuer.MergeProfile(spec, &profile.Spec), nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMergeProfile(t *testing.T) {
+	profile := &commandissuer.CommandIssuerProfileSpec{
+		CertificateTemplate:             "WebServer",
+		CertificateAuthorityLogicalName: "IssuingCA1",
+		CertificateAuthorityHostname:    "ca1.example.com",
+		AllowedCertificateAuthorities:   []string{"IssuingCA1", "IssuingCA2"},
+		AllowedSANTypes:                 []commandissuer.SANType{commandissuer.SANTypeDNS},
+		EnrollmentParameters:            map[string]string{"SubTemplate": "Server", "Region": "EU"},
+		MetadataFromLabels:              map[string]string{"team": "Team"},
+		CertificateCollection:           "Kubernetes Certificates",
+		DefaultDuration:                 &metav1.Duration{Duration: 720 * time.Hour},
+	}
+
+	tests := []struct {
+		name     string
+		spec     commandissuer.IssuerSpec
+		expected commandissuer.IssuerSpec
+	}{
+		{
+			name: "ProfileOnly",
+			spec: commandissuer.IssuerSpec{Hostname: "command.example.com", ProfileName: "default"},
+			expected: commandissuer.IssuerSpec{
+				Hostname:                        "command.example.com",
+				ProfileName:                     "default",
+				CertificateTemplate:             "WebServer",
+				CertificateAuthorityLogicalName: "IssuingCA1",
+				CertificateAuthorityHostname:    "ca1.example.com",
+				AllowedCertificateAuthorities:   []string{"IssuingCA1", "IssuingCA2"},
+				AllowedSANTypes:                 []commandissuer.SANType{commandissuer.SANTypeDNS},
+				EnrollmentParameters:            map[string]string{"SubTemplate": "Server", "Region": "EU"},
+				MetadataFromLabels:              map[string]string{"team": "Team"},
+				CertificateCollection:           "Kubernetes Certificates",
+				DefaultDuration:                 &metav1.Duration{Duration: 720 * time.Hour},
+			},
+		},
+		{
+			name: "IssuerOverrides",
+			spec: commandissuer.IssuerSpec{
+				CertificateTemplate:             "ClientAuth",
+				CertificateAuthorityLogicalName: "IssuingCA2",
+				AllowedSANTypes:                 []commandissuer.SANType{commandissuer.SANTypeEmail},
+				EnrollmentParameters:            map[string]string{"SubTemplate": "Client"},
+				MetadataFromAnnotations:         map[string]string{"example.com/owner": "Owner"},
+				DefaultDuration:                 &metav1.Duration{Duration: 24 * time.Hour},
+			},
+			expected: commandissuer.IssuerSpec{
+				CertificateTemplate:             "ClientAuth",
+				CertificateAuthorityLogicalName: "IssuingCA2",
+				AllowedCertificateAuthorities:   []string{"IssuingCA1", "IssuingCA2"},
+				AllowedSANTypes:                 []commandissuer.SANType{commandissuer.SANTypeEmail},
+				EnrollmentParameters:            map[string]string{"SubTemplate": "Client", "Region": "EU"},
+				MetadataFromLabels:              map[string]string{"team": "Team"},
+				MetadataFromAnnotations:         map[string]string{"example.com/owner": "Owner"},
+				CertificateCollection:           "Kubernetes Certificates",
+				DefaultDuration:                 &metav1.Duration{Duration: 24 * time.Hour},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec.DeepCopy()
+			assert.Equal(t, &tt.expected, commandissuer.MergeProfile(spec, profile))
+			// The issuer isn't modified
+			assert.Equal(t, &tt.spec, spec)
+		})
+	}
+}
+
+func TestSpecWithProfile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&commandissuer.CommandIssuerProfile{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ns1"},
+			Spec:       commandissuer.CommandIssuerProfileSpec{CertificateTemplate: "WebServer"},
+		}).
+		Build()
+
+	spec := &commandissuer.IssuerSpec{CertificateTemplate: "ClientAuth"}
+	merged, err := specWithProfile(context.TODO(), fakeClient, spec, "ns1")
+	require.NoError(t, err)
+	assert.Same(t, spec, merged, "an issuer without a profile is used as is")
+
+	merged, err = specWithProfile(context.TODO(), fakeClient, &commandissuer.IssuerSpec{ProfileName: "default"}, "ns1")
+	require.NoError(t, err)
+	assert.Equal(t, "WebServer", merged.CertificateTemplate)
+
+	_, err = specWithProfile(context.TODO(), fakeClient, &commandissuer.IssuerSpec{ProfileName: "default"}, "ns2")
+	assert.ErrorIs(t, err, errGetProfile)
+
+	assert.Equal(t, "ns1", profileNamespace(&commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1"}}, "kube-system"))
+	assert.Equal(t, "kube-system", profileNamespace(&commandissuer.ClusterIssuer{}, "kube-system"))
+}
+
+func TestIssuersForProfile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"}, Spec: commandissuer.IssuerSpec{ProfileName: "default"}},
+			&commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer2", Namespace: "ns1"}, Spec: commandissuer.IssuerSpec{ProfileName: "other"}},
+			&commandissuer.Issuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer3", Namespace: "ns2"}, Spec: commandissuer.IssuerSpec{ProfileName: "default"}},
+			&commandissuer.ClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "clusterissuer1"}, Spec: commandissuer.IssuerSpec{ProfileName: "default"}},
+		).
+		Build()
+
+	tests := []struct {
+		name      string
+		kind      string
+		namespace string
+		expected  []reconcile.Request
+	}{
+		{
+			name:      "Issuer",
+			kind:      "Issuer",
+			namespace: "ns1",
+			expected:  []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "issuer1", Namespace: "ns1"}}},
+		},
+		{
+			name:      "ClusterIssuer",
+			kind:      "ClusterIssuer",
+			namespace: "kube-system",
+			expected:  []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "clusterissuer1"}}},
+		},
+		{
+			name:      "ClusterIssuerProfileInOtherNamespace",
+			kind:      "ClusterIssuer",
+			namespace: "ns1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &IssuerReconciler{Client: fakeClient, Kind: tt.kind, ClusterResourceNamespace: "kube-system"}
+			profile := &commandissuer.CommandIssuerProfile{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: tt.namespace}}
+			assert.Equal(t, tt.expected, r.issuersForProfile(context.TODO(), profile))
+		})
+	}
+}
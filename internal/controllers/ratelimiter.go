@@ -0,0 +1,221 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// rateLimitLeaseLabel labels the Leases through which the replicas share the rate limit
+	rateLimitLeaseLabel = "command-issuer.keyfactor.com/rate-limit"
+	// rateLimitLeasePrefix is the prefix of the name of the Lease of each replica
+	rateLimitLeasePrefix = "command-issuer-rate-limit-"
+	// defaultRateLimitLeaseDuration is how long the Lease of a replica is valid after it was renewed
+	defaultRateLimitLeaseDuration = 15 * time.Second
+)
+
+// DistributedRateLimiter limits the requests of every Command client of the controller to a budget
+// that is shared by all replicas, so that the aggregate rate of requests to Command doesn't grow with
+// the number of replicas. Once started, every replica holds a Lease that it renews periodically, and
+// limits its requests to its share of the budget, i.e. the budget divided by the number of replicas
+// whose Lease hasn't expired. Only replicas that reconcile hold a Lease, so with leader election the
+// standby replicas don't take a share of the budget. If the Leases can't be read or renewed, the
+// replica keeps its last share, falling back to limiting its own requests. If it isn't started, the
+// replica uses the entire budget.
+type DistributedRateLimiter struct {
+	// Client creates, renews and deletes the Leases
+	Client client.Client
+	// Reader reads the Leases. It should read from the API server, so that the manager doesn't cache
+	// every Lease of the namespace.
+	Reader client.Reader
+	// Namespace is the namespace of the Leases
+	Namespace string
+	// Identity identifies the replica, e.g. the name of its pod
+	Identity string
+	// LeaseDuration is how long a Lease is valid after it was renewed. Defaults to 15 seconds.
+	LeaseDuration time.Duration
+	// LeaderElection is true if the replicas elect a leader, in which case only the leader reconciles
+	// and calls Command, so only the leader shares the budget
+	LeaderElection bool
+	Clock          clock.WithTicker
+
+	requestsPerMinute int
+	burst             int
+	limiter           *rate.Limiter
+	replicas          int
+}
+
+// NewDistributedRateLimiter returns a DistributedRateLimiter with a budget of requestsPerMinute
+// requests to Command, of which burst requests may be sent at once
+func NewDistributedRateLimiter(requestsPerMinute, burst int) *DistributedRateLimiter {
+	l := &DistributedRateLimiter{
+		requestsPerMinute: requestsPerMinute,
+		burst:             burst,
+		limiter:           rate.NewLimiter(rate.Inf, 1),
+	}
+	l.setReplicas(1)
+	return l
+}
+
+// Limiter returns the rate limiter of the requests of this replica
+func (l *DistributedRateLimiter) Limiter() *rate.Limiter {
+	return l.limiter
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. With leader election, a replica only
+// shares the budget once it is elected, since the controllers of the other replicas don't call Command.
+func (l *DistributedRateLimiter) NeedLeaderElection() bool {
+	return l.LeaderElection
+}
+
+// Start implements manager.Runnable. It renews the Lease of the replica and recomputes its share of
+// the budget until ctx is done, and then deletes the Lease so that the other replicas take over its
+// share without waiting for it to expire.
+func (l *DistributedRateLimiter) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("rate-limiter")
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	ticker := l.clock().NewTicker(l.leaseDuration() / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := l.sync(ctx); err != nil {
+			log.Error(err, fmt.Sprintf("Failed to coordinate the rate limit of requests to Command with the other replicas. Limiting this replica to its last share of %d replicas.", l.replicas))
+		}
+
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: l.Namespace, Name: l.leaseName()}}
+			if err := l.Client.Delete(releaseCtx, lease); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to delete the rate limit Lease of this replica")
+			}
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// sync renews the Lease of the replica, and sets its share of the budget from the number of replicas
+// holding a Lease that hasn't expired. Expired Leases, e.g. of deleted pods, are deleted.
+func (l *DistributedRateLimiter) sync(ctx context.Context) error {
+	if err := l.renew(ctx); err != nil {
+		return fmt.Errorf("failed to renew the Lease of this replica: %w", err)
+	}
+
+	var leases coordinationv1.LeaseList
+	if err := l.Reader.List(ctx, &leases, client.InNamespace(l.Namespace), client.HasLabels{rateLimitLeaseLabel}); err != nil {
+		return fmt.Errorf("failed to list the Leases of the replicas: %w", err)
+	}
+
+	now := l.clock().Now()
+	replicas := 0
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if lease.Name == l.leaseName() || !leaseExpired(lease, now) {
+			replicas++
+			continue
+		}
+		if err := l.Client.Delete(ctx, lease); client.IgnoreNotFound(err) != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to delete an expired rate limit Lease", "lease", lease.Name)
+		}
+	}
+
+	if replicas != l.replicas {
+		ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("Sharing the rate limit of %d requests per minute to Command with %d replicas", l.requestsPerMinute, replicas))
+		l.setReplicas(replicas)
+	}
+	return nil
+}
+
+// renew creates or renews the Lease of the replica
+func (l *DistributedRateLimiter) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(l.clock().Now())
+	durationSeconds := int32(l.leaseDuration() / time.Second)
+
+	var lease coordinationv1.Lease
+	err := l.Reader.Get(ctx, client.ObjectKey{Namespace: l.Namespace, Name: l.leaseName()}, &lease)
+	if apierrors.IsNotFound(err) {
+		lease = coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: l.Namespace,
+				Name:      l.leaseName(),
+				Labels:    map[string]string{rateLimitLeaseLabel: "true"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.Identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		return l.Client.Create(ctx, &lease)
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &l.Identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	return l.Client.Update(ctx, &lease)
+}
+
+// setReplicas limits this replica to its share of the budget
+func (l *DistributedRateLimiter) setReplicas(replicas int) {
+	l.replicas = replicas
+	l.limiter.SetLimit(rate.Limit(float64(l.requestsPerMinute) / 60 / float64(replicas)))
+	l.limiter.SetBurst(max(l.burst/replicas, 1))
+}
+
+func (l *DistributedRateLimiter) leaseName() string {
+	return rateLimitLeasePrefix + l.Identity
+}
+
+func (l *DistributedRateLimiter) leaseDuration() time.Duration {
+	if l.LeaseDuration <= 0 {
+		return defaultRateLimitLeaseDuration
+	}
+	return l.LeaseDuration
+}
+
+func (l *DistributedRateLimiter) clock() clock.WithTicker {
+	if l.Clock == nil {
+		return clock.RealClock{}
+	}
+	return l.Clock
+}
+
+// leaseExpired returns true if the Lease wasn't renewed within its duration
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return !now.Before(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// rateLimitLease returns the Lease of a replica that was last renewed at renewTime
+func rateLimitLease(identity string, renewTime time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "command-issuer-system",
+			Name:      rateLimitLeasePrefix + identity,
+			Labels:    map[string]string{rateLimitLeaseLabel: "true"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To(identity),
+			LeaseDurationSeconds: ptr.To(int32(15)),
+			RenewTime:            ptr.To(metav1.NewMicroTime(renewTime)),
+		},
+	}
+}
+
+func TestDistributedRateLimiterSync(t *testing.T) {
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+	now := time.Now()
+	clock := clocktesting.NewFakeClock(now)
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			rateLimitLease("replica-b", now.Add(-5*time.Second)),
+			rateLimitLease("replica-c", now.Add(-time.Minute)),
+		).
+		Build()
+
+	limiter := NewDistributedRateLimiter(600, 10)
+	limiter.Client = fakeClient
+	limiter.Reader = fakeClient
+	limiter.Namespace = "command-issuer-system"
+	limiter.Identity = "replica-a"
+	limiter.Clock = clock
+
+	// Until the replicas are known, the replica uses the entire budget
+	assert.Equal(t, rate.Limit(10), limiter.Limiter().Limit())
+	assert.Equal(t, 10, limiter.Limiter().Burst())
+
+	// The budget is shared with replica-b, whose Lease hasn't expired. The expired Lease of replica-c
+	// is deleted.
+	require.NoError(t, limiter.sync(ctx))
+	assert.Equal(t, rate.Limit(5), limiter.Limiter().Limit())
+	assert.Equal(t, 5, limiter.Limiter().Burst())
+
+	var lease coordinationv1.Lease
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "command-issuer-system", Name: rateLimitLeasePrefix + "replica-a"}, &lease))
+	assert.Equal(t, "replica-a", *lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(15), *lease.Spec.LeaseDurationSeconds)
+	err := fakeClient.Get(ctx, client.ObjectKey{Namespace: "command-issuer-system", Name: rateLimitLeasePrefix + "replica-c"}, &lease)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Once the Lease of replica-b expires, the replica uses the entire budget again and renews its Lease
+	clock.Step(15 * time.Second)
+	require.NoError(t, limiter.sync(ctx))
+	assert.Equal(t, rate.Limit(10), limiter.Limiter().Limit())
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "command-issuer-system", Name: rateLimitLeasePrefix + "replica-a"}, &lease))
+	assert.True(t, lease.Spec.RenewTime.Time.Equal(clock.Now().Truncate(time.Microsecond)))
+}
+
+func TestDistributedRateLimiterFallback(t *testing.T) {
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
+	now := time.Now()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	var unavailable bool
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(rateLimitLease("replica-b", now)).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if unavailable {
+					return apierrors.NewServiceUnavailable("unavailable")
+				}
+				return c.List(ctx, list, opts...)
+			},
+		}).
+		Build()
+
+	limiter := NewDistributedRateLimiter(600, 10)
+	limiter.Client = fakeClient
+	limiter.Reader = fakeClient
+	limiter.Namespace = "command-issuer-system"
+	limiter.Identity = "replica-a"
+	limiter.Clock = clocktesting.NewFakeClock(now)
+
+	require.NoError(t, limiter.sync(ctx))
+	assert.Equal(t, rate.Limit(5), limiter.Limiter().Limit())
+
+	// If the Leases can't be read, the replica keeps its last share
+	unavailable = true
+	assert.Error(t, limiter.sync(ctx))
+	assert.Equal(t, rate.Limit(5), limiter.Limiter().Limit())
+}
+
+func TestDistributedRateLimiterStart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	limiter := NewDistributedRateLimiter(600, 10)
+	limiter.Client = fakeClient
+	limiter.Reader = fakeClient
+	limiter.Namespace = "command-issuer-system"
+	limiter.Identity = "replica-a"
+	assert.False(t, limiter.NeedLeaderElection())
+
+	// With leader election, standby replicas don't take a share of the budget
+	limiter.LeaderElection = true
+	assert.True(t, limiter.NeedLeaderElection())
+
+	ctx, cancel := context.WithCancel(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)))
+	done := make(chan error)
+	go func() { done <- limiter.Start(ctx) }()
+
+	key := client.ObjectKey{Namespace: "command-issuer-system", Name: rateLimitLeasePrefix + "replica-a"}
+	assert.Eventually(t, func() bool {
+		return fakeClient.Get(context.TODO(), key, &coordinationv1.Lease{}) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The Lease is deleted when the replica stops, so the other replicas take over its share
+	cancel()
+	require.NoError(t, <-done)
+	err := fakeClient.Get(context.TODO(), key, &coordinationv1.Lease{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -0,0 +1,310 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultReadinessInterval = 30 * time.Second
+	defaultReadinessTimeout  = 5 * time.Second
+)
+
+// errNotProbed is reported by the readiness check until Command has been probed for the first time
+var errNotProbed = errors.New("Keyfactor Command has not been probed yet")
+
+// CommandReadinessChecker reports the controller as not ready when none of the Keyfactor Command
+// instances referenced by Issuers and ClusterIssuers can be reached. The Command hosts are resolved
+// like the signer resolves them, including fallback hostnames and hostnames read from Secrets and
+// ConfigMaps, and are reached through the proxy the signer would use. The probe only opens a TCP
+// connection to each Command host or its proxy. It runs in the background every Interval, so that
+// the readiness endpoint only reports the result of the last probe and never waits for Command.
+type CommandReadinessChecker struct {
+	Client   client.Reader
+	Clock    clock.Clock
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// ConfigClient reads the Secrets and ConfigMaps that hold the hostnames of issuers with
+	// hostnameKey or hostnameConfigMapName. If nil, the hostname field of these issuers is probed.
+	ConfigClient                      issuerutil.ConfigClient
+	ClusterResourceNamespace          string
+	ClusterIssuerSecretNamespace      string
+	SecretAccessGrantedAtClusterLevel bool
+	// DisableClusterIssuers skips probing the Command instances of ClusterIssuers, so that they aren't
+	// listed if the controller isn't allowed to read them
+	DisableClusterIssuers bool
+
+	dial  func(ctx context.Context, network, address string) (net.Conn, error)
+	proxy func(*http.Request) (*url.URL, error)
+
+	mu      sync.Mutex
+	probed  bool
+	lastErr error
+}
+
+// Check implements healthz.Checker. It returns the result of the last probe.
+func (c *CommandReadinessChecker) Check(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.probed {
+		return errNotProbed
+	}
+	return c.lastErr
+}
+
+// Start implements manager.Runnable. It probes Command every Interval until ctx is done.
+func (c *CommandReadinessChecker) Start(ctx context.Context) error {
+	for {
+		c.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.clock().After(c.interval()):
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica reports its own
+// readiness, so the probe runs whether or not the replica is the leader.
+func (c *CommandReadinessChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// refresh probes Command and records the result for Check
+func (c *CommandReadinessChecker) refresh(ctx context.Context) {
+	err := c.probe(ctx)
+	if err != nil && ctx.Err() != nil {
+		// The probe was interrupted by the shutdown, so it says nothing about Command
+		return
+	}
+	if err != nil {
+		log.FromContext(ctx).V(1).Info(fmt.Sprintf("Readiness probe of Keyfactor Command failed: %v", err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probed = true
+	c.lastErr = err
+}
+
+// probe attempts to connect to every Command host referenced by an Issuer or ClusterIssuer, and
+// returns nil if at least one of them is reachable or if no Command hosts are configured.
+func (c *CommandReadinessChecker) probe(ctx context.Context) error {
+	hosts, err := c.commandHosts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list Command hosts: %w", err)
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	dial := c.dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	var lastErr error
+	for _, host := range hosts {
+		address, err := c.dialAddress(host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, c.timeout())
+		conn, err := dial(dialCtx, "tcp", address)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_ = conn.Close()
+		return nil
+	}
+
+	return fmt.Errorf("failed to reach Keyfactor Command at %s: %w", strings.Join(hosts, ", "), lastErr)
+}
+
+// dialAddress returns the address that is dialed to reach the Command host, which is the address of
+// the proxy that the signer uses for the host, if any
+func (c *CommandReadinessChecker) dialAddress(host string) (string, error) {
+	proxy := c.proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: host}})
+	if err != nil {
+		return "", fmt.Errorf("invalid proxy configuration for %s: %w", host, err)
+	}
+	if proxyURL == nil {
+		return host, nil
+	}
+
+	if proxyURL.Port() != "" {
+		return proxyURL.Host, nil
+	}
+	port := "80"
+	if proxyURL.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port), nil
+}
+
+// commandHosts returns the sorted, de-duplicated host:port addresses of the Command instances
+// referenced by all Issuers and ClusterIssuers in the cluster.
+func (c *CommandReadinessChecker) commandHosts(ctx context.Context) ([]string, error) {
+	var issuers commandissuer.IssuerList
+	if err := c.Client.List(ctx, &issuers); err != nil {
+		return nil, err
+	}
+	var clusterIssuers commandissuer.ClusterIssuerList
+	if !c.DisableClusterIssuers {
+		if err := c.Client.List(ctx, &clusterIssuers); err != nil {
+			return nil, err
+		}
+	}
+
+	var objects []client.Object
+	for i := range issuers.Items {
+		objects = append(objects, &issuers.Items[i])
+	}
+	for i := range clusterIssuers.Items {
+		objects = append(objects, &clusterIssuers.Items[i])
+	}
+
+	unique := make(map[string]struct{})
+	for _, issuer := range objects {
+		for _, hostname := range c.issuerHostnames(ctx, issuer) {
+			unique[commandAddress(hostname)] = struct{}{}
+		}
+	}
+
+	hosts := make([]string, 0, len(unique))
+	for host := range unique {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// issuerHostnames returns the hostname and the fallback hostnames of the Command instance of the
+// issuer. The hostname is read from the ConfigMap or Secret of the issuer if it configures one, and
+// the hostname field of the issuer is used if they can't be read.
+func (c *CommandReadinessChecker) issuerHostnames(ctx context.Context, issuer client.Object) []string {
+	spec, _, err := issuerutil.GetSpecAndStatus(issuer)
+	if err != nil {
+		return nil
+	}
+
+	hostname := spec.Hostname
+	if c.ConfigClient != nil && (spec.HostnameConfigMapName != "" || spec.HostnameKey != "") {
+		if resolved, err := c.resolveHostname(ctx, issuer, spec); err == nil {
+			hostname = resolved
+		} else {
+			log.FromContext(ctx).V(1).Info(fmt.Sprintf("Failed to read the Command hostname of issuer %s, probing its hostname field instead: %v", client.ObjectKeyFromObject(issuer), err))
+		}
+	}
+
+	var hostnames []string
+	if hostname != "" {
+		hostnames = append(hostnames, hostname)
+	}
+	return append(hostnames, spec.FallbackHostnames...)
+}
+
+// resolveHostname reads the hostname of the Command instance of the issuer from the ConfigMap or
+// the Secret that the issuer references, like the signer does
+func (c *CommandReadinessChecker) resolveHostname(ctx context.Context, issuer client.Object, spec *commandissuer.IssuerSpec) (string, error) {
+	secretNamespace, err := issuerutil.GetSecretNamespace(issuer, c.ClusterResourceNamespace, c.ClusterIssuerSecretNamespace, c.SecretAccessGrantedAtClusterLevel)
+	if err != nil {
+		return "", err
+	}
+
+	if spec.HostnameConfigMapName != "" {
+		spec, err = specWithConfigMapHostname(ctx, c.ConfigClient, spec, secretNamespace)
+		if err != nil {
+			return "", err
+		}
+		return spec.Hostname, nil
+	}
+
+	var secret corev1.Secret
+	if err := c.ConfigClient.GetSecret(ctx, types.NamespacedName{Name: spec.SecretName, Namespace: secretNamespace}, &secret); err != nil {
+		return "", err
+	}
+	return signer.CommandHostname(spec, secret.Data)
+}
+
+func (c *CommandReadinessChecker) clock() clock.Clock {
+	if c.Clock == nil {
+		return clock.RealClock{}
+	}
+	return c.Clock
+}
+
+func (c *CommandReadinessChecker) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultReadinessInterval
+	}
+	return c.Interval
+}
+
+func (c *CommandReadinessChecker) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultReadinessTimeout
+	}
+	return c.Timeout
+}
+
+// commandAddress converts the hostname field of an Issuer spec, which may contain a scheme
+// and a trailing path, into a host:port address. The port defaults to 443.
+func commandAddress(hostname string) string {
+	host := hostname
+	if u, err := url.Parse(hostname); err == nil && u.Host != "" {
+		host = u.Host
+	} else {
+		host = strings.SplitN(hostname, "/", 2)[0]
+	}
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "443")
+	}
+	return host
+}
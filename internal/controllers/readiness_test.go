@@ -0,0 +1,275 @@
+/*
+Copyright © 2023 Keyfactor
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCommandReadinessChecker(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	issuers := []client.Object{
+		&commandissuer.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+			Spec:       commandissuer.IssuerSpec{Hostname: "https://command.example.com/KeyfactorAPI"},
+		},
+		&commandissuer.ClusterIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterissuer1"},
+			Spec:       commandissuer.IssuerSpec{Hostname: "backup.example.com:8443"},
+		},
+	}
+
+	secretHostname := []client.Object{
+		&commandissuer.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+			Spec: commandissuer.IssuerSpec{
+				Hostname:          "command.example.com",
+				HostnameKey:       "host",
+				SecretName:        "auth",
+				FallbackHostnames: []string{"fallback.example.com"},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "ns1"},
+			Data:       map[string][]byte{"host": []byte("secret.example.com")},
+		},
+	}
+
+	type testCase struct {
+		objects               []client.Object
+		reachable             map[string]bool
+		proxy                 string
+		disableClusterIssuers bool
+		expectedDials         []string
+		expectedError         bool
+	}
+
+	tests := map[string]testCase{
+		"no-issuers": {
+			expectedDials: nil,
+		},
+		"all-reachable": {
+			objects:       issuers,
+			reachable:     map[string]bool{"backup.example.com:8443": true, "command.example.com:443": true},
+			expectedDials: []string{"backup.example.com:8443"},
+		},
+		"one-reachable": {
+			objects:       issuers,
+			reachable:     map[string]bool{"command.example.com:443": true},
+			expectedDials: []string{"backup.example.com:8443", "command.example.com:443"},
+		},
+		"none-reachable": {
+			objects:       issuers,
+			expectedDials: []string{"backup.example.com:8443", "command.example.com:443"},
+			expectedError: true,
+		},
+		"cluster-issuers-disabled": {
+			objects:               issuers,
+			disableClusterIssuers: true,
+			expectedDials:         []string{"command.example.com:443"},
+			expectedError:         true,
+		},
+		"secret-hostname-and-fallbacks": {
+			objects:       secretHostname,
+			reachable:     map[string]bool{"secret.example.com:443": true},
+			expectedDials: []string{"fallback.example.com:443", "secret.example.com:443"},
+		},
+		"missing-secret": {
+			objects:       secretHostname[:1],
+			expectedDials: []string{"command.example.com:443", "fallback.example.com:443"},
+			expectedError: true,
+		},
+		"proxy": {
+			objects:       issuers[:1],
+			proxy:         "http://proxy.example.com:3128",
+			reachable:     map[string]bool{"proxy.example.com:3128": true},
+			expectedDials: []string{"proxy.example.com:3128"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var dials []string
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objects...).Build()
+			checker := &CommandReadinessChecker{
+				Client:                            fakeClient,
+				Clock:                             clocktesting.NewFakeClock(time.Now()),
+				ConfigClient:                      NewFakeConfigClient(fakeClient),
+				SecretAccessGrantedAtClusterLevel: true,
+				DisableClusterIssuers:             tc.disableClusterIssuers,
+				proxy: func(*http.Request) (*url.URL, error) {
+					if tc.proxy == "" {
+						return nil, nil
+					}
+					return url.Parse(tc.proxy)
+				},
+				dial: func(_ context.Context, _, address string) (net.Conn, error) {
+					dials = append(dials, address)
+					if !tc.reachable[address] {
+						return nil, errors.New("connection refused")
+					}
+					client, server := net.Pipe()
+					_ = server.Close()
+					return client, nil
+				},
+			}
+
+			req := httptest.NewRequest("GET", "/readyz", nil)
+			assert.ErrorIs(t, checker.Check(req), errNotProbed)
+
+			checker.refresh(context.Background())
+			err := checker.Check(req)
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedDials, dials)
+		})
+	}
+
+	t.Run("background", func(t *testing.T) {
+		fakeClock := clocktesting.NewFakeClock(time.Now())
+		var mu sync.Mutex
+		dials := 0
+		checker := &CommandReadinessChecker{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(issuers[0]).Build(),
+			Clock:    fakeClock,
+			Interval: time.Minute,
+			dial: func(context.Context, string, string) (net.Conn, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				dials++
+				return nil, errors.New("connection refused")
+			},
+		}
+		dialCount := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return dials
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- checker.Start(ctx) }()
+
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		require.Eventually(t, func() bool { return dialCount() == 1 && fakeClock.HasWaiters() }, 5*time.Second, 10*time.Millisecond)
+		assert.Error(t, checker.Check(req))
+		assert.Error(t, checker.Check(req))
+		assert.Equal(t, 1, dialCount(), "Check must not probe Command")
+
+		fakeClock.Step(time.Minute)
+		require.Eventually(t, func() bool { return dialCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		assert.NoError(t, <-done)
+	})
+}
+
+func TestCommandReadinessCheckerSharedConfigClient(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, commandissuer.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	issuer := &commandissuer.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "issuer1", Namespace: "ns1"},
+		Spec:       commandissuer.IssuerSpec{Hostname: "command.example.com", HostnameKey: "host", SecretName: "auth"},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		issuer,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "ns1"},
+			Data:       map[string][]byte{"host": []byte("secret.example.com")},
+		},
+	).Build()
+	configClient := NewFakeConfigClient(fakeClient)
+
+	var mu sync.Mutex
+	var dials []string
+	checker := &CommandReadinessChecker{
+		Client:                            fakeClient,
+		Clock:                             clocktesting.NewFakeClock(time.Now()),
+		ConfigClient:                      configClient,
+		SecretAccessGrantedAtClusterLevel: true,
+		dial: func(_ context.Context, _, address string) (net.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			dials = append(dials, address)
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	// The probe reads the hostname with its own context while reconciles that already returned read
+	// from the same config client with their cancelled contexts
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_, err := newIssuerSigner(cancelled, configClient, nil, &issuer.Spec, "ns1", false, nil)
+			assert.ErrorIs(t, err, errGetAuthSecret)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		checker.refresh(context.Background())
+	}
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, dials, 50)
+	for _, dial := range dials {
+		assert.Equal(t, "secret.example.com:443", dial)
+	}
+}
+
+func TestCommandAddress(t *testing.T) {
+	tests := map[string]string{
+		"command.example.com":                      "command.example.com:443",
+		"command.example.com:8443":                 "command.example.com:8443",
+		"https://command.example.com/KeyfactorAPI": "command.example.com:443",
+		"command.example.com/KeyfactorAPI":         "command.example.com:443",
+		"https://10.0.0.1:8443":                    "10.0.0.1:8443",
+	}
+
+	for hostname, expected := range tests {
+		assert.Equal(t, expected, commandAddress(hostname), hostname)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// errInvalidSecret is returned when a Secret referenced by an issuer has the wrong type, or doesn't
+// have the keys the issuer expects
+var errInvalidSecret = errors.New("invalid Secret")
+
+// unsupportedCredentialsSecretTypes are the built-in Secret types that can't hold Command credentials.
+// Secrets of these types are usually referenced by mistake, e.g. the TLS Secret of the Command server.
+var unsupportedCredentialsSecretTypes = map[corev1.SecretType]bool{
+	corev1.SecretTypeTLS:                 true,
+	corev1.SecretTypeDockercfg:           true,
+	corev1.SecretTypeDockerConfigJson:    true,
+	corev1.SecretTypeServiceAccountToken: true,
+	corev1.SecretTypeSSHAuth:             true,
+	corev1.SecretTypeBootstrapToken:      true,
+}
+
+// validateCredentialsSecret verifies that the Secret referenced by the field of the issuer holds the
+// Command username and password under the keys the issuer expects
+func validateCredentialsSecret(secret *corev1.Secret, field string, spec *commandissuer.IssuerSpec) error {
+	if unsupportedCredentialsSecretTypes[secret.Type] {
+		return fmt.Errorf("%w: %s references Secret %s/%s of type %q, which can't hold Command credentials. Reference a Secret of type %q or %q with the Command username and password instead", errInvalidSecret, field, secret.Namespace, secret.Name, secret.Type, corev1.SecretTypeBasicAuth, corev1.SecretTypeOpaque)
+	}
+
+	usernameKey, passwordKey := signer.CredentialSecretKeys(spec)
+	for _, key := range []struct{ name, value string }{{"username", usernameKey}, {"password", passwordKey}} {
+		value, ok := secret.Data[key.value]
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: Secret %s/%s referenced by %s has no %q key with the Command %s. Its keys are: %s", errInvalidSecret, secret.Namespace, secret.Name, field, key.value, key.name, secretKeys(secret))
+		case len(value) == 0:
+			return fmt.Errorf("%w: the %q key of Secret %s/%s referenced by %s is empty", errInvalidSecret, key.value, secret.Namespace, secret.Name, field)
+		case len(bytes.TrimSpace(value)) != len(value):
+			// Usually left over from creating the Secret from the output of echo or a file
+			return fmt.Errorf("%w: the Command %s in the %q key of Secret %s/%s referenced by %s starts or ends with whitespace, e.g. a trailing newline", errInvalidSecret, key.name, key.value, secret.Namespace, secret.Name, field)
+		}
+	}
+	return nil
+}
+
+// validateCASecret verifies that the Secret referenced by caSecretName holds the PEM encoded CA
+// certificates of the Command server and nothing else, since the certificates may be stored under any
+// key of the Secret
+func validateCASecret(secret *corev1.Secret) error {
+	if secret.Type == corev1.SecretTypeTLS {
+		return fmt.Errorf("%w: caSecretName references Secret %s/%s of type %q, which holds a certificate and its private key. Copy the CA certificate into a Secret with a single key, e.g. ca.crt, instead", errInvalidSecret, secret.Namespace, secret.Name, secret.Type)
+	}
+
+	switch len(secret.Data) {
+	case 0:
+		return fmt.Errorf("%w: Secret %s/%s referenced by caSecretName is empty. It must contain the PEM encoded CA certificate", errInvalidSecret, secret.Namespace, secret.Name)
+	case 1:
+	default:
+		return fmt.Errorf("%w: Secret %s/%s referenced by caSecretName must contain a single key with the PEM encoded CA certificate, but has the keys %s", errInvalidSecret, secret.Namespace, secret.Name, secretKeys(secret))
+	}
+
+	for key, value := range secret.Data {
+		certificates := 0
+		for rest := value; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				return fmt.Errorf("%w: the %q key of Secret %s/%s referenced by caSecretName contains a PEM block of type %q. It must only contain CA certificates", errInvalidSecret, key, secret.Namespace, secret.Name, block.Type)
+			}
+			certificates++
+		}
+		if certificates == 0 {
+			return fmt.Errorf("%w: the %q key of Secret %s/%s referenced by caSecretName doesn't contain a PEM encoded certificate", errInvalidSecret, key, secret.Namespace, secret.Name)
+		}
+	}
+	return nil
+}
+
+// secretKeys returns the sorted keys of the Secret for error messages
+func secretKeys(secret *corev1.Secret) string {
+	if len(secret.Data) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, fmt.Sprintf("%q", key))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+)
+
+// withShutdownGracePeriod returns a copy of ctx that is cancelled gracePeriod after ctx is
+// cancelled, rather than immediately. The manager cancels the context of in-flight reconciles when
+// the controller shuts down, which would abandon an enrollment after Command issued the certificate
+// but before it is recorded in the cluster. The copy lets the reconcile complete and persist its
+// status, while the manager stops starting new reconciles. If gracePeriod is zero, the copy is
+// cancelled with ctx. The returned cancel function must be called to release its resources.
+func withShutdownGracePeriod(ctx context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	if gracePeriod <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-drainCtx.Done():
+		}
+	})
+	return drainCtx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithShutdownGracePeriod(t *testing.T) {
+	type contextKey struct{}
+
+	t.Run("drains-in-flight-reconciles", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "value"))
+		ctx, cancel := withShutdownGracePeriod(parent, 100*time.Millisecond)
+		defer cancel()
+
+		assert.Equal(t, "value", ctx.Value(contextKey{}))
+
+		cancelParent()
+		assert.NoError(t, ctx.Err(), "the context must outlive the parent for the grace period")
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("the context wasn't cancelled after the grace period")
+		}
+	})
+
+	t.Run("no-grace-period", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := withShutdownGracePeriod(parent, 0)
+		defer cancel()
+
+		cancelParent()
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := withShutdownGracePeriod(context.Background(), time.Hour)
+		cancel()
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	issuerutil "github.com/Keyfactor/command-issuer/internal/issuer/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var errGetHostnameConfigMap = errors.New("hostnameConfigMapName specified a name, but failed to get ConfigMap containing the Command hostname")
+
+// newIssuerSigner reads the Secrets referenced by the issuer spec from secretNamespace and builds a
+// Command signer from them. It is shared by the reconcilers of cert-manager CertificateRequests and
+// Kubernetes CertificateSigningRequests. The secrets are read from the API server on every call, so
+// rotated credentials are used by the next enrollment without restarting the controller.
+func newIssuerSigner(ctx context.Context, configClient issuerutil.ConfigClient, signerBuilder signer.CommandSignerBuilder, issuerSpec *commandissuer.IssuerSpec, secretNamespace string, insecureSkipVerify bool, annotations map[string]string) (signer.Signer, error) {
+	if configClient == nil {
+		return nil, errConfigClientUnavailable
+	}
+
+	authSecretName := types.NamespacedName{
+		Name:      issuerSpec.SecretName,
+		Namespace: secretNamespace,
+	}
+
+	var authSecret corev1.Secret
+	if err := configClient.GetSecret(ctx, authSecretName, &authSecret); err != nil {
+		return nil, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, authSecretName, err)
+	}
+
+	// Pending enrollments are polled with the read credentials if the issuer has any
+	var readSecret corev1.Secret
+	if issuerSpec.ReadSecretName != "" {
+		readSecretName := types.NamespacedName{
+			Name:      issuerSpec.ReadSecretName,
+			Namespace: secretNamespace,
+		}
+		if err := configClient.GetSecret(ctx, readSecretName, &readSecret); err != nil {
+			return nil, fmt.Errorf("%w, secret name: %s, reason: %v", errGetReadSecret, readSecretName, err)
+		}
+	}
+
+	// If the CA secret name is not specified, we will not attempt to retrieve it
+	var caSecret corev1.Secret
+	if issuerSpec.CaSecretName != "" {
+		caSecretName := types.NamespacedName{
+			Name:      issuerSpec.CaSecretName,
+			Namespace: secretNamespace,
+		}
+		if err := configClient.GetSecret(ctx, caSecretName, &caSecret); err != nil {
+			return nil, fmt.Errorf("%w, secret name: %s, reason: %v", errGetCaSecret, caSecretName, err)
+		}
+	}
+
+	issuerSpec, err := specWithConfigMapHostname(ctx, configClient, issuerSpec, secretNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	commandSigner, err := signerBuilder(ctx, specWithInsecureSkipVerify(issuerSpec, insecureSkipVerify), annotations, authSecret.Data, readSecret.Data, caSecret.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSignerBuilder, err)
+	}
+	return commandSigner, nil
+}
+
+// specWithConfigMapHostname returns the issuer spec, or a copy of it with the hostname read from the
+// ConfigMap referenced by hostnameConfigMapName in secretNamespace. The hostname field of the issuer
+// is kept if the ConfigMap has no hostname. The hostnameKey field is cleared in the copy so that the
+// hostname isn't read from the Secrets as well.
+func specWithConfigMapHostname(ctx context.Context, configClient issuerutil.ConfigClient, spec *commandissuer.IssuerSpec, secretNamespace string) (*commandissuer.IssuerSpec, error) {
+	if spec.HostnameConfigMapName == "" {
+		return spec, nil
+	}
+
+	configMapName := types.NamespacedName{
+		Name:      spec.HostnameConfigMapName,
+		Namespace: secretNamespace,
+	}
+
+	var configMap corev1.ConfigMap
+	if err := configClient.GetConfigMap(ctx, configMapName, &configMap); err != nil {
+		return nil, fmt.Errorf("%w, configmap name: %s, reason: %v", errGetHostnameConfigMap, configMapName, err)
+	}
+
+	hostnameKey := spec.HostnameKey
+	if hostnameKey == "" {
+		hostnameKey = signer.DefaultHostnameKey
+	}
+
+	spec = spec.DeepCopy()
+	spec.HostnameKey = ""
+	if hostname := configMap.Data[hostnameKey]; hostname != "" {
+		spec.Hostname = hostname
+	} else if spec.Hostname == "" {
+		return nil, fmt.Errorf("%w: the ConfigMap %s has no hostname in the %q key", errGetHostnameConfigMap, configMapName, hostnameKey)
+	}
+	return spec, nil
+}
+
+// issuerMetadata returns the Command metadata fields mapped from the labels and annotations of the
+// issuer by its metadataFromLabels and metadataFromAnnotations fields. Labels and annotations that
+// aren't set on the issuer are skipped.
+func issuerMetadata(issuer client.Object, spec *commandissuer.IssuerSpec) map[string]string {
+	if len(spec.MetadataFromLabels)+len(spec.MetadataFromAnnotations) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string)
+	for key, metadataField := range spec.MetadataFromLabels {
+		if value, ok := issuer.GetLabels()[key]; ok {
+			metadata[metadataField] = value
+		}
+	}
+	for key, metadataField := range spec.MetadataFromAnnotations {
+		if value, ok := issuer.GetAnnotations()[key]; ok {
+			metadata[metadataField] = value
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIssuerMetadata(t *testing.T) {
+	issuer := &commandissuer.Issuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "issuer1",
+			Namespace:   "ns1",
+			Labels:      map[string]string{"app.kubernetes.io/part-of": "payments", "team": "pki"},
+			Annotations: map[string]string{"example.com/owner": "alice@example.com"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		spec     commandissuer.IssuerSpec
+		expected map[string]string
+	}{
+		{
+			name: "NoMapping",
+		},
+		{
+			name: "LabelsAndAnnotations",
+			spec: commandissuer.IssuerSpec{
+				MetadataFromLabels:      map[string]string{"app.kubernetes.io/part-of": "Application"},
+				MetadataFromAnnotations: map[string]string{"example.com/owner": "Owner"},
+			},
+			expected: map[string]string{"Application": "payments", "Owner": "alice@example.com"},
+		},
+		{
+			name: "MissingLabel",
+			spec: commandissuer.IssuerSpec{
+				MetadataFromLabels: map[string]string{"team": "Team", "environment": "Environment"},
+			},
+			expected: map[string]string{"Team": "pki"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, issuerMetadata(issuer, &tt.spec))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrMultipleIssuers is returned by LoadIssuer when a manifest contains more than one Issuer or
+// ClusterIssuer
+var ErrMultipleIssuers = errors.New("manifest contains more than one Issuer or ClusterIssuer")
+
+// Issuer is an Issuer or ClusterIssuer loaded from a manifest with the data of the Secrets it
+// references
+type Issuer struct {
+	// Object is the Issuer or ClusterIssuer
+	Object client.Object
+	// Kind is either Issuer or ClusterIssuer
+	Kind string
+	// Spec is the spec of the issuer merged with its CommandIssuerProfile, if any
+	Spec           *commandissuer.IssuerSpec
+	AuthSecretData map[string][]byte
+	CASecretData   map[string][]byte
+}
+
+// LoadIssuerFile loads the single Issuer or ClusterIssuer of the YAML or JSON manifest at path
+func LoadIssuerFile(path string) (*Issuer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadIssuer(f)
+}
+
+// LoadIssuer loads the single Issuer or ClusterIssuer of a YAML or JSON manifest without a cluster.
+// The issuer is validated like by ValidateIssuers. Since nothing is read from a cluster, the Secrets
+// and the CommandIssuerProfile that the issuer references must be part of the manifest, and the
+// hostname can't be read from a ConfigMap.
+func LoadIssuer(r io.Reader) (*Issuer, error) {
+	issuers, secrets, profiles, err := decodeManifest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(issuers) == 0:
+		return nil, ErrNoIssuers
+	case len(issuers) > 1:
+		return nil, ErrMultipleIssuers
+	}
+	issuer := issuers[0]
+
+	if err := validateIssuer(issuer, secrets, profiles); err != nil {
+		return nil, err
+	}
+
+	kind, spec, secretNamespace, profileInManifest := resolveIssuer(issuer, profiles)
+	if !profileInManifest {
+		return nil, fmt.Errorf("%s %s: the CommandIssuerProfile %q is not part of the manifest", kind, issuer.GetName(), spec.ProfileName)
+	}
+	if spec.HostnameConfigMapName != "" && spec.Hostname == "" {
+		return nil, fmt.Errorf("%s %s: the hostname can't be read from the ConfigMap %q without a cluster. Set the hostname field instead.", kind, issuer.GetName(), spec.HostnameConfigMapName)
+	}
+
+	loaded := &Issuer{
+		Object: issuer,
+		Kind:   kind,
+		Spec:   spec,
+	}
+
+	authSecret := findSecret(secrets, secretNamespace, spec.SecretName)
+	if authSecret == nil {
+		return nil, fmt.Errorf("%s %s: the Secret %q is not part of the manifest", kind, issuer.GetName(), spec.SecretName)
+	}
+	loaded.AuthSecretData = secretData(authSecret)
+
+	if spec.CaSecretName != "" {
+		caSecret := findSecret(secrets, secretNamespace, spec.CaSecretName)
+		if caSecret == nil {
+			return nil, fmt.Errorf("%s %s: the Secret %q is not part of the manifest", kind, issuer.GetName(), spec.CaSecretName)
+		}
+		loaded.CASecretData = secretData(caSecret)
+	}
+
+	return loaded, nil
+}
+
+// secretData returns the data of a Secret of the manifest, including its stringData, which the API
+// server would merge into its data
+func secretData(secret *corev1.Secret) map[string][]byte {
+	data := make(map[string][]byte, len(secret.Data)+len(secret.StringData))
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+	for key, value := range secret.StringData {
+		data[key] = []byte(value)
+	}
+	return data
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const commandSecret = `
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/basic-auth
+metadata:
+  name: command-secret
+  namespace: default
+data:
+  username: dXNlcg==
+stringData:
+  password: pass
+`
+
+const caSecret = `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: command-ca
+  namespace: default
+stringData:
+  ca.crt: bundle
+`
+
+func TestLoadIssuer(t *testing.T) {
+	tests := []struct {
+		name           string
+		manifest       string
+		expectedKind   string
+		expectedCA     bool
+		expectedErrors []string
+	}{
+		{
+			name:         "Issuer",
+			manifest:     validIssuer + commandSecret,
+			expectedKind: "Issuer",
+		},
+		{
+			name:         "IssuerWithCASecret",
+			manifest:     validIssuer + "  caSecretName: command-ca\n" + commandSecret + caSecret,
+			expectedKind: "Issuer",
+			expectedCA:   true,
+		},
+		{
+			name:         "ClusterIssuer",
+			manifest:     strings.Replace(validClusterIssuer, "commandSecretNamespace: command-issuer-system", "commandSecretNamespace: default", 1) + commandSecret,
+			expectedKind: "ClusterIssuer",
+		},
+		{
+			name:           "NoIssuer",
+			manifest:       commandSecret,
+			expectedErrors: []string{"does not contain an Issuer or ClusterIssuer"},
+		},
+		{
+			name:           "MultipleIssuers",
+			manifest:       validIssuer + "---" + validClusterIssuer + commandSecret,
+			expectedErrors: []string{"more than one Issuer or ClusterIssuer"},
+		},
+		{
+			name:           "InvalidIssuer",
+			manifest:       strings.Replace(validIssuer, "certificateTemplate: WebServer", "", 1) + commandSecret,
+			expectedErrors: []string{"spec.certificateTemplate: Required value"},
+		},
+		{
+			name:           "MissingSecret",
+			manifest:       validIssuer,
+			expectedErrors: []string{`the Secret "command-secret" is not part of the manifest`},
+		},
+		{
+			name:           "MissingCASecret",
+			manifest:       validIssuer + "  caSecretName: command-ca\n" + commandSecret,
+			expectedErrors: []string{`the Secret "command-ca" is not part of the manifest`},
+		},
+		{
+			name:           "MissingProfile",
+			manifest:       validIssuer + "  profileName: web\n" + commandSecret,
+			expectedErrors: []string{`the CommandIssuerProfile "web" is not part of the manifest`},
+		},
+		{
+			name:           "HostnameConfigMap",
+			manifest:       strings.Replace(validIssuer, "hostname: command.example.com", "hostnameConfigMapName: command-hostname", 1) + commandSecret,
+			expectedErrors: []string{`the hostname can't be read from the ConfigMap "command-hostname" without a cluster`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, err := LoadIssuer(strings.NewReader(tt.manifest))
+			if len(tt.expectedErrors) > 0 {
+				if assert.Error(t, err) {
+					for _, expected := range tt.expectedErrors {
+						assert.Contains(t, err.Error(), expected)
+					}
+				}
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedKind, issuer.Kind)
+			assert.Equal(t, "WebServer", issuer.Spec.CertificateTemplate)
+			assert.Equal(t, []byte("user"), issuer.AuthSecretData["username"])
+			assert.Equal(t, []byte("pass"), issuer.AuthSecretData["password"])
+			if tt.expectedCA {
+				assert.Equal(t, []byte("bundle"), issuer.CASecretData["ca.crt"])
+			} else {
+				assert.Nil(t, issuer.CASecretData)
+			}
+		})
+	}
+}
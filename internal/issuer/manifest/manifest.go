@@ -0,0 +1,273 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrNoIssuers is returned when a manifest doesn't contain an Issuer or ClusterIssuer
+var ErrNoIssuers = errors.New("manifest does not contain an Issuer or ClusterIssuer")
+
+// ValidateIssuersFile validates the Issuers and ClusterIssuers in the YAML or JSON manifest at path
+func ValidateIssuersFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ValidateIssuers(f)
+}
+
+// ValidateIssuers validates the Issuers and ClusterIssuers in a YAML or JSON manifest without a
+// cluster. In addition to the checks of the validating admission webhook, it verifies that the fields
+// required to enroll certificates are set, and that Secrets included in the manifest contain the keys
+// that the issuer reads. CommandIssuerProfiles in the manifest are merged into the issuers that
+// reference them. Other resources in the manifest are ignored.
+func ValidateIssuers(r io.Reader) error {
+	issuers, secrets, profiles, err := decodeManifest(r)
+	if err != nil {
+		return err
+	}
+
+	if len(issuers) == 0 {
+		return ErrNoIssuers
+	}
+
+	var errs []error
+	for _, issuer := range issuers {
+		if err := validateIssuer(issuer, secrets, profiles); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// decodeManifest decodes the Issuers, ClusterIssuers, CommandIssuerProfiles, and Secrets of a YAML
+// or JSON manifest. Other resources in the manifest are ignored.
+func decodeManifest(r io.Reader) ([]client.Object, []*corev1.Secret, []*commandissuer.CommandIssuerProfile, error) {
+	var issuers []client.Object
+	var secrets []*corev1.Secret
+	var profiles []*commandissuer.CommandIssuerProfile
+
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for document := 1; ; document++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, nil, fmt.Errorf("document %d: failed to parse the manifest: %w", document, err)
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(raw, &typeMeta); err != nil {
+			return nil, nil, nil, fmt.Errorf("document %d: failed to parse the manifest: %w", document, err)
+		}
+
+		var obj client.Object
+		switch gvk := typeMeta.GroupVersionKind(); {
+		case gvk == commandissuer.GroupVersion.WithKind("Issuer"):
+			obj = &commandissuer.Issuer{}
+		case gvk == commandissuer.GroupVersion.WithKind("ClusterIssuer"):
+			obj = &commandissuer.ClusterIssuer{}
+		case gvk == commandissuer.GroupVersion.WithKind("CommandIssuerProfile"):
+			obj = &commandissuer.CommandIssuerProfile{}
+		case gvk == corev1.SchemeGroupVersion.WithKind("Secret"):
+			obj = &corev1.Secret{}
+		case gvk.Group == commandissuer.GroupVersion.Group:
+			return nil, nil, nil, fmt.Errorf("document %d: unsupported apiVersion %q and kind %q, expected %s Issuer, ClusterIssuer or CommandIssuerProfile", document, typeMeta.APIVersion, typeMeta.Kind, commandissuer.GroupVersion)
+		default:
+			continue
+		}
+
+		// Unknown fields are rejected since they are usually misspelled field names
+		strictDecoder := json.NewDecoder(bytes.NewReader(raw))
+		strictDecoder.DisallowUnknownFields()
+		if err := strictDecoder.Decode(obj); err != nil {
+			return nil, nil, nil, fmt.Errorf("document %d: invalid %s: %w", document, typeMeta.Kind, err)
+		}
+
+		switch t := obj.(type) {
+		case *corev1.Secret:
+			secrets = append(secrets, t)
+		case *commandissuer.CommandIssuerProfile:
+			profiles = append(profiles, t)
+		default:
+			issuers = append(issuers, obj)
+		}
+	}
+
+	return issuers, secrets, profiles, nil
+}
+
+// validateIssuer validates a single Issuer or ClusterIssuer of the manifest
+func validateIssuer(issuer client.Object, secrets []*corev1.Secret, profiles []*commandissuer.CommandIssuerProfile) error {
+	allErrs, err := commandissuer.ValidateIssuer(issuer)
+	if err != nil {
+		return err
+	}
+
+	kind, spec, secretNamespace, profileInManifest := resolveIssuer(issuer, profiles)
+
+	specPath := field.NewPath("spec")
+	if issuer.GetName() == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("metadata", "name"), ""))
+	}
+	// The hostname may be read from the credentials Secrets or a ConfigMap instead, in which case the
+	// hostname field is an optional fallback
+	if spec.Hostname != "" || (spec.HostnameKey == "" && spec.HostnameConfigMapName == "") {
+		allErrs = append(allErrs, validateHostname(spec.Hostname, specPath.Child("hostname"))...)
+	}
+
+	// Keys of the Secrets referenced by commandSecretName and commandReadSecretName that the issuer reads
+	usernameKey, passwordKey := signer.CredentialSecretKeys(spec)
+	requiredAuthSecretKeys := []string{usernameKey, passwordKey}
+	if spec.HostnameKey != "" && spec.HostnameConfigMapName == "" && spec.Hostname == "" {
+		requiredAuthSecretKeys = append(requiredAuthSecretKeys, spec.HostnameKey)
+	}
+
+	if spec.SecretName == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("commandSecretName"), "the name of the Secret containing the Command credentials is required"))
+	} else if secret := findSecret(secrets, secretNamespace, spec.SecretName); secret != nil {
+		for _, key := range requiredAuthSecretKeys {
+			if !secretHasKey(secret, key) {
+				allErrs = append(allErrs, field.Invalid(specPath.Child("commandSecretName"), spec.SecretName, fmt.Sprintf("the Secret in the manifest has no %q key", key)))
+			}
+		}
+	}
+	if spec.ReadSecretName != "" {
+		if secret := findSecret(secrets, secretNamespace, spec.ReadSecretName); secret != nil {
+			for _, key := range requiredAuthSecretKeys {
+				if !secretHasKey(secret, key) {
+					allErrs = append(allErrs, field.Invalid(specPath.Child("commandReadSecretName"), spec.ReadSecretName, fmt.Sprintf("the Secret in the manifest has no %q key", key)))
+				}
+			}
+		}
+	}
+	if spec.CaSecretName != "" {
+		if secret := findSecret(secrets, secretNamespace, spec.CaSecretName); secret != nil && len(secret.Data)+len(secret.StringData) == 0 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("caSecretName"), spec.CaSecretName, "the Secret in the manifest contains no CA bundle"))
+		}
+	}
+	if spec.CertificateTemplate == "" && profileInManifest {
+		allErrs = append(allErrs, field.Required(specPath.Child("certificateTemplate"), "the short name of the Command certificate template is required"))
+	}
+	if spec.CertificateAuthorityLogicalName == "" && profileInManifest {
+		allErrs = append(allErrs, field.Required(specPath.Child("certificateAuthorityLogicalName"), "the logical name of the Command certificate authority is required"))
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(commandissuer.GroupVersion.WithKind(kind).GroupKind(), issuer.GetName(), allErrs)
+}
+
+// resolveIssuer returns the kind of the Issuer or ClusterIssuer, its spec merged with its profile if
+// the profile is part of the manifest, and the namespace of its Secrets. An empty namespace matches
+// Secrets in any namespace. If the profile isn't part of the manifest, profileInManifest is false.
+func resolveIssuer(issuer client.Object, profiles []*commandissuer.CommandIssuerProfile) (kind string, spec *commandissuer.IssuerSpec, secretNamespace string, profileInManifest bool) {
+	secretNamespace = issuer.GetNamespace()
+	profileNamespace := issuer.GetNamespace()
+	switch t := issuer.(type) {
+	case *commandissuer.Issuer:
+		kind, spec = "Issuer", &t.Spec
+	case *commandissuer.ClusterIssuer:
+		// Without commandSecretNamespace, the Secrets are read from the cluster resource namespace
+		// configured on the controller, which isn't known offline. The same applies to the profile.
+		kind, spec, secretNamespace = "ClusterIssuer", &t.Spec, t.Spec.SecretNamespace
+		profileNamespace = ""
+	}
+
+	// If the profile isn't part of the manifest, it is read from the cluster and may supply the
+	// certificate template and certificate authority
+	profileInManifest = true
+	if spec.ProfileName != "" {
+		if profile := findProfile(profiles, profileNamespace, spec.ProfileName); profile != nil {
+			spec = commandissuer.MergeProfile(spec, &profile.Spec)
+		} else {
+			profileInManifest = false
+		}
+	}
+	return kind, spec, secretNamespace, profileInManifest
+}
+
+// validateHostname verifies that the hostname of the Command instance is set and can be parsed. The
+// hostname may include a scheme and path, which are replaced by the Command client.
+func validateHostname(hostname string, fldPath *field.Path) field.ErrorList {
+	if hostname == "" {
+		return field.ErrorList{field.Required(fldPath, "the hostname of the Command instance is required, e.g. command.example.com")}
+	}
+
+	rawURL := hostname
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	if u, err := url.Parse(rawURL); err != nil || u.Hostname() == "" {
+		return field.ErrorList{field.Invalid(fldPath, hostname, "must be the hostname or URL of the Command instance, e.g. command.example.com")}
+	}
+
+	return nil
+}
+
+// findSecret returns the Secret with the given name in the manifest. If namespace is empty, the
+// Secret may be in any namespace.
+func findSecret(secrets []*corev1.Secret, namespace, name string) *corev1.Secret {
+	for _, secret := range secrets {
+		if secret.Name == name && (namespace == "" || secret.Namespace == namespace) {
+			return secret
+		}
+	}
+	return nil
+}
+
+// findProfile returns the CommandIssuerProfile with the given name in the manifest. If namespace is
+// empty, the profile may be in any namespace.
+func findProfile(profiles []*commandissuer.CommandIssuerProfile, namespace, name string) *commandissuer.CommandIssuerProfile {
+	for _, profile := range profiles {
+		if profile.Name == name && (namespace == "" || profile.Namespace == namespace) {
+			return profile
+		}
+	}
+	return nil
+}
+
+// secretHasKey returns true if the Secret has a non-empty value for key in data or stringData
+func secretHasKey(secret *corev1.Secret, key string) bool {
+	return len(secret.Data[key]) > 0 || secret.StringData[key] != ""
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validIssuer = `
+apiVersion: command-issuer.keyfactor.com/v1alpha1
+kind: Issuer
+metadata:
+  name: issuer-sample
+  namespace: default
+spec:
+  hostname: command.example.com
+  commandSecretName: command-secret
+  certificateTemplate: WebServer
+  certificateAuthorityLogicalName: InternalIssuingCA1
+`
+
+const validClusterIssuer = `
+apiVersion: command-issuer.keyfactor.com/v1alpha1
+kind: ClusterIssuer
+metadata:
+  name: clusterissuer-sample
+spec:
+  hostname: https://command.example.com/KeyfactorAPI
+  commandSecretName: command-secret
+  commandSecretNamespace: command-issuer-system
+  certificateTemplate: WebServer
+  certificateAuthorityLogicalName: InternalIssuingCA1
+`
+
+func TestValidateIssuers(t *testing.T) {
+	tests := []struct {
+		name           string
+		manifest       string
+		expectedErrors []string
+	}{
+		{
+			name:     "ValidIssuer",
+			manifest: validIssuer,
+		},
+		{
+			name:     "ValidClusterIssuer",
+			manifest: validClusterIssuer,
+		},
+		{
+			name: "ValidIssuerWithSecret",
+			manifest: validIssuer + `
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/basic-auth
+metadata:
+  name: command-secret
+  namespace: default
+stringData:
+  username: user
+  password: pass
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`,
+		},
+		{
+			name:           "NoIssuer",
+			manifest:       "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n",
+			expectedErrors: []string{"does not contain an Issuer or ClusterIssuer"},
+		},
+		{
+			name: "MissingFields",
+			manifest: `
+apiVersion: command-issuer.keyfactor.com/v1alpha1
+kind: Issuer
+metadata:
+  name: issuer-sample
+spec: {}
+`,
+			expectedErrors: []string{
+				"spec.hostname: Required value",
+				"spec.commandSecretName: Required value",
+				"spec.certificateTemplate: Required value",
+				"spec.certificateAuthorityLogicalName: Required value",
+			},
+		},
+		{
+			name:           "InvalidHostname",
+			manifest:       strings.Replace(validIssuer, "command.example.com", "https://:443", 1),
+			expectedErrors: []string{`spec.hostname: Invalid value: "https://:443"`},
+		},
+		{
+			name:           "UnknownField",
+			manifest:       strings.Replace(validIssuer, "certificateTemplate", "certificateTemplat", 1),
+			expectedErrors: []string{`unknown field "certificateTemplat"`},
+		},
+		{
+			name:           "WebhookValidation",
+			manifest:       validIssuer + "  subjectPattern: \"^(unterminated\"\n  commandSecretNamespace: other\n",
+			expectedErrors: []string{"spec.subjectPattern: Invalid value", "spec.commandSecretNamespace: Forbidden"},
+		},
+		{
+			name: "SecretMissingKeys",
+			manifest: validIssuer + `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: command-secret
+  namespace: default
+data:
+  username: dXNlcg==
+`,
+			expectedErrors: []string{`spec.commandSecretName: Invalid value: "command-secret": the Secret in the manifest has no "password" key`},
+		},
+		{
+			name: "ReadSecretMissingKeys",
+			manifest: validIssuer + `  commandReadSecretName: command-read-secret
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: command-read-secret
+  namespace: default
+stringData:
+  password: pass
+`,
+			expectedErrors: []string{`spec.commandReadSecretName: Invalid value: "command-read-secret": the Secret in the manifest has no "username" key`},
+		},
+		{
+			name: "CustomSecretKeys",
+			manifest: validIssuer + `  usernameKey: user
+  passwordKey: pass
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: command-secret
+  namespace: default
+stringData:
+  user: user
+  password: pass
+`,
+			expectedErrors: []string{`spec.commandSecretName: Invalid value: "command-secret": the Secret in the manifest has no "pass" key`},
+		},
+		{
+			name:     "HostnameKey",
+			manifest: strings.Replace(validIssuer, "hostname: command.example.com", "hostnameKey: host", 1),
+		},
+		{
+			name:     "HostnameConfigMap",
+			manifest: strings.Replace(validIssuer, "hostname: command.example.com", "hostnameConfigMapName: command-hostname", 1),
+		},
+		{
+			name: "HostnameKeyWithFallback",
+			manifest: validIssuer + `  hostnameKey: host
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: command-secret
+  namespace: default
+stringData:
+  username: user
+  password: pass
+`,
+		},
+		{
+			name:           "InvalidSecretKey",
+			manifest:       validIssuer + "  usernameKey: \"user name\"\n",
+			expectedErrors: []string{`spec.usernameKey: Invalid value: "user name"`},
+		},
+		{
+			name:     "AllowedCertificateAuthorities",
+			manifest: validIssuer + "  allowedCertificateAuthorities:\n  - InternalIssuingCA2\n  - 'ca.example.com\\InternalIssuingCA3'\n",
+		},
+		{
+			name:           "InvalidAllowedCertificateAuthority",
+			manifest:       validIssuer + "  allowedCertificateAuthorities:\n  - 'ca.example.com\\'\n",
+			expectedErrors: []string{`spec.allowedCertificateAuthorities[0]: Invalid value: "ca.example.com\\"`},
+		},
+		{
+			name:     "MetadataMapping",
+			manifest: validIssuer + "  metadataFromLabels:\n    app.kubernetes.io/part-of: Application\n  metadataFromAnnotations:\n    example.com/owner: Owner\n",
+		},
+		{
+			name:           "InvalidMetadataMapping",
+			manifest:       validIssuer + "  metadataFromLabels:\n    \"team name\": Team\n  metadataFromAnnotations:\n    example.com/owner: \"\"\n",
+			expectedErrors: []string{`spec.metadataFromLabels: Invalid value: "team name"`, `spec.metadataFromAnnotations[example.com/owner]: Required value`},
+		},
+		{
+			name:     "AdditionalSANs",
+			manifest: validIssuer + "  additionalSans:\n    dnsNames:\n    - '*.example.com'\n    uris:\n    - spiffe://example.com/org\n",
+		},
+		{
+			name:           "InvalidAdditionalSANs",
+			manifest:       validIssuer + "  additionalSans:\n    ipAddresses:\n    - 10.0.0\n    uris:\n    - example.com/org\n",
+			expectedErrors: []string{`spec.additionalSans.ipAddresses[0]: Invalid value: "10.0.0"`, `spec.additionalSans.uris[0]: Invalid value: "example.com/org"`},
+		},
+		{
+			name:           "AdditionalSANTypeNotAllowed",
+			manifest:       validIssuer + "  allowedSanTypes:\n  - DNS\n  additionalSans:\n    uris:\n    - spiffe://example.com/org\n",
+			expectedErrors: []string{`spec.additionalSans.uris: Forbidden: URI SANs are not allowed by allowedSanTypes`},
+		},
+		{
+			name:     "PermittedDNSDomains",
+			manifest: validIssuer + "  permittedDNSDomains:\n  - example.com\n  - '*.example.com'\n  additionalSans:\n    dnsNames:\n    - internal.example.com\n",
+		},
+		{
+			name:           "InvalidPermittedDNSDomains",
+			manifest:       validIssuer + "  permittedDNSDomains:\n  - '*.example.com'\n  - example.*\n  - '*.example.com'\n",
+			expectedErrors: []string{`spec.permittedDNSDomains[1]: Invalid value: "example.*"`, `spec.permittedDNSDomains[2]: Duplicate value: "*.example.com"`},
+		},
+		{
+			name:           "AdditionalSANNotPermitted",
+			manifest:       validIssuer + "  permittedDNSDomains:\n  - '*.example.com'\n  additionalSans:\n    dnsNames:\n    - example.org\n",
+			expectedErrors: []string{`spec.additionalSans.dnsNames[0]: Invalid value: "example.org": must be permitted by permittedDNSDomains`},
+		},
+		{
+			name:     "ChangeReference",
+			manifest: validIssuer + "  changeReference:\n    metadataField: ChangeTicket\n    required: true\n    pattern: ^CHG[0-9]{7}$\n    default: CHG0000001\n",
+		},
+		{
+			name:           "InvalidChangeReference",
+			manifest:       validIssuer + "  changeReference:\n    pattern: ^CHG[0-9]{7}$\n    default: INC0000001\n",
+			expectedErrors: []string{`spec.changeReference.metadataField: Required value`, `spec.changeReference.default: Invalid value: "INC0000001": must match pattern "^CHG[0-9]{7}$"`},
+		},
+		{
+			name:     "KeyPolicy",
+			manifest: validIssuer + "  keyPolicy:\n    allowedKeyAlgorithms:\n    - RSA\n    - ECDSA\n    minRsaKeySize: 2048\n    minEcdsaKeySize: 256\n    allowedSignatureAlgorithms:\n    - SHA256-RSA\n    - ECDSA-SHA256\n",
+		},
+		{
+			name:           "KeyPolicySignatureAlgorithmNotAllowed",
+			manifest:       validIssuer + "  keyPolicy:\n    allowedKeyAlgorithms:\n    - RSA\n    allowedSignatureAlgorithms:\n    - SHA256-RSA\n    - Ed25519\n",
+			expectedErrors: []string{`spec.keyPolicy.allowedSignatureAlgorithms[1]: Invalid value: "Ed25519": requires Ed25519 keys, which are not allowed by allowedKeyAlgorithms`},
+		},
+		{
+			name:     "EnrollmentFormat",
+			manifest: validIssuer + "  enrollmentFormat: PKCS10\n",
+		},
+		{
+			name:     "EnrollmentRequestTemplate",
+			manifest: validIssuer + "  enrollmentRequestTemplate: |\n    {\"CSR\": {{ json .CSR }}, \"Template\": {{ json .Template }}}\n",
+		},
+		{
+			name:           "InvalidEnrollmentRequestTemplate",
+			manifest:       validIssuer + "  enrollmentRequestTemplate: '{\"CSR\": {{ json .CSR }'\n",
+			expectedErrors: []string{`spec.enrollmentRequestTemplate: Invalid value: "{\"CSR\": {{ json .CSR }": template: enrollmentRequestTemplate:1: unexpected "}" in operand`},
+		},
+		{
+			name:     "ExtendedKeyUsageParameter",
+			manifest: validIssuer + "  extendedKeyUsageParameter:\n    name: SubTemplate\n    values:\n      server auth: Server\n      client auth: Client\n      1.3.6.1.4.1.99999.1: Custom\n",
+		},
+		{
+			name:     "InvalidExtendedKeyUsageParameter",
+			manifest: validIssuer + "  enrollmentParameters:\n    subTemplate: Server\n  extendedKeyUsageParameter:\n    name: SubTemplate\n    values:\n      web auth: Server\n",
+			expectedErrors: []string{
+				`spec.extendedKeyUsageParameter.name: Forbidden: conflicts with enrollmentParameters key "subTemplate"`,
+				`spec.extendedKeyUsageParameter.values: Invalid value: "web auth"`,
+			},
+		},
+		{
+			name:           "ReservedExtendedKeyUsageParameter",
+			manifest:       validIssuer + "  extendedKeyUsageParameter:\n    name: Template\n    values:\n      server auth: Server\n",
+			expectedErrors: []string{`spec.extendedKeyUsageParameter.name: Forbidden: managed by the issuer`},
+		},
+		{
+			name:     "ProfileName",
+			manifest: validIssuer + "  profileName: default-profile\n",
+		},
+		{
+			name: "ProfileInManifest",
+			manifest: strings.NewReplacer("  certificateTemplate: WebServer\n", "", "  certificateAuthorityLogicalName: InternalIssuingCA1\n", "").Replace(validIssuer) + `  profileName: default-profile
+---
+apiVersion: command-issuer.keyfactor.com/v1alpha1
+kind: CommandIssuerProfile
+metadata:
+  name: default-profile
+  namespace: default
+spec:
+  certificateTemplate: WebServer
+  certificateAuthorityLogicalName: InternalIssuingCA1
+`,
+		},
+		{
+			name: "ProfileInManifestMissingFields",
+			manifest: strings.Replace(validIssuer, "  certificateTemplate: WebServer\n", "", 1) + `  profileName: default-profile
+---
+apiVersion: command-issuer.keyfactor.com/v1alpha1
+kind: CommandIssuerProfile
+metadata:
+  name: default-profile
+  namespace: default
+spec:
+  certificateAuthorityLogicalName: InternalIssuingCA1
+`,
+			expectedErrors: []string{"spec.certificateTemplate: Required value"},
+		},
+		{
+			name:     "ProfileNotInManifest",
+			manifest: strings.NewReplacer("  certificateTemplate: WebServer\n", "", "  certificateAuthorityLogicalName: InternalIssuingCA1\n", "").Replace(validIssuer) + "  profileName: default-profile\n",
+		},
+		{
+			name:           "InvalidProfileName",
+			manifest:       validIssuer + "  profileName: Default_Profile\n",
+			expectedErrors: []string{`spec.profileName: Invalid value: "Default_Profile"`},
+		},
+		{
+			name:     "RequiredCertificatePolicy",
+			manifest: validIssuer + "  requiredCertificatePolicy:\n    oid: 2.23.140.1.2.2\n    enrollmentParameter: CertificatePolicy\n",
+		},
+		{
+			name:     "InvalidRequiredCertificatePolicy",
+			manifest: validIssuer + "  enrollmentParameters:\n    certificatePolicy: OV\n  requiredCertificatePolicy:\n    oid: ov-tls\n    enrollmentParameter: CertificatePolicy\n",
+			expectedErrors: []string{
+				`spec.requiredCertificatePolicy.oid: Invalid value: "ov-tls": must be an OID in dotted notation`,
+				`spec.requiredCertificatePolicy.enrollmentParameter: Forbidden: conflicts with enrollmentParameters key "certificatePolicy"`,
+			},
+		},
+		{
+			name:           "ReservedRequiredCertificatePolicyParameter",
+			manifest:       validIssuer + "  requiredCertificatePolicy:\n    oid: 2.23.140.1.2.2\n    enrollmentParameter: Template\n",
+			expectedErrors: []string{`spec.requiredCertificatePolicy.enrollmentParameter: Forbidden: managed by the issuer`},
+		},
+		{
+			name:     "RequestHeaders",
+			manifest: validIssuer + "  requestHeaders:\n  - name: X-Api-Key\n    secretKey: apiKey\n  - name: X-Tenant\n    value: tenant1\n",
+		},
+		{
+			name:     "InvalidRequestHeaders",
+			manifest: validIssuer + "  requestHeaders:\n  - name: Authorization\n    value: Bearer token\n  - name: X-Api-Key\n    value: key\n    secretKey: apiKey\n  - name: x-api-key\n  - name: X Tenant\n    value: tenant1\n",
+			expectedErrors: []string{
+				`spec.requestHeaders[0].name: Forbidden: managed by the issuer`,
+				`spec.requestHeaders[1]: Invalid value: "X-Api-Key": value and secretKey are mutually exclusive`,
+				`spec.requestHeaders[2].name: Duplicate value: "x-api-key"`,
+				`spec.requestHeaders[2].value: Required value: either value or secretKey is required`,
+				`spec.requestHeaders[3].name: Invalid value: "X Tenant": must be a valid HTTP header name`,
+			},
+		},
+		{
+			name:     "FallbackHostnames",
+			manifest: validIssuer + "  fallbackHostnames:\n  - command-dr.example.com\n",
+		},
+		{
+			name:     "InvalidFallbackHostnames",
+			manifest: validIssuer + "  fallbackHostnames:\n  - \"\"\n  - command.example.com\n",
+			expectedErrors: []string{
+				`spec.fallbackHostnames[0]: Required value`,
+				`spec.fallbackHostnames[1]: Duplicate value: "command.example.com"`,
+			},
+		},
+		{
+			name:     "SameKeyRenewal",
+			manifest: validIssuer + "  enableRenewal: true\n  renewalMode: SameKey\n",
+		},
+		{
+			name:           "RenewalModeWithoutRenewal",
+			manifest:       validIssuer + "  renewalMode: SameKey\n",
+			expectedErrors: []string{`spec.renewalMode: Invalid value: "SameKey": requires enableRenewal to be true`},
+		},
+		{
+			name:     "CACertificateTemplate",
+			manifest: validIssuer + "  allowCA: true\n  caCertificateTemplate: SubCA\n",
+		},
+		{
+			name:           "CACertificateTemplateWithoutAllowCA",
+			manifest:       validIssuer + "  caCertificateTemplate: SubCA\n",
+			expectedErrors: []string{`spec.caCertificateTemplate: Invalid value: "SubCA": requires allowCA to be true`},
+		},
+		{
+			name:     "EnrollmentLimits",
+			manifest: validIssuer + "  enrollmentLimits:\n    requestsPerMinute: 60\n    burst: 10\n    maxConcurrentEnrollments: 2\n    whenExceeded: FailFast\n",
+		},
+		{
+			name:           "EnrollmentLimitsBurstWithoutRate",
+			manifest:       validIssuer + "  enrollmentLimits:\n    burst: 10\n",
+			expectedErrors: []string{`spec.enrollmentLimits.burst: Invalid value: 10: requires requestsPerMinute to be set`},
+		},
+		{
+			name:     "DefaultDuration",
+			manifest: validIssuer + "  defaultDuration: 720h\n",
+		},
+		{
+			name:           "InvalidDefaultDuration",
+			manifest:       validIssuer + "  defaultDuration: -1h\n",
+			expectedErrors: []string{`spec.defaultDuration: Invalid value: "-1h0m0s": must be greater than zero`},
+		},
+		{
+			name:           "MultipleIssuers",
+			manifest:       strings.Replace(validIssuer, "hostname: command.example.com", "hostname: \"\"", 1) + "---" + strings.Replace(validClusterIssuer, "certificateTemplate: WebServer", "", 1),
+			expectedErrors: []string{`Issuer.command-issuer.keyfactor.com "issuer-sample" is invalid`, `ClusterIssuer.command-issuer.keyfactor.com "clusterissuer-sample" is invalid`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIssuers(strings.NewReader(tt.manifest))
+			if len(tt.expectedErrors) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, expected := range tt.expectedErrors {
+					assert.Contains(t, err.Error(), expected)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateIssuersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issuer.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(validIssuer), 0o600))
+
+	assert.NoError(t, ValidateIssuersFile(path))
+	assert.Error(t, ValidateIssuersFile(filepath.Join(t.TempDir(), "missing.yaml")))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// revocationReasonCessationOfOperation is the Command revocation reason of certificates that are
+// revoked because the issuer rejected them
+const revocationReasonCessationOfOperation = 5
+
+// ErrCANotAllowed is returned by Sign when the request asks for a CA certificate but the issuer
+// doesn't allow CA issuance. Retrying the request won't succeed.
+var ErrCANotAllowed = errors.New("CA certificates are not allowed by the issuer")
+
+// selectCATemplate verifies that a request for a CA certificate is allowed by the issuer and selects
+// the CA certificate template of the issuer for it, if any. Requests for leaf certificates are enrolled
+// with the certificate template unchanged.
+func (s *commandSigner) selectCATemplate(isCA bool) error {
+	if !isCA {
+		return nil
+	}
+	if !s.allowCA {
+		return fmt.Errorf("%w: the request has isCA set, but the issuer doesn't set allowCA", ErrCANotAllowed)
+	}
+	if s.caCertificateTemplate != "" {
+		s.certificateTemplate = s.caCertificateTemplate
+	}
+	return nil
+}
+
+// caTemplate returns the certificate template that CA certificates are enrolled with
+func (s *commandSigner) caTemplate() string {
+	if s.caCertificateTemplate != "" {
+		return s.caCertificateTemplate
+	}
+	return s.certificateTemplate
+}
+
+// checkIssuedCA verifies that a certificate issued for a request for a CA certificate is a CA
+// certificate, since a downstream issuer can't sign with a leaf certificate. The certificate template
+// won't issue a CA certificate on retries either.
+func checkIssuedCA(leaf *x509.Certificate, certificateTemplate string) error {
+	if leaf.IsCA {
+		return nil
+	}
+	return fmt.Errorf("%w: the request has isCA set, but Command issued a certificate that isn't a CA certificate. Verify that certificate template %q issues CA certificates", ErrEnrollmentRejected, certificateTemplate)
+}
+
+// rejectIssuedCertificate revokes a certificate that Command issued but that the issuer rejects, so
+// that it doesn't remain valid in Command without a requester, and returns the rejection. If the
+// certificate can't be revoked, the returned error records its Command ID so that it can be
+// revoked manually.
+func (s *commandSigner) rejectIssuedCertificate(ctx context.Context, certificateID int32, rejection error) error {
+	k8sLog := log.FromContext(ctx)
+
+	if certificateID == 0 {
+		return fmt.Errorf("%w. Command did not return the ID of the certificate, so it was not revoked", rejection)
+	}
+
+	request := keyfactor.ModelsRevokeCertificateRequest{
+		CertificateIds: []int32{certificateID},
+		Reason:         ptr(int32(revocationReasonCessationOfOperation)),
+		Comment:        ptr(s.changeReference.revocationComment(fmt.Sprintf("Rejected by command-cert-manager-issuer: %v", rejection))),
+	}
+	if _, _, err := s.client.CertificateApi.CertificateRevoke(ctx).Request(request).Execute(); err != nil {
+		k8sLog.Error(err, fmt.Sprintf("failed to revoke rejected certificate with Command ID %d. Revoke it in Command.", certificateID))
+		return fmt.Errorf("%w. Revoking certificate %d in Command failed, so it must be revoked manually: %v", rejection, certificateID, err)
+	}
+
+	k8sLog.Info(fmt.Sprintf("Revoked rejected certificate with Command ID %d", certificateID))
+	return fmt.Errorf("%w. Certificate %d was revoked in Command", rejection, certificateID)
+}
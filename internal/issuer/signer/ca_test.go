@@ -0,0 +1,192 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignCA(t *testing.T) {
+	leafResponse := fakeEnrollmentResponse(t)
+	caResponse := fakeCAEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                  string
+		isCA                  bool
+		allowCA               bool
+		caCertificateTemplate string
+		annotations           map[string]string
+		issuesCA              bool
+		expectedTemplate      string
+		expectedRevoked       bool
+		expectedError         error
+	}{
+		{
+			name:             "Leaf",
+			expectedTemplate: "template",
+		},
+		{
+			name:                  "LeafWithCAAllowed",
+			allowCA:               true,
+			caCertificateTemplate: "SubCA",
+			expectedTemplate:      "template",
+		},
+		{
+			name:          "CANotAllowed",
+			isCA:          true,
+			expectedError: ErrCANotAllowed,
+		},
+		{
+			name:             "CAWithCertificateTemplate",
+			isCA:             true,
+			allowCA:          true,
+			issuesCA:         true,
+			expectedTemplate: "template",
+		},
+		{
+			name:                  "CAWithCACertificateTemplate",
+			isCA:                  true,
+			allowCA:               true,
+			caCertificateTemplate: "SubCA",
+			issuesCA:              true,
+			expectedTemplate:      "SubCA",
+		},
+		{
+			name:                  "CATemplateOverriddenByAnnotation",
+			isCA:                  true,
+			allowCA:               true,
+			caCertificateTemplate: "SubCA",
+			annotations:           map[string]string{"command-issuer.keyfactor.com/certificateTemplate": "OtherCA"},
+			issuesCA:              true,
+			expectedTemplate:      "OtherCA",
+		},
+		{
+			name:                  "CAIssuedAsLeaf",
+			isCA:                  true,
+			allowCA:               true,
+			caCertificateTemplate: "SubCA",
+			expectedTemplate:      "SubCA",
+			expectedRevoked:       true,
+			expectedError:         ErrEnrollmentRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			var revoked []interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				mu.Lock()
+				defer mu.Unlock()
+				if strings.HasSuffix(r.URL.Path, "/Certificates/Revoke") {
+					revoked = append(revoked, body["CertificateIds"].([]interface{})...)
+					_, _ = w.Write([]byte("{}"))
+					return
+				}
+				requests = append(requests, body)
+
+				if tt.issuesCA {
+					_, _ = w.Write(caResponse)
+				} else {
+					_, _ = w.Write(leafResponse)
+				}
+			}))
+			defer server.Close()
+
+			ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.AllowCA = tt.allowCA
+			spec.CACertificateTemplate = tt.caCertificateTemplate
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, tt.annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{IsCA: tt.isCA})
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedTemplate == "" {
+				assert.Empty(t, requests, "the request must be rejected before it is enrolled")
+				return
+			}
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, tt.expectedTemplate, requests[0]["Template"])
+			}
+			if tt.expectedRevoked {
+				assert.Equal(t, []interface{}{float64(fakeCommandCertificateID)}, revoked, "the rejected certificate must be revoked")
+			} else {
+				assert.Empty(t, revoked)
+			}
+		})
+	}
+}
+
+// fakeCAEnrollmentResponse returns a Command CSR enrollment response containing a self-signed CA certificate
+func fakeCAEnrollmentResponse(t *testing.T) []byte {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	require.NoError(t, err)
+
+	response, err := json.Marshal(map[string]interface{}{
+		"CertificateInformation": map[string]interface{}{
+			"KeyfactorID":  fakeCommandCertificateID,
+			"Certificates": []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))},
+		},
+	})
+	require.NoError(t, err)
+	return response
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultCAChainCacheTTL is how long a CA chain returned by Command is reused for the certificates
+// enrolled with the same CA and certificate template
+const DefaultCAChainCacheTTL = time.Hour
+
+// CAChainCache caches the CA chains that Command returns with enrolled certificates, so that later
+// enrollments with the same CA and certificate template don't ask Command for the chain again. A
+// chain is used until its TTL elapses, and is dropped as soon as a certificate doesn't verify against
+// it, e.g. because the CA was renewed. A nil CAChainCache caches nothing. A CAChainCache is safe for
+// concurrent use.
+type CAChainCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	chains map[caChainKey]caChainEntry
+}
+
+// caChainKey identifies the CA chain of the certificates enrolled in a Command instance with a CA and
+// certificate template. The CA is empty if Command selects it from the template.
+type caChainKey struct {
+	host                 string
+	certificateAuthority string
+	certificateTemplate  string
+}
+
+// caChainEntry is a cached CA chain
+type caChainEntry struct {
+	chain     []*x509.Certificate
+	fetchedAt time.Time
+}
+
+// NewCAChainCache returns a CAChainCache that reuses CA chains for ttl
+func NewCAChainCache(ttl time.Duration) *CAChainCache {
+	if ttl <= 0 {
+		ttl = DefaultCAChainCacheTTL
+	}
+	return &CAChainCache{
+		ttl:    ttl,
+		now:    time.Now,
+		chains: make(map[caChainKey]caChainEntry),
+	}
+}
+
+type caChainCacheContextKey struct{}
+
+// ContextWithCAChainCache returns a copy of ctx carrying the CA chain cache used by the signers
+// created with it. If ctx carries no cache, the chain is fetched with every enrollment.
+func ContextWithCAChainCache(ctx context.Context, cache *CAChainCache) context.Context {
+	return context.WithValue(ctx, caChainCacheContextKey{}, cache)
+}
+
+// caChainCacheFromContext returns the CA chain cache carried by ctx, or nil
+func caChainCacheFromContext(ctx context.Context) *CAChainCache {
+	cache, _ := ctx.Value(caChainCacheContextKey{}).(*CAChainCache)
+	return cache
+}
+
+// caChainKey returns the key of the CA chain of the certificates enrolled by the signer
+func (s *commandSigner) caChainKey() caChainKey {
+	return caChainKey{
+		host:                 s.client.GetConfig().Host,
+		certificateAuthority: formatCertificateAuthority(s.certificateAuthorityHostname, s.certificateAuthorityLogicalName),
+		certificateTemplate:  s.certificateTemplate,
+	}
+}
+
+// get returns the cached CA chain, or false if it isn't cached or is older than the TTL
+func (c *CAChainCache) get(key caChainKey) ([]*x509.Certificate, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.chains[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(entry.fetchedAt) >= c.ttl {
+		delete(c.chains, key)
+		return nil, false
+	}
+	return entry.chain, true
+}
+
+// set caches the CA chain
+func (c *CAChainCache) set(key caChainKey, chain []*x509.Certificate) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.chains[key] = caChainEntry{chain: chain, fetchedAt: c.now()}
+}
+
+// invalidate removes the cached CA chain
+func (c *CAChainCache) invalidate(key caChainKey) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.chains, key)
+}
+
+// Forget removes the CA chains of the Command instance at hostname, so that they are fetched again by
+// the next enrollment. Forget is a no-op on a nil CAChainCache.
+func (c *CAChainCache) Forget(hostname string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	host := commandHost(hostname)
+	for key := range c.chains {
+		if key.host == host {
+			delete(c.chains, key)
+		}
+	}
+}
+
+// chainWithCachedCA returns the enrolled certificate followed by its CA chain. If the chain was cached
+// when the certificate was enrolled, Command only returned the certificate, which must verify against
+// the cached chain. Otherwise the chain is downloaded from Command and cached again. If Command
+// returned the chain, it is cached for the next enrollments.
+func (s *commandSigner) chainWithCachedCA(ctx context.Context, cache *CAChainCache, key caChainKey, cached []*x509.Certificate, certAndChain []*x509.Certificate, certificateID int32) []*x509.Certificate {
+	k8sLog := log.FromContext(ctx)
+	leaf := certAndChain[0]
+
+	if cached == nil {
+		if chainIssues(certAndChain[1:], leaf) {
+			cache.set(key, certAndChain[1:])
+		}
+		return certAndChain
+	}
+
+	if chainIssues(cached, leaf) {
+		return append([]*x509.Certificate{leaf}, cached...)
+	}
+
+	// The CA was probably renewed or replaced since the chain was cached
+	k8sLog.Info(fmt.Sprintf("The certificate doesn't verify against the cached CA chain of certificate template %q. Downloading the chain from Command.", s.certificateTemplate))
+	cache.invalidate(key)
+
+	downloaded, err := s.downloadCertificate(ctx, certificateID)
+	if err != nil {
+		// The certificate was issued, so it is returned rather than enrolled again
+		k8sLog.Error(err, "failed to download the CA chain of the certificate. Returning the certificate without its CA chain.")
+		return []*x509.Certificate{leaf}
+	}
+
+	chain := make([]*x509.Certificate, 0, len(downloaded))
+	for _, certificate := range downloaded {
+		if !bytes.Equal(certificate.Raw, leaf.Raw) {
+			chain = append(chain, certificate)
+		}
+	}
+	if chainIssues(chain, leaf) {
+		cache.set(key, chain)
+	}
+	return append([]*x509.Certificate{leaf}, chain...)
+}
+
+// chainIssues returns true if a certificate of the chain signed the leaf certificate
+func chainIssues(chain []*x509.Certificate, leaf *x509.Certificate) bool {
+	for _, certificate := range chain {
+		if leaf.CheckSignatureFrom(certificate) == nil {
+			return true
+		}
+	}
+	return false
+}
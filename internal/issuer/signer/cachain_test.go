@@ -0,0 +1,216 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignCachesCAChain(t *testing.T) {
+	ca1 := newTestCA(t, "CA 1")
+	ca2 := newTestCA(t, "CA 2")
+
+	var mu sync.Mutex
+	currentCA := ca1
+	var includeChain []bool
+	downloads := 0
+	var lastLeaf *x509.Certificate
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		var response interface{}
+		switch r.URL.Path {
+		case "/KeyfactorAPI/Enrollment/CSR":
+			var body map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			include, _ := body["IncludeChain"].(bool)
+			includeChain = append(includeChain, include)
+
+			lastLeaf = currentCA.issue(t)
+			certificates := []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: lastLeaf.Raw}))}
+			if include {
+				certificates = append(certificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: currentCA.certificate.Raw})))
+			}
+			response = map[string]interface{}{
+				"CertificateInformation": map[string]interface{}{
+					"KeyfactorID":  fakeCommandCertificateID,
+					"Certificates": certificates,
+				},
+			}
+		case "/KeyfactorAPI/Certificates/Download":
+			downloads++
+			chainPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: currentCA.certificate.Raw}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: lastLeaf.Raw})...)
+			response = map[string]interface{}{
+				"Content": base64.StdEncoding.EncodeToString(chainPEM),
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCAChainCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	sign := func() []byte {
+		ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+		ctx = ContextWithCAChainCache(ctx, cache)
+		signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+		require.NoError(t, err)
+		_, chain, _, err := signer.Sign(ctx, csr, K8sMetadata{})
+		require.NoError(t, err)
+		return chain
+	}
+	chainOf := func(ca *testCA) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw})
+	}
+
+	// The chain is returned by Command with the first enrollment, and reused by the next one
+	assert.Equal(t, chainOf(ca1), sign())
+	assert.Equal(t, chainOf(ca1), sign())
+
+	// The certificate issued by another CA doesn't verify against the cached chain, so the chain is
+	// downloaded and replaces the cached one
+	mu.Lock()
+	currentCA = ca2
+	mu.Unlock()
+	assert.Equal(t, chainOf(ca2), sign())
+	assert.Equal(t, chainOf(ca2), sign())
+
+	// The chain is fetched again once the TTL elapsed
+	now = now.Add(time.Hour)
+	assert.Equal(t, chainOf(ca2), sign())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []bool{true, false, false, false, true}, includeChain)
+	assert.Equal(t, 1, downloads)
+}
+
+func TestCAChainCacheForget(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	cache := NewCAChainCache(time.Hour)
+	key := caChainKey{host: "command.example.com", certificateTemplate: "WebServer"}
+	other := caChainKey{host: "other.example.com", certificateTemplate: "WebServer"}
+	cache.set(key, []*x509.Certificate{ca.certificate})
+	cache.set(other, []*x509.Certificate{ca.certificate})
+
+	cache.Forget("https://command.example.com/KeyfactorAPI")
+
+	_, ok := cache.get(key)
+	assert.False(t, ok)
+	_, ok = cache.get(other)
+	assert.True(t, ok)
+
+	var disabled *CAChainCache
+	disabled.set(key, []*x509.Certificate{ca.certificate})
+	_, ok = disabled.get(key)
+	assert.False(t, ok)
+	disabled.Forget("command.example.com")
+}
+
+func TestSignWithoutCAChainCache(t *testing.T) {
+	var includeChain []bool
+	enrollmentResponse := fakeEnrollmentResponse(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		include, _ := body["IncludeChain"].(bool)
+		includeChain = append(includeChain, include)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(enrollmentResponse)
+	}))
+	defer server.Close()
+
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+	signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []bool{true, true}, includeChain)
+}
+
+// testCA is a CA that issues leaf certificates in tests
+type testCA struct {
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+// newTestCA returns a self-signed CA with the common name
+func newTestCA(t *testing.T, commonName string) *testCA {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{certificate: certificate, key: key}
+}
+
+// issue returns a leaf certificate signed by the CA
+func (c *testCA) issue(t *testing.T) *x509.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, c.certificate, &key.PublicKey, c.key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate
+}
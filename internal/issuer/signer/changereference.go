@@ -0,0 +1,123 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+// changeReferenceAnnotation is the annotation of a request that sets its change reference
+const changeReferenceAnnotation = "command-issuer.keyfactor.com/change-reference"
+
+// ErrChangeReferenceInvalid is returned by Sign when the request has no change reference but the
+// issuer requires one, or its change reference doesn't match the pattern of the issuer. Retrying the
+// request won't succeed.
+var ErrChangeReferenceInvalid = errors.New("the change reference of the request is missing or invalid")
+
+// changeReference is the change reference of a request and the settings of the issuer for it
+type changeReference struct {
+	metadataField string
+	required      bool
+	pattern       *regexp.Regexp
+	// value is the change reference of the request. If empty, the request has none.
+	value string
+}
+
+// newChangeReference returns the change reference of a request with the annotations, or nil if the
+// issuer doesn't record change references
+func newChangeReference(spec *commandissuer.ChangeReference, annotations map[string]string) (*changeReference, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	if spec.MetadataField == "" {
+		return nil, fmt.Errorf("%w: changeReference requires a metadataField", ErrInvalidConfig)
+	}
+
+	reference := &changeReference{
+		metadataField: spec.MetadataField,
+		required:      spec.Required,
+		value:         ChangeReferenceOf(annotations, spec),
+	}
+	if spec.Pattern != "" {
+		var err error
+		reference.pattern, err = regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid change reference pattern %q: %w", ErrInvalidConfig, spec.Pattern, err)
+		}
+	}
+	return reference, nil
+}
+
+// ChangeReferenceOf returns the change reference of a request with the annotations, which is the
+// value of the change-reference annotation, or the default of the issuer if the request doesn't set
+// it. It returns an empty string if the issuer doesn't record change references.
+func ChangeReferenceOf(annotations map[string]string, spec *commandissuer.ChangeReference) string {
+	if spec == nil {
+		return ""
+	}
+	if value := strings.TrimSpace(annotations[changeReferenceAnnotation]); value != "" {
+		return value
+	}
+	return spec.Default
+}
+
+// check verifies that the request has a change reference if the issuer requires one, and that it
+// matches the pattern of the issuer
+func (c *changeReference) check() error {
+	if c == nil {
+		return nil
+	}
+	if c.value == "" {
+		if c.required {
+			return fmt.Errorf("%w: the issuer requires a change reference. Annotate the Certificate with %q, e.g. with the ticket number of the change", ErrChangeReferenceInvalid, changeReferenceAnnotation)
+		}
+		return nil
+	}
+	if c.pattern != nil && !c.pattern.MatchString(c.value) {
+		return fmt.Errorf("%w: change reference %q does not match pattern %q", ErrChangeReferenceInvalid, c.value, c.pattern.String())
+	}
+	return nil
+}
+
+// addMetadata records the change reference in the metadata of an enrollment request, if any
+func (c *changeReference) addMetadata(metadata map[string]interface{}) {
+	if c == nil || c.value == "" {
+		return
+	}
+	metadata[c.metadataField] = c.value
+}
+
+// metadataFields returns the metadata fields that the change reference is recorded in
+func (c *changeReference) metadataFields() []string {
+	if c == nil || c.value == "" {
+		return nil
+	}
+	return []string{c.metadataField}
+}
+
+// revocationComment prefixes the comment of a revocation with the change reference, if any
+func (c *changeReference) revocationComment(comment string) string {
+	if c == nil || c.value == "" {
+		return comment
+	}
+	return fmt.Sprintf("Change reference %s. %s", c.value, comment)
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignChangeReference(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		changeReference   *commandissuer.ChangeReference
+		annotations       map[string]string
+		isCA              bool
+		expectedReference string
+		expectedError     error
+		expectedMessage   string
+		expectedComment   string
+	}{
+		{
+			name: "NotConfigured",
+			annotations: map[string]string{
+				changeReferenceAnnotation: "CHG0012345",
+			},
+		},
+		{
+			name:            "Annotation",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Required: true},
+			annotations: map[string]string{
+				changeReferenceAnnotation: " CHG0012345 ",
+			},
+			expectedReference: "CHG0012345",
+		},
+		{
+			name:              "Default",
+			changeReference:   &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Required: true, Default: "CHG0000001"},
+			expectedReference: "CHG0000001",
+		},
+		{
+			name:            "AnnotationOverridesDefault",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Default: "CHG0000001"},
+			annotations: map[string]string{
+				changeReferenceAnnotation: "CHG0012345",
+			},
+			expectedReference: "CHG0012345",
+		},
+		{
+			name:            "AnnotationOverridesMetadataAnnotation",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket"},
+			annotations: map[string]string{
+				changeReferenceAnnotation:                        "CHG0012345",
+				commandMetadataAnnotationPrefix + "ChangeTicket": "none",
+			},
+			expectedReference: "CHG0012345",
+		},
+		{
+			name:            "Optional",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Pattern: "^CHG[0-9]{7}$"},
+		},
+		{
+			name:            "Missing",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Required: true},
+			annotations: map[string]string{
+				changeReferenceAnnotation: " ",
+			},
+			expectedError:   ErrChangeReferenceInvalid,
+			expectedMessage: `the issuer requires a change reference. Annotate the Certificate with "command-issuer.keyfactor.com/change-reference"`,
+		},
+		{
+			name:            "PatternMismatch",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Required: true, Pattern: "^CHG[0-9]{7}$"},
+			annotations: map[string]string{
+				changeReferenceAnnotation: "INC0012345",
+			},
+			expectedError:   ErrChangeReferenceInvalid,
+			expectedMessage: `change reference "INC0012345" does not match pattern "^CHG[0-9]{7}$"`,
+		},
+		{
+			name:            "Revocation",
+			changeReference: &commandissuer.ChangeReference{MetadataField: "ChangeTicket"},
+			annotations: map[string]string{
+				changeReferenceAnnotation: "CHG0012345",
+			},
+			isCA:              true,
+			expectedReference: "CHG0012345",
+			expectedError:     ErrEnrollmentRejected,
+			expectedComment:   "Change reference CHG0012345. Rejected by command-cert-manager-issuer: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			var comments []string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				mu.Lock()
+				defer mu.Unlock()
+				if strings.HasSuffix(r.URL.Path, "/Certificates/Revoke") {
+					comments = append(comments, body["Comment"].(string))
+					_, _ = w.Write([]byte("{}"))
+					return
+				}
+				requests = append(requests, body)
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.ChangeReference = tt.changeReference
+			spec.AllowCA = tt.isCA
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, tt.annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{IsCA: tt.isCA})
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.ErrorContains(t, err, tt.expectedMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedError == ErrChangeReferenceInvalid {
+				assert.Empty(t, requests, "the request must be rejected before it is enrolled")
+				return
+			}
+			require.Len(t, requests, 1)
+			metadata, _ := requests[0]["Metadata"].(map[string]interface{})
+			if tt.expectedReference != "" {
+				assert.Equal(t, tt.expectedReference, metadata["ChangeTicket"])
+			} else {
+				assert.NotContains(t, metadata, "ChangeTicket")
+			}
+			if tt.expectedComment != "" {
+				require.Len(t, comments, 1)
+				assert.True(t, strings.HasPrefix(comments[0], tt.expectedComment), comments[0])
+			}
+		})
+	}
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+		spec.ChangeReference = &commandissuer.ChangeReference{MetadataField: "ChangeTicket", Pattern: "CHG["}
+		_, err := commandSignerFromIssuerAndSecretData(ctx, spec, nil, authSecretData, nil, caSecretData)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default settings of the circuit breaker that stops calls to a Command host that is persistently down
+const (
+	DefaultCircuitBreakerThreshold   = 5
+	DefaultCircuitBreakerCooldown    = time.Minute
+	DefaultCircuitBreakerMaxCooldown = 15 * time.Minute
+)
+
+// ErrCircuitOpen is returned by Command clients when calls to the Command host are short-circuited
+// after repeated failures. The returned error is a *CircuitOpenError.
+var ErrCircuitOpen = errors.New("Command is unavailable")
+
+// CircuitOpenError is returned by Command clients when calls to the Command host are short-circuited
+// after repeated failures
+type CircuitOpenError struct {
+	// Host is the Command host that is unavailable
+	Host string
+	// RetryAfter is how long to wait before the next call to the host is attempted
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v: calls to %s are suspended after repeated failures, retrying in %s", ErrCircuitOpen, e.Host, e.RetryAfter.Round(time.Second))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitBreaker tracks the failures of calls to each Command host. After threshold consecutive
+// failures, calls to the host fail fast for the cooldown, which protects both the controller and
+// Command during an outage. Once the cooldown has elapsed, a single call probes the host. The
+// circuit closes again if the probe succeeds, and stays open otherwise for twice the previous
+// cooldown, up to the maximum cooldown, so that a long outage is probed less and less often. A
+// CircuitBreaker is shared by all reconcilers, so that an outage is detected across issuers.
+type CircuitBreaker struct {
+	threshold   int
+	cooldown    time.Duration
+	maxCooldown time.Duration
+	now         func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// circuit is the state of the calls to a single Command host
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	// cooldown is how long the circuit stays open after the last failure
+	cooldown time.Duration
+	// probing is set while a call probes whether the host has recovered
+	probing bool
+}
+
+// NewCircuitBreaker returns a circuit breaker that opens after threshold consecutive failures of
+// calls to a Command host, for the given cooldown. The cooldown doubles with every failed probe, up
+// to maxCooldown. If maxCooldown is less than cooldown, the cooldown doesn't grow.
+func NewCircuitBreaker(threshold int, cooldown, maxCooldown time.Duration) *CircuitBreaker {
+	if maxCooldown < cooldown {
+		maxCooldown = cooldown
+	}
+	return &CircuitBreaker{
+		threshold:   threshold,
+		cooldown:    cooldown,
+		maxCooldown: maxCooldown,
+		now:         time.Now,
+		hosts:       make(map[string]*circuit),
+	}
+}
+
+// allow returns a *CircuitOpenError if calls to host are short-circuited
+func (b *CircuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok || c.failures < b.threshold {
+		return nil
+	}
+
+	if now := b.now(); now.Before(c.openUntil) {
+		return &CircuitOpenError{Host: host, RetryAfter: c.openUntil.Sub(now)}
+	}
+
+	// Only one call probes the host once the cooldown has elapsed, the others keep failing fast
+	if c.probing {
+		return &CircuitOpenError{Host: host, RetryAfter: c.cooldown}
+	}
+	c.probing = true
+	return nil
+}
+
+// record records the outcome of a call to host that was allowed
+func (b *CircuitBreaker) record(host string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		delete(b.hosts, host)
+		return
+	}
+
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	c.failures++
+	c.probing = false
+	switch {
+	case c.failures == b.threshold:
+		c.cooldown = b.cooldown
+	case c.failures > b.threshold:
+		// Only probes are allowed while the circuit is open, so the probe failed
+		c.cooldown = min(2*c.cooldown, b.maxCooldown)
+	default:
+		return
+	}
+	c.openUntil = b.now().Add(c.cooldown)
+}
+
+// Reset closes the circuit of the Command instance at hostname, e.g. after an operator fixed an
+// outage, so that calls to it are allowed again before the cooldown has elapsed. Reset is a no-op
+// on a nil CircuitBreaker.
+func (b *CircuitBreaker) Reset(hostname string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.hosts, commandHost(hostname))
+}
+
+// release ends a probe of host without recording its outcome
+func (b *CircuitBreaker) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.hosts[host]; ok {
+		c.probing = false
+	}
+}
+
+// circuitBreakerTransport short-circuits the requests of a Command client to hosts whose circuit is open
+type circuitBreakerTransport struct {
+	base    http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := t.breaker.allow(host); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		// A request cancelled by the caller says nothing about the availability of Command, unlike a
+		// request that timed out. A probe is released so that the next call probes the host instead.
+		t.breaker.release(host)
+		return resp, err
+	}
+
+	// Connection failures and gateway errors indicate an outage. Other errors, e.g. rejected
+	// credentials, are answered by a healthy Command and don't count as failures.
+	t.breaker.record(host, err != nil || isUnavailable(resp))
+	return resp, err
+}
+
+// isUnavailable returns true if Command answered with an HTTP status that indicates an outage. A 500
+// is the response of a reachable Command to a request it failed to process, e.g. an enrollment the
+// CA rejected, so it doesn't count as an outage.
+func isUnavailable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type circuitBreakerContextKey struct{}
+
+// ContextWithCircuitBreaker returns a copy of ctx carrying the circuit breaker of the Command clients
+// created with it. If ctx carries no circuit breaker, calls to Command are never short-circuited.
+func ContextWithCircuitBreaker(ctx context.Context, breaker *CircuitBreaker) context.Context {
+	return context.WithValue(ctx, circuitBreakerContextKey{}, breaker)
+}
+
+// circuitBreakerFromContext returns the circuit breaker carried by ctx, or nil
+func circuitBreakerFromContext(ctx context.Context) *CircuitBreaker {
+	breaker, _ := ctx.Value(circuitBreakerContextKey{}).(*CircuitBreaker)
+	return breaker
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var status atomic.Int32
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, time.Minute, 10*time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	ctx, spec, annotations, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server)
+	ctx = ContextWithCircuitBreaker(ctx, breaker)
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+	require.NoError(t, err)
+
+	// Client errors and internal server errors are answered by a healthy Command and don't open the circuit
+	status.Store(http.StatusForbidden)
+	for i := 0; i < 5; i++ {
+		assert.Error(t, signer.Check(context.Background()))
+	}
+	status.Store(http.StatusInternalServerError)
+	for i := 0; i < 5; i++ {
+		assert.Error(t, signer.Check(context.Background()))
+	}
+	assert.Equal(t, int32(10), requests.Load())
+
+	// Consecutive server errors open the circuit, after which calls fail fast
+	status.Store(http.StatusServiceUnavailable)
+	for i := 0; i < 3; i++ {
+		assert.Error(t, signer.Check(context.Background()))
+	}
+	err = signer.Check(context.Background())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	var circuitErr *CircuitOpenError
+	if assert.ErrorAs(t, err, &circuitErr) {
+		assert.Equal(t, time.Minute, circuitErr.RetryAfter)
+	}
+	assert.Equal(t, int32(13), requests.Load())
+
+	csr, err := generateCSR("CN=test.example.com")
+	require.NoError(t, err)
+	_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+	assert.ErrorAs(t, err, &circuitErr)
+	assert.Equal(t, int32(13), requests.Load())
+
+	// Once the cooldown has elapsed, a failed probe opens the circuit for twice the cooldown
+	now = now.Add(time.Minute)
+	assert.NotErrorIs(t, signer.Check(context.Background()), ErrCircuitOpen)
+	err = signer.Check(context.Background())
+	if assert.ErrorAs(t, err, &circuitErr) {
+		assert.Equal(t, 2*time.Minute, circuitErr.RetryAfter)
+	}
+	assert.Equal(t, int32(14), requests.Load())
+
+	// A successful probe closes the circuit
+	status.Store(http.StatusOK)
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, signer.Check(context.Background()))
+	assert.NoError(t, signer.Check(context.Background()))
+	assert.Equal(t, int32(16), requests.Load())
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.record("command.example.com", true)
+	assert.ErrorIs(t, breaker.allow("command.example.com"), ErrCircuitOpen)
+	assert.NoError(t, breaker.allow("other.example.com"), "circuits are tracked per host")
+
+	// Only a single call probes the host once the cooldown has elapsed
+	now = now.Add(time.Minute)
+	assert.NoError(t, breaker.allow("command.example.com"))
+	assert.ErrorIs(t, breaker.allow("command.example.com"), ErrCircuitOpen)
+
+	// A cancelled probe lets the next call probe the host
+	breaker.release("command.example.com")
+	assert.NoError(t, breaker.allow("command.example.com"))
+	breaker.record("command.example.com", false)
+	assert.NoError(t, breaker.allow("command.example.com"))
+}
+
+func TestCircuitBreakerBackoff(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute, 5*time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	retryAfter := func() time.Duration {
+		var circuitErr *CircuitOpenError
+		require.ErrorAs(t, breaker.allow("command.example.com"), &circuitErr)
+		return circuitErr.RetryAfter
+	}
+
+	breaker.record("command.example.com", true)
+	assert.Equal(t, time.Minute, retryAfter())
+
+	// Every failed probe doubles the cooldown, up to the maximum
+	for _, expected := range []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		now = now.Add(time.Hour)
+		require.NoError(t, breaker.allow("command.example.com"))
+		breaker.record("command.example.com", true)
+		assert.Equal(t, expected, retryAfter())
+	}
+
+	// A successful probe resets the cooldown
+	now = now.Add(time.Hour)
+	require.NoError(t, breaker.allow("command.example.com"))
+	breaker.record("command.example.com", false)
+	breaker.record("command.example.com", true)
+	assert.Equal(t, time.Minute, retryAfter())
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Minute, time.Minute)
+	breaker.record("command.example.com:443", true)
+	breaker.record("other.example.com", true)
+	require.Error(t, breaker.allow("command.example.com:443"))
+
+	// The hostname of an issuer may include a scheme
+	breaker.Reset("https://command.example.com:443")
+	assert.NoError(t, breaker.allow("command.example.com:443"))
+	assert.Error(t, breaker.allow("other.example.com"))
+
+	var nilBreaker *CircuitBreaker
+	nilBreaker.Reset("command.example.com")
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"unicode"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+// ErrCSRMalformed is returned by Sign when the CSR isn't a PKCS#10 request in any of the encodings
+// the signer accepts. Retrying the request won't succeed.
+var ErrCSRMalformed = errors.New("CSR is not a valid PKCS#10 certificate request")
+
+const (
+	// csrPEMType is the type of the PEM block of the CSRs sent to Command
+	csrPEMType = "CERTIFICATE REQUEST"
+	// legacyCSRPEMType is the type of the PEM block of CSRs written by some older tools
+	legacyCSRPEMType = "NEW CERTIFICATE REQUEST"
+)
+
+// decodeCSR returns the DER encoding of the PKCS#10 request in csrBytes. cert-manager sends PEM
+// encoded CSRs, but requests created by other clients may use the legacy PEM header, base64 encode
+// the DER without a PEM header, or not encode it at all.
+func decodeCSR(csrBytes []byte) ([]byte, error) {
+	if block, _ := pem.Decode(csrBytes); block != nil {
+		if block.Type != csrPEMType && block.Type != legacyCSRPEMType {
+			return nil, fmt.Errorf("%w: PEM block type must be %s, got %s", ErrCSRMalformed, csrPEMType, block.Type)
+		}
+		return block.Bytes, nil
+	}
+
+	// The first byte of a DER encoded request is also a base64 character, so DER is tried first
+	if _, err := x509.ParseCertificateRequest(csrBytes); err == nil {
+		return csrBytes, nil
+	}
+
+	stripped := bytes.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, csrBytes)
+	if der, err := base64.StdEncoding.DecodeString(string(stripped)); err == nil && len(der) > 0 {
+		return der, nil
+	}
+
+	return nil, fmt.Errorf("%w: the CSR is not PEM, base64 or DER encoded", ErrCSRMalformed)
+}
+
+// parseCSR takes a byte array containing an encoded CSR and returns a x509.CertificateRequest object
+func parseCSR(csrBytes []byte) (*x509.CertificateRequest, error) {
+	der, err := decodeCSR(csrBytes)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCSRMalformed, err)
+	}
+	return csr, nil
+}
+
+// encodeCSR returns the CSR in the canonical form of the enrollment format of the issuer. The CSR is
+// re-encoded from its DER encoding regardless of how it was received. PEM sends a single CERTIFICATE
+// REQUEST block with 64 character lines and LF line endings, and PKCS10 sends the base64 encoded DER
+// without a header, footer or line breaks.
+func encodeCSR(csr *x509.CertificateRequest, format commandissuer.EnrollmentFormat) string {
+	if format == commandissuer.EnrollmentFormatPKCS10 {
+		return base64.StdEncoding.EncodeToString(csr.Raw)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: csrPEMType, Bytes: csr.Raw}))
+}
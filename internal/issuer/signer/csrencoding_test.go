@@ -0,0 +1,145 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// csrEncodings returns the CSR in each encoding that the signer accepts, by name
+func csrEncodings(t *testing.T) (der []byte, encodings map[string][]byte) {
+	csrPEM, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+	block, _ := pem.Decode(csrPEM)
+	require.NotNil(t, block)
+	der = block.Bytes
+
+	base64DER := base64.StdEncoding.EncodeToString(der)
+	var wrapped strings.Builder
+	for i := 0; i < len(base64DER); i += 76 {
+		wrapped.WriteString(base64DER[i:min(i+76, len(base64DER))])
+		wrapped.WriteString("\r\n")
+	}
+
+	return der, map[string][]byte{
+		"PEM":              csrPEM,
+		"PEMWithCRLF":      []byte(strings.ReplaceAll(string(csrPEM), "\n", "\r\n")),
+		"PEMWithPreamble":  append([]byte("Certificate Request:\n"), csrPEM...),
+		"LegacyPEMHeader":  pem.EncodeToMemory(&pem.Block{Type: "NEW CERTIFICATE REQUEST", Bytes: der}),
+		"DER":              der,
+		"Base64":           []byte(base64DER),
+		"Base64Wrapped":    []byte(wrapped.String()),
+		"Base64WithSpaces": []byte("  " + base64DER + "\n"),
+	}
+}
+
+func TestParseCSR(t *testing.T) {
+	der, encodings := csrEncodings(t)
+	for name, csrBytes := range encodings {
+		t.Run(name, func(t *testing.T) {
+			csr, err := parseCSR(csrBytes)
+			require.NoError(t, err)
+			assert.Equal(t, der, csr.Raw)
+		})
+	}
+
+	invalid := map[string][]byte{
+		"Empty":          nil,
+		"Garbage":        []byte("not a CSR"),
+		"WrongPEMType":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"TruncatedDER":   der[:len(der)/2],
+		"Base64NotDER":   []byte(base64.StdEncoding.EncodeToString([]byte("not a CSR"))),
+		"PEMWithBadBody": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte("not a CSR")}),
+	}
+	for name, csrBytes := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseCSR(csrBytes)
+			assert.ErrorIs(t, err, ErrCSRMalformed)
+		})
+	}
+}
+
+func TestSignSendsCanonicalCSR(t *testing.T) {
+	der, encodings := csrEncodings(t)
+	canonical := map[commandissuer.EnrollmentFormat]string{
+		commandissuer.EnrollmentFormatPEM:    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})),
+		commandissuer.EnrollmentFormatPKCS10: base64.StdEncoding.EncodeToString(der),
+	}
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	for format, expected := range canonical {
+		for name, csrBytes := range encodings {
+			t.Run(string(format)+"/"+name, func(t *testing.T) {
+				var mu sync.Mutex
+				var enrolled []string
+				server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var body map[string]interface{}
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					csr, _ := body["CSR"].(string)
+					mu.Lock()
+					enrolled = append(enrolled, csr)
+					mu.Unlock()
+
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write(enrollmentResponse)
+				}))
+				defer server.Close()
+
+				ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+				spec.EnrollmentFormat = format
+				signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+				require.NoError(t, err)
+
+				_, _, _, err = signer.Sign(context.Background(), csrBytes, K8sMetadata{})
+				require.NoError(t, err)
+
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Equal(t, []string{expected}, enrolled)
+			})
+		}
+	}
+}
+
+func TestSignRejectsMalformedCSR(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+	require.NoError(t, err)
+
+	_, _, _, err = signer.Sign(context.Background(), []byte("not a CSR"), K8sMetadata{})
+	assert.ErrorIs(t, err, ErrCSRMalformed)
+}
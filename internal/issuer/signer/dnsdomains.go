@@ -0,0 +1,82 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ErrDNSDomainNotPermitted is returned by Sign when the CSR requests a DNS name that isn't permitted
+// by the permittedDNSDomains of the issuer. Retrying the request won't succeed.
+var ErrDNSDomainNotPermitted = errors.New("CSR requests a DNS name that is not permitted by the issuer")
+
+// checkPermittedDNSDomains verifies that every DNS SAN of the CSR, and its Common Name if it is a
+// DNS name, is permitted by one of the permitted DNS domains of the issuer. If the issuer doesn't
+// restrict the DNS names, every CSR conforms. The additional SANs of the issuer are validated
+// against the permitted domains when the issuer is admitted, so they aren't checked here.
+func (s *commandSigner) checkPermittedDNSDomains(csr *x509.CertificateRequest) error {
+	if len(s.permittedDNSDomains) == 0 {
+		return nil
+	}
+
+	if isDNSName(csr.Subject.CommonName) && !s.dnsNamePermitted(csr.Subject.CommonName) {
+		return fmt.Errorf("%w: Common Name %q is not permitted by any of the permittedDNSDomains %s", ErrDNSDomainNotPermitted, csr.Subject.CommonName, s.formatPermittedDNSDomains())
+	}
+
+	for _, dnsName := range csr.DNSNames {
+		if !s.dnsNamePermitted(dnsName) {
+			return fmt.Errorf("%w: DNS SAN %q is not permitted by any of the permittedDNSDomains %s", ErrDNSDomainNotPermitted, dnsName, s.formatPermittedDNSDomains())
+		}
+	}
+
+	return nil
+}
+
+// dnsNamePermitted returns whether a DNS name is permitted by one of the permitted DNS domains
+func (s *commandSigner) dnsNamePermitted(name string) bool {
+	for _, domain := range s.permittedDNSDomains {
+		if commandissuer.DNSDomainPermits(domain, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPermittedDNSDomains returns the permitted DNS domains quoted for an error message
+func (s *commandSigner) formatPermittedDNSDomains() string {
+	quoted := make([]string, len(s.permittedDNSDomains))
+	for i, domain := range s.permittedDNSDomains {
+		quoted[i] = fmt.Sprintf("%q", domain)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// isDNSName returns whether a Common Name is a DNS name with at least two labels, optionally with a
+// wildcard label, so that Common Names such as "My Service" aren't treated as DNS names
+func isDNSName(commonName string) bool {
+	name := strings.TrimSuffix(strings.ToLower(commonName), ".")
+	if !strings.Contains(name, ".") {
+		return false
+	}
+	return len(validation.IsDNS1123Subdomain(strings.TrimPrefix(name, "*."))) == 0
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSDomainPermits(t *testing.T) {
+	tests := []struct {
+		domain   string
+		name     string
+		expected bool
+	}{
+		{domain: "example.com", name: "example.com", expected: true},
+		{domain: "example.com", name: "EXAMPLE.com.", expected: true},
+		{domain: "example.com", name: "app.example.com", expected: false},
+		{domain: "example.com", name: "badexample.com", expected: false},
+		{domain: "*.example.com", name: "app.example.com", expected: true},
+		{domain: "*.example.com", name: "a.b.example.com", expected: true},
+		{domain: "*.example.com", name: "*.example.com", expected: true},
+		{domain: "*.example.com", name: "*.app.example.com", expected: true},
+		{domain: "*.example.com", name: "example.com", expected: false},
+		{domain: "*.example.com", name: "badexample.com", expected: false},
+		{domain: "*.example.com", name: "app.example.com.evil.org", expected: false},
+		{domain: "app.example.com", name: "*.example.com", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain+"/"+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, commandissuer.DNSDomainPermits(tt.domain, tt.name))
+		})
+	}
+}
+
+func TestSignPermittedDNSDomains(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                string
+		permittedDNSDomains []string
+		commonName          string
+		dnsNames            []string
+		additionalDNSNames  []string
+		expectedError       string
+	}{
+		{
+			name:       "NoRestriction",
+			commonName: "app.example.org",
+			dnsNames:   []string{"app.example.org"},
+		},
+		{
+			name:                "ExactMatch",
+			permittedDNSDomains: []string{"example.com"},
+			commonName:          "example.com",
+			dnsNames:            []string{"example.com"},
+		},
+		{
+			name:                "WildcardMatch",
+			permittedDNSDomains: []string{"example.com", "*.example.com"},
+			commonName:          "app.example.com",
+			dnsNames:            []string{"example.com", "app.example.com", "*.app.example.com"},
+		},
+		{
+			name:                "SubdomainOfExactMatch",
+			permittedDNSDomains: []string{"example.com"},
+			commonName:          "example.com",
+			dnsNames:            []string{"example.com", "app.example.com"},
+			expectedError:       `DNS SAN "app.example.com" is not permitted by any of the permittedDNSDomains "example.com"`,
+		},
+		{
+			name:                "DomainOfWildcard",
+			permittedDNSDomains: []string{"*.example.com"},
+			commonName:          "app.example.com",
+			dnsNames:            []string{"app.example.com", "example.com"},
+			expectedError:       `DNS SAN "example.com" is not permitted by any of the permittedDNSDomains "*.example.com"`,
+		},
+		{
+			name:                "OtherDomain",
+			permittedDNSDomains: []string{"*.example.com", "*.example.net"},
+			commonName:          "app.example.com",
+			dnsNames:            []string{"app.example.com", "app.example.org"},
+			expectedError:       `DNS SAN "app.example.org" is not permitted by any of the permittedDNSDomains "*.example.com", "*.example.net"`,
+		},
+		{
+			name:                "CommonNameNotPermitted",
+			permittedDNSDomains: []string{"*.example.com"},
+			commonName:          "app.example.org",
+			dnsNames:            []string{"app.example.com"},
+			expectedError:       `Common Name "app.example.org" is not permitted by any of the permittedDNSDomains "*.example.com"`,
+		},
+		{
+			name:                "CommonNameNotDNSName",
+			permittedDNSDomains: []string{"*.example.com"},
+			commonName:          "My Service",
+			dnsNames:            []string{"app.example.com"},
+		},
+		{
+			name:                "AdditionalSANsNotChecked",
+			permittedDNSDomains: []string{"*.example.com"},
+			commonName:          "app.example.com",
+			dnsNames:            []string{"app.example.com"},
+			additionalDNSNames:  []string{"shared.example.org"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.PermittedDNSDomains = tt.permittedDNSDomains
+			if tt.additionalDNSNames != nil {
+				spec.AdditionalSANs = &commandissuer.AdditionalSANs{DNSNames: tt.additionalDNSNames}
+			}
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			template := x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: tt.commonName},
+				DNSNames: tt.dnsNames,
+			}
+			der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(ctx, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), K8sMetadata{})
+			if tt.expectedError != "" {
+				assert.ErrorIs(t, err, ErrDNSDomainNotPermitted)
+				assert.ErrorContains(t, err, tt.expectedError)
+				assert.Zero(t, requests.Load(), "a CSR with a DNS name that isn't permitted must not be sent to Command")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), requests.Load())
+		})
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// expiringCertificatesPageSize is the number of certificates requested from Command per page when
+// listing the certificates that expire soon
+const expiringCertificatesPageSize = 100
+
+// ExpiringCertificate is a certificate in the inventory of Command that expires soon
+type ExpiringCertificate struct {
+	CertificateID int32
+	CommonName    string
+	NotAfter      time.Time
+}
+
+// ExpiringCertificateLister is implemented by Signers that list the certificates they enrolled that
+// expire soon, according to the inventory of Command
+type ExpiringCertificateLister interface {
+	// ListExpiringCertificates returns the certificates whose Controller-Kind, Issuer-Name,
+	// Issuer-Namespace and Cluster-Name metadata fields match the metadata, which expire before the
+	// given time. Revoked and expired certificates are not returned.
+	ListExpiringCertificates(ctx context.Context, k8sMeta K8sMetadata, before time.Time) ([]ExpiringCertificate, error)
+}
+
+// ListExpiringCertificates implements ExpiringCertificateLister. Command is queried with the read
+// credentials of the issuer if it has any.
+func (s *commandSigner) ListExpiringCertificates(ctx context.Context, k8sMeta K8sMetadata, before time.Time) ([]ExpiringCertificate, error) {
+	query := expiringCertificatesQuery(k8sMeta, before)
+
+	// Pages are requested until a page has no new certificates, like listAllPages does, since a short
+	// page doesn't mean that it is the last one
+	seen := make(map[int32]bool)
+	var certificates []ExpiringCertificate
+	for page := int32(1); ; page++ {
+		results, _, err := s.readAPIClient().CertificateApi.CertificateQueryCertificates(ctx).
+			PqQueryString(query).
+			PqPageReturned(page).
+			PqReturnLimit(expiringCertificatesPageSize).
+			PqIncludeRevoked(false).
+			PqIncludeExpired(false).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the certificates that expire before %s: %w", before.UTC().Format(time.RFC3339), err)
+		}
+
+		added := false
+		for _, result := range results {
+			if seen[result.GetId()] {
+				continue
+			}
+			seen[result.GetId()] = true
+			added = true
+			certificates = append(certificates, ExpiringCertificate{
+				CertificateID: result.GetId(),
+				CommonName:    result.GetIssuedCN(),
+				NotAfter:      result.GetNotAfter(),
+			})
+		}
+		if !added {
+			return certificates, nil
+		}
+	}
+}
+
+// expiringCertificatesQuery returns the Command query of the certificates enrolled with the metadata
+// that expire before the given time. The Issuer-Namespace field is only matched if the metadata has
+// an issuer namespace, and the Cluster-Name field if it has a cluster name.
+func expiringCertificatesQuery(k8sMeta K8sMetadata, before time.Time) string {
+	clauses := []string{
+		fmt.Sprintf("%s -eq %q", CommandMetaControllerKind, k8sMeta.ControllerKind),
+		fmt.Sprintf("%s -eq %q", CommandMetaIssuerName, k8sMeta.IssuerName),
+	}
+	if k8sMeta.IssuerNamespace != "" {
+		clauses = append(clauses, fmt.Sprintf("%s -eq %q", CommandMetaIssuerNamespace, k8sMeta.IssuerNamespace))
+	}
+	if k8sMeta.ClusterName != "" {
+		clauses = append(clauses, fmt.Sprintf("%s -eq %q", CommandMetaClusterName, k8sMeta.ClusterName))
+	}
+	clauses = append(clauses, fmt.Sprintf("NotAfter -le %q", before.UTC().Format(time.RFC3339)))
+	return strings.Join(clauses, " AND ")
+}
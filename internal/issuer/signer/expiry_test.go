@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListExpiringCertificates(t *testing.T) {
+	notAfter := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query := r.URL.Query()
+		queries = append(queries, query.Get("pq.queryString"))
+		assert.Equal(t, "false", query.Get("pq.includeRevoked"))
+		assert.Equal(t, "false", query.Get("pq.includeExpired"))
+
+		// The second page repeats a certificate of the first page, and the third page has no new
+		// certificates, which ends the listing
+		var ids []int
+		switch query.Get("pq.pageReturned") {
+		case "1":
+			ids = []int{1, 2}
+		case "2":
+			ids = []int{2, 3}
+		default:
+			ids = []int{3}
+		}
+		var certificates []map[string]interface{}
+		for _, id := range ids {
+			certificates = append(certificates, map[string]interface{}{
+				"Id":       id,
+				"IssuedCN": "cert" + strconv.Itoa(id) + ".example.com",
+				"NotAfter": notAfter.Format(time.RFC3339),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(certificates)
+	}))
+	defer server.Close()
+
+	ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, nil, authSecretData, nil, caSecretData)
+	require.NoError(t, err)
+
+	certificates, err := signer.ListExpiringCertificates(ctx, K8sMetadata{
+		ControllerKind:  "issuer",
+		IssuerName:      "issuer1",
+		IssuerNamespace: "ns1",
+		ClusterName:     "cluster-a",
+	}, before)
+	require.NoError(t, err)
+
+	require.Len(t, certificates, 3)
+	for i, certificate := range certificates {
+		assert.Equal(t, int32(i+1), certificate.CertificateID)
+		assert.Equal(t, "cert"+strconv.Itoa(i+1)+".example.com", certificate.CommonName)
+		assert.True(t, notAfter.Equal(certificate.NotAfter), certificate.NotAfter)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, queries, 3)
+	assert.Equal(t, `Controller-Kind -eq "issuer" AND Issuer-Name -eq "issuer1" AND Issuer-Namespace -eq "ns1" AND Cluster-Name -eq "cluster-a" AND NotAfter -le "2024-01-31T00:00:00Z"`, queries[0])
+}
+
+func TestExpiringCertificatesQuery(t *testing.T) {
+	before := time.Date(2024, 1, 31, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	query := expiringCertificatesQuery(K8sMetadata{ControllerKind: "clusterissuer", IssuerName: "clusterissuer1"}, before)
+	assert.Equal(t, `Controller-Kind -eq "clusterissuer" AND Issuer-Name -eq "clusterissuer1" AND NotAfter -le "2024-01-31T11:00:00Z"`, query)
+}
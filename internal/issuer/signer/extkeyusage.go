@@ -0,0 +1,121 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+var oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// ErrExtendedKeyUsageAmbiguous is returned by Sign when the extended key usages of the CSR map to
+// different values of the enrollment parameter derived from them. Retrying the request won't succeed.
+var ErrExtendedKeyUsageAmbiguous = errors.New("the extended key usages of the CSR map to different values of the enrollment parameter")
+
+// extendedKeyUsageParameter is an ExtendedKeyUsageParameter with its values keyed by OIDs in dotted
+// notation
+type extendedKeyUsageParameter struct {
+	name         string
+	values       map[string]string
+	defaultValue string
+}
+
+// newExtendedKeyUsageParameter validates the ExtendedKeyUsageParameter of an issuer and keys its
+// values by OID. It returns nil if the issuer doesn't derive a parameter.
+func newExtendedKeyUsageParameter(parameter *commandissuer.ExtendedKeyUsageParameter) (*extendedKeyUsageParameter, error) {
+	if parameter == nil {
+		return nil, nil
+	}
+
+	if parameter.Name == "" {
+		return nil, fmt.Errorf("%w: extendedKeyUsageParameter has no name", ErrInvalidConfig)
+	}
+	if commandissuer.IsReservedEnrollmentParameter(parameter.Name) {
+		return nil, fmt.Errorf("%w: enrollment parameter %q is managed by the issuer and can't be derived from extended key usages", ErrInvalidConfig, parameter.Name)
+	}
+
+	values := make(map[string]string, len(parameter.Values))
+	for usage, value := range parameter.Values {
+		oid, ok := commandissuer.ExtendedKeyUsageOID(usage)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown extended key usage %q in extendedKeyUsageParameter", ErrInvalidConfig, usage)
+		}
+		values[oid] = value
+	}
+
+	return &extendedKeyUsageParameter{name: parameter.Name, values: values, defaultValue: parameter.Default}, nil
+}
+
+// value returns the value of the parameter for the CSR, or false if the CSR is enrolled without it
+func (p *extendedKeyUsageParameter) value(csr *x509.CertificateRequest) (string, bool, error) {
+	usages, err := extendedKeyUsages(csr)
+	if err != nil {
+		return "", false, err
+	}
+
+	matches := make(map[string][]string)
+	for _, usage := range usages {
+		if value, ok := p.values[usage]; ok {
+			matches[value] = append(matches[value], usage)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return p.defaultValue, p.defaultValue != "", nil
+	case 1:
+		for value := range matches {
+			return value, true, nil
+		}
+	}
+
+	conflicts := make([]string, 0, len(matches))
+	for value, usages := range matches {
+		conflicts = append(conflicts, fmt.Sprintf("%q for %s", value, strings.Join(usages, ", ")))
+	}
+	sort.Strings(conflicts)
+	return "", false, fmt.Errorf("%w %q: %s. Request only the extended key usages of one behavior of the certificate template", ErrExtendedKeyUsageAmbiguous, p.name, strings.Join(conflicts, " and "))
+}
+
+// extendedKeyUsages returns the OIDs in dotted notation of the extended key usages requested by the
+// CSR. The standard library doesn't parse the extended key usage extension of CSRs.
+func extendedKeyUsages(csr *x509.CertificateRequest) ([]string, error) {
+	for _, extension := range csr.Extensions {
+		if !extension.Id.Equal(oidExtensionExtendedKeyUsage) {
+			continue
+		}
+
+		var oids []asn1.ObjectIdentifier
+		if rest, err := asn1.Unmarshal(extension.Value, &oids); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("failed to parse the extended key usages of the CSR: %v", err)
+		}
+
+		usages := make([]string, 0, len(oids))
+		for _, oid := range oids {
+			usages = append(usages, oid.String())
+		}
+		return usages, nil
+	}
+	return nil, nil
+}
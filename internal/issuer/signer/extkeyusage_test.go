@@ -0,0 +1,207 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oidServerAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	oidClientAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+	oidCodeSign   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}
+	oidCustom     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+)
+
+func TestSignExtendedKeyUsageParameter(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	authBehaviors := &commandissuer.ExtendedKeyUsageParameter{
+		Name:   "SubTemplate",
+		Values: map[string]string{"server auth": "Server", "client auth": "Client"},
+	}
+
+	tests := []struct {
+		name          string
+		parameter     *commandissuer.ExtendedKeyUsageParameter
+		usages        []asn1.ObjectIdentifier
+		expectedValue interface{}
+		expectedError error
+	}{
+		{
+			name:   "NoParameter",
+			usages: []asn1.ObjectIdentifier{oidServerAuth},
+		},
+		{
+			name:          "ServerAuth",
+			parameter:     authBehaviors,
+			usages:        []asn1.ObjectIdentifier{oidServerAuth},
+			expectedValue: "Server",
+		},
+		{
+			name:          "ClientAuth",
+			parameter:     authBehaviors,
+			usages:        []asn1.ObjectIdentifier{oidClientAuth},
+			expectedValue: "Client",
+		},
+		{
+			name:          "UnmappedUsagesAreIgnored",
+			parameter:     authBehaviors,
+			usages:        []asn1.ObjectIdentifier{oidCodeSign, oidServerAuth},
+			expectedValue: "Server",
+		},
+		{
+			name:          "Ambiguous",
+			parameter:     authBehaviors,
+			usages:        []asn1.ObjectIdentifier{oidServerAuth, oidClientAuth},
+			expectedError: ErrExtendedKeyUsageAmbiguous,
+		},
+		{
+			name: "SameValue",
+			parameter: &commandissuer.ExtendedKeyUsageParameter{
+				Name:   "SubTemplate",
+				Values: map[string]string{"server auth": "TLS", "client auth": "TLS"},
+			},
+			usages:        []asn1.ObjectIdentifier{oidServerAuth, oidClientAuth},
+			expectedValue: "TLS",
+		},
+		{
+			name:      "NoMappedUsage",
+			parameter: authBehaviors,
+			usages:    []asn1.ObjectIdentifier{oidCodeSign},
+		},
+		{
+			name:      "NoUsages",
+			parameter: authBehaviors,
+		},
+		{
+			name: "Default",
+			parameter: &commandissuer.ExtendedKeyUsageParameter{
+				Name:    "SubTemplate",
+				Values:  map[string]string{"server auth": "Server"},
+				Default: "Generic",
+			},
+			expectedValue: "Generic",
+		},
+		{
+			name: "OID",
+			parameter: &commandissuer.ExtendedKeyUsageParameter{
+				Name:   "SubTemplate",
+				Values: map[string]string{oidCustom.String(): "Custom"},
+			},
+			usages:        []asn1.ObjectIdentifier{oidCustom},
+			expectedValue: "Custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.ExtendedKeyUsageParameter = tt.parameter
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), generateCSRWithExtendedKeyUsages(t, tt.usages), K8sMetadata{})
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Empty(t, requests, "an ambiguous CSR must not be sent to Command")
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.expectedValue, requests[0]["SubTemplate"])
+		})
+	}
+}
+
+func TestExtendedKeyUsageParameterBuilder(t *testing.T) {
+	tests := []struct {
+		name      string
+		parameter *commandissuer.ExtendedKeyUsageParameter
+	}{
+		{
+			name:      "MissingName",
+			parameter: &commandissuer.ExtendedKeyUsageParameter{Values: map[string]string{"server auth": "Server"}},
+		},
+		{
+			name:      "ReservedName",
+			parameter: &commandissuer.ExtendedKeyUsageParameter{Name: "Template", Values: map[string]string{"server auth": "Server"}},
+		},
+		{
+			name:      "UnknownUsage",
+			parameter: &commandissuer.ExtendedKeyUsageParameter{Name: "SubTemplate", Values: map[string]string{"web auth": "Server"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newExtendedKeyUsageParameter(tt.parameter)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
+
+// generateCSRWithExtendedKeyUsages returns a PEM encoded CSR that requests the extended key usages
+func generateCSRWithExtendedKeyUsages(t *testing.T, usages []asn1.ObjectIdentifier) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := x509.CertificateRequest{Subject: pkix.Name{CommonName: "app.example.com"}}
+	if len(usages) > 0 {
+		value, err := asn1.Marshal(usages)
+		require.NoError(t, err)
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oidExtensionExtendedKeyUsage, Value: value})
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// failoverTransport sends the requests of a Command client to the first of several Command hosts that
+// serves them, e.g. to fail over from a primary to a secondary Command instance. Every attempt is
+// bounded by commandRequestTimeout so that an unreachable host doesn't exhaust the timeout of the
+// client.
+//
+// Requests that aren't idempotent, i.e. enrollments, are only sent to the next host if they couldn't
+// be sent to the previous one, since a request that reached Command may have been processed even if
+// no response was received. Idempotent requests are also sent to the next host if the previous one
+// failed to respond or responded that it is unavailable.
+type failoverTransport struct {
+	base http.RoundTripper
+	// hosts are the hosts of the Command instances in the order they are tried. The host of the
+	// request URL is replaced by each of them.
+	hosts []string
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body can't be sent again, so the request can't fail over
+		return t.base.RoundTrip(req)
+	}
+
+	var failures []string
+	for i, host := range t.hosts {
+		resp, err := t.roundTrip(req, host)
+		last := i == len(t.hosts)-1
+		if req.Context().Err() != nil || last || !shouldFailOver(req, resp, err) {
+			if err == nil {
+				endpointRecorderFromContext(req.Context()).record(host, i > 0)
+			}
+			if err != nil && len(failures) > 0 {
+				err = fmt.Errorf("all Command endpoints failed: %s; %s: %w", strings.Join(failures, "; "), host, err)
+			}
+			return resp, err
+		}
+
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", host, err))
+		} else {
+			failures = append(failures, fmt.Sprintf("%s: HTTP %d", host, resp.StatusCode))
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}
+
+	// Not reached, since the last host always returns
+	return nil, errors.New("no Command endpoints are configured")
+}
+
+// roundTrip sends a copy of req to host, bounded by commandRequestTimeout
+func (t *failoverTransport) roundTrip(req *http.Request, host string) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), commandRequestTimeout)
+
+	attempt := req.Clone(ctx)
+	attempt.URL.Host = host
+	attempt.Host = ""
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attempt.Body = body
+	}
+
+	resp, err := t.base.RoundTrip(attempt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The attempt is cancelled once its response is read
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// shouldFailOver returns true if the request should be sent to the next Command host given the
+// response or error of the previous one
+func shouldFailOver(req *http.Request, resp *http.Response, err error) bool {
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) || isConnectionFailure(err) {
+		// The request wasn't sent
+		return true
+	}
+
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if !idempotent {
+		return false
+	}
+	return err != nil || isTransientFailure(resp)
+}
+
+// isConnectionFailure returns true if err indicates that no connection to Command could be
+// established, so that the request wasn't sent
+func isConnectionFailure(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// cancelOnClose cancels the context of a request when its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// EndpointRecorder records the Command host that served the requests of the Command clients created
+// with a context returned by ContextWithEndpointRecorder. Hosts are only recorded if the issuer has
+// fallback hostnames.
+type EndpointRecorder struct {
+	mu         sync.Mutex
+	host       string
+	failedOver bool
+}
+
+// Endpoint returns the host of the Command instance that served the last request, and whether it is
+// a fallback of the issuer's hostname. It returns an empty host if no request was recorded.
+func (r *EndpointRecorder) Endpoint() (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.host, r.failedOver
+}
+
+// record records that host served a request
+func (r *EndpointRecorder) record(host string, failedOver bool) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.host, r.failedOver = host, failedOver
+}
+
+type endpointRecorderContextKey struct{}
+
+// ContextWithEndpointRecorder returns a copy of ctx carrying a new EndpointRecorder, which records the
+// Command host that serves the requests of the Command clients created with the context
+func ContextWithEndpointRecorder(ctx context.Context) (context.Context, *EndpointRecorder) {
+	recorder := &EndpointRecorder{}
+	return context.WithValue(ctx, endpointRecorderContextKey{}, recorder), recorder
+}
+
+// endpointRecorderFromContext returns the endpoint recorder carried by ctx, or nil
+func endpointRecorderFromContext(ctx context.Context) *EndpointRecorder {
+	recorder, _ := ctx.Value(endpointRecorderContextKey{}).(*EndpointRecorder)
+	return recorder
+}
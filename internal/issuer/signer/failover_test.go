@@ -0,0 +1,165 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverTransport(t *testing.T) {
+	newServer := func(status int, body string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+		return server.Listener.Addr().String()
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	healthy := newServer(http.StatusOK, "healthy")
+	unavailable := newServer(http.StatusServiceUnavailable, "unavailable")
+
+	tests := []struct {
+		name               string
+		method             string
+		hosts              []string
+		expectedBody       string
+		expectedStatus     int
+		expectedError      string
+		expectedEndpoint   string
+		expectedFailedOver bool
+	}{
+		{
+			name:             "Primary",
+			method:           http.MethodGet,
+			hosts:            []string{healthy, unreachable},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "healthy",
+			expectedEndpoint: healthy,
+		},
+		{
+			name:               "PrimaryUnreachable",
+			method:             http.MethodGet,
+			hosts:              []string{unreachable, healthy},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "healthy",
+			expectedEndpoint:   healthy,
+			expectedFailedOver: true,
+		},
+		{
+			name:               "EnrollmentPrimaryUnreachable",
+			method:             http.MethodPost,
+			hosts:              []string{unreachable, healthy},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "healthy",
+			expectedEndpoint:   healthy,
+			expectedFailedOver: true,
+		},
+		{
+			name:               "PrimaryUnavailable",
+			method:             http.MethodGet,
+			hosts:              []string{unavailable, healthy},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "healthy",
+			expectedEndpoint:   healthy,
+			expectedFailedOver: true,
+		},
+		{
+			// The enrollment may have been processed by the primary, so it isn't sent again
+			name:             "EnrollmentPrimaryUnavailable",
+			method:           http.MethodPost,
+			hosts:            []string{unavailable, healthy},
+			expectedStatus:   http.StatusServiceUnavailable,
+			expectedBody:     "unavailable",
+			expectedEndpoint: unavailable,
+		},
+		{
+			name:          "AllUnreachable",
+			method:        http.MethodGet,
+			hosts:         []string{unreachable, unreachable},
+			expectedError: "all Command endpoints failed: " + unreachable + ": ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, recorder := ContextWithEndpointRecorder(context.Background())
+			request, err := http.NewRequestWithContext(ctx, tt.method, "http://"+tt.hosts[0]+"/KeyfactorAPI/Status/Endpoints", strings.NewReader("{}"))
+			require.NoError(t, err)
+
+			transport := &failoverTransport{base: http.DefaultTransport, hosts: tt.hosts}
+			response, err := transport.RoundTrip(request)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				endpoint, _ := recorder.Endpoint()
+				assert.Empty(t, endpoint)
+				return
+			}
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.StatusCode)
+			assert.Equal(t, tt.expectedBody, string(body))
+
+			endpoint, failedOver := recorder.Endpoint()
+			assert.Equal(t, tt.expectedEndpoint, endpoint)
+			assert.Equal(t, tt.expectedFailedOver, failedOver)
+		})
+	}
+}
+
+func TestHealthCheckFailover(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+	spec.FallbackHostnames = []string{spec.Hostname}
+	spec.Hostname = "https://" + unreachable
+
+	ctx, recorder := ContextWithEndpointRecorder(context.Background())
+	checker, err := CommandHealthCheckerFromIssuerAndSecretData(ctx, spec, authSecretData, caSecretData)
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(ctx))
+
+	endpoint, failedOver := recorder.Endpoint()
+	assert.Equal(t, server.Listener.Addr().String(), endpoint)
+	assert.True(t, failedOver)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides in-memory implementations of the Command signer and health checker, so that
+// the reconcilers can be tested without a Command instance.
+//
+// The builders returned by SignerBuilder and HealthCheckerBuilder can be assigned to the
+// SignerBuilder and HealthCheckerBuilder fields of the reconcilers:
+//
+//	fakeSigner, err := fake.NewSigner()
+//	...
+//	reconciler := controllers.CertificateRequestReconciler{
+//		...
+//		SignerBuilder: fake.SignerBuilder(fakeSigner),
+//	}
+package fake
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+)
+
+// DefaultDuration is the lifetime of the certificates issued by Signer if the request doesn't set one
+const DefaultDuration = 90 * 24 * time.Hour
+
+// Signer is a signer.Signer that issues certificates from an in-memory, self-signed CA instead of
+// enrolling them with Command. The certificates contain the subject, SANs, key usages and public
+// key of the CSR.
+type Signer struct {
+	// Err is returned by Sign and PollEnrollment instead of a certificate if set, e.g. to simulate
+	// a signer.ErrEnrollmentDenied error
+	Err error
+
+	mu            sync.Mutex
+	ca            *x509.Certificate
+	caKey         *ecdsa.PrivateKey
+	caPEM         []byte
+	serial        int64
+	requests      []signer.K8sMetadata
+	certificateID int32
+}
+
+var _ signer.Signer = &Signer{}
+
+// NewSigner returns a Signer with a new in-memory CA
+func NewSigner() (*Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the CA key: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake Command CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the CA certificate: %w", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the CA certificate: %w", err)
+	}
+
+	return &Signer{
+		ca:     ca,
+		caKey:  key,
+		caPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial: 1,
+	}, nil
+}
+
+// CA returns the PEM-encoded certificate of the CA that issues the certificates
+func (s *Signer) CA() []byte {
+	return s.caPEM
+}
+
+// Requests returns the metadata of the requests signed so far, in order
+func (s *Signer) Requests() []signer.K8sMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]signer.K8sMetadata(nil), s.requests...)
+}
+
+// Sign issues a certificate for the PEM-encoded CSR and returns it with the CA certificate and an
+// increasing fake Command ID
+func (s *Signer) Sign(ctx context.Context, csrBytes []byte, meta signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	release, err := signer.EnterEnrollmentGate(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, meta)
+	if s.Err != nil {
+		return nil, nil, 0, s.Err
+	}
+
+	block, _ := pem.Decode(csrBytes)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, nil, 0, errors.New("PEM block type must be CERTIFICATE REQUEST")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to parse the CSR: %w", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid CSR signature: %w", err)
+	}
+
+	duration := meta.Duration
+	if duration <= 0 {
+		duration = DefaultDuration
+	}
+
+	s.serial++
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(s.serial),
+		Subject:         csr.Subject,
+		DNSNames:        csr.DNSNames,
+		IPAddresses:     csr.IPAddresses,
+		URIs:            csr.URIs,
+		EmailAddresses:  csr.EmailAddresses,
+		ExtraExtensions: csr.Extensions,
+		NotBefore:       now,
+		NotAfter:        now.Add(duration),
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to issue the certificate: %w", err)
+	}
+
+	s.certificateID++
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), s.caPEM, s.certificateID, nil
+}
+
+// PollEnrollment always fails since Sign never reports an enrollment as pending, unless Err is set,
+// in which case Err is returned
+func (s *Signer) PollEnrollment(ctx context.Context, _ []byte, requestID int32, _ signer.K8sMetadata) ([]byte, []byte, int32, error) {
+	release, err := signer.EnterEnrollmentGate(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return nil, nil, 0, s.Err
+	}
+	return nil, nil, 0, fmt.Errorf("enrollment request %d does not exist", requestID)
+}
+
+// SignerBuilder returns a signer.CommandSignerBuilder that ignores the issuer and its Secrets and
+// always returns s
+func SignerBuilder(s *Signer) signer.CommandSignerBuilder {
+	return func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (signer.Signer, error) {
+		return s, nil
+	}
+}
+
+// HealthChecker is a signer.HealthChecker that reports the health and version of a fake Command
+// instance
+type HealthChecker struct {
+	// Err is returned by Check if set, e.g. to simulate a signer.ErrTransient error
+	Err error
+	// Version is returned by CommandVersion
+	Version string
+}
+
+var _ signer.HealthChecker = &HealthChecker{}
+
+// Check returns Err
+func (h *HealthChecker) Check(context.Context) error {
+	return h.Err
+}
+
+// CommandVersion returns Version
+func (h *HealthChecker) CommandVersion(context.Context) (string, error) {
+	return h.Version, nil
+}
+
+// HealthCheckerBuilder returns a signer.HealthCheckerBuilder that ignores the issuer and its Secrets
+// and always returns h
+func HealthCheckerBuilder(h *HealthChecker) signer.HealthCheckerBuilder {
+	return func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (signer.HealthChecker, error) {
+		return h, nil
+	}
+}
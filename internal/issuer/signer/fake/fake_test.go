@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
+)
+
+func TestSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "app.example.com"},
+		DNSNames: []string{"app.example.com", "www.example.com"},
+	}, key)
+	require.NoError(t, err)
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	fakeSigner, err := NewSigner()
+	require.NoError(t, err)
+
+	leafPEM, caPEM, certificateID, err := fakeSigner.Sign(context.Background(), csr, signer.K8sMetadata{IssuerName: "issuer1", Duration: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), certificateID)
+	assert.Equal(t, fakeSigner.CA(), caPEM)
+
+	block, _ := pem.Decode(leafPEM)
+	require.NotNil(t, block)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com", leaf.Subject.CommonName)
+	assert.Equal(t, []string{"app.example.com", "www.example.com"}, leaf.DNSNames)
+	assert.Equal(t, &key.PublicKey, leaf.PublicKey)
+	assert.Equal(t, time.Hour, leaf.NotAfter.Sub(leaf.NotBefore))
+
+	// The certificate is issued by the CA
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "www.example.com"})
+	assert.NoError(t, err)
+
+	// Following enrollments get new IDs
+	_, _, certificateID, err = fakeSigner.Sign(context.Background(), csr, signer.K8sMetadata{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), certificateID)
+
+	if assert.Len(t, fakeSigner.Requests(), 2) {
+		assert.Equal(t, "issuer1", fakeSigner.Requests()[0].IssuerName)
+	}
+
+	_, _, _, err = fakeSigner.Sign(context.Background(), []byte("not a CSR"), signer.K8sMetadata{})
+	assert.Error(t, err)
+
+	fakeSigner.Err = signer.ErrEnrollmentDenied
+	_, _, _, err = fakeSigner.Sign(context.Background(), csr, signer.K8sMetadata{})
+	assert.ErrorIs(t, err, signer.ErrEnrollmentDenied)
+}
+
+func TestBuilders(t *testing.T) {
+	fakeSigner, err := NewSigner()
+	require.NoError(t, err)
+	s, err := SignerBuilder(fakeSigner)(context.Background(), nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Same(t, fakeSigner, s)
+
+	checker := &HealthChecker{Err: signer.ErrTransient, Version: "24.4.0"}
+	h, err := HealthCheckerBuilder(checker)(context.Background(), nil, nil, nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, h.Check(context.Background()), signer.ErrTransient)
+	version, err := h.CommandVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "24.4.0", version)
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// CertificateFingerprint returns the serial number and the SHA-256 fingerprint of the DER encoding
+// of the PEM-encoded certificate issued by Command, both as uppercase hex, so that the certificate
+// can be correlated with the records of Command and of external audit systems.
+func CertificateFingerprint(certificateBytes []byte) (serial string, fingerprint string, err error) {
+	certificate, err := parseCertificatePEM(certificateBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256(certificate.Raw)
+	return strings.ToUpper(certificate.SerialNumber.Text(16)), fmt.Sprintf("%X", sum), nil
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateFingerprint(t *testing.T) {
+	certificate, err := generateSelfSignedCertificate()
+	require.NoError(t, err)
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+
+	serial, fingerprint, err := CertificateFingerprint(certificatePEM)
+	require.NoError(t, err)
+	assert.Equal(t, "1", serial)
+	sum := sha256.Sum256(certificate.Raw)
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), fingerprint)
+
+	_, _, err = CertificateFingerprint([]byte("not a certificate"))
+	assert.Error(t, err)
+}
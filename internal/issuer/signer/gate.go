@@ -0,0 +1,44 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import "context"
+
+// EnrollmentGate admits the calls of a signer to Command. It returns a function that releases the
+// call once Command responded, or an error if the call isn't admitted, in which case Command isn't
+// called.
+type EnrollmentGate func() (func(), error)
+
+type enrollmentGateContextKey struct{}
+
+// ContextWithEnrollmentGate returns a copy of ctx carrying the gate of the enrollments of the signers
+// it is passed to. Signers pass the gate only once a request passed their own checks, so requests
+// rejected by policy don't consume the capacity the gate admits.
+func ContextWithEnrollmentGate(ctx context.Context, gate EnrollmentGate) context.Context {
+	return context.WithValue(ctx, enrollmentGateContextKey{}, gate)
+}
+
+// EnterEnrollmentGate passes the enrollment gate carried by ctx right before a signer enrolls,
+// renews, or polls a certificate in Command. The returned function must be called once Command
+// responded. If ctx carries no gate, the call is always admitted.
+func EnterEnrollmentGate(ctx context.Context) (func(), error) {
+	gate, _ := ctx.Value(enrollmentGateContextKey{}).(EnrollmentGate)
+	if gate == nil {
+		return func() {}, nil
+	}
+	return gate()
+}
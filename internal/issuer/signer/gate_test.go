@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignEnrollmentGate(t *testing.T) {
+	response := fakeEnrollmentResponse(t)
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(response)
+	}))
+	defer server.Close()
+
+	ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, nil, authSecretData, nil, caSecretData)
+	require.NoError(t, err)
+
+	var entered, released int
+	errClosed := errors.New("gate closed")
+	open := true
+	gateCtx := ContextWithEnrollmentGate(context.Background(), func() (func(), error) {
+		entered++
+		if !open {
+			return nil, errClosed
+		}
+		return func() { released++ }, nil
+	})
+
+	// Requests rejected by the signer don't pass the gate
+	_, _, _, err = signer.Sign(gateCtx, csr, K8sMetadata{IsCA: true})
+	assert.ErrorIs(t, err, ErrCANotAllowed)
+	assert.Equal(t, 0, entered)
+
+	// Admitted enrollments are released once Command responded
+	_, _, _, err = signer.Sign(gateCtx, csr, K8sMetadata{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, entered)
+	assert.Equal(t, 1, released)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Enrollments that aren't admitted don't call Command
+	open = false
+	_, _, _, err = signer.Sign(gateCtx, csr, K8sMetadata{})
+	assert.ErrorIs(t, err, errClosed)
+	assert.Equal(t, 2, entered)
+	assert.Equal(t, int32(1), requests.Load())
+}
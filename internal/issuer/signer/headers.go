@@ -0,0 +1,54 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+// requestHeaders returns the static HTTP headers of the issuer, with the values of headers that
+// reference a Secret key read from secretData. Headers managed by the issuer, including the request
+// ID header carried by ctx, are rejected since the HTTP client would send them twice.
+func requestHeaders(ctx context.Context, spec *commandissuer.IssuerSpec, secretData map[string][]byte) (map[string]string, error) {
+	if len(spec.RequestHeaders) == 0 {
+		return nil, nil
+	}
+
+	requestIDHeader, _, _ := requestIDHeaderFromContext(ctx)
+
+	headers := make(map[string]string, len(spec.RequestHeaders))
+	for _, header := range spec.RequestHeaders {
+		if commandissuer.IsReservedRequestHeader(header.Name) || (requestIDHeader != "" && strings.EqualFold(header.Name, requestIDHeader)) {
+			return nil, fmt.Errorf("the %q request header is managed by the issuer", header.Name)
+		}
+
+		value := header.Value
+		if header.SecretKey != "" {
+			// Secret values are commonly written with a trailing newline, which isn't valid in a header
+			value = strings.TrimSpace(string(secretData[header.SecretKey]))
+			if value == "" {
+				return nil, fmt.Errorf("%w: the Secret has no value for the %q request header in the %q key", ErrMissingCredentials, header.Name, header.SecretKey)
+			}
+		}
+		headers[header.Name] = value
+	}
+	return headers, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var received http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		headers         []commandissuer.RequestHeader
+		secretData      map[string][]byte
+		requestIDHeader string
+		expected        map[string]string
+		expectedError   error
+	}{
+		{
+			name: "Value",
+			headers: []commandissuer.RequestHeader{
+				{Name: "X-Api-Key", Value: "key"},
+			},
+			expected: map[string]string{"X-Api-Key": "key"},
+		},
+		{
+			name: "SecretKey",
+			headers: []commandissuer.RequestHeader{
+				{Name: "X-Api-Key", SecretKey: "apiKey"},
+				{Name: "X-Tenant", Value: "tenant1"},
+			},
+			secretData: map[string][]byte{"apiKey": []byte("secret-key\n")},
+			expected:   map[string]string{"X-Api-Key": "secret-key", "X-Tenant": "tenant1"},
+		},
+		{
+			name: "MissingSecretKey",
+			headers: []commandissuer.RequestHeader{
+				{Name: "X-Api-Key", SecretKey: "apiKey"},
+			},
+			expectedError: ErrMissingCredentials,
+		},
+		{
+			name: "ReservedHeader",
+			headers: []commandissuer.RequestHeader{
+				{Name: "authorization", Value: "Bearer token"},
+			},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			name: "RequestIDHeader",
+			headers: []commandissuer.RequestHeader{
+				{Name: "X-Request-ID", Value: "static"},
+			},
+			requestIDHeader: DefaultRequestIDHeader,
+			expectedError:   ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+			spec.RequestHeaders = tt.headers
+			for key, value := range tt.secretData {
+				authSecretData[key] = value
+			}
+
+			ctx := context.Background()
+			if tt.requestIDHeader != "" {
+				ctx, _ = ContextWithRequestID(ctx, tt.requestIDHeader)
+			}
+
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(ctx, spec, authSecretData, caSecretData)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, checker.Check(ctx))
+
+			mu.Lock()
+			defer mu.Unlock()
+			for name, value := range tt.expected {
+				assert.Equal(t, []string{value}, received.Values(name))
+			}
+			// The credentials of the issuer are still sent
+			assert.NotEmpty(t, received.Get("Authorization"))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+// ErrKeyPolicyViolation is returned by Sign when the public key or signature algorithm of the CSR
+// doesn't conform to the key policy of the issuer. Retrying the request won't succeed.
+var ErrKeyPolicyViolation = errors.New("CSR does not conform to the issuer key policy")
+
+// checkKeyPolicy returns an error if the public key or signature algorithm of the CSR isn't allowed
+// by the key policy. A nil policy allows every CSR.
+func checkKeyPolicy(csr *x509.CertificateRequest, policy *commandissuer.KeyPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	var keyAlgorithm commandissuer.KeyAlgorithm
+	switch pub := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		keyAlgorithm = commandissuer.KeyAlgorithmRSA
+		if size := pub.N.BitLen(); size < policy.MinRSAKeySize {
+			return fmt.Errorf("%w: the CSR has a %d-bit RSA key, smaller than the minimum of %d bits", ErrKeyPolicyViolation, size, policy.MinRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		keyAlgorithm = commandissuer.KeyAlgorithmECDSA
+		if size := pub.Curve.Params().BitSize; size < policy.MinECDSAKeySize {
+			return fmt.Errorf("%w: the CSR has a %d-bit ECDSA key, smaller than the minimum of %d bits", ErrKeyPolicyViolation, size, policy.MinECDSAKeySize)
+		}
+	case ed25519.PublicKey:
+		keyAlgorithm = commandissuer.KeyAlgorithmEd25519
+	default:
+		return fmt.Errorf("%w: the CSR has an unsupported %s key", ErrKeyPolicyViolation, csr.PublicKeyAlgorithm)
+	}
+
+	if !containsAlgorithm(policy.AllowedKeyAlgorithms, keyAlgorithm) {
+		return fmt.Errorf("%w: %s keys are not allowed", ErrKeyPolicyViolation, keyAlgorithm)
+	}
+
+	signatureAlgorithm := commandissuer.SignatureAlgorithm(csr.SignatureAlgorithm.String())
+	if !containsAlgorithm(policy.AllowedSignatureAlgorithms, signatureAlgorithm) {
+		return fmt.Errorf("%w: the CSR is signed with %s, which is not allowed", ErrKeyPolicyViolation, signatureAlgorithm)
+	}
+
+	return nil
+}
+
+// csrKeyAlgorithm returns the algorithm of the public key of the CSR, or false if it isn't one of
+// the key algorithms known to the issuer
+func csrKeyAlgorithm(csr *x509.CertificateRequest) (commandissuer.KeyAlgorithm, bool) {
+	switch csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return commandissuer.KeyAlgorithmRSA, true
+	case *ecdsa.PublicKey:
+		return commandissuer.KeyAlgorithmECDSA, true
+	case ed25519.PublicKey:
+		return commandissuer.KeyAlgorithmEd25519, true
+	default:
+		return "", false
+	}
+}
+
+// containsAlgorithm returns true if algorithm is in allowed, or if allowed is empty
+func containsAlgorithm[T comparable](allowed []T, algorithm T) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignKeyPolicy(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name               string
+		key                crypto.Signer
+		signatureAlgorithm x509.SignatureAlgorithm
+		policy             *commandissuer.KeyPolicy
+		expectedError      error
+	}{
+		{
+			name: "NoPolicy",
+			key:  rsa1024,
+		},
+		{
+			name:          "WeakRSAKey",
+			key:           rsa1024,
+			policy:        &commandissuer.KeyPolicy{MinRSAKeySize: 2048},
+			expectedError: ErrKeyPolicyViolation,
+		},
+		{
+			name:   "RSAKey",
+			key:    rsa2048,
+			policy: &commandissuer.KeyPolicy{MinRSAKeySize: 2048},
+		},
+		{
+			name:          "WeakECDSAKey",
+			key:           p256,
+			policy:        &commandissuer.KeyPolicy{MinECDSAKeySize: 384},
+			expectedError: ErrKeyPolicyViolation,
+		},
+		{
+			name:   "ECDSAKey",
+			key:    p384,
+			policy: &commandissuer.KeyPolicy{MinECDSAKeySize: 384},
+		},
+		{
+			name:   "Ed25519Key",
+			key:    ed25519Key,
+			policy: &commandissuer.KeyPolicy{AllowedKeyAlgorithms: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmRSA, commandissuer.KeyAlgorithmEd25519}},
+		},
+		{
+			name:          "KeyAlgorithmNotAllowed",
+			key:           ed25519Key,
+			policy:        &commandissuer.KeyPolicy{AllowedKeyAlgorithms: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmRSA, commandissuer.KeyAlgorithmECDSA}},
+			expectedError: ErrKeyPolicyViolation,
+		},
+		{
+			name:               "SHA1Signature",
+			key:                rsa2048,
+			signatureAlgorithm: x509.SHA1WithRSA,
+			policy:             &commandissuer.KeyPolicy{AllowedSignatureAlgorithms: []commandissuer.SignatureAlgorithm{commandissuer.SignatureAlgorithmSHA256WithRSA, commandissuer.SignatureAlgorithmECDSAWithSHA256}},
+			expectedError:      ErrKeyPolicyViolation,
+		},
+		{
+			name:               "AllowedSignature",
+			key:                rsa2048,
+			signatureAlgorithm: x509.SHA256WithRSA,
+			policy:             &commandissuer.KeyPolicy{AllowedSignatureAlgorithms: []commandissuer.SignatureAlgorithm{commandissuer.SignatureAlgorithmSHA256WithRSA, commandissuer.SignatureAlgorithmECDSAWithSHA256}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.KeyPolicy = tt.policy
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			template := x509.CertificateRequest{
+				Subject:            pkix.Name{CommonName: "app.example.com"},
+				DNSNames:           []string{"app.example.com"},
+				SignatureAlgorithm: tt.signatureAlgorithm,
+			}
+			der, err := x509.CreateCertificateRequest(rand.Reader, &template, tt.key)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(ctx, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), K8sMetadata{})
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Zero(t, requests.Load(), "a CSR that violates the key policy must not be sent to Command")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), requests.Load())
+		})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// LatencyObserver observes the latency of the requests to Command, e.g. to record it as a metric
+type LatencyObserver interface {
+	// ObserveCommandLatency is called with the time Command took to respond to a request
+	ObserveCommandLatency(latency time.Duration)
+}
+
+// latencyTransport reports the latency of every request to a Command host to an observer. Requests
+// cancelled by the caller are not reported, since their duration says nothing about Command.
+type latencyTransport struct {
+	base     http.RoundTripper
+	observer LatencyObserver
+	now      func() time.Time
+}
+
+func (t *latencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := t.now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		return resp, err
+	}
+	t.observer.ObserveCommandLatency(t.now().Sub(start))
+	return resp, err
+}
+
+type latencyObserverContextKey struct{}
+
+// ContextWithLatencyObserver returns a copy of ctx carrying the observer of the latency of the requests
+// of the Command clients created with it. If ctx carries no observer, the latency isn't observed.
+func ContextWithLatencyObserver(ctx context.Context, observer LatencyObserver) context.Context {
+	return context.WithValue(ctx, latencyObserverContextKey{}, observer)
+}
+
+// latencyObserverFromContext returns the latency observer carried by ctx, or nil
+func latencyObserverFromContext(ctx context.Context) LatencyObserver {
+	observer, _ := ctx.Value(latencyObserverContextKey{}).(LatencyObserver)
+	return observer
+}
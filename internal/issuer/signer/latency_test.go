@@ -0,0 +1,95 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLatencyObserver records the latencies it observes
+type recordingLatencyObserver struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func (o *recordingLatencyObserver) ObserveCommandLatency(latency time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.latencies = append(o.latencies, latency)
+}
+
+func (o *recordingLatencyObserver) observed() []time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]time.Duration(nil), o.latencies...)
+}
+
+func TestLatencyObserver(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	observer := &recordingLatencyObserver{}
+	ctx, spec, annotations, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server)
+	ctx = ContextWithLatencyObserver(ctx, observer)
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+	require.NoError(t, err)
+
+	require.NoError(t, signer.Check(context.Background()))
+	latencies := observer.observed()
+	require.Len(t, latencies, 1)
+	assert.GreaterOrEqual(t, latencies[0], delay)
+
+	// A request cancelled by the caller isn't observed
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, signer.Check(cancelledCtx))
+	assert.Len(t, observer.observed(), 1)
+}
+
+func TestLatencyObserverWithCircuitBreaker(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	observer := &recordingLatencyObserver{}
+	ctx, spec, annotations, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server)
+	ctx = ContextWithLatencyObserver(ctx, observer)
+	ctx = ContextWithCircuitBreaker(ctx, NewCircuitBreaker(DefaultCircuitBreakerThreshold, time.Minute, 10*time.Minute))
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+	require.NoError(t, err)
+
+	// The circuit breaker wraps the observed transport, so the requests are still observed
+	for i := 0; i < 2; i++ {
+		require.NoError(t, signer.Check(context.Background()))
+	}
+	assert.Len(t, observer.observed(), 2)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// Default limits of the CSRs that are sent to Command
+const (
+	DefaultMaxCSRSANs = 100
+	DefaultMaxCSRSize = 64 * 1024
+)
+
+// ErrCSRTooLarge is returned by Sign when the CSR exceeds the limits of the controller, e.g. because it
+// contains too many SANs. Retrying the request won't succeed.
+var ErrCSRTooLarge = errors.New("CSR exceeds the limits of the issuer")
+
+// CSRLimits limits the CSRs that are sent to Command, so that a misconfigured client can't tie up
+// Command with oversized requests
+type CSRLimits struct {
+	// MaxSANs is the maximum number of SANs of a CSR. Zero disables the limit.
+	MaxSANs int
+	// MaxSize is the maximum size of a PEM-encoded CSR in bytes. Zero disables the limit.
+	MaxSize int
+}
+
+type csrLimitsContextKey struct{}
+
+// ContextWithCSRLimits returns a copy of ctx carrying the limits that Sign enforces before the CSR is
+// sent to Command. If ctx carries no limits, DefaultMaxCSRSANs and DefaultMaxCSRSize are enforced.
+func ContextWithCSRLimits(ctx context.Context, limits CSRLimits) context.Context {
+	return context.WithValue(ctx, csrLimitsContextKey{}, limits)
+}
+
+// csrLimitsFromContext returns the CSR limits carried by ctx, or the default limits
+func csrLimitsFromContext(ctx context.Context) CSRLimits {
+	if limits, ok := ctx.Value(csrLimitsContextKey{}).(CSRLimits); ok {
+		return limits
+	}
+	return CSRLimits{MaxSANs: DefaultMaxCSRSANs, MaxSize: DefaultMaxCSRSize}
+}
+
+// checkSize returns an error if the PEM-encoded CSR is larger than allowed. The size is checked
+// before the CSR is parsed.
+func (l CSRLimits) checkSize(csrBytes []byte) error {
+	if l.MaxSize > 0 && len(csrBytes) > l.MaxSize {
+		return fmt.Errorf("%w: the CSR is %d bytes, more than the limit of %d bytes", ErrCSRTooLarge, len(csrBytes), l.MaxSize)
+	}
+	return nil
+}
+
+// checkSANs returns an error if the CSR has more SANs than allowed
+func (l CSRLimits) checkSANs(csr *x509.CertificateRequest) error {
+	count := len(csr.DNSNames) + len(csr.IPAddresses) + len(csr.URIs) + len(csr.EmailAddresses)
+	if l.MaxSANs > 0 && count > l.MaxSANs {
+		return fmt.Errorf("%w: the CSR has %d SANs, more than the limit of %d SANs", ErrCSRTooLarge, count, l.MaxSANs)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignCSRLimits(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	tests := []struct {
+		name          string
+		sans          int
+		limits        *CSRLimits
+		expectedError error
+	}{
+		{
+			name: "WithinDefaultLimits",
+			sans: DefaultMaxCSRSANs,
+		},
+		{
+			name:          "TooManySANsDefaultLimit",
+			sans:          DefaultMaxCSRSANs + 1,
+			expectedError: ErrCSRTooLarge,
+		},
+		{
+			name:          "TooManySANs",
+			sans:          3,
+			limits:        &CSRLimits{MaxSANs: 2},
+			expectedError: ErrCSRTooLarge,
+		},
+		{
+			name:          "TooLarge",
+			sans:          1,
+			limits:        &CSRLimits{MaxSize: 512},
+			expectedError: ErrCSRTooLarge,
+		},
+		{
+			name:   "LimitsDisabled",
+			sans:   DefaultMaxCSRSANs + 1,
+			limits: &CSRLimits{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			if tt.limits != nil {
+				ctx = ContextWithCSRLimits(ctx, *tt.limits)
+			}
+
+			_, _, _, err = signer.Sign(ctx, generateCSRWithDNSNames(t, tt.sans), K8sMetadata{})
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Zero(t, requests.Load(), "an oversized CSR must not be sent to Command")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), requests.Load())
+		})
+	}
+}
+
+// generateCSRWithDNSNames returns a PEM encoded CSR with the given number of DNS SANs
+func generateCSRWithDNSNames(t *testing.T, count int) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := x509.CertificateRequest{Subject: pkix.Name{CommonName: "app.example.com"}}
+	for i := 0; i < count; i++ {
+		template.DNSNames = append(template.DNSNames, fmt.Sprintf("app-%d.example.com", i))
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Request dispositions of a Command CSR enrollment that is awaiting approval
+const (
+	dispositionPending            = "PENDING"
+	dispositionExternalValidation = "EXTERNAL VALIDATION"
+)
+
+// States of a certificate request in the Command workflow
+const (
+	workflowStatePending = "PENDING"
+	workflowStateIssued  = "ISSUED"
+	workflowStateDenied  = "DENIED"
+)
+
+// certificateFormatHeader selects the format of certificates downloaded from Command
+const certificateFormatHeader = "X-CertificateFormat"
+
+// ErrEnrollmentPending is returned by Sign and PollEnrollment when the enrollment is awaiting
+// approval in Command. The returned error is an *EnrollmentPendingError.
+var ErrEnrollmentPending = errors.New("enrollment is pending approval in Command")
+
+// EnrollmentPendingError is returned by Sign and PollEnrollment when the enrollment is awaiting
+// approval in Command. Pass RequestID to PollEnrollment to get the certificate once it is issued.
+type EnrollmentPendingError struct {
+	// RequestID is the ID of the certificate request in Command
+	RequestID int32
+	// Message is the disposition message returned by Command, if any
+	Message string
+}
+
+func (e *EnrollmentPendingError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%v (request ID %d)", ErrEnrollmentPending, e.RequestID)
+	}
+	return fmt.Sprintf("%v (request ID %d): %s", ErrEnrollmentPending, e.RequestID, e.Message)
+}
+
+func (e *EnrollmentPendingError) Unwrap() error {
+	return ErrEnrollmentPending
+}
+
+// PollEnrollment returns the certificate, the CA chain, and the Command ID of the certificate of an
+// enrollment that was pending approval in Command. csrBytes and k8sMeta describe the request that
+// was enrolled.
+func (s *commandSigner) PollEnrollment(ctx context.Context, csrBytes []byte, requestID int32, k8sMeta K8sMetadata) ([]byte, []byte, int32, error) {
+	k8sLog := log.FromContext(ctx)
+
+	// The issued certificate is identified by the key of the CSR
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	release, err := EnterEnrollmentGate(ctx)
+	if err != nil {
+		k8sLog.Info(fmt.Sprintf("Not polling certificate request %d: %v", requestID, err))
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	details, httpResponse, err := s.readAPIClient().WorkflowApi.WorkflowGetCertificateRequestDetails(ctx, requestID).Execute()
+	if err != nil {
+		detail := fmt.Sprintf("failed to get certificate request %d from Command", requestID)
+
+		var bodyError *keyfactor.GenericOpenAPIError
+		if errors.As(err, &bodyError) {
+			detail += fmt.Sprintf(" - %s", string(bodyError.Body()))
+		}
+
+		k8sLog.Error(err, detail)
+
+		if isPermanentFailure(httpResponse) {
+			return nil, nil, 0, fmt.Errorf("%w (HTTP %d): %s", ErrEnrollmentRejected, httpResponse.StatusCode, detail)
+		}
+		return nil, nil, 0, fmt.Errorf("%s: %w", detail, err)
+	}
+
+	state := strings.ToUpper(details.GetStateString())
+	switch state {
+	case workflowStatePending:
+		return nil, nil, 0, &EnrollmentPendingError{RequestID: requestID}
+	case workflowStateDenied:
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrEnrollmentDenied, details.GetDenialComment())
+	case workflowStateIssued:
+	default:
+		return nil, nil, 0, fmt.Errorf("%w: certificate request %d is in state %q", ErrEnrollmentRejected, requestID, details.GetStateString())
+	}
+
+	k8sLog.Info(fmt.Sprintf("Certificate request %d was approved in Command. Downloading the certificate.", requestID))
+
+	certificates, _, err := s.readAPIClient().CertificateApi.CertificateQueryCertificates(ctx).
+		PqQueryString(fmt.Sprintf("CertRequestId -eq %d", requestID)).
+		Execute()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to find the certificate issued for certificate request %d: %w", requestID, err)
+	}
+	if len(certificates) == 0 {
+		// Command may not have recorded the certificate yet, so the request is retried
+		return nil, nil, 0, fmt.Errorf("no certificate found for certificate request %d", requestID)
+	}
+	certificateID := certificates[0].GetId()
+
+	certAndChain, err := s.downloadCertificate(ctx, certificateID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// Command doesn't guarantee the order of the downloaded chain, so the issued certificate is moved first
+	for i, certificate := range certAndChain {
+		if hasPublicKey([]*x509.Certificate{certificate}, csr.PublicKey) {
+			certAndChain[0], certAndChain[i] = certAndChain[i], certAndChain[0]
+			break
+		}
+	}
+	if !hasPublicKey(certAndChain[:1], csr.PublicKey) {
+		return nil, nil, 0, fmt.Errorf("%w: certificate %d issued for certificate request %d doesn't have the key of the CSR", ErrEnrollmentRejected, certificateID, requestID)
+	}
+
+	// The certificate template was selected by Sign when the request was enrolled
+	if k8sMeta.IsCA {
+		if err = checkIssuedCA(certAndChain[0], s.caTemplate()); err != nil {
+			k8sLog.Error(err, "Command did not issue a CA certificate")
+			return nil, nil, 0, s.rejectIssuedCertificate(ctx, certificateID, err)
+		}
+	}
+
+	leaf, chain, err := compileCertificatesToPemBytes(certAndChain)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return leaf, chain, certificateID, nil
+}
+
+// downloadCertificate downloads the certificate with the given Command ID along with its chain
+func (s *commandSigner) downloadCertificate(ctx context.Context, certificateID int32) ([]*x509.Certificate, error) {
+	// The download endpoint has no format parameter, so the format is sent as a default header of
+	// this signer's client, which is only used for a single reconcile
+	client := s.readAPIClient()
+	config := client.GetConfig()
+	config.AddDefaultHeader(certificateFormatHeader, enrollmentPEMFormat)
+	defer delete(config.DefaultHeader, certificateFormatHeader)
+
+	response, _, err := client.CertificateApi.CertificateDownloadCertificateAsync(ctx).
+		Rq(keyfactor.ModelsCertificateDownloadRequest{CertID: &certificateID, IncludeChain: ptr(true)}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download certificate %d from Command: %w", certificateID, err)
+	}
+
+	pemBytes, err := base64.StdEncoding.DecodeString(response.GetContent())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode certificate %d downloaded from Command: %w", certificateID, err)
+	}
+
+	blocks, _ := decodePEMBytes(pemBytes)
+	var certificates []*x509.Certificate
+	for _, block := range blocks {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d downloaded from Command: %w", certificateID, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("Command did not return certificate %d", certificateID)
+	}
+
+	return certificates, nil
+}
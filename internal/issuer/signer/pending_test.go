@@ -0,0 +1,243 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeCommandRequestID = 42
+
+func TestSignPendingEnrollment(t *testing.T) {
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"CertificateInformation": map[string]interface{}{
+				"RequestDisposition": "EXTERNAL VALIDATION",
+				"DispositionMessage": "The request requires manager approval",
+				"KeyfactorRequestId": fakeCommandRequestID,
+			},
+		})
+	}))
+	defer server.Close()
+
+	signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+	require.NoError(t, err)
+
+	_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+
+	var pendingErr *EnrollmentPendingError
+	if assert.True(t, errors.As(err, &pendingErr), "expected an EnrollmentPendingError, got %v", err) {
+		assert.Equal(t, int32(fakeCommandRequestID), pendingErr.RequestID)
+		assert.Equal(t, "The request requires manager approval", pendingErr.Message)
+	}
+	assert.ErrorIs(t, err, ErrEnrollmentPending)
+}
+
+func TestPollEnrollment(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "example.com"}}, key)
+	require.NoError(t, err)
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	leaf := generateCertificateWithKey(t, key)
+	ca, err := generateSelfSignedCertificate()
+	require.NoError(t, err)
+	otherLeaf, err := generateSelfSignedCertificate()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		state         string
+		issued        *x509.Certificate
+		omitContent   bool
+		expectedError error
+	}{
+		{
+			name:   "Issued",
+			state:  "Issued",
+			issued: leaf,
+		},
+		{
+			// The issued certificate is found by the key of the CSR if the query doesn't return its content
+			name:        "IssuedWithoutContent",
+			state:       "Issued",
+			issued:      leaf,
+			omitContent: true,
+		},
+		{
+			name:          "IssuedWithAnotherKey",
+			state:         "Issued",
+			issued:        otherLeaf,
+			expectedError: ErrEnrollmentRejected,
+		},
+		{
+			name:          "Pending",
+			state:         "Pending",
+			expectedError: ErrEnrollmentPending,
+		},
+		{
+			name:          "Denied",
+			state:         "Denied",
+			expectedError: ErrEnrollmentDenied,
+		},
+		{
+			name:          "Failed",
+			state:         "Failed",
+			expectedError: ErrEnrollmentRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The chain is downloaded with the CA first to verify that the issued certificate is moved first
+			chainPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+			if tt.issued != nil {
+				chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tt.issued.Raw})...)
+			}
+
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				var response interface{}
+				switch r.URL.Path {
+				case "/KeyfactorAPI/Workflow/Certificates/42":
+					response = map[string]interface{}{
+						"Id":            fakeCommandRequestID,
+						"StateString":   tt.state,
+						"DenialComment": "simulated denial",
+					}
+				case "/KeyfactorAPI/Certificates":
+					assert.Equal(t, "CertRequestId -eq 42", r.URL.Query().Get("pq.queryString"))
+					certificate := map[string]interface{}{"Id": fakeCommandCertificateID}
+					if tt.issued != nil && !tt.omitContent {
+						certificate["ContentBytes"] = base64.StdEncoding.EncodeToString(tt.issued.Raw)
+					}
+					response = []map[string]interface{}{certificate}
+				case "/KeyfactorAPI/Certificates/Download":
+					assert.Equal(t, enrollmentPEMFormat, r.Header.Get(certificateFormatHeader))
+					response = map[string]interface{}{
+						"Content": base64.StdEncoding.EncodeToString(chainPEM),
+					}
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(response)
+			}))
+			defer server.Close()
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+			require.NoError(t, err)
+
+			leafPEM, caPEM, certificateID, err := signer.PollEnrollment(context.Background(), csr, fakeCommandRequestID, K8sMetadata{})
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int32(fakeCommandCertificateID), certificateID)
+			assert.Equal(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}), leafPEM)
+			assert.Equal(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), caPEM)
+			_, ok := signer.client.GetConfig().DefaultHeader[certificateFormatHeader]
+			assert.False(t, ok, "the certificate format header must only be sent when downloading the certificate")
+		})
+	}
+}
+
+func TestPollEnrollmentReadCredentials(t *testing.T) {
+	var mu sync.Mutex
+	usernames := make(map[string]string)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _, _ := r.BasicAuth()
+		mu.Lock()
+		usernames[r.URL.Path] = username
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/KeyfactorAPI/Enrollment/CSR" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"CertificateInformation": map[string]interface{}{
+					"RequestDisposition": "PENDING",
+					"KeyfactorRequestId": fakeCommandRequestID,
+				},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":          fakeCommandRequestID,
+			"StateString": "Pending",
+		})
+	}))
+	defer server.Close()
+
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+	readSecretData := map[string][]byte{
+		"username": []byte("reader"),
+		"password": []byte("password"),
+	}
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+	require.NoError(t, err)
+
+	_, _, _, err = signer.Sign(ctx, csr, K8sMetadata{})
+	assert.ErrorIs(t, err, ErrEnrollmentPending)
+	_, _, _, err = signer.PollEnrollment(ctx, csr, fakeCommandRequestID, K8sMetadata{})
+	assert.ErrorIs(t, err, ErrEnrollmentPending)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]string{
+		"/KeyfactorAPI/Enrollment/CSR":           string(authSecretData["username"]),
+		"/KeyfactorAPI/Workflow/Certificates/42": "reader",
+	}, usernames)
+}
+
+func TestPollEnrollmentRejectsMalformedCSR(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+	require.NoError(t, err)
+
+	_, _, _, err = signer.PollEnrollment(context.Background(), []byte("not a CSR"), fakeCommandRequestID, K8sMetadata{})
+	assert.ErrorIs(t, err, ErrCSRMalformed)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+// ErrCertificatePolicyMissing is returned by CheckCertificatePolicy when the issued certificate
+// doesn't assert the certificate policy required by the issuer
+var ErrCertificatePolicyMissing = errors.New("issued certificate does not contain the required certificate policy")
+
+// validateRequiredCertificatePolicy verifies the RequiredCertificatePolicy of an issuer
+func validateRequiredCertificatePolicy(policy *commandissuer.RequiredCertificatePolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if !commandissuer.IsObjectIdentifier(policy.OID) {
+		return fmt.Errorf("%w: requiredCertificatePolicy has an invalid OID %q", ErrInvalidConfig, policy.OID)
+	}
+	if commandissuer.IsReservedEnrollmentParameter(policy.EnrollmentParameter) {
+		return fmt.Errorf("%w: enrollment parameter %q is managed by the issuer and can't select the certificate policy", ErrInvalidConfig, policy.EnrollmentParameter)
+	}
+	return nil
+}
+
+// CheckCertificatePolicy verifies that the certificate policies extension of the PEM-encoded
+// certificate issued by Command contains the OID in dotted notation. If it doesn't, the returned
+// error wraps ErrCertificatePolicyMissing and lists the policies of the certificate.
+func CheckCertificatePolicy(certificateBytes []byte, oid string) error {
+	certificate, err := parseCertificatePEM(certificateBytes)
+	if err != nil {
+		return err
+	}
+
+	policies := make([]string, 0, len(certificate.PolicyIdentifiers))
+	for _, identifier := range certificate.PolicyIdentifiers {
+		if identifier.String() == oid {
+			return nil
+		}
+		policies = append(policies, identifier.String())
+	}
+
+	if len(policies) == 0 {
+		return fmt.Errorf("%w %s: the certificate has no certificate policies. Verify that the certificate template asserts the policy.", ErrCertificatePolicyMissing, oid)
+	}
+	return fmt.Errorf("%w %s: the certificate only asserts %s. Verify that the certificate template asserts the policy.", ErrCertificatePolicyMissing, oid, strings.Join(policies, ", "))
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oidPolicyOVTLS = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}
+	oidPolicyDVTLS = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+)
+
+func TestCheckCertificatePolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policies      []asn1.ObjectIdentifier
+		oid           string
+		expectedError error
+	}{
+		{
+			name:     "Asserted",
+			policies: []asn1.ObjectIdentifier{oidPolicyOVTLS},
+			oid:      "2.23.140.1.2.2",
+		},
+		{
+			name:     "AssertedAmongOthers",
+			policies: []asn1.ObjectIdentifier{oidPolicyDVTLS, oidPolicyOVTLS},
+			oid:      "2.23.140.1.2.2",
+		},
+		{
+			name:          "OtherPolicy",
+			policies:      []asn1.ObjectIdentifier{oidPolicyDVTLS},
+			oid:           "2.23.140.1.2.2",
+			expectedError: ErrCertificatePolicyMissing,
+		},
+		{
+			name:          "NoPolicies",
+			oid:           "2.23.140.1.2.2",
+			expectedError: ErrCertificatePolicyMissing,
+		},
+		{
+			name:          "PrefixIsNotAsserted",
+			policies:      []asn1.ObjectIdentifier{oidPolicyOVTLS},
+			oid:           "2.23.140.1.2",
+			expectedError: ErrCertificatePolicyMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCertificatePolicy(generateCertificateWithPolicies(t, tt.policies), tt.oid)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	err := CheckCertificatePolicy([]byte("not a certificate"), "2.23.140.1.2.2")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCertificatePolicyMissing)
+}
+
+func TestSignRequiredCertificatePolicyParameter(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	tests := []struct {
+		name          string
+		policy        *commandissuer.RequiredCertificatePolicy
+		expectedValue interface{}
+	}{
+		{
+			name: "NoPolicy",
+		},
+		{
+			name:   "NoParameter",
+			policy: &commandissuer.RequiredCertificatePolicy{OID: "2.23.140.1.2.2"},
+		},
+		{
+			name:          "Parameter",
+			policy:        &commandissuer.RequiredCertificatePolicy{OID: "2.23.140.1.2.2", EnrollmentParameter: "CertificatePolicy"},
+			expectedValue: "2.23.140.1.2.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.RequiredCertificatePolicy = tt.policy
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), generateCSRWithExtendedKeyUsages(t, nil), K8sMetadata{})
+			require.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.expectedValue, requests[0]["CertificatePolicy"])
+		})
+	}
+}
+
+func TestRequiredCertificatePolicyBuilder(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *commandissuer.RequiredCertificatePolicy
+	}{
+		{
+			name:   "MissingOID",
+			policy: &commandissuer.RequiredCertificatePolicy{},
+		},
+		{
+			name:   "InvalidOID",
+			policy: &commandissuer.RequiredCertificatePolicy{OID: "ov-tls"},
+		},
+		{
+			name:   "ReservedParameter",
+			policy: &commandissuer.RequiredCertificatePolicy{OID: "2.23.140.1.2.2", EnrollmentParameter: "Template"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, validateRequiredCertificatePolicy(tt.policy), ErrInvalidConfig)
+		})
+	}
+}
+
+// generateCertificateWithPolicies returns a PEM encoded self-signed certificate that asserts the
+// certificate policies
+func generateCertificateWithPolicies(t *testing.T, policies []asn1.ObjectIdentifier) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:      big.NewInt(1),
+		Subject:           pkix.Name{CommonName: "example.com"},
+		NotBefore:         time.Now(),
+		NotAfter:          time.Now().Add(time.Hour),
+		PolicyIdentifiers: policies,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
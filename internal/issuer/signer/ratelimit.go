@@ -0,0 +1,59 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned by Command clients when a request can't be sent within the rate limit
+// before its context expires
+var ErrRateLimited = errors.New("the rate limit of requests to Command was exceeded")
+
+// rateLimitTransport delays the requests of a Command client to stay within the rate limit shared by
+// all clients. It wraps the failover between hosts, so that a request counts once however many hosts
+// are tried.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRateLimited, err)
+	}
+	return t.base.RoundTrip(req)
+}
+
+type rateLimiterContextKey struct{}
+
+// ContextWithRateLimiter returns a copy of ctx carrying the rate limiter of the requests of the Command
+// clients created with it. If ctx carries no rate limiter, requests to Command aren't rate limited.
+func ContextWithRateLimiter(ctx context.Context, limiter *rate.Limiter) context.Context {
+	return context.WithValue(ctx, rateLimiterContextKey{}, limiter)
+}
+
+// rateLimiterFromContext returns the rate limiter carried by ctx, or nil
+func rateLimiterFromContext(ctx context.Context) *rate.Limiter {
+	limiter, _ := ctx.Value(rateLimiterContextKey{}).(*rate.Limiter)
+	return limiter
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	limiter := rate.NewLimiter(rate.Every(time.Minute), 1)
+
+	ctx, spec, annotations, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server)
+	ctx = ContextWithRateLimiter(ctx, limiter)
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+	require.NoError(t, err)
+
+	// The burst is sent at once
+	checkCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, signer.Check(checkCtx))
+	assert.Equal(t, int32(1), requests.Load())
+
+	// A request that can't be sent within the limit before its context expires isn't sent
+	assert.Error(t, signer.Check(checkCtx))
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Raising the limit, e.g. when another replica stops, applies to the existing clients
+	limiter.SetLimit(rate.Inf)
+	assert.NoError(t, signer.Check(checkCtx))
+	assert.Equal(t, int32(2), requests.Load())
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	keyfactor "github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// errRenewalKeyChanged is returned by renewSameKey when the CSR doesn't reuse the key of the
+// certificate it renews, so the certificate can't be renewed with its key
+var errRenewalKeyChanged = errors.New("CSR does not reuse the key of the renewed certificate")
+
+// renewSameKey renews the certificate with the Command ID RenewalCertificateID using the renewal flow of
+// Command, which reissues the certificate with its key and applies the renewal policy of the
+// certificate template. It returns the certificate, the CA chain, and the Command ID of the
+// renewed certificate.
+func (s *commandSigner) renewSameKey(ctx context.Context, csr *x509.CertificateRequest, k8sMeta K8sMetadata) ([]byte, []byte, int32, error) {
+	k8sLog := log.FromContext(ctx)
+	certificateID := k8sMeta.RenewalCertificateID
+
+	// The renewed certificate is only usable if the requester still holds its key
+	previous, err := s.downloadCertificate(ctx, certificateID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if !hasPublicKey(previous, csr.PublicKey) {
+		return nil, nil, 0, fmt.Errorf("%w (Command ID %d)", errRenewalKeyChanged, certificateID)
+	}
+
+	k8sLog.Info(fmt.Sprintf("Renewing certificate with Command ID %d with its key", certificateID))
+	if s.changeReference != nil && s.changeReference.value != "" {
+		// The renewal API of Command doesn't accept metadata, so the renewed certificate keeps the
+		// metadata of the previous certificate
+		k8sLog.Info(fmt.Sprintf("Change reference %q is not recorded on renewals with the same key", s.changeReference.value))
+	}
+
+	modelRequest := keyfactor.ModelsEnrollmentRenewalRequest{
+		CertificateId:        &certificateID,
+		CertificateAuthority: ptr(formatCertificateAuthority(s.certificateAuthorityHostname, s.certificateAuthorityLogicalName)),
+		Template:             &s.certificateTemplate,
+		Timestamp:            ptr(time.Now()),
+	}
+
+	release, err := EnterEnrollmentGate(ctx)
+	if err != nil {
+		k8sLog.Info(fmt.Sprintf("Not renewing: %v", err))
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	response, httpResponse, err := s.client.EnrollmentApi.EnrollmentRenew(ctx).Request(modelRequest).Execute()
+	if err != nil {
+		var circuitErr *CircuitOpenError
+		if errors.As(err, &circuitErr) {
+			return nil, nil, 0, circuitErr
+		}
+
+		detail := fmt.Sprintf("error renewing certificate %d with Command. Verify that the certificate template %q supports renewal.", certificateID, s.certificateTemplate)
+
+		var bodyError *keyfactor.GenericOpenAPIError
+		if errors.As(err, &bodyError) {
+			detail += fmt.Sprintf(" - %s", string(bodyError.Body()))
+		}
+
+		k8sLog.Error(err, detail)
+
+		if isPermanentFailure(httpResponse) {
+			return nil, nil, 0, fmt.Errorf("%w (HTTP %d): %s", ErrEnrollmentRejected, httpResponse.StatusCode, detail)
+		}
+		return nil, nil, 0, fmt.Errorf("%s: %w", detail, err)
+	}
+
+	// The renewal response has the same disposition as a CSR enrollment response
+	err = checkRequestDisposition(&keyfactor.ModelsPkcs10CertificateResponse{
+		KeyfactorRequestId: response.KeyfactorRequestId,
+		RequestDisposition: response.RequestDisposition,
+		DispositionMessage: response.DispositionMessage,
+	})
+	if err != nil {
+		if errors.Is(err, ErrEnrollmentPending) {
+			k8sLog.Info(fmt.Sprintf("Command did not renew the certificate yet: %v", err))
+			return nil, nil, 0, err
+		}
+		k8sLog.Error(err, "Command did not renew the certificate")
+		return nil, nil, 0, err
+	}
+
+	renewedID := response.GetKeyfactorId()
+	certAndChain, err := s.downloadCertificate(ctx, renewedID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// Command doesn't guarantee the order of the downloaded chain, so the renewed certificate is moved first
+	for i, certificate := range certAndChain {
+		if hasPublicKey([]*x509.Certificate{certificate}, csr.PublicKey) {
+			certAndChain[0], certAndChain[i] = certAndChain[i], certAndChain[0]
+			break
+		}
+	}
+	if !hasPublicKey(certAndChain[:1], csr.PublicKey) {
+		return nil, nil, 0, fmt.Errorf("%w: renewed certificate %d doesn't have the key of the CSR", ErrEnrollmentRejected, renewedID)
+	}
+
+	if k8sMeta.IsCA {
+		if err = checkIssuedCA(certAndChain[0], s.certificateTemplate); err != nil {
+			k8sLog.Error(err, "Command did not renew the certificate as a CA certificate")
+			return nil, nil, 0, s.rejectIssuedCertificate(ctx, renewedID, err)
+		}
+	}
+
+	k8sLog.Info(fmt.Sprintf("Successfully renewed certificate with Command with subject %q. Renewed certificate has Command ID %d", certAndChain[0].Subject, renewedID))
+
+	leaf, chain, err := compileCertificatesToPemBytes(certAndChain)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return leaf, chain, renewedID, nil
+}
+
+// hasPublicKey returns true if any of the certificates has the public key
+func hasPublicKey(certificates []*x509.Certificate, publicKey crypto.PublicKey) bool {
+	for _, certificate := range certificates {
+		key, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if ok && key.Equal(publicKey) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeRenewedCertificateID = 5678
+
+func TestSignSameKeyRenewal(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	previous := generateCertificateWithKey(t, key)
+	renewed := generateCertificateWithKey(t, key)
+	ca, err := generateSelfSignedCertificate()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                  string
+		csrKey                *rsa.PrivateKey
+		disposition           string
+		expectedEndpoint      string
+		expectedCertificateID int32
+		expectedError         error
+	}{
+		{
+			name:                  "SameKey",
+			csrKey:                key,
+			expectedEndpoint:      "/KeyfactorAPI/Enrollment/Renew",
+			expectedCertificateID: fakeRenewedCertificateID,
+		},
+		{
+			name:             "Pending",
+			csrKey:           key,
+			disposition:      "EXTERNAL VALIDATION",
+			expectedEndpoint: "/KeyfactorAPI/Enrollment/Renew",
+			expectedError:    ErrEnrollmentPending,
+		},
+		{
+			name:             "Denied",
+			csrKey:           key,
+			disposition:      "DENIED",
+			expectedEndpoint: "/KeyfactorAPI/Enrollment/Renew",
+			expectedError:    ErrEnrollmentDenied,
+		},
+		{
+			// cert-manager rotated the key, so the CSR is enrolled as a renewal with a new key
+			name:                  "KeyChanged",
+			expectedEndpoint:      "/KeyfactorAPI/Enrollment/CSR",
+			expectedCertificateID: fakeCommandCertificateID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csrKey := tt.csrKey
+			if csrKey == nil {
+				csrKey, err = rsa.GenerateKey(rand.Reader, 2048)
+				require.NoError(t, err)
+			}
+			csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com"}}, csrKey)
+			require.NoError(t, err)
+			csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+			var endpoint string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				var response interface{}
+				switch r.URL.Path {
+				case "/KeyfactorAPI/Certificates/Download":
+					var request map[string]interface{}
+					_ = json.NewDecoder(r.Body).Decode(&request)
+					certificate := previous
+					if request["CertID"] == float64(fakeRenewedCertificateID) {
+						certificate = renewed
+					}
+					// The chain is downloaded with the CA first to verify that the renewed certificate is moved first
+					chainPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+					response = map[string]interface{}{"Content": base64.StdEncoding.EncodeToString(chainPEM)}
+				case "/KeyfactorAPI/Enrollment/Renew":
+					endpoint = r.URL.Path
+					var request map[string]interface{}
+					_ = json.NewDecoder(r.Body).Decode(&request)
+					assert.Equal(t, float64(fakeCommandCertificateID), request["CertificateId"])
+					response = map[string]interface{}{
+						"KeyfactorId":        fakeRenewedCertificateID,
+						"KeyfactorRequestId": fakeCommandRequestID,
+						"RequestDisposition": tt.disposition,
+					}
+				case "/KeyfactorAPI/Enrollment/CSR":
+					endpoint = r.URL.Path
+					var request map[string]interface{}
+					_ = json.NewDecoder(r.Body).Decode(&request)
+					assert.Equal(t, float64(fakeCommandCertificateID), request[renewalCertificateIDProperty])
+					_, _ = w.Write(fakeEnrollmentResponse(t))
+					return
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(response)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.EnableRenewal = true
+			spec.RenewalMode = commandissuer.RenewalModeSameKey
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+			require.NoError(t, err)
+
+			leafPEM, _, certificateID, err := signer.Sign(context.Background(), csr, K8sMetadata{RenewalCertificateID: fakeCommandCertificateID})
+			assert.Equal(t, tt.expectedEndpoint, endpoint)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCertificateID, certificateID)
+			if tt.csrKey != nil {
+				assert.Equal(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: renewed.Raw}), leafPEM)
+			}
+		})
+	}
+}
+
+// generateCertificateWithKey returns a self-signed certificate for the key
+func generateCertificateWithKey(t *testing.T, key *rsa.PrivateKey) *x509.Certificate {
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+// DefaultRequestIDHeader is the HTTP header used to send the request ID to Command
+const DefaultRequestIDHeader = "X-Request-ID"
+
+type requestIDContextKey struct{}
+
+type requestID struct {
+	header string
+	value  string
+}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID that Command clients created from
+// the context send in the given HTTP header on every call. A request ID already carried by ctx is kept,
+// otherwise the controller-runtime reconcile ID is used so that the ID matches the reconcileID in the
+// controller logs. If neither is present, a new ID is generated.
+func ContextWithRequestID(ctx context.Context, header string) (context.Context, string) {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return ctx, id
+	}
+
+	id := string(controller.ReconcileIDFromContext(ctx))
+	if id == "" {
+		id = string(uuid.NewUUID())
+	}
+
+	return context.WithValue(ctx, requestIDContextKey{}, requestID{header: header, value: id}), id
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(requestID)
+	return id.value, ok
+}
+
+// requestIDHeaderFromContext returns the header name and value of the request ID carried by ctx, if any
+func requestIDHeaderFromContext(ctx context.Context) (string, string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(requestID)
+	return id.header, id.value, ok
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+)
+
+// enrollmentRequestTemplateData is the data that the enrollment request template of an issuer is
+// rendered with
+type enrollmentRequestTemplateData struct {
+	// CSR is the CSR in the enrollment format of the issuer
+	CSR string
+	// Subject is the subject of the CSR as an RFC 2253 distinguished name
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	IPAddresses    []string
+	URIs           []string
+	EmailAddresses []string
+	// SANs are the SANs of the built-in request keyed by type, including the additional SANs of
+	// the issuer
+	SANs map[string][]string
+	// Template is the certificate template, after the overrides of the request annotations
+	Template string
+	// CertificateAuthority is the certificate authority, after the overrides of the request
+	// annotations
+	CertificateAuthority string
+	// Metadata are the Command metadata fields of the built-in request
+	Metadata map[string]interface{}
+	// EnrollmentParameters are the additional properties of the built-in request, e.g. the
+	// enrollment parameters of the issuer and the requested lifetime
+	EnrollmentParameters map[string]interface{}
+	// Timestamp is the time of the request in RFC 3339 format
+	Timestamp string
+	// Request is the built-in request
+	Request map[string]interface{}
+}
+
+// enrollmentRequestFields decodes the properties of an enrollment request that the SDK knows by
+// their types, without the lenient decoding of keyfactor.ModelsEnrollmentCSREnrollmentRequest
+type enrollmentRequestFields keyfactor.ModelsEnrollmentCSREnrollmentRequest
+
+// renderEnrollmentRequest renders the enrollment request template of the issuer with the built-in
+// request and returns the request it describes. The rendered body must be a JSON object containing
+// the CSR whose known properties have the types Command expects. Otherwise, the error wraps
+// ErrInvalidConfig since the template of the issuer must be fixed.
+func (s *commandSigner) renderEnrollmentRequest(modelRequest keyfactor.ModelsEnrollmentCSREnrollmentRequest, csr *x509.CertificateRequest) (keyfactor.ModelsEnrollmentCSREnrollmentRequest, error) {
+	request, err := modelRequest.ToMap()
+	if err != nil {
+		return modelRequest, fmt.Errorf("failed to encode the enrollment request: %w", err)
+	}
+
+	data := enrollmentRequestTemplateData{
+		CSR:                  modelRequest.CSR,
+		Subject:              csr.Subject.String(),
+		CommonName:           csr.Subject.CommonName,
+		DNSNames:             csr.DNSNames,
+		EmailAddresses:       csr.EmailAddresses,
+		SANs:                 modelRequest.GetSANs(),
+		Template:             modelRequest.GetTemplate(),
+		CertificateAuthority: modelRequest.GetCertificateAuthority(),
+		Metadata:             modelRequest.Metadata,
+		EnrollmentParameters: modelRequest.AdditionalProperties,
+		Timestamp:            modelRequest.GetTimestamp().Format(time.RFC3339),
+		Request:              request,
+	}
+	for _, ip := range csr.IPAddresses {
+		data.IPAddresses = append(data.IPAddresses, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		data.URIs = append(data.URIs, uri.String())
+	}
+
+	var body bytes.Buffer
+	if err = s.enrollmentRequestTemplate.Execute(&body, data); err != nil {
+		return modelRequest, fmt.Errorf("%w: failed to render the enrollment request template: %w", ErrInvalidConfig, err)
+	}
+
+	var fields enrollmentRequestFields
+	if err = json.Unmarshal(body.Bytes(), &fields); err != nil {
+		return modelRequest, fmt.Errorf("%w: the enrollment request template rendered an invalid request: %w", ErrInvalidConfig, err)
+	}
+	if fields.CSR == "" {
+		return modelRequest, fmt.Errorf("%w: the enrollment request template rendered a request without the CSR", ErrInvalidConfig)
+	}
+
+	var rendered keyfactor.ModelsEnrollmentCSREnrollmentRequest
+	if err = rendered.UnmarshalJSON(body.Bytes()); err != nil {
+		return modelRequest, fmt.Errorf("%w: the enrollment request template rendered an invalid request: %w", ErrInvalidConfig, err)
+	}
+	return rendered, nil
+}
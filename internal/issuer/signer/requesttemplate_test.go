@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignEnrollmentRequestTemplate(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		template        string
+		expectedRequest map[string]interface{}
+		expectedError   error
+	}{
+		{
+			name: "CustomShape",
+			template: `{
+  "CSR": {{ json .CSR }},
+  "Template": {{ json .Template }},
+  "CertificateAuthority": {{ json .CertificateAuthority }},
+  "IncludeChain": true,
+  "Metadata": {"Requester": {{ json .CommonName }}, "Issuer": {{ json (index .Metadata "Issuer-Name") }}},
+  "Subject": {{ json .Subject }},
+  "Format": "PEM"
+}`,
+			expectedRequest: map[string]interface{}{
+				"CSR":                  string(csr),
+				"Template":             "template",
+				"CertificateAuthority": "ca",
+				"IncludeChain":         true,
+				"Metadata":             map[string]interface{}{"Requester": "example.com", "Issuer": "issuer1"},
+				"Subject":              "CN=example.com",
+				"Format":               "PEM",
+			},
+		},
+		{
+			name:     "BuiltInRequest",
+			template: `{{ json .Request }}`,
+		},
+		{
+			name:          "InvalidJSON",
+			template:      `{"CSR": {{ .CSR }}}`,
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			name:          "WrongPropertyType",
+			template:      `{"CSR": {{ json .CSR }}, "SANs": ["example.com"]}`,
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			name:          "MissingCSR",
+			template:      `{"Template": {{ json .Template }}}`,
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			name:          "UnknownVariable",
+			template:      `{"CSR": {{ json .CSR }}, "Owner": {{ json .Owner }}}`,
+			expectedError: ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.EnrollmentRequestTemplate = tt.template
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{IssuerName: "issuer1"})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Empty(t, requests, "an invalid request must not be sent to Command")
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, requests, 1)
+			if tt.expectedRequest != nil {
+				assert.Equal(t, tt.expectedRequest, requests[0])
+			} else {
+				assert.Equal(t, string(csr), requests[0]["CSR"])
+				assert.Equal(t, "template", requests[0]["Template"])
+			}
+		})
+	}
+}
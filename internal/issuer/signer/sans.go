@@ -0,0 +1,357 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+)
+
+// Keys of the SANs map in a Command enrollment request
+const (
+	commandSANDNS               = "dns"
+	commandSANIPv4              = "ip4"
+	commandSANIPv6              = "ip6"
+	commandSANURI               = "uri"
+	commandSANEmail             = "rfc822"
+	commandSANUserPrincipalName = "ms_ntprincipalname"
+)
+
+// generalNameTagOtherName is the context-specific tag of an otherName GeneralName
+const generalNameTagOtherName = 0
+
+var (
+	oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidUserPrincipalName       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// ErrSANTypeNotAllowed is returned by Sign when the CSR contains a SAN type that the issuer
+// doesn't allow. Retrying the request won't succeed.
+var ErrSANTypeNotAllowed = errors.New("CSR contains a SAN type that is not allowed by the issuer")
+
+// otherName is the ASN.1 structure of an otherName GeneralName (RFC 5280 section 4.2.1.6). Value
+// holds the explicit [0] wrapper, so Value.Bytes is the encoded value.
+type otherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue
+}
+
+// subjectAltNames returns the SANs of the CSR keyed by the SAN type names that Command expects
+// in an enrollment request, along with the SANType of each key. Duplicate SANs are only returned
+// once, since certificate templates handle them inconsistently. DNS names, email addresses, and
+// user principal names are compared case-insensitively.
+func subjectAltNames(csr *x509.CertificateRequest) (map[string][]string, map[string]commandissuer.SANType, error) {
+	sans := make(map[string][]string)
+	types := make(map[string]commandissuer.SANType)
+	add := func(key string, sanType commandissuer.SANType, value string) {
+		if containsSAN(sans[key], key, value) {
+			return
+		}
+		sans[key] = append(sans[key], value)
+		types[key] = sanType
+	}
+
+	for _, dnsName := range csr.DNSNames {
+		add(commandSANDNS, commandissuer.SANTypeDNS, dnsName)
+	}
+	for _, ip := range csr.IPAddresses {
+		if ip.To4() != nil {
+			add(commandSANIPv4, commandissuer.SANTypeIP, ip.String())
+		} else {
+			add(commandSANIPv6, commandissuer.SANTypeIP, ip.String())
+		}
+	}
+	for _, uri := range csr.URIs {
+		add(commandSANURI, commandissuer.SANTypeURI, uri.String())
+	}
+	for _, email := range csr.EmailAddresses {
+		add(commandSANEmail, commandissuer.SANTypeEmail, email)
+	}
+
+	otherNames, err := parseOtherNames(csr)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range otherNames {
+		if !name.TypeID.Equal(oidUserPrincipalName) {
+			return nil, nil, fmt.Errorf("%w: otherName SANs of type %s are not supported by Command", ErrSANTypeNotAllowed, name.TypeID)
+		}
+
+		var upn string
+		if _, err := asn1.UnmarshalWithParams(name.Value.Bytes, &upn, "utf8"); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse user principal name SAN: %w", err)
+		}
+		add(commandSANUserPrincipalName, commandissuer.SANTypeOtherName, upn)
+	}
+
+	return sans, types, nil
+}
+
+// containsSAN returns true if the SANs of type key contain value
+func containsSAN(sans []string, key, value string) bool {
+	for _, existing := range sans {
+		switch key {
+		case commandSANDNS, commandSANEmail, commandSANUserPrincipalName:
+			if strings.EqualFold(existing, value) {
+				return true
+			}
+		default:
+			if existing == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addCommonNameSAN adds the Common Name of a CSR to its SANs returned by subjectAltNames, as a DNS
+// SAN if it is a DNS name or as an IP SAN if it is an IP address, and returns true if it was added.
+// Common Names that the SANs already contain or that are neither aren't added.
+func addCommonNameSAN(sans map[string][]string, types map[string]commandissuer.SANType, commonName string) bool {
+	key, sanType, value := commandSANDNS, commandissuer.SANTypeDNS, commonName
+	if ip := net.ParseIP(commonName); ip != nil {
+		key, sanType, value = commandSANIPv4, commandissuer.SANTypeIP, ip.String()
+		if ip.To4() == nil {
+			key = commandSANIPv6
+		}
+	} else if !isDNSName(commonName) {
+		return false
+	}
+
+	if containsSAN(sans[key], key, value) {
+		return false
+	}
+	sans[key] = append(sans[key], value)
+	types[key] = sanType
+	return true
+}
+
+// addAdditionalSANs adds the additional SANs of the issuer to the SANs of a CSR returned by
+// subjectAltNames. SANs that the CSR already contains aren't added again.
+func addAdditionalSANs(sans map[string][]string, types map[string]commandissuer.SANType, additional *commandissuer.AdditionalSANs) {
+	if additional == nil {
+		return
+	}
+
+	add := func(key string, sanType commandissuer.SANType, value string, equal func(string, string) bool) {
+		for _, existing := range sans[key] {
+			if equal(existing, value) {
+				return
+			}
+		}
+		sans[key] = append(sans[key], value)
+		types[key] = sanType
+	}
+	identical := func(a, b string) bool { return a == b }
+
+	for _, dnsName := range additional.DNSNames {
+		add(commandSANDNS, commandissuer.SANTypeDNS, dnsName, strings.EqualFold)
+	}
+	for _, value := range additional.IPAddresses {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			add(commandSANIPv4, commandissuer.SANTypeIP, ip.String(), identical)
+		} else {
+			add(commandSANIPv6, commandissuer.SANTypeIP, ip.String(), identical)
+		}
+	}
+	for _, uri := range additional.URIs {
+		add(commandSANURI, commandissuer.SANTypeURI, uri, identical)
+	}
+	for _, email := range additional.EmailAddresses {
+		add(commandSANEmail, commandissuer.SANTypeEmail, email, strings.EqualFold)
+	}
+}
+
+// parseOtherNames returns the otherName SANs of the CSR, which are not parsed by crypto/x509
+func parseOtherNames(csr *x509.CertificateRequest) ([]otherName, error) {
+	var names []otherName
+
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+
+		var seq asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &seq); err != nil {
+			return nil, fmt.Errorf("failed to parse SAN extension: %w", err)
+		} else if len(rest) != 0 || !seq.IsCompound || seq.Tag != asn1.TagSequence || seq.Class != asn1.ClassUniversal {
+			return nil, errors.New("failed to parse SAN extension: invalid sequence")
+		}
+
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var generalName asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &generalName); err != nil {
+				return nil, fmt.Errorf("failed to parse SAN extension: %w", err)
+			}
+			if generalName.Class != asn1.ClassContextSpecific || generalName.Tag != generalNameTagOtherName {
+				continue
+			}
+
+			var name otherName
+			if _, err := asn1.UnmarshalWithParams(generalName.FullBytes, &name, "tag:0"); err != nil {
+				return nil, fmt.Errorf("failed to parse otherName SAN: %w", err)
+			}
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// checkAllowedSANTypes verifies that the issuer allows every SAN type found in the CSR. If the
+// issuer doesn't restrict the SAN types, every SAN type is allowed.
+func (s *commandSigner) checkAllowedSANTypes(types map[string]commandissuer.SANType) error {
+	if len(s.allowedSANTypes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(types))
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !s.allowedSANTypes[types[key]] {
+			return fmt.Errorf("%w: %s SANs are not allowed", ErrSANTypeNotAllowed, types[key])
+		}
+	}
+
+	return nil
+}
+
+// ErrIssuedSANMismatch is returned by CompareIssuedNames when the issued certificate doesn't contain
+// the Common Name and SANs requested by the CSR
+var ErrIssuedSANMismatch = errors.New("issued certificate does not match the names requested by the CSR")
+
+// CompareIssuedNames compares the Common Name and SANs of the PEM-encoded certificate issued by Command
+// with those requested by the PEM-encoded CSR, the additional SANs of the issuer, if any, and the
+// Common Name if the issuer includes it in the SANs, since certificate templates may remove or rewrite
+// them. If they differ, the returned error wraps ErrIssuedSANMismatch and describes the differences.
+func CompareIssuedNames(csrBytes, certificateBytes []byte, spec *commandissuer.IssuerSpec) error {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse CSR: %w", err)
+	}
+
+	certificate, err := parseCertificatePEM(certificateBytes)
+	if err != nil {
+		return err
+	}
+
+	var differences []string
+	if csr.Subject.CommonName != "" && csr.Subject.CommonName != certificate.Subject.CommonName {
+		differences = append(differences, fmt.Sprintf("Common Name %q was issued as %q", csr.Subject.CommonName, certificate.Subject.CommonName))
+	}
+
+	compare := func(sanType string, requested, issued []string, normalize func(string) string) {
+		issuedSet := make(map[string]bool)
+		for _, name := range issued {
+			issuedSet[normalize(name)] = true
+		}
+		requestedSet := make(map[string]bool)
+		var missing, added []string
+		for _, name := range requested {
+			if requestedSet[normalize(name)] {
+				continue
+			}
+			requestedSet[normalize(name)] = true
+			if !issuedSet[normalize(name)] {
+				missing = append(missing, name)
+			}
+		}
+		for _, name := range issued {
+			if !requestedSet[normalize(name)] {
+				added = append(added, name)
+			}
+		}
+		if len(missing) > 0 {
+			differences = append(differences, fmt.Sprintf("%s SANs %q are missing", sanType, missing))
+		}
+		if len(added) > 0 {
+			differences = append(differences, fmt.Sprintf("%s SANs %q were added", sanType, added))
+		}
+	}
+
+	requestedIPs := ipStrings(csr.IPAddresses)
+	requestedDNSNames, requestedURIs, requestedEmails := csr.DNSNames, uriStrings(csr.URIs), csr.EmailAddresses
+	var additional *commandissuer.AdditionalSANs
+	if spec != nil {
+		additional = spec.AdditionalSANs
+		if spec.IncludeCommonNameInSANs {
+			if ip := net.ParseIP(csr.Subject.CommonName); ip != nil {
+				requestedIPs = append(requestedIPs, ip.String())
+			} else if isDNSName(csr.Subject.CommonName) {
+				requestedDNSNames = append(append([]string{}, requestedDNSNames...), csr.Subject.CommonName)
+			}
+		}
+	}
+	if additional != nil {
+		requestedDNSNames = append(append([]string{}, requestedDNSNames...), additional.DNSNames...)
+		for _, value := range additional.IPAddresses {
+			if ip := net.ParseIP(value); ip != nil {
+				requestedIPs = append(requestedIPs, ip.String())
+			}
+		}
+		requestedURIs = append(requestedURIs, additional.URIs...)
+		requestedEmails = append(append([]string{}, requestedEmails...), additional.EmailAddresses...)
+	}
+
+	// DNS names and email addresses are compared case-insensitively
+	identity := func(name string) string { return name }
+	compare("DNS", requestedDNSNames, certificate.DNSNames, strings.ToLower)
+	compare("IP", requestedIPs, ipStrings(certificate.IPAddresses), identity)
+	compare("URI", requestedURIs, uriStrings(certificate.URIs), identity)
+	compare("Email", requestedEmails, certificate.EmailAddresses, strings.ToLower)
+
+	if len(differences) > 0 {
+		return fmt.Errorf("%w: %s", ErrIssuedSANMismatch, strings.Join(differences, "; "))
+	}
+	return nil
+}
+
+// ipStrings returns the string representations of the IP addresses
+func ipStrings(ips []net.IP) []string {
+	strs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		strs = append(strs, ip.String())
+	}
+	return strs
+}
+
+// uriStrings returns the string representations of the URIs
+func uriStrings(uris []*url.URL) []string {
+	strs := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		strs = append(strs, uri.String())
+	}
+	return strs
+}
@@ -0,0 +1,457 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	mixedSANs = map[string][]string{
+		commandSANDNS:               {"app.example.com", "www.example.com"},
+		commandSANIPv4:              {"10.0.0.1"},
+		commandSANIPv6:              {"2001:db8::1"},
+		commandSANURI:               {"spiffe://cluster.local/ns/default/sa/app"},
+		commandSANEmail:             {"app@example.com"},
+		commandSANUserPrincipalName: {"app@corp.example.com"},
+	}
+	oidTestOtherName = asn1.ObjectIdentifier{1, 2, 3, 4}
+)
+
+func TestSubjectAltNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		otherNameOID  asn1.ObjectIdentifier
+		expectedSANs  map[string][]string
+		expectedTypes map[string]commandissuer.SANType
+		expectedError error
+	}{
+		{
+			name:         "MixedSANTypes",
+			otherNameOID: oidUserPrincipalName,
+			expectedSANs: mixedSANs,
+			expectedTypes: map[string]commandissuer.SANType{
+				commandSANDNS:               commandissuer.SANTypeDNS,
+				commandSANIPv4:              commandissuer.SANTypeIP,
+				commandSANIPv6:              commandissuer.SANTypeIP,
+				commandSANURI:               commandissuer.SANTypeURI,
+				commandSANEmail:             commandissuer.SANTypeEmail,
+				commandSANUserPrincipalName: commandissuer.SANTypeOtherName,
+			},
+		},
+		{
+			name:          "UnsupportedOtherName",
+			otherNameOID:  oidTestOtherName,
+			expectedError: ErrSANTypeNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr, err := parseCSR(generateMixedSANCSR(t, tt.otherNameOID))
+			require.NoError(t, err)
+
+			sans, types, err := subjectAltNames(csr)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSANs, sans)
+			assert.Equal(t, tt.expectedTypes, types)
+		})
+	}
+}
+
+func TestSignForwardsSANs(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	tests := []struct {
+		name          string
+		allowed       []commandissuer.SANType
+		additional    *commandissuer.AdditionalSANs
+		expectedSANs  map[string][]string
+		expectedError error
+	}{
+		{
+			name: "AllSANTypesAllowed",
+		},
+		{
+			name: "AdditionalSANs",
+			additional: &commandissuer.AdditionalSANs{
+				DNSNames: []string{"WWW.example.com", "org.example.com"},
+				URIs:     []string{"urn:example:org"},
+			},
+			expectedSANs: map[string][]string{
+				commandSANDNS:               {"app.example.com", "www.example.com", "org.example.com"},
+				commandSANIPv4:              {"10.0.0.1"},
+				commandSANIPv6:              {"2001:db8::1"},
+				commandSANURI:               {"spiffe://cluster.local/ns/default/sa/app", "urn:example:org"},
+				commandSANEmail:             {"app@example.com"},
+				commandSANUserPrincipalName: {"app@corp.example.com"},
+			},
+		},
+		{
+			name: "AllowedSANTypes",
+			allowed: []commandissuer.SANType{
+				commandissuer.SANTypeDNS,
+				commandissuer.SANTypeIP,
+				commandissuer.SANTypeURI,
+				commandissuer.SANTypeEmail,
+				commandissuer.SANTypeOtherName,
+			},
+		},
+		{
+			name:          "DisallowedSANType",
+			allowed:       []commandissuer.SANType{commandissuer.SANTypeDNS, commandissuer.SANTypeIP},
+			expectedError: ErrSANTypeNotAllowed,
+		},
+		{
+			name:          "DisallowedAdditionalSANType",
+			allowed:       []commandissuer.SANType{commandissuer.SANTypeDNS, commandissuer.SANTypeIP, commandissuer.SANTypeURI, commandissuer.SANTypeOtherName},
+			additional:    &commandissuer.AdditionalSANs{EmailAddresses: []string{"security@example.com"}},
+			expectedError: ErrSANTypeNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string][]string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					SANs map[string][]string
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body.SANs)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.AllowedSANTypes = tt.allowed
+			spec.AdditionalSANs = tt.additional
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), generateMixedSANCSR(t, oidUserPrincipalName), K8sMetadata{})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Empty(t, requests, "a rejected CSR must not be enrolled")
+				return
+			}
+			assert.NoError(t, err)
+			expectedSANs := tt.expectedSANs
+			if expectedSANs == nil {
+				expectedSANs = mixedSANs
+			}
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, expectedSANs, requests[0])
+			}
+		})
+	}
+}
+
+// generateMixedSANCSR returns a PEM encoded CSR with DNS, IP, URI, email and otherName SANs. The SAN
+// extension is marshalled manually since crypto/x509 doesn't support otherName SANs.
+func TestCompareIssuedNames(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	requested := x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "app.example.com"},
+		DNSNames:       []string{"app.example.com", "www.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses: []string{"app@example.com"},
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &requested, key)
+	require.NoError(t, err)
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	tests := []struct {
+		name                string
+		modify              func(*x509.Certificate)
+		additional          *commandissuer.AdditionalSANs
+		expectedDifferences []string
+	}{
+		{
+			name: "Match",
+		},
+		{
+			name: "DifferentCase",
+			modify: func(c *x509.Certificate) {
+				c.DNSNames = []string{"APP.example.com", "www.example.com"}
+				c.EmailAddresses = []string{"App@Example.com"}
+			},
+		},
+		{
+			name:                "CommonNameRewritten",
+			modify:              func(c *x509.Certificate) { c.Subject.CommonName = "app" },
+			expectedDifferences: []string{`Common Name "app.example.com" was issued as "app"`},
+		},
+		{
+			name: "SANsStripped",
+			modify: func(c *x509.Certificate) {
+				c.DNSNames = []string{"app.example.com"}
+				c.IPAddresses = nil
+			},
+			expectedDifferences: []string{`DNS SANs ["www.example.com"] are missing`, `IP SANs ["10.0.0.1"] are missing`},
+		},
+		{
+			name:                "SANsAdded",
+			modify:              func(c *x509.Certificate) { c.DNSNames = append(c.DNSNames, "extra.example.com") },
+			expectedDifferences: []string{`DNS SANs ["extra.example.com"] were added`},
+		},
+		{
+			name: "AdditionalSANsIssued",
+			modify: func(c *x509.Certificate) {
+				c.DNSNames = append(c.DNSNames, "org.example.com")
+				c.IPAddresses = append(c.IPAddresses, net.ParseIP("10.0.0.2"))
+			},
+			additional: &commandissuer.AdditionalSANs{DNSNames: []string{"org.example.com", "app.example.com"}, IPAddresses: []string{"10.0.0.2"}},
+		},
+		{
+			name:                "AdditionalSANsMissing",
+			additional:          &commandissuer.AdditionalSANs{URIs: []string{"urn:example:org"}},
+			expectedDifferences: []string{`URI SANs ["urn:example:org"] are missing`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := x509.Certificate{
+				SerialNumber:   big.NewInt(1),
+				Subject:        requested.Subject,
+				DNSNames:       requested.DNSNames,
+				IPAddresses:    requested.IPAddresses,
+				EmailAddresses: requested.EmailAddresses,
+				NotBefore:      time.Now(),
+				NotAfter:       time.Now().Add(time.Hour),
+			}
+			if tt.modify != nil {
+				tt.modify(&template)
+			}
+			certificateDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+			require.NoError(t, err)
+
+			err = CompareIssuedNames(csr, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER}), &commandissuer.IssuerSpec{AdditionalSANs: tt.additional})
+			if len(tt.expectedDifferences) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrIssuedSANMismatch)
+			for _, difference := range tt.expectedDifferences {
+				assert.ErrorContains(t, err, difference)
+			}
+		})
+	}
+
+	assert.Error(t, CompareIssuedNames(csr, []byte("not a certificate"), nil))
+
+	t.Run("CommonNameInSANs", func(t *testing.T) {
+		requested := x509.CertificateRequest{Subject: pkix.Name{CommonName: "api.example.com"}}
+		csrDER, err := x509.CreateCertificateRequest(rand.Reader, &requested, key)
+		require.NoError(t, err)
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      requested.Subject,
+			DNSNames:     []string{"api.example.com"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		certificateDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		require.NoError(t, err)
+		csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+		certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER})
+
+		assert.NoError(t, CompareIssuedNames(csr, certificate, &commandissuer.IssuerSpec{IncludeCommonNameInSANs: true}))
+		assert.ErrorContains(t, CompareIssuedNames(csr, certificate, nil), `DNS SANs ["api.example.com"] were added`)
+	})
+}
+
+func TestSignNormalizesSANs(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	tests := []struct {
+		name                    string
+		csr                     x509.CertificateRequest
+		includeCommonNameInSANs bool
+		allowed                 []commandissuer.SANType
+		expectedSANs            map[string][]string
+		expectedError           error
+	}{
+		{
+			name: "DuplicateSANs",
+			csr: x509.CertificateRequest{
+				Subject:        pkix.Name{CommonName: "app.example.com"},
+				DNSNames:       []string{"app.example.com", "www.example.com", "APP.example.com", "www.example.com"},
+				IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.1")},
+				EmailAddresses: []string{"app@example.com", "App@Example.com"},
+			},
+			expectedSANs: map[string][]string{
+				commandSANDNS:   {"app.example.com", "www.example.com"},
+				commandSANIPv4:  {"10.0.0.1"},
+				commandSANEmail: {"app@example.com"},
+			},
+		},
+		{
+			name: "CommonNameOnlyInCommonName",
+			csr:  x509.CertificateRequest{Subject: pkix.Name{CommonName: "api.example.com"}},
+		},
+		{
+			name:                    "CommonNameAdded",
+			csr:                     x509.CertificateRequest{Subject: pkix.Name{CommonName: "api.example.com"}, DNSNames: []string{"www.example.com"}},
+			includeCommonNameInSANs: true,
+			expectedSANs:            map[string][]string{commandSANDNS: {"www.example.com", "api.example.com"}},
+		},
+		{
+			name:                    "CommonNameAlreadyInSANs",
+			csr:                     x509.CertificateRequest{Subject: pkix.Name{CommonName: "API.example.com"}, DNSNames: []string{"api.example.com"}},
+			includeCommonNameInSANs: true,
+			expectedSANs:            map[string][]string{commandSANDNS: {"api.example.com"}},
+		},
+		{
+			name:                    "IPCommonName",
+			csr:                     x509.CertificateRequest{Subject: pkix.Name{CommonName: "10.0.0.5"}},
+			includeCommonNameInSANs: true,
+			expectedSANs:            map[string][]string{commandSANIPv4: {"10.0.0.5"}},
+		},
+		{
+			name:                    "CommonNameNotADNSName",
+			csr:                     x509.CertificateRequest{Subject: pkix.Name{CommonName: "My Service"}},
+			includeCommonNameInSANs: true,
+		},
+		{
+			name:                    "CommonNameSANTypeNotAllowed",
+			csr:                     x509.CertificateRequest{Subject: pkix.Name{CommonName: "api.example.com"}},
+			includeCommonNameInSANs: true,
+			allowed:                 []commandissuer.SANType{commandissuer.SANTypeIP},
+			expectedError:           ErrSANTypeNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string][]string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					SANs map[string][]string
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body.SANs)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			require.NoError(t, err)
+			csrDER, err := x509.CreateCertificateRequest(rand.Reader, &tt.csr, key)
+			require.NoError(t, err)
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.IncludeCommonNameInSANs = tt.includeCommonNameInSANs
+			spec.AllowedSANTypes = tt.allowed
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}), K8sMetadata{})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Empty(t, requests, "a rejected CSR must not be enrolled")
+				return
+			}
+			assert.NoError(t, err)
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, tt.expectedSANs, requests[0])
+			}
+		})
+	}
+}
+
+func generateMixedSANCSR(t *testing.T, otherNameOID asn1.ObjectIdentifier) []byte {
+	otherNameValue, err := asn1.MarshalWithParams("app@corp.example.com", "utf8")
+	require.NoError(t, err)
+	otherNameBytes, err := asn1.MarshalWithParams(otherName{
+		TypeID: otherNameOID,
+		Value:  asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: otherNameValue},
+	}, "tag:0")
+	require.NoError(t, err)
+
+	generalNames := []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("app.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("www.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: net.ParseIP("10.0.0.1").To4()},
+		{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: net.ParseIP("2001:db8::1")},
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("spiffe://cluster.local/ns/default/sa/app")},
+		{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte("app@example.com")},
+		{FullBytes: otherNameBytes},
+	}
+	sanExtension, err := asn1.Marshal(generalNames)
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "app.example.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionSubjectAltName, Value: sanExtension},
+		},
+	}, key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+}
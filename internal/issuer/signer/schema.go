@@ -0,0 +1,419 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultSchemaRefreshInterval is how long the certificate templates and metadata fields fetched from
+// Command are used before they are refreshed in the background
+const DefaultSchemaRefreshInterval = 15 * time.Minute
+
+const (
+	// schemaPageSize is the number of templates or metadata fields fetched from Command per request
+	schemaPageSize = 100
+	// schemaMinRefetchInterval limits how often a schema is refetched because a request didn't match it,
+	// so that requests for a template that doesn't exist don't each fetch the schema from Command
+	schemaMinRefetchInterval = 30 * time.Second
+)
+
+// ErrSchemaMismatch is returned by Sign when the certificate template or a metadata field of the
+// request doesn't exist in Command. Retrying the request won't succeed.
+var ErrSchemaMismatch = errors.New("request does not match the templates and metadata fields in Command")
+
+// ErrKeyTypeNotSupported is returned by Sign when the public key of the CSR has a type that the
+// certificate template doesn't support. It wraps ErrSchemaMismatch.
+var ErrKeyTypeNotSupported = fmt.Errorf("%w: the certificate template does not support the key type of the CSR", ErrSchemaMismatch)
+
+// SchemaCache caches the certificate templates and metadata field definitions of the Command instances
+// used by the issuers, so that requests referencing a template or metadata field that doesn't exist
+// fail before they are enrolled. Schemas are refreshed in the background once they are older than the
+// refresh interval, and are refetched immediately if a request doesn't match them. A SchemaCache is
+// safe for concurrent use.
+type SchemaCache struct {
+	// SkipKeyTypeCheck disables checking the public key type of CSRs against the key types supported
+	// by the certificate template, e.g. if Command reports key types that the issuer doesn't recognize.
+	// It must be set before the cache is used.
+	SkipKeyTypeCheck bool
+
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu      sync.Mutex
+	schemas map[schemaKey]*schemaEntry
+}
+
+// schemaKey identifies the schema of a Command instance as seen by a Command user, since the templates
+// that can be enrolled depend on the permissions of the user
+type schemaKey struct {
+	host     string
+	username string
+}
+
+// schemaEntry is a cached schema of a Command instance
+type schemaEntry struct {
+	schema     *commandSchema
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// commandSchema holds the lower case names of the certificate templates and metadata fields of a
+// Command instance, and the key types supported by the templates that report them
+type commandSchema struct {
+	templates      map[string]bool
+	metadataFields map[string]bool
+	// templateKeyAlgorithms maps the lower case names of templates to the key algorithms they support.
+	// Templates whose key type isn't known aren't listed.
+	templateKeyAlgorithms map[string][]commandissuer.KeyAlgorithm
+}
+
+// NewSchemaCache returns a SchemaCache that refreshes schemas older than refreshInterval
+func NewSchemaCache(refreshInterval time.Duration) *SchemaCache {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultSchemaRefreshInterval
+	}
+	return &SchemaCache{
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+		schemas:         make(map[schemaKey]*schemaEntry),
+	}
+}
+
+type schemaCacheContextKey struct{}
+
+// ContextWithSchemaCache returns a copy of ctx carrying the schema cache consulted by the signers
+// created with it. If ctx carries no cache, requests aren't validated against the Command schema.
+func ContextWithSchemaCache(ctx context.Context, cache *SchemaCache) context.Context {
+	return context.WithValue(ctx, schemaCacheContextKey{}, cache)
+}
+
+// schemaCacheFromContext returns the schema cache carried by ctx, or nil
+func schemaCacheFromContext(ctx context.Context) *SchemaCache {
+	cache, _ := ctx.Value(schemaCacheContextKey{}).(*SchemaCache)
+	return cache
+}
+
+// schemaKeyForClient returns the key of the schema seen by the Command client
+func schemaKeyForClient(client *keyfactor.APIClient) schemaKey {
+	config := client.GetConfig()
+	return schemaKey{host: config.Host, username: config.BasicAuth.UserName}
+}
+
+// get returns the cached schema of the Command client, fetching it if it isn't cached yet. A schema
+// older than the refresh interval is returned while it is refreshed in the background. If the schema
+// can't be fetched, e.g. because the user lacks permission to read it, get returns nil and the fetch
+// isn't retried before the refresh interval elapses.
+func (c *SchemaCache) get(ctx context.Context, client *keyfactor.APIClient) *commandSchema {
+	key := schemaKeyForClient(client)
+
+	c.mu.Lock()
+	entry, ok := c.schemas[key]
+	if ok {
+		if !entry.refreshing && c.now().Sub(entry.fetchedAt) >= c.refreshInterval {
+			entry.refreshing = true
+			// The refresh outlives the reconcile that triggered it
+			go c.fetch(context.WithoutCancel(ctx), key, client)
+		}
+		c.mu.Unlock()
+		return entry.schema
+	}
+	c.mu.Unlock()
+
+	return c.fetch(ctx, key, client)
+}
+
+// invalidate refetches the schema of the Command client after a request didn't match it, unless the
+// schema was fetched less than schemaMinRefetchInterval ago. It returns the current schema, or nil if
+// it can't be fetched.
+func (c *SchemaCache) invalidate(ctx context.Context, client *keyfactor.APIClient) *commandSchema {
+	key := schemaKeyForClient(client)
+
+	c.mu.Lock()
+	entry, ok := c.schemas[key]
+	if ok && c.now().Sub(entry.fetchedAt) < schemaMinRefetchInterval {
+		c.mu.Unlock()
+		return entry.schema
+	}
+	c.mu.Unlock()
+
+	return c.fetch(ctx, key, client)
+}
+
+// Forget removes the schemas of the Command instance at hostname for all users, so that they are
+// fetched again by the next request. Forget is a no-op on a nil SchemaCache.
+func (c *SchemaCache) Forget(hostname string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	host := commandHost(hostname)
+	for key := range c.schemas {
+		if key.host == host {
+			delete(c.schemas, key)
+		}
+	}
+}
+
+// fetch fetches the schema of the Command client and stores it in the cache
+func (c *SchemaCache) fetch(ctx context.Context, key schemaKey, client *keyfactor.APIClient) *commandSchema {
+	schema, err := fetchCommandSchema(ctx, client)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to fetch the certificate templates and metadata fields from Command. Requests won't be validated against them until the next refresh.")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schemas[key] = &schemaEntry{schema: schema, fetchedAt: c.now()}
+	return schema
+}
+
+// fetchCommandSchema fetches the certificate templates and metadata fields visible to the Command client
+func fetchCommandSchema(ctx context.Context, client *keyfactor.APIClient) (*commandSchema, error) {
+	schema := &commandSchema{
+		templates:             make(map[string]bool),
+		metadataFields:        make(map[string]bool),
+		templateKeyAlgorithms: make(map[string][]commandissuer.KeyAlgorithm),
+	}
+
+	err := listAllPages(schema.templates, func(page int32) ([]string, error) {
+		templates, _, err := client.TemplateApi.TemplateGetTemplates(ctx).
+			SqPageReturned(page).
+			SqReturnLimit(schemaPageSize).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get certificate templates from Command: %w", err)
+		}
+
+		// Enrollments may reference a template by its short name or its display name
+		var names []string
+		for _, template := range templates {
+			names = append(names, template.GetCommonName(), template.GetTemplateName())
+			if algorithms, ok := parseTemplateKeyType(template.GetKeyType()); ok {
+				for _, name := range []string{template.GetCommonName(), template.GetTemplateName()} {
+					if name != "" {
+						schema.templateKeyAlgorithms[strings.ToLower(name)] = algorithms
+					}
+				}
+			}
+		}
+		return names, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = listAllPages(schema.metadataFields, func(page int32) ([]string, error) {
+		fields, _, err := client.MetadataFieldApi.MetadataFieldGetAllMetadataFields(ctx).
+			PqPageReturned(page).
+			PqReturnLimit(schemaPageSize).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metadata fields from Command: %w", err)
+		}
+
+		var names []string
+		for _, field := range fields {
+			names = append(names, field.GetName())
+		}
+		return names, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// listAllPages adds the lowercased names returned by list to names, requesting pages until a page
+// adds no new names. Command may return fewer entries than requested per page, so a short page
+// doesn't mean that it is the last one. Stopping at a page without new names also ends the listing
+// if Command ignores the paging parameters and returns every entry on each page.
+func listAllPages(names map[string]bool, list func(page int32) ([]string, error)) error {
+	for page := int32(1); ; page++ {
+		pageNames, err := list(page)
+		if err != nil {
+			return err
+		}
+
+		added := false
+		for _, name := range pageNames {
+			name = strings.ToLower(name)
+			if name != "" && !names[name] {
+				names[name] = true
+				added = true
+			}
+		}
+		if !added {
+			return nil
+		}
+	}
+}
+
+// validate verifies that the certificate template and metadata fields exist in the schema
+func (s *commandSchema) validate(template string, metadataFields []string) error {
+	if !s.templates[strings.ToLower(template)] {
+		return fmt.Errorf("%w: certificate template %q does not exist in Command or can't be used by the issuer's credentials", ErrSchemaMismatch, template)
+	}
+
+	var missing []string
+	for _, field := range metadataFields {
+		if !s.metadataFields[strings.ToLower(field)] {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: metadata fields %q do not exist in Command", ErrSchemaMismatch, missing)
+	}
+
+	return nil
+}
+
+// checkSchema validates the certificate template and the optional metadata fields of the request against
+// the schema cached for its Command client, if the context carries a schema cache. A request that
+// doesn't match the schema refetches it once, in case the template or field was created since the
+// schema was cached.
+func (s *commandSigner) checkSchema(ctx context.Context, k8sMeta K8sMetadata) error {
+	cache := schemaCacheFromContext(ctx)
+	if cache == nil {
+		return nil
+	}
+
+	// The metadata fields that are always recorded are required by the issuer, so only the optional
+	// ones are validated
+	metadataFields := make([]string, 0, len(s.customMetadata)+len(k8sMeta.IssuerMetadata)+2)
+	for name := range s.customMetadata {
+		metadataFields = append(metadataFields, name)
+	}
+	for name := range k8sMeta.IssuerMetadata {
+		if _, ok := s.customMetadata[name]; !ok {
+			metadataFields = append(metadataFields, name)
+		}
+	}
+	if k8sMeta.ClusterName != "" {
+		metadataFields = append(metadataFields, CommandMetaClusterName)
+	}
+	if s.certificateCollection != "" {
+		metadataFields = append(metadataFields, CommandMetaCertificateCollection)
+	}
+	for _, name := range s.changeReference.metadataFields() {
+		if _, ok := s.customMetadata[name]; !ok {
+			metadataFields = append(metadataFields, name)
+		}
+	}
+
+	schema := cache.get(ctx, s.client)
+	if schema == nil {
+		return nil
+	}
+	if err := schema.validate(s.certificateTemplate, metadataFields); err == nil {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Request does not match the cached Command schema. Refetching the certificate templates and metadata fields from Command.")
+	schema = cache.invalidate(ctx, s.client)
+	if schema == nil {
+		return nil
+	}
+	return schema.validate(s.certificateTemplate, metadataFields)
+}
+
+// parseTemplateKeyType returns the key algorithms of the key type reported by Command for a
+// certificate template, e.g. "RSA" or "ECC". It returns false if the key type is empty, allows any
+// key, or names an algorithm that the issuer doesn't recognize, in which case CSRs aren't checked.
+func parseTemplateKeyType(keyType string) ([]commandissuer.KeyAlgorithm, bool) {
+	var algorithms []commandissuer.KeyAlgorithm
+	for _, name := range strings.FieldsFunc(keyType, func(r rune) bool { return r == ',' || r == '/' || r == ' ' }) {
+		var algorithm commandissuer.KeyAlgorithm
+		switch strings.ToLower(name) {
+		case "rsa":
+			algorithm = commandissuer.KeyAlgorithmRSA
+		case "ecc", "ecdsa", "ec":
+			algorithm = commandissuer.KeyAlgorithmECDSA
+		case "ed25519":
+			algorithm = commandissuer.KeyAlgorithmEd25519
+		default:
+			return nil, false
+		}
+		if !slices.Contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms, len(algorithms) > 0
+}
+
+// checkKeyType verifies that the certificate template supports the key type of the CSR, if the key
+// types of the template are known
+func (s *commandSchema) checkKeyType(template string, csr *x509.CertificateRequest) error {
+	supported := s.templateKeyAlgorithms[strings.ToLower(template)]
+	if len(supported) == 0 {
+		return nil
+	}
+
+	algorithm, ok := csrKeyAlgorithm(csr)
+	if !ok || slices.Contains(supported, algorithm) {
+		return nil
+	}
+
+	names := make([]string, 0, len(supported))
+	for _, a := range supported {
+		names = append(names, string(a))
+	}
+	return fmt.Errorf("%w: the CSR has an %s key, but certificate template %q only supports %s keys", ErrKeyTypeNotSupported, algorithm, template, strings.Join(names, ", "))
+}
+
+// checkTemplateKeyType verifies that the certificate template supports the key type of the CSR,
+// using the schema cached for the Command client, if the context carries a schema cache. A CSR that
+// the cached schema rejects refetches it once, in case the template was changed since it was cached.
+func (s *commandSigner) checkTemplateKeyType(ctx context.Context, csr *x509.CertificateRequest) error {
+	cache := schemaCacheFromContext(ctx)
+	if cache == nil || cache.SkipKeyTypeCheck {
+		return nil
+	}
+
+	schema := cache.get(ctx, s.client)
+	if schema == nil {
+		return nil
+	}
+	if err := schema.checkKeyType(s.certificateTemplate, csr); err == nil {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("CSR key type is not supported by the certificate template in the cached Command schema. Refetching the certificate templates from Command.")
+	schema = cache.invalidate(ctx, s.client)
+	if schema == nil {
+		return nil
+	}
+	return schema.checkKeyType(s.certificateTemplate, csr)
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSchemaServer is a fake Command server that serves certificate templates and metadata fields
+type fakeSchemaServer struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	templates      []string
+	metadataFields []string
+	// keyTypes maps templates to the key type reported for them
+	keyTypes     map[string]string
+	schemaStatus int
+	// maxPageSize caps the number of entries returned per page regardless of the requested limit
+	maxPageSize int
+
+	schemaRequests atomic.Int32
+	enrollments    atomic.Int32
+}
+
+func newFakeSchemaServer(t *testing.T, templates, metadataFields []string) *fakeSchemaServer {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	s := &fakeSchemaServer{templates: templates, metadataFields: metadataFields, schemaStatus: http.StatusOK}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var response []map[string]string
+		var paging string
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/Enrollment/CSR"):
+			s.enrollments.Add(1)
+			_, _ = w.Write(enrollmentResponse)
+			return
+		case strings.HasSuffix(r.URL.Path, "/Templates"):
+			paging = "sq"
+			for _, template := range s.templates {
+				response = append(response, map[string]string{"CommonName": template, "TemplateName": template + " Display", "KeyType": s.keyTypes[template]})
+			}
+		case strings.HasSuffix(r.URL.Path, "/MetadataFields"):
+			paging = "pq"
+			for _, field := range s.metadataFields {
+				response = append(response, map[string]string{"Name": field})
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s.schemaRequests.Add(1)
+		if s.schemaStatus != http.StatusOK {
+			w.WriteHeader(s.schemaStatus)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s.page(response, r.URL.Query(), paging))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// page returns the page of entries selected by the paging query parameters with the given prefix
+func (s *fakeSchemaServer) page(entries []map[string]string, query url.Values, prefix string) []map[string]string {
+	page, _ := strconv.Atoi(query.Get(prefix + ".pageReturned"))
+	limit, _ := strconv.Atoi(query.Get(prefix + ".returnLimit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > len(entries) {
+		limit = len(entries)
+	}
+	if s.maxPageSize > 0 && limit > s.maxPageSize {
+		limit = s.maxPageSize
+	}
+
+	start := min((page-1)*limit, len(entries))
+	end := min(start+limit, len(entries))
+	return entries[start:end]
+}
+
+func (s *fakeSchemaServer) setTemplates(templates ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates = templates
+}
+
+func TestSignSchemaValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		template       string
+		metadata       map[string]string
+		k8sMeta        K8sMetadata
+		keyType        string
+		skipKeyType    bool
+		schemaStatus   int
+		expectedError  error
+		expectedDetail string
+	}{
+		{
+			name:     "Valid",
+			template: "template",
+			metadata: map[string]string{commandMetadataAnnotationPrefix + "Team": "pki"},
+		},
+		{
+			name:     "CaseInsensitive",
+			template: "TEMPLATE",
+			metadata: map[string]string{commandMetadataAnnotationPrefix + "team": "pki"},
+		},
+		{
+			name:     "TemplateDisplayName",
+			template: "template Display",
+		},
+		{
+			name:           "MissingTemplate",
+			template:       "missing",
+			expectedError:  ErrSchemaMismatch,
+			expectedDetail: `certificate template "missing"`,
+		},
+		{
+			name:           "MissingMetadataField",
+			template:       "template",
+			metadata:       map[string]string{commandMetadataAnnotationPrefix + "Owner": "pki"},
+			expectedError:  ErrSchemaMismatch,
+			expectedDetail: `metadata fields ["Owner"]`,
+		},
+		{
+			name:     "IssuerMetadataField",
+			template: "template",
+			k8sMeta:  K8sMetadata{IssuerMetadata: map[string]string{"Team": "pki"}},
+		},
+		{
+			name:           "MissingIssuerMetadataField",
+			template:       "template",
+			k8sMeta:        K8sMetadata{IssuerMetadata: map[string]string{"Environment": "production"}},
+			expectedError:  ErrSchemaMismatch,
+			expectedDetail: `metadata fields ["Environment"]`,
+		},
+		{
+			name:           "MissingClusterNameField",
+			template:       "template",
+			k8sMeta:        K8sMetadata{ClusterName: "prod-eu"},
+			expectedError:  ErrSchemaMismatch,
+			expectedDetail: `metadata fields ["Cluster-Name"]`,
+		},
+		{
+			name:     "SupportedKeyType",
+			template: "template",
+			keyType:  "RSA",
+		},
+		{
+			name:           "UnsupportedKeyType",
+			template:       "template",
+			keyType:        "ECC",
+			expectedError:  ErrKeyTypeNotSupported,
+			expectedDetail: `the CSR has an RSA key, but certificate template "template" only supports ECDSA keys`,
+		},
+		{
+			name:        "UnsupportedKeyTypeCheckSkipped",
+			template:    "template",
+			keyType:     "ECC",
+			skipKeyType: true,
+		},
+		{
+			name:     "AnyKeyType",
+			template: "template",
+			keyType:  "Any",
+		},
+		{
+			name:         "SchemaUnavailable",
+			template:     "missing",
+			schemaStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSchemaServer(t, []string{"template"}, []string{"Team"})
+			if tt.schemaStatus != 0 {
+				server.schemaStatus = tt.schemaStatus
+			}
+			server.keyTypes = map[string]string{"template": tt.keyType}
+
+			ctx, spec, _, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server.Server)
+			spec.CertificateTemplate = tt.template
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, tt.metadata, authSecretData, readSecretData, caSecretData)
+			require.NoError(t, err)
+
+			csr, err := generateCSR("CN=test.example.com")
+			require.NoError(t, err)
+
+			cache := NewSchemaCache(time.Hour)
+			cache.SkipKeyTypeCheck = tt.skipKeyType
+			ctx = ContextWithSchemaCache(ctx, cache)
+			_, _, _, err = signer.Sign(ctx, csr, tt.k8sMeta)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.ErrorContains(t, err, tt.expectedDetail)
+				assert.Zero(t, server.enrollments.Load(), "a request that doesn't match the schema must not be enrolled")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), server.enrollments.Load())
+		})
+	}
+}
+
+func TestParseTemplateKeyType(t *testing.T) {
+	tests := []struct {
+		keyType    string
+		expected   []commandissuer.KeyAlgorithm
+		expectedOK bool
+	}{
+		{keyType: "RSA", expected: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmRSA}, expectedOK: true},
+		{keyType: "ecc", expected: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmECDSA}, expectedOK: true},
+		{keyType: "Ed25519", expected: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmEd25519}, expectedOK: true},
+		{keyType: "RSA, ECC", expected: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmRSA, commandissuer.KeyAlgorithmECDSA}, expectedOK: true},
+		{keyType: "ECC/EC", expected: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmECDSA}, expectedOK: true},
+		{keyType: ""},
+		{keyType: "Any"},
+		{keyType: "RSA, Ed448"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyType, func(t *testing.T) {
+			algorithms, ok := parseTemplateKeyType(tt.keyType)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expected, algorithms)
+		})
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	server := newFakeSchemaServer(t, []string{"template"}, nil)
+
+	ctx, spec, annotations, authSecretData, readSecretData, caSecretData := getFakeCommandSignerConfigItems(server.Server)
+	spec.CertificateTemplate = "new"
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
+	require.NoError(t, err)
+
+	now := time.Now()
+	cache := NewSchemaCache(time.Hour)
+	cache.now = func() time.Time { return now }
+	ctx = ContextWithSchemaCache(ctx, cache)
+
+	// The schema is fetched once and cached, and a mismatch right after fetching it isn't refetched
+	assert.ErrorIs(t, signer.checkSchema(ctx, K8sMetadata{}), ErrSchemaMismatch)
+	assert.Equal(t, int32(3), server.schemaRequests.Load())
+	assert.ErrorIs(t, signer.checkSchema(ctx, K8sMetadata{}), ErrSchemaMismatch)
+	assert.Equal(t, int32(3), server.schemaRequests.Load())
+
+	// Once the template is created in Command, a mismatch refetches the schema
+	server.setTemplates("template", "new")
+	now = now.Add(schemaMinRefetchInterval)
+	assert.NoError(t, signer.checkSchema(ctx, K8sMetadata{}))
+	assert.Equal(t, int32(6), server.schemaRequests.Load())
+	assert.NoError(t, signer.checkSchema(ctx, K8sMetadata{}))
+	assert.Equal(t, int32(6), server.schemaRequests.Load())
+
+	// A stale schema is still used while it is refreshed in the background
+	server.setTemplates("template")
+	now = now.Add(time.Hour)
+	assert.NoError(t, signer.checkSchema(ctx, K8sMetadata{}))
+	assert.Eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return !cache.schemas[schemaKeyForClient(signer.client)].refreshing
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(9), server.schemaRequests.Load())
+	assert.ErrorIs(t, signer.checkSchema(ctx, K8sMetadata{}), ErrSchemaMismatch)
+}
+
+func TestSignWithoutSchemaCache(t *testing.T) {
+	server := newFakeSchemaServer(t, nil, nil)
+
+	signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server.Server))
+	require.NoError(t, err)
+
+	csr, err := generateCSR("CN=test.example.com")
+	require.NoError(t, err)
+
+	_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+	assert.NoError(t, err)
+	assert.Zero(t, server.schemaRequests.Load(), "the schema must not be fetched without a schema cache")
+}
+
+func TestFetchCommandSchemaPagination(t *testing.T) {
+	var templates, metadataFields []string
+	for i := 0; i < 2*schemaPageSize+10; i++ {
+		templates = append(templates, fmt.Sprintf("template%d", i))
+		metadataFields = append(metadataFields, fmt.Sprintf("Field%d", i))
+	}
+
+	tests := []struct {
+		name             string
+		maxPageSize      int
+		expectedRequests int32
+	}{
+		{
+			name:             "RequestedPageSize",
+			expectedRequests: 8,
+		},
+		{
+			name:             "SmallerPageSize",
+			maxPageSize:      30,
+			expectedRequests: 16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSchemaServer(t, templates, metadataFields)
+			server.maxPageSize = tt.maxPageSize
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server.Server))
+			require.NoError(t, err)
+
+			schema, err := fetchCommandSchema(context.Background(), signer.client)
+			require.NoError(t, err)
+
+			// Entries beyond the first page must be found
+			assert.NoError(t, schema.validate(templates[len(templates)-1], []string{metadataFields[len(metadataFields)-1]}))
+			assert.NoError(t, schema.validate("Template209 Display", nil))
+			assert.Len(t, schema.templates, 2*len(templates))
+			assert.Len(t, schema.metadataFields, len(metadataFields))
+			assert.Equal(t, tt.expectedRequests, server.schemaRequests.Load())
+		})
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// SelfTestCommonNamePrefix prefixes the Common Name of the throwaway certificates enrolled by
+	// SelfTest, so that they can be told apart from the certificates of workloads in Command
+	SelfTestCommonNamePrefix = "command-issuer-self-test-"
+	// SelfTestControllerKind is recorded in the Controller-Kind metadata field of the certificates
+	// enrolled by SelfTest instead of the kind of a request
+	SelfTestControllerKind = "SelfTest"
+)
+
+// ErrSelfTestFailed is returned by SelfTest when Command issued a certificate that doesn't match the
+// throwaway CSR or whose chain doesn't verify
+var ErrSelfTestFailed = errors.New("self-test failed")
+
+// SelfTestOptions configures SelfTest
+type SelfTestOptions struct {
+	// CertificateTemplate is the Command certificate template the throwaway CSR is enrolled with
+	// instead of the template of the issuer. It should be a template dedicated to testing.
+	CertificateTemplate string
+	// Revoke revokes the certificate in Command once it has been verified
+	Revoke bool
+	// IssuerName and IssuerNamespace identify the issuer in the metadata of the certificate
+	IssuerName      string
+	IssuerNamespace string
+}
+
+// SelfTestResult describes the certificate enrolled by SelfTest
+type SelfTestResult struct {
+	CommonName    string
+	CertificateID int32
+	SerialNumber  string
+	NotAfter      time.Time
+	// ChainLength is the number of CA certificates that Command returned with the certificate
+	ChainLength int
+	// Revoked is true if the certificate was revoked in Command
+	Revoked bool
+}
+
+// SelfTest exercises the enrollment path of the issuer end to end, outside of the reconcilers. It
+// enrolls a throwaway CSR with a random Common Name prefixed by SelfTestCommonNamePrefix using the
+// certificate template of the options, verifies that the certificate matches the key of the CSR and
+// that its chain verifies, and revokes the certificate if requested. The certificate is revoked even
+// if its verification fails. The checks of the issuer apply to the throwaway CSR like to any request.
+func SelfTest(ctx context.Context, spec *commandissuer.IssuerSpec, authSecretData map[string][]byte, caSecretData map[string][]byte, options SelfTestOptions) (*SelfTestResult, error) {
+	k8sLog := log.FromContext(ctx)
+
+	if options.CertificateTemplate == "" {
+		return nil, fmt.Errorf("%w: the certificate template of the self-test is required", ErrInvalidConfig)
+	}
+	spec = spec.DeepCopy()
+	spec.CertificateTemplate = options.CertificateTemplate
+
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, nil, authSecretData, nil, caSecretData)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := strings.ToLower(generateRandomString(12))
+	commonName := SelfTestCommonNamePrefix + suffix
+	csrBytes, err := selfTestCSR(commonName, spec.KeyPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the CSR of the self-test: %w", err)
+	}
+
+	k8sLog.Info(fmt.Sprintf("Enrolling throwaway certificate %q with certificate template %q", commonName, options.CertificateTemplate))
+	leafBytes, chainBytes, certificateID, err := signer.Sign(ctx, csrBytes, K8sMetadata{
+		ControllerKind:        SelfTestControllerKind,
+		IssuerName:            options.IssuerName,
+		IssuerNamespace:       options.IssuerNamespace,
+		ControllerReconcileId: suffix,
+	})
+	var pendingErr *EnrollmentPendingError
+	if errors.As(err, &pendingErr) {
+		return nil, fmt.Errorf("%w. The certificate template of the self-test must not require approval. Deny request %d in Command.", err, pendingErr.RequestID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SelfTestResult{
+		CommonName:    commonName,
+		CertificateID: certificateID,
+	}
+	verifyErr := verifySelfTestCertificate(result, csrBytes, leafBytes, chainBytes, time.Now())
+	if verifyErr == nil {
+		k8sLog.Info(fmt.Sprintf("Verified certificate with Command ID %d and a chain of %d CA certificates", certificateID, result.ChainLength))
+	}
+
+	if !options.Revoke {
+		return result, verifyErr
+	}
+	if certificateID == 0 {
+		return result, errors.Join(verifyErr, errors.New("Command did not return the ID of the certificate, so it was not revoked"))
+	}
+
+	request := keyfactor.ModelsRevokeCertificateRequest{
+		CertificateIds: []int32{certificateID},
+		Reason:         ptr(int32(revocationReasonCessationOfOperation)),
+		Comment:        ptr(signer.changeReference.revocationComment("Throwaway certificate of the command-cert-manager-issuer self-test")),
+	}
+	if _, _, err := signer.client.CertificateApi.CertificateRevoke(ctx).Request(request).Execute(); err != nil {
+		return result, errors.Join(verifyErr, fmt.Errorf("failed to revoke certificate %d in Command, so it must be revoked manually: %w", certificateID, err))
+	}
+	k8sLog.Info(fmt.Sprintf("Revoked certificate with Command ID %d", certificateID))
+	result.Revoked = true
+
+	return result, verifyErr
+}
+
+// selfTestCSR returns a PEM encoded CSR with the Common Name and a new key. The key is an RSA key,
+// unless the key policy of the issuer doesn't allow RSA keys, in which case it is an ECDSA key.
+func selfTestCSR(commonName string, policy *commandissuer.KeyPolicy) ([]byte, error) {
+	var key crypto.Signer
+	var err error
+	switch {
+	case policy == nil || containsAlgorithm(policy.AllowedKeyAlgorithms, commandissuer.KeyAlgorithmRSA):
+		size := 2048
+		if policy != nil && policy.MinRSAKeySize > size {
+			size = policy.MinRSAKeySize
+		}
+		key, err = rsa.GenerateKey(cryptorand.Reader, size)
+	default:
+		curve := elliptic.P256()
+		switch {
+		case policy.MinECDSAKeySize > 384:
+			curve = elliptic.P521()
+		case policy.MinECDSAKeySize > 256:
+			curve = elliptic.P384()
+		}
+		key, err = ecdsa.GenerateKey(curve, cryptorand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(cryptorand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// verifySelfTestCertificate verifies that the certificate returned for the throwaway CSR has its key
+// and Common Name and hasn't expired at now, and that every certificate of the chain is signed by the
+// next one, and records the certificate in result. A self-signed root at the end of the chain must
+// verify its own signature.
+func verifySelfTestCertificate(result *SelfTestResult, csrBytes, leafBytes, chainBytes []byte, now time.Time) error {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return err
+	}
+
+	leaves, err := parseCACertificates(leafBytes)
+	if err != nil || len(leaves) != 1 {
+		return fmt.Errorf("%w: Command did not return a single certificate", ErrSelfTestFailed)
+	}
+	leaf := leaves[0]
+	result.SerialNumber = leaf.SerialNumber.Text(16)
+	result.NotAfter = leaf.NotAfter
+
+	if !hasPublicKey(leaves, csr.PublicKey) {
+		return fmt.Errorf("%w: the certificate doesn't have the public key of the CSR", ErrSelfTestFailed)
+	}
+	if leaf.Subject.CommonName != csr.Subject.CommonName {
+		return fmt.Errorf("%w: the certificate has Common Name %q instead of %q", ErrSelfTestFailed, leaf.Subject.CommonName, csr.Subject.CommonName)
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("%w: the certificate expired at %s", ErrSelfTestFailed, leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	chain, err := parseCACertificates(chainBytes)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse the CA chain: %v", ErrSelfTestFailed, err)
+	}
+	result.ChainLength = len(chain)
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: Command did not return the CA chain of the certificate", ErrSelfTestFailed)
+	}
+
+	certificates := append([]*x509.Certificate{leaf}, chain...)
+	for i, certificate := range certificates[:len(certificates)-1] {
+		if err := certificate.CheckSignatureFrom(certificates[i+1]); err != nil {
+			return fmt.Errorf("%w: certificate %q of the chain is not signed by %q: %v", ErrSelfTestFailed, certificate.Subject, certificates[i+1].Subject, err)
+		}
+	}
+	if root := chain[len(chain)-1]; root.Subject.String() == root.Issuer.String() {
+		if err := root.CheckSignatureFrom(root); err != nil {
+			return fmt.Errorf("%w: the self-signed root %q of the chain doesn't verify: %v", ErrSelfTestFailed, root.Subject, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCertificate, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		options         SelfTestOptions
+		keyPolicy       *commandissuer.KeyPolicy
+		pending         bool
+		wrongKey        bool
+		expectedError   error
+		expectedMessage string
+		expectedRevoked bool
+	}{
+		{
+			name:            "Revoke",
+			options:         SelfTestOptions{CertificateTemplate: "SelfTest", Revoke: true, IssuerName: "issuer-sample", IssuerNamespace: "default"},
+			expectedRevoked: true,
+		},
+		{
+			name:    "KeepCertificate",
+			options: SelfTestOptions{CertificateTemplate: "SelfTest"},
+		},
+		{
+			name:      "ECDSAKeyPolicy",
+			options:   SelfTestOptions{CertificateTemplate: "SelfTest"},
+			keyPolicy: &commandissuer.KeyPolicy{AllowedKeyAlgorithms: []commandissuer.KeyAlgorithm{commandissuer.KeyAlgorithmECDSA}, MinECDSAKeySize: 384},
+		},
+		{
+			name:            "WrongKey",
+			options:         SelfTestOptions{CertificateTemplate: "SelfTest", Revoke: true},
+			wrongKey:        true,
+			expectedError:   ErrSelfTestFailed,
+			expectedMessage: "the certificate doesn't have the public key of the CSR",
+			expectedRevoked: true,
+		},
+		{
+			name:            "Pending",
+			options:         SelfTestOptions{CertificateTemplate: "SelfTest", Revoke: true},
+			pending:         true,
+			expectedError:   ErrEnrollmentPending,
+			expectedMessage: "must not require approval. Deny request 42 in Command.",
+		},
+		{
+			name:          "MissingTemplate",
+			options:       SelfTestOptions{Revoke: true},
+			expectedError: ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var enrollments []map[string]interface{}
+			var revocations []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				mu.Lock()
+				defer mu.Unlock()
+				if strings.HasSuffix(r.URL.Path, "/Certificates/Revoke") {
+					revocations = append(revocations, body)
+					_, _ = w.Write([]byte("{}"))
+					return
+				}
+				enrollments = append(enrollments, body)
+				if tt.pending {
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"CertificateInformation": map[string]interface{}{
+							"RequestDisposition": "PENDING",
+							"KeyfactorRequestId": fakeCommandRequestID,
+						},
+					})
+					return
+				}
+
+				block, _ := pem.Decode([]byte(body["CSR"].(string)))
+				csr, err := x509.ParseCertificateRequest(block.Bytes)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				publicKey := csr.PublicKey
+				if tt.wrongKey {
+					publicKey = &otherKey.PublicKey
+				}
+				leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+					SerialNumber: big.NewInt(2),
+					Subject:      csr.Subject,
+					NotBefore:    time.Now().Add(-time.Minute),
+					NotAfter:     time.Now().Add(time.Hour),
+				}, caCertificate, publicKey, caKey)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"CertificateInformation": map[string]interface{}{
+						"KeyfactorID": fakeCommandCertificateID,
+						"Certificates": []string{
+							string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})),
+							string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+						},
+					},
+				})
+			}))
+			defer server.Close()
+
+			ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.KeyPolicy = tt.keyPolicy
+			result, err := SelfTest(ctx, spec, authSecretData, caSecretData, tt.options)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.ErrorContains(t, err, tt.expectedMessage)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(result.CommonName, SelfTestCommonNamePrefix), result.CommonName)
+				assert.Equal(t, int32(fakeCommandCertificateID), result.CertificateID)
+				assert.Equal(t, "2", result.SerialNumber)
+				assert.Equal(t, 1, result.ChainLength)
+			}
+			assert.Equal(t, "template", spec.CertificateTemplate, "the spec of the issuer must not be modified")
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.options.CertificateTemplate == "" {
+				assert.Empty(t, enrollments)
+				return
+			}
+			require.Len(t, enrollments, 1)
+			assert.Equal(t, tt.options.CertificateTemplate, enrollments[0]["Template"])
+			metadata, _ := enrollments[0]["Metadata"].(map[string]interface{})
+			assert.Equal(t, SelfTestControllerKind, metadata[CommandMetaControllerKind])
+			assert.Equal(t, tt.options.IssuerName, metadata[CommandMetaIssuerName])
+
+			if tt.keyPolicy != nil {
+				block, _ := pem.Decode([]byte(enrollments[0]["CSR"].(string)))
+				csr, err := x509.ParseCertificateRequest(block.Bytes)
+				require.NoError(t, err)
+				key, ok := csr.PublicKey.(*ecdsa.PublicKey)
+				require.True(t, ok, "the CSR must have an ECDSA key")
+				assert.Equal(t, 384, key.Curve.Params().BitSize)
+			}
+
+			if !tt.expectedRevoked {
+				assert.Empty(t, revocations)
+				return
+			}
+			require.Len(t, revocations, 1)
+			assert.Equal(t, []interface{}{float64(fakeCommandCertificateID)}, revocations[0]["CertificateIds"])
+			assert.True(t, result.Revoked)
+		})
+	}
+}
@@ -25,8 +25,14 @@ import (
 	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
 	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
 	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -34,8 +40,33 @@ const (
 	// Keyfactor enrollment PEM format
 	enrollmentPEMFormat             = "PEM"
 	commandMetadataAnnotationPrefix = "metadata.command-issuer.keyfactor.com/"
+	// Property of the CSR enrollment request that makes Command treat the enrollment as a
+	// renewal of an existing certificate
+	renewalCertificateIDProperty = "RenewalCertificateId"
+	// Properties of the CSR enrollment request that request the lifetime of the certificate from the CA
+	validityPeriodProperty      = "ValidityPeriod"
+	validityPeriodUnitsProperty = "ValidityPeriodUnits"
+	validityPeriodHours         = "Hours"
+	// Annotation of a request that selects the certificate authority from the allowlist of the issuer
+	certificateAuthorityAnnotation = "command-issuer.keyfactor.com/certificate-authority"
 )
 
+// enrollmentAnnotations are the annotations of a request that override the enrollment settings of
+// the issuer
+var enrollmentAnnotations = []string{
+	"command-issuer.keyfactor.com/certificateTemplate",
+	"command-issuer.keyfactor.com/certificateAuthorityLogicalName",
+	"command-issuer.keyfactor.com/certificateAuthorityHostname",
+	certificateAuthorityAnnotation,
+	changeReferenceAnnotation,
+}
+
+// IsEnrollmentAnnotation returns true if the annotation of a request changes how its CSR is enrolled
+// with Command, e.g. by selecting the certificate template or by setting a metadata field
+func IsEnrollmentAnnotation(key string) bool {
+	return strings.HasPrefix(key, commandMetadataAnnotationPrefix) || slices.Contains(enrollmentAnnotations, key)
+}
+
 type K8sMetadata struct {
 	ControllerNamespace                string
 	ControllerKind                     string
@@ -44,6 +75,19 @@ type K8sMetadata struct {
 	IssuerNamespace                    string
 	ControllerReconcileId              string
 	CertificateSigningRequestNamespace string
+	// RenewalCertificateID is the Command ID of the certificate renewed by the request. If zero,
+	// a new certificate is enrolled.
+	RenewalCertificateID int32
+	// Duration is the lifetime of the certificate requested by the request. If zero, the default
+	// duration of the issuer is requested, if any.
+	Duration time.Duration
+	// ClusterName identifies the cluster of the controller. If empty, it isn't recorded in Command.
+	ClusterName string
+	// IssuerMetadata maps Command metadata fields to the values of the labels and annotations of the
+	// issuer selected by its metadataFromLabels and metadataFromAnnotations fields
+	IssuerMetadata map[string]string
+	// IsCA requests a CA certificate, e.g. for the subordinate CA of a downstream issuer
+	IsCA bool
 }
 
 type commandSigner struct {
@@ -53,76 +97,254 @@ type commandSigner struct {
 	certificateAuthorityHostname    string
 	certManagerCertificateName      string
 	customMetadata                  map[string]interface{}
+	subjectPattern                  *regexp.Regexp
+	applySubjectPatternToSANs       bool
+	requireCommonName               bool
+	includeCommonNameInSANs         bool
+	allowedSANTypes                 map[commandissuer.SANType]bool
+	permittedDNSDomains             []string
+	changeReference                 *changeReference
+	additionalSANs                  *commandissuer.AdditionalSANs
+	keyPolicy                       *commandissuer.KeyPolicy
+	enrollmentParameters            map[string]string
+	extendedKeyUsageParameter       *extendedKeyUsageParameter
+	certificatePolicy               *commandissuer.RequiredCertificatePolicy
+	defaultDuration                 time.Duration
+	reauthenticate                  func(context.Context) (*keyfactor.APIClient, error)
+	// readClient authenticates with the separate read credentials of the issuer, if any
+	readClient *keyfactor.APIClient
+	// certificateAuthorityOverride is the annotation that overrode the certificate authority of the
+	// issuer, if any
+	certificateAuthorityOverride string
+	// allowedCertificateAuthorities holds the lower case certificate authorities that annotations may select
+	allowedCertificateAuthorities map[string]bool
+	// renewalMode determines how the certificate of K8sMetadata.RenewalCertificateID is renewed
+	renewalMode commandissuer.RenewalMode
+	// certificateCollection is the Command certificate collection that groups the enrolled certificates
+	certificateCollection string
+	// enrollmentFormat determines how the CSR is encoded in enrollment requests
+	enrollmentFormat commandissuer.EnrollmentFormat
+	// enrollmentRequestTemplate renders the body of enrollment requests instead of the built-in body if set
+	enrollmentRequestTemplate *template.Template
+	// allowCA allows requests for CA certificates, which are enrolled with caCertificateTemplate if set
+	allowCA               bool
+	caCertificateTemplate string
 }
 
+// ErrSubjectPatternMismatch is returned by Sign when the CSR doesn't conform to the
+// subject pattern configured on the issuer. Retrying the request won't succeed.
+var ErrSubjectPatternMismatch = errors.New("CSR does not match the issuer subject pattern")
+
+// ErrCommonNameRequired is returned by Sign when the CSR has no Common Name but the issuer
+// requires one. Retrying the request won't succeed.
+var ErrCommonNameRequired = errors.New("CSR has no Common Name, which is required by the issuer")
+
+// ErrAuthenticationFailed is returned by Sign when Command rejects the credentials, even after
+// re-authenticating, and by Check when Command rejects the credentials or they aren't allowed to
+// enroll CSRs. Retrying won't succeed until the credentials are changed.
+var ErrAuthenticationFailed = errors.New("authentication with Command failed")
+
+// ErrInvalidConfig is returned by the signer and health checker builders when the issuer spec or
+// its Secrets are invalid, e.g. because of missing credentials or a missing certificate template.
+// Retrying won't succeed until the issuer or its Secrets are changed.
+var ErrInvalidConfig = errors.New("invalid issuer configuration")
+
+// ErrTransient is returned by Check when Command can't be reached or fails to respond, e.g. because
+// of a network error or an HTTP 5xx response, and by Sign when Command can't be reached or is
+// overloaded. Retrying may succeed.
+var ErrTransient = errors.New("Command is temporarily unavailable")
+
+// ErrEnrollmentRejected is returned by Sign when Command permanently rejects the enrollment, e.g.
+// because the certificate template or certificate authority doesn't exist. Retrying the request
+// won't succeed.
+var ErrEnrollmentRejected = errors.New("enrollment rejected by Command")
+
+// ErrEnrollmentDenied is returned by Sign when Command denies the enrollment, e.g. by policy.
+// Retrying the request won't succeed.
+var ErrEnrollmentDenied = errors.New("enrollment denied by Command")
+
+// ErrServerGeneratedKey is returned by Sign when Command generated the private key of the certificate
+// and returned it with the certificate, e.g. because the certificate template generates keys
+// server-side. cert-manager generates the key of every certificate it requests, so the certificate
+// can't be used. Retrying the request won't succeed.
+var ErrServerGeneratedKey = fmt.Errorf("%w: Command returned a private key generated for the certificate. Configure the certificate template to enroll CSRs, since cert-manager generates the key of the certificate", ErrEnrollmentRejected)
+
+// ErrCertificateAuthorityNotAllowed is returned by Sign when an annotation of the request selects a
+// certificate authority that the issuer doesn't allow. Retrying the request won't succeed.
+var ErrCertificateAuthorityNotAllowed = errors.New("certificate authority is not allowed by the issuer")
+
+// Request dispositions of a Command CSR enrollment
+const (
+	dispositionIssued = "ISSUED"
+	dispositionDenied = "DENIED"
+)
+
 type HealthChecker interface {
-	Check() error
+	Check(context.Context) error
+	// CommandVersion returns the version of the Command instance
+	CommandVersion(context.Context) (string, error)
 }
 
 type HealthCheckerBuilder func(context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) (HealthChecker, error)
-type CommandSignerBuilder func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) (Signer, error)
+type CommandSignerBuilder func(context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) (Signer, error)
 
 type Signer interface {
-	Sign(context.Context, []byte, K8sMetadata) ([]byte, []byte, error)
+	// Sign enrolls the CSR and returns the certificate, the CA chain, and the Command ID of the certificate
+	Sign(context.Context, []byte, K8sMetadata) ([]byte, []byte, int32, error)
+	// PollEnrollment returns the certificate, the CA chain, and the Command ID of the certificate of an
+	// enrollment that Sign reported as pending approval, given the CSR, the Command request ID and the
+	// metadata the request was signed with
+	PollEnrollment(context.Context, []byte, int32, K8sMetadata) ([]byte, []byte, int32, error)
+}
+
+// EnrollmentTargetReporter is implemented by Signers that report the certificate template and the
+// certificate authority they enroll with, after the overrides of the request annotations
+type EnrollmentTargetReporter interface {
+	EnrollmentTarget() (certificateTemplate string, certificateAuthority string)
 }
 
 // CommandHealthCheckerFromIssuerAndSecretData creates a new HealthChecker instance using the provided issuer spec and secret data
 func CommandHealthCheckerFromIssuerAndSecretData(ctx context.Context, spec *commandissuer.IssuerSpec, authSecretData map[string][]byte, caSecretData map[string][]byte) (HealthChecker, error) {
-	signer := commandSigner{}
-
-	client, err := createCommandClientFromSecretData(ctx, spec, authSecretData, caSecretData)
+	signer, err := newCommandSigner(ctx, spec, authSecretData, nil, caSecretData)
 	if err != nil {
 		return nil, err
 	}
 
-	signer.client = client
+	signer.certificateCollection = spec.CertificateCollection
 
-	return &signer, nil
+	return signer, nil
 }
 
 // CommandSignerFromIssuerAndSecretData is a wrapper for commandSignerFromIssuerAndSecretData that returns a Signer interface
 // given the provided issuer spec and secret data
-func CommandSignerFromIssuerAndSecretData(ctx context.Context, spec *commandissuer.IssuerSpec, annotations map[string]string, authSecretData map[string][]byte, caSecretData map[string][]byte) (Signer, error) {
-	return commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, caSecretData)
+func CommandSignerFromIssuerAndSecretData(ctx context.Context, spec *commandissuer.IssuerSpec, annotations map[string]string, authSecretData map[string][]byte, readSecretData map[string][]byte, caSecretData map[string][]byte) (Signer, error) {
+	return commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, readSecretData, caSecretData)
 }
 
-// commandSignerFromIssuerAndSecretData creates a new Signer instance using the provided issuer spec and secret data
-func commandSignerFromIssuerAndSecretData(ctx context.Context, spec *commandissuer.IssuerSpec, annotations map[string]string, authSecretData map[string][]byte, caSecretData map[string][]byte) (*commandSigner, error) {
+// commandSignerFromIssuerAndSecretData creates a new Signer instance using the provided issuer spec and secret data.
+// Enrollments use the credentials in authSecretData. If readSecretData is not empty, its credentials are used to
+// poll pending enrollments instead.
+func commandSignerFromIssuerAndSecretData(ctx context.Context, spec *commandissuer.IssuerSpec, annotations map[string]string, authSecretData map[string][]byte, readSecretData map[string][]byte, caSecretData map[string][]byte) (*commandSigner, error) {
 	k8sLog := log.FromContext(ctx)
 
-	signer := commandSigner{}
-
-	client, err := createCommandClientFromSecretData(ctx, spec, authSecretData, caSecretData)
+	signer, err := newCommandSigner(ctx, spec, authSecretData, readSecretData, caSecretData)
 	if err != nil {
 		return nil, err
 	}
 
-	signer.client = client
-
 	if spec.CertificateTemplate == "" {
 		k8sLog.Error(errors.New("missing certificate template"), "missing certificate template")
-		return nil, errors.New("missing certificate template")
+		return nil, fmt.Errorf("%w: missing certificate template", ErrInvalidConfig)
 	}
 	signer.certificateTemplate = spec.CertificateTemplate
 
 	if spec.CertificateAuthorityLogicalName == "" {
 		k8sLog.Error(errors.New("missing certificate authority logical name"), "missing certificate authority logical name")
-		return nil, errors.New("missing certificate authority logical name")
+		return nil, fmt.Errorf("%w: missing certificate authority logical name", ErrInvalidConfig)
 	}
 	signer.certificateAuthorityLogicalName = spec.CertificateAuthorityLogicalName
 
 	// CA Hostname is optional
 	signer.certificateAuthorityHostname = spec.CertificateAuthorityHostname
 
+	if spec.SubjectPattern != "" {
+		signer.subjectPattern, err = regexp.Compile(spec.SubjectPattern)
+		if err != nil {
+			k8sLog.Error(err, "invalid subject pattern")
+			return nil, fmt.Errorf("%w: invalid subject pattern %q: %w", ErrInvalidConfig, spec.SubjectPattern, err)
+		}
+		signer.applySubjectPatternToSANs = spec.ApplySubjectPatternToSANs
+	}
+
+	signer.requireCommonName = spec.RequireCommonName
+	signer.includeCommonNameInSANs = spec.IncludeCommonNameInSANs
+
+	if len(spec.AllowedSANTypes) > 0 {
+		signer.allowedSANTypes = make(map[commandissuer.SANType]bool)
+		for _, sanType := range spec.AllowedSANTypes {
+			signer.allowedSANTypes[sanType] = true
+		}
+	}
+
+	signer.permittedDNSDomains = spec.PermittedDNSDomains
+
+	for name := range spec.EnrollmentParameters {
+		if commandissuer.IsReservedEnrollmentParameter(name) {
+			err = fmt.Errorf("%w: enrollment parameter %q is managed by the issuer and can't be overridden", ErrInvalidConfig, name)
+			k8sLog.Error(err, "invalid enrollment parameters")
+			return nil, err
+		}
+	}
+	signer.enrollmentParameters = spec.EnrollmentParameters
+
+	signer.extendedKeyUsageParameter, err = newExtendedKeyUsageParameter(spec.ExtendedKeyUsageParameter)
+	if err != nil {
+		k8sLog.Error(err, "invalid extended key usage parameter")
+		return nil, err
+	}
+
+	if err = validateRequiredCertificatePolicy(spec.RequiredCertificatePolicy); err != nil {
+		k8sLog.Error(err, "invalid required certificate policy")
+		return nil, err
+	}
+	signer.certificatePolicy = spec.RequiredCertificatePolicy
+
+	if spec.DefaultDuration != nil {
+		signer.defaultDuration = spec.DefaultDuration.Duration
+	}
+
+	signer.additionalSANs = spec.AdditionalSANs
+	signer.keyPolicy = spec.KeyPolicy
+	signer.certificateCollection = spec.CertificateCollection
+	signer.renewalMode = spec.RenewalMode
+	signer.allowCA = spec.AllowCA
+	signer.caCertificateTemplate = spec.CACertificateTemplate
+
+	switch spec.EnrollmentFormat {
+	case "", commandissuer.EnrollmentFormatPEM, commandissuer.EnrollmentFormatPKCS10:
+		signer.enrollmentFormat = spec.EnrollmentFormat
+	default:
+		err = fmt.Errorf("%w: unsupported enrollment format %q, must be %q or %q", ErrInvalidConfig, spec.EnrollmentFormat, commandissuer.EnrollmentFormatPEM, commandissuer.EnrollmentFormatPKCS10)
+		k8sLog.Error(err, "invalid enrollment format")
+		return nil, err
+	}
+
+	if spec.EnrollmentRequestTemplate != "" {
+		signer.enrollmentRequestTemplate, err = commandissuer.ParseEnrollmentRequestTemplate(spec.EnrollmentRequestTemplate)
+		if err != nil {
+			k8sLog.Error(err, "invalid enrollment request template")
+			return nil, fmt.Errorf("%w: invalid enrollment request template: %w", ErrInvalidConfig, err)
+		}
+	}
+
 	// Override defaults from annotations
 	if value, exists := annotations["command-issuer.keyfactor.com/certificateTemplate"]; exists {
+		// The template selected by the request is used for CA certificates as well
 		signer.certificateTemplate = value
+		signer.caCertificateTemplate = ""
 	}
 	if value, exists := annotations["command-issuer.keyfactor.com/certificateAuthorityLogicalName"]; exists {
 		signer.certificateAuthorityLogicalName = value
+		signer.certificateAuthorityOverride = "command-issuer.keyfactor.com/certificateAuthorityLogicalName"
 	}
 	if value, exists := annotations["command-issuer.keyfactor.com/certificateAuthorityHostname"]; exists {
 		signer.certificateAuthorityHostname = value
+		signer.certificateAuthorityOverride = "command-issuer.keyfactor.com/certificateAuthorityHostname"
+	}
+	// The certificate-authority annotation selects both the hostname and the logical name, and takes
+	// precedence over the annotations above
+	if value, exists := annotations[certificateAuthorityAnnotation]; exists {
+		signer.certificateAuthorityHostname, signer.certificateAuthorityLogicalName = commandissuer.SplitCertificateAuthority(value)
+		signer.certificateAuthorityOverride = certificateAuthorityAnnotation
+	}
+
+	if len(spec.AllowedCertificateAuthorities) > 0 {
+		signer.allowedCertificateAuthorities = make(map[string]bool)
+		for _, certificateAuthority := range spec.AllowedCertificateAuthorities {
+			signer.allowedCertificateAuthorities[strings.ToLower(certificateAuthority)] = true
+		}
+		// The certificate authority of the issuer itself is always allowed
+		signer.allowedCertificateAuthorities[strings.ToLower(formatCertificateAuthority(spec.CertificateAuthorityHostname, spec.CertificateAuthorityLogicalName))] = true
 	}
 
 	if value, exists := annotations["command-manager.io/certificate-name"]; exists {
@@ -133,6 +355,38 @@ func commandSignerFromIssuerAndSecretData(ctx context.Context, spec *commandissu
 
 	signer.customMetadata = extractMetadataFromAnnotations(annotations)
 
+	signer.changeReference, err = newChangeReference(spec.ChangeReference, annotations)
+	if err != nil {
+		k8sLog.Error(err, "invalid change reference")
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+// newCommandSigner returns a commandSigner with the Command clients of the issuer and no enrollment
+// settings. The health checker and the signer are both built with it, so that a health check
+// connects to Command with exactly the same hostnames, credentials, headers, CA bundle, proxy and
+// timeouts as an enrollment. If readSecretData is not empty, a second client is created with its
+// credentials to poll pending enrollments.
+func newCommandSigner(ctx context.Context, spec *commandissuer.IssuerSpec, authSecretData map[string][]byte, readSecretData map[string][]byte, caSecretData map[string][]byte) (*commandSigner, error) {
+	client, err := createCommandClientFromSecretData(ctx, spec, authSecretData, caSecretData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	signer := commandSigner{client: client}
+	signer.reauthenticate = func(ctx context.Context) (*keyfactor.APIClient, error) {
+		return createCommandClientFromSecretData(ctx, spec, authSecretData, caSecretData)
+	}
+
+	if len(readSecretData) > 0 {
+		signer.readClient, err = createCommandClientFromSecretData(ctx, spec, readSecretData, caSecretData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid read credentials: %w", ErrInvalidConfig, err)
+		}
+	}
+
 	return &signer, nil
 }
 
@@ -149,9 +403,11 @@ func extractMetadataFromAnnotations(annotations map[string]string) map[string]in
 	return metadata
 }
 
-// Check checks the health of the signer by verifying that the "POST /Enrollment/CSR" endpoint exists
-func (s *commandSigner) Check() error {
-	endpoints, _, err := s.client.StatusApi.StatusGetEndpoints(context.Background()).Execute()
+// Check checks the health of the signer by verifying that the "POST /Enrollment/CSR" endpoint exists,
+// and that the certificate collection of the issuer exists, if any. Errors are classified as
+// ErrAuthenticationFailed, ErrInvalidConfig, or ErrTransient.
+func (s *commandSigner) Check(ctx context.Context) error {
+	endpoints, resp, err := s.client.StatusApi.StatusGetEndpoints(ctx).Execute()
 	if err != nil {
 		detail := "failed to get endpoints from Keyfactor Command"
 
@@ -161,32 +417,100 @@ func (s *commandSigner) Check() error {
 			detail += fmt.Sprintf(" - %s", string(bodyError.Body()))
 		}
 
-		detail += fmt.Sprintf(" (%s)", err.Error())
-
-		return errors.New(detail)
+		// The error is wrapped so that callers can tell a short-circuited call apart
+		return fmt.Errorf("%w: %s (%w)", classifyCheckFailure(resp), detail, err)
 	}
 
 	for _, endpoint := range endpoints {
 		if strings.Contains(endpoint, "POST /Enrollment/CSR") {
-			return nil
+			return s.checkCertificateCollection(ctx)
 		}
 	}
 
-	return errors.New("missing \"POST /Enrollment/CSR\" endpoint")
+	return fmt.Errorf("%w: missing \"POST /Enrollment/CSR\" endpoint", ErrAuthenticationFailed)
+}
+
+// checkCertificateCollection verifies that the certificate collection of the issuer exists in Command.
+// If the Command user isn't allowed to read certificate collections, the collection isn't verified.
+func (s *commandSigner) checkCertificateCollection(ctx context.Context) error {
+	if s.certificateCollection == "" {
+		return nil
+	}
+
+	_, resp, err := s.client.CertificateCollectionApi.CertificateCollectionGetCollection1(ctx, s.certificateCollection).Execute()
+	if err == nil {
+		return nil
+	}
+
+	if resp != nil && resp.StatusCode == http.StatusForbidden {
+		log.FromContext(ctx).Info(fmt.Sprintf("Not allowed to read certificate collections from Command. Not verifying that the certificate collection %q exists.", s.certificateCollection))
+		return nil
+	}
+	if isPermanentFailure(resp) {
+		return fmt.Errorf("%w: certificate collection %q does not exist in Command", ErrInvalidConfig, s.certificateCollection)
+	}
+	return fmt.Errorf("%w: failed to get certificate collection %q from Keyfactor Command (%w)", classifyCheckFailure(resp), s.certificateCollection, err)
+}
+
+// classifyCheckFailure returns the sentinel error for a failed health check given the response of
+// Command, if any. Responses that don't indicate a permanent failure are considered transient.
+func classifyCheckFailure(resp *http.Response) error {
+	if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return ErrAuthenticationFailed
+	}
+	if isPermanentFailure(resp) {
+		return ErrInvalidConfig
+	}
+	return ErrTransient
+}
+
+// CommandVersion returns the version of the Command instance reported by the "GET /License" endpoint
+func (s *commandSigner) CommandVersion(ctx context.Context) (string, error) {
+	license, _, err := s.client.LicenseApi.LicenseGetCurrentLicense(ctx).Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the license from Keyfactor Command: %w", err)
+	}
+
+	version := license.GetKeyfactorVersion()
+	if version == "" {
+		return "", errors.New("Keyfactor Command did not report its version")
+	}
+	return version, nil
 }
 
 // Sign signs the provided CSR using the Keyfactor Command API
-func (s *commandSigner) Sign(ctx context.Context, csrBytes []byte, k8sMeta K8sMetadata) ([]byte, []byte, error) {
+func (s *commandSigner) Sign(ctx context.Context, csrBytes []byte, k8sMeta K8sMetadata) ([]byte, []byte, int32, error) {
 	k8sLog := log.FromContext(ctx)
 
+	// Oversized CSRs are rejected before they are parsed or sent to Command
+	limits := csrLimitsFromContext(ctx)
+	if err := limits.checkSize(csrBytes); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
 	csr, err := parseCSR(csrBytes)
 	if err != nil {
 		k8sLog.Error(err, "failed to parse CSR")
-		return nil, nil, err
+		return nil, nil, 0, err
+	}
+
+	if err = limits.checkSANs(csr); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	// CA certificates may be enrolled with another template, which the checks below apply to
+	if err = s.selectCATemplate(k8sMeta.IsCA); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
 	}
 
 	// Log the common metadata of the CSR
-	k8sLog.Info(fmt.Sprintf("Found CSR wtih Common Name %q and %d DNS SANs, %d IP SANs, and %d URI SANs", csr.Subject.CommonName, len(csr.DNSNames), len(csr.IPAddresses), len(csr.URIs)))
+	k8sLog.Info(fmt.Sprintf("Found CSR wtih Common Name %q and %d DNS SANs, %d IP SANs, %d URI SANs, and %d email SANs", csr.Subject.CommonName, len(csr.DNSNames), len(csr.IPAddresses), len(csr.URIs), len(csr.EmailAddresses)))
+
+	// Every attribute of the subject is sent to Command, since the CSR is enrolled unchanged
+	k8sLog.Info(fmt.Sprintf("CSR subject: %s", csr.Subject))
 
 	// Print the SANs
 	for _, dnsName := range csr.DNSNames {
@@ -201,9 +525,85 @@ func (s *commandSigner) Sign(ctx context.Context, csrBytes []byte, k8sMeta K8sMe
 		k8sLog.Info(fmt.Sprintf("URI SAN: %s", uri.String()))
 	}
 
+	for _, email := range csr.EmailAddresses {
+		k8sLog.Info(fmt.Sprintf("Email SAN: %s", email))
+	}
+
+	if err = checkKeyPolicy(csr, s.keyPolicy); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.checkCommonName(csr); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.checkSubjectPattern(csr); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.checkPermittedDNSDomains(csr); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.changeReference.check(); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	sans, sanTypes, err := subjectAltNames(csr)
+	if err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if s.includeCommonNameInSANs && addCommonNameSAN(sans, sanTypes, csr.Subject.CommonName) {
+		k8sLog.Info(fmt.Sprintf("Adding Common Name %q to the SANs", csr.Subject.CommonName))
+	}
+
+	// The additional SANs of the issuer are subject to the allowed SAN types like those of the CSR
+	addAdditionalSANs(sans, sanTypes, s.additionalSANs)
+
+	if err = s.checkAllowedSANTypes(sanTypes); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.checkCertificateAuthority(); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.checkSchema(ctx, k8sMeta); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if err = s.checkTemplateKeyType(ctx, csr); err != nil {
+		k8sLog.Error(err, "CSR rejected")
+		return nil, nil, 0, err
+	}
+
+	if k8sMeta.RenewalCertificateID != 0 && s.renewalMode == commandissuer.RenewalModeSameKey {
+		leaf, chain, certificateID, err := s.renewSameKey(ctx, csr, k8sMeta)
+		if !errors.Is(err, errRenewalKeyChanged) {
+			return leaf, chain, certificateID, err
+		}
+		// cert-manager rotated the key of the Certificate, so the CSR is enrolled with its key instead
+		k8sLog.Info(fmt.Sprintf("Not renewing with the previous key: %v. Enrolling the CSR as a renewal with a new key.", err))
+	}
+
+	// Command only returns the CA chain if it isn't cached for the CA and template of the request
+	chainCache := caChainCacheFromContext(ctx)
+	chainKey := s.caChainKey()
+	cachedChain, _ := chainCache.get(chainKey)
+
 	modelRequest := keyfactor.ModelsEnrollmentCSREnrollmentRequest{
-		CSR:          string(csrBytes),
-		IncludeChain: ptr(true),
+		CSR:          encodeCSR(csr, s.enrollmentFormat),
+		IncludeChain: ptr(cachedChain == nil),
 		Metadata: map[string]interface{}{
 			CommandMetaControllerNamespace:                k8sMeta.ControllerNamespace,
 			CommandMetaControllerKind:                     k8sMeta.ControllerKind,
@@ -217,28 +617,139 @@ func (s *commandSigner) Sign(ctx context.Context, csrBytes []byte, k8sMeta K8sMe
 		SANs:     nil,
 	}
 
+	// Forward the SANs explicitly so that every SAN type in the CSR is included in the certificate
+	if len(sans) > 0 {
+		modelRequest.SetSANs(sans)
+	}
+
+	if k8sMeta.ClusterName != "" {
+		modelRequest.Metadata[CommandMetaClusterName] = k8sMeta.ClusterName
+	}
+
+	// Command can't add the certificate to a collection, so the query of the collection selects it by metadata
+	if s.certificateCollection != "" {
+		modelRequest.Metadata[CommandMetaCertificateCollection] = s.certificateCollection
+	}
+
+	// Metadata of the issuer is added before the metadata annotations of the request, which take precedence
+	for metaName, value := range k8sMeta.IssuerMetadata {
+		k8sLog.Info(fmt.Sprintf("Adding issuer metadata %q with value %q", metaName, value))
+		modelRequest.Metadata[metaName] = value
+	}
+
 	for metaName, value := range s.customMetadata {
 		k8sLog.Info(fmt.Sprintf("Adding metadata %q with value %q", metaName, value))
 		modelRequest.Metadata[metaName] = value
 	}
 
-	var caBuilder strings.Builder
-	if s.certificateAuthorityHostname != "" {
-		caBuilder.WriteString(s.certificateAuthorityHostname)
-		caBuilder.WriteString("\\")
+	// The change reference takes precedence over a metadata annotation of the same field
+	s.changeReference.addMetadata(modelRequest.Metadata)
+
+	additionalProperties := make(map[string]interface{})
+
+	// Enrollment parameters are added verbatim. They can't contain properties managed by the issuer.
+	for name, value := range s.enrollmentParameters {
+		k8sLog.Info(fmt.Sprintf("Adding enrollment parameter %q with value %q", name, value))
+		additionalProperties[name] = value
 	}
-	caBuilder.WriteString(s.certificateAuthorityLogicalName)
 
-	modelRequest.SetCertificateAuthority(caBuilder.String())
+	if s.extendedKeyUsageParameter != nil {
+		value, ok, err := s.extendedKeyUsageParameter.value(csr)
+		if err != nil {
+			k8sLog.Error(err, "CSR rejected")
+			return nil, nil, 0, err
+		}
+		if ok {
+			k8sLog.Info(fmt.Sprintf("Adding enrollment parameter %q with value %q derived from the extended key usages", s.extendedKeyUsageParameter.name, value))
+			additionalProperties[s.extendedKeyUsageParameter.name] = value
+		}
+	}
+
+	// Certificate templates that support several certificate policies select one by a parameter
+	if s.certificatePolicy != nil && s.certificatePolicy.EnrollmentParameter != "" {
+		k8sLog.Info(fmt.Sprintf("Adding enrollment parameter %q with the required certificate policy %q", s.certificatePolicy.EnrollmentParameter, s.certificatePolicy.OID))
+		additionalProperties[s.certificatePolicy.EnrollmentParameter] = s.certificatePolicy.OID
+	}
+
+	// Renew the certificate previously enrolled for the request to preserve its lineage in Command
+	if k8sMeta.RenewalCertificateID != 0 {
+		k8sLog.Info(fmt.Sprintf("Renewing certificate with Command ID %d", k8sMeta.RenewalCertificateID))
+		additionalProperties[renewalCertificateIDProperty] = k8sMeta.RenewalCertificateID
+	}
+
+	// The lifetime requested by the request takes precedence over the default of the issuer
+	duration := k8sMeta.Duration
+	if duration <= 0 {
+		duration = s.defaultDuration
+	}
+	if duration > 0 {
+		k8sLog.Info(fmt.Sprintf("Requesting a certificate lifetime of %s", duration))
+		additionalProperties[validityPeriodProperty] = validityPeriodHours
+		additionalProperties[validityPeriodUnitsProperty] = validityPeriodUnits(duration)
+	}
+
+	if len(additionalProperties) > 0 {
+		modelRequest.AdditionalProperties = additionalProperties
+	}
+
+	modelRequest.SetCertificateAuthority(formatCertificateAuthority(s.certificateAuthorityHostname, s.certificateAuthorityLogicalName))
 	modelRequest.SetTimestamp(time.Now())
 
-	commandCsrResponseObject, _, err := s.client.EnrollmentApi.EnrollmentPostCSREnroll(context.Background()).Request(modelRequest).XCertificateformat(enrollmentPEMFormat).Execute()
+	if s.enrollmentRequestTemplate != nil {
+		modelRequest, err = s.renderEnrollmentRequest(modelRequest, csr)
+		if err != nil {
+			k8sLog.Error(err, "failed to render the enrollment request template")
+			return nil, nil, 0, err
+		}
+		k8sLog.Info("Rendered the enrollment request from the enrollment request template of the issuer")
+	}
+
+	release, err := EnterEnrollmentGate(ctx)
+	if err != nil {
+		k8sLog.Info(fmt.Sprintf("Not enrolling: %v", err))
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	commandCsrResponseObject, httpResponse, err := s.enroll(ctx, modelRequest)
+	if isUnauthorized(httpResponse) {
+		// The session may have been invalidated, e.g. by a credential rotation. Re-authenticate once
+		// and retry the enrollment before giving up.
+		k8sLog.Info("Command returned HTTP 401. Re-authenticating and retrying the enrollment.")
+
+		if err = s.refreshClient(ctx); err != nil {
+			err = fmt.Errorf("%w: failed to re-authenticate: %v", ErrAuthenticationFailed, err)
+			k8sLog.Error(err, "failed to re-authenticate with Command")
+			return nil, nil, 0, err
+		}
+
+		commandCsrResponseObject, httpResponse, err = s.enroll(ctx, modelRequest)
+		if isUnauthorized(httpResponse) {
+			err = fmt.Errorf("%w: Command returned HTTP 401 after re-authenticating. Verify that the credentials in the issuer secret are valid", ErrAuthenticationFailed)
+			k8sLog.Error(err, "failed to enroll certificate with Command")
+			return nil, nil, 0, err
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		// The reconcile was cancelled, e.g. because the controller is shutting down
+		k8sLog.Error(err, "enrollment with Command was aborted")
+		return nil, nil, 0, fmt.Errorf("enrollment with Command was aborted: %w", ctx.Err())
+	}
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		// Command is known to be down, so the details of the enrollment are irrelevant
+		k8sLog.Info(fmt.Sprintf("Not enrolling: %v", circuitErr))
+		return nil, nil, 0, circuitErr
+	}
 	if err != nil {
 		detail := fmt.Sprintf("error enrolling certificate with Command. Verify that the certificate template %q exists and that the certificate authority %q (%s) is configured correctly.", s.certificateTemplate, s.certificateAuthorityLogicalName, s.certificateAuthorityHostname)
 
 		if len(s.customMetadata) > 0 {
 			detail += " Also verify that the metadata fields provided exist in Command."
 		}
+		if duration > 0 {
+			detail += fmt.Sprintf(" Also verify that the requested lifetime of %s doesn't exceed the maximum validity period of the certificate template.", duration)
+		}
 
 		var bodyError *keyfactor.GenericOpenAPIError
 		ok := errors.As(err, &bodyError)
@@ -248,32 +759,262 @@ func (s *commandSigner) Sign(ctx context.Context, csrBytes []byte, k8sMeta K8sMe
 
 		k8sLog.Error(err, detail)
 
-		return nil, nil, fmt.Errorf(detail)
+		if isPermanentFailure(httpResponse) {
+			return nil, nil, 0, fmt.Errorf("%w (HTTP %d): %s", ErrEnrollmentRejected, httpResponse.StatusCode, detail)
+		}
+		if isTransientFailure(httpResponse) {
+			return nil, nil, 0, fmt.Errorf("%w: %s", ErrTransient, detail)
+		}
+		return nil, nil, 0, fmt.Errorf(detail)
+	}
+
+	if err = checkRequestDisposition(commandCsrResponseObject.CertificateInformation); err != nil {
+		if errors.Is(err, ErrEnrollmentPending) {
+			k8sLog.Info(fmt.Sprintf("Command did not issue the certificate yet: %v", err))
+			return nil, nil, 0, err
+		}
+		k8sLog.Error(err, "Command did not issue the certificate")
+		return nil, nil, 0, err
 	}
 
 	certAndChain, err := getCertificatesFromCertificateInformation(commandCsrResponseObject.CertificateInformation)
+	if errors.Is(err, ErrServerGeneratedKey) {
+		// The certificate is bound to a key that only Command knows, so it must not remain valid
+		k8sLog.Error(err, fmt.Sprintf("Command generated the key of the certificate. Verify that certificate template %q enrolls CSRs.", s.certificateTemplate))
+		return nil, nil, 0, s.rejectIssuedCertificate(ctx, commandCsrResponseObject.CertificateInformation.GetKeyfactorID(), err)
+	}
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
+	}
+	if len(certAndChain) == 0 {
+		return nil, nil, 0, errors.New("Command did not return a certificate")
+	}
+
+	if k8sMeta.IsCA {
+		if err = checkIssuedCA(certAndChain[0], s.certificateTemplate); err != nil {
+			k8sLog.Error(err, "Command did not issue a CA certificate")
+			return nil, nil, 0, s.rejectIssuedCertificate(ctx, commandCsrResponseObject.CertificateInformation.GetKeyfactorID(), err)
+		}
+	}
+
+	certAndChain = s.chainWithCachedCA(ctx, chainCache, chainKey, cachedChain, certAndChain, commandCsrResponseObject.CertificateInformation.GetKeyfactorID())
+
+	// Command doesn't expose the maximum validity period of a template, so a lifetime exceeding it is
+	// only detected once the CA has shortened the certificate
+	if lifetime := certAndChain[0].NotAfter.Sub(certAndChain[0].NotBefore); duration > 0 && lifetime < duration-time.Hour {
+		k8sLog.Info(fmt.Sprintf("WARNING: Command issued a certificate valid for %s, which is shorter than the requested lifetime of %s. The requested lifetime may exceed the maximum validity period of certificate template %q.", lifetime.Round(time.Second), duration, s.certificateTemplate))
+	}
+
+	if differences := subjectDifferences(csr.Subject, certAndChain[0].Subject); len(differences) > 0 {
+		k8sLog.Info(fmt.Sprintf("Command issued the certificate with another subject than the CSR, which is usually enforced by certificate template %q or the CA: %s", s.certificateTemplate, strings.Join(differences, "; ")))
 	}
 
 	k8sLog.Info(fmt.Sprintf("Successfully enrolled certificate with Command with subject %q. Certificate has %d SANs", certAndChain[0].Subject, len(certAndChain[0].DNSNames)+len(certAndChain[0].IPAddresses)+len(certAndChain[0].URIs)))
 
 	// Return the certificate and chain in PEM format
-	return compileCertificatesToPemBytes(certAndChain)
+	leaf, chain, err := compileCertificatesToPemBytes(certAndChain)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return leaf, chain, commandCsrResponseObject.CertificateInformation.GetKeyfactorID(), nil
+}
+
+// enroll submits the CSR enrollment request to Command
+func (s *commandSigner) enroll(ctx context.Context, modelRequest keyfactor.ModelsEnrollmentCSREnrollmentRequest) (*keyfactor.ModelsEnrollmentCSREnrollmentResponse, *http.Response, error) {
+	return s.client.EnrollmentApi.EnrollmentPostCSREnroll(ctx).Request(modelRequest).XCertificateformat(enrollmentPEMFormat).Execute()
+}
+
+// readAPIClient returns the client used for read-only operations, which authenticates with the
+// read credentials of the issuer if it has any
+func (s *commandSigner) readAPIClient() *keyfactor.APIClient {
+	if s.readClient != nil {
+		return s.readClient
+	}
+	return s.client
+}
+
+// refreshClient discards any session cached by the current Command client and replaces the
+// client with a newly authenticated one
+func (s *commandSigner) refreshClient(ctx context.Context) error {
+	if config := s.client.GetConfig(); config != nil && config.HTTPClient != nil {
+		config.HTTPClient.CloseIdleConnections()
+	}
+
+	if s.reauthenticate == nil {
+		return errors.New("re-authentication is not supported by this signer")
+	}
+
+	client, err := s.reauthenticate(ctx)
+	if err != nil {
+		return err
+	}
+	s.client = client
+
+	return nil
+}
+
+// isUnauthorized returns true if Command rejected the request with HTTP 401
+func isUnauthorized(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusUnauthorized
+}
+
+// isPermanentFailure returns true if Command rejected the request with an HTTP status that won't
+// change when the request is retried. Authentication failures, timeouts, rate limiting and server
+// errors are considered transient.
+func isPermanentFailure(resp *http.Response) bool {
+	if resp == nil || resp.StatusCode < http.StatusBadRequest || resp.StatusCode >= http.StatusInternalServerError {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// isTransientFailure returns true if Command didn't respond to the request, or responded with an
+// HTTP status indicating that it is temporarily unavailable or overloaded. Other server errors may be
+// caused by the request itself, e.g. a CSR that the certificate template rejects.
+func isTransientFailure(resp *http.Response) bool {
+	if resp == nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// checkRequestDisposition verifies that Command issued the certificate. Enrollments that are denied
+// or failed in Command won't be issued by retrying the request. Enrollments that are awaiting approval
+// return an *EnrollmentPendingError.
+func checkRequestDisposition(info *keyfactor.ModelsPkcs10CertificateResponse) error {
+	if info == nil {
+		return errors.New("Command did not return certificate information")
+	}
+
+	disposition := strings.ToUpper(info.GetRequestDisposition())
+	switch disposition {
+	case "", dispositionIssued:
+		return nil
+	case dispositionDenied:
+		return fmt.Errorf("%w: %s", ErrEnrollmentDenied, info.GetDispositionMessage())
+	case dispositionPending, dispositionExternalValidation:
+		if info.GetKeyfactorRequestId() == 0 {
+			return fmt.Errorf("%w: enrollment is awaiting approval but Command did not return a request ID: %s", ErrEnrollmentRejected, info.GetDispositionMessage())
+		}
+		return &EnrollmentPendingError{RequestID: info.GetKeyfactorRequestId(), Message: info.GetDispositionMessage()}
+	default:
+		return fmt.Errorf("%w: request disposition is %q: %s", ErrEnrollmentRejected, disposition, info.GetDispositionMessage())
+	}
+}
+
+// checkCommonName verifies that the CSR has a Common Name if the issuer requires one. The Common
+// Name can't be added to the CSR since it is signed by the requester, so the error suggests a value.
+func (s *commandSigner) checkCommonName(csr *x509.CertificateRequest) error {
+	if !s.requireCommonName || csr.Subject.CommonName != "" {
+		return nil
+	}
+
+	if len(csr.DNSNames) > 0 {
+		return fmt.Errorf("%w: set the Common Name of the Certificate, e.g. to its first DNS SAN %q", ErrCommonNameRequired, csr.DNSNames[0])
+	}
+	return fmt.Errorf("%w: set the Common Name of the Certificate", ErrCommonNameRequired)
+}
+
+// checkCertificateAuthority verifies that a certificate authority selected by an annotation of the
+// request is allowed by the issuer. The certificate-authority annotation requires an allowlist. The
+// older certificateAuthorityLogicalName and certificateAuthorityHostname annotations are only
+// restricted if the issuer has an allowlist.
+func (s *commandSigner) checkCertificateAuthority() error {
+	if s.certificateAuthorityOverride == "" {
+		return nil
+	}
+
+	certificateAuthority := formatCertificateAuthority(s.certificateAuthorityHostname, s.certificateAuthorityLogicalName)
+	if len(s.allowedCertificateAuthorities) == 0 {
+		if s.certificateAuthorityOverride == certificateAuthorityAnnotation {
+			return fmt.Errorf("%w: the %q annotation selects certificate authority %q, but the issuer has no allowedCertificateAuthorities", ErrCertificateAuthorityNotAllowed, s.certificateAuthorityOverride, certificateAuthority)
+		}
+		return nil
+	}
+
+	if !s.allowedCertificateAuthorities[strings.ToLower(certificateAuthority)] {
+		return fmt.Errorf("%w: the %q annotation selects certificate authority %q, which is not in the allowedCertificateAuthorities of the issuer", ErrCertificateAuthorityNotAllowed, s.certificateAuthorityOverride, certificateAuthority)
+	}
+	return nil
+}
+
+// EnrollmentTarget implements EnrollmentTargetReporter
+func (s *commandSigner) EnrollmentTarget() (string, string) {
+	return s.certificateTemplate, formatCertificateAuthority(s.certificateAuthorityHostname, s.certificateAuthorityLogicalName)
+}
+
+// formatCertificateAuthority returns the certificate authority in the format expected by Command
+func formatCertificateAuthority(hostname, logicalName string) string {
+	if hostname == "" {
+		return logicalName
+	}
+	return hostname + "\\" + logicalName
+}
+
+// checkSubjectPattern verifies that the CSR Common Name, and optionally its SANs, match the
+// subject pattern configured on the issuer. If no pattern is configured, every CSR conforms.
+func (s *commandSigner) checkSubjectPattern(csr *x509.CertificateRequest) error {
+	if s.subjectPattern == nil {
+		return nil
+	}
+
+	if !s.subjectPattern.MatchString(csr.Subject.CommonName) {
+		return fmt.Errorf("%w: common name %q does not match pattern %q", ErrSubjectPatternMismatch, csr.Subject.CommonName, s.subjectPattern.String())
+	}
+
+	if !s.applySubjectPatternToSANs {
+		return nil
+	}
+
+	var sans []string
+	sans = append(sans, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, csr.EmailAddresses...)
+
+	for _, san := range sans {
+		if !s.subjectPattern.MatchString(san) {
+			return fmt.Errorf("%w: SAN %q does not match pattern %q", ErrSubjectPatternMismatch, san, s.subjectPattern.String())
+		}
+	}
+
+	return nil
 }
 
 // getCertificatesFromCertificateInformation takes a keyfactor.ModelsPkcs10CertificateResponse object and
-// returns a slice of x509 certificates
+// returns a slice of x509 certificates. If the response contains a private key, ErrServerGeneratedKey is
+// returned and the key is discarded.
 func getCertificatesFromCertificateInformation(commandResp *keyfactor.ModelsPkcs10CertificateResponse) ([]*x509.Certificate, error) {
 	var certBytes []byte
 
 	for _, cert := range commandResp.Certificates {
-		block, _ := pem.Decode([]byte(cert))
+		block, rest := pem.Decode([]byte(cert))
 		if block == nil {
 			return nil, errors.New("failed to parse certificate PEM")
 		}
 
-		certBytes = append(certBytes, block.Bytes...)
+		for ; block != nil; block, rest = pem.Decode(rest) {
+			if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+				clear(block.Bytes)
+				return nil, ErrServerGeneratedKey
+			}
+			certBytes = append(certBytes, block.Bytes...)
+		}
 	}
 
 	certs, err := x509.ParseCertificates(certBytes)
@@ -321,32 +1062,104 @@ const (
 	CommandMetaIssuerNamespace                    = "Issuer-Namespace"
 	CommandMetaControllerReconcileId              = "Controller-Reconcile-Id"
 	CommandMetaCertificateSigningRequestNamespace = "Certificate-Signing-Request-Namespace"
+	// CommandMetaClusterName is only recorded if the controller is configured with a cluster name
+	CommandMetaClusterName = "Cluster-Name"
+	// CommandMetaCertificateCollection is only recorded if the issuer has a certificate collection
+	CommandMetaCertificateCollection = "Certificate-Collection"
 )
 
+// Keys of the Secrets of an issuer that hold the Command credentials, unless overridden by the
+// usernameKey and passwordKey fields of the issuer
+const (
+	DefaultUsernameKey = "username"
+	DefaultPasswordKey = "password"
+)
+
+// ErrMissingCredentials is returned when a Secret of the issuer doesn't contain the Command credentials
+// or hostname under the configured keys
+var ErrMissingCredentials = errors.New("missing Command credentials")
+
+// CredentialSecretKeys returns the keys of the Secrets of the issuer that hold the Command username
+// and password
+func CredentialSecretKeys(spec *commandissuer.IssuerSpec) (string, string) {
+	usernameKey, passwordKey := DefaultUsernameKey, DefaultPasswordKey
+	if spec.UsernameKey != "" {
+		usernameKey = spec.UsernameKey
+	}
+	if spec.PasswordKey != "" {
+		passwordKey = spec.PasswordKey
+	}
+	return usernameKey, passwordKey
+}
+
+// DefaultHostnameKey is the key of the ConfigMap referenced by hostnameConfigMapName that holds the
+// hostname of the Command instance, unless overridden by the hostnameKey field of the issuer
+const DefaultHostnameKey = "hostname"
+
+// CommandHostname returns the hostname of the Command instance of the issuer, which is read from the
+// given Secret data if the issuer sets hostnameKey. The hostname field of the issuer is used if the
+// Secret has no such key.
+func CommandHostname(spec *commandissuer.IssuerSpec, authSecretData map[string][]byte) (string, error) {
+	if spec.HostnameKey == "" {
+		return spec.Hostname, nil
+	}
+
+	if hostname := string(authSecretData[spec.HostnameKey]); hostname != "" {
+		return hostname, nil
+	}
+	if spec.Hostname != "" {
+		return spec.Hostname, nil
+	}
+	return "", fmt.Errorf("%w: the Secret has no hostname in the %q key", ErrMissingCredentials, spec.HostnameKey)
+}
+
+// commandHost returns the host and port of the Command instance at hostname, as used in the URLs of
+// requests to Command. The hostname may include a scheme, which is ignored.
+func commandHost(hostname string) string {
+	if !strings.HasPrefix(hostname, "http://") && !strings.HasPrefix(hostname, "https://") {
+		hostname = "https://" + hostname
+	}
+	if u, err := url.Parse(hostname); err == nil {
+		return u.Host
+	}
+	return hostname
+}
+
 // createCommandClientFromSecretData creates a new Keyfactor Command client using the provided issuer spec and secret data
 func createCommandClientFromSecretData(ctx context.Context, spec *commandissuer.IssuerSpec, authSecretData map[string][]byte, caSecretData map[string][]byte) (*keyfactor.APIClient, error) {
 	k8sLogger := log.FromContext(ctx)
 
 	// Get username and password from secretData which contains key value pairs of a kubernetes.io/basic-auth secret
-	username := string(authSecretData["username"])
+	usernameKey, passwordKey := CredentialSecretKeys(spec)
+	username := string(authSecretData[usernameKey])
 	if username == "" {
-		k8sLogger.Error(errors.New("missing username"), "missing username")
-		return nil, errors.New("missing username")
+		err := fmt.Errorf("%w: the Secret has no username in the %q key", ErrMissingCredentials, usernameKey)
+		k8sLogger.Error(err, "missing username")
+		return nil, err
 	}
-	password := string(authSecretData["password"])
+	password := string(authSecretData[passwordKey])
 	if password == "" {
-		k8sLogger.Error(errors.New("missing password"), "missing password")
-		return nil, errors.New("missing password")
+		err := fmt.Errorf("%w: the Secret has no password in the %q key", ErrMissingCredentials, passwordKey)
+		k8sLogger.Error(err, "missing password")
+		return nil, err
+	}
+
+	hostname, err := CommandHostname(spec, authSecretData)
+	if err != nil {
+		k8sLogger.Error(err, "missing hostname")
+		return nil, err
 	}
 
 	keyfactorConfig := make(map[string]string)
 
-	// Set username and password for the Keyfactor client
+	// Pass the remaining keys of the secret, e.g. the domain, to the Keyfactor client
 	for key, value := range authSecretData {
 		keyfactorConfig[key] = string(value)
 	}
-	// Set the hostname for the Keyfactor client
-	keyfactorConfig["host"] = spec.Hostname
+	// Set username, password and hostname for the Keyfactor client
+	keyfactorConfig["username"] = username
+	keyfactorConfig["password"] = password
+	keyfactorConfig["host"] = hostname
 
 	config := keyfactor.NewConfiguration(keyfactorConfig)
 	if config == nil {
@@ -354,34 +1167,66 @@ func createCommandClientFromSecretData(ctx context.Context, spec *commandissuer.
 		return nil, errors.New("failed to create Keyfactor configuration")
 	}
 
-	// Set the user agent for the Keyfactor client
-	config.UserAgent = "command-issuer"
+	// Identify the issuer and its version to Command, e.g. for auditing
+	config.UserAgent = userAgentFromContext(ctx)
 
-	// If the CA certificate is provided, add it to the EJBCA configuration
+	// Attach the static headers of the issuer, e.g. the API key of a gateway in front of Command
+	headers, err := requestHeaders(ctx, spec, authSecretData)
+	if err != nil {
+		k8sLogger.Error(err, "invalid request headers")
+		return nil, err
+	}
+	for name, value := range headers {
+		config.AddDefaultHeader(name, value)
+	}
+
+	// Attach the request ID to every call so that Command logs can be correlated with the controller logs
+	if header, id, ok := requestIDHeaderFromContext(ctx); ok {
+		config.AddDefaultHeader(header, id)
+		k8sLogger.Info(fmt.Sprintf("Sending request ID %q to Command in the %q header", id, header))
+	}
+
+	// If the CA certificate is provided, trust it instead of the system roots
+	var caChain []*x509.Certificate
 	if len(caSecretData) > 0 {
 		// There is no requirement that the CA certificate is stored under a specific key in the secret, so we can just iterate over the map
 		var caCertBytes []byte
 		for _, caCertBytes = range caSecretData {
 		}
 
-		// Try to decode caCertBytes as a PEM formatted block
-		caChainBlocks, _ := decodePEMBytes(caCertBytes)
-		if caChainBlocks != nil {
-			var caChain []*x509.Certificate
-			for _, block := range caChainBlocks {
-				// Parse the PEM block into an x509 certificate
-				cert, err := x509.ParseCertificate(block.Bytes)
-				if err != nil {
-					return nil, err
-				}
+		caChain, err = parseCACertificates(caCertBytes)
+		if err != nil {
+			return nil, err
+		}
+	} else if config.CaCertificatePath != "" {
+		// The Keyfactor client also reads a CA bundle from the path in KEYFACTOR_CA_CERTIFICATE_PATH
+		caCertBytes, err := os.ReadFile(config.CaCertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA certificate at %s: %w", config.CaCertificatePath, err)
+		}
 
-				caChain = append(caChain, cert)
-			}
+		caChain, err = parseCACertificates(caCertBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.InsecureSkipVerify {
+		k8sLogger.Info("WARNING: TLS certificate verification of Command is DISABLED. The connection to Command is not secure and credentials may be intercepted. Never use insecureSkipVerify in production.", "hostname", hostname)
+	}
 
-			config.SetCaCertificates(caChain)
+	// Requests fail over to the fallback hostnames of the issuer in order
+	var hosts []string
+	if len(spec.FallbackHostnames) > 0 {
+		hosts = append(hosts, commandHost(hostname))
+		for _, fallback := range spec.FallbackHostnames {
+			hosts = append(hosts, commandHost(fallback))
 		}
 	}
 
+	// Clients share their transport with the clients of previous reconciles to reuse idle connections
+	config.HTTPClient = newHTTPClient(ctx, caChain, spec.InsecureSkipVerify, hosts)
+
 	client := keyfactor.NewAPIClient(config)
 	if client == nil {
 		k8sLogger.Error(errors.New("failed to create Keyfactor client"), "failed to create Keyfactor client")
@@ -393,6 +1238,24 @@ func createCommandClientFromSecretData(ctx context.Context, spec *commandissuer.
 	return client, nil
 }
 
+// parseCACertificates parses the PEM-encoded CA certificates of a CA bundle
+func parseCACertificates(caCertBytes []byte) ([]*x509.Certificate, error) {
+	caChainBlocks, _ := decodePEMBytes(caCertBytes)
+
+	var caChain []*x509.Certificate
+	for _, block := range caChainBlocks {
+		// Parse the PEM block into an x509 certificate
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		caChain = append(caChain, cert)
+	}
+
+	return caChain, nil
+}
+
 // decodePEMBytes takes a byte array containing PEM encoded data and returns a slice of PEM blocks and a private key PEM block
 func decodePEMBytes(buf []byte) ([]*pem.Block, *pem.Block) {
 	var privKey *pem.Block
@@ -411,14 +1274,10 @@ func decodePEMBytes(buf []byte) ([]*pem.Block, *pem.Block) {
 	return certificates, privKey
 }
 
-// parseCSR takes a byte array containing a PEM encoded CSR and returns a x509.CertificateRequest object
-func parseCSR(pemBytes []byte) (*x509.CertificateRequest, error) {
-	// extract PEM from request object
-	block, _ := pem.Decode(pemBytes)
-	if block == nil || block.Type != "CERTIFICATE REQUEST" {
-		return nil, errors.New("PEM block type must be CERTIFICATE REQUEST")
-	}
-	return x509.ParseCertificateRequest(block.Bytes)
+// validityPeriodUnits returns the number of hours requested for a certificate lifetime, rounded up
+// since Command only accepts whole units
+func validityPeriodUnits(duration time.Duration) int64 {
+	return int64((duration + time.Hour - 1) / time.Hour)
 }
 
 // generateRandomString generates a random string of the specified length
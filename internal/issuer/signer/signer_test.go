@@ -24,15 +24,23 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
 	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -52,7 +60,7 @@ func TestCommandHealthCheckerFromIssuerAndSecretData(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = builder.Check()
+	err = builder.Check(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,7 +94,7 @@ func TestCommandSignerFromIssuerAndSecretData(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		leaf, chain, err := signer.Sign(context.Background(), csr, meta)
+		leaf, chain, _, err := signer.Sign(context.Background(), csr, meta)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -120,7 +128,7 @@ func TestCommandSignerFromIssuerAndSecretData(t *testing.T) {
 		templateCopy := spec.CertificateTemplate
 		spec.CertificateTemplate = ""
 		// Create the signer
-		_, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, caSecretData)
+		_, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, nil, caSecretData)
 		if err == nil {
 			t.Errorf("expected error, got nil")
 		}
@@ -132,7 +140,7 @@ func TestCommandSignerFromIssuerAndSecretData(t *testing.T) {
 		logicalNameCopy := spec.CertificateAuthorityLogicalName
 		spec.CertificateAuthorityLogicalName = ""
 		// Create the signer
-		_, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, caSecretData)
+		_, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, nil, caSecretData)
 		if err == nil {
 			t.Errorf("expected error, got nil")
 		}
@@ -140,68 +148,1443 @@ func TestCommandSignerFromIssuerAndSecretData(t *testing.T) {
 		spec.CertificateAuthorityLogicalName = logicalNameCopy
 	})
 
+	t.Run("InvalidSubjectPattern", func(t *testing.T) {
+		spec.SubjectPattern = "^(unterminated"
+		// Create the signer
+		_, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, nil, caSecretData)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		spec.SubjectPattern = ""
+	})
+
 	t.Run("NoAnnotations", func(t *testing.T) {
 		// Create the signer
-		signer, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, caSecretData)
+		signer, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, make(map[string]string), authSecretData, nil, caSecretData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// If there are no annotations, the customMetadata map should be empty
+		if len(signer.customMetadata) != 0 {
+			t.Errorf("expected customMetadata to be empty, got %v", signer.customMetadata)
+		}
+	})
+
+	t.Run("MetadataAnnotations", func(t *testing.T) {
+		annotations := map[string]string{
+			commandMetadataAnnotationPrefix + "key1": "value1",
+			commandMetadataAnnotationPrefix + "key2": "value2",
+		}
+
+		// Create the signer
+		signer, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, annotations, authSecretData, nil, caSecretData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// If there are no annotations, the customMetadata map should be empty
+		if len(signer.customMetadata) != 2 {
+			t.Errorf("expected customMetadata to have 2 entries, got %v", signer.customMetadata)
+		}
+
+		if value, ok := signer.customMetadata["key1"].(string); ok && value == "value1" {
+			// They are equal
+		} else {
+			t.Errorf("expected customMetadata key1 to be value1, got %v", signer.customMetadata["key1"])
+		}
+
+		if value, ok := signer.customMetadata["key2"].(string); ok && value == "value2" {
+			// They are equal
+		} else {
+			t.Errorf("expected customMetadata key1 to be value1, got %v", signer.customMetadata["key1"])
+		}
+	})
+
+	t.Run("AnnotationDefaultOverrides", func(t *testing.T) {
+		annotations := map[string]string{
+			"command-issuer.keyfactor.com/certificateTemplate":             "TestCertificateTemplate",
+			"command-issuer.keyfactor.com/certificateAuthorityLogicalName": "TestCertificateAuthorityLogicalName",
+			"command-issuer.keyfactor.com/certificateAuthorityHostname":    "TestCertificateAuthorityHostname",
+			"command-manager.io/certificate-name":                          "TestCertificateName",
+		}
+
+		// Create the signer
+		signer, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, annotations, authSecretData, nil, caSecretData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "TestCertificateTemplate", signer.certificateTemplate)
+		assert.Equal(t, "TestCertificateAuthorityLogicalName", signer.certificateAuthorityLogicalName)
+		assert.Equal(t, "TestCertificateAuthorityHostname", signer.certificateAuthorityHostname)
+		assert.Equal(t, "TestCertificateName", signer.certManagerCertificateName)
+	})
+}
+
+func TestCheckSubjectPattern(t *testing.T) {
+	tests := []struct {
+		name          string
+		pattern       string
+		applyToSANs   bool
+		commonName    string
+		dnsNames      []string
+		expectedError bool
+	}{
+		{
+			name:       "No pattern",
+			commonName: "anything.example.org",
+		},
+		{
+			name:       "Conforming common name",
+			pattern:    `^[a-z0-9-]+\.example\.com$`,
+			commonName: "app-1.example.com",
+			dnsNames:   []string{"other.example.org"},
+		},
+		{
+			name:          "Non-conforming common name",
+			pattern:       `^[a-z0-9-]+\.example\.com$`,
+			commonName:    "app-1.example.org",
+			expectedError: true,
+		},
+		{
+			name:        "Conforming SANs",
+			pattern:     `^[a-z0-9-]+\.example\.com$`,
+			applyToSANs: true,
+			commonName:  "app-1.example.com",
+			dnsNames:    []string{"app-1.example.com", "app-2.example.com"},
+		},
+		{
+			name:          "Non-conforming SAN",
+			pattern:       `^[a-z0-9-]+\.example\.com$`,
+			applyToSANs:   true,
+			commonName:    "app-1.example.com",
+			dnsNames:      []string{"app-1.example.com", "app-2.example.org"},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := commandSigner{applySubjectPatternToSANs: tt.applyToSANs}
+			if tt.pattern != "" {
+				signer.subjectPattern = regexp.MustCompile(tt.pattern)
+			}
+
+			csr := &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: tt.commonName},
+				DNSNames: tt.dnsNames,
+			}
+
+			err := signer.checkSubjectPattern(csr)
+			if tt.expectedError {
+				assert.ErrorIs(t, err, ErrSubjectPatternMismatch)
+				assert.Contains(t, err.Error(), fmt.Sprintf("%q", tt.pattern))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckCommonName(t *testing.T) {
+	tests := []struct {
+		name              string
+		requireCommonName bool
+		commonName        string
+		dnsNames          []string
+		expectedError     bool
+		expectedHint      string
+	}{
+		{
+			name:     "Empty common name allowed",
+			dnsNames: []string{"app.example.com"},
+		},
+		{
+			name:              "Common name present",
+			requireCommonName: true,
+			commonName:        "app.example.com",
+		},
+		{
+			name:              "Empty common name with SANs",
+			requireCommonName: true,
+			dnsNames:          []string{"app.example.com", "www.example.com"},
+			expectedError:     true,
+			expectedHint:      `"app.example.com"`,
+		},
+		{
+			name:              "Empty common name without SANs",
+			requireCommonName: true,
+			expectedError:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := commandSigner{requireCommonName: tt.requireCommonName}
+
+			csr := &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: tt.commonName},
+				DNSNames: tt.dnsNames,
+			}
+
+			err := signer.checkCommonName(csr)
+			if tt.expectedError {
+				assert.ErrorIs(t, err, ErrCommonNameRequired)
+				assert.Contains(t, err.Error(), tt.expectedHint)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckCertificateAuthority(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                          string
+		allowedCertificateAuthorities []string
+		annotations                   map[string]string
+		expectedCertificateAuthority  string
+		expectedError                 bool
+	}{
+		{
+			name:                         "NoOverride",
+			expectedCertificateAuthority: "ca",
+		},
+		{
+			name:                          "AllowedOverride",
+			allowedCertificateAuthorities: []string{"CA2", `ca.example.com\CA3`},
+			annotations:                   map[string]string{certificateAuthorityAnnotation: `ca.example.com\ca3`},
+			expectedCertificateAuthority:  `ca.example.com\ca3`,
+		},
+		{
+			name:                          "IssuerCertificateAuthority",
+			allowedCertificateAuthorities: []string{"CA2"},
+			annotations:                   map[string]string{certificateAuthorityAnnotation: "ca"},
+			expectedCertificateAuthority:  "ca",
+		},
+		{
+			name:                          "DisallowedOverride",
+			allowedCertificateAuthorities: []string{"CA2"},
+			annotations:                   map[string]string{certificateAuthorityAnnotation: `ca.example.com\CA2`},
+			expectedError:                 true,
+		},
+		{
+			name:          "OverrideWithoutAllowlist",
+			annotations:   map[string]string{certificateAuthorityAnnotation: "CA2"},
+			expectedError: true,
+		},
+		{
+			name:                         "LegacyOverrideWithoutAllowlist",
+			annotations:                  map[string]string{"command-issuer.keyfactor.com/certificateAuthorityLogicalName": "CA2"},
+			expectedCertificateAuthority: "CA2",
+		},
+		{
+			name:                          "DisallowedLegacyOverride",
+			allowedCertificateAuthorities: []string{"CA2"},
+			annotations:                   map[string]string{"command-issuer.keyfactor.com/certificateAuthorityLogicalName": "CA3"},
+			expectedError:                 true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.AllowedCertificateAuthorities = tt.allowedCertificateAuthorities
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, tt.annotations, authSecretData, nil, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.expectedError {
+				assert.ErrorIs(t, err, ErrCertificateAuthorityNotAllowed)
+				assert.Empty(t, requests, "a disallowed certificate authority must not be sent to Command")
+				return
+			}
+			assert.NoError(t, err)
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, tt.expectedCertificateAuthority, requests[0]["CertificateAuthority"])
+			}
+		})
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	const header = "X-Correlation-ID"
+
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get(header))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+
+	tests := []struct {
+		name     string
+		ctx      func() (context.Context, string)
+		expected func(id string) []string
+	}{
+		{
+			name: "HeaderStablePerRequest",
+			ctx: func() (context.Context, string) {
+				return ContextWithRequestID(context.Background(), header)
+			},
+			expected: func(id string) []string { return []string{id, id} },
+		},
+		{
+			name: "PropagatesExistingRequestID",
+			ctx: func() (context.Context, string) {
+				ctx, _ := ContextWithRequestID(context.Background(), header)
+				return ContextWithRequestID(ctx, "X-Other-Header")
+			},
+			expected: func(id string) []string { return []string{id, id} },
+		},
+		{
+			name: "NoRequestID",
+			ctx: func() (context.Context, string) {
+				return context.Background(), ""
+			},
+			expected: func(string) []string { return []string{"", ""} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+
+			ctx, id := tt.ctx()
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(ctx, spec, authSecretData, caSecretData)
+			assert.NoError(t, err)
+
+			// Every call made by the same client must carry the same request ID
+			assert.NoError(t, checker.Check(ctx))
+			assert.NoError(t, checker.Check(ctx))
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.expected(id), received)
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		suffix   string
+		expected string
+	}{
+		{
+			name:     "NoSuffix",
+			expected: "command-issuer/dev",
+		},
+		{
+			name:     "Suffix",
+			suffix:   "cluster/prod-eu",
+			expected: "command-issuer/dev cluster/prod-eu",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var received []string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				received = append(received, r.Header.Get("User-Agent"))
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/KeyfactorAPI/Status/Endpoints" {
+					_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+					return
+				}
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			ctx = ContextWithUserAgentSuffix(ctx, tt.suffix)
+
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(ctx, spec, authSecretData, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, checker.Check(ctx))
+
+			signer, err := CommandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, _, err = signer.Sign(ctx, csr, K8sMetadata{})
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, []string{tt.expected, tt.expected}, received)
+		})
+	}
+}
+
+func TestValidateUserAgentSuffix(t *testing.T) {
+	assert.NoError(t, ValidateUserAgentSuffix(""))
+	assert.NoError(t, ValidateUserAgentSuffix("cluster/prod-eu (team=platform)"))
+	assert.ErrorIs(t, ValidateUserAgentSuffix("prod\r\nX-Injected: true"), ErrInvalidUserAgentSuffix)
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name               string
+		insecureSkipVerify bool
+		expectError        bool
+	}{
+		{
+			name:        "UntrustedServerCertificate",
+			expectError: true,
+		},
+		{
+			name:               "InsecureSkipVerify",
+			insecureSkipVerify: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No CA bundle is provided, so the self-signed server certificate can't be verified
+			spec, authSecretData, _ := getFakeCommandConfigItems(server)
+			spec.InsecureSkipVerify = tt.insecureSkipVerify
+
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(context.Background(), spec, authSecretData, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checker.Check(context.Background())
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckErrorClassification(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCode    int
+		body          string
+		expectedError error
+	}{
+		{
+			name:       "Healthy",
+			statusCode: http.StatusOK,
+			body:       `["POST /Enrollment/CSR"]`,
+		},
+		{
+			name:          "MissingEnrollmentEndpoint",
+			statusCode:    http.StatusOK,
+			body:          `["GET /Certificates"]`,
+			expectedError: ErrAuthenticationFailed,
+		},
+		{
+			name:          "Unauthorized",
+			statusCode:    http.StatusUnauthorized,
+			expectedError: ErrAuthenticationFailed,
+		},
+		{
+			name:          "Forbidden",
+			statusCode:    http.StatusForbidden,
+			expectedError: ErrAuthenticationFailed,
+		},
+		{
+			name:          "NotFound",
+			statusCode:    http.StatusNotFound,
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			name:          "TooManyRequests",
+			statusCode:    http.StatusTooManyRequests,
+			expectedError: ErrTransient,
+		},
+		{
+			name:          "ServiceUnavailable",
+			statusCode:    http.StatusServiceUnavailable,
+			expectedError: ErrTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(context.Background(), spec, authSecretData, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checker.Check(context.Background())
+			if tt.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedError)
+			}
+		})
+	}
+
+	t.Run("Unreachable", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+		server.Close()
+
+		checker, err := CommandHealthCheckerFromIssuerAndSecretData(context.Background(), spec, authSecretData, caSecretData)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		// If there are no annotations, the customMetadata map should be empty
-		if len(signer.customMetadata) != 0 {
-			t.Errorf("expected customMetadata to be empty, got %v", signer.customMetadata)
-		}
-	})
+		assert.ErrorIs(t, checker.Check(context.Background()), ErrTransient)
+	})
+}
+
+func TestCheckCertificateCollection(t *testing.T) {
+	tests := []struct {
+		name             string
+		collection       string
+		collectionStatus int
+		expectedError    error
+	}{
+		{
+			name: "NoCollection",
+		},
+		{
+			name:             "CollectionExists",
+			collection:       "Kubernetes Certificates",
+			collectionStatus: http.StatusOK,
+		},
+		{
+			name:             "CollectionMissing",
+			collection:       "Kubernetes Certificates",
+			collectionStatus: http.StatusNotFound,
+			expectedError:    ErrInvalidConfig,
+		},
+		{
+			name:             "CollectionsNotReadable",
+			collection:       "Kubernetes Certificates",
+			collectionStatus: http.StatusForbidden,
+		},
+		{
+			name:             "CommandUnavailable",
+			collection:       "Kubernetes Certificates",
+			collectionStatus: http.StatusServiceUnavailable,
+			expectedError:    ErrTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var collectionRequests []string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if strings.HasPrefix(r.URL.Path, "/KeyfactorAPI/CertificateCollections/") {
+					collectionRequests = append(collectionRequests, strings.TrimPrefix(r.URL.Path, "/KeyfactorAPI/CertificateCollections/"))
+					w.WriteHeader(tt.collectionStatus)
+					_, _ = w.Write([]byte(`{"Id": 1}`))
+					return
+				}
+				_, _ = w.Write([]byte(`["POST /Enrollment/CSR"]`))
+			}))
+			defer server.Close()
+
+			spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+			spec.CertificateCollection = tt.collection
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(context.Background(), spec, authSecretData, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checker.Check(context.Background())
+			if tt.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedError)
+			}
+			if tt.collection == "" {
+				assert.Empty(t, collectionRequests)
+			} else {
+				assert.Equal(t, []string{tt.collection}, collectionRequests)
+			}
+		})
+	}
+}
+
+func TestBuilderErrorClassification(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		modify func(spec *commandissuer.IssuerSpec, authSecretData map[string][]byte)
+	}{
+		{
+			name: "MissingUsername",
+			modify: func(_ *commandissuer.IssuerSpec, authSecretData map[string][]byte) {
+				delete(authSecretData, "username")
+			},
+		},
+		{
+			name: "MissingCertificateTemplate",
+			modify: func(spec *commandissuer.IssuerSpec, _ map[string][]byte) {
+				spec.CertificateTemplate = ""
+			},
+		},
+		{
+			name: "MissingCertificateAuthority",
+			modify: func(spec *commandissuer.IssuerSpec, _ map[string][]byte) {
+				spec.CertificateAuthorityLogicalName = ""
+			},
+		},
+		{
+			name: "InvalidSubjectPattern",
+			modify: func(spec *commandissuer.IssuerSpec, _ map[string][]byte) {
+				spec.SubjectPattern = "("
+			},
+		},
+		{
+			name: "UnsupportedEnrollmentFormat",
+			modify: func(spec *commandissuer.IssuerSpec, _ map[string][]byte) {
+				spec.EnrollmentFormat = "DER"
+			},
+		},
+		{
+			name: "InvalidEnrollmentRequestTemplate",
+			modify: func(spec *commandissuer.IssuerSpec, _ map[string][]byte) {
+				spec.EnrollmentRequestTemplate = `{"CSR": {{ json .CSR }`
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+			tt.modify(spec, authSecretData)
+
+			_, err := CommandSignerFromIssuerAndSecretData(context.Background(), spec, nil, authSecretData, nil, caSecretData)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+
+	t.Run("HealthCheckerMissingPassword", func(t *testing.T) {
+		spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+		delete(authSecretData, "password")
+
+		_, err := CommandHealthCheckerFromIssuerAndSecretData(context.Background(), spec, authSecretData, caSecretData)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+		assert.ErrorIs(t, err, ErrMissingCredentials)
+	})
+}
+
+func TestCommandVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		response        string
+		expectedVersion string
+		expectError     bool
+	}{
+		{
+			name:            "VersionReported",
+			response:        `{"KeyfactorVersion": "11.0.0"}`,
+			expectedVersion: "11.0.0",
+		},
+		{
+			name:        "VersionNotReported",
+			response:    `{}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(context.Background(), spec, authSecretData, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			version, err := checker.CommandVersion(context.Background())
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVersion, version)
+		})
+	}
+}
+
+func TestSignReauthentication(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                string
+		unauthorizedCalls   int
+		reauthenticateError error
+		expectedCalls       int
+		expectedError       error
+	}{
+		{
+			name:          "NoReauthentication",
+			expectedCalls: 1,
+		},
+		{
+			name:              "ReauthenticateAndRetry",
+			unauthorizedCalls: 1,
+			expectedCalls:     2,
+		},
+		{
+			name:              "ReauthenticatedRequestUnauthorized",
+			unauthorizedCalls: 2,
+			expectedCalls:     2,
+			expectedError:     ErrAuthenticationFailed,
+		},
+		{
+			name:                "ReauthenticationFails",
+			unauthorizedCalls:   1,
+			reauthenticateError: errors.New("simulated re-authentication error"),
+			expectedCalls:       1,
+			expectedError:       ErrAuthenticationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := 0
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calls++
+				unauthorized := calls <= tt.unauthorizedCalls
+				mu.Unlock()
+
+				if unauthorized {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.reauthenticateError != nil {
+				signer.reauthenticate = func(context.Context) (*keyfactor.APIClient, error) {
+					return nil, tt.reauthenticateError
+				}
+			}
+
+			leaf, _, _, err := signer.Sign(context.Background(), csr, K8sMetadata{})
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, leaf)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.expectedCalls, calls)
+		})
+	}
+}
+
+func TestSignContextCancellation(t *testing.T) {
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		newContext    func(received <-chan struct{}) (context.Context, context.CancelFunc)
+		expectedError error
+	}{
+		{
+			name: "Cancelled",
+			newContext: func(received <-chan struct{}) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				// Cancel the context once the enrollment is in flight
+				go func() {
+					<-received
+					cancel()
+				}()
+				return ctx, cancel
+			},
+			expectedError: context.Canceled,
+		},
+		{
+			name: "DeadlineExceeded",
+			newContext: func(<-chan struct{}) (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			expectedError: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan struct{})
+			release := make(chan struct{})
+			var once sync.Once
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				once.Do(func() { close(received) })
+				// Simulate a Command instance that never answers
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			}))
+			defer server.Close()
+			defer close(release)
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := tt.newContext(received)
+			defer cancel()
+
+			start := time.Now()
+			_, _, _, err = signer.Sign(ctx, csr, K8sMetadata{})
+			assert.ErrorIs(t, err, tt.expectedError)
+			// The client times out after 10 seconds, so the enrollment must have been aborted by the context
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
+
+func TestSignErrorClassification(t *testing.T) {
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := generateSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollmentResponse := func(disposition string) []byte {
+		response, err := json.Marshal(map[string]interface{}{
+			"CertificateInformation": map[string]interface{}{
+				"RequestDisposition": disposition,
+				"DispositionMessage": "simulated disposition message",
+				"KeyfactorRequestId": 42,
+				"Certificates":       []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	tests := []struct {
+		name          string
+		statusCode    int
+		response      []byte
+		expectedError error
+		transient     bool
+		failed        bool
+	}{
+		{
+			name:       "Issued",
+			statusCode: http.StatusOK,
+			response:   enrollmentResponse("Issued"),
+		},
+		{
+			name:          "Denied",
+			statusCode:    http.StatusOK,
+			response:      enrollmentResponse("Denied"),
+			expectedError: ErrEnrollmentDenied,
+		},
+		{
+			name:          "Pending",
+			statusCode:    http.StatusOK,
+			response:      enrollmentResponse("Pending"),
+			expectedError: ErrEnrollmentPending,
+		},
+		{
+			name:          "ExternalValidation",
+			statusCode:    http.StatusOK,
+			response:      enrollmentResponse("External Validation"),
+			expectedError: ErrEnrollmentPending,
+		},
+		{
+			name:          "BadRequest",
+			statusCode:    http.StatusBadRequest,
+			response:      []byte(`{"ErrorCode":"0xA0110001","Message":"Template 'missing' does not exist"}`),
+			expectedError: ErrEnrollmentRejected,
+		},
+		{
+			name:       "TooManyRequests",
+			statusCode: http.StatusTooManyRequests,
+			response:   []byte(`{}`),
+			transient:  true,
+		},
+		{
+			name:       "ServiceUnavailable",
+			statusCode: http.StatusServiceUnavailable,
+			response:   []byte(`{}`),
+			transient:  true,
+		},
+		{
+			name:       "InternalServerError",
+			statusCode: http.StatusInternalServerError,
+			response:   []byte(`{"ErrorCode":"0xA0110001","Message":"The CSR could not be parsed"}`),
+			failed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write(tt.response)
+			}))
+			defer server.Close()
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+			switch {
+			case tt.expectedError != nil:
+				assert.ErrorIs(t, err, tt.expectedError)
+			case tt.transient:
+				assert.ErrorIs(t, err, ErrTransient)
+				assert.NotErrorIs(t, err, ErrEnrollmentRejected)
+				assert.NotErrorIs(t, err, ErrEnrollmentDenied)
+			case tt.failed:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrTransient)
+				assert.NotErrorIs(t, err, ErrEnrollmentRejected)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSignRenewal(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		renewalCertificateID int32
+		expectedProperty     interface{}
+	}{
+		{
+			name:             "NewEnrollment",
+			expectedProperty: nil,
+		},
+		{
+			name:                 "Renewal",
+			renewalCertificateID: 42,
+			expectedProperty:     float64(42),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			signer, err := commandSignerFromIssuerAndSecretData(getFakeCommandSignerConfigItems(server))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, certificateID, err := signer.Sign(context.Background(), csr, K8sMetadata{RenewalCertificateID: tt.renewalCertificateID})
+			assert.NoError(t, err)
+			assert.Equal(t, int32(fakeCommandCertificateID), certificateID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, tt.expectedProperty, requests[0][renewalCertificateIDProperty])
+			}
+		})
+	}
+}
+
+func TestSignEnrollmentParameters(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		enrollmentParameters map[string]string
+		expectedProperties   map[string]interface{}
+		expectError          bool
+	}{
+		{
+			name: "TemplateParameters",
+			enrollmentParameters: map[string]string{
+				"Owner":       "team-a",
+				"CostCenter":  "1234",
+				"KeyRecovery": "false",
+			},
+			expectedProperties: map[string]interface{}{
+				"Owner":       "team-a",
+				"CostCenter":  "1234",
+				"KeyRecovery": "false",
+			},
+		},
+		{
+			name:                 "ReservedParameter",
+			enrollmentParameters: map[string]string{"csr": "not a CSR"},
+			expectError:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.EnrollmentParameters = tt.enrollmentParameters
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
 
-	t.Run("MetadataAnnotations", func(t *testing.T) {
-		annotations := map[string]string{
-			commandMetadataAnnotationPrefix + "key1": "value1",
-			commandMetadataAnnotationPrefix + "key2": "value2",
-		}
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+			assert.NoError(t, err)
 
-		// Create the signer
-		signer, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, annotations, authSecretData, caSecretData)
-		if err != nil {
-			t.Fatal(err)
-		}
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, requests, 1) {
+				for name, value := range tt.expectedProperties {
+					assert.Equal(t, value, requests[0][name])
+				}
+				assert.Equal(t, string(csr), requests[0]["CSR"])
+			}
+		})
+	}
+}
 
-		// If there are no annotations, the customMetadata map should be empty
-		if len(signer.customMetadata) != 2 {
-			t.Errorf("expected customMetadata to have 2 entries, got %v", signer.customMetadata)
-		}
+func TestSignEnrollmentFormat(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
 
-		if value, ok := signer.customMetadata["key1"].(string); ok && value == "value1" {
-			// They are equal
-		} else {
-			t.Errorf("expected customMetadata key1 to be value1, got %v", signer.customMetadata["key1"])
-		}
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csr)
+	if block == nil {
+		t.Fatal("failed to decode the CSR")
+	}
 
-		if value, ok := signer.customMetadata["key2"].(string); ok && value == "value2" {
-			// They are equal
-		} else {
-			t.Errorf("expected customMetadata key1 to be value1, got %v", signer.customMetadata["key1"])
-		}
+	tests := []struct {
+		name        string
+		format      commandissuer.EnrollmentFormat
+		expectedCSR string
+	}{
+		{
+			name:        "Default",
+			expectedCSR: string(csr),
+		},
+		{
+			name:        "PEM",
+			format:      commandissuer.EnrollmentFormatPEM,
+			expectedCSR: string(csr),
+		},
+		{
+			name:        "PKCS10",
+			format:      commandissuer.EnrollmentFormatPKCS10,
+			expectedCSR: base64.StdEncoding.EncodeToString(block.Bytes),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.EnrollmentFormat = tt.format
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, tt.expectedCSR, requests[0]["CSR"])
+			}
+		})
+	}
+}
+
+func TestSignMetadata(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		annotations      map[string]string
+		collection       string
+		k8sMeta          K8sMetadata
+		expectedMetadata map[string]interface{}
+		absentMetadata   []string
+	}{
+		{
+			name: "IssuerMetadataAndClusterName",
+			k8sMeta: K8sMetadata{
+				IssuerName:     "issuer1",
+				ClusterName:    "prod-eu",
+				IssuerMetadata: map[string]string{"Team": "pki", "Environment": "production"},
+			},
+			expectedMetadata: map[string]interface{}{
+				CommandMetaIssuerName:  "issuer1",
+				CommandMetaClusterName: "prod-eu",
+				"Team":                 "pki",
+				"Environment":          "production",
+			},
+		},
+		{
+			name:             "NoClusterName",
+			k8sMeta:          K8sMetadata{IssuerName: "issuer1"},
+			expectedMetadata: map[string]interface{}{CommandMetaIssuerName: "issuer1"},
+			absentMetadata:   []string{CommandMetaClusterName, CommandMetaCertificateCollection},
+		},
+		{
+			name:             "CertificateCollection",
+			collection:       "Kubernetes Certificates",
+			expectedMetadata: map[string]interface{}{CommandMetaCertificateCollection: "Kubernetes Certificates"},
+		},
+		{
+			name:             "RequestMetadataTakesPrecedence",
+			annotations:      map[string]string{commandMetadataAnnotationPrefix + "Team": "web"},
+			k8sMeta:          K8sMetadata{IssuerMetadata: map[string]string{"Team": "pki"}},
+			expectedMetadata: map[string]interface{}{"Team": "web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.CertificateCollection = tt.collection
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, tt.annotations, authSecretData, nil, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, _, err = signer.Sign(context.Background(), csr, tt.k8sMeta)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, requests, 1) {
+				metadata, ok := requests[0]["Metadata"].(map[string]interface{})
+				if !ok {
+					t.Fatal("the enrollment request has no metadata")
+				}
+				for name, value := range tt.expectedMetadata {
+					assert.Equal(t, value, metadata[name])
+				}
+				for _, name := range tt.absentMetadata {
+					assert.NotContains(t, metadata, name)
+				}
+			}
+		})
+	}
+}
+
+func TestSignDuration(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		defaultDuration *metav1.Duration
+		duration        time.Duration
+		expectedUnits   interface{}
+	}{
+		{
+			name:          "NoDuration",
+			expectedUnits: nil,
+		},
+		{
+			name:            "DefaultDuration",
+			defaultDuration: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+			expectedUnits:   float64(720),
+		},
+		{
+			name:            "RequestOverridesDefault",
+			defaultDuration: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+			duration:        90 * time.Minute,
+			expectedUnits:   float64(2),
+		},
+		{
+			name:          "RequestDuration",
+			duration:      24 * time.Hour,
+			expectedUnits: float64(24),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.DefaultDuration = tt.defaultDuration
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{Duration: tt.duration})
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, tt.expectedUnits, requests[0][validityPeriodUnitsProperty])
+				if tt.expectedUnits != nil {
+					assert.Equal(t, validityPeriodHours, requests[0][validityPeriodProperty])
+				} else {
+					assert.NotContains(t, requests[0], validityPeriodProperty)
+				}
+			}
+		})
+	}
+}
+
+func TestSignServerGeneratedKey(t *testing.T) {
+	cert, err := generateSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	response, err := json.Marshal(map[string]interface{}{
+		"CertificateInformation": map[string]interface{}{
+			"KeyfactorID":  fakeCommandCertificateID,
+			"Certificates": []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})) + string(keyPEM)},
+		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	t.Run("AnnotationDefaultOverrides", func(t *testing.T) {
-		annotations := map[string]string{
-			"command-issuer.keyfactor.com/certificateTemplate":             "TestCertificateTemplate",
-			"command-issuer.keyfactor.com/certificateAuthorityLogicalName": "TestCertificateAuthorityLogicalName",
-			"command-issuer.keyfactor.com/certificateAuthorityHostname":    "TestCertificateAuthorityHostname",
-			"command-manager.io/certificate-name":                          "TestCertificateName",
+	var mu sync.Mutex
+	var revoked bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/Certificates/Revoke") {
+			mu.Lock()
+			revoked = true
+			mu.Unlock()
+			_, _ = w.Write([]byte("{}"))
+			return
 		}
+		_, _ = w.Write(response)
+	}))
+	defer server.Close()
 
-		// Create the signer
-		signer, err := commandSignerFromIssuerAndSecretData(context.Background(), &spec, annotations, authSecretData, caSecretData)
-		if err != nil {
-			t.Fatal(err)
-		}
+	ctx, spec, _, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+	signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, nil, authSecretData, nil, caSecretData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := generateCSR("CN=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		assert.Equal(t, "TestCertificateTemplate", signer.certificateTemplate)
-		assert.Equal(t, "TestCertificateAuthorityLogicalName", signer.certificateAuthorityLogicalName)
-		assert.Equal(t, "TestCertificateAuthorityHostname", signer.certificateAuthorityHostname)
-		assert.Equal(t, "TestCertificateName", signer.certManagerCertificateName)
-	})
+	// The certificate can't be used with the key of the CSR, so it is revoked and the request fails
+	leaf, _, _, err := signer.Sign(context.Background(), csr, K8sMetadata{})
+	assert.ErrorIs(t, err, ErrServerGeneratedKey)
+	assert.ErrorIs(t, err, ErrEnrollmentRejected)
+	assert.Nil(t, leaf)
+	assert.NotContains(t, err.Error(), "PRIVATE KEY")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.True(t, revoked, "the certificate must be revoked")
 }
 
 func TestCompileCertificatesToPemBytes(t *testing.T) {
@@ -363,6 +1746,97 @@ func Test_createCommandClientFromSecretData(t *testing.T) {
 			},
 			expectedErr: false,
 		},
+		{
+			name: "CustomSecretKeys",
+			spec: commandissuer.IssuerSpec{
+				UsernameKey: "user",
+				PasswordKey: "pass",
+				HostnameKey: "host",
+			},
+			authSecretData: map[string][]byte{
+				"user": []byte("username"),
+				"pass": []byte("password"),
+				"host": []byte("hostname-from-secret"),
+			},
+			verify: func(t *testing.T, client *keyfactor.APIClient) error {
+				if client == nil {
+					return fmt.Errorf("expected client to be non-nil")
+				}
+
+				if client.GetConfig().Host != "hostname-from-secret" {
+					return fmt.Errorf("expected hostname to be hostname-from-secret, got %s", client.GetConfig().Host)
+				}
+
+				if client.GetConfig().BasicAuth.UserName != "username" {
+					return fmt.Errorf("expected username to be username, got %s", client.GetConfig().BasicAuth.UserName)
+				}
+
+				if client.GetConfig().BasicAuth.Password != "password" {
+					return fmt.Errorf("expected password to be password, got %s", client.GetConfig().BasicAuth.Password)
+				}
+
+				return nil
+			},
+			expectedErr: false,
+		},
+		{
+			name: "MissingCustomSecretKey",
+			spec: commandissuer.IssuerSpec{
+				Hostname:    "hostname",
+				PasswordKey: "pass",
+			},
+			authSecretData: map[string][]byte{
+				"username": []byte("username"),
+				"password": []byte("password"),
+			},
+			verify: func(t *testing.T, client *keyfactor.APIClient) error {
+				if client != nil {
+					return fmt.Errorf("expected client to be nil")
+				}
+				return nil
+			},
+			expectedErr: true,
+		},
+		{
+			name: "HostnameKeyFallback",
+			spec: commandissuer.IssuerSpec{
+				Hostname:    "hostname",
+				HostnameKey: "host",
+			},
+			authSecretData: map[string][]byte{
+				"username": []byte("username"),
+				"password": []byte("password"),
+			},
+			verify: func(t *testing.T, client *keyfactor.APIClient) error {
+				if client == nil {
+					return fmt.Errorf("expected client to be non-nil")
+				}
+
+				if client.GetConfig().Host != "hostname" {
+					return fmt.Errorf("expected hostname to be hostname, got %s", client.GetConfig().Host)
+				}
+
+				return nil
+			},
+			expectedErr: false,
+		},
+		{
+			name: "MissingHostnameKey",
+			spec: commandissuer.IssuerSpec{
+				HostnameKey: "host",
+			},
+			authSecretData: map[string][]byte{
+				"username": []byte("username"),
+				"password": []byte("password"),
+			},
+			verify: func(t *testing.T, client *keyfactor.APIClient) error {
+				if client != nil {
+					return fmt.Errorf("expected client to be nil")
+				}
+				return nil
+			},
+			expectedErr: true,
+		},
 		{
 			name: "InvalidCaData",
 			spec: commandissuer.IssuerSpec{
@@ -399,12 +1873,57 @@ func Test_createCommandClientFromSecretData(t *testing.T) {
 	}
 }
 
+// getFakeCommandConfigItems returns the issuer spec and secret data of a Command client that trusts and
+// connects to the given fake Command server
+func getFakeCommandConfigItems(server *httptest.Server) (*commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) {
+	spec := &commandissuer.IssuerSpec{
+		Hostname:                        server.URL,
+		CertificateTemplate:             "template",
+		CertificateAuthorityLogicalName: "ca",
+	}
+	authSecretData := map[string][]byte{
+		"username": []byte("username"),
+		"password": []byte("password"),
+	}
+	caSecretData := map[string][]byte{
+		"ca.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+	}
+	return spec, authSecretData, caSecretData
+}
+
+// getFakeCommandSignerConfigItems returns the builder arguments of a signer that enrolls with the given fake Command server
+func getFakeCommandSignerConfigItems(server *httptest.Server) (context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) {
+	spec, authSecretData, caSecretData := getFakeCommandConfigItems(server)
+	return context.Background(), spec, nil, authSecretData, nil, caSecretData
+}
+
+// fakeCommandCertificateID is the Command ID of the certificate returned by fakeEnrollmentResponse
+const fakeCommandCertificateID = 1234
+
+// fakeEnrollmentResponse returns a Command CSR enrollment response containing a self-signed certificate
+func fakeEnrollmentResponse(t *testing.T) []byte {
+	cert, err := generateSelfSignedCertificate()
+	if err != nil {
+		t.Fatalf("failed to generate self-signed certificate: %v", err)
+	}
+	response, err := json.Marshal(map[string]interface{}{
+		"CertificateInformation": map[string]interface{}{
+			"KeyfactorID":  fakeCommandCertificateID,
+			"Certificates": []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
 func getTestHealthCheckerConfigItems(t *testing.T) (context.Context, *commandissuer.IssuerSpec, map[string][]byte, map[string][]byte) {
-	ctx, spec, _, secret, configmap := getTestSignerConfigItems(t)
+	ctx, spec, _, secret, _, configmap := getTestSignerConfigItems(t)
 	return ctx, spec, secret, configmap
 }
 
-func getTestSignerConfigItems(t *testing.T) (context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte) {
+func getTestSignerConfigItems(t *testing.T) (context.Context, *commandissuer.IssuerSpec, map[string]string, map[string][]byte, map[string][]byte, map[string][]byte) {
 	// Get the username and password from the environment
 	secretData := make(map[string][]byte)
 	username := os.Getenv("COMMAND_USERNAME")
@@ -459,7 +1978,7 @@ func getTestSignerConfigItems(t *testing.T) (context.Context, *commandissuer.Iss
 		caSecretData["tls.crt"] = caCertBytes
 	}
 
-	return context.Background(), &spec, make(map[string]string), secretData, caSecretData
+	return context.Background(), &spec, make(map[string]string), secretData, nil, caSecretData
 }
 
 func generateCSR(subject string) ([]byte, error) {
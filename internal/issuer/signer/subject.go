@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/x509/pkix"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// subjectAttributeNames are the short names of the subject attributes that cert-manager encodes from
+// the subject field of a Certificate, used to describe differences in the subject
+var subjectAttributeNames = map[string]string{
+	"2.5.4.3":  "CN",
+	"2.5.4.5":  "SERIALNUMBER",
+	"2.5.4.6":  "C",
+	"2.5.4.7":  "L",
+	"2.5.4.8":  "ST",
+	"2.5.4.9":  "STREET",
+	"2.5.4.10": "O",
+	"2.5.4.11": "OU",
+	"2.5.4.17": "POSTALCODE",
+	// emailAddress is deprecated in subjects but still included by some CSRs
+	"1.2.840.113549.1.9.1": "E",
+}
+
+// subjectDifferences describes the attributes of the requested subject that were dropped or changed
+// in the issued subject, and the attributes that were added to it. The CSR is sent to Command
+// unchanged, so differences are made by the certificate template or the CA. Attributes are compared
+// by type regardless of their order, and the descriptions are sorted by the OID of the type.
+func subjectDifferences(requested, issued pkix.Name) []string {
+	requestedValues := subjectAttributeValues(requested)
+	issuedValues := subjectAttributeValues(issued)
+
+	types := make([]string, 0, len(requestedValues)+len(issuedValues))
+	for oid := range requestedValues {
+		types = append(types, oid)
+	}
+	for oid := range issuedValues {
+		if _, ok := requestedValues[oid]; !ok {
+			types = append(types, oid)
+		}
+	}
+	sort.Strings(types)
+
+	var differences []string
+	for _, oid := range types {
+		name := subjectAttributeName(oid)
+		requestedValue := strings.Join(requestedValues[oid], ", ")
+		issuedValue := strings.Join(issuedValues[oid], ", ")
+		switch {
+		case requestedValue == issuedValue:
+		case issuedValue == "":
+			differences = append(differences, fmt.Sprintf("%s %q was dropped", name, requestedValue))
+		case requestedValue == "":
+			differences = append(differences, fmt.Sprintf("%s %q was added", name, issuedValue))
+		default:
+			differences = append(differences, fmt.Sprintf("%s %q was issued as %q", name, requestedValue, issuedValue))
+		}
+	}
+	return differences
+}
+
+// subjectAttributeValues returns the sorted values of every attribute of the subject, by the dotted
+// OID of their type. Attributes that aren't strings are compared by their formatted value.
+func subjectAttributeValues(name pkix.Name) map[string][]string {
+	values := make(map[string][]string)
+	for _, attribute := range name.Names {
+		oid := attribute.Type.String()
+		values[oid] = append(values[oid], fmt.Sprint(attribute.Value))
+	}
+	for oid := range values {
+		sort.Strings(values[oid])
+	}
+	return values
+}
+
+// subjectAttributeName returns the short name of a subject attribute type, or its dotted OID
+func subjectAttributeName(oid string) string {
+	if name, ok := subjectAttributeNames[oid]; ok {
+		return name
+	}
+	return oid
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// richSubject has every attribute that cert-manager encodes from the subject field of a Certificate,
+// with several values for some of them, and an emailAddress attribute
+var richSubject = pkix.Name{
+	CommonName:         "example.com",
+	SerialNumber:       "1234",
+	Country:            []string{"US"},
+	Province:           []string{"Washington"},
+	Locality:           []string{"Seattle"},
+	StreetAddress:      []string{"1 Main Street"},
+	PostalCode:         []string{"98101"},
+	Organization:       []string{"Example Corp", "Example Holdings"},
+	OrganizationalUnit: []string{"Platform", "Security"},
+	ExtraNames: []pkix.AttributeTypeAndValue{
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}, Value: "pki@example.com"},
+	},
+}
+
+func TestSignForwardsSubject(t *testing.T) {
+	enrollmentResponse := fakeEnrollmentResponse(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: richSubject, DNSNames: []string{"example.com"}}, key)
+	require.NoError(t, err)
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	requested, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	for _, format := range []commandissuer.EnrollmentFormat{commandissuer.EnrollmentFormatPEM, commandissuer.EnrollmentFormatPKCS10} {
+		t.Run(string(format), func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, body)
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(enrollmentResponse)
+			}))
+			defer server.Close()
+
+			ctx, spec, annotations, authSecretData, _, caSecretData := getFakeCommandSignerConfigItems(server)
+			spec.EnrollmentFormat = format
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, spec, annotations, authSecretData, nil, caSecretData)
+			require.NoError(t, err)
+
+			_, _, _, err = signer.Sign(context.Background(), csr, K8sMetadata{})
+			require.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Len(t, requests, 1)
+			enrolledCSR, _ := requests[0]["CSR"].(string)
+			enrolledDER := []byte(enrolledCSR)
+			if block, _ := pem.Decode(enrolledDER); block != nil {
+				enrolledDER = block.Bytes
+			} else {
+				enrolledDER, err = base64.StdEncoding.DecodeString(enrolledCSR)
+				require.NoError(t, err)
+			}
+			enrolled, err := x509.ParseCertificateRequest(enrolledDER)
+			require.NoError(t, err)
+
+			// Every attribute of the subject is enrolled in its original encoding
+			assert.Equal(t, requested.RawSubject, enrolled.RawSubject)
+			for _, attribute := range requested.Subject.Names {
+				assert.Contains(t, enrolled.Subject.Names, attribute)
+			}
+			assert.Len(t, enrolled.Subject.Names, 12)
+		})
+	}
+}
+
+func TestSubjectDifferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		issued   pkix.Name
+		expected []string
+	}{
+		{
+			name:   "Identical",
+			issued: richSubject,
+		},
+		{
+			name: "Reordered",
+			issued: func() pkix.Name {
+				name := richSubject
+				name.Organization = []string{"Example Holdings", "Example Corp"}
+				return name
+			}(),
+		},
+		{
+			name: "Overridden",
+			issued: pkix.Name{
+				CommonName:   "example.com",
+				Country:      []string{"DE"},
+				Organization: []string{"Example Corp"},
+				Names: []pkix.AttributeTypeAndValue{
+					{Type: asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}, Value: "com"},
+				},
+			},
+			expected: []string{
+				`0.9.2342.19200300.100.1.25 "com" was added`,
+				`E "pki@example.com" was dropped`,
+				`O "Example Corp, Example Holdings" was issued as "Example Corp"`,
+				`OU "Platform, Security" was dropped`,
+				`POSTALCODE "98101" was dropped`,
+				`SERIALNUMBER "1234" was dropped`,
+				`C "US" was issued as "DE"`,
+				`L "Seattle" was dropped`,
+				`ST "Washington" was dropped`,
+				`STREET "1 Main Street" was dropped`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The names of parsed subjects are populated from their attributes
+			requested := parsedName(richSubject)
+			issued := parsedName(tt.issued)
+			assert.Equal(t, tt.expected, subjectDifferences(requested, issued))
+		})
+	}
+}
+
+// parsedName returns the name as it is parsed from a certificate, with its Names populated
+func parsedName(name pkix.Name) pkix.Name {
+	rdns := name.ToRDNSequence()
+	if len(name.Names) > 0 {
+		rdns = append(rdns, pkix.RelativeDistinguishedNameSET(name.Names))
+	}
+	var parsed pkix.Name
+	parsed.FillFromRDNSequence(&rdns)
+	return parsed
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default connection pool settings of the HTTP transports used to connect to Command. The controller
+// usually talks to a single Command host, so more idle connections are kept per host than Go's
+// default of two. Idle connections are closed before IIS' default connection timeout of two minutes
+// so that Command doesn't close a connection while it's being reused.
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 20
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// commandRequestTimeout is the timeout of a single HTTP request to Command
+const commandRequestTimeout = 10 * time.Second
+
+// TransportOptions tunes the connection pool of the HTTP transports used to connect to Command. Zero
+// values are replaced by the defaults.
+type TransportOptions struct {
+	// MaxIdleConns is the maximum number of idle connections across all Command hosts
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the maximum number of idle connections to a single Command host
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open
+	IdleConnTimeout time.Duration
+}
+
+// withDefaults returns the options with zero values replaced by the defaults
+func (o TransportOptions) withDefaults() TransportOptions {
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	return o
+}
+
+type transportOptionsContextKey struct{}
+
+// ContextWithTransportOptions returns a copy of ctx carrying the connection pool settings of the
+// Command clients created with it. If ctx carries no settings, the defaults are used.
+func ContextWithTransportOptions(ctx context.Context, options TransportOptions) context.Context {
+	return context.WithValue(ctx, transportOptionsContextKey{}, options)
+}
+
+// transportOptionsFromContext returns the connection pool settings carried by ctx, with zero values
+// replaced by the defaults
+func transportOptionsFromContext(ctx context.Context) TransportOptions {
+	options, _ := ctx.Value(transportOptionsContextKey{}).(TransportOptions)
+	return options.withDefaults()
+}
+
+// transportKey identifies the transports that can be shared by Command clients
+type transportKey struct {
+	options            TransportOptions
+	caChain            [sha256.Size]byte
+	insecureSkipVerify bool
+}
+
+// transports caches the HTTP transports of the Command clients. A new client is created on every
+// reconcile, so the transports are shared to reuse their idle connections across reconciles.
+var transports = struct {
+	sync.Mutex
+	m map[transportKey]*http.Transport
+}{m: make(map[transportKey]*http.Transport)}
+
+// newHTTPClient returns an HTTP client for Command that trusts caChain, or the system roots if
+// caChain is empty. Clients with the same settings share their transport and its idle connections.
+// If more than one host is given, requests fail over from each host to the next, see failoverTransport.
+func newHTTPClient(ctx context.Context, caChain []*x509.Certificate, insecureSkipVerify bool, hosts []string) *http.Client {
+	key := transportKey{
+		options:            transportOptionsFromContext(ctx),
+		insecureSkipVerify: insecureSkipVerify,
+	}
+	hash := sha256.New()
+	for _, certificate := range caChain {
+		hash.Write(certificate.Raw)
+	}
+	copy(key.caChain[:], hash.Sum(nil))
+
+	transports.Lock()
+	defer transports.Unlock()
+
+	transport, ok := transports.m[key]
+	if !ok {
+		transport = newTransport(key.options, caChain, insecureSkipVerify)
+		transports.m[key] = transport
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   commandRequestTimeout,
+	}
+	if observer := latencyObserverFromContext(ctx); observer != nil {
+		// Every host a request fails over to is observed separately
+		client.Transport = &latencyTransport{base: client.Transport, observer: observer, now: time.Now}
+	}
+	if breaker := circuitBreakerFromContext(ctx); breaker != nil {
+		client.Transport = &circuitBreakerTransport{base: client.Transport, breaker: breaker}
+	}
+	if len(hosts) > 1 {
+		// Every host is tried for up to commandRequestTimeout
+		client.Transport = &failoverTransport{base: client.Transport, hosts: hosts}
+		client.Timeout = commandRequestTimeout * time.Duration(len(hosts))
+	}
+	if limiter := rateLimiterFromContext(ctx); limiter != nil {
+		client.Transport = &rateLimitTransport{base: client.Transport, limiter: limiter}
+	}
+	return client
+}
+
+// newTransport returns an HTTP transport with the given connection pool settings and TLS configuration
+func newTransport(options TransportOptions, caChain []*x509.Certificate, insecureSkipVerify bool) *http.Transport {
+	tlsConfig := &tls.Config{
+		Renegotiation:      tls.RenegotiateOnceAsClient,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if len(caChain) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		for _, certificate := range caChain {
+			tlsConfig.RootCAs.AddCert(certificate)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Honor HTTPS_PROXY, HTTP_PROXY and NO_PROXY even if the default transport was changed
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = tlsConfig
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.MaxIdleConns = options.MaxIdleConns
+	transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = options.IdleConnTimeout
+
+	return transport
+}
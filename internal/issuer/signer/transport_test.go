@@ -0,0 +1,179 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caChain := []*x509.Certificate{server.Certificate()}
+
+	options := TransportOptions{MaxIdleConns: 7, MaxIdleConnsPerHost: 5, IdleConnTimeout: 42 * time.Second}
+	ctx := ContextWithTransportOptions(context.Background(), options)
+
+	client := newHTTPClient(ctx, caChain, false, nil)
+	transport, ok := client.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 7, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 42*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, commandRequestTimeout, client.Timeout)
+
+	// Clients of following reconciles reuse the transport and its idle connections
+	assert.Same(t, transport, newHTTPClient(ctx, caChain, false, nil).Transport)
+
+	// Clients with other settings don't
+	assert.NotSame(t, transport, newHTTPClient(ctx, nil, false, nil).Transport)
+	assert.NotSame(t, transport, newHTTPClient(ctx, caChain, true, nil).Transport)
+	assert.NotSame(t, transport, newHTTPClient(context.Background(), caChain, false, nil).Transport)
+
+	// Requests to the server reuse the connection
+	var reused []bool
+	for i := 0; i < 2; i++ {
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = append(reused, info.Reused) },
+		}
+		request, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		response, err := newHTTPClient(ctx, caChain, false, nil).Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+	}
+	assert.Equal(t, []bool{false, true}, reused)
+}
+
+func TestTransportOptionsDefaults(t *testing.T) {
+	assert.Equal(t, TransportOptions{
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+	}, transportOptionsFromContext(context.Background()))
+
+	options := transportOptionsFromContext(ContextWithTransportOptions(context.Background(), TransportOptions{MaxIdleConnsPerHost: 3}))
+	assert.Equal(t, DefaultMaxIdleConns, options.MaxIdleConns)
+	assert.Equal(t, 3, options.MaxIdleConnsPerHost)
+	assert.Equal(t, DefaultIdleConnTimeout, options.IdleConnTimeout)
+}
+
+func TestHealthCheckerAndSignerClientConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caSecretData := map[string][]byte{
+		"ca.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+	}
+	authSecretData := map[string][]byte{
+		"username": []byte("username"),
+		"password": []byte("password"),
+	}
+
+	tests := []struct {
+		name         string
+		spec         commandissuer.IssuerSpec
+		caSecretData map[string][]byte
+	}{
+		{
+			name: "Defaults",
+			spec: commandissuer.IssuerSpec{Hostname: "command.example.com"},
+		},
+		{
+			name:         "CA bundle",
+			spec:         commandissuer.IssuerSpec{Hostname: "command.example.com"},
+			caSecretData: caSecretData,
+		},
+		{
+			name: "InsecureSkipVerify",
+			spec: commandissuer.IssuerSpec{Hostname: "command.example.com", InsecureSkipVerify: true},
+		},
+		{
+			name: "FallbackHostnames",
+			spec: commandissuer.IssuerSpec{
+				Hostname:          "command.example.com",
+				FallbackHostnames: []string{"command-dr.example.com"},
+			},
+			caSecretData: caSecretData,
+		},
+		{
+			name: "RequestHeaders",
+			spec: commandissuer.IssuerSpec{
+				Hostname:       "command.example.com",
+				RequestHeaders: []commandissuer.RequestHeader{{Name: "X-Api-Key", Value: "key"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := ContextWithTransportOptions(context.Background(), TransportOptions{MaxIdleConnsPerHost: 3})
+			spec := tc.spec
+			spec.CertificateTemplate = "template"
+			spec.CertificateAuthorityLogicalName = "ca"
+
+			checker, err := CommandHealthCheckerFromIssuerAndSecretData(ctx, &spec, authSecretData, tc.caSecretData)
+			require.NoError(t, err)
+			signer, err := commandSignerFromIssuerAndSecretData(ctx, &spec, nil, authSecretData, nil, tc.caSecretData)
+			require.NoError(t, err)
+
+			checkerConfig := checker.(*commandSigner).client.GetConfig()
+			signerConfig := signer.client.GetConfig()
+			assert.Equal(t, signerConfig.Host, checkerConfig.Host)
+			assert.Equal(t, signerConfig.UserAgent, checkerConfig.UserAgent)
+			assert.Equal(t, signerConfig.DefaultHeader, checkerConfig.DefaultHeader)
+
+			// Both connect through the same transport, so proxy, TLS and connection pool settings are identical
+			assert.Equal(t, signerConfig.HTTPClient.Timeout, checkerConfig.HTTPClient.Timeout)
+			assert.Equal(t, signerConfig.HTTPClient.Transport, checkerConfig.HTTPClient.Transport)
+			checkerTransport := baseTransport(t, checkerConfig.HTTPClient.Transport)
+			assert.Same(t, baseTransport(t, signerConfig.HTTPClient.Transport), checkerTransport)
+			assert.NotNil(t, checkerTransport.Proxy)
+			assert.Equal(t, spec.InsecureSkipVerify, checkerTransport.TLSClientConfig.InsecureSkipVerify)
+			assert.Equal(t, tc.caSecretData != nil, checkerTransport.TLSClientConfig.RootCAs != nil)
+			assert.Equal(t, 3, checkerTransport.MaxIdleConnsPerHost)
+		})
+	}
+}
+
+// baseTransport returns the HTTP transport wrapped by the round trippers of a Command client
+func baseTransport(t *testing.T, roundTripper http.RoundTripper) *http.Transport {
+	t.Helper()
+	for {
+		switch transport := roundTripper.(type) {
+		case *http.Transport:
+			return transport
+		case *failoverTransport:
+			roundTripper = transport.base
+		case *circuitBreakerTransport:
+			roundTripper = transport.base
+		default:
+			t.Fatalf("unexpected round tripper %T", roundTripper)
+			return nil
+		}
+	}
+}
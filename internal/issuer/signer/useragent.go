@@ -0,0 +1,66 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Keyfactor/command-issuer/internal/version"
+)
+
+// userAgentProduct is the product token of the User-Agent sent to Command
+const userAgentProduct = "command-issuer"
+
+// ErrInvalidUserAgentSuffix is returned when a User-Agent suffix can't be sent in an HTTP header
+var ErrInvalidUserAgentSuffix = errors.New("invalid User-Agent suffix")
+
+type userAgentSuffixContextKey struct{}
+
+// ContextWithUserAgentSuffix returns a copy of ctx carrying a suffix that Command clients created from
+// the context append to their User-Agent, e.g. to tell apart the issuers of several clusters
+func ContextWithUserAgentSuffix(ctx context.Context, suffix string) context.Context {
+	return context.WithValue(ctx, userAgentSuffixContextKey{}, suffix)
+}
+
+// UserAgent returns the User-Agent sent to Command, which includes the version of the issuer and the
+// given suffix, if any
+func UserAgent(suffix string) string {
+	userAgent := fmt.Sprintf("%s/%s", userAgentProduct, version.Version)
+	if suffix != "" {
+		userAgent += " " + suffix
+	}
+	return userAgent
+}
+
+// ValidateUserAgentSuffix returns an error if suffix contains characters that aren't allowed in an
+// HTTP header value
+func ValidateUserAgentSuffix(suffix string) error {
+	for _, r := range suffix {
+		if r < ' ' || r == 0x7f {
+			return fmt.Errorf("%w %q: must not contain control characters", ErrInvalidUserAgentSuffix, suffix)
+		}
+	}
+	return nil
+}
+
+// userAgentFromContext returns the User-Agent for Command clients created from ctx
+func userAgentFromContext(ctx context.Context) string {
+	suffix, _ := ctx.Value(userAgentSuffixContextKey{}).(string)
+	return UserAgent(suffix)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrValidityWindow is returned by CheckValidityWindow when the issued certificate isn't valid at
+// the local time, e.g. because the clock of the cluster drifted from the clock of the CA
+var ErrValidityWindow = errors.New("issued certificate is not valid at the local time")
+
+// CheckValidityWindow verifies that the PEM-encoded certificate issued by Command is valid at now,
+// allowing for a clock skew of up to tolerance between the cluster and the CA. If it isn't, the
+// returned error wraps ErrValidityWindow and describes the difference.
+func CheckValidityWindow(certificateBytes []byte, now time.Time, tolerance time.Duration) error {
+	certificate, err := parseCertificatePEM(certificateBytes)
+	if err != nil {
+		return err
+	}
+
+	if skew := certificate.NotBefore.Sub(now); skew > tolerance {
+		return fmt.Errorf("%w: the certificate is not valid until %s, %s after the local time, which exceeds the clock skew tolerance of %s. Verify that the clocks of the cluster and of the CA are synchronized.", ErrValidityWindow, certificate.NotBefore.UTC().Format(time.RFC3339), skew.Round(time.Second), tolerance)
+	}
+	if skew := now.Sub(certificate.NotAfter); skew > tolerance {
+		return fmt.Errorf("%w: the certificate expired at %s, %s before the local time, which exceeds the clock skew tolerance of %s", ErrValidityWindow, certificate.NotAfter.UTC().Format(time.RFC3339), skew.Round(time.Second), tolerance)
+	}
+	return nil
+}
+
+// parseCertificatePEM parses the first PEM block of a certificate issued by Command
+func parseCertificatePEM(certificateBytes []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certificateBytes)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("failed to parse the issued certificate: PEM block type must be CERTIFICATE")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the issued certificate: %w", err)
+	}
+	return certificate, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckValidityWindow(t *testing.T) {
+	certificate, err := generateSelfSignedCertificate()
+	require.NoError(t, err)
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		tolerance     time.Duration
+		expectedError string
+	}{
+		{
+			name: "Valid",
+			now:  certificate.NotBefore.Add(time.Minute),
+		},
+		{
+			name:          "NotYetValid",
+			now:           certificate.NotBefore.Add(-30 * time.Second),
+			expectedError: "30s after the local time",
+		},
+		{
+			name:      "NotYetValidWithinTolerance",
+			now:       certificate.NotBefore.Add(-30 * time.Second),
+			tolerance: time.Minute,
+		},
+		{
+			name:          "Expired",
+			now:           certificate.NotAfter.Add(2 * time.Minute),
+			tolerance:     time.Minute,
+			expectedError: "2m0s before the local time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckValidityWindow(certificatePEM, tt.now, tt.tolerance)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrValidityWindow)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+
+	assert.Error(t, CheckValidityWindow([]byte("not a certificate"), time.Now(), 0))
+}
@@ -26,27 +26,33 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sync"
 )
 
-// ConfigClient is an interface for a K8s REST client.
+// ConfigClient is an interface for a K8s REST client. It is shared by the reconcilers and the
+// background runnables of the controller, so it is safe for concurrent use, and every read takes
+// the context of its caller.
 type ConfigClient interface {
-	SetContext(ctx context.Context)
-	GetConfigMap(name types.NamespacedName, out *corev1.ConfigMap) error
-	GetSecret(name types.NamespacedName, out *corev1.Secret) error
+	GetConfigMap(ctx context.Context, name types.NamespacedName, out *corev1.ConfigMap) error
+	GetSecret(ctx context.Context, name types.NamespacedName, out *corev1.Secret) error
 }
 
 type configClient struct {
-	ctx         context.Context
-	logger      klog.Logger
-	client      kubernetes.Interface
+	client kubernetes.Interface
+
+	// mu guards accessCache
+	mu          sync.Mutex
 	accessCache map[string]bool
 
-	verifyAccessFunc func(apiResource string, resource types.NamespacedName) error
+	verifyAccessFunc func(ctx context.Context, apiResource string, resource types.NamespacedName) error
 }
 
 // NewConfigClient creates a new K8s REST client using the configuration from the controller-runtime.
-func NewConfigClient(ctx context.Context) (ConfigClient, error) {
-	config := ctrl.GetConfigOrDie()
+func NewConfigClient() (ConfigClient, error) {
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the Kubernetes client configuration: %w", err)
+	}
 
 	// Create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
@@ -57,8 +63,6 @@ func NewConfigClient(ctx context.Context) (ConfigClient, error) {
 	client := &configClient{
 		client:      clientset,
 		accessCache: make(map[string]bool),
-		ctx:         ctx,
-		logger:      klog.NewKlogr(),
 	}
 
 	client.verifyAccessFunc = client.verifyAccessToResource
@@ -66,16 +70,10 @@ func NewConfigClient(ctx context.Context) (ConfigClient, error) {
 	return client, nil
 }
 
-// SetContext sets the context for the client.
-func (c *configClient) SetContext(ctx context.Context) {
-	c.ctx = ctx
-	c.logger = klog.FromContext(ctx)
-}
-
 // verifyAccessToResource verifies that the client has access to a given resource in a given namespace
 // by creating a SelfSubjectAccessReview. This is done to avoid errors when the client does not have
 // access to the resource.
-func (c *configClient) verifyAccessToResource(apiResource string, resource types.NamespacedName) error {
+func (c *configClient) verifyAccessToResource(ctx context.Context, apiResource string, resource types.NamespacedName) error {
 	verbs := []string{"get", "list", "watch"}
 
 	for _, verb := range verbs {
@@ -92,40 +90,35 @@ func (c *configClient) verifyAccessToResource(apiResource string, resource types
 			},
 		}
 
-		ssar, err := c.client.AuthorizationV1().SelfSubjectAccessReviews().Create(c.ctx, ssar, metav1.CreateOptions{})
+		ssar, err := c.client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, ssar, metav1.CreateOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to create SelfSubjectAccessReview to check access to %s for verb %q: %w", apiResource, verb, err)
 		}
 
 		if !ssar.Status.Allowed {
-			return fmt.Errorf("client does not have access to %s called %q for verb %q, reason: %v", apiResource, resource.String(), verb, ssar.Status.String())
+			return fmt.Errorf("client does not have access to %s called %q for verb %q, reason: %v. Grant the controller's ServiceAccount the get, list and watch verbs on %s in namespace %q, "+
+				"for example with a Role and RoleBinding, or deploy the controller with secret access granted at the cluster level", apiResource, resource.String(), verb, ssar.Status.String(), apiResource, resource.Namespace)
 		}
 	}
 
-	c.logger.Info(fmt.Sprintf("Client has access to %s called %q", apiResource, resource.String()))
+	klog.FromContext(ctx).Info(fmt.Sprintf("Client has access to %s called %q", apiResource, resource.String()))
 
 	return nil
 }
 
 // GetConfigMap gets the configmap with the given name and namespace and copies it into the out parameter.
-func (c *configClient) GetConfigMap(name types.NamespacedName, out *corev1.ConfigMap) error {
+func (c *configClient) GetConfigMap(ctx context.Context, name types.NamespacedName, out *corev1.ConfigMap) error {
 	if c == nil {
 		return fmt.Errorf("config client is nil")
 	}
 
 	// Check if the client has access to the configmap resource
-	if _, ok := c.accessCache[name.String()]; !ok {
-		// If this is the first time the client is accessing the resource and it does have
-		// permission, add it to the access cache so that it does not need to be checked again.
-		err := c.verifyAccessFunc("configmaps", name)
-		if err != nil {
-			return err
-		}
-		c.accessCache[name.String()] = true
+	if err := c.verifyAccess(ctx, "configmaps", name); err != nil {
+		return err
 	}
 
 	// Get the configmap
-	configmap, err := c.client.CoreV1().ConfigMaps(name.Namespace).Get(c.ctx, name.Name, metav1.GetOptions{})
+	configmap, err := c.client.CoreV1().ConfigMaps(name.Namespace).Get(ctx, name.Name, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
@@ -136,24 +129,18 @@ func (c *configClient) GetConfigMap(name types.NamespacedName, out *corev1.Confi
 }
 
 // GetSecret gets the secret with the given name and namespace and copies it into the out parameter.
-func (c *configClient) GetSecret(name types.NamespacedName, out *corev1.Secret) error {
+func (c *configClient) GetSecret(ctx context.Context, name types.NamespacedName, out *corev1.Secret) error {
 	if c == nil {
 		return fmt.Errorf("config client is nil")
 	}
 
 	// Check if the client has access to the secret resource
-	if _, ok := c.accessCache[name.String()]; !ok {
-		// If this is the first time the client is accessing the resource and it does have
-		// permission, add it to the access cache so that it does not need to be checked again.
-		err := c.verifyAccessFunc("secrets", name)
-		if err != nil {
-			return err
-		}
-		c.accessCache[name.String()] = true
+	if err := c.verifyAccess(ctx, "secrets", name); err != nil {
+		return err
 	}
 
 	// Get the secret
-	secret, err := c.client.CoreV1().Secrets(name.Namespace).Get(c.ctx, name.Name, metav1.GetOptions{})
+	secret, err := c.client.CoreV1().Secrets(name.Namespace).Get(ctx, name.Name, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
@@ -162,3 +149,24 @@ func (c *configClient) GetSecret(name types.NamespacedName, out *corev1.Secret)
 	secret.DeepCopyInto(out)
 	return nil
 }
+
+// verifyAccess verifies that the client has access to the resource, unless it did before.
+// Concurrent first reads of a resource may each verify the access, which is harmless.
+func (c *configClient) verifyAccess(ctx context.Context, apiResource string, name types.NamespacedName) error {
+	c.mu.Lock()
+	verified := c.accessCache[name.String()]
+	c.mu.Unlock()
+	if verified {
+		return nil
+	}
+
+	// If this is the first time the client is accessing the resource and it does have
+	// permission, add it to the access cache so that it does not need to be checked again.
+	if err := c.verifyAccessFunc(ctx, apiResource, name); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.accessCache[name.String()] = true
+	c.mu.Unlock()
+	return nil
+}
@@ -18,6 +18,7 @@ package util
 
 import (
 	"context"
+	"fmt"
 	logrtesting "github.com/go-logr/logr/testr"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
@@ -26,6 +27,8 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -63,17 +66,17 @@ func TestConfigClient(t *testing.T) {
 
 	// The fake client doesn't implement authorization.k8s.io/v1 SelfSubjectAccessReview
 	// So we'll mock the verifyAccessFunc
-	client.verifyAccessFunc = func(apiResource string, resource types.NamespacedName) error {
+	client.verifyAccessFunc = func(ctx context.Context, apiResource string, resource types.NamespacedName) error {
 		return nil
 	}
 
-	// Setup logging for test environment by setting the context
-	client.SetContext(ctrl.LoggerInto(context.TODO(), logrtesting.New(t)))
+	// Setup logging for test environment with the context of the reads
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.New(t))
 
 	t.Run("GetConfigMap", func(t *testing.T) {
 		// Test GetConfigMap
 		var out corev1.ConfigMap
-		err = client.GetConfigMap(configMapName, &out)
+		err = client.GetConfigMap(ctx, configMapName, &out)
 		assert.NoError(t, err)
 		assert.Equal(t, testConfigMap, &out)
 	})
@@ -81,8 +84,66 @@ func TestConfigClient(t *testing.T) {
 	t.Run("GetSecret", func(t *testing.T) {
 		// Test GetSecret
 		var out corev1.Secret
-		err = client.GetSecret(secretName, &out)
+		err = client.GetSecret(ctx, secretName, &out)
 		assert.NoError(t, err)
 		assert.Equal(t, testSecret, &out)
 	})
 }
+
+func TestConfigClientConcurrentReads(t *testing.T) {
+	const readers = 20
+
+	var objects []runtime.Object
+	for i := 0; i < readers; i++ {
+		objects = append(objects,
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("secret-%d", i), Namespace: "default"}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("configmap-%d", i), Namespace: "default"}},
+		)
+	}
+
+	var verified atomic.Int32
+	client := &configClient{
+		client:      fake.NewSimpleClientset(objects...),
+		accessCache: make(map[string]bool),
+	}
+	client.verifyAccessFunc = func(ctx context.Context, apiResource string, resource types.NamespacedName) error {
+		verified.Add(1)
+		return ctx.Err()
+	}
+
+	// Every reader reads with its own context, and half of them with a cancelled one. The reads with
+	// a live context must not be affected by the concurrent reads with a cancelled context.
+	var wg sync.WaitGroup
+	errs := make([]error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			if i%2 == 1 {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			var secret corev1.Secret
+			if err := client.GetSecret(ctx, types.NamespacedName{Name: fmt.Sprintf("secret-%d", i), Namespace: "default"}, &secret); err != nil {
+				errs[i] = err
+				return
+			}
+			var configMap corev1.ConfigMap
+			errs[i] = client.GetConfigMap(ctx, types.NamespacedName{Name: fmt.Sprintf("configmap-%d", i), Namespace: "default"}, &configMap)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%2 == 1 {
+			assert.ErrorIs(t, err, context.Canceled)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	// The access to the resources read with a live context was cached
+	assert.Len(t, client.accessCache, readers)
+	assert.Equal(t, int32(readers+readers/2), verified.Load())
+}
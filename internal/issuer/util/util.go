@@ -20,8 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
@@ -41,8 +43,34 @@ func GetSpecAndStatus(issuer client.Object) (*commandissuer.IssuerSpec, *command
 	}
 }
 
-// SetReadyCondition is a helper function that sets the Ready condition on an IssuerStatus.
-func SetReadyCondition(status *commandissuer.IssuerStatus, conditionStatus commandissuer.ConditionStatus, reason, message string) {
+// GetSecretNamespace is a helper function that returns the namespace that the Secrets referenced
+// by an Issuer or ClusterIssuer are read from. Issuers read Secrets from their own namespace if the
+// controller was granted access to Secrets at the cluster level, and from the cluster resource
+// namespace otherwise. ClusterIssuers read Secrets from spec.commandSecretNamespace if set, then
+// from clusterIssuerSecretNamespace if set, and from the cluster resource namespace otherwise.
+func GetSecretNamespace(issuer client.Object, clusterResourceNamespace, clusterIssuerSecretNamespace string, secretAccessGrantedAtClusterLevel bool) (string, error) {
+	switch t := issuer.(type) {
+	case *commandissuer.Issuer:
+		if secretAccessGrantedAtClusterLevel {
+			return t.Namespace, nil
+		}
+		return clusterResourceNamespace, nil
+	case *commandissuer.ClusterIssuer:
+		if t.Spec.SecretNamespace != "" {
+			return t.Spec.SecretNamespace, nil
+		}
+		if clusterIssuerSecretNamespace != "" {
+			return clusterIssuerSecretNamespace, nil
+		}
+		return clusterResourceNamespace, nil
+	default:
+		return "", fmt.Errorf("not an issuer type: %t", t)
+	}
+}
+
+// SetReadyCondition is a helper function that sets the Ready condition on an IssuerStatus for the
+// given generation of the issuer.
+func SetReadyCondition(status *commandissuer.IssuerStatus, observedGeneration int64, conditionStatus commandissuer.ConditionStatus, reason, message string) {
 	ready := GetReadyCondition(status)
 	if ready == nil {
 		ready = &commandissuer.IssuerCondition{
@@ -57,6 +85,7 @@ func SetReadyCondition(status *commandissuer.IssuerStatus, conditionStatus comma
 	}
 	ready.Reason = reason
 	ready.Message = message
+	ready.ObservedGeneration = observedGeneration
 
 	for i, c := range status.Conditions {
 		if c.Type == commandissuer.IssuerConditionReady {
@@ -76,14 +105,39 @@ func GetReadyCondition(status *commandissuer.IssuerStatus) *commandissuer.Issuer
 	return nil
 }
 
-// IsReady is a helper function that returns true if the Ready condition is set to True.
-func IsReady(status *commandissuer.IssuerStatus) bool {
+// IsReady is a helper function that returns true if the Ready condition is set to True for the
+// given generation of the issuer. A Ready condition set for an older generation is stale, since the
+// spec changed after it was checked. Conditions without an observed generation, which were set
+// before it was recorded, are assumed to be current.
+func IsReady(status *commandissuer.IssuerStatus, generation int64) bool {
 	if c := GetReadyCondition(status); c != nil {
+		if c.ObservedGeneration != 0 && c.ObservedGeneration < generation {
+			return false
+		}
 		return c.Status == commandissuer.ConditionTrue
 	}
 	return false
 }
 
+// ParseNamespaces parses a comma-separated list of namespaces, e.g. the value of a flag. Empty entries
+// and duplicates are skipped.
+func ParseNamespaces(value string) ([]string, error) {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces, nil
+}
+
 var ErrNotInCluster = errors.New("not running in-cluster")
 
 // Copied from controller-runtime/pkg/leaderelection
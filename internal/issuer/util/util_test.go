@@ -0,0 +1,105 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	commandissuer "github.com/Keyfactor/command-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	tests := []struct {
+		name               string
+		value              string
+		expectedNamespaces []string
+		expectError        bool
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name:               "Namespaces",
+			value:              "tenant-a, tenant-b,,tenant-a",
+			expectedNamespaces: []string{"tenant-a", "tenant-b"},
+		},
+		{
+			name:        "InvalidNamespace",
+			value:       "tenant-a,Tenant_B",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespaces, err := ParseNamespaces(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedNamespaces, namespaces)
+		})
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		condition  *commandissuer.IssuerCondition
+		generation int64
+		expected   bool
+	}{
+		{
+			name:       "NoCondition",
+			generation: 1,
+		},
+		{
+			name:       "Ready",
+			condition:  &commandissuer.IssuerCondition{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue, ObservedGeneration: 2},
+			generation: 2,
+			expected:   true,
+		},
+		{
+			name:       "NotReady",
+			condition:  &commandissuer.IssuerCondition{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionFalse, ObservedGeneration: 2},
+			generation: 2,
+		},
+		{
+			name:       "StaleGeneration",
+			condition:  &commandissuer.IssuerCondition{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue, ObservedGeneration: 1},
+			generation: 2,
+		},
+		{
+			name:       "NoObservedGeneration",
+			condition:  &commandissuer.IssuerCondition{Type: commandissuer.IssuerConditionReady, Status: commandissuer.ConditionTrue},
+			generation: 2,
+			expected:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status commandissuer.IssuerStatus
+			if tt.condition != nil {
+				status.Conditions = []commandissuer.IssuerCondition{*tt.condition}
+			}
+			assert.Equal(t, tt.expected, IsReady(&status, tt.generation))
+		})
+	}
+}
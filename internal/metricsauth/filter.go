@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metricsauth authenticates and authorizes requests to the metrics endpoint with the
+// Kubernetes API server.
+package metricsauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/rest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// WithAuthenticationAndAuthorization is a metricsserver.Options FilterProvider that requires a
+// bearer token on every request to the metrics endpoint. The token is authenticated with a
+// TokenReview, and the user is authorized to get the request path with a SubjectAccessReview.
+//
+// The controller needs permission to create tokenreviews and subjectaccessreviews, and scrapers
+// need a ClusterRole allowing get on the nonResourceURL /metrics.
+func WithAuthenticationAndAuthorization(config *rest.Config, httpClient *http.Client) (metricsserver.Filter, error) {
+	clientset, err := kubernetes.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Kubernetes client of the metrics endpoint: %w", err)
+	}
+
+	return newFilter(clientset.AuthenticationV1().TokenReviews(), clientset.AuthorizationV1().SubjectAccessReviews()), nil
+}
+
+// newFilter returns a metricsserver.Filter that authenticates and authorizes requests with the given clients
+func newFilter(tokenReviews authenticationv1client.TokenReviewInterface, subjectAccessReviews authorizationv1client.SubjectAccessReviewInterface) metricsserver.Filter {
+	return func(log logr.Logger, handler http.Handler) (http.Handler, error) {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			token, ok := bearerToken(r)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			tokenReview, err := tokenReviews.Create(ctx, &authenticationv1.TokenReview{
+				Spec: authenticationv1.TokenReviewSpec{Token: token},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				log.Error(err, "failed to authenticate a request to the metrics endpoint")
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !tokenReview.Status.Authenticated {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			user := tokenReview.Status.User
+			extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+			for key, value := range user.Extra {
+				extra[key] = authorizationv1.ExtraValue(value)
+			}
+			subjectAccessReview, err := subjectAccessReviews.Create(ctx, &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+						Path: r.URL.Path,
+						Verb: strings.ToLower(r.Method),
+					},
+					User:   user.Username,
+					Groups: user.Groups,
+					UID:    user.UID,
+					Extra:  extra,
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				log.Error(err, "failed to authorize a request to the metrics endpoint", "user", user.Username)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !subjectAccessReview.Status.Allowed {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		}), nil
+	}
+}
+
+// bearerToken returns the bearer token of the request's Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
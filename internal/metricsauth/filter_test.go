@@ -0,0 +1,112 @@
+/*
+Copyright 2023 Keyfactor.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logrtesting "github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		authorization  string
+		tokenReviewErr error
+		expectedStatus int
+	}{
+		{
+			name:           "NoToken",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "BasicAuth",
+			authorization:  "Basic dXNlcjpwYXNz",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "InvalidToken",
+			authorization:  "Bearer invalid",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Forbidden",
+			authorization:  "Bearer forbidden",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Allowed",
+			authorization:  "Bearer allowed",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "TokenReviewError",
+			authorization:  "Bearer allowed",
+			tokenReviewErr: errors.New("simulated API server error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if tt.tokenReviewErr != nil {
+					return true, nil, tt.tokenReviewErr
+				}
+				review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+				if review.Spec.Token != "invalid" {
+					review.Status.Authenticated = true
+					review.Status.User.Username = "system:serviceaccount:monitoring:" + review.Spec.Token
+				}
+				return true, review, nil
+			})
+			clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+				review.Status.Allowed = review.Spec.User == "system:serviceaccount:monitoring:allowed" &&
+					review.Spec.NonResourceAttributes.Path == "/metrics" &&
+					review.Spec.NonResourceAttributes.Verb == "get"
+				return true, review, nil
+			})
+
+			filter := newFilter(clientset.AuthenticationV1().TokenReviews(), clientset.AuthorizationV1().SubjectAccessReviews())
+			handler, err := filter(logrtesting.New(t), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			require.NoError(t, err)
+
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
@@ -21,22 +21,37 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Keyfactor/command-issuer/internal/controllers"
+	"github.com/Keyfactor/command-issuer/internal/issuer/manifest"
 	"github.com/Keyfactor/command-issuer/internal/issuer/signer"
 	"github.com/Keyfactor/command-issuer/internal/issuer/util"
+	"github.com/Keyfactor/command-issuer/internal/metricsauth"
+	"github.com/Keyfactor/command-issuer/internal/version"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
 	"k8s.io/utils/clock"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -62,32 +77,458 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var metricsSecure bool
+	var metricsRequireAuthn bool
+	var metricsCertDir string
+	var metricsCertName string
+	var metricsKeyName string
 	var enableLeaderElection bool
+	var leaderElectionNamespace string
+	var leaseDuration time.Duration
+	var renewDeadline time.Duration
+	var retryPeriod time.Duration
 	var probeAddr string
 	var clusterResourceNamespace string
+	var clusterIssuerSecretNamespace string
 	var printVersion bool
 	var disableApprovedCheck bool
+	var disableIssuerApprovedCheck bool
+	var disableClusterIssuerApprovedCheck bool
+	var approvedCheckExemptNamespaceSelector string
 	var secretAccessGrantedAtClusterLevel bool
+	var enrollmentLogSampleRate int
+	var readinessEndpointName string
+	var commandReadinessInterval time.Duration
+	var issuerRetryInterval time.Duration
+	var issuerHealthCheckJitter float64
+	var enableWebhooks bool
+	var webhookPort int
+	var certificateRequestDefaultsConfigMap string
+	var logFormat string
+	var logLevels string
+	var requestIDHeader string
+	var commandInsecureSkipVerify bool
+	var enrollmentPollInterval time.Duration
+	var enrollmentMaxPendingDuration time.Duration
+	var certificateRequestTimeout time.Duration
+	var clockSkewTolerance time.Duration
+	var shutdownGracePeriod time.Duration
+	var recordCertificateFingerprints bool
+	var maxEnrollmentAttempts int
+	var maxConditionMessageLength int
+	var issuerRefDiagnostics bool
+	var priorityCertificateRequestWorkers int
+	var backpressureSensitivity float64
+	var backpressureMaxInterval time.Duration
+	var enrollmentCoalescingWindow time.Duration
+	var auditLogPath string
+	var enrollmentWebhookURL string
+	var enrollmentWebhookTokenFile string
+	var enrollmentWebhookTimeout time.Duration
+	var enrollmentWebhookRetries int
+	var enrollmentWebhookConcurrency int
+	var watchNamespaces string
+	var enableClusterIssuers bool
+	var skipEnrollmentAnnotation string
+	var validateIssuerPath string
+	var selfTestPath string
+	var selfTestCertificateTemplate string
+	var selfTestRevoke bool
+	var userAgentSuffix string
+	var clusterName string
+	var expiryScanInterval time.Duration
+	var expiryScanThreshold time.Duration
+	var expiryScanEvents bool
+	var maxCSRSANs int
+	var maxCSRSize int
+	var enableCertificateSigningRequests bool
+	var commandMaxIdleConns int
+	var commandMaxIdleConnsPerHost int
+	var commandIdleConnTimeout time.Duration
+	var commandSchemaRefreshInterval time.Duration
+	var commandCAChainCacheTTL time.Duration
+	var skipTemplateKeyTypeCheck bool
+	var commandCircuitBreakerThreshold int
+	var commandCircuitBreakerCooldown time.Duration
+	var commandCircuitBreakerMaxCooldown time.Duration
+	var commandRateLimit int
+	var commandRateLimitBurst int
+	var commandRateLimitDistributed bool
+	var certificateSigningRequestSignerDomain string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&metricsSecure, "metrics-secure", false,
+		"Serve the metrics endpoint over HTTPS instead of plaintext HTTP.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "",
+		"The directory containing the certificate and key of the HTTPS metrics endpoint. If empty, a self-signed certificate is generated.")
+	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The file name of the certificate in --metrics-cert-dir.")
+	flag.StringVar(&metricsKeyName, "metrics-key-name", "tls.key", "The file name of the private key in --metrics-cert-dir.")
+	flag.BoolVar(&metricsRequireAuthn, "metrics-require-authn", false,
+		"Require a bearer token that is authenticated and authorized with the Kubernetes API server to access the metrics endpoint. Requires --metrics-secure.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&readinessEndpointName, "readiness-endpoint-name", "/readyz", "The path of the readiness probe endpoint.")
+	flag.DurationVar(&commandReadinessInterval, "command-readiness-interval", 30*time.Second,
+		"How often Command is probed in the background for the readiness endpoint, which reports the result of the last probe.")
+	flag.DurationVar(&issuerRetryInterval, "issuer-retry-interval", time.Minute,
+		"How long to wait before checking the health of a not-ready Issuer or ClusterIssuer again. Set to 0 to retry with exponential backoff.")
+	flag.Float64Var(&issuerHealthCheckJitter, "issuer-health-check-jitter", 0.1,
+		"The fraction by which the interval between Issuer and ClusterIssuer health checks is randomized in either direction, so that the checks of issuers created at the same time are spread out. Must be in [0, 1). Set to 0 to disable.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace in which the leader election lease is created. Defaults to the namespace the controller runs in.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"The duration that non-leader candidates will wait to force acquire leadership.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"The duration that the acting leader will retry refreshing leadership before giving up.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"The duration the leader election clients should wait between tries of actions.")
 	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "", "The namespace for secrets in which cluster-scoped resources are found.")
+	flag.StringVar(&clusterIssuerSecretNamespace, "cluster-issuer-secret-namespace", "",
+		"The namespace that ClusterIssuers without commandSecretNamespace read their secrets from. Defaults to --cluster-resource-namespace.")
 	flag.BoolVar(&printVersion, "version", false, "Print version to stdout and exit")
 	flag.BoolVar(&disableApprovedCheck, "disable-approved-check", false,
 		"Disables waiting for CertificateRequests to have an approved condition before signing.")
+	flag.BoolVar(&disableIssuerApprovedCheck, "disable-issuer-approved-check", false,
+		"Disables waiting for CertificateRequests that reference an Issuer to have an approved condition before signing.")
+	flag.BoolVar(&disableClusterIssuerApprovedCheck, "disable-cluster-issuer-approved-check", false,
+		"Disables waiting for CertificateRequests that reference a ClusterIssuer to have an approved condition before signing.")
+	flag.StringVar(&approvedCheckExemptNamespaceSelector, "approved-check-exempt-namespace-selector", "",
+		"A label selector of the namespaces whose CertificateRequests are signed without waiting for an approved condition, e.g. 'command-issuer.keyfactor.com/auto-approve=true'. If empty, the approved condition is checked in every namespace.")
 	flag.BoolVar(&secretAccessGrantedAtClusterLevel, "secret-access-granted-at-cluster-level", false,
 		"Set this flag to true if the secret access is granted at cluster level. This will allow the controller to access secrets in any namespace. ")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enables the validating admission webhooks for Issuer and ClusterIssuer resources, and the mutating webhook for CertificateRequests if --certificate-request-defaults-configmap is set. Requires a serving certificate for the webhook server.")
+	flag.IntVar(&webhookPort, "webhook-bind-port", 9443, "The port the webhook server binds to.")
+	flag.StringVar(&certificateRequestDefaultsConfigMap, "certificate-request-defaults-configmap", "",
+		"The name of a ConfigMap in --cluster-resource-namespace with default annotations and labels that a mutating webhook adds to new CertificateRequests of Issuers and ClusterIssuers. Requires --enable-webhooks. If empty, no defaults are added.")
+	flag.IntVar(&enrollmentLogSampleRate, "enrollment-log-sample-rate", 1,
+		"Log the informational request logs of 1 in N enrollments per Issuer/ClusterIssuer. Errors are always logged.")
+	flag.DurationVar(&enrollmentPollInterval, "enrollment-poll-interval", time.Minute,
+		"How often an enrollment that is awaiting approval in Command is polled.")
+	flag.DurationVar(&enrollmentMaxPendingDuration, "enrollment-max-pending-duration", 24*time.Hour,
+		"How long an enrollment may await approval in Command before the CertificateRequest is marked as Failed. Set to 0 to wait indefinitely.")
+	flag.IntVar(&maxEnrollmentAttempts, "max-enrollment-attempts", 0,
+		"How many enrollments of a CertificateRequest or CertificateSigningRequest may fail before it is marked as Failed, e.g. because Command can never issue the CSR. Failures caused by the unavailability of Command aren't counted. Set to 0 to retry indefinitely.")
+	flag.IntVar(&maxConditionMessageLength, "max-condition-message-length", controllers.DefaultMaxConditionMessageLength,
+		fmt.Sprintf("The maximum length in bytes of the condition messages of CertificateRequests, CertificateSigningRequests, Issuers, and ClusterIssuers. Longer messages are truncated with an ellipsis, and the full message is recorded as an Event. Must be at least %d. Set to 0 to disable.", controllers.MinMaxConditionMessageLength))
+	flag.BoolVar(&issuerRefDiagnostics, "issuer-ref-diagnostics", true,
+		"Record an Event on CertificateRequests of this group explaining why the referenced Issuer or ClusterIssuer can't be used, e.g. because issuerRef has a misspelled name or kind, or the issuer isn't ready.")
+	flag.IntVar(&priorityCertificateRequestWorkers, "priority-certificate-request-workers", 1,
+		"How many CertificateRequests annotated with command-issuer.keyfactor.com/priority: high are reconciled at once, in a work queue of their own that isn't shared with the other CertificateRequests. Set to 0 to ignore the annotation.")
+	flag.Float64Var(&backpressureSensitivity, "backpressure-sensitivity", 0,
+		"How strongly the intervals of issuer health checks and of polls of enrollments awaiting approval are lengthened while the latency of Command trends upward. With 1, the intervals grow in proportion to the increase of the recent latency over its baseline. Set to 0 to disable.")
+	flag.DurationVar(&backpressureMaxInterval, "backpressure-max-interval", 10*time.Minute,
+		"The longest interval that --backpressure-sensitivity lengthens the intervals of health checks and polls to.")
+	flag.DurationVar(&enrollmentCoalescingWindow, "enrollment-coalescing-window", 5*time.Second,
+		"How long the certificate enrolled for a CertificateRequest is reused for new CertificateRequests of the same Certificate with the same CSR, e.g. when the Certificate is edited several times in quick succession. Set to 0 to disable.")
+	flag.StringVar(&auditLogPath, "audit-log", "",
+		"Write a JSON record of every enrollment, whatever its outcome, to this file, or to stdout if set to -. The records are separate from the logs of the controller, which are written to stderr. If empty, enrollments aren't audited.")
+	flag.StringVar(&enrollmentWebhookURL, "enrollment-webhook-url", "",
+		"An http or https URL that the audit record of every issued certificate and failed enrollment is POSTed to as JSON, e.g. to notify dashboards or chatops. Notifications are sent in the background and never block reconciliation. If empty, no notifications are sent.")
+	flag.StringVar(&enrollmentWebhookTokenFile, "enrollment-webhook-token-file", "",
+		"The path of a file with a bearer token sent to --enrollment-webhook-url in the Authorization header, e.g. from a mounted Secret. The file is read for every notification. If empty, no Authorization header is sent.")
+	flag.DurationVar(&enrollmentWebhookTimeout, "enrollment-webhook-timeout", 10*time.Second,
+		"The maximum duration of each attempt to send a notification to --enrollment-webhook-url.")
+	flag.IntVar(&enrollmentWebhookRetries, "enrollment-webhook-retries", 3,
+		"How many times a notification is sent again, with an exponential backoff, after a network error or an HTTP 408, 429 or 5xx response of --enrollment-webhook-url.")
+	flag.IntVar(&enrollmentWebhookConcurrency, "enrollment-webhook-concurrency", 4,
+		"The maximum number of notifications sent to --enrollment-webhook-url at the same time.")
+	flag.DurationVar(&certificateRequestTimeout, "certificate-request-timeout", 5*time.Minute,
+		"The maximum duration of the calls to Command made while reconciling a CertificateRequest or CertificateSigningRequest. Requests that exceed it are retried. Set to 0 to disable.")
+	flag.DurationVar(&clockSkewTolerance, "clock-skew-tolerance", 0,
+		"How far the validity window of an issued certificate may be from the local time before a ClockSkew warning Event is recorded, e.g. to tolerate clock drift between the cluster and the CA.")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", 30*time.Second,
+		"How long in-flight enrollments may continue after the controller receives SIGTERM, so that certificates issued by Command are recorded in the cluster. New reconciles aren't started during this period. Should be shorter than the terminationGracePeriodSeconds of the pod. Set to 0 to cancel in-flight enrollments immediately.")
+	flag.BoolVar(&recordCertificateFingerprints, "record-certificate-fingerprints", false,
+		"Records the serial number and SHA-256 fingerprint of each issued certificate as annotations of the CertificateRequest, e.g. for correlation with external audit systems.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"A comma-separated list of namespaces whose Issuers and CertificateRequests are reconciled, e.g. to run one controller per tenant. If empty, every namespace is watched.")
+	flag.BoolVar(&enableClusterIssuers, "enable-cluster-issuers", true,
+		"Enables reconciling ClusterIssuers and the requests that reference them. Set to false if only namespaced Issuers are used, or if ClusterIssuers are handled by another instance of the controller. The controller then doesn't read ClusterIssuers or the Secrets of their namespace.")
+	flag.StringVar(&skipEnrollmentAnnotation, "skip-enrollment-annotation", controllers.DefaultSkipEnrollmentAnnotation,
+		"The annotation that marks a CertificateRequest as handled manually when set to \"true\". Such requests are left untouched until the annotation is removed. Set to an empty string to disable.")
+	flag.StringVar(&requestIDHeader, "request-id-header", signer.DefaultRequestIDHeader,
+		"The HTTP header used to send a per-request ID to Command for log correlation. Set to an empty string to disable.")
+	flag.BoolVar(&commandInsecureSkipVerify, "command-insecure-skip-verify", false,
+		"UNSAFE: Disables verification of the Command server certificate for every Issuer and ClusterIssuer. Only use this in test or development environments.")
+	flag.IntVar(&commandMaxIdleConns, "command-max-idle-conns", signer.DefaultMaxIdleConns,
+		"The maximum number of idle keep-alive connections to Command across all hosts.")
+	flag.IntVar(&commandMaxIdleConnsPerHost, "command-max-idle-conns-per-host", signer.DefaultMaxIdleConnsPerHost,
+		"The maximum number of idle keep-alive connections to a single Command host.")
+	flag.DurationVar(&commandIdleConnTimeout, "command-idle-conn-timeout", signer.DefaultIdleConnTimeout,
+		"How long an idle keep-alive connection to Command is kept open. Should be shorter than the keep-alive timeout of Command's web server.")
+	flag.DurationVar(&commandSchemaRefreshInterval, "command-schema-refresh-interval", signer.DefaultSchemaRefreshInterval,
+		"How often the certificate templates and metadata fields cached from Command are refreshed. Requests referencing a template or metadata field that doesn't exist are marked as Failed without enrolling. Set to 0 to disable the validation.")
+	flag.DurationVar(&commandCAChainCacheTTL, "command-ca-chain-cache-ttl", signer.DefaultCAChainCacheTTL,
+		"How long the CA chain returned by Command is reused for enrollments with the same CA and certificate template. A chain that doesn't verify an issued certificate is fetched again. Set to 0 to fetch the chain with every enrollment.")
+	flag.BoolVar(&skipTemplateKeyTypeCheck, "skip-template-key-type-check", false,
+		"Don't check the public key type of CSRs against the key types supported by the certificate template. By default, CSRs with a key type the template doesn't support are marked as Failed without enrolling.")
+	flag.IntVar(&commandCircuitBreakerThreshold, "command-circuit-breaker-threshold", signer.DefaultCircuitBreakerThreshold,
+		"The number of consecutive failed calls to a Command host after which calls to it fail fast for --command-circuit-breaker-cooldown. Set to 0 to disable.")
+	flag.DurationVar(&commandCircuitBreakerCooldown, "command-circuit-breaker-cooldown", signer.DefaultCircuitBreakerCooldown,
+		"How long calls to a Command host fail fast after --command-circuit-breaker-threshold consecutive failures, before a single call probes whether it has recovered.")
+	flag.DurationVar(&commandCircuitBreakerMaxCooldown, "command-circuit-breaker-max-cooldown", signer.DefaultCircuitBreakerMaxCooldown,
+		"The maximum cooldown of the circuit breaker. The cooldown doubles with every failed probe of a Command host, up to this value.")
+	flag.IntVar(&commandRateLimit, "command-rate-limit", 0,
+		"The maximum number of requests per minute to Command. Requests beyond it wait until they are within the limit. Set to 0 to disable.")
+	flag.IntVar(&commandRateLimitBurst, "command-rate-limit-burst", 10,
+		"How many requests to Command may be sent at once before --command-rate-limit applies.")
+	flag.BoolVar(&commandRateLimitDistributed, "command-rate-limit-distributed", false,
+		"Share --command-rate-limit between the replicas of the controller through Leases in the leader election namespace, so that the aggregate rate of requests to Command stays within the limit. If the Leases are unavailable, each replica keeps its last share.")
+	flag.IntVar(&maxCSRSANs, "max-csr-sans", signer.DefaultMaxCSRSANs,
+		"The maximum number of SANs of a CSR. CertificateRequests with more SANs are marked as Failed without contacting Command. Set to 0 to disable.")
+	flag.IntVar(&maxCSRSize, "max-csr-size", signer.DefaultMaxCSRSize,
+		"The maximum size of a PEM-encoded CSR in bytes. Larger CertificateRequests are marked as Failed without contacting Command. Set to 0 to disable.")
+	flag.BoolVar(&enableCertificateSigningRequests, "enable-certificate-signing-requests", false,
+		"Enables enrolling Kubernetes CertificateSigningRequests (certificates.k8s.io) with the signer name issuers.<domain>/<namespace>.<name> or clusterissuers.<domain>/<name>.")
+	flag.StringVar(&certificateSigningRequestSignerDomain, "certificate-signing-request-signer-domain", controllers.DefaultSignerDomain,
+		"The domain of the signer names of the Kubernetes CertificateSigningRequests enrolled when --enable-certificate-signing-requests is set.")
+	flag.StringVar(&userAgentSuffix, "user-agent-suffix", "",
+		"Appended to the User-Agent sent to Command, which identifies the issuer and its version. Use it to tell apart the issuers of several clusters, e.g. 'cluster/prod-eu'.")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"Identifies the cluster in the Cluster-Name metadata field of every certificate enrolled in Command. The metadata field must exist in Command. If empty, the cluster isn't recorded.")
+	flag.DurationVar(&expiryScanInterval, "expiry-scan-interval", 0,
+		"How often Command is queried for the certificates enrolled through each ready Issuer and ClusterIssuer that expire within --expiry-scan-threshold, which are reported in the command_issuer_expiring_certificates metric. Set to 0 to disable.")
+	flag.DurationVar(&expiryScanThreshold, "expiry-scan-threshold", 30*24*time.Hour,
+		"How long before their expiry certificates are reported by the expiry scan.")
+	flag.BoolVar(&expiryScanEvents, "expiry-scan-events", false,
+		"Record a Warning Event on the issuers that have certificates expiring within --expiry-scan-threshold.")
+	flag.StringVar(&validateIssuerPath, "validate-issuer", "",
+		"Validate the Issuers and ClusterIssuers in the given YAML or JSON manifest file without connecting to a cluster, then exit. Exits non-zero if the manifest is invalid.")
+	flag.StringVar(&selfTestPath, "self-test", "",
+		"Enroll a throwaway certificate with the Issuer or ClusterIssuer in the given YAML or JSON manifest file, which must include the Secrets it references, verify the certificate and its chain, then exit. Exits non-zero if the self-test fails. Doesn't connect to a cluster.")
+	flag.StringVar(&selfTestCertificateTemplate, "self-test-certificate-template", "",
+		"The Command certificate template that --self-test enrolls the throwaway certificate with, instead of the template of the issuer. Required with --self-test.")
+	flag.BoolVar(&selfTestRevoke, "self-test-revoke", true,
+		"Revoke the throwaway certificate of --self-test in Command once it has been verified.")
+	flag.StringVar(&logFormat, "log-format", "console",
+		"The format of the controller logs. One of 'console' (human-readable development logs) or 'json' (structured production logs).")
+	flag.StringVar(&logLevels, "log-levels", "",
+		"A comma-separated list of name=level pairs that set the verbosity of the loggers of components, e.g. 'signer=2,controller-runtime=0'. The components are reconciler, signer, healthcheck and the loggers of controller-runtime, such as controller-runtime.cache. Other loggers use the level of --zap-log-level.")
 
-	opts := zap.Options{
-		Development: true,
-	}
+	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if printVersion {
+		fmt.Println(version.Version)
+		os.Exit(0)
+	}
+
+	if validateIssuerPath != "" {
+		os.Exit(validateIssuerManifest(validateIssuerPath))
+	}
+
+	switch logFormat {
+	case "console":
+		opts.Development = true
+	case "json":
+		opts.Development = false
+		zap.JSONEncoder()(&opts)
+	default:
+		fmt.Fprintf(os.Stderr, "invalid --log-format %q: must be one of 'console' or 'json'\n", logFormat)
+		os.Exit(1)
+	}
+
+	if issuerHealthCheckJitter < 0 || issuerHealthCheckJitter >= 1 {
+		fmt.Fprintf(os.Stderr, "invalid --issuer-health-check-jitter %v: must be at least 0 and less than 1\n", issuerHealthCheckJitter)
+		os.Exit(1)
+	}
+
+	if expiryScanInterval > 0 && expiryScanThreshold <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid --expiry-scan-threshold %v: must be positive\n", expiryScanThreshold)
+		os.Exit(1)
+	}
+
+	if commandMaxIdleConns <= 0 || commandMaxIdleConnsPerHost <= 0 || commandIdleConnTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "--command-max-idle-conns, --command-max-idle-conns-per-host, and --command-idle-conn-timeout must be greater than 0")
+		os.Exit(1)
+	}
+	transportOptions := signer.TransportOptions{
+		MaxIdleConns:        commandMaxIdleConns,
+		MaxIdleConnsPerHost: commandMaxIdleConnsPerHost,
+		IdleConnTimeout:     commandIdleConnTimeout,
+	}
+
+	if certificateRequestTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --certificate-request-timeout %v: must not be negative\n", certificateRequestTimeout)
+		os.Exit(1)
+	}
+
+	if maxEnrollmentAttempts < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --max-enrollment-attempts %d: must not be negative\n", maxEnrollmentAttempts)
+		os.Exit(1)
+	}
+
+	var approvedCheckExemptNamespaces labels.Selector
+	if approvedCheckExemptNamespaceSelector != "" {
+		var err error
+		if approvedCheckExemptNamespaces, err = labels.Parse(approvedCheckExemptNamespaceSelector); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --approved-check-exempt-namespace-selector %q: %v\n", approvedCheckExemptNamespaceSelector, err)
+			os.Exit(1)
+		}
+	}
+
+	if maxConditionMessageLength != 0 && maxConditionMessageLength < controllers.MinMaxConditionMessageLength {
+		fmt.Fprintf(os.Stderr, "invalid --max-condition-message-length %d: must be 0 or at least %d\n", maxConditionMessageLength, controllers.MinMaxConditionMessageLength)
+		os.Exit(1)
+	}
+
+	if priorityCertificateRequestWorkers < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --priority-certificate-request-workers %d: must not be negative\n", priorityCertificateRequestWorkers)
+		os.Exit(1)
+	}
+
+	if backpressureSensitivity < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --backpressure-sensitivity %v: must not be negative\n", backpressureSensitivity)
+		os.Exit(1)
+	}
+
+	if backpressureSensitivity > 0 && backpressureMaxInterval <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid --backpressure-max-interval %v: must be greater than zero\n", backpressureMaxInterval)
+		os.Exit(1)
+	}
+
+	if enrollmentCoalescingWindow < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --enrollment-coalescing-window %v: must not be negative\n", enrollmentCoalescingWindow)
+		os.Exit(1)
+	}
+
+	if clockSkewTolerance < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --clock-skew-tolerance %v: must not be negative\n", clockSkewTolerance)
+		os.Exit(1)
+	}
+
+	if shutdownGracePeriod < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --shutdown-grace-period %v: must not be negative\n", shutdownGracePeriod)
+		os.Exit(1)
+	}
+
+	watchedNamespaces, err := util.ParseNamespaces(watchNamespaces)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --watch-namespaces: %v\n", err)
+		os.Exit(1)
+	}
+
+	if commandCircuitBreakerThreshold < 0 || commandCircuitBreakerCooldown <= 0 {
+		fmt.Fprintln(os.Stderr, "--command-circuit-breaker-threshold must not be negative and --command-circuit-breaker-cooldown must be greater than 0")
+		os.Exit(1)
+	}
+	var circuitBreaker *signer.CircuitBreaker
+	if commandCircuitBreakerThreshold > 0 {
+		circuitBreaker = signer.NewCircuitBreaker(commandCircuitBreakerThreshold, commandCircuitBreakerCooldown, commandCircuitBreakerMaxCooldown)
+	}
+
+	if commandRateLimit < 0 || commandRateLimitBurst < 0 {
+		fmt.Fprintln(os.Stderr, "--command-rate-limit and --command-rate-limit-burst must not be negative")
+		os.Exit(1)
+	}
+	var rateLimiter *controllers.DistributedRateLimiter
+	var commandRateLimiter *rate.Limiter
+	if commandRateLimit > 0 {
+		rateLimiter = controllers.NewDistributedRateLimiter(commandRateLimit, commandRateLimitBurst)
+		commandRateLimiter = rateLimiter.Limiter()
+	}
+
+	if commandSchemaRefreshInterval < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --command-schema-refresh-interval %v: must not be negative\n", commandSchemaRefreshInterval)
+		os.Exit(1)
+	}
+	var schemaCache *signer.SchemaCache
+	if commandSchemaRefreshInterval > 0 {
+		schemaCache = signer.NewSchemaCache(commandSchemaRefreshInterval)
+		schemaCache.SkipKeyTypeCheck = skipTemplateKeyTypeCheck
+	}
+
+	if commandCAChainCacheTTL < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --command-ca-chain-cache-ttl %v: must not be negative\n", commandCAChainCacheTTL)
+		os.Exit(1)
+	}
+	var caChainCache *signer.CAChainCache
+	if commandCAChainCacheTTL > 0 {
+		caChainCache = signer.NewCAChainCache(commandCAChainCacheTTL)
+	}
+
+	var auditLogger *controllers.AuditLogger
+	switch auditLogPath {
+	case "":
+	case "-":
+		auditLogger = &controllers.AuditLogger{Writer: os.Stdout}
+	default:
+		auditLog, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to open --audit-log %s: %v\n", auditLogPath, err)
+			os.Exit(1)
+		}
+		defer auditLog.Close()
+		auditLogger = &controllers.AuditLogger{Writer: auditLog}
+	}
+
+	var enrollmentNotifier *controllers.EnrollmentNotifier
+	if enrollmentWebhookURL != "" {
+		if u, err := url.Parse(enrollmentWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "invalid --enrollment-webhook-url %q: must be an http or https URL\n", enrollmentWebhookURL)
+			os.Exit(1)
+		}
+		if enrollmentWebhookTimeout <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid --enrollment-webhook-timeout %v: must be positive\n", enrollmentWebhookTimeout)
+			os.Exit(1)
+		}
+		if enrollmentWebhookRetries < 0 {
+			fmt.Fprintf(os.Stderr, "invalid --enrollment-webhook-retries %d: must not be negative\n", enrollmentWebhookRetries)
+			os.Exit(1)
+		}
+		if enrollmentWebhookConcurrency < 1 {
+			fmt.Fprintf(os.Stderr, "invalid --enrollment-webhook-concurrency %d: must be at least 1\n", enrollmentWebhookConcurrency)
+			os.Exit(1)
+		}
+		enrollmentNotifier = &controllers.EnrollmentNotifier{
+			URL:         enrollmentWebhookURL,
+			TokenFile:   enrollmentWebhookTokenFile,
+			Clock:       clock.RealClock{},
+			Timeout:     enrollmentWebhookTimeout,
+			Retries:     enrollmentWebhookRetries,
+			Concurrency: enrollmentWebhookConcurrency,
+		}
+	}
+
+	if metricsRequireAuthn && !metricsSecure {
+		fmt.Fprintln(os.Stderr, "--metrics-require-authn requires --metrics-secure, since bearer tokens must not be sent in plaintext")
+		os.Exit(1)
+	}
+
+	if err := signer.ValidateUserAgentSuffix(userAgentSuffix); err != nil {
+		fmt.Fprintf(os.Stderr, "--user-agent-suffix: %v\n", err)
+		os.Exit(1)
+	}
+
+	componentLogLevels, err := controllers.ParseComponentLogLevels(logLevels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --log-levels: %v\n", err)
+		os.Exit(1)
+	}
+	// The loggers of components may be more verbose than the others, so zap is enabled up to the
+	// highest level and the components filter their own logs
+	defaultLogLevel := zapVerbosity(&opts)
+	if maxLevel := componentLogLevels.MaxLevel(); maxLevel > defaultLogLevel {
+		opts.Level = zapcore.Level(-maxLevel)
+	}
+	ctrl.SetLogger(componentLogLevels.Logger(zap.New(zap.UseFlagOptions(&opts)), defaultLogLevel))
+
+	if selfTestPath != "" {
+		if selfTestCertificateTemplate == "" {
+			fmt.Fprintln(os.Stderr, "--self-test requires --self-test-certificate-template")
+			os.Exit(1)
+		}
+		ctx := signer.ContextWithUserAgentSuffix(context.Background(), userAgentSuffix)
+		ctx = signer.ContextWithTransportOptions(ctx, transportOptions)
+		os.Exit(runSelfTest(ctx, selfTestPath, commandInsecureSkipVerify, signer.SelfTestOptions{
+			CertificateTemplate: selfTestCertificateTemplate,
+			Revoke:              selfTestRevoke,
+		}))
+	}
 
 	if clusterResourceNamespace == "" {
 		var err error
@@ -107,27 +548,86 @@ func main() {
 	} else {
 		setupLog.Info(fmt.Sprintf("expecting secret access at namespace level (%s)", clusterResourceNamespace))
 	}
+	if clusterIssuerSecretNamespace != "" {
+		setupLog.Info(fmt.Sprintf("reading ClusterIssuer secrets from namespace %s", clusterIssuerSecretNamespace))
+	}
+
+	if commandInsecureSkipVerify {
+		setupLog.Info("WARNING: --command-insecure-skip-verify is set. TLS certificate verification of Command is DISABLED for every Issuer and ClusterIssuer. Never use this in production.")
+	}
 
-	ctx := context.Background()
-	configClient, err := util.NewConfigClient(ctx)
+	configClient, err := util.NewConfigClient()
 	if err != nil {
-		setupLog.Error(err, "error creating config client")
+		// Every reconcile reads Secrets with the config client, so the controller can't work without it
+		setupLog.Error(err, "unable to create the Kubernetes client that reads the Secrets and ConfigMaps of issuers. Check the kubeconfig or the service account of the controller.")
+		os.Exit(1)
 	}
 
+	// The issuer status endpoint is served by the metrics server, so it is protected like the
+	// metrics. Its client is set once the manager is created.
+	issuerStatusHandler := &controllers.IssuerStatusHandler{Clock: clock.RealClock{}, DisableClusterIssuers: !enableClusterIssuers}
+
+	// The enrollment limits of each issuer are shared by the CertificateRequest and
+	// CertificateSigningRequest reconcilers
+	issuerLimiter := controllers.NewIssuerLimiter(clock.RealClock{})
+
+	// The latency of Command is observed by all reconcilers, so that their requeues back off together
+	backpressure := controllers.NewBackpressure(backpressureSensitivity, backpressureMaxInterval, clock.RealClock{})
+
 	mtr := metricsserver.Options{
-		BindAddress: metricsAddr,
+		BindAddress:   metricsAddr,
+		SecureServing: metricsSecure,
+		CertDir:       metricsCertDir,
+		CertName:      metricsCertName,
+		KeyName:       metricsKeyName,
+		ExtraHandlers: map[string]http.Handler{
+			controllers.IssuerStatusEndpoint: issuerStatusHandler,
+		},
+	}
+	if metricsRequireAuthn {
+		mtr.FilterProvider = metricsauth.WithAuthenticationAndAuthorization
 	}
 	hookServer := webhookserver.NewServer(webhookserver.Options{
-		Port: 9443,
+		Port: webhookPort,
 	})
 
+	// Cluster-scoped resources, like ClusterIssuers and CertificateSigningRequests, are still watched
+	// cluster-wide if the cache is limited to some namespaces
+	var cacheOptions cache.Options
+	if len(watchedNamespaces) > 0 {
+		setupLog.Info(fmt.Sprintf("watching namespaces %s", strings.Join(watchedNamespaces, ", ")))
+		cacheOptions.DefaultNamespaces = make(map[string]cache.Config)
+		for _, namespace := range watchedNamespaces {
+			cacheOptions.DefaultNamespaces[namespace] = cache.Config{}
+		}
+
+		// ClusterIssuers reference CommandIssuerProfiles in the cluster resource namespace, which
+		// is cached for profiles even if it isn't watched
+		profileNamespaces := map[string]cache.Config{clusterResourceNamespace: {}}
+		for namespace := range cacheOptions.DefaultNamespaces {
+			profileNamespaces[namespace] = cache.Config{}
+		}
+		cacheOptions.ByObject = map[client.Object]cache.ByObject{
+			&commandissuerv1alpha1.CommandIssuerProfile{}: {Namespaces: profileNamespaces},
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                mtr,
-		WebhookServer:          hookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "b68cef20.keyfactor.com",
+		Scheme:                  scheme,
+		Cache:                   cacheOptions,
+		Metrics:                 mtr,
+		WebhookServer:           hookServer,
+		HealthProbeBindAddress:  probeAddr,
+		ReadinessEndpointName:   readinessEndpointName,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "b68cef20.keyfactor.com",
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaseDuration:           &leaseDuration,
+		RenewDeadline:           &renewDeadline,
+		RetryPeriod:             &retryPeriod,
+		// In-flight reconciles run for up to the grace period after the manager is stopped, so the
+		// manager waits longer than that for its controllers to stop
+		GracefulShutdownTimeout: managerShutdownTimeout(shutdownGracePeriod),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -144,6 +644,28 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	issuerStatusHandler.Client = mgr.GetClient()
+
+	if rateLimiter != nil && commandRateLimitDistributed {
+		rateLimiter.Client = mgr.GetClient()
+		rateLimiter.Reader = mgr.GetAPIReader()
+		rateLimiter.LeaderElection = enableLeaderElection
+		rateLimiter.Namespace = leaderElectionNamespace
+		if rateLimiter.Namespace == "" {
+			rateLimiter.Namespace = clusterResourceNamespace
+		}
+		// The pod name identifies the replica
+		if rateLimiter.Identity, err = os.Hostname(); err != nil {
+			setupLog.Error(err, "unable to determine the identity of this replica for the distributed rate limit")
+			os.Exit(1)
+		}
+		if err = mgr.Add(rateLimiter); err != nil {
+			setupLog.Error(err, "unable to set up the distributed rate limit")
+			os.Exit(1)
+		}
+	} else if commandRateLimitDistributed {
+		setupLog.Info("WARNING: --command-rate-limit-distributed is ignored without --command-rate-limit")
+	}
 
 	if err = (&controllers.IssuerReconciler{
 		Kind:                              "Issuer",
@@ -151,37 +673,174 @@ func main() {
 		ConfigClient:                      configClient,
 		Scheme:                            mgr.GetScheme(),
 		ClusterResourceNamespace:          clusterResourceNamespace,
+		ClusterIssuerSecretNamespace:      clusterIssuerSecretNamespace,
 		SecretAccessGrantedAtClusterLevel: secretAccessGrantedAtClusterLevel,
 		HealthCheckerBuilder:              signer.CommandHealthCheckerFromIssuerAndSecretData,
+		RequestIDHeader:                   requestIDHeader,
+		RetryInterval:                     issuerRetryInterval,
+		HealthCheckJitter:                 issuerHealthCheckJitter,
+		Clock:                             clock.RealClock{},
+		CommandInsecureSkipVerify:         commandInsecureSkipVerify,
+		UserAgentSuffix:                   userAgentSuffix,
+		TransportOptions:                  transportOptions,
+		CircuitBreaker:                    circuitBreaker,
+		RateLimiter:                       commandRateLimiter,
+		IssuerStatusHandler:               issuerStatusHandler,
+		SchemaCache:                       schemaCache,
+		CAChainCache:                      caChainCache,
+		Recorder:                          mgr.GetEventRecorderFor("command-issuer"),
+		IssuerLimiter:                     issuerLimiter,
+		MaxConditionMessageLength:         maxConditionMessageLength,
+		Backpressure:                      backpressure,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Issuer")
 		os.Exit(1)
 	}
-	if err = (&controllers.IssuerReconciler{
+	if !enableClusterIssuers {
+		setupLog.Info("ClusterIssuers are disabled")
+	} else if err = (&controllers.IssuerReconciler{
 		Kind:                              "ClusterIssuer",
 		Client:                            mgr.GetClient(),
 		ConfigClient:                      configClient,
 		Scheme:                            mgr.GetScheme(),
 		ClusterResourceNamespace:          clusterResourceNamespace,
+		ClusterIssuerSecretNamespace:      clusterIssuerSecretNamespace,
 		SecretAccessGrantedAtClusterLevel: secretAccessGrantedAtClusterLevel,
 		HealthCheckerBuilder:              signer.CommandHealthCheckerFromIssuerAndSecretData,
+		RequestIDHeader:                   requestIDHeader,
+		RetryInterval:                     issuerRetryInterval,
+		HealthCheckJitter:                 issuerHealthCheckJitter,
+		Clock:                             clock.RealClock{},
+		CommandInsecureSkipVerify:         commandInsecureSkipVerify,
+		UserAgentSuffix:                   userAgentSuffix,
+		TransportOptions:                  transportOptions,
+		CircuitBreaker:                    circuitBreaker,
+		RateLimiter:                       commandRateLimiter,
+		IssuerStatusHandler:               issuerStatusHandler,
+		SchemaCache:                       schemaCache,
+		CAChainCache:                      caChainCache,
+		Recorder:                          mgr.GetEventRecorderFor("command-issuer"),
+		IssuerLimiter:                     issuerLimiter,
+		MaxConditionMessageLength:         maxConditionMessageLength,
+		Backpressure:                      backpressure,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterIssuer")
 		os.Exit(1)
 	}
 	if err = (&controllers.CertificateRequestReconciler{
-		Client:                            mgr.GetClient(),
-		Scheme:                            mgr.GetScheme(),
-		ConfigClient:                      configClient,
-		ClusterResourceNamespace:          clusterResourceNamespace,
-		SignerBuilder:                     signer.CommandSignerFromIssuerAndSecretData,
-		CheckApprovedCondition:            !disableApprovedCheck,
-		SecretAccessGrantedAtClusterLevel: secretAccessGrantedAtClusterLevel,
-		Clock:                             clock.RealClock{},
+		Client:                              mgr.GetClient(),
+		Scheme:                              mgr.GetScheme(),
+		ConfigClient:                        configClient,
+		ClusterResourceNamespace:            clusterResourceNamespace,
+		ClusterIssuerSecretNamespace:        clusterIssuerSecretNamespace,
+		SignerBuilder:                       signer.CommandSignerFromIssuerAndSecretData,
+		CheckApprovedCondition:              !disableApprovedCheck && !disableIssuerApprovedCheck,
+		CheckClusterIssuerApprovedCondition: !disableApprovedCheck && !disableClusterIssuerApprovedCheck,
+		ApprovedCheckExemptNamespaces:       approvedCheckExemptNamespaces,
+		IssuerRefDiagnostics:                issuerRefDiagnostics,
+		PriorityReconciles:                  priorityCertificateRequestWorkers,
+		SecretAccessGrantedAtClusterLevel:   secretAccessGrantedAtClusterLevel,
+		Clock:                               clock.RealClock{},
+		LogSampler:                          controllers.NewEnrollmentLogSampler(enrollmentLogSampleRate),
+		RequestIDHeader:                     requestIDHeader,
+		CommandInsecureSkipVerify:           commandInsecureSkipVerify,
+		UserAgentSuffix:                     userAgentSuffix,
+		ClusterName:                         clusterName,
+		TransportOptions:                    transportOptions,
+		CircuitBreaker:                      circuitBreaker,
+		RateLimiter:                         commandRateLimiter,
+		IssuerStatusHandler:                 issuerStatusHandler,
+		EnrollmentPollInterval:              enrollmentPollInterval,
+		EnrollmentMaxPendingDuration:        enrollmentMaxPendingDuration,
+		CSRLimits:                           signer.CSRLimits{MaxSANs: maxCSRSANs, MaxSize: maxCSRSize},
+		SchemaCache:                         schemaCache,
+		CAChainCache:                        caChainCache,
+		Recorder:                            mgr.GetEventRecorderFor("command-issuer"),
+		ClockSkewTolerance:                  clockSkewTolerance,
+		Timeout:                             certificateRequestTimeout,
+		ShutdownGracePeriod:                 shutdownGracePeriod,
+		RecordCertificateFingerprints:       recordCertificateFingerprints,
+		MaxEnrollmentAttempts:               maxEnrollmentAttempts,
+		EnrollmentCoalescer:                 controllers.NewEnrollmentCoalescer(enrollmentCoalescingWindow, clock.RealClock{}),
+		AuditLogger:                         auditLogger,
+		EnrollmentNotifier:                  enrollmentNotifier,
+		IssuerLimiter:                       issuerLimiter,
+		MaxConditionMessageLength:           maxConditionMessageLength,
+		Backpressure:                        backpressure,
+		DisableClusterIssuers:               !enableClusterIssuers,
+		SkipEnrollmentAnnotation:            skipEnrollmentAnnotation,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CertificateRequest")
 		os.Exit(1)
 	}
+	if enableCertificateSigningRequests {
+		// The requesters of CertificateSigningRequests for Issuers are authorized with SubjectAccessReviews
+		kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to create the Kubernetes client that authorizes CertificateSigningRequests")
+			os.Exit(1)
+		}
+		if err = (&controllers.CertificateSigningRequestReconciler{
+			Client:                            mgr.GetClient(),
+			Scheme:                            mgr.GetScheme(),
+			ConfigClient:                      configClient,
+			ClusterResourceNamespace:          clusterResourceNamespace,
+			ClusterIssuerSecretNamespace:      clusterIssuerSecretNamespace,
+			SignerBuilder:                     signer.CommandSignerFromIssuerAndSecretData,
+			SecretAccessGrantedAtClusterLevel: secretAccessGrantedAtClusterLevel,
+			Clock:                             clock.RealClock{},
+			SignerDomain:                      certificateSigningRequestSignerDomain,
+			RequestIDHeader:                   requestIDHeader,
+			CommandInsecureSkipVerify:         commandInsecureSkipVerify,
+			UserAgentSuffix:                   userAgentSuffix,
+			ClusterName:                       clusterName,
+			TransportOptions:                  transportOptions,
+			CircuitBreaker:                    circuitBreaker,
+			RateLimiter:                       commandRateLimiter,
+			IssuerStatusHandler:               issuerStatusHandler,
+			CSRLimits:                         signer.CSRLimits{MaxSANs: maxCSRSANs, MaxSize: maxCSRSize},
+			SchemaCache:                       schemaCache,
+			CAChainCache:                      caChainCache,
+			EnrollmentPollInterval:            enrollmentPollInterval,
+			Recorder:                          mgr.GetEventRecorderFor("command-issuer"),
+			ClockSkewTolerance:                clockSkewTolerance,
+			WatchNamespaces:                   watchedNamespaces,
+			DisableClusterIssuers:             !enableClusterIssuers,
+			ShutdownGracePeriod:               shutdownGracePeriod,
+			AuditLogger:                       auditLogger,
+			EnrollmentNotifier:                enrollmentNotifier,
+			IssuerLimiter:                     issuerLimiter,
+			MaxConditionMessageLength:         maxConditionMessageLength,
+			Backpressure:                      backpressure,
+			SubjectAccessReviews:              kubeClient.AuthorizationV1().SubjectAccessReviews(),
+			Timeout:                           certificateRequestTimeout,
+			MaxEnrollmentAttempts:             maxEnrollmentAttempts,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CertificateSigningRequest")
+			os.Exit(1)
+		}
+	}
+	if enableWebhooks {
+		if err = (&commandissuerv1alpha1.Issuer{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Issuer")
+			os.Exit(1)
+		}
+		if err = (&commandissuerv1alpha1.ClusterIssuer{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterIssuer")
+			os.Exit(1)
+		}
+		if certificateRequestDefaultsConfigMap != "" {
+			if err = (&controllers.CertificateRequestDefaulter{
+				Reader:    mgr.GetAPIReader(),
+				ConfigMap: types.NamespacedName{Namespace: clusterResourceNamespace, Name: certificateRequestDefaultsConfigMap},
+			}).SetupWebhookWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create webhook", "webhook", "CertificateRequest")
+				os.Exit(1)
+			}
+		}
+	} else if certificateRequestDefaultsConfigMap != "" {
+		setupLog.Info("WARNING: --certificate-request-defaults-configmap is ignored without --enable-webhooks")
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -192,6 +851,60 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	commandReadinessChecker := &controllers.CommandReadinessChecker{
+		Client:                            mgr.GetClient(),
+		Clock:                             clock.RealClock{},
+		Interval:                          commandReadinessInterval,
+		ConfigClient:                      configClient,
+		ClusterResourceNamespace:          clusterResourceNamespace,
+		ClusterIssuerSecretNamespace:      clusterIssuerSecretNamespace,
+		SecretAccessGrantedAtClusterLevel: secretAccessGrantedAtClusterLevel,
+		DisableClusterIssuers:             !enableClusterIssuers,
+	}
+	// Command is probed in the background, so that the readiness endpoint doesn't wait for it
+	if err := mgr.Add(commandReadinessChecker); err != nil {
+		setupLog.Error(err, "unable to set up Command ready check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("command", commandReadinessChecker.Check); err != nil {
+		setupLog.Error(err, "unable to set up Command ready check")
+		os.Exit(1)
+	}
+
+	if expiryScanInterval > 0 {
+		expiryScanner := &controllers.ExpiringCertificateScanner{
+			Client:                            mgr.GetClient(),
+			ConfigClient:                      configClient,
+			SignerBuilder:                     signer.CommandSignerFromIssuerAndSecretData,
+			Clock:                             clock.RealClock{},
+			Interval:                          expiryScanInterval,
+			Threshold:                         expiryScanThreshold,
+			ClusterResourceNamespace:          clusterResourceNamespace,
+			ClusterIssuerSecretNamespace:      clusterIssuerSecretNamespace,
+			SecretAccessGrantedAtClusterLevel: secretAccessGrantedAtClusterLevel,
+			DisableClusterIssuers:             !enableClusterIssuers,
+			ClusterName:                       clusterName,
+			CommandInsecureSkipVerify:         commandInsecureSkipVerify,
+			UserAgentSuffix:                   userAgentSuffix,
+			TransportOptions:                  transportOptions,
+			CircuitBreaker:                    circuitBreaker,
+			RateLimiter:                       commandRateLimiter,
+		}
+		if expiryScanEvents {
+			expiryScanner.Recorder = mgr.GetEventRecorderFor("command-issuer")
+		}
+		if err := mgr.Add(expiryScanner); err != nil {
+			setupLog.Error(err, "unable to set up the expiry scan")
+			os.Exit(1)
+		}
+	}
+
+	if enrollmentNotifier != nil {
+		if err := mgr.Add(enrollmentNotifier); err != nil {
+			setupLog.Error(err, "unable to set up the enrollment notifications")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -199,3 +912,93 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// zapVerbosity returns the highest logr verbosity enabled by the zap options, which is the level of
+// --zap-log-level, or -1 if only errors are logged. Development logs default to debug logs.
+func zapVerbosity(opts *zap.Options) int {
+	level := opts.Level
+	if level == nil {
+		if opts.Development {
+			return 1
+		}
+		return 0
+	}
+
+	verbosity := -1
+	for verbosity < 127 && level.Enabled(zapcore.Level(-verbosity-1)) {
+		verbosity++
+	}
+	return verbosity
+}
+
+// validateIssuerManifest validates the Issuers and ClusterIssuers in the manifest at path and returns
+// the exit code of the --validate-issuer mode
+func validateIssuerManifest(path string) int {
+	err := manifest.ValidateIssuersFile(path)
+	if err == nil {
+		fmt.Printf("%s: valid\n", path)
+		return 0
+	}
+
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		for _, err := range aggregate.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	return 1
+}
+
+// runSelfTest enrolls a throwaway certificate with the issuer in the manifest at path and returns the
+// exit code of the --self-test mode
+func runSelfTest(ctx context.Context, path string, insecureSkipVerify bool, options signer.SelfTestOptions) int {
+	issuer, err := manifest.LoadIssuerFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	spec := issuer.Spec
+	if insecureSkipVerify {
+		spec = spec.DeepCopy()
+		spec.InsecureSkipVerify = true
+	}
+	options.IssuerName = issuer.Object.GetName()
+	options.IssuerNamespace = issuer.Object.GetNamespace()
+
+	result, err := signer.SelfTest(ctx, spec, issuer.AuthSecretData, issuer.CASecretData, options)
+	if result != nil {
+		fmt.Printf("%s %s: enrolled certificate %q with Command ID %d, serial number %s, expiring %s, and %d CA certificates\n", issuer.Kind, issuer.Object.GetName(), result.CommonName, result.CertificateID, result.SerialNumber, result.NotAfter.UTC().Format(time.RFC3339), result.ChainLength)
+		if result.Revoked {
+			fmt.Printf("%s %s: revoked certificate %d\n", issuer.Kind, issuer.Object.GetName(), result.CertificateID)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: self-test failed: %v\n", issuer.Kind, issuer.Object.GetName(), err)
+		return 1
+	}
+
+	fmt.Printf("%s %s: self-test passed\n", issuer.Kind, issuer.Object.GetName())
+	return 0
+}
+
+// shutdownTimeoutMargin is how much longer than the shutdown grace period the manager waits for its
+// runnables to stop, so that reconciles cancelled at the end of the grace period can return and the
+// leader election lease is released. The Helm chart sets the terminationGracePeriodSeconds of the
+// pod to 10 seconds more than the grace period, so the margin must be shorter than that.
+const shutdownTimeoutMargin = 5 * time.Second
+
+// managerShutdownTimeout returns the GracefulShutdownTimeout of the manager for the shutdown grace
+// period of in-flight reconciles. A zero grace period cancels in-flight reconciles immediately, but
+// the manager still waits for its runnables to stop for the default timeout of controller-runtime
+// rather than disabling the graceful shutdown of the manager, which would skip the release of the
+// leader election lease.
+func managerShutdownTimeout(gracePeriod time.Duration) *time.Duration {
+	if gracePeriod == 0 {
+		return nil
+	}
+	timeout := gracePeriod + shutdownTimeoutMargin
+	return &timeout
+}